@@ -0,0 +1,211 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/templates"
+)
+
+// TemplateStatsResponse reports the statistics recomputed for a template
+type TemplateStatsResponse struct {
+	TemplateID   string   `json:"template_id"`
+	Answers      int      `json:"answers"`
+	SuccessRate  *float64 `json:"success_rate,omitempty"`
+	AvgSolveTime *int64   `json:"avg_solve_time,omitempty"` // seconds
+}
+
+// TemplateStatsListResponse reports the statistics recomputed for every
+// template
+type TemplateStatsListResponse struct {
+	Templates []TemplateStatsResponse `json:"templates"`
+}
+
+// RegisterAdminHandlers mounts the admin endpoints on router, normally the
+// /v1/admin subrouter guarded by Middleware.AdminAuth
+func RegisterAdminHandlers(router *mux.Router, generatorService *service.GeneratorService) {
+	h := &Handler{generatorService: generatorService}
+
+	router.HandleFunc("/templates/recompute-stats", h.RecomputeAllTemplateStats).Methods("POST")
+	router.HandleFunc("/templates/{id}/recompute-stats", h.RecomputeTemplateStats).Methods("POST")
+	router.HandleFunc("/templates/{id}/analyze", h.AnalyzeTemplate).Methods("POST")
+	router.HandleFunc("/templates/{id}/golden", h.CheckGoldenQuestion).Methods("POST")
+}
+
+// AnalyzeTemplateRequest is the optional body of a template analysis. Zero
+// values fall back to templates.DefaultVarietySamples and the template's
+// base difficulty.
+type AnalyzeTemplateRequest struct {
+	Samples    int     `json:"samples"`
+	Difficulty float64 `json:"difficulty"`
+}
+
+// AnalyzeTemplate samples a template's questions and reports how varied
+// they are, flagging templates that keep producing the same few questions
+func (h *Handler) AnalyzeTemplate(w http.ResponseWriter, r *http.Request) {
+	templateID, ok := templateIDVar(w, r)
+	if !ok {
+		return
+	}
+
+	var req AnalyzeTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if req.Samples != 0 && (req.Samples < templates.MinVarietySamples || req.Samples > templates.MaxVarietySamples) {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("samples must be between %d and %d",
+			templates.MinVarietySamples, templates.MaxVarietySamples))
+		return
+	}
+	if req.Difficulty < 0 || req.Difficulty > 1 {
+		writeJSONError(w, http.StatusBadRequest, "difficulty must be between 0.0 and 1.0")
+		return
+	}
+
+	report, err := h.generatorService.Templates().AnalyzeVariety(r.Context(), templates.VarietyRequest{
+		TemplateID: templateID,
+		Samples:    req.Samples,
+		Difficulty: req.Difficulty,
+	})
+	if err != nil {
+		if errors.Is(err, templates.ErrTemplateInvalid) {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		writeTemplateError(w, r, "analyze", err)
+		return
+	}
+
+	if err := WriteJSONResponse(w, report); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write template analysis response", "error", err)
+	}
+}
+
+// GoldenQuestionRequest is the body of a golden question check. Seed is
+// required; a zero difficulty falls back to the template's base difficulty.
+type GoldenQuestionRequest struct {
+	Seed       int64   `json:"seed"`
+	Difficulty float64 `json:"difficulty"`
+	Update     bool    `json:"update"` // Overwrite the fixture with the current question
+}
+
+// CheckGoldenQuestion generates a template's question for a fixed seed and
+// compares it with the stored golden fixture, reporting the drifted fields.
+// The first check of a seed stores the fixture.
+func (h *Handler) CheckGoldenQuestion(w http.ResponseWriter, r *http.Request) {
+	templateID, ok := templateIDVar(w, r)
+	if !ok {
+		return
+	}
+
+	var req GoldenQuestionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if req.Seed == 0 {
+		writeJSONError(w, http.StatusBadRequest, "seed is required")
+		return
+	}
+	if req.Difficulty < 0 || req.Difficulty > 1 {
+		writeJSONError(w, http.StatusBadRequest, "difficulty must be between 0.0 and 1.0")
+		return
+	}
+
+	result, err := h.generatorService.Templates().CheckGolden(r.Context(), templates.GoldenRequest{
+		TemplateID: templateID,
+		Seed:       req.Seed,
+		Difficulty: req.Difficulty,
+		Update:     req.Update,
+	})
+	if err != nil {
+		if errors.Is(err, templates.ErrTemplateInvalid) {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		writeTemplateError(w, r, "check golden question of", err)
+		return
+	}
+
+	if err := WriteJSONResponse(w, result); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write golden question response", "error", err)
+	}
+}
+
+// RecomputeTemplateStats refreshes one template's success rate and
+// average solve time from submitted answers
+func (h *Handler) RecomputeTemplateStats(w http.ResponseWriter, r *http.Request) {
+	templateID, ok := templateIDVar(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := h.generatorService.Templates().RecomputeStats(r.Context(), templateID)
+	if err != nil {
+		writeTemplateError(w, r, "recompute stats for", err)
+		return
+	}
+
+	if err := WriteJSONResponse(w, newTemplateStatsResponse(stats)); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write template stats response", "error", err)
+	}
+}
+
+// RecomputeAllTemplateStats refreshes the statistics of every template
+func (h *Handler) RecomputeAllTemplateStats(w http.ResponseWriter, r *http.Request) {
+	all, err := h.generatorService.Templates().RecomputeAllStats(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Errorw("failed to recompute template stats", "recomputed", len(all), "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to recompute template stats")
+		return
+	}
+
+	response := &TemplateStatsListResponse{Templates: make([]TemplateStatsResponse, 0, len(all))}
+	for _, stats := range all {
+		response.Templates = append(response.Templates, *newTemplateStatsResponse(stats))
+	}
+	if err := WriteJSONResponse(w, response); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write template stats response", "error", err)
+	}
+}
+
+func newTemplateStatsResponse(stats *db.TemplateStats) *TemplateStatsResponse {
+	return &TemplateStatsResponse{
+		TemplateID:   stats.TemplateID,
+		Answers:      stats.Answers,
+		SuccessRate:  stats.SuccessRate,
+		AvgSolveTime: stats.AvgSolveTime,
+	}
+}
+
+// AdminAuth only lets through requests bearing the configured admin token.
+// Without one configured the admin endpoints are disabled altogether,
+// whether or not AuthEnabled is set.
+func (m *Middleware) AdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.cfg.AdminToken == "" {
+			writeJSONError(w, http.StatusForbidden, "admin endpoints are disabled")
+			return
+		}
+		prefix := m.cfg.TokenPrefix
+		if prefix == "" {
+			prefix = "Bearer"
+		}
+		token := extractAuthToken(r, prefix)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(m.cfg.AdminToken)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/apierror"
+	"question-generator-service/pkg/logging"
+)
+
+// SubmitAnswer grades a student's answer to a stored question and updates
+// their BKT mastery for the topic
+func (h *Handler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
+	var req service.AnswerSubmission
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	var missing []string
+	for _, field := range [][2]string{
+		{"student_id", req.StudentID},
+		{"question_id", req.QuestionID},
+		{"topic_id", req.TopicID},
+		{"answer", req.Answer},
+	} {
+		if strings.TrimSpace(field[1]) == "" {
+			missing = append(missing, field[0])
+		}
+	}
+	if len(missing) > 0 {
+		WriteError(w, http.StatusBadRequest, apierror.CodeValidationFailed,
+			"missing required fields: "+strings.Join(missing, ", "), missing)
+		return
+	}
+	if req.ResponseTimeMs < 0 {
+		writeJSONError(w, http.StatusBadRequest, "response_time_ms must not be negative")
+		return
+	}
+
+	result, err := h.generatorService.SubmitAnswer(r.Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrQuestionNotFound):
+			writeJSONError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, service.ErrMasteryUpdateFailed):
+			logging.FromContext(r.Context()).Errorw("answer submission failed", "error", err)
+			writeJSONError(w, http.StatusBadGateway, "mastery update failed")
+		default:
+			logging.FromContext(r.Context()).Errorw("answer submission failed", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "answer submission failed")
+		}
+		return
+	}
+
+	if err := WriteJSONResponse(w, result); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write answer response", "error", err)
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/validator"
+)
+
+// BatchGenerateRequest is the body of a batch generation request
+type BatchGenerateRequest struct {
+	Requests []validator.GenerateQuestionRequest `json:"requests"`
+	// Seed, when set, makes the batch reproducible: items without a seed
+	// of their own get one derived from it and their index in Requests
+	Seed int64 `json:"seed,omitempty"`
+}
+
+// BatchItemResponse is the outcome of one batch item. Question is set on
+// success; otherwise Error, plus Errors when the item failed validation.
+type BatchItemResponse struct {
+	Index    int                               `json:"index"`
+	Question *service.GenerateQuestionResponse `json:"question,omitempty"`
+	Error    string                            `json:"error,omitempty"`
+	Errors   []validator.ValidationError       `json:"errors,omitempty"`
+}
+
+// BatchGenerateResponse lists item results in request order
+type BatchGenerateResponse struct {
+	Results   []BatchItemResponse `json:"results"`
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+}
+
+// GenerateBatch generates a question for every request in the batch. Items
+// that fail validation or generation are reported inline; the batch as a
+// whole only fails when the body is unusable or too large. A debug=true
+// query parameter turns on debug diagnostics for every item.
+func (h *Handler) GenerateBatch(w http.ResponseWriter, r *http.Request) {
+	var req BatchGenerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if len(req.Requests) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "requests must not be empty")
+		return
+	}
+	if max := h.generatorService.MaxBatchSize(); len(req.Requests) > max {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("batch of %d requests exceeds the maximum of %d", len(req.Requests), max))
+		return
+	}
+
+	results := make([]BatchItemResponse, len(req.Requests))
+	var valid []*service.GenerateQuestionRequest
+	var validIndex []int
+	for i := range req.Requests {
+		item := &req.Requests[i]
+		results[i].Index = i
+		validator.AssignRequestID(item)
+		if errs := validator.ValidateRequest(item); len(errs) > 0 {
+			results[i].Error = "request validation failed"
+			results[i].Errors = errs
+			continue
+		}
+		if !allowStageOverrides(r.Context(), item.SkipRAG, item.SkipValidation) {
+			results[i].Error = errExperimentScopeRequired
+			continue
+		}
+		seed := item.Seed
+		if seed == 0 && req.Seed != 0 {
+			// Derive from the index in the request, not among the valid
+			// items, so an invalid item doesn't shift the others' seeds
+			seed = service.DeriveSeed(req.Seed, i)
+		}
+		valid = append(valid, &service.GenerateQuestionRequest{
+			StudentID:           item.StudentID,
+			TopicID:             item.TopicID,
+			ExamType:            item.ExamType,
+			Subject:             item.Subject,
+			Format:              item.Format,
+			RequestedDifficulty: item.RequestedDifficulty,
+			SessionID:           item.SessionID,
+			RequestID:           item.RequestID,
+			Seed:                seed,
+			Debug:               item.Debug || debugRequested(r),
+			Language:            item.Language,
+			SkipRAG:             item.SkipRAG,
+			SkipValidation:      item.SkipValidation,
+		})
+		validIndex = append(validIndex, i)
+	}
+
+	if len(valid) > 0 {
+		generated, err := h.generatorService.GenerateBatch(r.Context(), valid, req.Seed)
+		if err != nil {
+			logging.FromContext(r.Context()).Errorw("batch generation failed", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "batch generation failed")
+			return
+		}
+		for j, item := range generated {
+			i := validIndex[j]
+			results[i].Question = item.Question
+			results[i].Error = item.Error
+		}
+	}
+
+	resp := BatchGenerateResponse{Results: results}
+	for _, item := range results {
+		if item.Question != nil {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+
+	if err := WriteJSONResponse(w, resp); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write batch response", "error", err)
+	}
+}
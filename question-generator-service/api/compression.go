@@ -0,0 +1,150 @@
+package api
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// minCompressSize is the smallest body worth gzipping; below it the gzip
+// header and trailer outweigh the savings
+const minCompressSize = 1024
+
+// compressedContentTypes are already compressed, so gzipping them again
+// only costs CPU
+var compressedContentTypes = []string{
+	"image/", "video/", "audio/", "application/gzip", "application/zip", "application/x-gzip",
+}
+
+// CompressResponses gzips response bodies of at least minCompressSize
+// bytes for clients that accept gzip. Bodies the handler already encoded
+// or whose content type is compressed are passed through untouched, as are
+// connection upgrades such as WebSockets.
+func CompressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip,
+// honouring q=0 exclusions
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter holds back the status and the start of the body until
+// it is known whether the body is worth compressing
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	buf         []byte
+	gz          *gzip.Writer
+	passthrough bool // Decided against compressing; writes go straight through
+	wroteHeader bool // WriteHeader has been called by the handler
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	switch {
+	case w.gz != nil:
+		return w.gz.Write(p)
+	case w.passthrough:
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) < minCompressSize {
+		return len(p), nil
+	}
+	if err := w.start(w.compressible()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// compressible reports whether the response may be gzipped, judging by the
+// headers the handler set
+func (w *gzipResponseWriter) compressible() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	contentType := header.Get("Content-Type")
+	for _, prefix := range compressedContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// start sends the held-back status and body, compressed or not
+func (w *gzipResponseWriter) start(compress bool) error {
+	if compress {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.ResponseWriter.WriteHeader(w.status)
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+		_, err := w.gz.Write(w.buf)
+		w.buf = nil
+		return err
+	}
+
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// Close flushes the response, sending bodies too small to compress as they
+// are
+func (w *gzipResponseWriter) Close() error {
+	switch {
+	case w.gz != nil:
+		return w.gz.Close()
+	case w.passthrough:
+		return nil
+	}
+	if len(w.buf) == 0 && !w.wroteHeader {
+		// The handler wrote nothing; let net/http send its default response
+		w.passthrough = true
+		return nil
+	}
+	return w.start(false)
+}
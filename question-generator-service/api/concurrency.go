@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// concurrencyRetryAfter is the Retry-After hint for requests rejected by
+// the concurrency limit. Unlike a rate limit there is no refill to wait
+// for, only the client's own requests completing.
+const concurrencyRetryAfter = time.Second
+
+// ConcurrencyLimiter caps the requests in flight per key (e.g., IP or
+// token) with a semaphore per key
+type ConcurrencyLimiter struct {
+	sync.Mutex
+	semaphores  map[string]*semaphore
+	maxInFlight int
+}
+
+type semaphore struct {
+	slots    chan struct{}
+	lastSeen time.Time
+}
+
+// NewConcurrencyLimiter creates a limiter allowing maxInFlight requests
+// per key at once
+func NewConcurrencyLimiter(maxInFlight int64) *ConcurrencyLimiter {
+	cl := &ConcurrencyLimiter{
+		semaphores:  make(map[string]*semaphore),
+		maxInFlight: int(maxInFlight),
+	}
+	go cl.cleanupSemaphores()
+	return cl
+}
+
+// cleanupSemaphores evicts keys with nothing in flight that have been idle
+// for a minute, since a fresh semaphore is indistinguishable from them
+func (cl *ConcurrencyLimiter) cleanupSemaphores() {
+	for {
+		time.Sleep(time.Minute)
+		cl.Lock()
+		for key, s := range cl.semaphores {
+			if len(s.slots) == 0 && time.Since(s.lastSeen) > time.Minute {
+				delete(cl.semaphores, key)
+			}
+		}
+		cl.Unlock()
+	}
+}
+
+// Acquire claims a slot for key, returning the func that releases it. It
+// reports false without waiting when key already has the maximum number of
+// requests in flight.
+func (cl *ConcurrencyLimiter) Acquire(key string) (func(), bool) {
+	cl.Lock()
+	defer cl.Unlock()
+
+	s, exists := cl.semaphores[key]
+	if !exists {
+		s = &semaphore{slots: make(chan struct{}, cl.maxInFlight)}
+		cl.semaphores[key] = s
+	}
+	s.lastSeen = time.Now()
+
+	select {
+	case s.slots <- struct{}{}:
+		return func() { <-s.slots }, true
+	default:
+		return nil, false
+	}
+}
+
+// concurrencyKey identifies who a request counts against: its token when
+// auth is enabled, otherwise its client IP. Tokens are not trusted as keys
+// without auth, since a client could then pick a fresh one per request.
+func (m *Middleware) concurrencyKey(r *http.Request) string {
+	if m.cfg.AuthEnabled {
+		if token := extractAuthToken(r, m.cfg.TokenPrefix); token != "" {
+			return "token:" + token
+		}
+	}
+	return "ip:" + m.ClientIP(r)
+}
+
+// LimitConcurrency rejects requests beyond MaxInFlightPerKey in flight for
+// the same IP or token with 429, so that a single client cannot tie up the
+// workers and database pool with slow requests
+func (m *Middleware) LimitConcurrency(next http.Handler) http.Handler {
+	if m.concurrency == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, ok := m.concurrency.Acquire(m.concurrencyKey(r))
+		if !ok {
+			writeTooManyRequests(w, concurrencyRetryAfter)
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
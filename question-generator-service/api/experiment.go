@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+
+	"question-generator-service/pkg/apierror"
+)
+
+// errExperimentScopeRequired is the error of requests overriding pipeline
+// stages without the experiment scope
+const errExperimentScopeRequired = "skip_rag and skip_validation require the experiment scope"
+
+// experimentScopeKey marks the context of requests holding the experiment
+// scope
+type experimentScopeKey struct{}
+
+// ExperimentScope grants the experiment scope to requests bearing the
+// experiment or the admin token, letting them switch stages off with
+// skip_rag and skip_validation. Other requests pass through without it.
+func (m *Middleware) ExperimentScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := m.cfg.TokenPrefix
+		if prefix == "" {
+			prefix = "Bearer"
+		}
+		token := extractAuthToken(r, prefix)
+		if token != "" && (tokenMatches(token, m.cfg.ExperimentToken) || tokenMatches(token, m.cfg.AdminToken)) {
+			r = r.WithContext(context.WithValue(r.Context(), experimentScopeKey{}, true))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tokenMatches compares token with a configured token in constant time. An
+// unconfigured token matches nothing.
+func tokenMatches(token, configured string) bool {
+	return configured != "" && subtle.ConstantTimeCompare([]byte(token), []byte(configured)) == 1
+}
+
+// HasExperimentScope reports whether ExperimentScope granted the request
+// with ctx the experiment scope
+func HasExperimentScope(ctx context.Context) bool {
+	scoped, _ := ctx.Value(experimentScopeKey{}).(bool)
+	return scoped
+}
+
+// allowStageOverrides reports whether a request may skip the stages it
+// asks to: always when it skips none, otherwise only with the scope
+func allowStageOverrides(ctx context.Context, skipRAG, skipValidation bool) bool {
+	return (!skipRAG && !skipValidation) || HasExperimentScope(ctx)
+}
+
+// writeExperimentScopeRequired responds 403 to a request overriding stages
+// without the experiment scope
+func writeExperimentScopeRequired(w http.ResponseWriter) {
+	WriteError(w, http.StatusForbidden, apierror.CodeForbidden, errExperimentScopeRequired, nil)
+}
@@ -1,74 +1,230 @@
 package api
 
 import (
-    "context"
-    "encoding/json"
-    "net/http"
-    "time"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
 
-    "github.com/yourproject/internal/service"
-    "github.com/yourproject/pkg/logger"
+	"github.com/gorilla/mux"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/apierror"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/templates"
+	"question-generator-service/pkg/validator"
 )
 
+// IdempotentReplayHeader is set to "true" on generation responses served
+// from an earlier completed generation with the same request ID
+const IdempotentReplayHeader = "X-Idempotent-Replay"
+
+// Handler serves the REST endpoints backed by the generator service
 type Handler struct {
-    GeneratorService *service.GeneratorService
-    Logger           *logger.Logger
-    RagClient        *service.RagClient
+	generatorService *service.GeneratorService
+}
+
+// RegisterHandlers mounts the API endpoints on router, normally the /v1
+// subrouter
+func RegisterHandlers(router *mux.Router, generatorService *service.GeneratorService) {
+	h := &Handler{generatorService: generatorService}
+
+	router.HandleFunc("/questions/generate/batch", h.GenerateBatch).Methods("POST")
+	router.HandleFunc("/questions/validate", h.ValidateQuestion).Methods("POST")
+	router.HandleFunc("/questions/{id}", h.GetQuestion).Methods("GET")
+	router.HandleFunc("/questions/{id}/solution", h.GetSolution).Methods("GET")
+	router.HandleFunc("/answers", h.SubmitAnswer).Methods("POST")
+	router.HandleFunc("/logs", h.QueryLogs).Methods("GET")
+	router.HandleFunc("/stats", h.GetStats).Methods("GET")
+	router.HandleFunc("/tests/generate", h.GenerateTest).Methods("POST")
+	router.HandleFunc("/tests/generate/stream", h.StreamGenerateTest).Methods("GET")
+	router.HandleFunc("/topics", h.ListTopics).Methods("GET")
+	router.HandleFunc("/templates", h.ListTemplates).Methods("GET")
+	router.HandleFunc("/templates", h.CreateTemplate).Methods("POST")
+	router.HandleFunc("/templates/{id}", h.GetTemplate).Methods("GET")
+	router.HandleFunc("/templates/{id}", h.UpdateTemplate).Methods("PUT")
+	router.HandleFunc("/templates/{id}", h.DeleteTemplate).Methods("DELETE")
+	router.HandleFunc("/templates/{id}/preview", h.PreviewTemplate).Methods("POST")
+}
+
+// PreviewTemplateRequest is the optional body of a template preview. Zero
+// values fall back to the template's base difficulty and a random seed.
+type PreviewTemplateRequest struct {
+	Difficulty float64 `json:"difficulty"`
+	Seed       int64   `json:"seed"`
+}
+
+// PreviewTemplate fills and validates a template without calibrating,
+// logging or counting usage, so authors can check a template before it
+// goes live
+func (h *Handler) PreviewTemplate(w http.ResponseWriter, r *http.Request) {
+	templateID, ok := templateIDVar(w, r)
+	if !ok {
+		return
+	}
+
+	var req PreviewTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if req.Difficulty < 0 || req.Difficulty > 1 {
+		writeJSONError(w, http.StatusBadRequest, "difficulty must be between 0.0 and 1.0")
+		return
+	}
+
+	preview, err := h.generatorService.PreviewTemplate(r.Context(), service.TemplatePreviewRequest{
+		TemplateID: templateID,
+		Difficulty: req.Difficulty,
+		Seed:       req.Seed,
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrTemplateNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if errors.Is(err, templates.ErrTemplateInvalid) {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		logging.FromContext(r.Context()).Errorw("template preview failed", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "template preview failed")
+		return
+	}
+
+	if err := WriteJSONResponse(w, preview); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write template preview response", "error", err)
+	}
+}
+
+// WriteJSONResponse encodes v as the JSON response body. Callers that need a
+// status other than 200 must call WriteHeader first.
+func WriteJSONResponse(w http.ResponseWriter, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v)
+}
+
+// ErrorResponse is the JSON error envelope every handler and middleware
+// responds with
+type ErrorResponse = apierror.Response
+
+// WriteError responds with status and the JSON error envelope, carrying the
+// request's correlation ID. details is omitted when nil.
+func WriteError(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	apierror.Write(w, status, code, message, details)
+}
+
+// writeJSONError responds with status and the error envelope, using the
+// default code for status
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	WriteError(w, status, apierror.CodeForStatus(status), message, nil)
+}
+
+// NotFound responds to requests matching no route with the error envelope
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, http.StatusNotFound, "no route for "+r.URL.Path)
+}
+
+// MethodNotAllowed responds to requests whose path matches a route but not
+// its method with the error envelope
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, http.StatusMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+}
+
+// GenerateQuestion serves POST /v1/questions/generate. It must run behind
+// validator.ValidateGenerateQuestionRequest, which leaves the validated
+// request in the context. A debug=true query parameter, like the debug
+// field, adds the validation breakdown and RAG exemplars to the metadata.
+// skip_rag and skip_validation are refused with 403 unless
+// Middleware.ExperimentScope granted the request the experiment scope.
+func GenerateQuestion(generatorService *service.GeneratorService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		validatedReq, ok := ctx.Value("validated_request").(*validator.GenerateQuestionRequest)
+		if !ok {
+			WriteError(w, http.StatusBadRequest, apierror.CodeValidationFailed, "Request validation failed", nil)
+			return
+		}
+		if !allowStageOverrides(ctx, validatedReq.SkipRAG, validatedReq.SkipValidation) {
+			writeExperimentScopeRequired(w)
+			return
+		}
+
+		response, err := generatorService.GenerateQuestion(ctx, &service.GenerateQuestionRequest{
+			StudentID:           validatedReq.StudentID,
+			TopicID:             validatedReq.TopicID,
+			ExamType:            validatedReq.ExamType,
+			Subject:             validatedReq.Subject,
+			Format:              validatedReq.Format,
+			RequestedDifficulty: validatedReq.RequestedDifficulty,
+			SessionID:           validatedReq.SessionID,
+			RequestID:           validatedReq.RequestID,
+			Seed:                validatedReq.Seed,
+			Debug:               validatedReq.Debug || debugRequested(r),
+			Language:            validatedReq.Language,
+			SkipRAG:             validatedReq.SkipRAG,
+			SkipValidation:      validatedReq.SkipValidation,
+		})
+		if err != nil {
+			logging.FromContext(ctx).Errorw("question generation failed", "error", err)
+			WriteGenerationError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if response.Replayed {
+			w.Header().Set(IdempotentReplayHeader, "true")
+		}
+		w.WriteHeader(http.StatusOK)
+		if err := WriteJSONResponse(w, response); err != nil {
+			logging.FromContext(ctx).Warnw("failed to encode response", "error", err)
+		}
+	})
 }
 
-type GenerateRequest struct {
-    StudentID string `json:"student_id"`
-    Topic     string `json:"topic"`
-    Difficulty string `json:"difficulty"`
+// debugRequested reports whether the debug query parameter asks for
+// diagnostics
+func debugRequested(r *http.Request) bool {
+	debug, _ := strconv.ParseBool(r.URL.Query().Get("debug"))
+	return debug
 }
 
-type GenerateResponse struct {
-    QuestionID string `json:"question_id"`
-    Question   string `json:"question"`
-    Options    []string `json:"options"`
-    QualityScore float64 `json:"quality_score"`
+// GenerationErrorStatus maps a generation error onto an HTTP status: 404
+// when no template covers the request, 422 when the selected template could
+// not be filled or has no text in the requested language, 409 while a
+// background retry of the same request_id is in flight, 504 when no
+// question was ready within the latency budget, and 500 for everything else.
+// The first two are content gaps rather than server faults.
+func GenerationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, templates.ErrNoTemplatesFound):
+		return http.StatusNotFound
+	case errors.Is(err, templates.ErrTemplateInvalid), errors.Is(err, templates.ErrLanguageUnavailable):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, service.ErrRetryInProgress):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrLatencyBudgetExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
 }
 
-func (h *Handler) GenerateQuestion(w http.ResponseWriter, r *http.Request) {
-    var req GenerateRequest
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid request", http.StatusBadRequest)
-        return
-    }
-
-    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-    defer cancel()
-
-    question, err := h.GeneratorService.Generate(ctx, req.StudentID, req.Topic, req.Difficulty)
-    if err != nil {
-        http.Error(w, "Failed to generate question", http.StatusInternalServerError)
-        return
-    }
-
-    ragResp, err := h.RagClient.AssessQuestionQuality(ctx, question.Text)
-    if err != nil {
-        // Log error but continue
-        ragResp = &service.RagResponse{Score: 0.0}
-    }
-
-    logEntry := logger.GenerationLog{
-        StudentID:      req.StudentID,
-        QuestionID:     question.ID,
-        GenerationTime: time.Now(),
-        Parameters: map[string]interface{}{
-            "topic":     req.Topic,
-            "difficulty": req.Difficulty,
-        },
-        Result: question.Text,
-    }
-    h.Logger.Save(logEntry)
-
-    resp := GenerateResponse{
-        QuestionID:   question.ID,
-        Question:     question.Text,
-        Options:      question.Options,
-        QualityScore: ragResp.Score,
-    }
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(resp)
+// WriteGenerationError responds to a failed generation with the status from
+// GenerationErrorStatus. Content gaps carry the error text; timeouts and
+// server faults only a generic message.
+func WriteGenerationError(w http.ResponseWriter, err error) {
+	status := GenerationErrorStatus(err)
+	switch status {
+	case http.StatusInternalServerError:
+		writeJSONError(w, status, "question generation failed")
+		return
+	case http.StatusGatewayTimeout:
+		writeJSONError(w, status, "no question could be generated within the latency budget")
+		return
+	}
+	writeJSONError(w, status, err.Error())
 }
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"question-generator-service/pkg/buildinfo"
+	"question-generator-service/pkg/logging"
+)
+
+// HealthResponse is the body of /health
+type HealthResponse struct {
+	Status    string `json:"status"`
+	Service   string `json:"service"`
+	Version   string `json:"version"`
+	GitSHA    string `json:"git_sha"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	DBVersion string `json:"db_version,omitempty"` // Omitted until the database has answered
+	Timestamp string `json:"timestamp"`
+}
+
+// Health serves the liveness probe along with the build info of the binary
+// and the database server version. The database version is only queried
+// when /health is hit, and is then cached for DBVersionTTL so that probes
+// do not cost a query each; a failed query is retried on the next probe
+// and never fails the liveness check.
+type Health struct {
+	Service      string
+	DBVersion    func(ctx context.Context) (string, error)
+	DBVersionTTL time.Duration
+	Timeout      time.Duration // Bounds the database version query
+
+	mu        sync.Mutex
+	dbVersion string
+	fetchedAt time.Time
+}
+
+// ServeHTTP implements http.Handler
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	info := buildinfo.Get()
+	response := HealthResponse{
+		Status:    "healthy",
+		Service:   h.Service,
+		Version:   info.Version,
+		GitSHA:    info.GitSHA,
+		BuildTime: info.BuildTime,
+		GoVersion: info.GoVersion,
+		DBVersion: h.databaseVersion(r.Context()),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := WriteJSONResponse(w, response); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write health check response", "error", err)
+	}
+}
+
+// databaseVersion returns the cached database version, querying it when
+// the cache is empty or older than DBVersionTTL. The query runs without
+// the lock held, so a slow database never queues other probes behind it.
+func (h *Health) databaseVersion(ctx context.Context) string {
+	if h.DBVersion == nil {
+		return ""
+	}
+
+	h.mu.Lock()
+	cached, fetchedAt := h.dbVersion, h.fetchedAt
+	h.mu.Unlock()
+	if cached != "" && time.Since(fetchedAt) < h.DBVersionTTL {
+		return cached
+	}
+
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+	version, err := h.DBVersion(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Warnw("failed to query database version", "error", err)
+		// Keep reporting a stale version rather than none
+		return cached
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dbVersion, h.fetchedAt = version, time.Now()
+	return version
+}
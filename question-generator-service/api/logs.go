@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/pkg/logging"
+)
+
+// GenerationLogResponse is the trimmed view of a generation log served by
+// /v1/logs. The generated question is only included for verbose queries.
+type GenerationLogResponse struct {
+	ID                   int64     `json:"id"`
+	QuestionID           string    `json:"question_id,omitempty"`
+	StudentID            string    `json:"student_id"`
+	SessionID            string    `json:"session_id,omitempty"`
+	RequestID            string    `json:"request_id,omitempty"`
+	TopicID              string    `json:"topic_id"`
+	ExamType             string    `json:"exam_type"`
+	Subject              string    `json:"subject"`
+	Format               string    `json:"format"`
+	RequestedDifficulty  float64   `json:"requested_difficulty"`
+	CalibratedDifficulty *float64  `json:"calibrated_difficulty,omitempty"`
+	TemplateID           *string   `json:"template_id,omitempty"`
+	RAGAlignmentScore    *float64  `json:"rag_alignment_score,omitempty"`
+	FinalQualityScore    *float64  `json:"final_quality_score,omitempty"`
+	TotalPipelineTimeMs  int       `json:"total_pipeline_time_ms"`
+	Status               string    `json:"status"`
+	ErrorMessage         string    `json:"error_message,omitempty"`
+	RetryCount           int       `json:"retry_count"`
+	CreatedAt            time.Time `json:"created_at"`
+
+	QuestionText  string            `json:"question_text,omitempty"`
+	Options       map[string]string `json:"options,omitempty"`
+	CorrectAnswer string            `json:"correct_answer,omitempty"`
+}
+
+// GenerationLogsResponse is one page of /v1/logs, newest first
+type GenerationLogsResponse struct {
+	Logs       []GenerationLogResponse `json:"logs"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// QueryLogs lists recent generation logs filtered by student_id, status,
+// subject, exam_type and a since/until time range (RFC 3339). Pages of up
+// to limit logs are followed with the returned next_cursor.
+func (h *Handler) QueryLogs(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseLogFilters(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.generatorService.QueryGenerationLogs(r.Context(), filters)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidCursor) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logging.FromContext(r.Context()).Errorw("failed to query generation logs", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to query generation logs")
+		return
+	}
+
+	response := &GenerationLogsResponse{
+		Logs:       make([]GenerationLogResponse, 0, len(page.Logs)),
+		NextCursor: page.NextCursor,
+	}
+	for _, l := range page.Logs {
+		response.Logs = append(response.Logs, GenerationLogResponse{
+			ID:                   l.ID,
+			QuestionID:           l.QuestionID,
+			StudentID:            l.StudentID,
+			SessionID:            l.SessionID,
+			RequestID:            l.RequestID,
+			TopicID:              l.TopicID,
+			ExamType:             l.ExamType,
+			Subject:              l.Subject,
+			Format:               l.Format,
+			RequestedDifficulty:  l.RequestedDifficulty,
+			CalibratedDifficulty: l.CalibratedDifficulty,
+			TemplateID:           l.TemplateID,
+			RAGAlignmentScore:    l.RAGAlignmentScore,
+			FinalQualityScore:    l.FinalQualityScore,
+			TotalPipelineTimeMs:  l.TotalPipelineTimeMs,
+			Status:               l.Status,
+			ErrorMessage:         l.ErrorMessage,
+			RetryCount:           l.RetryCount,
+			CreatedAt:            l.CreatedAt,
+			QuestionText:         l.GeneratedQuestionText,
+			Options:              l.GeneratedOptions,
+			CorrectAnswer:        l.CorrectAnswer,
+		})
+	}
+	if err := WriteJSONResponse(w, response); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write generation logs response", "error", err)
+	}
+}
+
+// parseLogFilters reads the /v1/logs query parameters
+func parseLogFilters(query url.Values) (db.GenerationLogFilters, error) {
+	filters := db.GenerationLogFilters{
+		StudentID: query.Get("student_id"),
+		Status:    query.Get("status"),
+		Subject:   query.Get("subject"),
+		ExamType:  query.Get("exam_type"),
+		Cursor:    query.Get("cursor"),
+	}
+
+	for _, param := range []struct {
+		name string
+		dest *time.Time
+	}{
+		{"since", &filters.Since},
+		{"until", &filters.Until},
+	} {
+		if value := query.Get(param.name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filters, fmt.Errorf("%s must be an RFC 3339 time, got %q", param.name, value)
+			}
+			*param.dest = t
+		}
+	}
+	if !filters.Since.IsZero() && !filters.Until.IsZero() && !filters.Since.Before(filters.Until) {
+		return filters, fmt.Errorf("since must be before until")
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > db.MaxGenerationLogLimit {
+			return filters, fmt.Errorf("limit must be between 1 and %d, got %q", db.MaxGenerationLogLimit, value)
+		}
+		filters.Limit = limit
+	}
+
+	if value := query.Get("verbose"); value != "" {
+		verbose, err := strconv.ParseBool(value)
+		if err != nil {
+			return filters, fmt.Errorf("verbose must be true or false, got %q", value)
+		}
+		filters.Verbose = verbose
+	}
+	return filters, nil
+}
@@ -2,58 +2,112 @@ package api
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
-	"log"
-	"sync/atomic"
+	"go.uber.org/zap"
 	"errors"
+
+	"question-generator-service/internal/config"
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/validator"
 )
 
 var (
-	ErrTooManyRequests = errors.New("too many requests")
+	ErrTooManyRequests      = errors.New("too many requests")
+	ErrRateLimitUnavailable = errors.New("rate limiter unavailable")
 )
 
 // MiddlewareConfig holds configurable params
 type MiddlewareConfig struct {
-	RateLimitPerMinute int64
+	RateLimitPerMinute int64 // Token refill rate per key
+	RateLimitBurst     int64 // Bucket size per key (defaults to RateLimitPerMinute)
+	// RateLimitOverrides maps a path prefix to its own per-minute limit.
+	// The longest matching prefix wins; unmatched paths use RateLimitPerMinute.
+	RateLimitOverrides map[string]int64
+	// RateLimitFailClosed rejects requests when the limiter backend errors
+	// (e.g. Redis unreachable) instead of letting them through
+	RateLimitFailClosed bool
+	// MaxInFlightPerKey caps concurrent requests per IP, or per token when
+	// auth is enabled. Zero leaves concurrency unlimited.
+	MaxInFlightPerKey int64
+	// TrustedProxies lists CIDRs of proxies allowed to set X-Forwarded-For.
+	// Requests from any other peer are identified by RemoteAddr.
+	TrustedProxies []string
 	AuthEnabled        bool
 	AuthHeader         string
 	TokenPrefix        string
+	// AdminToken is the token AdminAuth requires; the admin endpoints are
+	// disabled when it is empty
+	AdminToken string
+	// ExperimentToken, like AdminToken, grants the experiment scope that
+	// lets generate requests skip RAG or validation; empty leaves the scope
+	// to the admin token
+	ExperimentToken string
+	// Settings, when set, supplies the rate limits instead of the fields
+	// above so that configuration reloads apply without a restart
+	Settings *config.Holder
 }
 
-// RateLimiter tracks counts per key (e.g., IP or token)
-// Uses atomic counters for concurrency safety
+// RateLimiter is a per-key (e.g., IP or token) token bucket limiter.
+// Each key holds up to burst tokens which refill continuously at rate per second.
 type RateLimiter struct {
-	sync.RWMutex
+	sync.Mutex
 	visitors map[string]*visitor
-	limit    int64
+	rate     float64 // tokens per second
+	burst    float64
 }
 
 type visitor struct {
 	lastSeen time.Time
-	count    int64
+	tokens   float64
+	rate     float64 // The limit the bucket was last used under
+	burst    float64
 }
 
-func NewRateLimiter(limit int64) *RateLimiter {
-	rl := &RateLimiter{
-		visitors: make(map[string]*visitor),
-		limit:    limit,
-	}
+// NewRateLimiter creates a token bucket limiter refilling ratePerMinute tokens
+// per minute with a maximum of burst tokens per key
+func NewRateLimiter(ratePerMinute, burst int64) *RateLimiter {
+	rl := &RateLimiter{visitors: make(map[string]*visitor)}
+	rl.rate, rl.burst = limitRates(RateLimit{PerMinute: ratePerMinute, Burst: burst})
 	go rl.cleanupVisitors()
 	return rl
 }
 
+// limitRates converts limit into tokens per second and a bucket size,
+// defaulting the burst to the per-minute rate
+func limitRates(limit RateLimit) (float64, float64) {
+	burst := limit.Burst
+	if burst <= 0 {
+		burst = limit.PerMinute
+	}
+	return float64(limit.PerMinute) / 60.0, float64(burst)
+}
+
+// cleanupVisitors evicts keys idle long enough for their bucket to be full again,
+// since a fresh visitor is indistinguishable from them
 func (rl *RateLimiter) cleanupVisitors() {
 	for {
 		time.Sleep(time.Minute)
 		rl.Lock()
 		for key, v := range rl.visitors {
-			if time.Since(v.lastSeen) > time.Minute {
+			idle := time.Minute
+			if v.rate > 0 {
+				if refill := time.Duration(v.burst / v.rate * float64(time.Second)); refill > idle {
+					idle = refill
+				}
+			}
+			if time.Since(v.lastSeen) > idle {
 				delete(rl.visitors, key)
 			}
 		}
@@ -61,38 +115,178 @@ func (rl *RateLimiter) cleanupVisitors() {
 	}
 }
 
+// Allow reports whether a request for key may proceed, consuming a token if so
 func (rl *RateLimiter) Allow(key string) bool {
+	allowed, _ := rl.Reserve(key)
+	return allowed
+}
+
+// Reserve consumes a token for key if one is available. When denied it returns
+// how long until the next token is available.
+func (rl *RateLimiter) Reserve(key string) (bool, time.Duration) {
+	return rl.reserve(key, rl.rate, rl.burst)
+}
+
+// reserve is Reserve under the given refill rate and bucket size. A bucket
+// last used under another limit keeps its tokens: a raised burst adds its
+// extra room to them and a lowered one caps them.
+func (rl *RateLimiter) reserve(key string, rate, burst float64) (bool, time.Duration) {
 	rl.Lock()
 	defer rl.Unlock()
+
+	now := time.Now()
 	v, exists := rl.visitors[key]
 	if !exists {
-		rl.visitors[key] = &visitor{lastSeen: time.Now(), count: 1}
-		return true
+		v = &visitor{lastSeen: now, tokens: burst, rate: rate, burst: burst}
+		rl.visitors[key] = v
+	} else {
+		if burst > v.burst {
+			v.tokens += burst - v.burst
+		}
+		v.rate, v.burst = rate, burst
+		v.tokens += now.Sub(v.lastSeen).Seconds() * rate
+		if v.tokens > burst {
+			v.tokens = burst
+		}
+		v.lastSeen = now
 	}
-	if time.Since(v.lastSeen) > time.Minute {
-		v.count = 0
+
+	if v.tokens >= 1 {
+		v.tokens--
+		return true, 0
 	}
-	v.lastSeen = time.Now()
-	if atomic.LoadInt64(&v.count) >= rl.limit {
-		return false
+	if rate <= 0 {
+		return false, time.Minute
 	}
-	atomic.AddInt64(&v.count, 1)
-	return true
+	return false, time.Duration((1 - v.tokens) / rate * float64(time.Second))
 }
 
-// Extract IP from request taking X-Forwarded-For header into account
-func extractClientIP(r *http.Request) string {
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		ips := strings.Split(xff, ",")
-		return strings.TrimSpace(ips[0])
+// retryAfterSeconds converts a wait into a whole-second Retry-After value
+func retryAfterSeconds(wait time.Duration) string {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
 	}
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	return strconv.FormatInt(seconds, 10)
+}
+
+// writeTooManyRequests rejects a request with a Retry-After hint
+func writeTooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", retryAfterSeconds(wait))
+	writeJSONError(w, http.StatusTooManyRequests, ErrTooManyRequests.Error())
+}
+
+// RateLimit describes a token bucket: PerMinute tokens refill each minute up to Burst
+type RateLimit struct {
+	PerMinute int64
+	Burst     int64
+}
+
+// RateLimiterBackend stores rate limit state. The in-memory backend limits per
+// process; shared backends such as Redis limit across all replicas.
+type RateLimiterBackend interface {
+	// Reserve consumes a token for key under limit. When denied it returns how
+	// long until the next token is available.
+	Reserve(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error)
+}
+
+// MemoryRateLimiterBackend keeps token buckets in process, one per key as
+// in Redis. Every Reserve brings the key's current limit, so a reloaded
+// limit applies to the existing buckets instead of starting fresh ones.
+type MemoryRateLimiterBackend struct {
+	limiter *RateLimiter
+}
+
+// NewMemoryRateLimiterBackend creates an in-process rate limiter backend
+func NewMemoryRateLimiterBackend() *MemoryRateLimiterBackend {
+	return &MemoryRateLimiterBackend{limiter: NewRateLimiter(0, 0)}
+}
+
+// Reserve implements RateLimiterBackend
+func (b *MemoryRateLimiterBackend) Reserve(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	rate, burst := limitRates(limit)
+	allowed, wait := b.limiter.reserve(key, rate, burst)
+	return allowed, wait, nil
+}
+
+// extractClientIP returns the client IP for a request. X-Forwarded-For is only
+// consulted when the direct peer is a trusted proxy; the list is then walked
+// right-to-left, skipping trusted hops, so spoofed entries prepended by the
+// client are ignored. A hop that is not an IP address stops the walk and the
+// peer's own address is used, so garbage never becomes a rate limit key.
+func extractClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		// fallback to raw addr
-		return r.RemoteAddr
+		remoteIP = r.RemoteAddr
+	}
+
+	if !isTrustedProxy(remoteIP, trustedProxies) {
+		return remoteIP
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			return remoteIP
+		}
+		if !isTrustedProxy(hops[i], trustedProxies) {
+			return hops[i]
+		}
+	}
+
+	// Every hop is a trusted proxy; the leftmost is the closest to the client
+	if len(hops) > 0 {
+		return hops[0]
 	}
-	return ip
+	return remoteIP
+}
+
+// isTrustedProxy reports whether ip falls inside one of the trusted CIDRs
+func isTrustedProxy(ip string, trustedProxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses CIDRs (or bare IPs) and skips invalid entries
+func parseTrustedProxies(entries []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			zap.S().Warnw("ignoring invalid trusted proxy", "entry", entry, "error", err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
 }
 
 // Extract Auth Token from Authorization header
@@ -109,27 +303,135 @@ func extractAuthToken(r *http.Request, prefix string) string {
 
 // Middleware is the API middleware container
 type Middleware struct {
-	cfg                MiddlewareConfig
-	ipRateLimiter      *RateLimiter
-	authTokenRateLimiter *RateLimiter
+	cfg         MiddlewareConfig
+	rateLimiter RateLimiterBackend
+	limits      atomic.Value // *rateLimits
+	trustedProxies []*net.IPNet
+	concurrency *ConcurrencyLimiter // nil when concurrency is unlimited
+}
+
+// rateLimits are the limits in force, derived from source when they come
+// from a config.Holder
+type rateLimits struct {
+	source *config.AppConfig
+	ip     RateLimit
+	paths  []pathRateLimit
 }
 
-// NewMiddleware creates middleware instance
-func NewMiddleware(cfg MiddlewareConfig) *Middleware {
+// pathRateLimit applies a dedicated limit to requests under a path prefix
+type pathRateLimit struct {
+	prefix string
+	limit  RateLimit
+}
+
+// NewMiddleware creates middleware instance. A nil backend keeps rate limit
+// state in memory.
+func NewMiddleware(cfg MiddlewareConfig, backend RateLimiterBackend) *Middleware {
+	if backend == nil {
+		backend = NewMemoryRateLimiterBackend()
+	}
 	m := &Middleware{
-		cfg:                cfg,
-		ipRateLimiter:      NewRateLimiter(cfg.RateLimitPerMinute),
-		authTokenRateLimiter: NewRateLimiter(cfg.RateLimitPerMinute),
+		cfg:         cfg,
+		rateLimiter: backend,
+		trustedProxies: parseTrustedProxies(cfg.TrustedProxies),
 	}
+	if cfg.MaxInFlightPerKey > 0 {
+		m.concurrency = NewConcurrencyLimiter(cfg.MaxInFlightPerKey)
+	}
+	m.limits.Store(newRateLimits(cfg.RateLimitPerMinute, cfg.RateLimitBurst, cfg.RateLimitOverrides))
 	return m
 }
 
-// RateLimitByIP limits request rate per IP address
+// currentLimits returns the limits in force, rebuilding them when the
+// settings holder has published a new configuration
+func (m *Middleware) currentLimits() *rateLimits {
+	cached := m.limits.Load().(*rateLimits)
+	if m.cfg.Settings == nil {
+		return cached
+	}
+	cfg := m.cfg.Settings.Get()
+	if cached.source == cfg {
+		return cached
+	}
+	limits := newRateLimits(cfg.RateLimit.PerMinute, cfg.RateLimit.Burst, cfg.RateLimit.PathOverrides)
+	limits.source = cfg
+	m.limits.Store(limits)
+	return limits
+}
+
+func newRateLimits(perMinute, burst int64, overrides map[string]int64) *rateLimits {
+	return &rateLimits{
+		ip:    RateLimit{PerMinute: perMinute, Burst: burst},
+		paths: newPathRateLimits(burst, overrides),
+	}
+}
+
+// newPathRateLimits builds one limit per override, ordered longest prefix
+// first (ties broken alphabetically) so matching is deterministic
+func newPathRateLimits(defaultBurst int64, overrides map[string]int64) []pathRateLimit {
+	limits := make([]pathRateLimit, 0, len(overrides))
+	for prefix, limit := range overrides {
+		burst := defaultBurst
+		if burst <= 0 || burst > limit {
+			burst = limit
+		}
+		limits = append(limits, pathRateLimit{
+			prefix: prefix,
+			limit:  RateLimit{PerMinute: limit, Burst: burst},
+		})
+	}
+	sort.Slice(limits, func(i, j int) bool {
+		if len(limits[i].prefix) != len(limits[j].prefix) {
+			return len(limits[i].prefix) > len(limits[j].prefix)
+		}
+		return limits[i].prefix < limits[j].prefix
+	})
+	return limits
+}
+
+// ClientIP returns the client IP for a request, honouring trusted proxies
+func (m *Middleware) ClientIP(r *http.Request) string {
+	return extractClientIP(r, m.trustedProxies)
+}
+
+// limitForPath returns the most specific limit for a request path and the
+// key scope it is tracked under
+func (m *Middleware) limitForPath(path string) (string, RateLimit) {
+	limits := m.currentLimits()
+	for _, pl := range limits.paths {
+		if strings.HasPrefix(path, pl.prefix) {
+			return "ip:" + pl.prefix + ":", pl.limit
+		}
+	}
+	return "ip:", limits.ip
+}
+
+// allow consults the backend, applying the fail-open/fail-closed policy on
+// backend errors. It writes the rejection response and returns false when the
+// request must not proceed.
+func (m *Middleware) allow(w http.ResponseWriter, r *http.Request, key string, limit RateLimit) bool {
+	allowed, wait, err := m.rateLimiter.Reserve(r.Context(), key, limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Errorw("rate limiter backend error",
+			"fail_closed", m.cfg.RateLimitFailClosed, "error", err)
+		if m.cfg.RateLimitFailClosed {
+			writeJSONError(w, http.StatusServiceUnavailable, ErrRateLimitUnavailable.Error())
+			return false
+		}
+		return true
+	}
+	if !allowed {
+		writeTooManyRequests(w, wait)
+		return false
+	}
+	return true
+}
+
+// RateLimitByIP limits request rate per IP address, using per-path overrides when configured
 func (m *Middleware) RateLimitByIP(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := extractClientIP(r)
-		if !m.ipRateLimiter.Allow(ip) {
-			http.Error(w, ErrTooManyRequests.Error(), http.StatusTooManyRequests)
+		scope, limit := m.limitForPath(r.URL.Path)
+		if !m.allow(w, r, scope+m.ClientIP(r), limit) {
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -145,19 +447,18 @@ func (m *Middleware) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token := extractAuthToken(r, m.cfg.TokenPrefix)
 		if token == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeJSONError(w, http.StatusUnauthorized, "missing auth token")
 			return
 		}
 		// Here put your token validation logic (JWT or OAuth)
 		// For stub: accept any token with length > 5 for demo
 		if len(token) < 6 {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeJSONError(w, http.StatusUnauthorized, "invalid auth token")
 			return
 		}
 
 		// Rate limit by token also to prevent abuse
-		if !m.authTokenRateLimiter.Allow(token) {
-			http.Error(w, ErrTooManyRequests.Error(), http.StatusTooManyRequests)
+		if !m.allow(w, r, "token:"+token, m.currentLimits().ip) {
 			return
 		}
 
@@ -167,23 +468,39 @@ func (m *Middleware) AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// RequestLogger middleware logs request details with correlation ID
+// maxHeaderRequestIDLength bounds X-Request-ID headers, leaving room for
+// the "-<slot>" suffix each test paper question's request ID adds
+var maxHeaderRequestIDLength = validator.MaxRequestIDLength - len(fmt.Sprintf("-%d", service.MaxPaperQuestions))
+
+// RequestLogger middleware logs request details with correlation ID. A
+// missing or malformed X-Request-ID, one request IDs in bodies would be
+// rejected for, is replaced with a fresh UUID, since the header becomes
+// the ID of generated tests and their questions.
 func (m *Middleware) RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := r.Header.Get("X-Request-ID")
-		if requestID == "" {
+		requestID := r.Header.Get(logging.RequestIDHeader)
+		replaced := requestID != "" && !validator.ValidRequestID(requestID, maxHeaderRequestIDLength)
+		if requestID == "" || replaced {
 			requestID = uuid.NewString()
 		}
 		start := time.Now()
-		log.Printf("Start Request: Method=%s Path=%s RemoteIP=%s RequestID=%s", r.Method, r.URL.Path, extractClientIP(r), requestID)
 
-		// Add RequestID to context and response header
+		// Add RequestID to context and response header; downstream code logs
+		// through the request-scoped logger so entries carry request_id
 		ctx := context.WithValue(r.Context(), "request_id", requestID)
-		w.Header().Set("X-Request-ID", requestID)
+		ctx = logging.WithRequestID(ctx, requestID)
+		w.Header().Set(logging.RequestIDHeader, requestID)
+
+		logger := logging.FromContext(ctx)
+		logger.Infow("request started", "method", r.Method, "path", r.URL.Path, "remote_ip", m.ClientIP(r))
+		if replaced {
+			logger.Warnw("replaced malformed request ID header", "header_length", len(r.Header.Get(logging.RequestIDHeader)))
+		}
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 
-		log.Printf("End Request: Method=%s Path=%s RequestID=%s Duration=%s", r.Method, r.URL.Path, requestID, time.Since(start))
+		logger.Infow("request completed", "method", r.Method, "path", r.URL.Path,
+			"duration_ms", time.Since(start).Milliseconds())
 	})
 }
 
@@ -192,8 +509,8 @@ func (m *Middleware) RecoverMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rec := recover(); rec != nil {
-				log.Printf("Recovered from panic: %v", rec)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				logging.FromContext(r.Context()).Errorw("recovered from panic", "panic", rec)
+				writeJSONError(w, http.StatusInternalServerError, "internal server error")
 			}
 		}()
 		next.ServeHTTP(w, r)
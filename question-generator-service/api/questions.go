@@ -0,0 +1,174 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/apierror"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/validator"
+)
+
+// QuestionResponse is a previously generated question as returned by the API
+type QuestionResponse struct {
+	QuestionID    string            `json:"question_id"`
+	TemplateID    string            `json:"template_id"`
+	QuestionText  string            `json:"question_text"`
+	Options       map[string]string `json:"options,omitempty"`
+	CorrectAnswer string            `json:"correct_answer"`
+	SolutionSteps []string          `json:"solution_steps,omitempty"`
+	RenderFormat  string            `json:"render_format"`
+	Difficulty    float64           `json:"difficulty"`
+	Seed          int64             `json:"seed"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+// GetQuestion returns a stored question by the question_id it was served with
+func (h *Handler) GetQuestion(w http.ResponseWriter, r *http.Request) {
+	q, err := h.generatorService.GetQuestion(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, db.ErrQuestionNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		logging.FromContext(r.Context()).Errorw("failed to fetch question", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to fetch question")
+		return
+	}
+
+	response := &QuestionResponse{
+		QuestionID:    q.QuestionID,
+		TemplateID:    q.TemplateID,
+		QuestionText:  q.QuestionText,
+		Options:       q.Options,
+		CorrectAnswer: q.CorrectAnswer,
+		SolutionSteps: q.SolutionSteps,
+		RenderFormat:  q.RenderFormat,
+		Difficulty:    q.Difficulty,
+		Seed:          q.Seed,
+		CreatedAt:     q.CreatedAt,
+	}
+	if err := WriteJSONResponse(w, response); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write question response", "error", err)
+	}
+}
+
+// SolutionResponse is the worked solution of a previously generated question
+type SolutionResponse struct {
+	QuestionID    string   `json:"question_id"`
+	CorrectAnswer string   `json:"correct_answer"`
+	SolutionSteps []string `json:"solution_steps"`
+	RenderFormat  string   `json:"render_format"`
+}
+
+// GetSolution returns the solution steps stored with a generated question
+func (h *Handler) GetSolution(w http.ResponseWriter, r *http.Request) {
+	q, err := h.generatorService.GetQuestion(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, db.ErrQuestionNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		logging.FromContext(r.Context()).Errorw("failed to fetch question solution", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to fetch question solution")
+		return
+	}
+
+	response := &SolutionResponse{
+		QuestionID:    q.QuestionID,
+		CorrectAnswer: q.CorrectAnswer,
+		SolutionSteps: q.SolutionSteps,
+		RenderFormat:  q.RenderFormat,
+	}
+	if response.SolutionSteps == nil {
+		response.SolutionSteps = []string{}
+	}
+	if err := WriteJSONResponse(w, response); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write solution response", "error", err)
+	}
+}
+
+// ValidateQuestionRequest is a hand-written question to score before import
+type ValidateQuestionRequest struct {
+	QuestionText  string            `json:"question_text"`
+	Options       map[string]string `json:"options,omitempty"`
+	CorrectAnswer string            `json:"correct_answer"`
+	AnswerUnit    string            `json:"answer_unit,omitempty"`
+	Format        string            `json:"format,omitempty"` // MCQ with options, NUMERICAL without when empty
+	Subject       string            `json:"subject"`
+	ExamType      string            `json:"exam_type"`
+	TopicID       string            `json:"topic_id,omitempty"`
+}
+
+// ValidateQuestion scores a question authored outside the template system
+// with the validator and, when enabled, the RAG alignment check. Nothing
+// is generated or logged.
+func (h *Handler) ValidateQuestion(w http.ResponseWriter, r *http.Request) {
+	var req ValidateQuestionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if problems := validateQuestionFields(req); len(problems) > 0 {
+		WriteError(w, http.StatusBadRequest, apierror.CodeValidationFailed,
+			"invalid question: "+strings.Join(problems, "; "), problems)
+		return
+	}
+
+	result, err := h.generatorService.ValidateQuestion(r.Context(), service.QuestionValidationRequest{
+		QuestionText:  req.QuestionText,
+		Options:       req.Options,
+		CorrectAnswer: req.CorrectAnswer,
+		AnswerUnit:    req.AnswerUnit,
+		Format:        req.Format,
+		Subject:       req.Subject,
+		ExamType:      req.ExamType,
+		TopicID:       req.TopicID,
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Errorw("question validation failed", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "question validation failed")
+		return
+	}
+
+	if err := WriteJSONResponse(w, result); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write question validation response", "error", err)
+	}
+}
+
+// validateQuestionFields checks the fields of a question to validate,
+// applying the generate endpoint's rules to its subject, exam type and
+// format
+func validateQuestionFields(req ValidateQuestionRequest) []string {
+	var problems []string
+	if strings.TrimSpace(req.QuestionText) == "" {
+		problems = append(problems, "question_text: Question text is required")
+	}
+	if strings.TrimSpace(req.CorrectAnswer) == "" {
+		problems = append(problems, "correct_answer: Correct answer is required")
+	}
+
+	format := req.Format
+	if format == "" {
+		format = "MCQ" // Either default is valid
+	}
+	for _, e := range validator.ValidateRequest(&validator.GenerateQuestionRequest{
+		StudentID:           "-",
+		TopicID:             "-",
+		ExamType:            req.ExamType,
+		Subject:             req.Subject,
+		Format:              format,
+		RequestedDifficulty: 0.5,
+		RequestID:           "-",
+	}) {
+		problems = append(problems, e.Field+": "+e.Message)
+	}
+	return problems
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"question-generator-service/pkg/logging"
+)
+
+// Dependency readiness states reported by /ready
+const (
+	DependencyOK          = "ok"
+	DependencyUnavailable = "unavailable"
+)
+
+// Overall readiness states reported by /ready
+const (
+	ReadinessReady    = "ready"
+	ReadinessDegraded = "degraded" // An optional dependency is down
+	ReadinessNotReady = "not_ready"
+)
+
+// DependencyCheck probes one dependency of the service
+type DependencyCheck struct {
+	Name string
+	// Required dependencies fail readiness when unhealthy; the others only
+	// mark the service degraded
+	Required bool
+	Check    func(ctx context.Context) error
+}
+
+// DependencyStatus is the outcome of one DependencyCheck
+type DependencyStatus struct {
+	Status   string `json:"status"`
+	Required bool   `json:"required"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ReadinessResponse is the body of /ready
+type ReadinessResponse struct {
+	Status    string                      `json:"status"`
+	Service   string                      `json:"service"`
+	Version   string                      `json:"version"`
+	Timestamp string                      `json:"timestamp"`
+	Checks    map[string]DependencyStatus `json:"checks"`
+}
+
+// Readiness serves the readiness probe, running every check concurrently
+// with its own Timeout. It responds 503 when a required dependency is
+// unhealthy and 200 otherwise.
+type Readiness struct {
+	Service string
+	Version string
+	Timeout time.Duration
+	Checks  []DependencyCheck
+}
+
+// ServeHTTP implements http.Handler
+func (rd *Readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response := ReadinessResponse{
+		Status:    ReadinessReady,
+		Service:   rd.Service,
+		Version:   rd.Version,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Checks:    make(map[string]DependencyStatus, len(rd.Checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range rd.Checks {
+		wg.Add(1)
+		go func(check DependencyCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), rd.Timeout)
+			defer cancel()
+
+			status := DependencyStatus{Status: DependencyOK, Required: check.Required}
+			if err := check.Check(ctx); err != nil {
+				logging.FromContext(r.Context()).Warnw("readiness check failed", "check", check.Name, "error", err)
+				status.Status, status.Error = DependencyUnavailable, err.Error()
+			}
+			mu.Lock()
+			response.Checks[check.Name] = status
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	for _, status := range response.Checks {
+		if status.Status == DependencyOK {
+			continue
+		}
+		if status.Required {
+			response.Status = ReadinessNotReady
+			break
+		}
+		response.Status = ReadinessDegraded
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if response.Status == ReadinessNotReady {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	WriteJSONResponse(w, response)
+}
+
+// HTTPHealthCheck returns a check that GETs url and expects a 2xx response
+func HTTPHealthCheck(client *http.Client, url string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("health check returned HTTP %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript atomically refills and consumes a token bucket stored as a
+// hash of {tokens, ts}. Time is read from the Redis server in milliseconds,
+// so replicas with skewed clocks share one timeline, and ts never moves
+// backwards should that clock step back. Returns {allowed (0/1), wait_ms}.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+-- TIME before a write needs effects replication on Redis before 5
+redis.replicate_commands()
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate)
+end
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+elseif rate > 0 then
+	wait = math.ceil((1 - tokens) / rate)
+else
+	wait = 60000
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(math.max(ts, now)))
+if rate > 0 then
+	redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate) + 1000)
+else
+	redis.call('PEXPIRE', KEYS[1], 60000)
+end
+return {allowed, wait}
+`)
+
+// RedisRateLimiter is a RateLimiterBackend sharing token buckets across
+// replicas through Redis
+type RedisRateLimiter struct {
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+// NewRedisRateLimiter creates a Redis-backed rate limiter
+func NewRedisRateLimiter(client redis.UniversalClient) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		client:    client,
+		keyPrefix: "question-generator:ratelimit:",
+	}
+}
+
+// Reserve implements RateLimiterBackend
+func (rl *RedisRateLimiter) Reserve(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	burst := limit.Burst
+	if burst <= 0 {
+		burst = limit.PerMinute
+	}
+	ratePerMs := float64(limit.PerMinute) / float64(time.Minute/time.Millisecond)
+
+	res, err := tokenBucketScript.Run(ctx, rl.client, []string{rl.keyPrefix + key},
+		ratePerMs, burst).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("redis rate limit script failed: %w", err)
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("unexpected redis rate limit reply: %v", res)
+	}
+
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
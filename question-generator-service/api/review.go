@@ -0,0 +1,168 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/apierror"
+	"question-generator-service/pkg/logging"
+)
+
+// FlaggedQuestionResponse is a question queued for human review
+type FlaggedQuestionResponse struct {
+	ID         int64      `json:"id"`
+	QuestionID string     `json:"question_id"`
+	TemplateID string     `json:"template_id"`
+	Reason     string     `json:"reason"`
+	Score      *float64   `json:"score,omitempty"`
+	Details    string     `json:"details,omitempty"`
+	Status     string     `json:"status"`
+	Reviewer   *string    `json:"reviewer,omitempty"`
+	ReviewNote *string    `json:"review_note,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// FlaggedQuestionsResponse is one page of /v1/review/flagged, oldest first
+type FlaggedQuestionsResponse struct {
+	Flags      []FlaggedQuestionResponse `json:"flags"`
+	NextCursor string                    `json:"next_cursor,omitempty"`
+}
+
+// RegisterReviewHandlers mounts the review endpoints on router, normally the
+// /v1/review subrouter guarded by Middleware.AdminAuth
+func RegisterReviewHandlers(router *mux.Router, generatorService *service.GeneratorService) {
+	h := &Handler{generatorService: generatorService}
+
+	router.HandleFunc("/flagged", h.ListFlaggedQuestions).Methods("GET")
+	router.HandleFunc("/{id:[0-9]+}", h.ResolveFlaggedQuestion).Methods("POST")
+}
+
+// ListFlaggedQuestions lists the questions queued for review, pending ones
+// unless status says otherwise, filtered by reason and template_id. Pages
+// of up to limit flags are followed with the returned next_cursor.
+func (h *Handler) ListFlaggedQuestions(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseFlagFilters(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.generatorService.QueryFlaggedQuestions(r.Context(), filters)
+	if err != nil {
+		logging.FromContext(r.Context()).Errorw("failed to query flagged questions", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to query flagged questions")
+		return
+	}
+
+	response := &FlaggedQuestionsResponse{Flags: make([]FlaggedQuestionResponse, 0, len(page.Flags))}
+	for _, f := range page.Flags {
+		response.Flags = append(response.Flags, newFlaggedQuestionResponse(f))
+	}
+	if page.NextCursor != 0 {
+		response.NextCursor = strconv.FormatInt(page.NextCursor, 10)
+	}
+	if err := WriteJSONResponse(w, response); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write flagged questions response", "error", err)
+	}
+}
+
+// ResolveFlaggedQuestion accepts or rejects a pending flag. Rejecting it
+// deactivates the question's template.
+func (h *Handler) ResolveFlaggedQuestion(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid flag id: "+err.Error())
+		return
+	}
+	var review service.Review
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	flag, err := h.generatorService.ResolveFlaggedQuestion(r.Context(), id, review)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnknownVerdict):
+			WriteError(w, http.StatusBadRequest, apierror.CodeValidationFailed, err.Error(), []string{"verdict"})
+		case errors.Is(err, db.ErrFlagNotFound):
+			writeJSONError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, db.ErrFlagResolved):
+			writeJSONError(w, http.StatusConflict, err.Error())
+		default:
+			logging.FromContext(r.Context()).Errorw("failed to resolve flagged question", "flag_id", id, "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to resolve flagged question")
+		}
+		return
+	}
+
+	if err := WriteJSONResponse(w, newFlaggedQuestionResponse(flag)); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write flagged question response", "error", err)
+	}
+}
+
+// parseFlagFilters reads the /v1/review/flagged query parameters
+func parseFlagFilters(query url.Values) (db.FlaggedQuestionFilters, error) {
+	filters := db.FlaggedQuestionFilters{
+		Status:     query.Get("status"),
+		Reason:     query.Get("reason"),
+		TemplateID: query.Get("template_id"),
+	}
+	switch filters.Status {
+	case "":
+		filters.Status = db.FlagStatusPending
+	case db.FlagStatusPending, db.FlagStatusAccepted, db.FlagStatusRejected:
+	default:
+		return filters, fmt.Errorf("status must be %s, %s or %s, got %q",
+			db.FlagStatusPending, db.FlagStatusAccepted, db.FlagStatusRejected, filters.Status)
+	}
+	switch filters.Reason {
+	case "", db.FlagReasonLowRAGAlignment, db.FlagReasonValidationFailed, db.FlagReasonValidationUnavailable:
+	default:
+		return filters, fmt.Errorf("reason must be %s, %s or %s, got %q",
+			db.FlagReasonLowRAGAlignment, db.FlagReasonValidationFailed, db.FlagReasonValidationUnavailable, filters.Reason)
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > db.MaxFlaggedQuestionLimit {
+			return filters, fmt.Errorf("limit must be between 1 and %d, got %q", db.MaxFlaggedQuestionLimit, value)
+		}
+		filters.Limit = limit
+	}
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || cursor < 0 {
+			return filters, fmt.Errorf("%w: %q", db.ErrInvalidCursor, value)
+		}
+		filters.Cursor = cursor
+	}
+	return filters, nil
+}
+
+// newFlaggedQuestionResponse converts a flag row for the API
+func newFlaggedQuestionResponse(f *db.FlaggedQuestion) FlaggedQuestionResponse {
+	return FlaggedQuestionResponse{
+		ID:         f.ID,
+		QuestionID: f.QuestionID,
+		TemplateID: f.TemplateID,
+		Reason:     f.Reason,
+		Score:      f.Score,
+		Details:    f.Details,
+		Status:     f.Status,
+		Reviewer:   f.Reviewer,
+		ReviewNote: f.ReviewNote,
+		CreatedAt:  f.CreatedAt,
+		ResolvedAt: f.ResolvedAt,
+	}
+}
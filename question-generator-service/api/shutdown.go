@@ -0,0 +1,29 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"question-generator-service/pkg/metrics"
+)
+
+// Shutdown stops server gracefully, letting in-flight requests finish until
+// ctx is done, then writes the final metrics summary to metricsDumpPath
+// when one is set. The summary follows the drain so that it counts every
+// request served, and is written even when the drain is cut short.
+func Shutdown(ctx context.Context, server *http.Server, metricsDumpPath string) {
+	if err := server.Shutdown(ctx); err != nil {
+		zap.S().Warnw("server forced to shutdown", "error", err)
+	}
+
+	// Keep the final metrics of runs that may never have been scraped
+	if metricsDumpPath != "" {
+		if err := metrics.WriteSummaryReport(metricsDumpPath); err != nil {
+			zap.S().Errorw("failed to write metrics report", "error", err)
+		} else {
+			zap.S().Infow("wrote metrics report", "path", metricsDumpPath)
+		}
+	}
+}
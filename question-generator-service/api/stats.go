@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/pkg/logging"
+)
+
+// Bounds on the window of GET /v1/stats
+const (
+	DefaultStatsWindow = 24 * time.Hour
+	MaxStatsWindow     = 30 * 24 * time.Hour
+)
+
+// StatsBucketResponse is one point of the /v1/stats series. Averages and
+// rates are null for a bucket without generations.
+type StatsBucketResponse struct {
+	Start              time.Time `json:"start"`
+	Generations        int       `json:"generations"`
+	AvgQualityScore    *float64  `json:"avg_quality_score"`
+	ValidationPassRate *float64  `json:"validation_pass_rate"`
+	RegenerationRate   *float64  `json:"regeneration_rate"`
+	AvgLatencyMs       *float64  `json:"avg_latency_ms"`
+}
+
+// StatsResponse is the body of GET /v1/stats, its series oldest first
+type StatsResponse struct {
+	Window string                `json:"window"`
+	Bucket string                `json:"bucket"`
+	Since  time.Time             `json:"since"`
+	Until  time.Time             `json:"until"`
+	Series []StatsBucketResponse `json:"series"`
+}
+
+// GetStats serves generation quality trends over the last window (a Go
+// duration such as 24h, at most 720h) in hourly or daily buckets, for
+// dashboards
+func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
+	until := time.Now().UTC()
+	window, filters, err := parseStatsQuery(r.URL.Query(), until)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	trends, err := h.generatorService.GetQualityTrends(r.Context(), filters)
+	if err != nil {
+		logging.FromContext(r.Context()).Errorw("failed to query quality trends", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to query quality trends")
+		return
+	}
+
+	response := &StatsResponse{
+		Window: window,
+		Bucket: filters.Bucket,
+		Since:  filters.Since,
+		Until:  filters.Until,
+		Series: make([]StatsBucketResponse, 0, len(trends)),
+	}
+	for _, bucket := range trends {
+		response.Series = append(response.Series, StatsBucketResponse{
+			Start:              bucket.Start,
+			Generations:        bucket.Generations,
+			AvgQualityScore:    bucket.AvgQualityScore,
+			ValidationPassRate: bucket.ValidationPassRate,
+			RegenerationRate:   bucket.RegenerationRate,
+			AvgLatencyMs:       bucket.AvgLatencyMs,
+		})
+	}
+	if err := WriteJSONResponse(w, response); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write stats response", "error", err)
+	}
+}
+
+// parseStatsQuery reads the window and bucket parameters of /v1/stats,
+// returning the window as given alongside the trend filters ending at until
+func parseStatsQuery(query url.Values, until time.Time) (string, db.QualityTrendFilters, error) {
+	filters := db.QualityTrendFilters{Until: until, Bucket: db.TrendBucketHour}
+
+	window := query.Get("window")
+	duration := DefaultStatsWindow
+	if window == "" {
+		window = "24h"
+	} else {
+		d, err := time.ParseDuration(window)
+		if err != nil || d < time.Hour || d > MaxStatsWindow {
+			return window, filters, fmt.Errorf("window must be a duration between 1h and 720h, got %q", window)
+		}
+		duration = d
+	}
+	filters.Since = until.Add(-duration)
+
+	switch bucket := query.Get("bucket"); bucket {
+	case "":
+	case db.TrendBucketHour, db.TrendBucketDay:
+		filters.Bucket = bucket
+	default:
+		return window, filters, fmt.Errorf("bucket must be %s or %s, got %q", db.TrendBucketHour, db.TrendBucketDay, bucket)
+	}
+	return window, filters, nil
+}
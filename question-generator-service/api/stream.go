@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/logging"
+)
+
+const (
+	// streamWriteTimeout bounds each message written to a stream, and how
+	// long the client has to send its blueprint
+	streamWriteTimeout = 10 * time.Second
+	// maxStreamBlueprintSize bounds the blueprint message
+	maxStreamBlueprintSize = 1 << 20
+)
+
+// Types of a TestStreamMessage
+const (
+	StreamMessageProgress = "progress"
+	StreamMessageSummary  = "summary"
+	StreamMessageError    = "error"
+)
+
+// TestStreamMessage is one message of a test generation stream: a progress
+// event per slot, then either a summary carrying the paper or an error.
+// Progress fields are inlined into the message.
+type TestStreamMessage struct {
+	Type string `json:"type"`
+	*service.PaperProgress
+	Paper *service.TestPaper `json:"paper,omitempty"` // Summary only
+	Error string             `json:"error,omitempty"` // Error only
+}
+
+// streamUpgrader accepts same-origin and non-browser clients only
+var streamUpgrader = websocket.Upgrader{ReadBufferSize: 4096, WriteBufferSize: 4096}
+
+// StreamGenerateTest is GenerateTest over a WebSocket. The client sends the
+// blueprint as the first message and receives a progress message as each
+// slot is generated or fails, then a summary with the whole paper, after
+// which the server closes the stream. Closing the stream early cancels the
+// generation.
+func (h *Handler) StreamGenerateTest(w http.ResponseWriter, r *http.Request) {
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade has replied with an HTTP error
+	}
+	defer conn.Close()
+	// The server's timeouts were meant for a single response, not a stream
+	conn.NetConn().SetDeadline(time.Time{})
+
+	conn.SetReadLimit(maxStreamBlueprintSize)
+	conn.SetReadDeadline(time.Now().Add(streamWriteTimeout))
+	var blueprint service.TestBlueprint
+	if err := conn.ReadJSON(&blueprint); err != nil {
+		closeStream(conn, websocket.CloseUnsupportedData, "invalid request body: "+err.Error())
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	if problems := validateBlueprintFields(blueprint); len(problems) > 0 {
+		closeStream(conn, websocket.ClosePolicyViolation, "invalid test blueprint: "+strings.Join(problems, "; "))
+		return
+	}
+
+	// Nothing more is expected from the client; reading on notices it
+	// going away, which cancels the generation
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	paper, err := h.generatorService.GenerateTestWithProgress(ctx, blueprint, func(event service.PaperProgress) {
+		if err := writeStreamMessage(conn, TestStreamMessage{Type: StreamMessageProgress, PaperProgress: &event}); err != nil {
+			cancel()
+		}
+	})
+	switch {
+	case ctx.Err() != nil:
+		return // The client is gone
+	case errors.Is(err, service.ErrInvalidBlueprint):
+		closeStream(conn, websocket.ClosePolicyViolation, err.Error())
+		return
+	case err != nil:
+		logging.FromContext(ctx).Errorw("streamed test generation failed", "error", err)
+		closeStream(conn, websocket.CloseInternalServerErr, "test generation failed")
+		return
+	}
+
+	if err := writeStreamMessage(conn, TestStreamMessage{Type: StreamMessageSummary, Paper: paper}); err != nil {
+		logging.FromContext(ctx).Warnw("failed to write test summary", "error", err)
+		return
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(streamWriteTimeout))
+}
+
+// writeStreamMessage writes one message, giving up after streamWriteTimeout
+func writeStreamMessage(conn *websocket.Conn, message TestStreamMessage) error {
+	conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return conn.WriteJSON(message)
+}
+
+// closeStream sends message as an error and closes the stream with code.
+// The message goes in its own frame since close reasons are limited to 123
+// bytes.
+func closeStream(conn *websocket.Conn, code int, message string) {
+	if err := writeStreamMessage(conn, TestStreamMessage{Type: StreamMessageError, Error: message}); err != nil {
+		return
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(streamWriteTimeout))
+}
@@ -0,0 +1,404 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/pkg/apierror"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/templates"
+)
+
+// TemplateRequest is the body of template create and update requests.
+// variable_slots, options_template and options_template_hi are embedded
+// JSON, not strings.
+type TemplateRequest struct {
+	TemplateID         string                 `json:"template_id,omitempty"`
+	TopicID            string                 `json:"topic_id"`
+	ExamType           string                 `json:"exam_type"`
+	Subject            string                 `json:"subject"`
+	Format             string                 `json:"format"`
+	TemplateText       string                 `json:"template_text"`
+	TemplateTextHi     *string                `json:"template_text_hi,omitempty"`
+	VariableSlots      json.RawMessage        `json:"variable_slots"`
+	OptionsTemplate    json.RawMessage        `json:"options_template,omitempty"`
+	OptionsTemplateHi  json.RawMessage        `json:"options_template_hi,omitempty"`
+	AnswerUnit         *string                `json:"answer_unit,omitempty"`
+	AnswerFormula      *string                `json:"answer_formula,omitempty"`
+	NumericalTolerance *db.NumericalTolerance `json:"numerical_tolerance,omitempty"`
+	AnswerPrecision    *int                   `json:"answer_precision,omitempty"`
+	RenderFormat       string                 `json:"render_format,omitempty"`
+	BaseDifficulty     float64                `json:"base_difficulty"`
+	BloomLevel         int                    `json:"bloom_level"`
+	ConceptDepth       int                    `json:"concept_depth"`
+	Chapter            string                 `json:"chapter"`
+	SubChapter         *string                `json:"sub_chapter,omitempty"`
+	NCERTReference     *string                `json:"ncert_reference,omitempty"`
+}
+
+// TemplateResponse is a stored template as returned by the API
+type TemplateResponse struct {
+	TemplateID         string                 `json:"template_id"`
+	TopicID            string                 `json:"topic_id"`
+	ExamType           string                 `json:"exam_type"`
+	Subject            string                 `json:"subject"`
+	Format             string                 `json:"format"`
+	TemplateText       string                 `json:"template_text"`
+	TemplateTextHi     *string                `json:"template_text_hi,omitempty"`
+	VariableSlots      json.RawMessage        `json:"variable_slots"`
+	OptionsTemplate    json.RawMessage        `json:"options_template,omitempty"`
+	OptionsTemplateHi  json.RawMessage        `json:"options_template_hi,omitempty"`
+	AnswerUnit         *string                `json:"answer_unit,omitempty"`
+	AnswerFormula      *string                `json:"answer_formula,omitempty"`
+	NumericalTolerance *db.NumericalTolerance `json:"numerical_tolerance,omitempty"`
+	AnswerPrecision    *int                   `json:"answer_precision,omitempty"`
+	RenderFormat       string                 `json:"render_format"`
+	BaseDifficulty     float64                `json:"base_difficulty"`
+	BloomLevel         int                    `json:"bloom_level"`
+	ConceptDepth       int                    `json:"concept_depth"`
+	ValidationScore    *float64               `json:"validation_score,omitempty"`
+	AmbiguityFlag      bool                   `json:"ambiguity_flag"`
+	ClarityScore       *float64               `json:"clarity_score,omitempty"`
+	Chapter            string                 `json:"chapter"`
+	SubChapter         *string                `json:"sub_chapter,omitempty"`
+	NCERTReference     *string                `json:"ncert_reference,omitempty"`
+	UsageCount         int                    `json:"usage_count"`
+	SuccessRate        *float64               `json:"success_rate,omitempty"`
+	AvgSolveTime       *int64                 `json:"avg_solve_time,omitempty"`
+	CreatedAt          time.Time              `json:"created_at"`
+	UpdatedAt          time.Time              `json:"updated_at"`
+	IsActive           bool                   `json:"is_active"`
+	Version            int                    `json:"version"`
+}
+
+// toModel converts the request into a template row
+func (req *TemplateRequest) toModel() *db.QuestionTemplate {
+	qt := &db.QuestionTemplate{
+		TemplateID:         req.TemplateID,
+		TopicID:            req.TopicID,
+		ExamType:           req.ExamType,
+		Subject:            req.Subject,
+		Format:             req.Format,
+		TemplateText:       req.TemplateText,
+		TemplateTextHi:     req.TemplateTextHi,
+		VariableSlots:      string(req.VariableSlots),
+		AnswerUnit:         req.AnswerUnit,
+		AnswerFormula:      req.AnswerFormula,
+		NumericalTolerance: req.NumericalTolerance,
+		AnswerPrecision:    req.AnswerPrecision,
+		RenderFormat:       req.RenderFormat,
+		BaseDifficulty:     req.BaseDifficulty,
+		BloomLevel:         req.BloomLevel,
+		ConceptDepth:       req.ConceptDepth,
+		Chapter:            req.Chapter,
+		SubChapter:         req.SubChapter,
+		NCERTReference:     req.NCERTReference,
+	}
+	if qt.VariableSlots == "" {
+		qt.VariableSlots = "[]"
+	}
+	qt.OptionsTemplate = rawJSONString(req.OptionsTemplate)
+	qt.OptionsTemplateHi = rawJSONString(req.OptionsTemplateHi)
+	return qt
+}
+
+// newTemplateResponse converts a template row for the API
+func newTemplateResponse(qt *db.QuestionTemplate) *TemplateResponse {
+	resp := &TemplateResponse{
+		TemplateID:         qt.TemplateID,
+		TopicID:            qt.TopicID,
+		ExamType:           qt.ExamType,
+		Subject:            qt.Subject,
+		Format:             qt.Format,
+		TemplateText:       qt.TemplateText,
+		TemplateTextHi:     qt.TemplateTextHi,
+		VariableSlots:      json.RawMessage(qt.VariableSlots),
+		AnswerUnit:         qt.AnswerUnit,
+		AnswerFormula:      qt.AnswerFormula,
+		NumericalTolerance: qt.NumericalTolerance,
+		AnswerPrecision:    qt.AnswerPrecision,
+		RenderFormat:       qt.RenderFormat,
+		BaseDifficulty:     qt.BaseDifficulty,
+		BloomLevel:         qt.BloomLevel,
+		ConceptDepth:       qt.ConceptDepth,
+		ValidationScore:    qt.ValidationScore,
+		AmbiguityFlag:      qt.AmbiguityFlag,
+		ClarityScore:       qt.ClarityScore,
+		Chapter:            qt.Chapter,
+		SubChapter:         qt.SubChapter,
+		NCERTReference:     qt.NCERTReference,
+		UsageCount:         qt.UsageCount,
+		SuccessRate:        qt.SuccessRate,
+		AvgSolveTime:       qt.AvgSolveTime,
+		CreatedAt:          qt.CreatedAt,
+		UpdatedAt:          qt.UpdatedAt,
+		IsActive:           qt.IsActive,
+		Version:            qt.Version,
+	}
+	if qt.OptionsTemplate != nil {
+		resp.OptionsTemplate = json.RawMessage(*qt.OptionsTemplate)
+	}
+	if qt.OptionsTemplateHi != nil {
+		resp.OptionsTemplateHi = json.RawMessage(*qt.OptionsTemplateHi)
+	}
+	return resp
+}
+
+// rawJSONString returns embedded JSON as a string, or nil when it is absent
+// or null
+func rawJSONString(raw json.RawMessage) *string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	s := string(raw)
+	return &s
+}
+
+// CreateTemplate stores a new template
+func (h *Handler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var req TemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	qt := req.toModel()
+	if err := h.generatorService.Templates().CreateTemplate(r.Context(), qt); err != nil {
+		writeTemplateError(w, r, "create", err)
+		return
+	}
+
+	w.Header().Set("Location", "/v1/templates/"+qt.TemplateID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := WriteJSONResponse(w, newTemplateResponse(qt)); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write template response", "error", err)
+	}
+}
+
+// GetTemplate returns an active template
+func (h *Handler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	templateID, ok := templateIDVar(w, r)
+	if !ok {
+		return
+	}
+
+	qt, err := h.generatorService.Templates().GetTemplate(r.Context(), templateID)
+	if err != nil {
+		writeTemplateError(w, r, "fetch", err)
+		return
+	}
+
+	if err := WriteJSONResponse(w, newTemplateResponse(qt)); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write template response", "error", err)
+	}
+}
+
+// UpdateTemplate replaces the content of an active template. The ID in the
+// path wins over any template_id in the body.
+func (h *Handler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	templateID, ok := templateIDVar(w, r)
+	if !ok {
+		return
+	}
+
+	var req TemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	req.TemplateID = templateID
+
+	qt := req.toModel()
+	if err := h.generatorService.Templates().UpdateTemplate(r.Context(), qt); err != nil {
+		writeTemplateError(w, r, "update", err)
+		return
+	}
+
+	if err := WriteJSONResponse(w, newTemplateResponse(qt)); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write template response", "error", err)
+	}
+}
+
+// DeleteTemplate soft-deletes a template so it is no longer served
+func (h *Handler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	templateID, ok := templateIDVar(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.generatorService.Templates().DeactivateTemplate(r.Context(), templateID); err != nil {
+		writeTemplateError(w, r, "delete", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// templateIDVar returns the template ID in the request path, responding
+// 400 when it is not a UUID. Template IDs are UUID columns, so anything
+// else would fail in the database instead of reading as a bad request.
+func templateIDVar(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid template ID %q", id))
+		return "", false
+	}
+	return id, true
+}
+
+// writeTemplateError maps template service errors to HTTP responses
+func writeTemplateError(w http.ResponseWriter, r *http.Request, action string, err error) {
+	var validationErr *templates.TemplateValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		WriteError(w, http.StatusBadRequest, apierror.CodeValidationFailed, "invalid template", validationErr.Fields)
+	case errors.Is(err, db.ErrTemplateNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, db.ErrTemplateExists):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	default:
+		logging.FromContext(r.Context()).Errorw("template request failed", "action", action, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to "+action+" template")
+	}
+}
+
+// TemplateSummaryResponse is a template as listed by GET /v1/templates,
+// without its variables and options
+type TemplateSummaryResponse struct {
+	TemplateID     string    `json:"template_id"`
+	TopicID        string    `json:"topic_id"`
+	ExamType       string    `json:"exam_type"`
+	Subject        string    `json:"subject"`
+	Format         string    `json:"format"`
+	TemplateText   string    `json:"template_text"`
+	BaseDifficulty float64   `json:"base_difficulty"`
+	BloomLevel     int       `json:"bloom_level"`
+	Chapter        string    `json:"chapter"`
+	SubChapter     *string   `json:"sub_chapter,omitempty"`
+	NCERTReference *string   `json:"ncert_reference,omitempty"`
+	UsageCount     int       `json:"usage_count"`
+	IsActive       bool      `json:"is_active"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TemplatesResponse is one page of GET /v1/templates, ordered by template ID
+type TemplatesResponse struct {
+	Templates  []TemplateSummaryResponse `json:"templates"`
+	NextCursor string                    `json:"next_cursor,omitempty"`
+}
+
+// ListTemplates searches templates by subject, exam_type, topic_id,
+// chapter, bloom_level, a min_difficulty/max_difficulty range, the active
+// flag, ncert, a case-insensitive snippet of the NCERT reference, and q, a
+// case-insensitive snippet of the template text. Pages of up
+// to limit templates are followed with the returned next_cursor.
+func (h *Handler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	search, err := parseTemplateSearch(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.generatorService.Templates().SearchTemplates(r.Context(), search)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidCursor) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeTemplateError(w, r, "search", err)
+		return
+	}
+
+	response := &TemplatesResponse{
+		Templates:  make([]TemplateSummaryResponse, 0, len(page.Templates)),
+		NextCursor: page.NextCursor,
+	}
+	for _, qt := range page.Templates {
+		response.Templates = append(response.Templates, TemplateSummaryResponse{
+			TemplateID:     qt.TemplateID,
+			TopicID:        qt.TopicID,
+			ExamType:       qt.ExamType,
+			Subject:        qt.Subject,
+			Format:         qt.Format,
+			TemplateText:   qt.TemplateText,
+			BaseDifficulty: qt.BaseDifficulty,
+			BloomLevel:     qt.BloomLevel,
+			Chapter:        qt.Chapter,
+			SubChapter:     qt.SubChapter,
+			NCERTReference: qt.NCERTReference,
+			UsageCount:     qt.UsageCount,
+			IsActive:       qt.IsActive,
+			UpdatedAt:      qt.UpdatedAt,
+		})
+	}
+	if err := WriteJSONResponse(w, response); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write templates response", "error", err)
+	}
+}
+
+// parseTemplateSearch reads the GET /v1/templates query parameters
+func parseTemplateSearch(query url.Values) (db.TemplateSearch, error) {
+	search := db.TemplateSearch{
+		Subject:  query.Get("subject"),
+		ExamType: query.Get("exam_type"),
+		TopicID:  query.Get("topic_id"),
+		Chapter:  query.Get("chapter"),
+		Text:     strings.TrimSpace(query.Get("q")),
+		NCERT:    strings.TrimSpace(query.Get("ncert")),
+		Cursor:   query.Get("cursor"),
+	}
+
+	if value := query.Get("bloom_level"); value != "" {
+		level, err := strconv.Atoi(value)
+		if err != nil || level < 1 || level > 6 {
+			return search, fmt.Errorf("bloom_level must be between 1 and 6, got %q", value)
+		}
+		search.BloomLevel = level
+	}
+
+	for _, param := range []struct {
+		name string
+		dest *float64
+	}{
+		{"min_difficulty", &search.MinDifficulty},
+		{"max_difficulty", &search.MaxDifficulty},
+	} {
+		if value := query.Get(param.name); value != "" {
+			difficulty, err := strconv.ParseFloat(value, 64)
+			if err != nil || difficulty < 0 || difficulty > 1 {
+				return search, fmt.Errorf("%s must be between 0 and 1, got %q", param.name, value)
+			}
+			*param.dest = difficulty
+		}
+	}
+	if search.MaxDifficulty > 0 && search.MinDifficulty > search.MaxDifficulty {
+		return search, fmt.Errorf("min_difficulty must not exceed max_difficulty")
+	}
+
+	if value := query.Get("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return search, fmt.Errorf("active must be true or false, got %q", value)
+		}
+		search.Active = &active
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > db.MaxTemplateSearchLimit {
+			return search, fmt.Errorf("limit must be between 1 and %d, got %q", db.MaxTemplateSearchLimit, value)
+		}
+		search.Limit = limit
+	}
+	return search, nil
+}
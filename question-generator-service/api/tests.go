@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/apierror"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/validator"
+)
+
+// GenerateTest assembles a full mock test from a blueprint of per-subject
+// question counts, topic weights and a target difficulty histogram. Slots
+// that could not be generated are listed under failures; the test as a
+// whole only fails when the blueprint is unusable.
+func (h *Handler) GenerateTest(w http.ResponseWriter, r *http.Request) {
+	var blueprint service.TestBlueprint
+	if err := json.NewDecoder(r.Body).Decode(&blueprint); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if problems := validateBlueprintFields(blueprint); len(problems) > 0 {
+		WriteError(w, http.StatusBadRequest, apierror.CodeValidationFailed,
+			"invalid test blueprint: "+strings.Join(problems, "; "), problems)
+		return
+	}
+
+	paper, err := h.generatorService.GenerateTest(r.Context(), blueprint)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidBlueprint) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logging.FromContext(r.Context()).Errorw("test generation failed", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "test generation failed")
+		return
+	}
+
+	if err := WriteJSONResponse(w, paper); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write test response", "error", err)
+	}
+}
+
+// validateBlueprintFields applies the generate endpoint's field and business
+// rules to every subject and topic of the blueprint, reporting each problem
+// once
+func validateBlueprintFields(blueprint service.TestBlueprint) []string {
+	format := blueprint.Format
+	if format == "" {
+		format = "MCQ"
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	for i, section := range blueprint.Sections {
+		topics := make([]string, 0, len(section.Topics))
+		for topic := range section.Topics {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+		if len(topics) == 0 {
+			topics = []string{"-"} // Still check the subject; the service reports the missing topics
+		}
+
+		for _, topic := range topics {
+			errs := validator.ValidateRequest(&validator.GenerateQuestionRequest{
+				StudentID:           blueprint.StudentID,
+				TopicID:             topic,
+				ExamType:            blueprint.ExamType,
+				Subject:             section.Subject,
+				Format:              format,
+				RequestedDifficulty: 0.5,
+				RequestID:           "-", // Each generated question gets its own, derived from the X-Request-ID RequestLogger checked
+			})
+			for _, e := range errs {
+				problem := e.Field + ": " + e.Message
+				if e.Field == "subject" || e.Field == "topic_id" {
+					problem = fmt.Sprintf("sections[%d].%s", i, problem)
+				}
+				if !seen[problem] {
+					seen[problem] = true
+					problems = append(problems, problem)
+				}
+			}
+		}
+	}
+	return problems
+}
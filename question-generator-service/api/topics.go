@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/pkg/logging"
+)
+
+// TopicResponse is a topic as listed by GET /v1/topics
+type TopicResponse struct {
+	TopicID       string  `json:"topic_id"`
+	Subject       string  `json:"subject"`
+	TemplateCount int     `json:"template_count"`
+	MinDifficulty float64 `json:"min_difficulty"`
+	MaxDifficulty float64 `json:"max_difficulty"`
+}
+
+// TopicsResponse is the body of GET /v1/topics, ordered by subject and
+// topic ID
+type TopicsResponse struct {
+	Topics []TopicResponse `json:"topics"`
+}
+
+// ListTopics lists the topics that have active templates, optionally
+// narrowed by subject and exam_type, so clients can discover the topic IDs
+// they may request questions for
+func (h *Handler) ListTopics(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	topics, err := h.generatorService.Templates().ListTopics(r.Context(), db.TopicFilters{
+		Subject:  query.Get("subject"),
+		ExamType: query.Get("exam_type"),
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Errorw("failed to list topics", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list topics")
+		return
+	}
+
+	response := &TopicsResponse{Topics: make([]TopicResponse, 0, len(topics))}
+	for _, topic := range topics {
+		response.Topics = append(response.Topics, TopicResponse{
+			TopicID:       topic.TopicID,
+			Subject:       topic.Subject,
+			TemplateCount: topic.TemplateCount,
+			MinDifficulty: topic.MinDifficulty,
+			MaxDifficulty: topic.MaxDifficulty,
+		})
+	}
+	if err := WriteJSONResponse(w, response); err != nil {
+		logging.FromContext(r.Context()).Warnw("failed to write topics response", "error", err)
+	}
+}
@@ -2,18 +2,19 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/cors"
+	"go.uber.org/zap"
 
 	"question-generator-service/internal/config"
 	"question-generator-service/internal/db"
@@ -21,16 +22,20 @@ import (
 	"question-generator-service/api"
 	"question-generator-service/pkg/validator"
 	"question-generator-service/pkg/rag_advisor"
+	"question-generator-service/pkg/buildinfo"
 	"question-generator-service/pkg/logger"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/metrics"
+	"question-generator-service/pkg/templates"
 )
 
-const (
-	serviceName    = "question-generator"
-	serviceVersion = "v1.0.0"
-)
+const serviceName = "question-generator"
 
 func main() {
-	log.Printf("Starting %s service %s", serviceName, serviceVersion)
+	info := buildinfo.Get()
+	log.Printf("Starting %s service %s (%s, built %s, %s)",
+		serviceName, info.Version, info.GitSHA, info.BuildTime, info.GoVersion)
+	metrics.SetServiceInfo(serviceName, info.Version)
 
 	// Load configuration from environment variables
 	cfg, err := config.LoadConfig()
@@ -38,16 +43,37 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Initialize database client with connection pooling
-	dbClient, err := db.NewClient(cfg.Database)
+	// Route all logging, including remaining log.Printf calls, through the
+	// configured structured logger
+	appLogger, err := logging.New(cfg.Logging)
+	if err != nil {
+		log.Fatalf("Failed to initialize logging: %v", err)
+	}
+	defer appLogger.Close()
+	zap.ReplaceGlobals(appLogger.Desugar())
+
+	// Requests are checked against the configured exam types and subjects
+	validator.SetExamSubjects(cfg.Validator.ExamSubjects)
+
+	// Initialize database client with connection pooling, waiting for the
+	// database to come up if it is still starting
+	connectCtx, cancelConnect := context.WithTimeout(context.Background(), cfg.Database.ConnectTimeout)
+	dbClient, err := db.NewClient(connectCtx, cfg.Database)
+	cancelConnect()
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer dbClient.Close()
 
-	// Run database migrations
-	if err := dbClient.RunMigrations(); err != nil {
-		log.Fatalf("Failed to run database migrations: %v", err)
+	// Run database migrations, up to DB_MIGRATION_VERSION when it pins one
+	runMigrations(dbClient, cfg.Database)
+
+	// Prepare the hot-path queries only now that their columns exist
+	prepareStatements(dbClient)
+
+	// Catch templates that would only fail once a student is served them
+	if cfg.Templates.StartupValidation != "OFF" {
+		validateTemplates(dbClient, cfg.Templates.StartupValidation == "FAIL")
 	}
 
 	// Initialize question generation service with all dependencies
@@ -55,15 +81,49 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to initialize generator service: %v", err)
 	}
+	defer generatorService.Close()
+
+	// Pick up the background retries a previous run left pending
+	resumeRetries(generatorService)
+
+	// Preload hot templates so the first requests skip Postgres and parsing
+	if cfg.Templates.WarmupEnabled {
+		warmTemplates(generatorService.Templates(), cfg.Templates.WarmupTopN)
+	}
 
 	// Initialize middleware with configuration
+	// Rate limits are read from the service's settings so SIGHUP reloads apply
 	middlewareConfig := api.MiddlewareConfig{
-		RateLimitPerMinute: 1000, // 1000 requests per minute per IP
+		RateLimitPerMinute: cfg.RateLimit.PerMinute,
+		RateLimitBurst:     cfg.RateLimit.Burst,
+		RateLimitOverrides: cfg.RateLimit.PathOverrides,
+		Settings:           generatorService.Settings(),
+		RateLimitFailClosed: cfg.RateLimit.FailClosed,
+		MaxInFlightPerKey:  cfg.RateLimit.MaxInFlight,
+		TrustedProxies:     cfg.Server.TrustedProxies,
 		AuthEnabled:        false, // Disable auth for Phase 2.2
 		AuthHeader:         "Authorization",
 		TokenPrefix:        "Bearer",
+		AdminToken:         cfg.Server.AdminToken,
+		ExperimentToken:    cfg.Server.ExperimentToken,
 	}
-	middleware := api.NewMiddleware(middlewareConfig)
+
+	// Share rate limit state across replicas when Redis is configured
+	var rateLimiterBackend api.RateLimiterBackend
+	if cfg.RateLimit.Backend == "redis" {
+		redisClient := redis.NewClient(&redis.Options{
+			Addr:         cfg.RateLimit.RedisAddr,
+			Password:     cfg.RateLimit.RedisPassword,
+			DB:           cfg.RateLimit.RedisDB,
+			DialTimeout:  500 * time.Millisecond,
+			ReadTimeout:  200 * time.Millisecond,
+			WriteTimeout: 200 * time.Millisecond,
+		})
+		defer redisClient.Close()
+		rateLimiterBackend = api.NewRedisRateLimiter(redisClient)
+		log.Printf("Using Redis rate limiter backend at %s", cfg.RateLimit.RedisAddr)
+	}
+	middleware := api.NewMiddleware(middlewareConfig, rateLimiterBackend)
 
 	// Initialize logger service
 	loggerService, err := logger.NewService(dbClient)
@@ -73,16 +133,27 @@ func main() {
 
 	// Set up HTTP handlers and middleware chain
 	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(api.NotFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(api.MethodNotAllowed)
 	
 	// Apply global middleware
+	router.Use(metrics.MetricsMiddleware)
+	router.Use(api.CompressResponses)
 	router.Use(middleware.RequestLogger)
 	router.Use(middleware.RecoverMiddleware)
 	router.Use(middleware.RateLimitByIP)
+	router.Use(middleware.LimitConcurrency)
+	router.Use(middleware.ExperimentScope)
 	
 	// Add service discovery and health check endpoints
-	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
-	router.HandleFunc("/ready", readinessCheckHandler(dbClient)).Methods("GET")
-	router.HandleFunc("/metrics", metricsHandler).Methods("GET")
+	router.Handle("/health", &api.Health{
+		Service:      serviceName,
+		DBVersion:    dbClient.ServerVersion,
+		DBVersionTTL: cfg.Server.DBVersionTTL,
+		Timeout:      cfg.Server.ReadinessTimeout,
+	}).Methods("GET")
+	router.Handle("/ready", readinessHandler(cfg, dbClient)).Methods("GET")
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
 	
 	// Mount API routes with versioning
 	apiRouter := router.PathPrefix("/v1").Subrouter()
@@ -93,10 +164,7 @@ func main() {
 			validator.ValidateGenerateQuestionRequest(
 				rag_advisor.AdviseQuality(
 					loggerService.LogRequest(
-						http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-							// Call the generator service method
-							handleGenerateQuestion(generatorService, w, r)
-						}),
+						api.GenerateQuestion(generatorService),
 					),
 				),
 			),
@@ -106,12 +174,23 @@ func main() {
 	// Register other handlers
 	api.RegisterHandlers(apiRouter, generatorService)
 
+	// Admin endpoints require the admin token even while auth is disabled
+	adminRouter := apiRouter.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(middleware.AdminAuth)
+	api.RegisterAdminHandlers(adminRouter, generatorService)
+
+	// Reviewers resolve flagged questions with the admin token too, since
+	// rejecting one deactivates its template
+	reviewRouter := apiRouter.PathPrefix("/review").Subrouter()
+	reviewRouter.Use(middleware.AdminAuth)
+	api.RegisterReviewHandlers(reviewRouter, generatorService)
+
 	// Configure CORS for cross-origin requests
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   cfg.Server.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Request-ID"},
-		ExposedHeaders:   []string{"X-Request-ID", "X-Generation-Time"},
+		ExposedHeaders:   []string{"X-Request-ID", "X-Generation-Time", api.IdempotentReplayHeader},
 		AllowCredentials: true,
 		MaxAge:           300, // 5 minutes preflight cache
 	}).Handler(router)
@@ -133,6 +212,9 @@ func main() {
 		}
 	}()
 
+	// Reload tunable settings on SIGHUP
+	go reloadOnSIGHUP(generatorService.Settings(), appLogger)
+
 	// Wait for interrupt signal for graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -144,200 +226,152 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Attempt graceful shutdown
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
-	}
+	// Attempt graceful shutdown, then dump the final metrics
+	api.Shutdown(ctx, server, cfg.Server.MetricsDumpPath)
 
 	log.Println("Server exited successfully")
 }
 
-// healthCheckHandler provides liveness probe endpoint
-func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	
-	response := map[string]interface{}{
-		"status":    "healthy",
-		"service":   serviceName,
-		"version":   serviceVersion,
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
+// reloadOnSIGHUP re-reads the configuration each time the process receives
+// SIGHUP and applies its tunable settings. A configuration that fails to
+// load or validate is logged and the current one kept.
+func reloadOnSIGHUP(settings *config.Holder, appLogger *logging.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		changes, err := settings.Reload()
+		if err != nil {
+			log.Printf("Configuration reload failed, keeping current settings: %v", err)
+			continue
+		}
+		if len(changes) == 0 {
+			log.Println("Configuration reloaded: no tunable settings changed")
+			continue
+		}
+		for _, change := range changes {
+			log.Printf("Configuration reloaded: %s", change)
+		}
+		if err := appLogger.SetLevel(settings.Get().Logging.Level); err != nil {
+			log.Printf("Keeping current log level: %v", err)
+		}
 	}
-	
-	if err := api.WriteJSONResponse(w, response); err != nil {
-		log.Printf("Failed to write health check response: %v", err)
+}
+
+// readinessHandler reports the service ready when the database answers.
+// BKT is required when probed; RAG is optional, so a RAG outage only marks
+// the service degraded.
+func readinessHandler(cfg *config.AppConfig, dbClient *db.Client) http.Handler {
+	client := &http.Client{Timeout: cfg.Server.ReadinessTimeout}
+	checks := []api.DependencyCheck{
+		{Name: "database", Required: true, Check: dbClient.Ping},
+	}
+	if cfg.BKT.ReadinessCheck {
+		checks = append(checks, api.DependencyCheck{
+			Name:     "bkt",
+			Required: true,
+			Check:    api.HTTPHealthCheck(client, cfg.BKT.ServiceURL+"/health"),
+		})
+	}
+	if cfg.RAG.Enabled && cfg.RAG.ReadinessCheck {
+		checks = append(checks, api.DependencyCheck{
+			Name:  "rag",
+			Check: api.HTTPHealthCheck(client, cfg.RAG.ServiceURL+"/health"),
+		})
+	}
+	return &api.Readiness{
+		Service: serviceName,
+		Version: buildinfo.Version,
+		Timeout: cfg.Server.ReadinessTimeout,
+		Checks:  checks,
 	}
 }
 
-// readinessCheckHandler provides readiness probe endpoint with dependency checks
-func readinessCheckHandler(dbClient *db.Client) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-		defer cancel()
-		
-		// Check database connectivity
-		if err := dbClient.Ping(ctx); err != nil {
-			log.Printf("Database health check failed: %v", err)
-			w.WriteHeader(http.StatusServiceUnavailable)
-			
-			response := map[string]interface{}{
-				"status": "not_ready",
-				"reason": "database_unavailable",
-				"error":  err.Error(),
-			}
-			api.WriteJSONResponse(w, response)
-			return
-		}
+// validateTemplates reports the active templates that cannot be generated,
+// exiting when failOnProblems is set
+func validateTemplates(dbClient *db.Client, failOnProblems bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-		// All checks passed
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		
-		response := map[string]interface{}{
-			"status":      "ready",
-			"service":     serviceName,
-			"version":     serviceVersion,
-			"timestamp":   time.Now().UTC().Format(time.RFC3339),
-			"checks": map[string]string{
-				"database": "ok",
-			},
+	problems, err := dbClient.ValidateAllTemplates(ctx)
+	if err != nil {
+		if failOnProblems {
+			log.Fatalf("Failed to validate templates: %v", err)
 		}
-		
-		api.WriteJSONResponse(w, response)
+		log.Printf("Failed to validate templates: %v", err)
+		return
+	}
+	for _, problem := range problems {
+		zap.S().Warnw("broken question template", "template_id", problem.TemplateID, "reasons", problem.Reasons)
+	}
+	if len(problems) > 0 && failOnProblems {
+		log.Fatalf("%d active templates failed validation", len(problems))
 	}
 }
 
-// Global metrics counters
-var (
-	startTime = time.Now()
-	totalRequests int64
-	successfulRequests int64
-	failedRequests int64
-	totalResponseTime int64 // in milliseconds
-	validationErrors int64
-	ragChecks int64
-	bktCalls int64
-	activeConnections int64
-	questionsGenerated int64
-	mutex sync.RWMutex
-)
+// warmTemplates preloads the topN most used templates of each subject. A
+// failed warm-up only costs the first requests some latency.
+func warmTemplates(templateSvc *templates.Service, topN int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-// metricsHandler provides comprehensive Prometheus-compatible metrics
-func metricsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	
-	mutex.RLock()
-	defer mutex.RUnlock()
-	
-	uptime := time.Since(startTime).Seconds()
-	avgResponseTime := float64(0)
-	if totalRequests > 0 {
-		avgResponseTime = float64(totalResponseTime) / float64(totalRequests)
+	result, err := templateSvc.WarmUp(ctx, topN)
+	if err != nil {
+		log.Printf("Template warm-up failed: %v", err)
+		return
 	}
-	successRate := float64(0)
-	if totalRequests > 0 {
-		successRate = float64(successfulRequests) / float64(totalRequests) * 100
+	log.Printf("Warmed %d templates (top %d per subject) in %s", result.Templates, topN, result.Duration)
+}
+
+// prepareStatements prepares the client's hot-path queries. A schema the
+// migrations left behind, e.g. in a dry run, keeps them unprepared rather
+// than stopping the service.
+func prepareStatements(dbClient *db.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := dbClient.PrepareStatements(ctx); err != nil {
+		log.Printf("Running queries unprepared: %v", err)
 	}
-	
-	metrics := fmt.Sprintf(`# HELP question_generator_info Service information
-# TYPE question_generator_info gauge
-question_generator_info{version="%s",service="%s"} 1
-
-# HELP question_generator_uptime_seconds Service uptime in seconds
-# TYPE question_generator_uptime_seconds counter
-question_generator_uptime_seconds %.2f
-
-# HELP question_generator_requests_total Total number of HTTP requests
-# TYPE question_generator_requests_total counter
-question_generator_requests_total{status="success"} %d
-question_generator_requests_total{status="failed"} %d
-
-# HELP question_generator_request_duration_ms Average request duration in milliseconds
-# TYPE question_generator_request_duration_ms gauge
-question_generator_request_duration_ms %.2f
-
-# HELP question_generator_success_rate Percentage of successful requests
-# TYPE question_generator_success_rate gauge
-question_generator_success_rate %.2f
-
-# HELP question_generator_validation_errors_total Total validation errors
-# TYPE question_generator_validation_errors_total counter
-question_generator_validation_errors_total %d
-
-# HELP question_generator_rag_checks_total Total RAG quality checks performed
-# TYPE question_generator_rag_checks_total counter
-question_generator_rag_checks_total %d
-
-# HELP question_generator_bkt_calls_total Total BKT service calls
-# TYPE question_generator_bkt_calls_total counter
-question_generator_bkt_calls_total %d
-
-# HELP question_generator_active_connections Current active connections
-# TYPE question_generator_active_connections gauge
-question_generator_active_connections %d
-
-# HELP question_generator_questions_generated_total Total questions generated successfully
-# TYPE question_generator_questions_generated_total counter
-question_generator_questions_generated_total %d
-
-# HELP question_generator_requests_per_second Current requests per second
-# TYPE question_generator_requests_per_second gauge
-question_generator_requests_per_second %.2f
-`,
-		serviceVersion, serviceName, uptime,
-		successfulRequests, failedRequests,
-		avgResponseTime, successRate,
-		validationErrors, ragChecks, bktCalls,
-		activeConnections, questionsGenerated,
-		float64(totalRequests)/uptime,
-	)
-	
-	w.Write([]byte(metrics))
 }
 
-// handleGenerateQuestion processes question generation requests
-func handleGenerateQuestion(generatorService *service.GeneratorService, w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	
-	// Extract validated request from context
-	validatedReq := ctx.Value("validated_request")
-	if validatedReq == nil {
-		http.Error(w, "Request validation failed", http.StatusBadRequest)
+// resumeRetries requeues the generations left RETRY_PENDING by the last
+// shutdown or crash
+func resumeRetries(generatorService *service.GeneratorService) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	resumed, err := generatorService.ResumeRetries(ctx)
+	if err != nil {
+		log.Printf("Failed to resume generation retries: %v", err)
 		return
 	}
-	
-	// Convert to service request format
-	// This is a simplified handler for Phase 2.2
-	// Full implementation would use the complete service.GenerateQuestionRequest
-	
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	
-	// Mock response for Phase 2.2 testing
-	mockResponse := map[string]interface{}{
-		"question_id":     "mock_q_12345",
-		"question_text":   "What is the acceleration due to gravity on Earth?",
-		"options": map[string]string{
-			"A": "9.8 m/s²",
-			"B": "9.6 m/s²",
-			"C": "10.0 m/s²",
-			"D": "8.9 m/s²",
-		},
-		"correct_answer":  "A",
-		"difficulty":      0.3,
-		"generation_time": 150,
-		"quality_score":   0.85,
-		"status":          "success",
-		"metadata": map[string]interface{}{
-			"template_id": "physics_basic_001",
-			"bkt_mastery": 0.65,
-			"rag_checked": true,
-		},
+	if resumed > 0 {
+		log.Printf("Resumed %d pending generation retries", resumed)
 	}
-	
-	if err := json.NewEncoder(w).Encode(mockResponse); err != nil {
-		log.Printf("Failed to encode response: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+}
+
+// runMigrations migrates to the configured version, or only reports what
+// would be applied when DB_MIGRATION_DRY_RUN is set
+func runMigrations(dbClient *db.Client, cfg config.DatabaseConfig) {
+	if cfg.MigrationDryRun {
+		status, err := dbClient.MigrateDryRun()
+		if err != nil {
+			log.Fatalf("Failed to check database migrations: %v", err)
+		}
+		log.Printf("Migration dry run: database at version %d, pending migrations %v", status.Version, status.Pending)
+		return
+	}
+
+	version, latest, err := cfg.TargetMigration()
+	if err != nil {
+		log.Fatalf("Invalid migration target: %v", err)
+	}
+	if latest {
+		err = dbClient.RunMigrations()
+	} else {
+		err = dbClient.MigrateTo(version)
+	}
+	if err != nil {
+		log.Fatalf("Failed to run database migrations: %v", err)
 	}
 }
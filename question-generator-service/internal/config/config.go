@@ -1,7 +1,9 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -10,11 +12,18 @@ import (
 
 // AppConfig holds all configuration for the question generator service
 type AppConfig struct {
-	Database DatabaseConfig
-	Server   ServerConfig
-	BKT      BKTConfig
-	RAG      RAGConfig
-	Logging  LoggingConfig
+	Database  DatabaseConfig
+	Server    ServerConfig
+	BKT       BKTConfig
+	RAG       RAGConfig
+	Logging   LoggingConfig
+	RateLimit RateLimitConfig
+	Validator ValidatorConfig
+	Batch     BatchConfig
+	Retry      RetryConfig
+	Duplicates DuplicateConfig
+	Templates  TemplateConfig
+	Stages     StageTimeoutConfig
 }
 
 // DatabaseConfig contains database connection settings
@@ -29,7 +38,26 @@ type DatabaseConfig struct {
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
 	MigrationsPath  string
-	MigrationVersion string // Target migration version (V1, V2, V3, etc.)
+	MigrationVersion string // Target migration version (V1, V2, V3, etc.), or "latest"
+	MigrationDryRun  bool   // Log pending migrations at startup without applying them
+	ConnectRetries    int           // Extra connection attempts at startup before giving up
+	ConnectRetryDelay time.Duration // Wait before the first retry, doubling after each
+	ConnectTimeout    time.Duration // Overall limit on connecting at startup
+	TemplateCacheSize int           // Templates, and template selections, kept in memory; 0 disables the cache
+	TemplateCacheTTL  time.Duration // How long a cached template or selection is served
+}
+
+// TargetMigration parses MigrationVersion, reporting latest when every
+// migration should be applied
+func (c DatabaseConfig) TargetMigration() (version uint, latest bool, err error) {
+	if c.MigrationVersion == "" || strings.EqualFold(c.MigrationVersion, "latest") {
+		return 0, true, nil
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(c.MigrationVersion), "V"), 10, 0)
+	if err != nil || n == 0 {
+		return 0, false, fmt.Errorf("DB_MIGRATION_VERSION must be latest or a version such as V14, got %q", c.MigrationVersion)
+	}
+	return uint(n), false, nil
 }
 
 // ServerConfig contains HTTP server settings  
@@ -39,6 +67,12 @@ type ServerConfig struct {
 	WriteTimeout   time.Duration
 	IdleTimeout    time.Duration
 	AllowedOrigins []string
+	TrustedProxies []string // CIDRs allowed to set X-Forwarded-For
+	ReadinessTimeout time.Duration // Limit on each dependency probe of /ready
+	DBVersionTTL   time.Duration // How long /health caches the database server version
+	AdminToken     string        // Bearer token for /v1/admin, which is disabled when empty
+	MetricsDumpPath string       // JSON file the final metrics summary is written to on graceful shutdown; empty disables
+	ExperimentToken string       // Bearer token allowing generate requests to skip RAG or validation; the admin token also does
 }
 
 // BKTConfig contains BKT inference service settings
@@ -49,6 +83,118 @@ type BKTConfig struct {
 	RetryCount    int
 	RetryDelay    time.Duration
 	CircuitBreaker CircuitBreakerConfig
+	ReadinessCheck bool // Probe the BKT /health endpoint from /ready
+	FallbackStrategy string // AVERAGE, ZPD or REQUESTED difficulty when BKT cannot calibrate
+	BloomAdjustments map[string]float64 // Difficulty added per Bloom level, e.g. ANALYZE=0.08; unlisted levels are unchanged
+}
+
+// DefaultBloomAdjustments raise the calibrated difficulty of templates that
+// ask for more than recall. Keys are Bloom level names, REMEMBER to CREATE.
+var DefaultBloomAdjustments = map[string]float64{
+	"REMEMBER":   0,
+	"UNDERSTAND": 0.02,
+	"APPLY":      0.05,
+	"ANALYZE":    0.08,
+	"EVALUATE":   0.11,
+	"CREATE":     0.15,
+}
+
+// maxBloomAdjustment bounds each Bloom level adjustment
+const maxBloomAdjustment = 0.5
+
+// BatchConfig bounds batch question generation
+type BatchConfig struct {
+	MaxSize     int // Most requests accepted in one batch
+	Concurrency int // Requests generated in parallel per batch
+}
+
+// RetryConfig controls background retries of generations that failed with
+// a transient error. A zero QueueSize disables retries.
+type RetryConfig struct {
+	QueueSize   int           // Most failed generations waiting for a retry at once
+	Workers     int           // Retries run in parallel
+	MaxAttempts int           // Retries per generation before it stays failed
+	BaseDelay   time.Duration // Wait before the first retry, doubling after each
+	MaxDelay    time.Duration // Upper bound on the wait between retries
+	Timeout     time.Duration // Limit on each retried generation
+}
+
+// StageTimeoutConfig bounds each stage of the generation pipeline within
+// the request deadline. A zero timeout leaves the stage bounded by the
+// request alone.
+type StageTimeoutConfig struct {
+	Template    time.Duration // Template selection
+	Calibration time.Duration // BKT calibration; the rule-based fallback runs when it expires
+	Generation  time.Duration // Filling the template
+	Validation  time.Duration // Validator checks
+	RAG         time.Duration // Each RAG quality check; the check is skipped when it expires
+
+	// MaxGenerationLatency bounds a whole generation. Once it runs out the
+	// best question generated so far is served without further RAG checks
+	// or regeneration, and generation fails when there is none. Zero
+	// leaves generation bounded by the stage timeouts alone.
+	MaxGenerationLatency time.Duration
+}
+
+// DuplicateConfig controls the check that regenerates a question too
+// similar to one recently served to the same student
+type DuplicateConfig struct {
+	Enabled          bool
+	Threshold        float64       // Trigram similarity from which a question counts as a duplicate
+	Window           time.Duration // How far back served questions are compared
+	MaxRegenerations int           // Regenerations per attempt before a duplicate is served anyway
+}
+
+// TemplateConfig controls how a template is picked from the candidates
+type TemplateConfig struct {
+	SelectionMode        string        // BEST always serves the top score; WEIGHTED samples by softmax over scores
+	SelectionTemperature float64       // Softmax temperature for WEIGHTED; lower favors the top score more
+	RecentWindow         int           // Templates per session excluded from the next selections, 0 disables
+	RecentTTL            time.Duration // How long an idle session's recent templates are remembered
+	StartupValidation    string        // OFF, WARN logs broken templates at startup, FAIL refuses to start
+	MaxDifficultyBand    float64       // Widest ± difficulty band searched when nothing matches; DifficultyBandStep disables widening
+	CooldownSelections   int           // Selections a just-served template is deprioritized for, 0 disables
+	CooldownDuration     time.Duration // How long a just-served template is deprioritized, 0 disables
+	GoldenDir            string        // Directory of the golden question fixtures checked by the admin API
+	WarmupEnabled        bool          // Preload the most used templates of each subject at startup
+	WarmupTopN           int           // Templates per subject preloaded by the warm-up
+	MaxCandidates        int           // Most templates scored per selection; more are cut to the top rows plus a random sample
+	Scoring              TemplateScoringConfig
+
+	// ExamTypeFallbacks lists, per exam type, the exam types whose
+	// templates may serve a topic it has none for, in order of preference,
+	// e.g. FOUNDATION=JEE_MAIN. None by default.
+	ExamTypeFallbacks map[string][]string
+}
+
+// DifficultyBandStep is the ± band around the requested difficulty searched
+// first, and how much it grows on each widening
+const DifficultyBandStep = 0.1
+
+// TemplateScoringConfig weights the factors of a template's selection score.
+// The weights must be non-negative and sum to 1.0.
+type TemplateScoringConfig struct {
+	Difficulty  float64 // Closeness of base difficulty to the requested range
+	Quality     float64 // Validation and clarity scores, unambiguous bonus
+	SuccessRate float64 // Historical student success rate
+	Freshness   float64 // Penalty for heavily used templates
+}
+
+// DefaultTemplateScoring is the weighting used when none is configured
+var DefaultTemplateScoring = TemplateScoringConfig{Difficulty: 0.4, Quality: 0.3, SuccessRate: 0.2, Freshness: 0.1}
+
+// scoringWeightTolerance allows for float rounding when weights are summed
+const scoringWeightTolerance = 1e-6
+
+// Validate checks the weights are non-negative and sum to 1.0
+func (w TemplateScoringConfig) Validate() error {
+	if w.Difficulty < 0 || w.Quality < 0 || w.SuccessRate < 0 || w.Freshness < 0 {
+		return fmt.Errorf("template scoring weights must not be negative")
+	}
+	if sum := w.Difficulty + w.Quality + w.SuccessRate + w.Freshness; math.Abs(sum-1.0) > scoringWeightTolerance {
+		return fmt.Errorf("template scoring weights must sum to 1.0, got %g", sum)
+	}
+	return nil
 }
 
 // RAGConfig contains RAG advisor service settings
@@ -58,8 +204,23 @@ type RAGConfig struct {
 	VectorStoreURL    string
 	Timeout           time.Duration
 	AlignmentThreshold float64
+	SubjectThresholds map[string]float64 // Per-subject overrides of AlignmentThreshold
 	MaxRetries        int
+	RetryDelay        time.Duration // Wait before the first retry, doubling after each
 	EmbeddingModel    string
+	CircuitBreaker    CircuitBreakerConfig
+	CacheSize         int           // Quality results kept in memory; 0 disables the cache
+	CacheTTL          time.Duration // How long a cached quality result is served
+	ReadinessCheck    bool          // Probe the RAG /health endpoint from /ready
+}
+
+// ThresholdFor returns the alignment threshold for subject, falling back to
+// the global AlignmentThreshold
+func (c RAGConfig) ThresholdFor(subject string) float64 {
+	if threshold, ok := c.SubjectThresholds[subject]; ok {
+		return threshold
+	}
+	return c.AlignmentThreshold
 }
 
 // CircuitBreakerConfig for resilient service calls
@@ -77,56 +238,209 @@ type LoggingConfig struct {
 	Output string // stdout, stderr, or file path
 }
 
-// LoadConfig loads configuration from environment variables with sensible defaults
+// RateLimitConfig controls request rate limits and where their state is kept
+type RateLimitConfig struct {
+	PerMinute     int64            // Requests per minute per client
+	Burst         int64            // Bucket size per client
+	PathOverrides map[string]int64 // Per-minute limits for path prefixes, e.g. expensive endpoints
+	Backend       string // memory or redis
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	FailClosed    bool // Reject requests when the backend is unreachable
+	MaxInFlight   int64 // Concurrent requests per client, unlimited when zero
+}
+
+// ValidatorConfig controls the question quality checks
+type ValidatorConfig struct {
+	AmbiguityTermsFile string // JSON file of weighted ambiguous terms, built-in list if empty
+	Policy             string // STRICT fails generation when the validator errors, LENIENT serves the question unvalidated
+
+	// GrammarChecker is HEURISTIC, or HTTP to refine the heuristics with a
+	// LanguageTool-compatible service at GrammarCheckerURL
+	GrammarChecker        string
+	GrammarCheckerURL     string
+	GrammarCheckerTimeout time.Duration
+	GrammarLanguage       string // Language code sent to the grammar service, e.g. en-US
+
+	// ExamSubjects maps each exam type requests may name onto the subjects
+	// it covers. A new exam type also needs adding to the exam_type CHECK
+	// constraints.
+	ExamSubjects map[string][]string
+}
+
+// DefaultExamSubjects are the exam types served and their subjects
+var DefaultExamSubjects = map[string][]string{
+	"JEE_MAIN":     {"PHYSICS", "CHEMISTRY", "MATHEMATICS"},
+	"JEE_ADVANCED": {"PHYSICS", "CHEMISTRY", "MATHEMATICS", "BIOLOGY"},
+	"NEET":         {"PHYSICS", "CHEMISTRY", "BIOLOGY"},
+	"FOUNDATION":   {"PHYSICS", "CHEMISTRY", "MATHEMATICS", "BIOLOGY"},
+}
+
+// knownSubjects are the subjects of the question_templates CHECK constraint
+var knownSubjects = map[string]bool{"PHYSICS": true, "CHEMISTRY": true, "MATHEMATICS": true, "BIOLOGY": true}
+
+// LoadConfig loads configuration with sensible defaults. When CONFIG_FILE
+// names a JSON file its values override the defaults, and environment
+// variables override both.
 func LoadConfig() (*AppConfig, error) {
+	settings, err := loadSettings(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, err
+	}
+
 	cfg := &AppConfig{
 		Database: DatabaseConfig{
-			Host:            getEnv("DB_HOST", "localhost"),
-			Port:            getEnvAsInt("DB_PORT", 5432),
-			Database:        getEnv("DB_NAME", "jee_neet_platform"),
-			Username:        getEnv("DB_USER", "postgres"),
-			Password:        getEnv("DB_PASSWORD", ""),
-			SSLMode:         getEnv("DB_SSL_MODE", "prefer"),
-			MaxOpenConns:    getEnvAsInt("DB_MAX_OPEN_CONNS", 25),
-			MaxIdleConns:    getEnvAsInt("DB_MAX_IDLE_CONNS", 5),
-			ConnMaxLifetime: getEnvAsDuration("DB_CONN_MAX_LIFETIME", time.Hour),
-			MigrationsPath:  getEnv("DB_MIGRATIONS_PATH", "internal/db/migrations"),
-			MigrationVersion: getEnv("DB_MIGRATION_VERSION", "V4"), // Default to latest
+			Host:            settings.getEnv("DB_HOST", "localhost"),
+			Port:            settings.getEnvAsInt("DB_PORT", 5432),
+			Database:        settings.getEnv("DB_NAME", "jee_neet_platform"),
+			Username:        settings.getEnv("DB_USER", "postgres"),
+			Password:        settings.getEnv("DB_PASSWORD", ""),
+			SSLMode:         settings.getEnv("DB_SSL_MODE", "prefer"),
+			MaxOpenConns:    settings.getEnvAsInt("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:    settings.getEnvAsInt("DB_MAX_IDLE_CONNS", 5),
+			ConnMaxLifetime: settings.getEnvAsDuration("DB_CONN_MAX_LIFETIME", time.Hour),
+			MigrationsPath:  settings.getEnv("DB_MIGRATIONS_PATH", "internal/db/migrations"),
+			MigrationVersion: settings.getEnv("DB_MIGRATION_VERSION", "latest"),
+			MigrationDryRun:  settings.getEnvAsBool("DB_MIGRATION_DRY_RUN", false),
+			ConnectRetries:    settings.getEnvAsInt("DB_CONNECT_RETRIES", 5),
+			ConnectRetryDelay: settings.getEnvAsDuration("DB_CONNECT_RETRY_DELAY", time.Second),
+			ConnectTimeout:    settings.getEnvAsDuration("DB_CONNECT_TIMEOUT", 2*time.Minute),
+			TemplateCacheSize: settings.getEnvAsInt("DB_TEMPLATE_CACHE_SIZE", 500),
+			TemplateCacheTTL:  settings.getEnvAsDuration("DB_TEMPLATE_CACHE_TTL", time.Minute),
 		},
 		Server: ServerConfig{
-			Port:           getEnvAsInt("SERVER_PORT", 8080),
-			ReadTimeout:    getEnvAsDuration("SERVER_READ_TIMEOUT", 10*time.Second),
-			WriteTimeout:   getEnvAsDuration("SERVER_WRITE_TIMEOUT", 30*time.Second),
-			IdleTimeout:    getEnvAsDuration("SERVER_IDLE_TIMEOUT", 60*time.Second),
-			AllowedOrigins: getEnvAsSlice("ALLOWED_ORIGINS", []string{"*"}),
+			Port:           settings.getEnvAsInt("SERVER_PORT", 8080),
+			ReadTimeout:    settings.getEnvAsDuration("SERVER_READ_TIMEOUT", 10*time.Second),
+			WriteTimeout:   settings.getEnvAsDuration("SERVER_WRITE_TIMEOUT", 30*time.Second),
+			IdleTimeout:    settings.getEnvAsDuration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			AllowedOrigins: settings.getEnvAsSlice("ALLOWED_ORIGINS", []string{"*"}),
+			TrustedProxies: settings.getEnvAsSlice("TRUSTED_PROXIES", []string{}),
+			ReadinessTimeout: settings.getEnvAsDuration("SERVER_READINESS_TIMEOUT", 2*time.Second),
+			DBVersionTTL:   settings.getEnvAsDuration("SERVER_DB_VERSION_TTL", 10*time.Minute),
+			AdminToken:     settings.getEnv("ADMIN_TOKEN", ""),
+			MetricsDumpPath: settings.getEnv("METRICS_DUMP_PATH", ""),
+			ExperimentToken: settings.getEnv("EXPERIMENT_TOKEN", ""),
 		},
 		BKT: BKTConfig{
-			ServiceURL: getEnv("BKT_SERVICE_URL", "http://bkt-inference:8081"),
-			ModelPath:  getEnv("BKT_MODEL_PATH", "/models/enhanced_bkt_v2.pkl"),
-			Timeout:    getEnvAsDuration("BKT_TIMEOUT", 5*time.Second),
-			RetryCount: getEnvAsInt("BKT_RETRY_COUNT", 3),
-			RetryDelay: getEnvAsDuration("BKT_RETRY_DELAY", 100*time.Millisecond),
+			ServiceURL: settings.getEnv("BKT_SERVICE_URL", "http://bkt-inference:8081"),
+			ModelPath:  settings.getEnv("BKT_MODEL_PATH", "/models/enhanced_bkt_v2.pkl"),
+			Timeout:    settings.getEnvAsDuration("BKT_TIMEOUT", 5*time.Second),
+			RetryCount: settings.getEnvAsInt("BKT_RETRY_COUNT", 3),
+			RetryDelay: settings.getEnvAsDuration("BKT_RETRY_DELAY", 100*time.Millisecond),
+			ReadinessCheck: settings.getEnvAsBool("BKT_READINESS_CHECK", true),
+			FallbackStrategy: settings.getEnv("BKT_FALLBACK_STRATEGY", "AVERAGE"),
+			BloomAdjustments: settings.getEnvAsFloatMap("BKT_BLOOM_ADJUSTMENTS", DefaultBloomAdjustments),
 			CircuitBreaker: CircuitBreakerConfig{
-				MaxRequests:  uint32(getEnvAsInt("BKT_CB_MAX_REQUESTS", 10)),
-				Interval:     getEnvAsDuration("BKT_CB_INTERVAL", 60*time.Second),
-				Timeout:      getEnvAsDuration("BKT_CB_TIMEOUT", 10*time.Second),
-				FailureRatio: getEnvAsFloat("BKT_CB_FAILURE_RATIO", 0.6),
+				MaxRequests:  uint32(settings.getEnvAsInt("BKT_CB_MAX_REQUESTS", 10)),
+				Interval:     settings.getEnvAsDuration("BKT_CB_INTERVAL", 60*time.Second),
+				Timeout:      settings.getEnvAsDuration("BKT_CB_TIMEOUT", 10*time.Second),
+				FailureRatio: settings.getEnvAsFloat("BKT_CB_FAILURE_RATIO", 0.6),
 			},
 		},
 		RAG: RAGConfig{
-			Enabled:            getEnvAsBool("RAG_ENABLED", true),
-			ServiceURL:         getEnv("RAG_SERVICE_URL", "http://rag-advisor:8082"),
-			VectorStoreURL:     getEnv("VECTOR_STORE_URL", "http://weaviate:8080"),
-			Timeout:            getEnvAsDuration("RAG_TIMEOUT", 3*time.Second),
-			AlignmentThreshold: getEnvAsFloat("RAG_ALIGNMENT_THRESHOLD", 0.8),
-			MaxRetries:         getEnvAsInt("RAG_MAX_RETRIES", 2),
-			EmbeddingModel:     getEnv("RAG_EMBEDDING_MODEL", "sentence-transformers/all-MiniLM-L6-v2"),
+			Enabled:            settings.getEnvAsBool("RAG_ENABLED", true),
+			ServiceURL:         settings.getEnv("RAG_SERVICE_URL", "http://rag-advisor:8082"),
+			VectorStoreURL:     settings.getEnv("VECTOR_STORE_URL", "http://weaviate:8080"),
+			Timeout:            settings.getEnvAsDuration("RAG_TIMEOUT", 3*time.Second),
+			AlignmentThreshold: settings.getEnvAsFloat("RAG_ALIGNMENT_THRESHOLD", 0.8),
+			SubjectThresholds:  settings.getEnvAsFloatMap("RAG_SUBJECT_THRESHOLDS", nil),
+			MaxRetries:         settings.getEnvAsInt("RAG_MAX_RETRIES", 2),
+			RetryDelay:         settings.getEnvAsDuration("RAG_RETRY_DELAY", 100*time.Millisecond),
+			EmbeddingModel:     settings.getEnv("RAG_EMBEDDING_MODEL", "sentence-transformers/all-MiniLM-L6-v2"),
+			CircuitBreaker: CircuitBreakerConfig{
+				MaxRequests:  uint32(settings.getEnvAsInt("RAG_CB_MAX_REQUESTS", 3)),
+				Interval:     settings.getEnvAsDuration("RAG_CB_INTERVAL", 60*time.Second),
+				Timeout:      settings.getEnvAsDuration("RAG_CB_TIMEOUT", 30*time.Second),
+				FailureRatio: settings.getEnvAsFloat("RAG_CB_FAILURE_RATIO", 0.5),
+			},
+			CacheSize: settings.getEnvAsInt("RAG_CACHE_SIZE", 1000),
+			CacheTTL:  settings.getEnvAsDuration("RAG_CACHE_TTL", 10*time.Minute),
+			ReadinessCheck: settings.getEnvAsBool("RAG_READINESS_CHECK", true),
 		},
 		Logging: LoggingConfig{
-			Level:  getEnv("LOG_LEVEL", "info"),
-			Format: getEnv("LOG_FORMAT", "json"),
-			Output: getEnv("LOG_OUTPUT", "stdout"),
+			Level:  settings.getEnv("LOG_LEVEL", "info"),
+			Format: settings.getEnv("LOG_FORMAT", "json"),
+			Output: settings.getEnv("LOG_OUTPUT", "stdout"),
+		},
+		RateLimit: RateLimitConfig{
+			PerMinute:     int64(settings.getEnvAsInt("RATE_LIMIT_PER_MINUTE", 1000)),
+			Burst:         int64(settings.getEnvAsInt("RATE_LIMIT_BURST", 100)),
+			PathOverrides: settings.getEnvAsLimits("RATE_LIMIT_PATH_OVERRIDES", map[string]int64{
+				// Generation is expensive; limit more tightly
+				"/v1/questions/generate": 300,
+				// A test paper runs the pipeline once per question
+				"/v1/tests/generate": 10,
+			}),
+			Backend:       settings.getEnv("RATE_LIMIT_BACKEND", "memory"),
+			RedisAddr:     settings.getEnv("RATE_LIMIT_REDIS_ADDR", "redis:6379"),
+			RedisPassword: settings.getEnv("RATE_LIMIT_REDIS_PASSWORD", ""),
+			RedisDB:       settings.getEnvAsInt("RATE_LIMIT_REDIS_DB", 0),
+			FailClosed:    settings.getEnvAsBool("RATE_LIMIT_FAIL_CLOSED", false),
+			MaxInFlight:   int64(settings.getEnvAsInt("RATE_LIMIT_MAX_IN_FLIGHT", 20)),
+		},
+		Validator: ValidatorConfig{
+			AmbiguityTermsFile: settings.getEnv("AMBIGUITY_TERMS_FILE", ""),
+			Policy:             settings.getEnv("VALIDATION_POLICY", "STRICT"),
+
+			GrammarChecker:        settings.getEnv("GRAMMAR_CHECKER", "HEURISTIC"),
+			GrammarCheckerURL:     settings.getEnv("GRAMMAR_CHECKER_URL", ""),
+			GrammarCheckerTimeout: settings.getEnvAsDuration("GRAMMAR_CHECKER_TIMEOUT", 2*time.Second),
+			GrammarLanguage:       settings.getEnv("GRAMMAR_CHECKER_LANGUAGE", "en-US"),
+			ExamSubjects:          settings.getEnvAsListMap("EXAM_SUBJECTS", DefaultExamSubjects),
+		},
+		Batch: BatchConfig{
+			MaxSize:     settings.getEnvAsInt("BATCH_MAX_SIZE", 50),
+			Concurrency: settings.getEnvAsInt("BATCH_CONCURRENCY", 8),
 		},
+		Retry: RetryConfig{
+			QueueSize:   settings.getEnvAsInt("GENERATION_RETRY_QUEUE_SIZE", 100),
+			Workers:     settings.getEnvAsInt("GENERATION_RETRY_WORKERS", 2),
+			MaxAttempts: settings.getEnvAsInt("GENERATION_RETRY_MAX_ATTEMPTS", 3),
+			BaseDelay:   settings.getEnvAsDuration("GENERATION_RETRY_BASE_DELAY", 2*time.Second),
+			MaxDelay:    settings.getEnvAsDuration("GENERATION_RETRY_MAX_DELAY", time.Minute),
+			Timeout:     settings.getEnvAsDuration("GENERATION_RETRY_TIMEOUT", 30*time.Second),
+		},
+		Stages: StageTimeoutConfig{
+			Template:    settings.getEnvAsDuration("STAGE_TEMPLATE_TIMEOUT", 2*time.Second),
+			Calibration: settings.getEnvAsDuration("STAGE_CALIBRATION_TIMEOUT", 6*time.Second),
+			Generation:  settings.getEnvAsDuration("STAGE_GENERATION_TIMEOUT", 2*time.Second),
+			Validation:  settings.getEnvAsDuration("STAGE_VALIDATION_TIMEOUT", 2*time.Second),
+			RAG:         settings.getEnvAsDuration("STAGE_RAG_TIMEOUT", 5*time.Second),
+			MaxGenerationLatency: settings.getEnvAsDuration("MAX_GENERATION_LATENCY", 0),
+		},
+		Duplicates: DuplicateConfig{
+			Enabled:          settings.getEnvAsBool("DUPLICATE_CHECK_ENABLED", true),
+			Threshold:        settings.getEnvAsFloat("DUPLICATE_SIMILARITY_THRESHOLD", 0.8),
+			Window:           settings.getEnvAsDuration("DUPLICATE_WINDOW", 30*24*time.Hour),
+			MaxRegenerations: settings.getEnvAsInt("DUPLICATE_MAX_REGENERATIONS", 2),
+		},
+		Templates: TemplateConfig{
+			SelectionMode:        settings.getEnv("TEMPLATE_SELECTION_MODE", "WEIGHTED"),
+			SelectionTemperature: settings.getEnvAsFloat("TEMPLATE_SELECTION_TEMPERATURE", 0.05),
+			RecentWindow:         settings.getEnvAsInt("TEMPLATE_RECENT_WINDOW", 3),
+			RecentTTL:            settings.getEnvAsDuration("TEMPLATE_RECENT_TTL", time.Hour),
+			StartupValidation:    settings.getEnv("TEMPLATE_STARTUP_VALIDATION", "WARN"),
+			MaxDifficultyBand:    settings.getEnvAsFloat("TEMPLATE_MAX_DIFFICULTY_BAND", 0.3),
+			CooldownSelections:   settings.getEnvAsInt("TEMPLATE_COOLDOWN_SELECTIONS", 0),
+			CooldownDuration:     settings.getEnvAsDuration("TEMPLATE_COOLDOWN_DURATION", 0),
+			GoldenDir:            settings.getEnv("TEMPLATE_GOLDEN_DIR", "testdata/golden"),
+			WarmupEnabled:        settings.getEnvAsBool("WARMUP_ENABLED", false),
+			WarmupTopN:           settings.getEnvAsInt("WARMUP_TOP_N", 20),
+			MaxCandidates:        settings.getEnvAsInt("TEMPLATE_MAX_CANDIDATES", 100),
+			Scoring: TemplateScoringConfig{
+				Difficulty:  settings.getEnvAsFloat("TEMPLATE_WEIGHT_DIFFICULTY", DefaultTemplateScoring.Difficulty),
+				Quality:     settings.getEnvAsFloat("TEMPLATE_WEIGHT_QUALITY", DefaultTemplateScoring.Quality),
+				SuccessRate: settings.getEnvAsFloat("TEMPLATE_WEIGHT_SUCCESS_RATE", DefaultTemplateScoring.SuccessRate),
+				Freshness:   settings.getEnvAsFloat("TEMPLATE_WEIGHT_FRESHNESS", DefaultTemplateScoring.Freshness),
+			},
+			ExamTypeFallbacks: settings.getEnvAsListMap("TEMPLATE_EXAM_TYPE_FALLBACKS", nil),
+		},
+	}
+
+	// A set but malformed value must not silently become its default
+	if err := settings.err(); err != nil {
+		return nil, err
 	}
 
 	// Validate required configuration
@@ -151,10 +465,139 @@ func (c *AppConfig) validate() error {
 		return fmt.Errorf("database username is required")
 	}
 
+	if c.Database.Port < 1 || c.Database.Port > 65535 {
+		return fmt.Errorf("DB_PORT must be between 1 and 65535, got %d", c.Database.Port)
+	}
+
+	if c.Database.MaxOpenConns < 1 {
+		return fmt.Errorf("DB_MAX_OPEN_CONNS must be at least 1, got %d", c.Database.MaxOpenConns)
+	}
+
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		return fmt.Errorf("DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS (%d), got %d",
+			c.Database.MaxOpenConns, c.Database.MaxIdleConns)
+	}
+
+	if c.Database.ConnMaxLifetime < 0 {
+		return fmt.Errorf("DB_CONN_MAX_LIFETIME must not be negative, got %s", c.Database.ConnMaxLifetime)
+	}
+
+	if _, _, err := c.Database.TargetMigration(); err != nil {
+		return err
+	}
+
+	if c.Database.ConnectRetries < 0 {
+		return fmt.Errorf("DB_CONNECT_RETRIES must not be negative, got %d", c.Database.ConnectRetries)
+	}
+
+	if c.Database.ConnectRetryDelay < 0 {
+		return fmt.Errorf("DB_CONNECT_RETRY_DELAY must not be negative, got %s", c.Database.ConnectRetryDelay)
+	}
+
+	if c.Database.ConnectTimeout <= 0 {
+		return fmt.Errorf("DB_CONNECT_TIMEOUT must be positive, got %s", c.Database.ConnectTimeout)
+	}
+
+	if c.Database.TemplateCacheSize < 0 {
+		return fmt.Errorf("DB_TEMPLATE_CACHE_SIZE must not be negative, got %d", c.Database.TemplateCacheSize)
+	}
+
+	if c.Database.TemplateCacheSize > 0 && c.Database.TemplateCacheTTL <= 0 {
+		return fmt.Errorf("DB_TEMPLATE_CACHE_TTL must be positive when the cache is enabled, got %s", c.Database.TemplateCacheTTL)
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		return fmt.Errorf("SERVER_PORT must be between 1 and 65535, got %d", c.Server.Port)
+	}
+
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"SERVER_READ_TIMEOUT", c.Server.ReadTimeout},
+		{"SERVER_WRITE_TIMEOUT", c.Server.WriteTimeout},
+		{"SERVER_IDLE_TIMEOUT", c.Server.IdleTimeout},
+		{"SERVER_READINESS_TIMEOUT", c.Server.ReadinessTimeout},
+		{"SERVER_DB_VERSION_TTL", c.Server.DBVersionTTL},
+		{"BKT_TIMEOUT", c.BKT.Timeout},
+	} {
+		if timeout.value <= 0 {
+			return fmt.Errorf("%s must be positive, got %s", timeout.name, timeout.value)
+		}
+	}
+
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"STAGE_TEMPLATE_TIMEOUT", c.Stages.Template},
+		{"STAGE_CALIBRATION_TIMEOUT", c.Stages.Calibration},
+		{"STAGE_GENERATION_TIMEOUT", c.Stages.Generation},
+		{"STAGE_VALIDATION_TIMEOUT", c.Stages.Validation},
+		{"STAGE_RAG_TIMEOUT", c.Stages.RAG},
+		{"MAX_GENERATION_LATENCY", c.Stages.MaxGenerationLatency},
+	} {
+		if timeout.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", timeout.name, timeout.value)
+		}
+	}
+
 	if c.BKT.ServiceURL == "" {
 		return fmt.Errorf("BKT service URL is required")
 	}
 
+	if c.BKT.RetryCount < 0 {
+		return fmt.Errorf("BKT_RETRY_COUNT must not be negative, got %d", c.BKT.RetryCount)
+	}
+
+	if c.BKT.RetryDelay < 0 {
+		return fmt.Errorf("BKT_RETRY_DELAY must not be negative, got %s", c.BKT.RetryDelay)
+	}
+
+	switch c.BKT.FallbackStrategy {
+	case "AVERAGE", "ZPD", "REQUESTED":
+	default:
+		return fmt.Errorf("BKT_FALLBACK_STRATEGY must be AVERAGE, ZPD or REQUESTED, got %q", c.BKT.FallbackStrategy)
+	}
+
+	for level, adjustment := range c.BKT.BloomAdjustments {
+		if adjustment < 0 || adjustment > maxBloomAdjustment {
+			return fmt.Errorf("BKT_BLOOM_ADJUSTMENTS %s must be between 0.0 and %g, got %g", level, maxBloomAdjustment, adjustment)
+		}
+	}
+
+	if ratio := c.BKT.CircuitBreaker.FailureRatio; ratio <= 0 || ratio > 1 {
+		return fmt.Errorf("BKT_CB_FAILURE_RATIO must be in (0, 1], got %g", ratio)
+	}
+
+	if c.RAG.Enabled && c.RAG.Timeout <= 0 {
+		return fmt.Errorf("RAG_TIMEOUT must be positive when RAG is enabled, got %s", c.RAG.Timeout)
+	}
+
+	if c.RAG.MaxRetries < 0 {
+		return fmt.Errorf("RAG_MAX_RETRIES must not be negative, got %d", c.RAG.MaxRetries)
+	}
+
+	if c.RAG.RetryDelay < 0 {
+		return fmt.Errorf("RAG_RETRY_DELAY must not be negative, got %s", c.RAG.RetryDelay)
+	}
+
+	if ratio := c.RAG.CircuitBreaker.FailureRatio; ratio <= 0 || ratio > 1 {
+		return fmt.Errorf("RAG_CB_FAILURE_RATIO must be in (0, 1], got %g", ratio)
+	}
+
+	if c.RAG.CircuitBreaker.Timeout <= 0 {
+		return fmt.Errorf("RAG_CB_TIMEOUT must be positive, got %s", c.RAG.CircuitBreaker.Timeout)
+	}
+
+	if c.RAG.CacheSize < 0 {
+		return fmt.Errorf("RAG_CACHE_SIZE must not be negative, got %d", c.RAG.CacheSize)
+	}
+
+	if c.RAG.CacheSize > 0 && c.RAG.CacheTTL <= 0 {
+		return fmt.Errorf("RAG_CACHE_TTL must be positive when the cache is enabled, got %s", c.RAG.CacheTTL)
+	}
+
 	if c.RAG.Enabled && c.RAG.ServiceURL == "" {
 		return fmt.Errorf("RAG service URL is required when RAG is enabled")
 	}
@@ -163,6 +606,173 @@ func (c *AppConfig) validate() error {
 		return fmt.Errorf("RAG alignment threshold must be between 0.0 and 1.0")
 	}
 
+	for subject, threshold := range c.RAG.SubjectThresholds {
+		if threshold < 0.0 || threshold > 1.0 {
+			return fmt.Errorf("RAG_SUBJECT_THRESHOLDS %s must be between 0.0 and 1.0, got %g", subject, threshold)
+		}
+	}
+
+	if c.Batch.MaxSize < 1 || c.Batch.Concurrency < 1 {
+		return fmt.Errorf("batch max size and concurrency must be at least 1")
+	}
+
+	if c.Retry.QueueSize < 0 {
+		return fmt.Errorf("GENERATION_RETRY_QUEUE_SIZE must not be negative, got %d", c.Retry.QueueSize)
+	}
+
+	if c.Retry.QueueSize > 0 {
+		if c.Retry.Workers < 1 || c.Retry.MaxAttempts < 1 {
+			return fmt.Errorf("GENERATION_RETRY_WORKERS and GENERATION_RETRY_MAX_ATTEMPTS must be at least 1 when retries are enabled")
+		}
+		if c.Retry.BaseDelay <= 0 || c.Retry.MaxDelay < c.Retry.BaseDelay {
+			return fmt.Errorf("GENERATION_RETRY_BASE_DELAY must be positive and at most GENERATION_RETRY_MAX_DELAY, got %s and %s", c.Retry.BaseDelay, c.Retry.MaxDelay)
+		}
+		if c.Retry.Timeout <= 0 {
+			return fmt.Errorf("GENERATION_RETRY_TIMEOUT must be positive, got %s", c.Retry.Timeout)
+		}
+	}
+
+	if c.Duplicates.Enabled {
+		if c.Duplicates.Threshold <= 0 || c.Duplicates.Threshold > 1 {
+			return fmt.Errorf("DUPLICATE_SIMILARITY_THRESHOLD must be above 0.0 and at most 1.0, got %v", c.Duplicates.Threshold)
+		}
+		if c.Duplicates.Window <= 0 {
+			return fmt.Errorf("DUPLICATE_WINDOW must be positive, got %s", c.Duplicates.Window)
+		}
+		if c.Duplicates.MaxRegenerations < 0 {
+			return fmt.Errorf("DUPLICATE_MAX_REGENERATIONS must not be negative, got %d", c.Duplicates.MaxRegenerations)
+		}
+	}
+
+	switch strings.ToLower(c.Logging.Level) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		return fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", c.Logging.Level)
+	}
+
+	if c.Logging.Format != "json" && c.Logging.Format != "console" {
+		return fmt.Errorf("LOG_FORMAT must be json or console, got %q", c.Logging.Format)
+	}
+
+	if c.Logging.Output == "" {
+		return fmt.Errorf("LOG_OUTPUT must be stdout, stderr or a file path")
+	}
+
+	if c.Templates.SelectionMode != "BEST" && c.Templates.SelectionMode != "WEIGHTED" {
+		return fmt.Errorf("template selection mode must be BEST or WEIGHTED")
+	}
+
+	if c.Templates.SelectionTemperature <= 0 {
+		return fmt.Errorf("template selection temperature must be positive")
+	}
+
+	if c.Templates.RecentWindow < 0 {
+		return fmt.Errorf("TEMPLATE_RECENT_WINDOW must not be negative, got %d", c.Templates.RecentWindow)
+	}
+
+	if c.Templates.RecentWindow > 0 && c.Templates.RecentTTL <= 0 {
+		return fmt.Errorf("TEMPLATE_RECENT_TTL must be positive when TEMPLATE_RECENT_WINDOW is set, got %s", c.Templates.RecentTTL)
+	}
+
+	if c.Templates.CooldownSelections < 0 {
+		return fmt.Errorf("TEMPLATE_COOLDOWN_SELECTIONS must not be negative, got %d", c.Templates.CooldownSelections)
+	}
+
+	if c.Templates.CooldownDuration < 0 {
+		return fmt.Errorf("TEMPLATE_COOLDOWN_DURATION must not be negative, got %s", c.Templates.CooldownDuration)
+	}
+
+	if c.Templates.MaxCandidates < 1 {
+		return fmt.Errorf("TEMPLATE_MAX_CANDIDATES must be at least 1, got %d", c.Templates.MaxCandidates)
+	}
+
+	switch c.Validator.Policy {
+	case "STRICT", "LENIENT":
+	default:
+		return fmt.Errorf("VALIDATION_POLICY must be STRICT or LENIENT, got %q", c.Validator.Policy)
+	}
+
+	switch c.Validator.GrammarChecker {
+	case "HEURISTIC":
+	case "HTTP":
+		if c.Validator.GrammarCheckerURL == "" {
+			return fmt.Errorf("GRAMMAR_CHECKER_URL is required when GRAMMAR_CHECKER is HTTP")
+		}
+		if c.Validator.GrammarCheckerTimeout <= 0 {
+			return fmt.Errorf("GRAMMAR_CHECKER_TIMEOUT must be positive, got %s", c.Validator.GrammarCheckerTimeout)
+		}
+	default:
+		return fmt.Errorf("GRAMMAR_CHECKER must be HEURISTIC or HTTP, got %q", c.Validator.GrammarChecker)
+	}
+
+	if len(c.Validator.ExamSubjects) == 0 {
+		return fmt.Errorf("EXAM_SUBJECTS must list at least one exam type")
+	}
+	for exam, subjects := range c.Validator.ExamSubjects {
+		if len(subjects) == 0 {
+			return fmt.Errorf("EXAM_SUBJECTS %s must list at least one subject", exam)
+		}
+		for _, subject := range subjects {
+			if !knownSubjects[subject] {
+				return fmt.Errorf("EXAM_SUBJECTS %s: subject must be PHYSICS, CHEMISTRY, MATHEMATICS or BIOLOGY, got %q", exam, subject)
+			}
+		}
+	}
+
+	switch c.Templates.StartupValidation {
+	case "OFF", "WARN", "FAIL":
+	default:
+		return fmt.Errorf("TEMPLATE_STARTUP_VALIDATION must be OFF, WARN or FAIL, got %q", c.Templates.StartupValidation)
+	}
+
+	if c.Templates.MaxDifficultyBand < DifficultyBandStep || c.Templates.MaxDifficultyBand > 1 {
+		return fmt.Errorf("TEMPLATE_MAX_DIFFICULTY_BAND must be between %.1f and 1.0, got %v", DifficultyBandStep, c.Templates.MaxDifficultyBand)
+	}
+
+	if c.Templates.WarmupEnabled && c.Templates.WarmupTopN < 1 {
+		return fmt.Errorf("WARMUP_TOP_N must be at least 1 when WARMUP_ENABLED is set, got %d", c.Templates.WarmupTopN)
+	}
+
+	for exam, fallbacks := range c.Templates.ExamTypeFallbacks {
+		if _, ok := c.Validator.ExamSubjects[exam]; !ok {
+			return fmt.Errorf("TEMPLATE_EXAM_TYPE_FALLBACKS: unknown exam type %q", exam)
+		}
+		for _, fallback := range fallbacks {
+			if _, ok := c.Validator.ExamSubjects[fallback]; !ok || fallback == exam {
+				return fmt.Errorf("TEMPLATE_EXAM_TYPE_FALLBACKS %s: fallback must be another known exam type, got %q", exam, fallback)
+			}
+		}
+	}
+
+	if err := c.Templates.Scoring.Validate(); err != nil {
+		return err
+	}
+
+	if c.RateLimit.PerMinute < 1 || c.RateLimit.Burst < 0 {
+		return fmt.Errorf("rate limit must be at least 1 per minute with a non-negative burst")
+	}
+	for prefix, limit := range c.RateLimit.PathOverrides {
+		if limit < 1 {
+			return fmt.Errorf("rate limit for %s must be at least 1 per minute", prefix)
+		}
+	}
+
+	if c.RateLimit.Backend != "memory" && c.RateLimit.Backend != "redis" {
+		return fmt.Errorf("rate limit backend must be memory or redis")
+	}
+
+	if c.RateLimit.Backend == "redis" && c.RateLimit.RedisAddr == "" {
+		return fmt.Errorf("rate limit Redis address is required when the redis backend is selected")
+	}
+
+	if c.RateLimit.RedisDB < 0 {
+		return fmt.Errorf("RATE_LIMIT_REDIS_DB must not be negative, got %d", c.RateLimit.RedisDB)
+	}
+
+	if c.RateLimit.MaxInFlight < 0 {
+		return fmt.Errorf("RATE_LIMIT_MAX_IN_FLIGHT must not be negative, got %d", c.RateLimit.MaxInFlight)
+	}
+
 	return nil
 }
 
@@ -174,49 +784,194 @@ func (c *DatabaseConfig) GetDatabaseDSN() string {
 
 // Environment variable helper functions
 
-func getEnv(key, defaultValue string) string {
+// settings resolves configuration keys from the environment, then from the
+// config file, then from the built-in default. Values that are set but
+// cannot be parsed are collected in invalid.
+type settings struct {
+	file    map[string]string
+	invalid []string
+}
+
+// err reports every value that could not be parsed
+func (s *settings) err() error {
+	if len(s.invalid) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration values: %s", strings.Join(s.invalid, "; "))
+}
+
+// loadSettings reads the config file at path, if any. The file is a JSON
+// object keyed by the same names as the environment variables, e.g.
+//
+//	{"DB_HOST": "db.internal", "BKT_TIMEOUT": "5s", "RAG_ENABLED": false,
+//	 "ALLOWED_ORIGINS": ["https://app.example.com"]}
+//
+// Numbers and booleans may be given as JSON literals and lists as arrays.
+func loadSettings(path string) (*settings, error) {
+	if path == "" {
+		return &settings{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	file := make(map[string]string, len(raw))
+	for key, value := range raw {
+		var str string
+		var list []string
+		switch {
+		case json.Unmarshal(value, &str) == nil:
+			file[key] = str
+		case json.Unmarshal(value, &list) == nil:
+			file[key] = strings.Join(list, ",")
+		case json.Valid(value) && value[0] != '{' && value[0] != '[' && string(value) != "null":
+			file[key] = string(value) // number or boolean literal
+		default:
+			return nil, fmt.Errorf("config file %s: %s must be a string, number, boolean or list of strings", path, key)
+		}
+	}
+	return &settings{file: file}, nil
+}
+
+func (s *settings) getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
+	if value, ok := s.file[key]; ok && value != "" {
+		return value
+	}
 	return defaultValue
 }
 
-func getEnvAsInt(key string, defaultValue int) int {
-	valueStr := getEnv(key, "")
-	if value, err := strconv.Atoi(valueStr); err == nil {
-		return value
+func (s *settings) getEnvAsInt(key string, defaultValue int) int {
+	valueStr := s.getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
 	}
-	return defaultValue
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		s.invalid = append(s.invalid, fmt.Sprintf("%s=%q is not an integer", key, valueStr))
+		return defaultValue
+	}
+	return value
 }
 
-func getEnvAsBool(key string, defaultValue bool) bool {
-	valueStr := getEnv(key, "")
-	if value, err := strconv.ParseBool(valueStr); err == nil {
-		return value
+func (s *settings) getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := s.getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
 	}
-	return defaultValue
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		s.invalid = append(s.invalid, fmt.Sprintf("%s=%q is not a boolean (true or false)", key, valueStr))
+		return defaultValue
+	}
+	return value
 }
 
-func getEnvAsFloat(key string, defaultValue float64) float64 {
-	valueStr := getEnv(key, "")
-	if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
-		return value
+func (s *settings) getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := s.getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
 	}
-	return defaultValue
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		s.invalid = append(s.invalid, fmt.Sprintf("%s=%q is not a number", key, valueStr))
+		return defaultValue
+	}
+	return value
 }
 
-func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
-	valueStr := getEnv(key, "")
-	if value, err := time.ParseDuration(valueStr); err == nil {
-		return value
+func (s *settings) getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := s.getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
 	}
-	return defaultValue
+	value, err := time.ParseDuration(valueStr)
+	if err != nil {
+		s.invalid = append(s.invalid, fmt.Sprintf("%s=%q is not a duration (e.g. 5s, 250ms)", key, valueStr))
+		return defaultValue
+	}
+	return value
 }
 
-func getEnvAsSlice(key string, defaultValue []string) []string {
-	valueStr := getEnv(key, "")
+func (s *settings) getEnvAsSlice(key string, defaultValue []string) []string {
+	valueStr := s.getEnv(key, "")
 	if valueStr == "" {
 		return defaultValue
 	}
 	return strings.Split(valueStr, ",")
-}
\ No newline at end of file
+}
+
+// getEnvAsFloatMap parses "name=value" pairs separated by commas, e.g.
+// "BIOLOGY=0.7,MATHEMATICS=0.9"
+func (s *settings) getEnvAsFloatMap(key string, defaultValue map[string]float64) map[string]float64 {
+	valueStr := s.getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	values := make(map[string]float64)
+	for _, pair := range strings.Split(valueStr, ",") {
+		name, numStr, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		value, err := strconv.ParseFloat(strings.TrimSpace(numStr), 64)
+		if !ok || name == "" || err != nil {
+			s.invalid = append(s.invalid, fmt.Sprintf("%s=%q is not a list of name=number pairs", key, valueStr))
+			return defaultValue
+		}
+		values[strings.TrimSpace(name)] = value
+	}
+	return values
+}
+
+// getEnvAsListMap parses "name=value|value" pairs separated by commas, e.g.
+// "NEET=PHYSICS|CHEMISTRY|BIOLOGY,BITSAT=PHYSICS|CHEMISTRY|MATHEMATICS"
+func (s *settings) getEnvAsListMap(key string, defaultValue map[string][]string) map[string][]string {
+	valueStr := s.getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	lists := make(map[string][]string)
+	for _, pair := range strings.Split(valueStr, ",") {
+		name, listStr, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			s.invalid = append(s.invalid, fmt.Sprintf("%s=%q is not a list of name=value|value pairs", key, valueStr))
+			return defaultValue
+		}
+		var values []string
+		for _, value := range strings.Split(listStr, "|") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		lists[name] = values
+	}
+	return lists
+}
+
+// getEnvAsLimits parses "prefix=limit" pairs separated by commas, e.g.
+// "/v1/questions/generate=300,/v1/answers=600"
+func (s *settings) getEnvAsLimits(key string, defaultValue map[string]int64) map[string]int64 {
+	valueStr := s.getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	limits := make(map[string]int64)
+	for _, pair := range strings.Split(valueStr, ",") {
+		prefix, limitStr, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		limit, err := strconv.ParseInt(limitStr, 10, 64)
+		if !ok || err != nil {
+			s.invalid = append(s.invalid, fmt.Sprintf("%s=%q is not a list of prefix=limit pairs", key, valueStr))
+			return defaultValue
+		}
+		limits[prefix] = limit
+	}
+	return limits
+}
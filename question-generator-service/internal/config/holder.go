@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Holder publishes the current configuration to request handlers. The
+// tunable settings (RAG thresholds, rate limits, log level and template
+// scoring weights) can be replaced at runtime; everything else keeps the
+// values the service started with, since database and server bindings
+// cannot change without a restart.
+type Holder struct {
+	current atomic.Value // *AppConfig, never mutated once stored
+	mu      sync.Mutex   // Serializes reloads
+}
+
+// NewHolder publishes cfg as the current configuration
+func NewHolder(cfg *AppConfig) *Holder {
+	h := &Holder{}
+	h.current.Store(cfg)
+	return h
+}
+
+// Get returns the current configuration. Callers must not modify it.
+func (h *Holder) Get() *AppConfig {
+	return h.current.Load().(*AppConfig)
+}
+
+// Reload re-reads the configuration from the environment and config file
+// and applies its tunable settings, returning what changed
+func (h *Holder) Reload() ([]string, error) {
+	next, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return h.Apply(next)
+}
+
+// Apply swaps in the tunable settings of next, keeping the rest of the
+// current configuration, and returns a description of each change
+func (h *Holder) Apply(next *AppConfig) ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	current := h.Get()
+	updated := *current
+	updated.RAG.AlignmentThreshold = next.RAG.AlignmentThreshold
+	updated.RAG.SubjectThresholds = next.RAG.SubjectThresholds
+	updated.RateLimit.PerMinute = next.RateLimit.PerMinute
+	updated.RateLimit.Burst = next.RateLimit.Burst
+	updated.RateLimit.PathOverrides = next.RateLimit.PathOverrides
+	updated.Logging.Level = next.Logging.Level
+	updated.Templates.Scoring = next.Templates.Scoring
+
+	if err := updated.validate(); err != nil {
+		return nil, fmt.Errorf("reloaded configuration is invalid: %w", err)
+	}
+
+	var changes []string
+	changed := func(name string, from, to interface{}) {
+		if !reflect.DeepEqual(from, to) {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", name, from, to))
+		}
+	}
+	changed("RAG.AlignmentThreshold", current.RAG.AlignmentThreshold, updated.RAG.AlignmentThreshold)
+	changed("RAG.SubjectThresholds", current.RAG.SubjectThresholds, updated.RAG.SubjectThresholds)
+	changed("RateLimit.PerMinute", current.RateLimit.PerMinute, updated.RateLimit.PerMinute)
+	changed("RateLimit.Burst", current.RateLimit.Burst, updated.RateLimit.Burst)
+	changed("RateLimit.PathOverrides", current.RateLimit.PathOverrides, updated.RateLimit.PathOverrides)
+	changed("Logging.Level", current.Logging.Level, updated.Logging.Level)
+	changed("Templates.Scoring", current.Templates.Scoring, updated.Templates.Scoring)
+
+	if len(changes) > 0 {
+		h.current.Store(&updated)
+	}
+	return changes, nil
+}
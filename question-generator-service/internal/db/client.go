@@ -3,28 +3,103 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
-	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/lib/pq"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 
 	"question-generator-service/internal/config"
 )
 
+// ErrTemplateNotFound is returned when no active template has the requested ID
+var ErrTemplateNotFound = errors.New("template not found")
+
+// ErrTemplateExists is returned when creating a template whose ID is taken
+var ErrTemplateExists = errors.New("template already exists")
+
+// ErrGenerationLogNotFound is returned when no generation log matches a lookup
+var ErrGenerationLogNotFound = errors.New("generation log not found")
+
+// ErrQuestionNotFound is returned when no generated question has the requested ID
+var ErrQuestionNotFound = errors.New("question not found")
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// uniqueViolation is the Postgres error code for a duplicate key
+const uniqueViolation = "23505"
+
 // Client wraps database connection with helper methods
 type Client struct {
-	db  *sql.DB
-	cfg config.DatabaseConfig
+	db        *sql.DB
+	cfg       config.DatabaseConfig
+	stmts     map[string]*sql.Stmt // Prepared static queries by SQL text
+	templates *templateCache       // Nil when template caching is disabled
+}
+
+// NewClient connects to Postgres with connection pooling, retrying while the
+// database is not yet reachable (e.g. still starting alongside the service)
+func NewClient(ctx context.Context, cfg config.DatabaseConfig) (*Client, error) {
+	return NewClientWithOpener(ctx, cfg, func() (*sql.DB, error) {
+		return sql.Open("postgres", cfg.GetDatabaseDSN())
+	})
+}
+
+// Opener opens a connection pool without necessarily connecting
+type Opener func() (*sql.DB, error)
+
+// pingTimeout bounds each connection attempt
+const pingTimeout = 10 * time.Second
+
+// maxConnectRetryDelay caps the exponential backoff between attempts
+const maxConnectRetryDelay = 30 * time.Second
+
+// NewClientWithOpener opens and pings a pool from open, making up to
+// cfg.ConnectRetries further attempts with exponential backoff. It gives up
+// early when ctx is done. Queries run unprepared until PrepareStatements is
+// called, which must wait for migrations since the statements name columns
+// later migrations add.
+func NewClientWithOpener(ctx context.Context, cfg config.DatabaseConfig, open Opener) (*Client, error) {
+	delay := cfg.ConnectRetryDelay
+	var lastErr error
+	for attempt := 1; attempt <= cfg.ConnectRetries+1; attempt++ {
+		if attempt > 1 {
+			log.Printf("Database connection attempt %d/%d failed: %v; retrying in %s",
+				attempt-1, cfg.ConnectRetries+1, lastErr, delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, fmt.Errorf("gave up connecting to database: %w (last error: %v)", ctx.Err(), lastErr)
+			}
+			if delay *= 2; delay > maxConnectRetryDelay {
+				delay = maxConnectRetryDelay
+			}
+		}
+
+		db, err := connect(ctx, cfg, open)
+		if err == nil {
+			log.Printf("Successfully connected to database %s:%d/%s",
+				cfg.Host, cfg.Port, cfg.Database)
+			return &Client{db: db, cfg: cfg, templates: newTemplateCache(cfg.TemplateCacheSize, cfg.TemplateCacheTTL)}, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("gave up connecting to database: %w (last error: %v)", ctx.Err(), lastErr)
+		}
+	}
+	return nil, fmt.Errorf("failed to connect to database after %d attempts: %w", cfg.ConnectRetries+1, lastErr)
 }
 
-// NewClient creates a new database client with connection pooling
-func NewClient(cfg config.DatabaseConfig) (*Client, error) {
-	db, err := sql.Open("postgres", cfg.GetDatabaseDSN())
+// connect opens a pool and pings it once
+func connect(ctx context.Context, cfg config.DatabaseConfig, open Opener) (*sql.DB, error) {
+	db, err := open()
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -35,25 +110,40 @@ func NewClient(cfg config.DatabaseConfig) (*Client, error) {
 	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	// Test the connection
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
 	defer cancel()
 
-	if err := db.PingContext(ctx); err != nil {
+	if err := db.PingContext(pingCtx); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
+	return db, nil
+}
 
-	log.Printf("Successfully connected to database %s:%d/%s", 
-		cfg.Host, cfg.Port, cfg.Database)
+// NewClientFromDB wraps an already opened connection pool, e.g. one backed
+// by a test driver. Migrations need a Client created by NewClient, queries
+// run unprepared until PrepareStatements is called, and templates are not
+// cached until EnableTemplateCache is called.
+func NewClientFromDB(db *sql.DB) *Client {
+	return &Client{db: db}
+}
+
+// EnableTemplateCache makes GetQuestionTemplate serve up to size templates,
+// and GetTemplatesByFilters up to size selections, from memory for ttl
+// each, replacing any cache already held. A size of zero disables caching.
+func (c *Client) EnableTemplateCache(size int, ttl time.Duration) {
+	c.templates = newTemplateCache(size, ttl)
+}
 
-	return &Client{
-		db:  db,
-		cfg: cfg,
-	}, nil
+// WarmTemplateCache stores templates in the template cache, when enabled,
+// as though GetQuestionTemplate had just read them
+func (c *Client) WarmTemplateCache(templates []*QuestionTemplate) {
+	c.templates.warm(templates)
 }
 
-// Close closes the database connection
+// Close closes the prepared statements and the database connection
 func (c *Client) Close() error {
+	c.closeStatements()
 	return c.db.Close()
 }
 
@@ -62,63 +152,48 @@ func (c *Client) Ping(ctx context.Context) error {
 	return c.db.PingContext(ctx)
 }
 
+// ServerVersion returns the version reported by the database server
+func (c *Client) ServerVersion(ctx context.Context) (string, error) {
+	var version string
+	if err := c.db.QueryRowContext(ctx, "SHOW server_version").Scan(&version); err != nil {
+		return "", fmt.Errorf("failed to query server version: %w", err)
+	}
+	return version, nil
+}
+
 // DB returns the underlying sql.DB instance
 func (c *Client) DB() *sql.DB {
 	return c.db
 }
 
-// RunMigrations applies database migrations from the migrations directory
-func (c *Client) RunMigrations() error {
-	driver, err := postgres.WithInstance(c.db, &postgres.Config{})
-	if err != nil {
-		return fmt.Errorf("failed to create migration driver: %w", err)
-	}
-
-	// Construct migration source URL
-	migrationsURL := fmt.Sprintf("file://%s", filepath.Join(c.cfg.MigrationsPath))
-	
-	m, err := migrate.NewWithDatabaseInstance(
-		migrationsURL,
-		"postgres",
-		driver,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create migrator: %w", err)
-	}
-
-	// Apply migrations
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		return fmt.Errorf("failed to apply migrations: %w", err)
+// GetQuestionTemplate retrieves an active question template by ID, serving
+// it from the template cache when enabled. Pointer fields of the returned
+// template may be shared with the cache and must not be modified through.
+func (c *Client) GetQuestionTemplate(ctx context.Context, templateID string) (*QuestionTemplate, error) {
+	cached, generation := c.templates.get(templateID)
+	if cached != nil {
+		return cached, nil
 	}
-
-	version, dirty, err := m.Version()
+	qt, err := c.GetQuestionTemplateUncached(ctx, templateID)
 	if err != nil {
-		log.Printf("Database migrations applied successfully")
-	} else {
-		log.Printf("Database at migration version %d (dirty: %v)", version, dirty)
+		return nil, err
 	}
-
-	return nil
+	c.templates.put(qt, generation)
+	return qt, nil
 }
 
-// GetQuestionTemplate retrieves a question template by ID with optimized query
-func (c *Client) GetQuestionTemplate(ctx context.Context, templateID string) (*QuestionTemplate, error) {
-	query := `
-		SELECT template_id, topic_id, exam_type, subject, format, template_text, 
-			   variable_slots, options_template, base_difficulty, bloom_level, 
-			   concept_depth, validation_score, ambiguity_flag, clarity_score,
-			   chapter, sub_chapter, ncert_reference, usage_count, success_rate,
-			   avg_solve_time, created_at, updated_at, is_active, version
-		FROM question_templates 
-		WHERE template_id = $1 AND is_active = true`
-
+// GetQuestionTemplateUncached retrieves an active question template by ID
+// straight from the database, for authoring and admin paths that must see
+// the latest stored version
+func (c *Client) GetQuestionTemplateUncached(ctx context.Context, templateID string) (*QuestionTemplate, error) {
 	var qt QuestionTemplate
-	var optionsTemplate, validationScore, successRate sql.NullString
+	var optionsTemplate, optionsTemplateHi sql.NullString
+	var validationScore, successRate sql.NullFloat64
 	var avgSolveTime sql.NullInt64
 
-	err := c.db.QueryRowContext(ctx, query, templateID).Scan(
+	err := c.queryRow(ctx, nil, getTemplateQuery, templateID).Scan(
 		&qt.TemplateID, &qt.TopicID, &qt.ExamType, &qt.Subject, &qt.Format,
-		&qt.TemplateText, &qt.VariableSlots, &optionsTemplate, &qt.BaseDifficulty,
+		&qt.TemplateText, &qt.TemplateTextHi, &qt.VariableSlots, &optionsTemplate, &optionsTemplateHi, &qt.AnswerUnit, &qt.AnswerFormula, &qt.NumericalTolerance, &qt.AnswerPrecision, &qt.RenderFormat, &qt.BaseDifficulty,
 		&qt.BloomLevel, &qt.ConceptDepth, &validationScore, &qt.AmbiguityFlag,
 		&qt.ClarityScore, &qt.Chapter, &qt.SubChapter, &qt.NCERTReference,
 		&qt.UsageCount, &successRate, &avgSolveTime, &qt.CreatedAt,
@@ -127,7 +202,7 @@ func (c *Client) GetQuestionTemplate(ctx context.Context, templateID string) (*Q
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("template %s not found", templateID)
+			return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, templateID)
 		}
 		return nil, fmt.Errorf("failed to get template: %w", err)
 	}
@@ -136,15 +211,14 @@ func (c *Client) GetQuestionTemplate(ctx context.Context, templateID string) (*Q
 	if optionsTemplate.Valid {
 		qt.OptionsTemplate = &optionsTemplate.String
 	}
+	if optionsTemplateHi.Valid {
+		qt.OptionsTemplateHi = &optionsTemplateHi.String
+	}
 	if validationScore.Valid {
-		if score, err := parseFloat64(validationScore.String); err == nil {
-			qt.ValidationScore = &score
-		}
+		qt.ValidationScore = &validationScore.Float64
 	}
 	if successRate.Valid {
-		if rate, err := parseFloat64(successRate.String); err == nil {
-			qt.SuccessRate = &rate
-		}
+		qt.SuccessRate = &successRate.Float64
 	}
 	if avgSolveTime.Valid {
 		qt.AvgSolveTime = &avgSolveTime.Int64
@@ -153,11 +227,29 @@ func (c *Client) GetQuestionTemplate(ctx context.Context, templateID string) (*Q
 	return &qt, nil
 }
 
-// GetTemplatesByFilters retrieves templates matching the specified criteria
+// GetTemplatesByFilters retrieves templates matching the specified
+// criteria, serving repeated selections from the template cache when
+// enabled. Pointer fields of the returned templates may be shared with the
+// cache and must not be modified through.
 func (c *Client) GetTemplatesByFilters(ctx context.Context, filters TemplateFilters) ([]*QuestionTemplate, error) {
+	cached, ok, generation := c.templates.getSelection(filters)
+	if ok {
+		return cached, nil
+	}
+	templates, err := c.queryTemplatesByFilters(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	c.templates.putSelection(filters, templates, generation)
+	return templates, nil
+}
+
+// queryTemplatesByFilters reads the templates matching filters from the
+// database
+func (c *Client) queryTemplatesByFilters(ctx context.Context, filters TemplateFilters) ([]*QuestionTemplate, error) {
 	query := `
-		SELECT template_id, topic_id, exam_type, subject, format, template_text,
-			   variable_slots, base_difficulty, bloom_level, concept_depth,
+		SELECT template_id, topic_id, exam_type, subject, format, template_text, template_text_hi,
+			   variable_slots, options_template, options_template_hi, answer_unit, answer_formula, answer_precision, render_format, base_difficulty, bloom_level, concept_depth,
 			   chapter, validation_score, usage_count, success_rate
 		FROM question_templates
 		WHERE is_active = true`
@@ -202,6 +294,10 @@ func (c *Client) GetTemplatesByFilters(ctx context.Context, filters TemplateFilt
 		argIndex++
 	}
 
+	if filters.HasHindi {
+		query += " AND template_text_hi IS NOT NULL"
+	}
+
 	// Add ordering and limits for performance
 	query += ` ORDER BY usage_count DESC, success_rate DESC NULLS LAST, validation_score DESC NULLS LAST`
 	
@@ -224,7 +320,7 @@ func (c *Client) GetTemplatesByFilters(ctx context.Context, filters TemplateFilt
 
 		err := rows.Scan(
 			&qt.TemplateID, &qt.TopicID, &qt.ExamType, &qt.Subject, &qt.Format,
-			&qt.TemplateText, &qt.VariableSlots, &qt.BaseDifficulty, &qt.BloomLevel,
+			&qt.TemplateText, &qt.TemplateTextHi, &qt.VariableSlots, &qt.OptionsTemplate, &qt.OptionsTemplateHi, &qt.AnswerUnit, &qt.AnswerFormula, &qt.AnswerPrecision, &qt.RenderFormat, &qt.BaseDifficulty, &qt.BloomLevel,
 			&qt.ConceptDepth, &qt.Chapter, &validationScore, &qt.UsageCount, &successRate,
 		)
 		if err != nil {
@@ -248,37 +344,313 @@ func (c *Client) GetTemplatesByFilters(ctx context.Context, filters TemplateFilt
 	return templates, nil
 }
 
-// CreateGenerationLog inserts a new generation log entry
-func (c *Client) CreateGenerationLog(ctx context.Context, log *GenerationLog) error {
+// Bounds on the page size of SearchTemplates
+const (
+	DefaultTemplateSearchLimit = 50
+	MaxTemplateSearchLimit     = 200
+)
+
+// templateSummaryColumns are the columns read by SearchTemplates
+const templateSummaryColumns = `template_id, topic_id, exam_type, subject, format, template_text,
+			base_difficulty, bloom_level, chapter, sub_chapter, ncert_reference,
+			usage_count, is_active, updated_at`
+
+// likeEscaper escapes the LIKE wildcards in a search term
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchTemplates lists the templates matching search by template ID, a
+// page at a time, with only the columns needed to tell them apart. Unlike
+// GetTemplatesByFilters it includes inactive templates unless asked not to.
+func (c *Client) SearchTemplates(ctx context.Context, search TemplateSearch) (*TemplatePage, error) {
 	query := `
-		INSERT INTO question_generation_logs (
-			student_id, session_id, request_id, topic_id, exam_type, subject, format,
-			requested_difficulty, calibrated_difficulty, bkt_mastery_level,
-			template_id, template_variables, generated_question_text, generated_options,
-			correct_answer, solution_steps, grammar_score, clarity_score, ambiguity_score,
-			validator_feedback, rag_alignment_score, rag_exemplar_ids, rag_feedback,
-			regeneration_triggered, regeneration_reason, generation_time_ms,
-			calibration_time_ms, validation_time_ms, rag_time_ms, total_pipeline_time_ms,
-			validation_passed, final_quality_score, status, error_message, retry_count,
-			generator_version, model_version
+		SELECT ` + templateSummaryColumns + `
+		FROM question_templates
+		WHERE true`
+
+	args := []interface{}{}
+	argIndex := 1
+	for _, cond := range []struct {
+		column string
+		value  string
+	}{
+		{"subject", search.Subject},
+		{"exam_type", search.ExamType},
+		{"topic_id", search.TopicID},
+		{"chapter", search.Chapter},
+	} {
+		if cond.value != "" {
+			query += fmt.Sprintf(" AND %s = $%d", cond.column, argIndex)
+			args = append(args, cond.value)
+			argIndex++
+		}
+	}
+
+	if search.BloomLevel > 0 {
+		query += fmt.Sprintf(" AND bloom_level = $%d", argIndex)
+		args = append(args, search.BloomLevel)
+		argIndex++
+	}
+
+	if search.MinDifficulty > 0 {
+		query += fmt.Sprintf(" AND base_difficulty >= $%d", argIndex)
+		args = append(args, search.MinDifficulty)
+		argIndex++
+	}
+
+	if search.MaxDifficulty > 0 {
+		query += fmt.Sprintf(" AND base_difficulty <= $%d", argIndex)
+		args = append(args, search.MaxDifficulty)
+		argIndex++
+	}
+
+	if search.Active != nil {
+		query += fmt.Sprintf(" AND is_active = $%d", argIndex)
+		args = append(args, *search.Active)
+		argIndex++
+	}
+
+	for _, cond := range []struct {
+		column string
+		value  string
+	}{
+		{"template_text", search.Text},
+		{"ncert_reference", search.NCERT},
+	} {
+		if cond.value != "" {
+			query += fmt.Sprintf(" AND %s ILIKE $%d", cond.column, argIndex)
+			args = append(args, "%"+likeEscaper.Replace(cond.value)+"%")
+			argIndex++
+		}
+	}
+
+	if search.Cursor != "" {
+		// The cursor is compared with the UUID column, so anything but a
+		// template ID would fail the query rather than the request
+		after, err := base64.RawURLEncoding.DecodeString(search.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCursor, search.Cursor)
+		}
+		if _, err := uuid.Parse(string(after)); err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCursor, search.Cursor)
+		}
+		query += fmt.Sprintf(" AND template_id > $%d", argIndex)
+		args = append(args, string(after))
+		argIndex++
+	}
+
+	limit := search.Limit
+	if limit <= 0 {
+		limit = DefaultTemplateSearchLimit
+	}
+	if limit > MaxTemplateSearchLimit {
+		limit = MaxTemplateSearchLimit
+	}
+	// One extra row tells whether there is a next page
+	query += fmt.Sprintf(" ORDER BY template_id LIMIT $%d", argIndex)
+	args = append(args, limit+1)
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search templates: %w", err)
+	}
+	defer rows.Close()
+
+	page := &TemplatePage{}
+	for rows.Next() {
+		var qt QuestionTemplate
+		err := rows.Scan(
+			&qt.TemplateID, &qt.TopicID, &qt.ExamType, &qt.Subject, &qt.Format, &qt.TemplateText,
+			&qt.BaseDifficulty, &qt.BloomLevel, &qt.Chapter, &qt.SubChapter, &qt.NCERTReference,
+			&qt.UsageCount, &qt.IsActive, &qt.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan template row: %w", err)
+		}
+		page.Templates = append(page.Templates, &qt)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating template rows: %w", err)
+	}
+
+	if len(page.Templates) > limit {
+		page.Templates = page.Templates[:limit]
+		last := page.Templates[limit-1]
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(last.TemplateID))
+	}
+	return page, nil
+}
+
+// ListTopics lists the topics that have active templates, ordered by
+// subject and topic ID, with the number of templates and the range of base
+// difficulties each covers
+func (c *Client) ListTopics(ctx context.Context, filters TopicFilters) ([]TopicSummary, error) {
+	query := `
+		SELECT topic_id, subject, COUNT(*), MIN(base_difficulty), MAX(base_difficulty)
+		FROM question_templates
+		WHERE is_active = true`
+
+	args := []interface{}{}
+	argIndex := 1
+	for _, cond := range []struct {
+		column string
+		value  string
+	}{
+		{"subject", filters.Subject},
+		{"exam_type", filters.ExamType},
+	} {
+		if cond.value != "" {
+			query += fmt.Sprintf(" AND %s = $%d", cond.column, argIndex)
+			args = append(args, cond.value)
+			argIndex++
+		}
+	}
+	query += ` GROUP BY subject, topic_id ORDER BY subject, topic_id`
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list topics: %w", err)
+	}
+	defer rows.Close()
+
+	var topics []TopicSummary
+	for rows.Next() {
+		var topic TopicSummary
+		if err := rows.Scan(&topic.TopicID, &topic.Subject, &topic.TemplateCount, &topic.MinDifficulty, &topic.MaxDifficulty); err != nil {
+			return nil, fmt.Errorf("failed to scan topic row: %w", err)
+		}
+		topics = append(topics, topic)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating topic rows: %w", err)
+	}
+	return topics, nil
+}
+
+// CreateTemplate inserts a new active template. An empty TemplateID lets the
+// database assign one; the stored ID, counters and timestamps are written
+// back to qt.
+func (c *Client) CreateTemplate(ctx context.Context, qt *QuestionTemplate) error {
+	query := `
+		INSERT INTO question_templates (
+			template_id, topic_id, exam_type, subject, format, template_text,
+			variable_slots, options_template, answer_unit, render_format, base_difficulty, bloom_level,
+			concept_depth, chapter, sub_chapter, ncert_reference, numerical_tolerance, answer_formula,
+			template_text_hi, options_template_hi, answer_precision
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16,
-			$17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30,
-			$31, $32, $33, $34, $35, $36, $37
-		) RETURNING id`
+			COALESCE(NULLIF($1, '')::uuid, gen_random_uuid()), $2, $3, $4, $5, $6,
+			$7, $8, $9, COALESCE(NULLIF($10, ''), 'PLAIN'), $11, $12,
+			$13, $14, $15, $16, $17, $18,
+			$19, $20, $21
+		)
+		RETURNING template_id, render_format, usage_count, created_at, updated_at, is_active, version`
 
 	err := c.db.QueryRowContext(ctx, query,
-		log.StudentID, log.SessionID, log.RequestID, log.TopicID, log.ExamType,
+		qt.TemplateID, qt.TopicID, qt.ExamType, qt.Subject, qt.Format, qt.TemplateText,
+		qt.VariableSlots, qt.OptionsTemplate, qt.AnswerUnit, qt.RenderFormat, qt.BaseDifficulty, qt.BloomLevel,
+		qt.ConceptDepth, qt.Chapter, qt.SubChapter, qt.NCERTReference, qt.NumericalTolerance, qt.AnswerFormula,
+		qt.TemplateTextHi, qt.OptionsTemplateHi, qt.AnswerPrecision,
+	).Scan(&qt.TemplateID, &qt.RenderFormat, &qt.UsageCount, &qt.CreatedAt, &qt.UpdatedAt, &qt.IsActive, &qt.Version)
+
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return fmt.Errorf("%w: %s", ErrTemplateExists, qt.TemplateID)
+		}
+		return fmt.Errorf("failed to create template: %w", err)
+	}
+	c.templates.invalidate(qt.TemplateID)
+
+	return nil
+}
+
+// UpdateTemplate replaces the editable fields of an active template and
+// bumps its version. Usage statistics and quality scores are left untouched.
+func (c *Client) UpdateTemplate(ctx context.Context, qt *QuestionTemplate) error {
+	query := `
+		UPDATE question_templates
+		SET topic_id = $2, exam_type = $3, subject = $4, format = $5, template_text = $6,
+			variable_slots = $7, options_template = $8, answer_unit = $9,
+			render_format = COALESCE(NULLIF($10, ''), 'PLAIN'), base_difficulty = $11, bloom_level = $12,
+			concept_depth = $13, chapter = $14, sub_chapter = $15, ncert_reference = $16,
+			numerical_tolerance = $17, answer_formula = $18, template_text_hi = $19, options_template_hi = $20,
+			answer_precision = $21, version = version + 1, updated_at = NOW()
+		WHERE template_id = $1 AND is_active = true
+		RETURNING render_format, usage_count, created_at, updated_at, is_active, version`
+
+	err := c.db.QueryRowContext(ctx, query,
+		qt.TemplateID, qt.TopicID, qt.ExamType, qt.Subject, qt.Format, qt.TemplateText,
+		qt.VariableSlots, qt.OptionsTemplate, qt.AnswerUnit, qt.RenderFormat, qt.BaseDifficulty, qt.BloomLevel,
+		qt.ConceptDepth, qt.Chapter, qt.SubChapter, qt.NCERTReference, qt.NumericalTolerance, qt.AnswerFormula,
+		qt.TemplateTextHi, qt.OptionsTemplateHi, qt.AnswerPrecision,
+	).Scan(&qt.RenderFormat, &qt.UsageCount, &qt.CreatedAt, &qt.UpdatedAt, &qt.IsActive, &qt.Version)
+	c.templates.invalidate(qt.TemplateID)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %s", ErrTemplateNotFound, qt.TemplateID)
+		}
+		return fmt.Errorf("failed to update template: %w", err)
+	}
+
+	return nil
+}
+
+// deactivateTemplateQuery clears a template's is_active, affecting no row
+// when it is missing or already inactive
+const deactivateTemplateQuery = `
+		UPDATE question_templates
+		SET is_active = false, updated_at = NOW()
+		WHERE template_id = $1 AND is_active = true`
+
+// DeactivateTemplate soft-deletes a template by clearing is_active, keeping
+// the row for generation logs that reference it
+func (c *Client) DeactivateTemplate(ctx context.Context, templateID string) error {
+	result, err := c.db.ExecContext(ctx, deactivateTemplateQuery, templateID)
+	c.templates.invalidate(templateID)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate template: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, templateID)
+	}
+
+	return nil
+}
+
+// CreateGenerationLog inserts a new generation log entry
+func (c *Client) CreateGenerationLog(ctx context.Context, log *GenerationLog) error {
+	return c.CreateGenerationLogTx(ctx, nil, log)
+}
+
+// CreateGenerationLogTx inserts a new generation log entry within tx, or
+// directly on the pool when tx is nil
+func (c *Client) CreateGenerationLogTx(ctx context.Context, tx *sql.Tx, log *GenerationLog) error {
+	// NULL rather than "" keeps rows without a question ID out of the unique index
+	questionID := sql.NullString{String: log.QuestionID, Valid: log.QuestionID != ""}
+	sessionID := sql.NullString{String: log.SessionID, Valid: log.SessionID != ""}
+	err := c.queryRow(ctx, tx, insertGenerationLogQuery,
+		questionID, log.StudentID, sessionID, log.RequestID, log.TopicID, log.ExamType,
 		log.Subject, log.Format, log.RequestedDifficulty, log.CalibratedDifficulty,
 		log.BKTMasteryLevel, log.TemplateID, log.TemplateVariables,
 		log.GeneratedQuestionText, log.GeneratedOptions, log.CorrectAnswer,
 		log.SolutionSteps, log.GrammarScore, log.ClarityScore, log.AmbiguityScore,
 		log.ValidatorFeedback, log.RAGAlignmentScore, log.RAGExemplarIDs,
-		log.RAGFeedback, log.RegenerationTriggered, log.RegenerationReason,
+		log.RAGExemplars, log.RAGFeedback, log.RegenerationTriggered, log.RegenerationReason,
 		log.GenerationTimeMs, log.CalibrationTimeMs, log.ValidationTimeMs,
 		log.RAGTimeMs, log.TotalPipelineTimeMs, log.ValidationPassed,
 		log.FinalQualityScore, log.Status, log.ErrorMessage, log.RetryCount,
 		log.GeneratorVersion, log.ModelVersion,
+		sql.NullString{String: log.CalibrationFallback, Valid: log.CalibrationFallback != ""},
+		sql.NullString{String: log.CalibrationSource, Valid: log.CalibrationSource != ""},
+		log.BKTConfidence, sql.NullString{String: log.BKTRecommendation, Valid: log.BKTRecommendation != ""},
+		log.DifficultyBand, log.TimedOutStages, log.SkippedStages,
+		sql.NullString{String: log.FallbackExamType, Valid: log.FallbackExamType != ""}, log.StageOverrides,
 	).Scan(&log.ID)
 
 	if err != nil {
@@ -356,7 +728,390 @@ func (c *Client) UpdateGenerationLog(ctx context.Context, logID int64, updates G
 	return nil
 }
 
-// IncrementTemplateUsage atomically increments usage count for a template
+// UpdateGenerationLogOutcome writes the outcome of a generation, from its
+// status to the calibration it used, to the log with ID log.ID
+func (c *Client) UpdateGenerationLogOutcome(ctx context.Context, log *GenerationLog) error {
+	questionID := sql.NullString{String: log.QuestionID, Valid: log.QuestionID != ""}
+	_, err := c.exec(ctx, updateGenerationLogOutcomeQuery, log.Status, log.FinalQualityScore,
+		log.RAGAlignmentScore, log.ValidationPassed, log.ErrorMessage,
+		log.RegenerationTriggered, log.RegenerationReason, log.RegenerationAttempts,
+		log.RetryCount, log.RAGExemplarIDs, log.RAGExemplars, log.RAGFeedback,
+		questionID, sql.NullString{String: log.CalibrationFallback, Valid: log.CalibrationFallback != ""},
+		sql.NullString{String: log.CalibrationSource, Valid: log.CalibrationSource != ""},
+		log.BKTConfidence, sql.NullString{String: log.BKTRecommendation, Valid: log.BKTRecommendation != ""},
+		log.DifficultyBand, log.TimedOutStages, log.SkippedStages,
+		sql.NullString{String: log.FallbackExamType, Valid: log.FallbackExamType != ""}, log.StageOverrides, log.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update generation log: %w", err)
+	}
+	return nil
+}
+
+// SaveGeneratedQuestion stores a served question under its question_id
+func (c *Client) SaveGeneratedQuestion(ctx context.Context, q *GeneratedQuestion) error {
+	query := `
+		INSERT INTO generated_questions (
+			question_id, template_id, student_id, request_id, question_text, options,
+			correct_answer, solution_steps, render_format, difficulty, seed
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, COALESCE(NULLIF($9, ''), 'PLAIN'), $10, $11
+		)
+		RETURNING created_at`
+
+	err := c.db.QueryRowContext(ctx, query,
+		q.QuestionID, q.TemplateID, q.StudentID, q.RequestID, q.QuestionText, q.Options,
+		q.CorrectAnswer, q.SolutionSteps, q.RenderFormat, q.Difficulty, q.Seed,
+	).Scan(&q.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to save generated question: %w", err)
+	}
+
+	return nil
+}
+
+// GetGeneratedQuestion retrieves a served question by its question_id
+func (c *Client) GetGeneratedQuestion(ctx context.Context, questionID string) (*GeneratedQuestion, error) {
+	query := `
+		SELECT question_id, template_id, student_id, request_id, question_text, options,
+			   correct_answer, solution_steps, render_format, difficulty, seed, created_at
+		FROM generated_questions
+		WHERE question_id = $1`
+
+	var q GeneratedQuestion
+	var requestID sql.NullString
+
+	err := c.db.QueryRowContext(ctx, query, questionID).Scan(
+		&q.QuestionID, &q.TemplateID, &q.StudentID, &requestID, &q.QuestionText, &q.Options,
+		&q.CorrectAnswer, &q.SolutionSteps, &q.RenderFormat, &q.Difficulty, &q.Seed, &q.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrQuestionNotFound, questionID)
+		}
+		return nil, fmt.Errorf("failed to get generated question: %w", err)
+	}
+
+	q.RequestID = requestID.String
+	return &q, nil
+}
+
+// FindSimilarQuestions lists the questions recently served to a student
+// whose text is at least query.MinSimilarity similar to query.QuestionText,
+// most similar first. Similarity is pg_trgm's trigram similarity, from 0
+// for no shared trigrams to 1 for the same text up to case and punctuation.
+func (c *Client) FindSimilarQuestions(ctx context.Context, query SimilarQuestionQuery) ([]SimilarQuestion, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultSimilarQuestionLimit
+	}
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT question_id, template_id, question_text, similarity(question_text, $2) AS score, created_at
+		FROM generated_questions
+		WHERE student_id = $1 AND created_at >= $3 AND similarity(question_text, $2) >= $4
+		ORDER BY score DESC, created_at DESC
+		LIMIT $5`,
+		query.StudentID, query.QuestionText, query.Since, query.MinSimilarity, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find similar questions: %w", err)
+	}
+	defer rows.Close()
+
+	var similar []SimilarQuestion
+	for rows.Next() {
+		var q SimilarQuestion
+		if err := rows.Scan(&q.QuestionID, &q.TemplateID, &q.QuestionText, &q.Similarity, &q.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan similar question row: %w", err)
+		}
+		similar = append(similar, q)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating similar question rows: %w", err)
+	}
+	return similar, nil
+}
+
+// GetGenerationLogByQuestionID finds the generation log behind a question_id
+// returned to a client
+func (c *Client) GetGenerationLogByQuestionID(ctx context.Context, questionID string) (*GenerationLog, error) {
+	log, err := c.getGenerationLog(ctx, "question_id = $1", questionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: question %s", ErrGenerationLogNotFound, questionID)
+	}
+	return log, err
+}
+
+// GetCompletedGenerationLogByRequestID finds the generation that completed
+// for a request_id, so a retried request can be answered without generating
+// again
+func (c *Client) GetCompletedGenerationLogByRequestID(ctx context.Context, requestID string) (*GenerationLog, error) {
+	log, err := c.getGenerationLog(ctx, "request_id = $1 AND status = 'COMPLETED'", requestID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: request %s", ErrGenerationLogNotFound, requestID)
+	}
+	return log, err
+}
+
+// generationLogColumns are read by every generation log lookup, and
+// generationLogDetailColumns additionally by verbose queries
+const (
+	generationLogColumns = `id, question_id, student_id, session_id, request_id, topic_id, exam_type,
+			   subject, format, requested_difficulty, calibrated_difficulty, template_id,
+			   rag_alignment_score, final_quality_score, total_pipeline_time_ms,
+			   status, error_message, retry_count, created_at`
+	generationLogDetailColumns = `generated_question_text, generated_options, correct_answer`
+)
+
+// getGenerationLog reads the generation log matching condition, returning
+// sql.ErrNoRows unwrapped when there is none
+func (c *Client) getGenerationLog(ctx context.Context, condition string, arg interface{}) (*GenerationLog, error) {
+	query := `
+		SELECT ` + generationLogColumns + `
+		FROM question_generation_logs
+		WHERE ` + condition
+
+	log, err := scanGenerationLog(c.db.QueryRowContext(ctx, query, arg), false)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get generation log: %w", err)
+	}
+	return log, nil
+}
+
+// Bounds on the page size of QueryGenerationLogs
+const (
+	DefaultGenerationLogLimit = 50
+	MaxGenerationLogLimit     = 200
+)
+
+// QueryGenerationLogs lists the generation logs matching filters, newest
+// first, a page at a time. Pages are keyed on (created_at, id) so that
+// later pages stay cheap and stable while new logs are written.
+func (c *Client) QueryGenerationLogs(ctx context.Context, filters GenerationLogFilters) (*GenerationLogPage, error) {
+	columns := generationLogColumns
+	if filters.Verbose {
+		columns += ", " + generationLogDetailColumns
+	}
+	query := `
+		SELECT ` + columns + `
+		FROM question_generation_logs
+		WHERE true`
+
+	args := []interface{}{}
+	argIndex := 1
+	for _, cond := range []struct {
+		column string
+		value  string
+	}{
+		{"student_id", filters.StudentID},
+		{"status", filters.Status},
+		{"subject", filters.Subject},
+		{"exam_type", filters.ExamType},
+	} {
+		if cond.value != "" {
+			query += fmt.Sprintf(" AND %s = $%d", cond.column, argIndex)
+			args = append(args, cond.value)
+			argIndex++
+		}
+	}
+
+	if !filters.Since.IsZero() {
+		query += fmt.Sprintf(" AND created_at >= $%d", argIndex)
+		args = append(args, filters.Since)
+		argIndex++
+	}
+
+	if !filters.Until.IsZero() {
+		query += fmt.Sprintf(" AND created_at < $%d", argIndex)
+		args = append(args, filters.Until)
+		argIndex++
+	}
+
+	if filters.Cursor != "" {
+		createdAt, id, err := decodeLogCursor(filters.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", argIndex, argIndex+1)
+		args = append(args, createdAt, id)
+		argIndex += 2
+	}
+
+	limit := filters.Limit
+	if limit <= 0 {
+		limit = DefaultGenerationLogLimit
+	}
+	if limit > MaxGenerationLogLimit {
+		limit = MaxGenerationLogLimit
+	}
+	// One extra row tells whether there is a next page
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", argIndex)
+	args = append(args, limit+1)
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query generation logs: %w", err)
+	}
+	defer rows.Close()
+
+	page := &GenerationLogPage{}
+	for rows.Next() {
+		log, err := scanGenerationLog(rows, filters.Verbose)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan generation log row: %w", err)
+		}
+		page.Logs = append(page.Logs, log)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating generation log rows: %w", err)
+	}
+
+	if len(page.Logs) > limit {
+		page.Logs = page.Logs[:limit]
+		last := page.Logs[limit-1]
+		page.NextCursor = encodeLogCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+// trendBucketWidths are the supported GetQualityTrends buckets
+var trendBucketWidths = map[string]time.Duration{
+	TrendBucketHour: time.Hour,
+	TrendBucketDay:  24 * time.Hour,
+}
+
+// GetQualityTrends aggregates the finished generation logs between
+// filters.Since and filters.Until into hourly or daily buckets, oldest
+// first. Buckets are in UTC and every bucket of the range is returned, with
+// no generations where none were logged, so the series can be charted
+// as is.
+func (c *Client) GetQualityTrends(ctx context.Context, filters QualityTrendFilters) ([]QualityTrendBucket, error) {
+	width, ok := trendBucketWidths[filters.Bucket]
+	if !ok {
+		return nil, fmt.Errorf("unsupported trend bucket %q", filters.Bucket)
+	}
+	query := `
+		SELECT date_trunc($1, created_at AT TIME ZONE 'UTC') AS bucket,
+			COUNT(*),
+			AVG(final_quality_score),
+			AVG(CASE WHEN validation_passed THEN 1.0 ELSE 0.0 END),
+			AVG(CASE WHEN regeneration_triggered THEN 1.0 ELSE 0.0 END),
+			AVG(total_pipeline_time_ms)
+		FROM question_generation_logs
+		WHERE created_at >= $2 AND created_at < $3 AND status <> 'PENDING'
+		GROUP BY bucket
+		ORDER BY bucket`
+
+	rows, err := c.db.QueryContext(ctx, query, filters.Bucket, filters.Since, filters.Until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quality trends: %w", err)
+	}
+	defer rows.Close()
+
+	logged := make(map[time.Time]QualityTrendBucket)
+	for rows.Next() {
+		var bucket QualityTrendBucket
+		var quality, passRate, regenerationRate, latency sql.NullFloat64
+		if err := rows.Scan(&bucket.Start, &bucket.Generations, &quality, &passRate, &regenerationRate, &latency); err != nil {
+			return nil, fmt.Errorf("failed to scan quality trend row: %w", err)
+		}
+		bucket.Start = bucket.Start.UTC()
+		bucket.AvgQualityScore = nullableFloat(quality)
+		bucket.ValidationPassRate = nullableFloat(passRate)
+		bucket.RegenerationRate = nullableFloat(regenerationRate)
+		bucket.AvgLatencyMs = nullableFloat(latency)
+		logged[bucket.Start] = bucket
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating quality trend rows: %w", err)
+	}
+
+	// Fill in the buckets without generations
+	var trends []QualityTrendBucket
+	for start := filters.Since.UTC().Truncate(width); start.Before(filters.Until); start = start.Add(width) {
+		bucket, ok := logged[start]
+		if !ok {
+			bucket = QualityTrendBucket{Start: start}
+		}
+		trends = append(trends, bucket)
+	}
+	return trends, nil
+}
+
+func nullableFloat(f sql.NullFloat64) *float64 {
+	if !f.Valid {
+		return nil
+	}
+	return &f.Float64
+}
+
+// scanGenerationLog reads one row of generationLogColumns, followed by
+// generationLogDetailColumns when verbose
+func scanGenerationLog(row interface{ Scan(...interface{}) error }, verbose bool) (*GenerationLog, error) {
+	var log GenerationLog
+	var questionID, sessionID, requestID, templateID, errorMessage sql.NullString
+	var questionText, correctAnswer sql.NullString
+
+	dest := []interface{}{
+		&log.ID, &questionID, &log.StudentID, &sessionID, &requestID, &log.TopicID, &log.ExamType,
+		&log.Subject, &log.Format, &log.RequestedDifficulty, &log.CalibratedDifficulty, &templateID,
+		&log.RAGAlignmentScore, &log.FinalQualityScore, &log.TotalPipelineTimeMs,
+		&log.Status, &errorMessage, &log.RetryCount, &log.CreatedAt,
+	}
+	if verbose {
+		dest = append(dest, &questionText, &log.GeneratedOptions, &correctAnswer)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	// Handle nullable fields
+	log.QuestionID = questionID.String
+	log.SessionID = sessionID.String
+	log.RequestID = requestID.String
+	log.ErrorMessage = errorMessage.String
+	log.GeneratedQuestionText = questionText.String
+	log.CorrectAnswer = correctAnswer.String
+	if templateID.Valid {
+		log.TemplateID = &templateID.String
+	}
+	return &log, nil
+}
+
+// encodeLogCursor renders the position after a log as an opaque cursor
+func encodeLogCursor(createdAt time.Time, id int64) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeLogCursor reverses encodeLogCursor
+func decodeLogCursor(cursor string) (time.Time, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+	}
+	return t, n, nil
+}
+
+// IncrementTemplateUsage atomically increments usage count for a template.
+// The template cache is left alone: every served question counts a use, so
+// invalidating here would empty the cache as fast as it fills. Cached usage
+// counts, and the selection order they drive, lag by at most the cache TTL.
 func (c *Client) IncrementTemplateUsage(ctx context.Context, templateID string) error {
 	query := `
 		UPDATE question_templates 
@@ -380,10 +1135,99 @@ func (c *Client) IncrementTemplateUsage(ctx context.Context, templateID string)
 	return nil
 }
 
-// Helper function to parse float64 from string
-func parseFloat64(s string) (float64, error) {
-	if s == "" {
-		return 0, fmt.Errorf("empty string")
+// SaveAnswerSubmission stores a graded answer, writing its ID and
+// submission time back to a
+func (c *Client) SaveAnswerSubmission(ctx context.Context, a *AnswerSubmission) error {
+	query := `
+		INSERT INTO answer_submissions (
+			question_id, template_id, student_id, is_correct, partial_credit, response_time_ms
+		) VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, submitted_at`
+
+	err := c.db.QueryRowContext(ctx, query,
+		a.QuestionID, a.TemplateID, a.StudentID, a.IsCorrect, a.PartialCredit, a.ResponseTimeMs,
+	).Scan(&a.ID, &a.SubmittedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save answer submission: %w", err)
+	}
+	return nil
+}
+
+// recomputeTemplateStatsQuery derives success_rate and avg_solve_time from
+// answer submissions and stores them in one statement, clearing them for
+// templates without answers. %s narrows the templates recomputed. Rates
+// are rounded to the precision of the NUMERIC(4,3) column, and untimed
+// answers are left out of the average solve time.
+const recomputeTemplateStatsQuery = `
+		UPDATE question_templates qt
+		SET success_rate = stats.success_rate, avg_solve_time = stats.avg_solve_time
+		FROM (
+			SELECT t.template_id,
+				COUNT(a.template_id) AS answers,
+				ROUND(AVG(a.is_correct::int), 3) AS success_rate,
+				ROUND(AVG(a.response_time_ms) FILTER (WHERE a.response_time_ms > 0) / 1000)::BIGINT AS avg_solve_time
+			FROM question_templates t
+			LEFT JOIN answer_submissions a ON a.template_id = t.template_id
+			%s
+			GROUP BY t.template_id
+		) stats
+		WHERE qt.template_id = stats.template_id
+		RETURNING qt.template_id, stats.answers, stats.success_rate, stats.avg_solve_time`
+
+// RecomputeTemplateStats derives a template's success_rate and
+// avg_solve_time from its answer submissions and stores them, clearing
+// them when it has none. Inactive templates are updated too, since their
+// answers remain valid.
+func (c *Client) RecomputeTemplateStats(ctx context.Context, templateID string) (*TemplateStats, error) {
+	all, err := c.recomputeTemplateStats(ctx, "WHERE t.template_id = $1", templateID)
+	c.templates.invalidate(templateID)
+	if err != nil {
+		return nil, err
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, templateID)
+	}
+	return all[0], nil
+}
+
+// RecomputeAllTemplateStats runs RecomputeTemplateStats for every
+// template, active or not, in a single statement, returning the stats in
+// template ID order
+func (c *Client) RecomputeAllTemplateStats(ctx context.Context) ([]*TemplateStats, error) {
+	return c.recomputeTemplateStats(ctx, "")
+}
+
+// recomputeTemplateStats runs recomputeTemplateStatsQuery narrowed by
+// filter, invalidating the cached copies of the templates it updates
+func (c *Client) recomputeTemplateStats(ctx context.Context, filter string, args ...interface{}) ([]*TemplateStats, error) {
+	rows, err := c.db.QueryContext(ctx, fmt.Sprintf(recomputeTemplateStatsQuery, filter), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update template stats: %w", err)
 	}
-	return sql.NullFloat64{}.Scan(s)
-}
\ No newline at end of file
+	defer rows.Close()
+
+	var all []*TemplateStats
+	for rows.Next() {
+		var stats TemplateStats
+		var successRate sql.NullFloat64
+		var avgSolveTime sql.NullInt64
+		if err := rows.Scan(&stats.TemplateID, &stats.Answers, &successRate, &avgSolveTime); err != nil {
+			return nil, fmt.Errorf("failed to scan template stats: %w", err)
+		}
+		c.templates.invalidate(stats.TemplateID)
+		if successRate.Valid {
+			stats.SuccessRate = &successRate.Float64
+		}
+		if avgSolveTime.Valid {
+			stats.AvgSolveTime = &avgSolveTime.Int64
+		}
+		all = append(all, &stats)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating template stats: %w", err)
+	}
+
+	// RETURNING follows no order
+	sort.Slice(all, func(i, j int) bool { return all[i].TemplateID < all[j].TemplateID })
+	return all, nil
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/file"
+)
+
+// ErrDirtyMigration is returned when a previous migration failed part way.
+// The schema must be repaired by hand and the version forced before any
+// further migration runs.
+var ErrDirtyMigration = errors.New("database is in a dirty migration state")
+
+// MigrationStatus describes the schema version and what Up would apply
+type MigrationStatus struct {
+	Version uint   // Last applied migration, 0 when none has been applied
+	Pending []uint // Versions not yet applied, in the order they would run
+}
+
+// Migrator applies the migrations of a directory to a database
+type Migrator struct {
+	m      *migrate.Migrate
+	source source.Driver
+}
+
+// NewMigrator reads migrations from dir and applies them through driver
+func NewMigrator(dir string, driver database.Driver) (*Migrator, error) {
+	src, err := (&file.File{}).Open(fmt.Sprintf("file://%s", filepath.ToSlash(dir)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open migrations: %w", err)
+	}
+	m, err := migrate.NewWithInstance("file", src, "database", driver)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("failed to create migrator: %w", err)
+	}
+	return &Migrator{m: m, source: src}, nil
+}
+
+// Close releases the migration source and closes the database driver
+func (mg *Migrator) Close() error {
+	srcErr, dbErr := mg.m.Close()
+	if srcErr != nil {
+		return srcErr
+	}
+	return dbErr
+}
+
+// Version returns the last applied migration, 0 when none has been applied.
+// It returns ErrDirtyMigration when that migration failed part way.
+func (mg *Migrator) Version() (uint, error) {
+	version, dirty, err := mg.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migration version: %w", err)
+	}
+	if dirty {
+		return version, fmt.Errorf("%w at version %d: repair the schema and force the version", ErrDirtyMigration, version)
+	}
+	return version, nil
+}
+
+// Up applies every pending migration and returns the resulting version
+func (mg *Migrator) Up() (uint, error) {
+	if _, err := mg.Version(); err != nil {
+		return 0, err
+	}
+	if err := mg.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return 0, fmt.Errorf("failed to apply migrations: %w", err)
+	}
+	return mg.Version()
+}
+
+// MigrateTo migrates up or down to version, which must exist
+func (mg *Migrator) MigrateTo(version uint) error {
+	if _, err := mg.Version(); err != nil {
+		return err
+	}
+	if err := mg.m.Migrate(version); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to migrate to version %d: %w", version, err)
+	}
+	_, err := mg.Version()
+	return err
+}
+
+// DryRun reports the current version and the migrations Up would apply,
+// without applying them
+func (mg *Migrator) DryRun() (MigrationStatus, error) {
+	current, err := mg.Version()
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	status := MigrationStatus{Version: current}
+
+	next, err := mg.source.First()
+	if current > 0 {
+		next, err = mg.source.Next(current)
+	}
+	for err == nil {
+		status.Pending = append(status.Pending, next)
+		next, err = mg.source.Next(next)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return MigrationStatus{}, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	return status, nil
+}
+
+// migrator opens a Migrator over one connection of the client's pool with
+// the configured migrations directory. Closing it returns the connection.
+func (c *Client) migrator() (*Migrator, error) {
+	ctx := context.Background()
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migration connection: %w", err)
+	}
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create migration driver: %w", err)
+	}
+	mg, err := NewMigrator(c.cfg.MigrationsPath, driver)
+	if err != nil {
+		driver.Close()
+		return nil, err
+	}
+	return mg, nil
+}
+
+// RunMigrations applies every pending database migration
+func (c *Client) RunMigrations() error {
+	mg, err := c.migrator()
+	if err != nil {
+		return err
+	}
+	defer mg.Close()
+	version, err := mg.Up()
+	if err != nil {
+		return err
+	}
+	log.Printf("Database at migration version %d", version)
+	return nil
+}
+
+// MigrateTo migrates the database up or down to version
+func (c *Client) MigrateTo(version uint) error {
+	mg, err := c.migrator()
+	if err != nil {
+		return err
+	}
+	defer mg.Close()
+	if err := mg.MigrateTo(version); err != nil {
+		return err
+	}
+	log.Printf("Database at migration version %d", version)
+	return nil
+}
+
+// MigrateDryRun reports the pending migrations without applying them
+func (c *Client) MigrateDryRun() (MigrationStatus, error) {
+	mg, err := c.migrator()
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	defer mg.Close()
+	return mg.DryRun()
+}
+
+// MigrationVersion returns the last applied migration, 0 when none has been
+// applied, or ErrDirtyMigration when it failed part way
+func (c *Client) MigrationVersion() (uint, error) {
+	mg, err := c.migrator()
+	if err != nil {
+		return 0, err
+	}
+	defer mg.Close()
+	return mg.Version()
+}
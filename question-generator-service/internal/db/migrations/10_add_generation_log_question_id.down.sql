@@ -0,0 +1,7 @@
+-- 10_add_generation_log_question_id.down.sql
+-- Reverts 10_add_generation_log_question_id.up.sql
+
+DROP INDEX IF EXISTS idx_generation_logs_question_id;
+
+ALTER TABLE question_generation_logs
+    DROP COLUMN IF EXISTS question_id;
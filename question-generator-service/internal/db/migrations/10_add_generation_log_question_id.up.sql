@@ -0,0 +1,11 @@
+-- 10_add_generation_log_question_id.up.sql
+-- Phase 2.2 Migration: Link each generation log to the question_id returned to the client
+
+ALTER TABLE question_generation_logs
+    ADD COLUMN IF NOT EXISTS question_id TEXT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_generation_logs_question_id
+    ON question_generation_logs(question_id) WHERE question_id IS NOT NULL;
+
+COMMENT ON COLUMN question_generation_logs.question_id IS
+    'question_id returned to the client, for tracing a reported question back to its generation';
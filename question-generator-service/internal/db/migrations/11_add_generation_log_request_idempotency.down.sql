@@ -0,0 +1,8 @@
+-- 11_add_generation_log_request_idempotency.down.sql
+-- Reverts 11_add_generation_log_request_idempotency.up.sql
+
+DROP INDEX IF EXISTS idx_generation_logs_completed_request_id;
+
+-- Fails while logs hold client request IDs that are not UUIDs
+ALTER TABLE question_generation_logs
+    ALTER COLUMN request_id TYPE UUID USING request_id::uuid;
@@ -0,0 +1,12 @@
+-- 11_add_generation_log_request_idempotency.up.sql
+-- Phase 2.2 Migration: Enforce one completed generation per request_id so retried requests are replayed
+
+-- Clients send their own request IDs, which need not be UUIDs
+ALTER TABLE question_generation_logs
+    ALTER COLUMN request_id TYPE TEXT USING request_id::text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_generation_logs_completed_request_id
+    ON question_generation_logs(request_id) WHERE status = 'COMPLETED';
+
+COMMENT ON INDEX idx_generation_logs_completed_request_id IS
+    'At most one completed generation per request_id; failed attempts may be retried under the same ID';
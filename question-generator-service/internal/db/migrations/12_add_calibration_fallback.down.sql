@@ -0,0 +1,5 @@
+-- 12_add_calibration_fallback.down.sql
+-- Reverts 12_add_calibration_fallback.up.sql
+
+ALTER TABLE question_generation_logs
+    DROP COLUMN IF EXISTS calibration_fallback;
@@ -0,0 +1,9 @@
+-- 12_add_calibration_fallback.up.sql
+-- Phase 2.2 Migration: Record which fallback strategy calibrated a question when BKT was unavailable
+
+ALTER TABLE question_generation_logs
+    ADD COLUMN IF NOT EXISTS calibration_fallback TEXT NULL
+        CHECK (calibration_fallback IN ('AVERAGE', 'ZPD', 'REQUESTED'));
+
+COMMENT ON COLUMN question_generation_logs.calibration_fallback IS
+    'BKT_FALLBACK_STRATEGY applied when BKT could not calibrate; NULL when BKT calibrated';
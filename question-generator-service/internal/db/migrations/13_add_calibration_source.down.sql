@@ -0,0 +1,7 @@
+-- 13_add_calibration_source.down.sql
+-- Reverts 13_add_calibration_source.up.sql
+
+DROP INDEX IF EXISTS idx_generation_logs_calibration_source;
+
+ALTER TABLE question_generation_logs
+    DROP COLUMN IF EXISTS calibration_source;
@@ -0,0 +1,12 @@
+-- 13_add_calibration_source.up.sql
+-- Phase 2.2 Migration: Tag each generation with whether BKT or the rule-based fallback calibrated it
+
+ALTER TABLE question_generation_logs
+    ADD COLUMN IF NOT EXISTS calibration_source TEXT NULL
+        CHECK (calibration_source IN ('BKT', 'FALLBACK'));
+
+CREATE INDEX IF NOT EXISTS idx_generation_logs_calibration_source
+    ON question_generation_logs(calibration_source, created_at);
+
+COMMENT ON COLUMN question_generation_logs.calibration_source IS
+    'BKT when the BKT service calibrated the difficulty, FALLBACK when the rule-based path did';
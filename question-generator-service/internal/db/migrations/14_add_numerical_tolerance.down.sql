@@ -0,0 +1,5 @@
+-- 14_add_numerical_tolerance.down.sql
+-- Reverts 14_add_numerical_tolerance.up.sql
+
+ALTER TABLE question_templates
+    DROP COLUMN IF EXISTS numerical_tolerance;
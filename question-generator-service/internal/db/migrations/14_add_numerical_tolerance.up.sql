@@ -0,0 +1,8 @@
+-- 14_add_numerical_tolerance.up.sql
+-- Phase 2.2 Migration: Let templates set how closely NUMERICAL answers must match for full and partial credit
+
+ALTER TABLE question_templates
+    ADD COLUMN IF NOT EXISTS numerical_tolerance JSONB NULL;
+
+COMMENT ON COLUMN question_templates.numerical_tolerance IS
+    'Full-credit band of NUMERICAL answers as {"absolute": x, "relative": y}, the looser applying; NULL uses 1% relative';
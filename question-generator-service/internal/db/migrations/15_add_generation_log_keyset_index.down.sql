@@ -0,0 +1,4 @@
+-- 15_add_generation_log_keyset_index.down.sql
+-- Reverts 15_add_generation_log_keyset_index.up.sql
+
+DROP INDEX IF EXISTS idx_generation_logs_created_id;
@@ -0,0 +1,5 @@
+-- 15_add_generation_log_keyset_index.up.sql
+-- Phase 2.2 Migration: Page through generation logs newest first for the /v1/logs query API
+
+CREATE INDEX IF NOT EXISTS idx_generation_logs_created_id
+    ON question_generation_logs(created_at DESC, id DESC);
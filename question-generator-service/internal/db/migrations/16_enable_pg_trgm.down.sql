@@ -0,0 +1,4 @@
+-- 16_enable_pg_trgm.down.sql
+-- Reverts 16_enable_pg_trgm.up.sql
+
+DROP EXTENSION IF EXISTS pg_trgm;
@@ -0,0 +1,7 @@
+-- 16_enable_pg_trgm.up.sql
+-- Phase 2.2 Migration: Trigram similarity for finding near-duplicates of a new question among those served to the same student
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- No trigram index: similarity() is only computed for one student's recent
+-- questions, which idx_generated_questions_student already narrows down to
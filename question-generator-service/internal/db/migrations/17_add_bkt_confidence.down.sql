@@ -0,0 +1,6 @@
+-- 17_add_bkt_confidence.down.sql
+-- Reverts 17_add_bkt_confidence.up.sql
+
+ALTER TABLE question_generation_logs
+    DROP COLUMN IF EXISTS bkt_confidence,
+    DROP COLUMN IF EXISTS bkt_recommendation;
@@ -0,0 +1,12 @@
+-- 17_add_bkt_confidence.up.sql
+-- Phase 2.2 Migration: Keep BKT's confidence and recommendation alongside the difficulty it calibrated
+
+ALTER TABLE question_generation_logs
+    ADD COLUMN IF NOT EXISTS bkt_confidence NUMERIC(4,3) NULL
+        CHECK (bkt_confidence BETWEEN 0.0 AND 1.0),
+    ADD COLUMN IF NOT EXISTS bkt_recommendation TEXT NULL;
+
+COMMENT ON COLUMN question_generation_logs.bkt_confidence IS
+    'Confidence BKT reported for its calibration; NULL when the rule-based fallback calibrated';
+COMMENT ON COLUMN question_generation_logs.bkt_recommendation IS
+    'Advice BKT returned for the student, e.g. review prerequisite';
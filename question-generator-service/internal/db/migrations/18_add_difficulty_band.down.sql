@@ -0,0 +1,5 @@
+-- 18_add_difficulty_band.down.sql
+-- Reverts 18_add_difficulty_band.up.sql
+
+ALTER TABLE question_generation_logs
+    DROP COLUMN IF EXISTS difficulty_band;
@@ -0,0 +1,9 @@
+-- 18_add_difficulty_band.up.sql
+-- Phase 2.2 Migration: Record how far the difficulty band was widened to find a template
+
+ALTER TABLE question_generation_logs
+    ADD COLUMN IF NOT EXISTS difficulty_band NUMERIC(3,2) NULL
+        CHECK (difficulty_band BETWEEN 0.0 AND 1.0);
+
+COMMENT ON COLUMN question_generation_logs.difficulty_band IS
+    'Half-width of the band around the requested difficulty templates were searched in; above 0.1 when it was widened';
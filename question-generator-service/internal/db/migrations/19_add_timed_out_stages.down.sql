@@ -0,0 +1,5 @@
+-- 19_add_timed_out_stages.down.sql
+-- Reverts 19_add_timed_out_stages.up.sql
+
+ALTER TABLE question_generation_logs
+    DROP COLUMN IF EXISTS timed_out_stages;
@@ -0,0 +1,8 @@
+-- 19_add_timed_out_stages.up.sql
+-- Phase 2.2 Migration: Record which pipeline stages ran out of their own timeout
+
+ALTER TABLE question_generation_logs
+    ADD COLUMN IF NOT EXISTS timed_out_stages TEXT[] NULL;
+
+COMMENT ON COLUMN question_generation_logs.timed_out_stages IS
+    'Pipeline stages (template, calibration, generation, validation, rag) that hit their stage timeout';
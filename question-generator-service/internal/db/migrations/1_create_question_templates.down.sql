@@ -0,0 +1,5 @@
+-- 1_create_question_templates.down.sql
+-- Reverts 1_create_question_templates.up.sql
+
+DROP TABLE IF EXISTS question_templates CASCADE;
+DROP FUNCTION IF EXISTS update_modified_column();
@@ -1,4 +1,4 @@
--- V1__create_question_templates.sql
+-- 1_create_question_templates.up.sql
 -- Phase 2.1 Migration: Create question templates table for JEE/NEET
 
 CREATE TABLE IF NOT EXISTS question_templates (
@@ -0,0 +1,4 @@
+-- 20_create_answer_submissions.down.sql
+-- Reverts 20_create_answer_submissions.up.sql
+
+DROP TABLE IF EXISTS answer_submissions;
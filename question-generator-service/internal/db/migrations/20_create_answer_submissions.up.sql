@@ -0,0 +1,20 @@
+-- 20_create_answer_submissions.up.sql
+-- Phase 2.2 Migration: Keep graded answers so template success rates and solve times can be derived from them
+
+CREATE TABLE IF NOT EXISTS answer_submissions (
+    id BIGSERIAL PRIMARY KEY,
+    question_id TEXT NOT NULL REFERENCES generated_questions(question_id),
+    template_id UUID NOT NULL REFERENCES question_templates(template_id),
+    student_id TEXT NOT NULL,
+    is_correct BOOLEAN NOT NULL,
+    partial_credit DOUBLE PRECISION NOT NULL DEFAULT 0,
+    response_time_ms BIGINT NOT NULL DEFAULT 0,
+    submitted_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX idx_answer_submissions_template ON answer_submissions(template_id);
+
+COMMENT ON TABLE answer_submissions IS
+    'Graded student answers to generated questions, the source of question_templates.success_rate and avg_solve_time';
+COMMENT ON COLUMN answer_submissions.response_time_ms IS
+    'Time the student took to answer as reported by the client, 0 when unknown';
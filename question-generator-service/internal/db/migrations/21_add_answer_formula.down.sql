@@ -0,0 +1,5 @@
+-- 21_add_answer_formula.down.sql
+-- Reverts 21_add_answer_formula.up.sql
+
+ALTER TABLE question_templates
+    DROP COLUMN IF EXISTS answer_formula;
@@ -0,0 +1,8 @@
+-- 21_add_answer_formula.up.sql
+-- Phase 2.2 Migration: Let NUMERICAL templates state how their answer is computed
+
+ALTER TABLE question_templates
+    ADD COLUMN IF NOT EXISTS answer_formula TEXT NULL;
+
+COMMENT ON COLUMN question_templates.answer_formula IS
+    'Arithmetic over {{variable}} placeholders giving the correct answer in answer_unit, e.g. {{v0}} + {{a}} * {{t}}; NULL falls back to the subject calculation';
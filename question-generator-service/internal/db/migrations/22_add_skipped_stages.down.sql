@@ -0,0 +1,5 @@
+-- 22_add_skipped_stages.down.sql
+-- Reverts 22_add_skipped_stages.up.sql
+
+ALTER TABLE question_generation_logs
+    DROP COLUMN IF EXISTS skipped_stages;
@@ -0,0 +1,8 @@
+-- 22_add_skipped_stages.up.sql
+-- Phase 2.2 Migration: Record which optional stages were skipped to stay within the latency budget
+
+ALTER TABLE question_generation_logs
+    ADD COLUMN IF NOT EXISTS skipped_stages TEXT[] NULL;
+
+COMMENT ON COLUMN question_generation_logs.skipped_stages IS
+    'Optional stages (rag, regeneration) skipped when MAX_GENERATION_LATENCY ran out';
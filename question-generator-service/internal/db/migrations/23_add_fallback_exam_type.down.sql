@@ -0,0 +1,5 @@
+-- 23_add_fallback_exam_type.down.sql
+-- Reverts 23_add_fallback_exam_type.up.sql
+
+ALTER TABLE question_generation_logs
+    DROP COLUMN IF EXISTS fallback_exam_type;
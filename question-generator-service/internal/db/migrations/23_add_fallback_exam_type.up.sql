@@ -0,0 +1,8 @@
+-- 23_add_fallback_exam_type.up.sql
+-- Phase 2.2 Migration: Record when another exam type's template stood in for the requested one
+
+ALTER TABLE question_generation_logs
+    ADD COLUMN IF NOT EXISTS fallback_exam_type VARCHAR(20) NULL;
+
+COMMENT ON COLUMN question_generation_logs.fallback_exam_type IS
+    'Exam type of the served template when TEMPLATE_EXAM_TYPE_FALLBACKS substituted it for the requested exam type';
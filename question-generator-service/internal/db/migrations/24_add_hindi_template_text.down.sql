@@ -0,0 +1,6 @@
+-- 24_add_hindi_template_text.down.sql
+-- Reverts 24_add_hindi_template_text.up.sql
+
+ALTER TABLE question_templates
+    DROP COLUMN IF EXISTS template_text_hi,
+    DROP COLUMN IF EXISTS options_template_hi;
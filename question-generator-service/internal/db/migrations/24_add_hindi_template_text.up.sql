@@ -0,0 +1,11 @@
+-- 24_add_hindi_template_text.up.sql
+-- Phase 2.2 Migration: Let templates carry a Hindi translation for bilingual papers
+
+ALTER TABLE question_templates
+    ADD COLUMN IF NOT EXISTS template_text_hi TEXT NULL,
+    ADD COLUMN IF NOT EXISTS options_template_hi JSONB NULL;
+
+COMMENT ON COLUMN question_templates.template_text_hi IS
+    'Hindi translation of template_text over the same {{variable}} placeholders; NULL when the template is English only';
+COMMENT ON COLUMN question_templates.options_template_hi IS
+    'Hindi translation of options_template, MCQ only, with the same option keys and placeholders';
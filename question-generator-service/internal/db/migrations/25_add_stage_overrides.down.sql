@@ -0,0 +1,5 @@
+-- 25_add_stage_overrides.down.sql
+-- Reverts 25_add_stage_overrides.up.sql
+
+ALTER TABLE question_generation_logs
+    DROP COLUMN IF EXISTS stage_overrides;
@@ -0,0 +1,8 @@
+-- 25_add_stage_overrides.up.sql
+-- Phase 2.2 Migration: Record which stages an experiment request switched off
+
+ALTER TABLE question_generation_logs
+    ADD COLUMN IF NOT EXISTS stage_overrides TEXT[] NULL;
+
+COMMENT ON COLUMN question_generation_logs.stage_overrides IS
+    'Stages (rag, validation) the request skipped through skip_rag or skip_validation, set by callers with the experiment scope';
@@ -0,0 +1,5 @@
+-- 26_add_answer_precision.down.sql
+-- Reverts 26_add_answer_precision.up.sql
+
+ALTER TABLE question_templates
+    DROP COLUMN IF EXISTS answer_precision;
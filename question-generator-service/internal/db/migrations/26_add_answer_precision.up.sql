@@ -0,0 +1,9 @@
+-- 26_add_answer_precision.up.sql
+-- Phase 2.2 Migration: Let templates set the decimal places their answers and options are quoted to
+
+ALTER TABLE question_templates
+    ADD COLUMN IF NOT EXISTS answer_precision SMALLINT NULL
+        CHECK (answer_precision BETWEEN 0 AND 6);
+
+COMMENT ON COLUMN question_templates.answer_precision IS
+    'Decimal places numeric answers and options are written with, trailing zeros kept; NULL rounds to two places and drops trailing zeros';
@@ -0,0 +1,4 @@
+-- 27_create_flagged_questions.down.sql
+-- Reverts 27_create_flagged_questions.up.sql
+
+DROP TABLE IF EXISTS flagged_questions;
@@ -0,0 +1,26 @@
+-- 27_create_flagged_questions.up.sql
+-- Phase 2.2 Migration: Queue served questions of doubtful quality for human review
+
+CREATE TABLE IF NOT EXISTS flagged_questions (
+    id BIGSERIAL PRIMARY KEY,
+    question_id TEXT NOT NULL REFERENCES generated_questions(question_id),
+    template_id UUID NOT NULL REFERENCES question_templates(template_id),
+    reason TEXT NOT NULL CHECK (reason IN ('LOW_RAG_ALIGNMENT', 'VALIDATION_FAILED', 'VALIDATION_UNAVAILABLE')),
+    score DOUBLE PRECISION NULL,
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'ACCEPTED', 'REJECTED')),
+    reviewer TEXT NULL,
+    review_note TEXT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX idx_flagged_questions_status ON flagged_questions(status, created_at DESC);
+CREATE INDEX idx_flagged_questions_template ON flagged_questions(template_id);
+
+COMMENT ON TABLE flagged_questions IS
+    'Served questions queued for human review because RAG could not align them or validation failed';
+COMMENT ON COLUMN flagged_questions.score IS
+    'RAG alignment score or validation overall score behind the flag, NULL when the validator was unavailable';
+COMMENT ON COLUMN flagged_questions.status IS
+    'PENDING until a reviewer accepts the question or rejects it, which deactivates its template';
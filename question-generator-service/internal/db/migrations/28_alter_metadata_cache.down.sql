@@ -0,0 +1,23 @@
+-- 28_alter_metadata_cache.down.sql
+-- Reverts 28_alter_metadata_cache.up.sql
+
+DROP VIEW IF EXISTS generation_stats_daily;
+DROP VIEW IF EXISTS question_quality_monitor;
+DROP TRIGGER IF EXISTS trigger_auto_quality_assurance ON question_metadata_cache;
+DROP FUNCTION IF EXISTS auto_quality_assurance();
+DROP FUNCTION IF EXISTS update_question_quality_flags(TEXT, BOOLEAN, BOOLEAN);
+
+DROP INDEX IF EXISTS idx_question_metadata_cache_calibration;
+DROP INDEX IF EXISTS idx_question_metadata_cache_template;
+DROP INDEX IF EXISTS idx_question_metadata_cache_generation;
+
+ALTER TABLE question_metadata_cache
+    DROP CONSTRAINT IF EXISTS chk_ai_generated_has_template,
+    DROP COLUMN IF EXISTS calibration_params,
+    DROP COLUMN IF EXISTS template_version,
+    DROP COLUMN IF EXISTS rag_verified,
+    DROP COLUMN IF EXISTS quality_assured,
+    DROP COLUMN IF EXISTS generation_method,
+    DROP COLUMN IF EXISTS ai_generated,
+    DROP COLUMN IF EXISTS generation_log_id,
+    DROP COLUMN IF EXISTS template_id;
@@ -1,5 +1,7 @@
--- V3__alter_metadata_cache.sql
+-- 28_alter_metadata_cache.up.sql
 -- Phase 2.1 Migration: Extend question_metadata_cache for generation pipeline
+-- Shared a V3 with 3_create_student_profiles_bkt until migrations got unique
+-- versions; nothing depends on it, so it now runs last
 
 -- Add generation-specific columns to existing metadata cache
 ALTER TABLE question_metadata_cache 
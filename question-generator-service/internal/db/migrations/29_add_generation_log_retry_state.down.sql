@@ -0,0 +1,17 @@
+-- 29_add_generation_log_retry_state.down.sql
+-- Reverts 29_add_generation_log_retry_state.up.sql; pending retries are given up
+
+UPDATE question_generation_logs SET status = 'FAILED' WHERE status = 'RETRY_PENDING';
+
+DROP INDEX IF EXISTS idx_generation_logs_retry_pending;
+
+ALTER TABLE question_generation_logs
+    DROP COLUMN IF EXISTS retry_request,
+    DROP COLUMN IF EXISTS next_attempt_at;
+
+ALTER TABLE question_generation_logs
+    DROP CONSTRAINT IF EXISTS question_generation_logs_status_check;
+
+ALTER TABLE question_generation_logs
+    ADD CONSTRAINT question_generation_logs_status_check
+        CHECK (status IN ('PENDING', 'GENERATED', 'VALIDATED', 'RAG_CHECKED', 'COMPLETED', 'FAILED', 'REGENERATED'));
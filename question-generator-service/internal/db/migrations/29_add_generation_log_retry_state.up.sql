@@ -0,0 +1,21 @@
+-- 29_add_generation_log_retry_state.up.sql
+-- Phase 2.2 Migration: Persist background retries of transiently failed generations so they survive restarts
+
+ALTER TABLE question_generation_logs
+    DROP CONSTRAINT IF EXISTS question_generation_logs_status_check;
+
+ALTER TABLE question_generation_logs
+    ADD CONSTRAINT question_generation_logs_status_check
+        CHECK (status IN ('PENDING', 'GENERATED', 'VALIDATED', 'RAG_CHECKED', 'COMPLETED', 'FAILED', 'REGENERATED', 'RETRY_PENDING'));
+
+ALTER TABLE question_generation_logs
+    ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ NULL,
+    ADD COLUMN IF NOT EXISTS retry_request JSONB NULL;
+
+CREATE INDEX IF NOT EXISTS idx_generation_logs_retry_pending
+    ON question_generation_logs(request_id) WHERE status = 'RETRY_PENDING';
+
+COMMENT ON COLUMN question_generation_logs.next_attempt_at IS
+    'When a RETRY_PENDING generation is next retried, or until when the retry running it holds it';
+COMMENT ON COLUMN question_generation_logs.retry_request IS
+    'The request and seed a RETRY_PENDING generation is retried with';
@@ -0,0 +1,6 @@
+-- 2_create_generation_logs.down.sql
+-- Reverts 2_create_generation_logs.up.sql
+
+DROP FUNCTION IF EXISTS refresh_generation_analytics();
+DROP MATERIALIZED VIEW IF EXISTS generation_performance_summary;
+DROP TABLE IF EXISTS question_generation_logs CASCADE;
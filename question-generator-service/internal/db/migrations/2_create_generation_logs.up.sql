@@ -1,4 +1,4 @@
--- V2__create_generation_logs.sql
+-- 2_create_generation_logs.up.sql
 -- Phase 2.1 Migration: Create question generation tracking and audit logs
 
 CREATE TABLE IF NOT EXISTS question_generation_logs (
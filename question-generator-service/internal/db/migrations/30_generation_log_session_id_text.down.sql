@@ -0,0 +1,9 @@
+-- 30_generation_log_session_id_text.down.sql
+-- Reverts 30_generation_log_session_id_text.up.sql
+
+-- Fails while logs hold client session IDs that are not UUIDs
+ALTER TABLE question_generation_logs
+    ALTER COLUMN session_id TYPE UUID USING session_id::uuid;
+
+ALTER TABLE question_generation_logs
+    ALTER COLUMN session_id SET DEFAULT gen_random_uuid();
@@ -0,0 +1,11 @@
+-- 30_generation_log_session_id_text.up.sql
+-- Phase 2.2 Migration: Store client session IDs, which need not be UUIDs, as text
+
+ALTER TABLE question_generation_logs
+    ALTER COLUMN session_id DROP DEFAULT;
+
+ALTER TABLE question_generation_logs
+    ALTER COLUMN session_id TYPE TEXT USING session_id::text;
+
+COMMENT ON COLUMN question_generation_logs.session_id IS
+    'The client''s session ID as sent, NULL when the request carried none';
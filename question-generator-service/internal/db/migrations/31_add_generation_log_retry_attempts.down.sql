@@ -0,0 +1,5 @@
+-- 31_add_generation_log_retry_attempts.down.sql
+-- Reverts 31_add_generation_log_retry_attempts.up.sql
+
+ALTER TABLE question_generation_logs
+    DROP COLUMN IF EXISTS retry_attempts;
@@ -0,0 +1,8 @@
+-- 31_add_generation_log_retry_attempts.up.sql
+-- Phase 2.2 Migration: Count background retries apart from retry_count, which also counts RAG regenerations
+
+ALTER TABLE question_generation_logs
+    ADD COLUMN IF NOT EXISTS retry_attempts INTEGER NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN question_generation_logs.retry_attempts IS
+    'Background retries a RETRY_PENDING generation has run, restored with it after a restart';
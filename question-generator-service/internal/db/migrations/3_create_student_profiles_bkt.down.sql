@@ -0,0 +1,10 @@
+-- 3_create_student_profiles_bkt.down.sql
+-- Reverts 3_create_student_profiles_bkt.up.sql; update_modified_column is
+-- left to 1_create_question_templates.down.sql
+
+DROP FUNCTION IF EXISTS refresh_student_analytics();
+DROP MATERIALIZED VIEW IF EXISTS student_performance_summary;
+DROP TABLE IF EXISTS student_interactions CASCADE;
+DROP TABLE IF EXISTS student_concept_mastery CASCADE;
+DROP TABLE IF EXISTS student_profiles CASCADE;
+DROP FUNCTION IF EXISTS calculate_profile_completion();
@@ -1,4 +1,4 @@
--- V3__create_student_profiles_bkt.sql
+-- 3_create_student_profiles_bkt.up.sql
 -- Phase 2-3 Migration: Student profiles, BKT integration, and adaptive learning tables
 -- Aligns with comprehensive PDF roadmap requirements
 
@@ -0,0 +1,13 @@
+-- 4_create_rag_time_aware_system.down.sql
+-- Reverts 4_create_rag_time_aware_system.up.sql
+
+DROP FUNCTION IF EXISTS update_strategic_test_phase();
+DROP FUNCTION IF EXISTS determine_preparation_phase(INTEGER);
+DROP TABLE IF EXISTS concept_relationships CASCADE;
+DROP TABLE IF EXISTS time_based_performance CASCADE;
+DROP TABLE IF EXISTS chapter_coverage_tracking CASCADE;
+DROP TABLE IF EXISTS strategic_test_plans CASCADE;
+DROP TABLE IF EXISTS exam_calendar CASCADE;
+DROP TABLE IF EXISTS exemplar_concept_mappings CASCADE;
+DROP TABLE IF EXISTS rag_quality_assessments CASCADE;
+DROP TABLE IF EXISTS rag_exemplar_questions CASCADE;
@@ -1,4 +1,4 @@
--- V4__create_rag_time_aware_system.sql  
+-- 4_create_rag_time_aware_system.up.sql
 -- Phase 2-3 Migration: RAG system integration and time-aware testing capabilities
 -- Aligns with PDF roadmap for advanced question quality and strategic test planning
 
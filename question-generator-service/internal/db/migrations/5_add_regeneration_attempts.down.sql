@@ -0,0 +1,5 @@
+-- 5_add_regeneration_attempts.down.sql
+-- Reverts 5_add_regeneration_attempts.up.sql
+
+ALTER TABLE question_generation_logs
+    DROP COLUMN IF EXISTS regeneration_attempts;
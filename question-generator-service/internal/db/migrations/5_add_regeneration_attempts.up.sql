@@ -0,0 +1,8 @@
+-- 5_add_regeneration_attempts.up.sql
+-- Phase 2.2 Migration: Track every RAG-driven regeneration attempt per generation
+
+ALTER TABLE question_generation_logs
+    ADD COLUMN IF NOT EXISTS regeneration_attempts JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+COMMENT ON COLUMN question_generation_logs.regeneration_attempts IS
+    'Array of {attempt, template_id, alignment_score, error} objects, one per RAG-scored generation attempt';
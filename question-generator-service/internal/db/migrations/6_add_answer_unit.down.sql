@@ -0,0 +1,5 @@
+-- 6_add_answer_unit.down.sql
+-- Reverts 6_add_answer_unit.up.sql
+
+ALTER TABLE question_templates
+    DROP COLUMN IF EXISTS answer_unit;
@@ -0,0 +1,8 @@
+-- 6_add_answer_unit.up.sql
+-- Phase 2.2 Migration: Declare the expected unit of NUMERICAL template answers
+
+ALTER TABLE question_templates
+    ADD COLUMN IF NOT EXISTS answer_unit TEXT NULL;
+
+COMMENT ON COLUMN question_templates.answer_unit IS
+    'Unit the correct answer must carry (e.g. m/s), NULL for unitless or non-numerical answers';
@@ -0,0 +1,5 @@
+-- 7_add_render_format.down.sql
+-- Reverts 7_add_render_format.up.sql
+
+ALTER TABLE question_templates
+    DROP COLUMN IF EXISTS render_format;
@@ -0,0 +1,9 @@
+-- 7_add_render_format.up.sql
+-- Phase 2.2 Migration: Tell clients how to render math in template text
+
+ALTER TABLE question_templates
+    ADD COLUMN IF NOT EXISTS render_format TEXT NOT NULL DEFAULT 'PLAIN'
+    CHECK (render_format IN ('PLAIN', 'LATEX', 'MATHML'));
+
+COMMENT ON COLUMN question_templates.render_format IS
+    'How math in template_text is marked up: PLAIN, LATEX ($...$ delimiters) or MATHML';
@@ -0,0 +1,4 @@
+-- 8_create_generated_questions.down.sql
+-- Reverts 8_create_generated_questions.up.sql
+
+DROP TABLE IF EXISTS generated_questions;
@@ -0,0 +1,28 @@
+-- 8_create_generated_questions.up.sql
+-- Phase 2.2 Migration: Persist served questions so they can be fetched again by question_id
+
+CREATE TABLE IF NOT EXISTS generated_questions (
+    question_id TEXT PRIMARY KEY,
+    template_id UUID NOT NULL REFERENCES question_templates(template_id),
+    student_id TEXT NOT NULL,
+    request_id TEXT,
+
+    -- Question as returned to the client
+    question_text TEXT NOT NULL,
+    options JSONB NULL, -- MCQ only
+    correct_answer TEXT NOT NULL,
+    solution_steps JSONB NULL,
+    render_format TEXT NOT NULL DEFAULT 'PLAIN' CHECK (render_format IN ('PLAIN', 'LATEX', 'MATHML')),
+
+    -- Generation inputs needed to reproduce the question
+    difficulty DOUBLE PRECISION NOT NULL,
+    seed BIGINT NOT NULL,
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX idx_generated_questions_student ON generated_questions(student_id, created_at DESC);
+CREATE INDEX idx_generated_questions_template ON generated_questions(template_id);
+
+COMMENT ON TABLE generated_questions IS
+    'Questions served by the generator, keyed by the question_id returned to clients';
@@ -0,0 +1,5 @@
+-- 9_add_rag_exemplars.down.sql
+-- Reverts 9_add_rag_exemplars.up.sql
+
+ALTER TABLE question_generation_logs
+    DROP COLUMN IF EXISTS rag_exemplars;
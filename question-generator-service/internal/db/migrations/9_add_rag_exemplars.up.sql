@@ -0,0 +1,8 @@
+-- 9_add_rag_exemplars.up.sql
+-- Phase 2.2 Migration: Keep the exemplar questions RAG compared each generation against
+
+ALTER TABLE question_generation_logs
+    ADD COLUMN IF NOT EXISTS rag_exemplars JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+COMMENT ON COLUMN question_generation_logs.rag_exemplars IS
+    'Array of {id, text, similarity} objects for the exemplars behind rag_alignment_score';
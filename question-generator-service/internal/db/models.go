@@ -0,0 +1,435 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// QuestionTemplate mirrors a row of the question_templates table
+type QuestionTemplate struct {
+	TemplateID         string
+	TopicID            string
+	ExamType           string
+	Subject            string
+	Format             string
+	TemplateText       string
+	TemplateTextHi     *string             // Hindi translation of TemplateText, nil when English only
+	VariableSlots      string              // JSON array of variable specifications
+	OptionsTemplate    *string             // JSON options template, MCQ only
+	OptionsTemplateHi  *string             // Hindi translation of OptionsTemplate, MCQ only
+	AnswerUnit         *string             // Expected unit of NUMERICAL answers
+	AnswerFormula      *string             // Formula over {{variables}} giving the answer in AnswerUnit, NUMERICAL only
+	NumericalTolerance *NumericalTolerance // Grading tolerance of NUMERICAL answers, nil for the default
+	AnswerPrecision    *int                // Decimal places of numeric answers and options, nil for the default
+	RenderFormat       string              // PLAIN, LATEX or MATHML
+	BaseDifficulty     float64
+	BloomLevel         int
+	ConceptDepth       int
+	ValidationScore    *float64
+	AmbiguityFlag      bool
+	ClarityScore       *float64
+	Chapter            string
+	SubChapter         *string
+	NCERTReference     *string
+	UsageCount         int
+	SuccessRate        *float64
+	AvgSolveTime       *int64 // seconds
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	IsActive           bool
+	Version            int
+}
+
+// TemplateFilters narrows GetTemplatesByFilters; zero values are ignored
+type TemplateFilters struct {
+	TopicID       string
+	ExamType      string
+	Subject       string
+	Format        string
+	MinDifficulty float64
+	MaxDifficulty float64
+	HasHindi      bool // Only templates with Hindi text (template_text_hi)
+	Limit         int
+}
+
+// TemplateSearch narrows SearchTemplates; zero values are ignored
+type TemplateSearch struct {
+	Subject       string
+	ExamType      string
+	TopicID       string
+	Chapter       string
+	BloomLevel    int
+	MinDifficulty float64
+	MaxDifficulty float64
+	Active        *bool  // Both active and inactive templates when nil
+	Text          string // Case-insensitive substring of template_text
+	NCERT         string // Case-insensitive substring of ncert_reference
+	Limit         int    // DefaultTemplateSearchLimit when zero, at most MaxTemplateSearchLimit
+	Cursor        string // NextCursor of the previous page
+}
+
+// TemplatePage is one page of SearchTemplates, ordered by template ID. Its
+// templates carry only the summary columns.
+type TemplatePage struct {
+	Templates  []*QuestionTemplate
+	NextCursor string // Empty on the last page
+}
+
+// TopicFilters narrows ListTopics; zero values are ignored
+type TopicFilters struct {
+	Subject  string
+	ExamType string
+}
+
+// TopicSummary describes the active templates of one topic
+type TopicSummary struct {
+	TopicID       string
+	Subject       string
+	TemplateCount int
+	MinDifficulty float64 // Lowest base difficulty among the topic's templates
+	MaxDifficulty float64 // Highest base difficulty among the topic's templates
+}
+
+// GenerationLogFilters narrows QueryGenerationLogs; zero values are ignored
+type GenerationLogFilters struct {
+	StudentID string
+	Status    string
+	Subject   string
+	ExamType  string
+	Since     time.Time // Logs created at or after Since
+	Until     time.Time // Logs created before Until
+	Verbose   bool      // Also read the generated question text, options and answer
+	Limit     int       // DefaultGenerationLogLimit when zero, at most MaxGenerationLogLimit
+	Cursor    string    // NextCursor of the previous page
+}
+
+// GenerationLogPage is one page of QueryGenerationLogs, newest first
+type GenerationLogPage struct {
+	Logs       []*GenerationLog
+	NextCursor string // Empty on the last page
+}
+
+// Bucket widths of GetQualityTrends, as understood by date_trunc
+const (
+	TrendBucketHour = "hour"
+	TrendBucketDay  = "day"
+)
+
+// QualityTrendFilters selects the generation logs GetQualityTrends
+// aggregates and the width of its buckets
+type QualityTrendFilters struct {
+	Since  time.Time // Logs created at or after Since
+	Until  time.Time // Logs created before Until
+	Bucket string    // TrendBucketHour or TrendBucketDay
+}
+
+// QualityTrendBucket aggregates the finished generations of one bucket.
+// The averages and rates are nil for a bucket without generations.
+type QualityTrendBucket struct {
+	Start              time.Time // Start of the bucket, in UTC
+	Generations        int
+	AvgQualityScore    *float64 // Over the generations with a final quality score
+	ValidationPassRate *float64
+	RegenerationRate   *float64
+	AvgLatencyMs       *float64 // Mean total_pipeline_time_ms
+}
+
+// GenerationLog mirrors a row of the question_generation_logs table
+type GenerationLog struct {
+	ID                    int64
+	QuestionID            string // ID returned to the client for this generation
+	StudentID             string
+	SessionID             string
+	RequestID             string
+	TopicID               string
+	ExamType              string
+	Subject               string
+	Format                string
+	RequestedDifficulty   float64
+	CalibratedDifficulty  *float64
+	BKTMasteryLevel       *float64
+	BKTConfidence         *float64       // BKT's confidence in the calibration, nil for fallbacks
+	BKTRecommendation     string         // BKT's advice for the student, such as "review prerequisite"
+	CalibrationSource     string         // BKT, or FALLBACK when the rule-based path calibrated
+	CalibrationFallback   string         // Fallback strategy used when BKT could not calibrate
+	DifficultyBand        *float64       // ± band around the requested difficulty the template was selected from
+	FallbackExamType      string         // Exam type of the template when a fallback stood in for ExamType
+	TimedOutStages        pq.StringArray // Pipeline stages that ran out of their own timeout
+	SkippedStages         pq.StringArray // Optional stages skipped when the latency budget ran out
+	StageOverrides        pq.StringArray // Stages the request switched off for an experiment
+	TemplateID            *string
+	TemplateVariables     JSONMap
+	GeneratedQuestionText string
+	GeneratedOptions      StringMap
+	CorrectAnswer         string
+	SolutionSteps         StringList
+	GrammarScore          *float64
+	ClarityScore          *float64
+	AmbiguityScore        *float64
+	ValidatorFeedback     string
+	RAGAlignmentScore     *float64
+	RAGExemplarIDs        pq.StringArray
+	RAGExemplars          RAGExemplars
+	RAGFeedback           string
+	RegenerationTriggered bool
+	RegenerationReason    string
+	RegenerationAttempts  RegenerationAttempts
+	GenerationTimeMs      int
+	CalibrationTimeMs     int
+	ValidationTimeMs      int
+	RAGTimeMs             int
+	TotalPipelineTimeMs   int
+	ValidationPassed      bool
+	FinalQualityScore     *float64
+	Status                string
+	ErrorMessage          string
+	RetryCount            int
+	GeneratorVersion      string
+	ModelVersion          string
+	CreatedAt             time.Time
+}
+
+// GeneratedQuestion mirrors a row of the generated_questions table
+type GeneratedQuestion struct {
+	QuestionID    string
+	TemplateID    string
+	StudentID     string
+	RequestID     string
+	QuestionText  string
+	Options       StringMap
+	CorrectAnswer string
+	SolutionSteps StringList
+	RenderFormat  string
+	Difficulty    float64
+	Seed          int64
+	CreatedAt     time.Time
+}
+
+// AnswerSubmission mirrors a row of the answer_submissions table
+type AnswerSubmission struct {
+	ID             int64
+	QuestionID     string
+	TemplateID     string
+	StudentID      string
+	IsCorrect      bool
+	PartialCredit  float64
+	ResponseTimeMs int64 // Zero when the client did not report it
+	SubmittedAt    time.Time
+}
+
+// TemplateStats are the answer statistics RecomputeTemplateStats stored on
+// a template
+type TemplateStats struct {
+	TemplateID   string
+	Answers      int      // Submissions the stats were derived from
+	SuccessRate  *float64 // Fraction answered correctly, nil without answers
+	AvgSolveTime *int64   // Seconds, nil without timed answers
+}
+
+// Reasons a served question is flagged for review
+const (
+	FlagReasonLowRAGAlignment       = "LOW_RAG_ALIGNMENT"      // RAG could not align the question with its exemplars
+	FlagReasonValidationFailed      = "VALIDATION_FAILED"      // The validator scored the question as failing
+	FlagReasonValidationUnavailable = "VALIDATION_UNAVAILABLE" // The validator failed and LENIENT policy served the question unvalidated
+)
+
+// Review states of a flagged question
+const (
+	FlagStatusPending  = "PENDING"
+	FlagStatusAccepted = "ACCEPTED"
+	FlagStatusRejected = "REJECTED" // The question's template was deactivated
+)
+
+// FlaggedQuestion mirrors a row of the flagged_questions table
+type FlaggedQuestion struct {
+	ID         int64
+	QuestionID string
+	TemplateID string
+	Reason     string   // One of the FlagReason constants
+	Score      *float64 // Alignment or validation score behind the flag, nil when there is none
+	Details    string
+	Status     string // One of the FlagStatus constants
+	Reviewer   *string
+	ReviewNote *string
+	CreatedAt  time.Time
+	ResolvedAt *time.Time
+}
+
+// FlaggedQuestionFilters selects the flags QueryFlaggedQuestions lists
+type FlaggedQuestionFilters struct {
+	Status     string // Any status when empty
+	Reason     string
+	TemplateID string
+	Limit      int   // DefaultFlaggedQuestionLimit when zero, at most MaxFlaggedQuestionLimit
+	Cursor     int64 // Only flags with a larger ID, the NextCursor of the previous page
+}
+
+// FlaggedQuestionPage is one page of QueryFlaggedQuestions, oldest first
+type FlaggedQuestionPage struct {
+	Flags      []*FlaggedQuestion
+	NextCursor int64 // Zero on the last page
+}
+
+// DefaultSimilarQuestionLimit bounds FindSimilarQuestions when the query
+// sets no limit
+const DefaultSimilarQuestionLimit = 5
+
+// SimilarQuestionQuery selects the served questions to compare a new
+// question with
+type SimilarQuestionQuery struct {
+	StudentID     string
+	QuestionText  string
+	Since         time.Time // Only questions served at or after Since
+	MinSimilarity float64   // Trigram similarity from 0 to 1
+	Limit         int       // DefaultSimilarQuestionLimit when zero
+}
+
+// SimilarQuestion is a served question resembling the queried text
+type SimilarQuestion struct {
+	QuestionID   string
+	TemplateID   string
+	QuestionText string
+	Similarity   float64
+	CreatedAt    time.Time
+}
+
+// GenerationLogUpdate carries the optional fields for UpdateGenerationLog
+type GenerationLogUpdate struct {
+	Status            *string
+	FinalQualityScore *float64
+	RAGAlignmentScore *float64
+	ValidationPassed  *bool
+	ErrorMessage      *string
+}
+
+// RegenerationAttempt records one RAG-scored generation attempt
+type RegenerationAttempt struct {
+	Attempt        int     `json:"attempt"`
+	TemplateID     string  `json:"template_id"`
+	AlignmentScore float64 `json:"alignment_score"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// RegenerationAttempts is stored as a JSONB array
+type RegenerationAttempts []RegenerationAttempt
+
+// Value implements driver.Valuer
+func (a RegenerationAttempts) Value() (driver.Value, error) {
+	if a == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(a)
+}
+
+// Scan implements sql.Scanner
+func (a *RegenerationAttempts) Scan(src interface{}) error {
+	return scanJSON(src, a)
+}
+
+// RAGExemplar is a reference question RAG compared the generated one against
+type RAGExemplar struct {
+	ID         string  `json:"id"`
+	Text       string  `json:"text"`
+	Similarity float64 `json:"similarity"`
+}
+
+// RAGExemplars is stored as a JSONB array
+type RAGExemplars []RAGExemplar
+
+// Value implements driver.Valuer
+func (e RAGExemplars) Value() (driver.Value, error) {
+	if e == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(e)
+}
+
+// Scan implements sql.Scanner
+func (e *RAGExemplars) Scan(src interface{}) error {
+	return scanJSON(src, e)
+}
+
+// NumericalTolerance is how far a NUMERICAL answer may stray from the
+// correct value and still earn full credit: within Absolute of it, in the
+// answer's unit, or within Relative of its magnitude, whichever is looser.
+// It is stored as a JSONB object.
+type NumericalTolerance struct {
+	Absolute float64 `json:"absolute"`
+	Relative float64 `json:"relative"`
+}
+
+// Value implements driver.Valuer
+func (t NumericalTolerance) Value() (driver.Value, error) {
+	return json.Marshal(t)
+}
+
+// Scan implements sql.Scanner
+func (t *NumericalTolerance) Scan(src interface{}) error {
+	return scanJSON(src, t)
+}
+
+// JSONMap is stored as a JSONB object
+type JSONMap map[string]interface{}
+
+// Value implements driver.Valuer
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(m)
+}
+
+// Scan implements sql.Scanner
+func (m *JSONMap) Scan(src interface{}) error {
+	return scanJSON(src, m)
+}
+
+// StringMap is stored as a JSONB object of strings (e.g. MCQ options)
+type StringMap map[string]string
+
+// Value implements driver.Valuer
+func (m StringMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// Scan implements sql.Scanner
+func (m *StringMap) Scan(src interface{}) error {
+	return scanJSON(src, m)
+}
+
+// StringList is stored as a JSONB array of strings (e.g. solution steps)
+type StringList []string
+
+// Value implements driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	return json.Marshal(l)
+}
+
+// Scan implements sql.Scanner
+func (l *StringList) Scan(src interface{}) error {
+	return scanJSON(src, l)
+}
+
+// scanJSON decodes a JSONB column into dest, leaving it untouched for NULL
+func scanJSON(src interface{}, dest interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	default:
+		return fmt.Errorf("cannot scan %T into JSON column", src)
+	}
+}
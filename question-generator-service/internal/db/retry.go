@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GenerationRetry is a transiently failed generation waiting in
+// question_generation_logs, with status RETRY_PENDING, for a background
+// retry
+type GenerationRetry struct {
+	Log           *GenerationLog
+	Attempts      int       // Background retries run so far, unlike Log.RetryCount excluding regenerations
+	NextAttemptAt time.Time // When the retry is due, or its claim expires
+	Request       []byte    // The request to retry, as the service serialized it
+}
+
+// ScheduleGenerationRetry marks the generation logged as log.ID as
+// RETRY_PENDING after attempts background retries, to be retried with
+// request at nextAttemptAt
+func (c *Client) ScheduleGenerationRetry(ctx context.Context, log *GenerationLog, attempts int, nextAttemptAt time.Time, request []byte) error {
+	query := `
+		UPDATE question_generation_logs
+		SET status = 'RETRY_PENDING', retry_count = $2, retry_attempts = $3, next_attempt_at = $4, retry_request = $5
+		WHERE id = $1`
+
+	if _, err := c.db.ExecContext(ctx, query, log.ID, log.RetryCount, attempts, nextAttemptAt, request); err != nil {
+		return fmt.Errorf("failed to schedule generation retry: %w", err)
+	}
+	return nil
+}
+
+// ClaimGenerationRetry takes the retry of logID due at dueAt for the caller
+// until leaseUntil, reporting false when it is no longer pending at dueAt
+// because another replica claimed or finished it first. A claim that runs
+// out, e.g. when its replica crashed, is taken again at leaseUntil.
+func (c *Client) ClaimGenerationRetry(ctx context.Context, logID int64, dueAt, leaseUntil time.Time) (bool, error) {
+	query := `
+		UPDATE question_generation_logs
+		SET next_attempt_at = $3
+		WHERE id = $1 AND status = 'RETRY_PENDING' AND next_attempt_at = $2`
+
+	result, err := c.db.ExecContext(ctx, query, logID, dueAt, leaseUntil)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim generation retry: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// GetPendingGenerationRetries lists every RETRY_PENDING generation, the
+// soonest due first, so retries can be resumed after a restart
+func (c *Client) GetPendingGenerationRetries(ctx context.Context) ([]*GenerationRetry, error) {
+	query := `
+		SELECT ` + generationLogColumns + `, retry_attempts, next_attempt_at, retry_request
+		FROM question_generation_logs
+		WHERE status = 'RETRY_PENDING'
+		ORDER BY next_attempt_at`
+
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending generation retries: %w", err)
+	}
+	defer rows.Close()
+
+	var retries []*GenerationRetry
+	for rows.Next() {
+		retry := &GenerationRetry{}
+		retry.Log, err = scanGenerationLog(retryRow{rows, retry}, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pending generation retry: %w", err)
+		}
+		retries = append(retries, retry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pending generation retries: %w", err)
+	}
+	return retries, nil
+}
+
+// retryRow scans retry_attempts, next_attempt_at and retry_request into
+// retry after the generationLogColumns scanGenerationLog reads
+type retryRow struct {
+	rows  *sql.Rows
+	retry *GenerationRetry
+}
+
+func (r retryRow) Scan(dest ...interface{}) error {
+	return r.rows.Scan(append(dest, &r.retry.Attempts, &r.retry.NextAttemptAt, &r.retry.Request)...)
+}
+
+// GetPendingGenerationRetry returns when the RETRY_PENDING generation of
+// requestID, if any, is next retried
+func (c *Client) GetPendingGenerationRetry(ctx context.Context, requestID string) (time.Time, bool, error) {
+	query := `
+		SELECT next_attempt_at
+		FROM question_generation_logs
+		WHERE request_id = $1 AND status = 'RETRY_PENDING'
+		LIMIT 1`
+
+	var nextAttemptAt time.Time
+	err := c.db.QueryRowContext(ctx, query, requestID).Scan(&nextAttemptAt)
+	switch {
+	case err == sql.ErrNoRows:
+		return time.Time{}, false, nil
+	case err != nil:
+		return time.Time{}, false, fmt.Errorf("failed to look up pending generation retry: %w", err)
+	}
+	return nextAttemptAt, true, nil
+}
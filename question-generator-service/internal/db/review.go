@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrFlagNotFound is returned when no flagged question has the given ID
+var ErrFlagNotFound = errors.New("flagged question not found")
+
+// ErrFlagResolved is returned when resolving a flag a reviewer has already
+// accepted or rejected
+var ErrFlagResolved = errors.New("flagged question already resolved")
+
+// Bounds on the page size of QueryFlaggedQuestions
+const (
+	DefaultFlaggedQuestionLimit = 50
+	MaxFlaggedQuestionLimit     = 200
+)
+
+// flaggedQuestionColumns is the column order scanFlaggedQuestion reads
+const flaggedQuestionColumns = `id, question_id, template_id, reason, score, details, status,
+	reviewer, review_note, created_at, resolved_at`
+
+// CreateFlaggedQuestion queues a served question for review, setting the
+// flag's ID, status and creation time
+func (c *Client) CreateFlaggedQuestion(ctx context.Context, f *FlaggedQuestion) error {
+	query := `
+		INSERT INTO flagged_questions (
+			question_id, template_id, reason, score, details
+		) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at`
+
+	err := c.db.QueryRowContext(ctx, query,
+		f.QuestionID, f.TemplateID, f.Reason, f.Score, f.Details,
+	).Scan(&f.ID, &f.Status, &f.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to flag question: %w", err)
+	}
+	return nil
+}
+
+// QueryFlaggedQuestions lists the flags matching filters, oldest first, a
+// page at a time
+func (c *Client) QueryFlaggedQuestions(ctx context.Context, filters FlaggedQuestionFilters) (*FlaggedQuestionPage, error) {
+	query := `
+		SELECT ` + flaggedQuestionColumns + `
+		FROM flagged_questions
+		WHERE id > $1`
+
+	args := []interface{}{filters.Cursor}
+	argIndex := 2
+	for _, cond := range []struct {
+		column string
+		value  string
+	}{
+		{"status", filters.Status},
+		{"reason", filters.Reason},
+		{"template_id", filters.TemplateID},
+	} {
+		if cond.value != "" {
+			query += fmt.Sprintf(" AND %s = $%d", cond.column, argIndex)
+			args = append(args, cond.value)
+			argIndex++
+		}
+	}
+
+	limit := filters.Limit
+	if limit <= 0 {
+		limit = DefaultFlaggedQuestionLimit
+	}
+	if limit > MaxFlaggedQuestionLimit {
+		limit = MaxFlaggedQuestionLimit
+	}
+	// One extra row tells whether there is a next page
+	query += fmt.Sprintf(" ORDER BY id LIMIT $%d", argIndex)
+	args = append(args, limit+1)
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query flagged questions: %w", err)
+	}
+	defer rows.Close()
+
+	page := &FlaggedQuestionPage{}
+	for rows.Next() {
+		f, err := scanFlaggedQuestion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan flagged question row: %w", err)
+		}
+		page.Flags = append(page.Flags, f)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating flagged question rows: %w", err)
+	}
+
+	if len(page.Flags) > limit {
+		page.Flags = page.Flags[:limit]
+		page.NextCursor = page.Flags[limit-1].ID
+	}
+	return page, nil
+}
+
+// ResolveFlaggedQuestion records a reviewer's verdict on a pending flag,
+// FlagStatusAccepted or FlagStatusRejected, and returns the updated flag.
+// Rejecting it deactivates the flag's template in the same transaction, so
+// a rejected question's template is never left active; a template already
+// inactive or deleted is left as it is.
+func (c *Client) ResolveFlaggedQuestion(ctx context.Context, id int64, status, reviewer, note string) (*FlaggedQuestion, error) {
+	query := `
+		UPDATE flagged_questions
+		SET status = $2, reviewer = NULLIF($3, ''), review_note = NULLIF($4, ''), resolved_at = NOW()
+		WHERE id = $1 AND status = 'PENDING'
+		RETURNING ` + flaggedQuestionColumns
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin review transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	f, err := scanFlaggedQuestion(tx.QueryRowContext(ctx, query, id, status, reviewer, note))
+	if err == sql.ErrNoRows {
+		// Tell a missing flag from one resolved earlier
+		var current string
+		err = tx.QueryRowContext(ctx, `SELECT status FROM flagged_questions WHERE id = $1`, id).Scan(&current)
+		switch {
+		case err == sql.ErrNoRows:
+			return nil, fmt.Errorf("%w: %d", ErrFlagNotFound, id)
+		case err != nil:
+			return nil, fmt.Errorf("failed to resolve flagged question: %w", err)
+		}
+		return nil, fmt.Errorf("%w: %d is %s", ErrFlagResolved, id, current)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve flagged question: %w", err)
+	}
+
+	if status == FlagStatusRejected {
+		if _, err := tx.ExecContext(ctx, deactivateTemplateQuery, f.TemplateID); err != nil {
+			return nil, fmt.Errorf("failed to deactivate template %s: %w", f.TemplateID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit review of flagged question %d: %w", id, err)
+	}
+	if status == FlagStatusRejected {
+		// Only once committed, or a concurrent read could cache the template
+		// as still active
+		c.templates.invalidate(f.TemplateID)
+	}
+	return f, nil
+}
+
+// scanFlaggedQuestion reads a row in flaggedQuestionColumns order
+func scanFlaggedQuestion(row interface{ Scan(...interface{}) error }) (*FlaggedQuestion, error) {
+	var f FlaggedQuestion
+	var score sql.NullFloat64
+	var reviewer, note sql.NullString
+	var resolvedAt sql.NullTime
+	err := row.Scan(&f.ID, &f.QuestionID, &f.TemplateID, &f.Reason, &score, &f.Details, &f.Status,
+		&reviewer, &note, &f.CreatedAt, &resolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	if score.Valid {
+		f.Score = &score.Float64
+	}
+	if reviewer.Valid {
+		f.Reviewer = &reviewer.String
+	}
+	if note.Valid {
+		f.ReviewNote = &note.String
+	}
+	if resolvedAt.Valid {
+		f.ResolvedAt = &resolvedAt.Time
+	}
+	return &f, nil
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Queries with a fixed column set, prepared once by PrepareStatements. Queries
+// built per call, such as GetTemplatesByFilters, are run ad hoc.
+const (
+	getTemplateQuery = `
+		SELECT template_id, topic_id, exam_type, subject, format, template_text, template_text_hi,
+			   variable_slots, options_template, options_template_hi, answer_unit, answer_formula, numerical_tolerance, answer_precision, render_format, base_difficulty, bloom_level,
+			   concept_depth, validation_score, ambiguity_flag, clarity_score,
+			   chapter, sub_chapter, ncert_reference, usage_count, success_rate,
+			   avg_solve_time, created_at, updated_at, is_active, version
+		FROM question_templates
+		WHERE template_id = $1 AND is_active = true`
+
+	insertGenerationLogQuery = `
+		INSERT INTO question_generation_logs (
+			question_id, student_id, session_id, request_id, topic_id, exam_type, subject, format,
+			requested_difficulty, calibrated_difficulty, bkt_mastery_level,
+			template_id, template_variables, generated_question_text, generated_options,
+			correct_answer, solution_steps, grammar_score, clarity_score, ambiguity_score,
+			validator_feedback, rag_alignment_score, rag_exemplar_ids, rag_exemplars, rag_feedback,
+			regeneration_triggered, regeneration_reason, generation_time_ms,
+			calibration_time_ms, validation_time_ms, rag_time_ms, total_pipeline_time_ms,
+			validation_passed, final_quality_score, status, error_message, retry_count,
+			generator_version, model_version, calibration_fallback, calibration_source,
+			bkt_confidence, bkt_recommendation, difficulty_band, timed_out_stages, skipped_stages,
+			fallback_exam_type, stage_overrides
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16,
+			$17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30,
+			$31, $32, $33, $34, $35, $36, $37, $38, $39, $40, $41, $42, $43, $44, $45,
+			$46, $47, $48
+		) RETURNING id`
+
+	updateGenerationLogOutcomeQuery = `
+		UPDATE question_generation_logs SET
+			status = $1,
+			final_quality_score = $2,
+			rag_alignment_score = $3,
+			validation_passed = $4,
+			error_message = $5,
+			regeneration_triggered = $6,
+			regeneration_reason = $7,
+			regeneration_attempts = $8,
+			retry_count = $9,
+			rag_exemplar_ids = $10,
+			rag_exemplars = $11,
+			rag_feedback = $12,
+			question_id = COALESCE($13, question_id),
+			calibration_fallback = $14,
+			calibration_source = $15,
+			bkt_confidence = $16,
+			bkt_recommendation = $17,
+			difficulty_band = $18,
+			timed_out_stages = $19,
+			skipped_stages = $20,
+			fallback_exam_type = $21,
+			stage_overrides = $22,
+			next_attempt_at = NULL,
+			retry_request = NULL
+		WHERE id = $23`
+)
+
+// preparedQueries are the queries PrepareStatements prepares
+var preparedQueries = []string{getTemplateQuery, insertGenerationLogQuery, updateGenerationLogOutcomeQuery}
+
+// PrepareStatements prepares the fixed-column queries on the hot path so
+// that they are parsed once rather than on every call. It is called once
+// migrations have run, before the client is in use; against an older
+// schema it fails and the queries keep running unprepared.
+func (c *Client) PrepareStatements(ctx context.Context) error {
+	stmts := make(map[string]*sql.Stmt, len(preparedQueries))
+	for _, query := range preparedQueries {
+		stmt, err := c.db.PrepareContext(ctx, query)
+		if err != nil {
+			for _, prepared := range stmts {
+				prepared.Close()
+			}
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		stmts[query] = stmt
+	}
+	c.closeStatements()
+	c.stmts = stmts
+	return nil
+}
+
+func (c *Client) closeStatements() {
+	for _, stmt := range c.stmts {
+		stmt.Close()
+	}
+	c.stmts = nil
+}
+
+// queryRow runs query through its prepared statement when there is one,
+// within tx when it is not nil
+func (c *Client) queryRow(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) *sql.Row {
+	stmt, prepared := c.stmts[query]
+	switch {
+	case prepared && tx != nil:
+		return tx.StmtContext(ctx, stmt).QueryRowContext(ctx, args...)
+	case prepared:
+		return stmt.QueryRowContext(ctx, args...)
+	case tx != nil:
+		return tx.QueryRowContext(ctx, query, args...)
+	}
+	return c.db.QueryRowContext(ctx, query, args...)
+}
+
+// exec runs query through its prepared statement when there is one
+func (c *Client) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if stmt, prepared := c.stmts[query]; prepared {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return c.db.ExecContext(ctx, query, args...)
+}
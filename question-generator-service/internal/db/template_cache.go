@@ -0,0 +1,196 @@
+package db
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// templateCache keeps recently fetched templates by ID, and the results of
+// recent template selections by their filters, so that hot templates are
+// not re-read from Postgres on every request. Entries expire after the TTL,
+// which also bounds how stale a template changed by another replica can be,
+// and the least recently used entry is evicted once it is full.
+type templateCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Front is most recently used
+	// selections holds up to size selection results, kept apart from
+	// entries so that selections do not evict the templates they list
+	selections     map[TemplateFilters]*list.Element
+	selectionOrder *list.List
+	size           int
+	ttl            time.Duration
+	// generation counts invalidations, so that a read which raced with an
+	// update does not cache the template it fetched before the update
+	generation uint64
+}
+
+type templateCacheEntry struct {
+	template QuestionTemplate
+	storedAt time.Time
+}
+
+type selectionCacheEntry struct {
+	filters   TemplateFilters
+	templates []QuestionTemplate
+	storedAt  time.Time
+}
+
+// newTemplateCache holds up to size templates for ttl each. A size of zero
+// disables caching and returns nil, which every method accepts.
+func newTemplateCache(size int, ttl time.Duration) *templateCache {
+	if size <= 0 {
+		return nil
+	}
+	return &templateCache{
+		entries:        make(map[string]*list.Element),
+		order:          list.New(),
+		selections:     make(map[TemplateFilters]*list.Element),
+		selectionOrder: list.New(),
+		size:           size,
+		ttl:            ttl,
+	}
+}
+
+// get returns a copy of the cached template, if still fresh, along with the
+// generation to pass to put after a miss
+func (c *templateCache) get(templateID string) (*QuestionTemplate, uint64) {
+	if c == nil {
+		return nil, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[templateID]
+	if !ok {
+		return nil, c.generation
+	}
+	entry := elem.Value.(*templateCacheEntry)
+	if time.Since(entry.storedAt) > c.ttl {
+		c.order.Remove(elem)
+		delete(c.entries, templateID)
+		return nil, c.generation
+	}
+	c.order.MoveToFront(elem)
+	qt := entry.template
+	return &qt, c.generation
+}
+
+// put stores a copy of qt unless the cache was invalidated since generation
+// was returned by get, evicting the least recently used entry when full
+func (c *templateCache) put(qt *QuestionTemplate, generation uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if elem, ok := c.entries[qt.TemplateID]; ok {
+		entry := elem.Value.(*templateCacheEntry)
+		entry.template, entry.storedAt = *qt, time.Now()
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[qt.TemplateID] = c.order.PushFront(&templateCacheEntry{template: *qt, storedAt: time.Now()})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*templateCacheEntry).template.TemplateID)
+	}
+}
+
+// getSelection returns copies of the templates cached for filters, if still
+// fresh, along with the generation to pass to putSelection after a miss.
+// ok tells a cached empty selection from a miss.
+func (c *templateCache) getSelection(filters TemplateFilters) (templates []*QuestionTemplate, ok bool, generation uint64) {
+	if c == nil {
+		return nil, false, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, found := c.selections[filters]
+	if !found {
+		return nil, false, c.generation
+	}
+	entry := elem.Value.(*selectionCacheEntry)
+	if time.Since(entry.storedAt) > c.ttl {
+		c.selectionOrder.Remove(elem)
+		delete(c.selections, filters)
+		return nil, false, c.generation
+	}
+	c.selectionOrder.MoveToFront(elem)
+	templates = make([]*QuestionTemplate, len(entry.templates))
+	for i := range entry.templates {
+		qt := entry.templates[i]
+		templates[i] = &qt
+	}
+	return templates, true, c.generation
+}
+
+// putSelection stores copies of the templates selected by filters unless
+// the cache was invalidated since generation was returned by getSelection
+func (c *templateCache) putSelection(filters TemplateFilters, templates []*QuestionTemplate, generation uint64) {
+	if c == nil {
+		return
+	}
+	copies := make([]QuestionTemplate, len(templates))
+	for i, qt := range templates {
+		copies[i] = *qt
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if elem, ok := c.selections[filters]; ok {
+		entry := elem.Value.(*selectionCacheEntry)
+		entry.templates, entry.storedAt = copies, time.Now()
+		c.selectionOrder.MoveToFront(elem)
+		return
+	}
+	c.selections[filters] = c.selectionOrder.PushFront(&selectionCacheEntry{filters: filters, templates: copies, storedAt: time.Now()})
+	for c.selectionOrder.Len() > c.size {
+		oldest := c.selectionOrder.Back()
+		c.selectionOrder.Remove(oldest)
+		delete(c.selections, oldest.Value.(*selectionCacheEntry).filters)
+	}
+}
+
+// warm stores copies of templates fetched ahead of any request
+func (c *templateCache) warm(templates []*QuestionTemplate) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	generation := c.generation
+	c.mu.Unlock()
+	for _, qt := range templates {
+		c.put(qt, generation)
+	}
+}
+
+// invalidate drops templateID, and every cached selection since a changed
+// template may join or leave any of them, so that the next reads fetch
+// them afresh
+func (c *templateCache) invalidate(templateID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, ok := c.entries[templateID]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, templateID)
+	}
+	c.selections = make(map[TemplateFilters]*list.Element)
+	c.selectionOrder.Init()
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TemplateProblem lists why a stored template cannot be generated
+type TemplateProblem struct {
+	TemplateID string
+	Reasons    []string
+}
+
+func (p TemplateProblem) String() string {
+	return p.TemplateID + ": " + strings.Join(p.Reasons, "; ")
+}
+
+// placeholderPattern matches the {{name}} placeholders filled at generation
+var placeholderPattern = regexp.MustCompile(`\{\{([^{}]*)\}\}`)
+
+// slotSpec holds the fields of a variable slot the consistency checks need.
+// The full spec is parsed and validated by the templates package.
+type slotSpec struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Formula string `json:"formula"`
+}
+
+// ValidateAllTemplates scans the active templates for problems that would
+// otherwise only surface at generation time: malformed variable_slots,
+// placeholders in template_text, template_text_hi or answer_formula without
+// a matching slot and computed variables referring to slots that are not
+// generated before them. It returns the broken templates ordered by ID.
+func (c *Client) ValidateAllTemplates(ctx context.Context) ([]TemplateProblem, error) {
+	templates, err := c.GetTemplatesByFilters(ctx, TemplateFilters{})
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []TemplateProblem
+	for _, qt := range templates {
+		if reasons := checkTemplate(qt); len(reasons) > 0 {
+			problems = append(problems, TemplateProblem{TemplateID: qt.TemplateID, Reasons: reasons})
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].TemplateID < problems[j].TemplateID })
+	return problems, nil
+}
+
+// checkTemplate returns the reasons qt cannot be generated
+func checkTemplate(qt *QuestionTemplate) []string {
+	raw := qt.VariableSlots
+	if strings.TrimSpace(raw) == "" {
+		raw = "[]"
+	}
+	var specs []slotSpec
+	if err := json.Unmarshal([]byte(raw), &specs); err != nil {
+		return []string{fmt.Sprintf("variable_slots is not a JSON array of variable specs: %v", err)}
+	}
+
+	var reasons []string
+	declared := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		declared[spec.Name] = true
+	}
+
+	// Variables are generated in order, so a formula may only use the
+	// slots before it
+	generated := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		if spec.Type == "computed" {
+			if strings.TrimSpace(spec.Formula) == "" {
+				reasons = append(reasons, fmt.Sprintf("computed variable %s has no formula", spec.Name))
+			}
+			for _, ref := range placeholders(spec.Formula) {
+				switch {
+				case !declared[ref]:
+					reasons = append(reasons, fmt.Sprintf("computed variable %s refers to undefined variable %s", spec.Name, ref))
+				case !generated[ref]:
+					reasons = append(reasons, fmt.Sprintf("computed variable %s refers to %s before it is generated", spec.Name, ref))
+				}
+			}
+		}
+		generated[spec.Name] = true
+	}
+
+	for _, name := range placeholders(qt.TemplateText) {
+		if !declared[name] {
+			reasons = append(reasons, fmt.Sprintf("template_text placeholder {{%s}} has no variable slot", name))
+		}
+	}
+	if qt.TemplateTextHi != nil {
+		for _, name := range placeholders(*qt.TemplateTextHi) {
+			if !declared[name] {
+				reasons = append(reasons, fmt.Sprintf("template_text_hi placeholder {{%s}} has no variable slot", name))
+			}
+		}
+	}
+	if qt.AnswerFormula != nil {
+		for _, name := range placeholders(*qt.AnswerFormula) {
+			if !declared[name] {
+				reasons = append(reasons, fmt.Sprintf("answer_formula placeholder {{%s}} has no variable slot", name))
+			}
+		}
+	}
+	return reasons
+}
+
+// placeholders returns the distinct names of the {{name}} placeholders in
+// text, in order of first use
+func placeholders(text string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/pkg/calibrator"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/templates"
+)
+
+// ErrMasteryUpdateFailed is returned when the BKT service rejects or fails
+// an answer's mastery update
+var ErrMasteryUpdateFailed = errors.New("mastery update failed")
+
+// AnswerSubmission is a student's answer to a previously generated question
+type AnswerSubmission struct {
+	StudentID      string `json:"student_id"`
+	QuestionID     string `json:"question_id"`
+	TopicID        string `json:"topic_id"`
+	Answer         string `json:"answer"` // MCQ option key or text, or a numerical value with optional unit
+	ResponseTimeMs int64  `json:"response_time_ms"`
+	HintUsed       bool   `json:"hint_used,omitempty"`
+}
+
+// AnswerResult reports how an answer was graded and the resulting mastery
+type AnswerResult struct {
+	QuestionID    string  `json:"question_id"`
+	IsCorrect     bool    `json:"is_correct"`
+	PartialCredit float64 `json:"partial_credit"`
+	CorrectAnswer string  `json:"correct_answer"`
+	MasteryLevel  float64 `json:"mastery_level"`
+}
+
+// SubmitAnswer grades a student's answer against the stored question and
+// feeds the outcome back into BKT, closing the adaptive loop
+func (gs *GeneratorService) SubmitAnswer(ctx context.Context, submission AnswerSubmission) (*AnswerResult, error) {
+	question, err := gs.dbClient.GetGeneratedQuestion(ctx, submission.QuestionID)
+	if err != nil {
+		return nil, err
+	}
+
+	tolerance := templates.DefaultNumericalTolerance
+	if len(question.Options) == 0 {
+		tolerance = gs.numericalTolerance(ctx, question.TemplateID)
+	}
+	grade := templates.GradeAnswerWithTolerance(question.CorrectAnswer, question.Options, submission.Answer, tolerance)
+
+	// Submissions feed the template's success rate and solve time, which
+	// are recomputed on demand; losing one only skews them slightly
+	err = gs.dbClient.SaveAnswerSubmission(ctx, &db.AnswerSubmission{
+		QuestionID:     question.QuestionID,
+		TemplateID:     question.TemplateID,
+		StudentID:      submission.StudentID,
+		IsCorrect:      grade.Correct,
+		PartialCredit:  grade.PartialCredit,
+		ResponseTimeMs: submission.ResponseTimeMs,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Warnw("failed to save answer submission (non-critical)",
+			"question_id", question.QuestionID, "error", err)
+	}
+
+	update := calibrator.MasteryUpdateRequest{
+		StudentID:    submission.StudentID,
+		TopicID:      submission.TopicID,
+		QuestionID:   submission.QuestionID,
+		IsCorrect:    grade.Correct,
+		ResponseTime: submission.ResponseTimeMs,
+		Difficulty:   question.Difficulty,
+		HintUsed:     submission.HintUsed,
+	}
+	if grade.Numerical {
+		update.PartialCredit = grade.PartialCredit
+	}
+
+	mastery, err := gs.calibrator.UpdateMasteryLevel(ctx, update)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMasteryUpdateFailed, err)
+	}
+
+	return &AnswerResult{
+		QuestionID:    question.QuestionID,
+		IsCorrect:     grade.Correct,
+		PartialCredit: grade.PartialCredit,
+		CorrectAnswer: question.CorrectAnswer,
+		MasteryLevel:  mastery,
+	}, nil
+}
+
+// numericalTolerance returns the grading tolerance of a question's template,
+// or the default when the template sets none or cannot be read
+func (gs *GeneratorService) numericalTolerance(ctx context.Context, templateID string) db.NumericalTolerance {
+	template, err := gs.dbClient.GetQuestionTemplate(ctx, templateID)
+	if err != nil {
+		logging.FromContext(ctx).Warnw("grading with the default numerical tolerance",
+			"template_id", templateID, "error", err)
+		return templates.DefaultNumericalTolerance
+	}
+	if template.NumericalTolerance == nil {
+		return templates.DefaultNumericalTolerance
+	}
+	return *template.NumericalTolerance
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Batch limits applied when the configuration leaves them unset
+const (
+	defaultBatchMaxSize     = 50
+	defaultBatchConcurrency = 8
+)
+
+// ErrBatchTooLarge is returned when a batch exceeds the configured maximum size
+var ErrBatchTooLarge = errors.New("batch exceeds maximum size")
+
+// BatchItemResult is the outcome of one request in a batch. Exactly one of
+// Question and Error is set.
+type BatchItemResult struct {
+	Index    int                       `json:"index"`
+	Question *GenerateQuestionResponse `json:"question,omitempty"`
+	Error    string                    `json:"error,omitempty"`
+}
+
+// MaxBatchSize returns the largest batch GenerateBatch accepts
+func (gs *GeneratorService) MaxBatchSize() int {
+	if gs.cfg.Batch.MaxSize > 0 {
+		return gs.cfg.Batch.MaxSize
+	}
+	return defaultBatchMaxSize
+}
+
+// GenerateBatch runs every request through the generation pipeline on a
+// bounded pool of workers. Failures are reported per item rather than
+// failing the batch, and results are returned in request order.
+//
+// A non-zero seed makes the batch reproducible: requests without a seed of
+// their own get one derived from it and their index, and the requests run
+// one at a time so that those sharing a session avoid each other's
+// templates in request order.
+func (gs *GeneratorService) GenerateBatch(ctx context.Context, reqs []*GenerateQuestionRequest, seed int64) ([]BatchItemResult, error) {
+	if max := gs.MaxBatchSize(); len(reqs) > max {
+		return nil, fmt.Errorf("%w: %d requests, maximum is %d", ErrBatchTooLarge, len(reqs), max)
+	}
+
+	workers := gs.cfg.Batch.Concurrency
+	if workers <= 0 {
+		workers = defaultBatchConcurrency
+	}
+	if seed != 0 {
+		workers = 1
+		seeded := make([]*GenerateQuestionRequest, len(reqs))
+		for i, req := range reqs {
+			seeded[i] = req
+			if req.Seed == 0 {
+				withSeed := *req
+				withSeed.Seed = DeriveSeed(seed, i)
+				seeded[i] = &withSeed
+			}
+		}
+		reqs = seeded
+	}
+	if workers > len(reqs) {
+		workers = len(reqs)
+	}
+
+	results := make([]BatchItemResult, len(reqs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = BatchItemResult{Index: i}
+				response, err := gs.GenerateQuestion(ctx, reqs[i])
+				if err != nil {
+					results[i].Error = err.Error()
+					continue
+				}
+				results[i].Question = response
+			}
+		}()
+	}
+
+	// Stop handing out work once the caller gives up; undispatched items
+	// report the context error
+	dispatched := 0
+dispatch:
+	for ; dispatched < len(reqs); dispatched++ {
+		select {
+		case jobs <- dispatched:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := dispatched; i < len(reqs); i++ {
+		results[i] = BatchItemResult{Index: i, Error: ctx.Err().Error()}
+	}
+	return results, nil
+}
+
+// DeriveSeed returns the seed of the index-th question of a batch or test
+// from the batch's seed. It mixes the two with SplitMix64, so neighbouring
+// indexes get unrelated seeds, and never returns zero, which would ask for
+// a random one.
+func DeriveSeed(seed int64, index int) int64 {
+	z := uint64(seed) + uint64(index+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	if derived := int64(z >> 1); derived != 0 {
+		return derived
+	}
+	return 1
+}
@@ -2,8 +2,11 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"math"
+	"math/rand"
+	"strings"
 	"time"
 
 	"question-generator-service/internal/config"
@@ -13,6 +16,8 @@ import (
 	"question-generator-service/pkg/validator"
 	"question-generator-service/pkg/rag_advisor"
 	"question-generator-service/pkg/logger"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/metrics"
 )
 
 // GeneratorService orchestrates the complete question generation pipeline
@@ -20,16 +25,19 @@ type GeneratorService struct {
 	dbClient     *db.Client
 	templateSvc  *templates.Service
 	calibrator   *calibrator.Service
-	validator    *validator.Service
+	validator    QuestionValidator
 	ragAdvisor   *rag_advisor.Service
-	logger       *logger.Service
+	logger       *logger.GenlogService
+	recent       *templates.RecentTemplates
+	settings     *config.Holder
 	cfg          *config.AppConfig
+	retries      *retryQueue // Nil when background retries are disabled
 }
 
 // NewGeneratorService creates a new generator service with all dependencies
 func NewGeneratorService(cfg *config.AppConfig, dbClient *db.Client) (*GeneratorService, error) {
 	// Initialize template service
-	templateSvc, err := templates.NewService(dbClient)
+	templateSvc, err := templates.NewService(dbClient, cfg.Templates)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize template service: %w", err)
 	}
@@ -41,7 +49,7 @@ func NewGeneratorService(cfg *config.AppConfig, dbClient *db.Client) (*Generator
 	}
 
 	// Initialize validator service
-	validatorSvc, err := validator.NewService()
+	validatorSvc, err := validator.NewService(cfg.Validator)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize validator: %w", err)
 	}
@@ -55,21 +63,61 @@ func NewGeneratorService(cfg *config.AppConfig, dbClient *db.Client) (*Generator
 		}
 	}
 
+	// Tunable settings are read through the holder so reloads apply live
+	settings := config.NewHolder(cfg)
+	templateSvc.UseSettings(settings)
+	if ragAdvisorSvc != nil {
+		ragAdvisorSvc.UseSettings(settings)
+	}
+
 	// Initialize logger service
 	loggerSvc, err := logger.NewService(dbClient)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize logger: %w", err)
 	}
 
-	return &GeneratorService{
+	gs := &GeneratorService{
 		dbClient:    dbClient,
 		templateSvc: templateSvc,
 		calibrator:  calibratorSvc,
 		validator:   validatorSvc,
 		ragAdvisor:  ragAdvisorSvc,
 		logger:      loggerSvc,
+		recent:      templates.NewRecentTemplates(cfg.Templates.RecentWindow, cfg.Templates.RecentTTL),
+		settings:    settings,
 		cfg:         cfg,
-	}, nil
+	}
+	if cfg.Retry.QueueSize > 0 {
+		gs.retries = newRetryQueue(cfg.Retry, dbClient, gs.runGeneration)
+	}
+	return gs, nil
+}
+
+// Close stops the background retry workers. Queued retries keep their
+// RETRY_PENDING log rows, and ResumeRetries picks them up on the next start.
+func (gs *GeneratorService) Close() {
+	if gs.retries != nil {
+		gs.retries.close()
+	}
+}
+
+// ResumeRetries queues the background retries persisted as RETRY_PENDING
+// before a restart, returning how many it queued
+func (gs *GeneratorService) ResumeRetries(ctx context.Context) (int, error) {
+	if gs.retries == nil {
+		return 0, nil
+	}
+	return gs.retries.resume(ctx)
+}
+
+// Settings returns the holder of the service's reloadable configuration
+func (gs *GeneratorService) Settings() *config.Holder {
+	return gs.settings
+}
+
+// Templates returns the template service, for template management endpoints
+func (gs *GeneratorService) Templates() *templates.Service {
+	return gs.templateSvc
 }
 
 // GenerateQuestionRequest represents a question generation request
@@ -82,30 +130,146 @@ type GenerateQuestionRequest struct {
 	RequestedDifficulty float64 `json:"requested_difficulty" validate:"required,min=0.1,max=1.0"`
 	SessionID         string  `json:"session_id"`
 	RequestID         string  `json:"request_id"`
+	Seed              int64   `json:"seed,omitempty"` // Replays a previous generation; random when zero
+	Debug             bool    `json:"debug,omitempty"` // Adds diagnostics such as the validation breakdown and RAG exemplars to the metadata
+	Language          string  `json:"language,omitempty"` // en (default), hi or both; hi needs a template with Hindi text
+	SkipRAG           bool    `json:"skip_rag,omitempty"`        // Experiment override: serve without the RAG check
+	SkipValidation    bool    `json:"skip_validation,omitempty"` // Experiment override: serve without validation
+	SkipTemplateIDs   []string `json:"-"`              // Templates never to serve, e.g. those already in the same test paper
 }
 
 // GenerateQuestionResponse represents the generated question response
 type GenerateQuestionResponse struct {
 	QuestionID       string                 `json:"question_id"`
+	RequestID        string                 `json:"request_id,omitempty"` // The request's request_id, generated when the client sent none
 	QuestionText     string                 `json:"question_text"`
 	Options          map[string]string      `json:"options,omitempty"`
 	CorrectAnswer    string                 `json:"correct_answer"`
 	SolutionSteps    []string              `json:"solution_steps,omitempty"`
+	AssertionReason  *templates.AssertionReason `json:"assertion_reason,omitempty"` // ASSERTION_REASON only
+	MatrixMatch      *templates.MatrixMatch     `json:"matrix_match,omitempty"`     // MATRIX_MATCH only
+	Passage          *templates.Passage         `json:"passage,omitempty"`          // PASSAGE only
+	Bodies           map[string]templates.QuestionBody `json:"bodies,omitempty"` // Text and options per requested language; question_text and options stay English
+	RenderFormat     string                `json:"render_format"` // PLAIN, LATEX or MATHML
 	Difficulty       float64               `json:"difficulty"`
 	GenerationTime   int64                 `json:"generation_time_ms"`
 	QualityScore     float64               `json:"quality_score"`
 	Metadata         map[string]interface{} `json:"metadata"`
+	Replayed         bool                   `json:"-"` // Served from an earlier completed generation of the same request ID
+}
+
+// ValidationBreakdown details the checks behind a question's quality score.
+// It is added to the metadata as validation_breakdown for debug requests
+// only, for content QA.
+type ValidationBreakdown struct {
+	GrammarScore      float64    `json:"grammar_score"`
+	ClarityScore      float64    `json:"clarity_score"`
+	AmbiguityScore    float64    `json:"ambiguity_score"`
+	ValidationScore   float64    `json:"validation_score"` // The validator's overall score
+	ValidationPassed  bool       `json:"validation_passed"`
+	NegationFlag      bool       `json:"negation_flag"`
+	DuplicateOptions  [][]string `json:"duplicate_options,omitempty"`
+	Feedback          []string   `json:"feedback"`
+	RAGAlignmentScore *float64   `json:"rag_alignment_score,omitempty"` // Absent when RAG did not score the question
+	RAGFeedback       string     `json:"rag_feedback,omitempty"`
+}
+
+// newValidationBreakdown collects the validator's and, when present, RAG's
+// results
+func newValidationBreakdown(validation *validator.ValidationResult, rag *rag_advisor.QualityCheckResponse) *ValidationBreakdown {
+	breakdown := &ValidationBreakdown{
+		GrammarScore:     validation.GrammarScore,
+		ClarityScore:     validation.ClarityScore,
+		AmbiguityScore:   validation.AmbiguityScore,
+		ValidationScore:  validation.OverallScore,
+		ValidationPassed: validation.Passed,
+		NegationFlag:     validation.NegationFlag,
+		DuplicateOptions: validation.DuplicateOptions,
+		Feedback:         append([]string{}, validation.FeedbackItems...),
+	}
+	if rag != nil {
+		breakdown.RAGAlignmentScore = &rag.AlignmentScore
+		breakdown.RAGFeedback = rag.Feedback
+	}
+	return breakdown
 }
 
+// generationCandidate holds the output of one pass through template
+// selection, calibration, generation and validation
+type generationCandidate struct {
+	template             *db.QuestionTemplate
+	difficultyBand       float64 // ± band around the requested difficulty the template came from
+	fallbackExamType     string  // Exam type of the template when it is not the requested one
+	calibratedDifficulty float64
+	masteryLevel         float64
+	calibrationSource    calibrator.CalibrationSource
+	calibrationFallback  calibrator.FallbackStrategy // Empty when BKT calibrated
+	confidence           float64                     // BKT's confidence, zero for fallbacks
+	recommendation       string                      // BKT's advice for the student, if any
+	question             *templates.GeneratedQuestion
+	seed                 int64 // Seed the template variables were drawn from
+	validation           *validator.ValidationResult
+	unvalidated          bool // The validator failed and LENIENT policy served the question anyway, or the request skipped validation
+	templateTime         time.Duration
+	calibrationTime      time.Duration
+	generationTime       time.Duration
+	validationTime       time.Duration
+}
+
+// candidateError carries the pipeline stage at which a candidate failed
+type candidateError struct {
+	stage string
+	err   error
+}
+
+func (e *candidateError) Error() string { return e.err.Error() }
+func (e *candidateError) Unwrap() error { return e.err }
+
 // GenerateQuestion executes the complete question generation pipeline
 func (gs *GeneratorService) GenerateQuestion(ctx context.Context, req *GenerateQuestionRequest) (*GenerateQuestionResponse, error) {
 	startTime := time.Now()
+
+	// The body's request_id identifies the request for idempotency and the
+	// generation log. The correlation ID carried by ctx, e.g. X-Request-ID,
+	// differs per HTTP attempt and is only forwarded downstream; callers
+	// without one (e.g. batch items) fall back to the request_id.
+	requestID := req.RequestID
+	if logging.RequestID(ctx) == "" && requestID != "" {
+		ctx = logging.WithRequestID(ctx, requestID)
+	}
+
+	// A retried request that already completed gets its earlier question
+	// back rather than a second generation
+	if requestID != "" {
+		response, err := gs.replayCompleted(ctx, requestID)
+		if err == nil {
+			response.RequestID = req.RequestID
+			return response, nil
+		}
+		if !errors.Is(err, db.ErrGenerationLogNotFound) && !errors.Is(err, db.ErrQuestionNotFound) {
+			logging.FromContext(ctx).Warnw("idempotency lookup failed, generating anew", "error", err)
+		}
+		// One waiting for a background retry is refused until the retry
+		// completes; generating it again would race the retry for the
+		// request_id
+		if nextAttemptAt, ok, err := gs.retryInFlight(ctx, requestID); ok {
+			return nil, fmt.Errorf("%w for request %s, next attempt at %s",
+				ErrRetryInProgress, requestID, nextAttemptAt.Format(time.RFC3339))
+		} else if err != nil {
+			logging.FromContext(ctx).Warnw("retry lookup failed, generating anew", "error", err)
+		}
+	}
 	
+	// The question ID is fixed up front so the log row can be found from
+	// the ID a client reports, even when generation fails
+	questionID := fmt.Sprintf("q_%s_%d", req.RequestID, time.Now().UnixNano())
+
 	// Initialize generation log for tracking
 	genLog := &db.GenerationLog{
+		QuestionID:          questionID,
 		StudentID:           req.StudentID,
 		SessionID:           req.SessionID,
-		RequestID:           req.RequestID,
+		RequestID:           requestID,
 		TopicID:             req.TopicID,
 		ExamType:            req.ExamType,
 		Subject:             req.Subject,
@@ -114,135 +278,245 @@ func (gs *GeneratorService) GenerateQuestion(ctx context.Context, req *GenerateQ
 		Status:              "PENDING",
 		GeneratorVersion:    "v1.0.0",
 		ModelVersion:        "template-v1",
+		StageOverrides:      req.stageOverrides(),
+	}
+	if len(genLog.StageOverrides) > 0 {
+		logging.FromContext(ctx).Infow("request switched stages off", "stage_overrides", []string(genLog.StageOverrides))
 	}
 
 	// Create generation log entry
 	if err := gs.logger.CreateGenerationLog(ctx, genLog); err != nil {
-		log.Printf("Failed to create generation log: %v", err)
+		logging.FromContext(ctx).Warnw("failed to create generation log", "error", err)
 		// Continue execution even if logging fails
 	}
 
-	// Step 1: Load and select appropriate template
-	templateStart := time.Now()
-	template, err := gs.templateSvc.SelectTemplate(ctx, templates.TemplateSelection{
-		TopicID:       req.TopicID,
-		ExamType:      req.ExamType,
-		Subject:       req.Subject,
-		Format:        req.Format,
-		MinDifficulty: req.RequestedDifficulty - 0.1,
-		MaxDifficulty: req.RequestedDifficulty + 0.1,
-	})
-	if err != nil {
-		return gs.handleGenerationError(ctx, genLog, "TEMPLATE_SELECTION_FAILED", err)
+	// Every attempt derives its variables from the effective seed, so
+	// replaying a request with the returned seed reproduces the question
+	seed := req.Seed
+	for seed == 0 {
+		seed = rand.Int63()
 	}
-	templateTime := time.Since(templateStart)
 
-	genLog.TemplateID = &template.TemplateID
-	genLog.Status = "TEMPLATE_SELECTED"
+	response, err := gs.runGeneration(ctx, req, genLog, seed, startTime)
+	if err != nil && gs.retries != nil && IsTransient(err) {
+		gs.retries.schedule(ctx, req, genLog, seed)
+	}
+	return response, err
+}
 
-	// Step 2: Calibrate difficulty using BKT
-	calibrationStart := time.Now()
-	calibratedDifficulty, masteryLevel, err := gs.calibrator.CalibrateDifficulty(ctx, calibrator.CalibrationRequest{
-		StudentID:           req.StudentID,
-		TopicID:             req.TopicID,
-		RequestedDifficulty: req.RequestedDifficulty,
-		BaseDifficulty:      template.BaseDifficulty,
-	})
-	if err != nil {
-		return gs.handleGenerationError(ctx, genLog, "CALIBRATION_FAILED", err)
+// runGeneration runs the pipeline for req from template selection onwards,
+// recording progress and the outcome on genLog. Background retries re-run
+// it with the same log row and seed.
+func (gs *GeneratorService) runGeneration(ctx context.Context, req *GenerateQuestionRequest, genLog *db.GenerationLog, seed int64, startTime time.Time) (*GenerateQuestionResponse, error) {
+	// Steps 1-4 run once per attempt, avoiding templates this session was
+	// recently served; retries also prefer a template not tried yet. A
+	// candidate too similar to a question the student was recently served
+	// is regenerated from another template before it counts as an attempt,
+	// since other numbers in the same template would still look alike.
+	var candidates []*generationCandidate
+	var duplicates []string // Why near-duplicate candidates were regenerated
+	draws := 0              // Candidates generated so far, each from the next seed
+	recentKey := recentTemplatesKey(req)
+	avoidTemplates := gs.recent.Recent(recentKey)
+	timer := &stageTimer{timeouts: gs.cfg.Stages}
+
+	// Candidates are generated and checked within the latency budget; the
+	// question is recorded and served under ctx even once it has run out
+	budgetCtx, cancelBudget := gs.withLatencyBudget(ctx, startTime)
+	defer cancelBudget()
+	generate := func(ctx context.Context, attempt int) (*rag_advisor.QualityCheckRequest, error) {
+		var candidate *generationCandidate
+		candidateReq := req
+		for regenerations := 0; ; regenerations++ {
+			next, err := gs.generateCandidate(ctx, timer, candidateReq, avoidTemplates, seed+int64(draws))
+			draws++
+			if err != nil {
+				if candidate != nil {
+					metrics.IncrementDuplicateQuestions("served")
+					break // Serve the duplicate rather than nothing
+				}
+				return nil, err
+			}
+			candidate = next
+			avoidTemplates = append(avoidTemplates, candidate.template.TemplateID)
+
+			similar := gs.findDuplicate(ctx, req, candidate)
+			if similar == nil {
+				break
+			}
+			if regenerations >= gs.cfg.Duplicates.MaxRegenerations {
+				metrics.IncrementDuplicateQuestions("served")
+				break
+			}
+			metrics.IncrementDuplicateQuestions("regenerated")
+			duplicates = append(duplicates, fmt.Sprintf("template %s was %.2f similar to question %s",
+				candidate.template.TemplateID, similar.Similarity, similar.QuestionID))
+			skipping := *candidateReq
+			skipping.SkipTemplateIDs = append(append([]string(nil), candidateReq.SkipTemplateIDs...), candidate.template.TemplateID)
+			candidateReq = &skipping
+		}
+		candidates = append(candidates, candidate)
+
+		return &rag_advisor.QualityCheckRequest{
+			QuestionText:   candidate.question.QuestionText,
+			Options:        candidate.question.Options,
+			Subject:        req.Subject,
+			ExamType:       req.ExamType,
+			TopicID:        req.TopicID,
+			BaseDiff:       candidate.template.BaseDifficulty,
+			IncludeExemplars: true,
+		}, nil
 	}
-	calibrationTime := time.Since(calibrationStart)
 
-	genLog.CalibratedDifficulty = &calibratedDifficulty
-	genLog.BKTMasteryLevel = &masteryLevel
-	genLog.CalibrationTimeMs = int(calibrationTime.Milliseconds())
-	genLog.Status = "CALIBRATED"
+	// Step 5: RAG advisor quality check (if enabled), regenerating while
+	// alignment stays below threshold
+	var ragTime time.Duration
+	var regeneration *rag_advisor.RegenerationResult
+	var err error
+	var threshold float64
 
-	// Step 3: Generate question from template
-	generationStart := time.Now()
-	generatedQuestion, err := gs.templateSvc.FillTemplate(ctx, templates.TemplateFillRequest{
-		Template:           template,
-		CalibratedDifficulty: calibratedDifficulty,
-		StudentContext:     req.StudentID,
-	})
+	if gs.ragAdvisor != nil && !req.SkipRAG {
+		check := func(ctx context.Context, qr *rag_advisor.QualityCheckRequest) (*rag_advisor.QualityCheckResponse, error) {
+			ragStart := time.Now()
+			defer func() { ragTime += time.Since(ragStart) }()
+			metrics.IncrementRAGChecks()
+			// A RAG timeout only fails this check, so generation carries on
+			// without it
+			stageCtx, stop := timer.start(ctx, stageRAG)
+			defer stop()
+			return gs.ragAdvisor.CheckQuestionQuality(stageCtx, qr)
+		}
+		threshold = gs.ragAdvisor.ThresholdFor(req.Subject)
+		regeneration, err = rag_advisor.RegenerateUntilAligned(budgetCtx, gs.cfg.RAG.MaxRetries, threshold, generate, check)
+	} else {
+		_, err = generate(budgetCtx, 1)
+	}
+	genLog.TimedOutStages = timer.timedOut
+	budgetExceeded := budgetCtx.Err() != nil && ctx.Err() == nil
+	if budgetExceeded {
+		if len(candidates) > 0 {
+			// The first RAG check was cut short; serve the question unchecked
+			err = nil
+		} else if err != nil {
+			err = fmt.Errorf("%w after %s: %w", ErrLatencyBudgetExceeded, gs.cfg.Stages.MaxGenerationLatency, err)
+		}
+	}
 	if err != nil {
-		return gs.handleGenerationError(ctx, genLog, "GENERATION_FAILED", err)
+		if errors.Is(err, templates.ErrNoTemplatesFound) {
+			metrics.IncrementContentGaps(req.ExamType, req.Subject, req.TopicID)
+		}
+		return gs.handleGenerationError(ctx, genLog, candidateStage(err), err)
 	}
-	generationTime := time.Since(generationStart)
 
+	// Use the best-scoring candidate, or the latest one if RAG never scored
+	chosen := candidates[len(candidates)-1]
+	var ragResult *rag_advisor.QualityCheckResponse
+	if regeneration != nil {
+		if best := regeneration.Best(); best != nil {
+			chosen = candidates[best.Number-1]
+			ragResult = best.Response
+		} else if n := len(regeneration.Attempts); n > 0 && regeneration.Attempts[n-1].Err != nil {
+			logging.FromContext(ctx).Warnw("RAG advisor check failed (non-critical)", "error", regeneration.Attempts[n-1].Err)
+			// RAG failure is non-critical, continue with generation
+		}
+	}
+
+	// Out of budget, the RAG check or further regeneration were given up
+	if budgetExceeded && regeneration != nil {
+		switch {
+		case ragResult == nil:
+			genLog.SkippedStages = append(genLog.SkippedStages, stageRAG)
+		case !regeneration.Aligned && len(regeneration.Attempts) <= gs.cfg.RAG.MaxRetries:
+			genLog.SkippedStages = append(genLog.SkippedStages, stageRegeneration)
+		}
+		logging.FromContext(ctx).Warnw("generation latency budget ran out, serving the best question so far",
+			"budget", gs.cfg.Stages.MaxGenerationLatency, "skipped_stages", []string(genLog.SkippedStages))
+	}
+
+	template := chosen.template
+	gs.recent.Add(recentKey, template.TemplateID)
+	calibratedDifficulty := chosen.calibratedDifficulty
+	masteryLevel := chosen.masteryLevel
+	generatedQuestion := chosen.question
+	validationResult := chosen.validation
+
+	genLog.TemplateID = &template.TemplateID
+	genLog.DifficultyBand = &chosen.difficultyBand
+	genLog.FallbackExamType = chosen.fallbackExamType
+	genLog.CalibratedDifficulty = &calibratedDifficulty
+	genLog.BKTMasteryLevel = &masteryLevel
+	genLog.CalibrationTimeMs = int(chosen.calibrationTime.Milliseconds())
+	genLog.CalibrationSource = string(chosen.calibrationSource)
+	genLog.CalibrationFallback = string(chosen.calibrationFallback)
+	if chosen.calibrationSource == calibrator.SourceBKT {
+		genLog.BKTConfidence = &chosen.confidence
+	}
+	genLog.BKTRecommendation = chosen.recommendation
 	genLog.GeneratedQuestionText = generatedQuestion.QuestionText
 	genLog.GeneratedOptions = generatedQuestion.Options
 	genLog.CorrectAnswer = generatedQuestion.CorrectAnswer
 	genLog.SolutionSteps = generatedQuestion.SolutionSteps
 	genLog.TemplateVariables = generatedQuestion.VariableValues
-	genLog.GenerationTimeMs = int(generationTime.Milliseconds())
-	genLog.Status = "GENERATED"
-
-	// Step 4: Validate generated question
-	validationStart := time.Now()
-	validationResult, err := gs.validator.ValidateQuestion(ctx, validator.ValidationRequest{
-		QuestionText:  generatedQuestion.QuestionText,
-		Options:       generatedQuestion.Options,
-		CorrectAnswer: generatedQuestion.CorrectAnswer,
-		Subject:       req.Subject,
-		ExamType:      req.ExamType,
-	})
-	if err != nil {
-		return gs.handleGenerationError(ctx, genLog, "VALIDATION_FAILED", err)
+	genLog.GenerationTimeMs = int(chosen.generationTime.Milliseconds())
+	if !chosen.unvalidated {
+		genLog.GrammarScore = &validationResult.GrammarScore
+		genLog.ClarityScore = &validationResult.ClarityScore
+		genLog.AmbiguityScore = &validationResult.AmbiguityScore
 	}
-	validationTime := time.Since(validationStart)
-
-	genLog.GrammarScore = &validationResult.GrammarScore
-	genLog.ClarityScore = &validationResult.ClarityScore
-	genLog.AmbiguityScore = &validationResult.AmbiguityScore
 	genLog.ValidatorFeedback = validationResult.Feedback
 	genLog.ValidationPassed = validationResult.Passed
-	genLog.ValidationTimeMs = int(validationTime.Milliseconds())
+	genLog.ValidationTimeMs = int(chosen.validationTime.Milliseconds())
 	genLog.Status = "VALIDATED"
 
-	// Step 5: RAG advisor quality check (if enabled)
-	var ragTime time.Duration
 	var finalQualityScore float64 = validationResult.OverallScore
 
-	if gs.ragAdvisor != nil {
-		ragStart := time.Now()
-		ragResult, err := gs.ragAdvisor.CheckQuestionQuality(ctx, rag_advisor.QualityCheckRequest{
-			QuestionText:    generatedQuestion.QuestionText,
-			Options:         generatedQuestion.Options,
-			Subject:         req.Subject,
-			ExamType:        req.ExamType,
-			TopicID:         req.TopicID,
-			BaseDifficulty:  template.BaseDifficulty,
-		})
-		if err != nil {
-			log.Printf("RAG advisor check failed (non-critical): %v", err)
-			// RAG failure is non-critical, continue with generation
-		} else {
-			ragTime = time.Since(ragStart)
-			
+	if regeneration != nil {
+		for i, attempt := range regeneration.Attempts {
+			record := db.RegenerationAttempt{
+				Attempt:        attempt.Number,
+				TemplateID:     candidates[i].template.TemplateID,
+				AlignmentScore: attempt.AlignmentScore,
+			}
+			if attempt.Err != nil {
+				record.Error = attempt.Err.Error()
+			}
+			genLog.RegenerationAttempts = append(genLog.RegenerationAttempts, record)
+		}
+		genLog.RetryCount += len(regeneration.Attempts) - 1
+		genLog.RAGTimeMs = int(ragTime.Milliseconds())
+
+		if ragResult != nil {
 			genLog.RAGAlignmentScore = &ragResult.AlignmentScore
 			genLog.RAGExemplarIDs = ragResult.ExemplarIDs
+			for _, exemplar := range ragResult.Exemplars {
+				genLog.RAGExemplars = append(genLog.RAGExemplars, db.RAGExemplar(exemplar))
+			}
 			genLog.RAGFeedback = ragResult.Feedback
-			genLog.RAGTimeMs = int(ragTime.Milliseconds())
-
-			// Check if regeneration is needed
-			if ragResult.AlignmentScore < gs.cfg.RAG.AlignmentThreshold {
-				genLog.RegenerationTriggered = true
-				genLog.RegenerationReason = fmt.Sprintf("RAG alignment score %.3f below threshold %.3f", 
-					ragResult.AlignmentScore, gs.cfg.RAG.AlignmentThreshold)
-				
-				// Trigger regeneration (simplified for Phase 2.1)
-				log.Printf("Question regeneration triggered for request %s: %s", 
-					req.RequestID, genLog.RegenerationReason)
+
+			if len(regeneration.Attempts) > 1 || !regeneration.Aligned {
+				genLog.RegenerationTriggered = len(regeneration.Attempts) > 1
+				genLog.RegenerationReason = fmt.Sprintf("RAG alignment score %.3f after %d attempt(s), threshold %.3f",
+					ragResult.AlignmentScore, len(regeneration.Attempts), threshold)
+				logging.FromContext(ctx).Infow("question regenerated",
+					"attempts", len(regeneration.Attempts), "reason", genLog.RegenerationReason)
 			}
 
 			// Combine RAG and validation scores for final quality
 			finalQualityScore = (validationResult.OverallScore + ragResult.AlignmentScore) / 2.0
 		}
-		
+
 		genLog.Status = "RAG_CHECKED"
 	}
 
+	if len(duplicates) > 0 {
+		genLog.RegenerationTriggered = true
+		reason := "near-duplicate: " + strings.Join(duplicates, "; ")
+		if genLog.RegenerationReason != "" {
+			reason = genLog.RegenerationReason + "; " + reason
+		}
+		genLog.RegenerationReason = reason
+	}
+
 	// Calculate total pipeline time
 	totalTime := time.Since(startTime)
 	genLog.FinalQualityScore = &finalQualityScore
@@ -251,23 +525,31 @@ func (gs *GeneratorService) GenerateQuestion(ctx context.Context, req *GenerateQ
 
 	// Update generation log with final results
 	if err := gs.logger.UpdateGenerationLog(ctx, genLog); err != nil {
-		log.Printf("Failed to update generation log: %v", err)
+		logging.FromContext(ctx).Warnw("failed to update generation log", "error", err)
 		// Continue execution even if logging fails
 	}
 
 	// Increment template usage counter
 	if err := gs.dbClient.IncrementTemplateUsage(ctx, template.TemplateID); err != nil {
-		log.Printf("Failed to increment template usage: %v", err)
+		logging.FromContext(ctx).Warnw("failed to increment template usage",
+			"template_id", template.TemplateID, "error", err)
 		// Non-critical error, continue
 	}
 
 	// Build response
+	renderFormat, _ := generatedQuestion.Metadata["render_format"].(string)
 	response := &GenerateQuestionResponse{
-		QuestionID:     fmt.Sprintf("q_%s_%d", req.RequestID, time.Now().UnixNano()),
+		QuestionID:     genLog.QuestionID,
+		RequestID:      req.RequestID,
 		QuestionText:   generatedQuestion.QuestionText,
 		Options:        generatedQuestion.Options,
 		CorrectAnswer:  generatedQuestion.CorrectAnswer,
 		SolutionSteps:  generatedQuestion.SolutionSteps,
+		AssertionReason: generatedQuestion.AssertionReason,
+		MatrixMatch:    generatedQuestion.MatrixMatch,
+		Passage:        generatedQuestion.Passage,
+		Bodies:         generatedQuestion.Bodies,
+		RenderFormat:   renderFormat,
 		Difficulty:     calibratedDifficulty,
 		GenerationTime: totalTime.Milliseconds(),
 		QualityScore:   finalQualityScore,
@@ -276,11 +558,14 @@ func (gs *GeneratorService) GenerateQuestion(ctx context.Context, req *GenerateQ
 			"mastery_level":       masteryLevel,
 			"validation_passed":   validationResult.Passed,
 			"generation_log_id":   genLog.ID,
+			"generation_attempts": len(candidates),
+			"seed":                seed,
+			"render_format":       renderFormat,
 			"pipeline_breakdown": map[string]int64{
-				"template_ms":    templateTime.Milliseconds(),
-				"calibration_ms": calibrationTime.Milliseconds(),
-				"generation_ms":  generationTime.Milliseconds(),
-				"validation_ms":  validationTime.Milliseconds(),
+				"template_ms":    chosen.templateTime.Milliseconds(),
+				"calibration_ms": chosen.calibrationTime.Milliseconds(),
+				"generation_ms":  chosen.generationTime.Milliseconds(),
+				"validation_ms":  chosen.validationTime.Milliseconds(),
 				"rag_ms":         ragTime.Milliseconds(),
 			},
 		},
@@ -289,10 +574,440 @@ func (gs *GeneratorService) GenerateQuestion(ctx context.Context, req *GenerateQ
 	if gs.ragAdvisor != nil && genLog.RAGAlignmentScore != nil {
 		response.Metadata["rag_alignment_score"] = *genLog.RAGAlignmentScore
 	}
+	if chosen.calibrationFallback != "" {
+		response.Metadata["calibration_fallback"] = string(chosen.calibrationFallback)
+	} else {
+		response.Metadata["calibration_confidence"] = chosen.confidence
+	}
+	if chosen.recommendation != "" {
+		response.Metadata["calibration_recommendation"] = chosen.recommendation
+	}
+	if chosen.difficultyBand > config.DifficultyBandStep {
+		response.Metadata["difficulty_band"] = chosen.difficultyBand
+	}
+	if chosen.fallbackExamType != "" {
+		response.Metadata["fallback_exam_type"] = chosen.fallbackExamType
+	}
+	if req.Language != "" {
+		response.Metadata["language"] = req.Language
+	}
+	if chosen.unvalidated && !req.SkipValidation {
+		response.Metadata["validation_error"] = validationResult.Feedback
+	}
+	if len(genLog.StageOverrides) > 0 {
+		response.Metadata["stage_overrides"] = []string(genLog.StageOverrides)
+	}
+	if len(genLog.SkippedStages) > 0 {
+		response.Metadata["skipped_stages"] = []string(genLog.SkippedStages)
+	}
+	flags := reviewFlags(req, chosen, regeneration, ragResult, threshold)
+	if len(flags) > 0 {
+		reasons := make([]string, 0, len(flags))
+		for _, flag := range flags {
+			reasons = append(reasons, flag.Reason)
+		}
+		response.Metadata["review_flags"] = reasons
+	}
+	if req.Debug {
+		response.Metadata["validation_breakdown"] = newValidationBreakdown(validationResult, ragResult)
+		if ragResult != nil {
+			response.Metadata["rag_exemplars"] = ragResult.Exemplars
+		}
+	}
+
+	// Persist the served question so clients can fetch it again by ID
+	if err := gs.dbClient.SaveGeneratedQuestion(ctx, &db.GeneratedQuestion{
+		QuestionID:    response.QuestionID,
+		TemplateID:    template.TemplateID,
+		StudentID:     req.StudentID,
+		RequestID:     req.RequestID,
+		QuestionText:  response.QuestionText,
+		Options:       response.Options,
+		CorrectAnswer: response.CorrectAnswer,
+		SolutionSteps: response.SolutionSteps,
+		RenderFormat:  renderFormat,
+		Difficulty:    calibratedDifficulty,
+		Seed:          chosen.seed,
+	}); err != nil {
+		logging.FromContext(ctx).Warnw("failed to save generated question",
+			"question_id", response.QuestionID, "error", err)
+		// Non-critical error, the question is still returned
+	} else {
+		// Only a stored question counts as served for the cool-down
+		gs.templateSvc.TemplateServed(template.TemplateID)
+		// Flags refer to the stored question
+		gs.flagForReview(ctx, response.QuestionID, template.TemplateID, flags)
+	}
+
+	if breakdown, ok := response.Metadata["pipeline_breakdown"].(map[string]int64); ok {
+		metrics.ObservePipelineBreakdown(breakdown)
+	}
 
 	return response, nil
 }
 
+// replayCompleted rebuilds the response of the generation that completed
+// for requestID from its log row and stored question
+func (gs *GeneratorService) replayCompleted(ctx context.Context, requestID string) (*GenerateQuestionResponse, error) {
+	genLog, err := gs.dbClient.GetCompletedGenerationLogByRequestID(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	question, err := gs.dbClient.GetGeneratedQuestion(ctx, genLog.QuestionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var qualityScore float64
+	if genLog.FinalQualityScore != nil {
+		qualityScore = *genLog.FinalQualityScore
+	}
+	logging.FromContext(ctx).Infow("replaying completed generation", "question_id", question.QuestionID)
+	metrics.IncrementIdempotentReplays()
+
+	return &GenerateQuestionResponse{
+		QuestionID:     question.QuestionID,
+		QuestionText:   question.QuestionText,
+		Options:        question.Options,
+		CorrectAnswer:  question.CorrectAnswer,
+		SolutionSteps:  question.SolutionSteps,
+		RenderFormat:   question.RenderFormat,
+		Difficulty:     question.Difficulty,
+		GenerationTime: int64(genLog.TotalPipelineTimeMs),
+		QualityScore:   qualityScore,
+		Metadata: map[string]interface{}{
+			"template_id":       question.TemplateID,
+			"generation_log_id": genLog.ID,
+			"seed":              question.Seed,
+			"render_format":     question.RenderFormat,
+			"idempotent_replay": true,
+		},
+		Replayed: true,
+	}, nil
+}
+
+// retryInFlight reports whether requestID has a background retry waiting
+// or running, on this replica or, as a RETRY_PENDING log row, any other,
+// and when it is next attempted
+func (gs *GeneratorService) retryInFlight(ctx context.Context, requestID string) (time.Time, bool, error) {
+	if gs.retries == nil {
+		return time.Time{}, false, nil
+	}
+	if nextAttemptAt, ok := gs.retries.inFlight(requestID); ok {
+		return nextAttemptAt, true, nil
+	}
+	return gs.dbClient.GetPendingGenerationRetry(ctx, requestID)
+}
+
+// stageOverrides lists the stages the request switches off, as recorded in
+// the log's stage_overrides
+func (req *GenerateQuestionRequest) stageOverrides() []string {
+	var stages []string
+	if req.SkipRAG {
+		stages = append(stages, stageRAG)
+	}
+	if req.SkipValidation {
+		stages = append(stages, stageValidation)
+	}
+	return stages
+}
+
+// recentTemplatesKey identifies whose recent templates to avoid: the session
+// when given, otherwise the student
+func recentTemplatesKey(req *GenerateQuestionRequest) string {
+	if req.SessionID != "" {
+		return "session:" + req.SessionID
+	}
+	return "student:" + req.StudentID
+}
+
+// difficultyBands lists the ± bands around the requested difficulty that
+// template selection tries in turn, from DifficultyBandStep up to the
+// configured maximum
+func (gs *GeneratorService) difficultyBands() []float64 {
+	bands := []float64{config.DifficultyBandStep}
+	steps := int(math.Round(gs.cfg.Templates.MaxDifficultyBand / config.DifficultyBandStep))
+	for i := 2; i <= steps; i++ {
+		bands = append(bands, math.Round(float64(i)*config.DifficultyBandStep*100)/100)
+	}
+	return bands
+}
+
+// generateCandidate runs template selection, calibration, generation and
+// validation once, avoiding the excluded templates when alternatives exist
+// and filling template variables from seed
+func (gs *GeneratorService) generateCandidate(ctx context.Context, timer *stageTimer, req *GenerateQuestionRequest, excludeTemplateIDs []string, seed int64) (*generationCandidate, error) {
+	candidate := &generationCandidate{seed: seed}
+
+	// Step 1: Load and select appropriate template, widening the difficulty
+	// band step by step while no template matches, and only then turning to
+	// the fallback exam types, each searched band by band in turn
+	templateStart := time.Now()
+	var template *db.QuestionTemplate
+	var err error
+	examTypes := gs.templateSvc.ExamTypes(req.ExamType)
+	bands := gs.difficultyBands()
+	templateCtx, stopTemplate := timer.start(ctx, stageTemplate)
+selection:
+	for _, examType := range examTypes {
+		for _, band := range bands {
+			template, err = gs.templateSvc.SelectTemplate(templateCtx, templates.TemplateSelection{
+				TopicID:            req.TopicID,
+				ExamType:           examType,
+				Subject:            req.Subject,
+				Format:             req.Format,
+				MinDifficulty:      req.RequestedDifficulty - band,
+				MaxDifficulty:      req.RequestedDifficulty + band,
+				ExcludeTemplateIDs: excludeTemplateIDs,
+				SkipTemplateIDs:    req.SkipTemplateIDs,
+				Seed:               seed,
+				Language:           req.Language,
+			})
+			candidate.difficultyBand = band
+			if err == nil || !errors.Is(err, templates.ErrNoTemplatesFound) {
+				break selection
+			}
+		}
+	}
+	stopTemplate()
+	if err != nil {
+		if errors.Is(err, templates.ErrNoTemplatesFound) {
+			if len(bands) > 1 {
+				err = fmt.Errorf("%w (difficulty band widened to ±%.1f)", err, candidate.difficultyBand)
+			}
+			if len(examTypes) > 1 {
+				err = fmt.Errorf("%w (exam types tried: %s)", err, strings.Join(examTypes, ", "))
+			}
+		}
+		return nil, &candidateError{stage: "TEMPLATE_SELECTION_FAILED", err: err}
+	}
+	if candidate.difficultyBand > config.DifficultyBandStep {
+		logging.FromContext(ctx).Infow("widened difficulty band to find a template",
+			"band", candidate.difficultyBand, "template_id", template.TemplateID)
+	}
+	if req.ExamType != "" && template.ExamType != req.ExamType {
+		candidate.fallbackExamType = template.ExamType
+		logging.FromContext(ctx).Infow("served a fallback exam type's template",
+			"exam_type", req.ExamType, "fallback_exam_type", template.ExamType, "template_id", template.TemplateID)
+	}
+	candidate.template = template
+	candidate.templateTime = time.Since(templateStart)
+
+	// Step 2: Calibrate difficulty using BKT, falling back to rules when
+	// BKT runs out of stage time
+	calibrationStart := time.Now()
+	calibrationReq := calibrator.CalibrationRequest{
+		StudentID:           req.StudentID,
+		TopicID:             req.TopicID,
+		RequestedDifficulty: req.RequestedDifficulty,
+		BaseDifficulty:      template.BaseDifficulty,
+		BloomLevel:          template.BloomLevel,
+	}
+	calibrationCtx, stopCalibration := timer.start(ctx, stageCalibration)
+	calibration, err := gs.calibrator.CalibrateDifficulty(calibrationCtx, calibrationReq)
+	if timedOut := stopCalibration(); timedOut && err != nil {
+		calibration, err = gs.calibrator.FallbackCalibration(calibrationReq), nil
+	}
+	if err != nil {
+		return nil, &candidateError{stage: "CALIBRATION_FAILED", err: err}
+	}
+	candidate.calibratedDifficulty = calibration.Difficulty
+	candidate.masteryLevel = calibration.Mastery
+	candidate.calibrationSource = calibration.Source
+	candidate.calibrationFallback = calibration.Fallback
+	candidate.confidence = calibration.Confidence
+	candidate.recommendation = calibration.Recommendation
+	candidate.calibrationTime = time.Since(calibrationStart)
+
+	// Step 3: Generate question from template
+	generationStart := time.Now()
+	generationCtx, stopGeneration := timer.start(ctx, stageGeneration)
+	candidate.question, err = gs.templateSvc.FillTemplate(generationCtx, templates.TemplateFillRequest{
+		Template:             template,
+		CalibratedDifficulty: candidate.calibratedDifficulty,
+		StudentContext:       req.StudentID,
+		RandomSeed:           seed,
+		Language:             req.Language,
+	})
+	stopGeneration()
+	if err != nil {
+		return nil, &candidateError{stage: "GENERATION_FAILED", err: err}
+	}
+	candidate.generationTime = time.Since(generationStart)
+
+	// Step 4: Validate generated question, unless the request skips it
+	if req.SkipValidation {
+		candidate.validation = skippedValidationResult()
+		candidate.unvalidated = true
+		return candidate, nil
+	}
+	validationStart := time.Now()
+	var answerUnit string
+	if template.AnswerUnit != nil {
+		answerUnit = *template.AnswerUnit
+	}
+	validationCtx, stopValidation := timer.start(ctx, stageValidation)
+	candidate.validation, err = gs.validator.ValidateQuestion(validationCtx, validator.ValidationRequest{
+		QuestionText:    candidate.question.QuestionText,
+		Options:         candidate.question.Options,
+		CorrectAnswer:   candidate.question.CorrectAnswer,
+		ExpectedUnit:    answerUnit,
+		AnswerPrecision: template.AnswerPrecision,
+		Format:          template.Format,
+		Subject:         req.Subject,
+		ExamType:        req.ExamType,
+	})
+	stopValidation()
+	if err != nil {
+		if !gs.lenientValidation(ctx) {
+			return nil, &candidateError{stage: "VALIDATION_FAILED", err: err}
+		}
+		logging.FromContext(ctx).Warnw("validation failed, serving the question unvalidated", "template_id", template.TemplateID, "error", err)
+		candidate.validation = unvalidatedResult(err)
+		candidate.unvalidated = true
+	}
+	candidate.validationTime = time.Since(validationStart)
+
+	return candidate, nil
+}
+
+// findDuplicate returns the question recently served to the student that
+// is most similar to candidate, or nil when none reaches the duplicate
+// threshold or the check is disabled. Failed lookups count as no duplicate.
+func (gs *GeneratorService) findDuplicate(ctx context.Context, req *GenerateQuestionRequest, candidate *generationCandidate) *db.SimilarQuestion {
+	if !gs.cfg.Duplicates.Enabled {
+		return nil
+	}
+	similar, err := gs.dbClient.FindSimilarQuestions(ctx, db.SimilarQuestionQuery{
+		StudentID:     req.StudentID,
+		QuestionText:  candidate.question.QuestionText,
+		Since:         time.Now().Add(-gs.cfg.Duplicates.Window),
+		MinSimilarity: gs.cfg.Duplicates.Threshold,
+		Limit:         1,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Warnw("duplicate check failed (non-critical)", "error", err)
+		return nil
+	}
+	if len(similar) == 0 {
+		return nil
+	}
+	return &similar[0]
+}
+
+// GetQuestion returns a previously generated question by its question_id
+func (gs *GeneratorService) GetQuestion(ctx context.Context, questionID string) (*db.GeneratedQuestion, error) {
+	return gs.dbClient.GetGeneratedQuestion(ctx, questionID)
+}
+
+// QueryGenerationLogs lists recent generation logs for inspection
+func (gs *GeneratorService) QueryGenerationLogs(ctx context.Context, filters db.GenerationLogFilters) (*db.GenerationLogPage, error) {
+	return gs.dbClient.QueryGenerationLogs(ctx, filters)
+}
+
+// GetQualityTrends aggregates generation quality over time for dashboards
+func (gs *GeneratorService) GetQualityTrends(ctx context.Context, filters db.QualityTrendFilters) ([]db.QualityTrendBucket, error) {
+	return gs.dbClient.GetQualityTrends(ctx, filters)
+}
+
+// TemplatePreviewRequest selects the template and inputs for a dry run
+type TemplatePreviewRequest struct {
+	TemplateID string
+	Difficulty float64 // Template base difficulty when zero
+	Seed       int64   // Random when zero
+}
+
+// TemplatePreviewResponse is a filled and validated template that was
+// neither logged nor counted as served
+type TemplatePreviewResponse struct {
+	TemplateID      string                      `json:"template_id"`
+	QuestionText    string                      `json:"question_text"`
+	Options         map[string]string           `json:"options,omitempty"`
+	CorrectAnswer   string                      `json:"correct_answer"`
+	SolutionSteps   []string                    `json:"solution_steps,omitempty"`
+	AssertionReason *templates.AssertionReason  `json:"assertion_reason,omitempty"`
+	MatrixMatch     *templates.MatrixMatch      `json:"matrix_match,omitempty"`
+	Passage         *templates.Passage          `json:"passage,omitempty"`
+	RenderFormat    string                      `json:"render_format"`
+	Variables       map[string]interface{}      `json:"variables"`
+	Difficulty      float64                     `json:"difficulty"`
+	Seed            int64                       `json:"seed"`
+	Validation      *validator.ValidationResult `json:"validation"`
+}
+
+// PreviewTemplate fills and validates a single template for authoring. It
+// skips BKT calibration, generation logging and usage counting, so the only
+// database access is the template read, which bypasses the template cache
+// so that authors see their latest edit.
+func (gs *GeneratorService) PreviewTemplate(ctx context.Context, req TemplatePreviewRequest) (*TemplatePreviewResponse, error) {
+	template, err := gs.dbClient.GetQuestionTemplateUncached(ctx, req.TemplateID)
+	if err != nil {
+		return nil, err
+	}
+
+	difficulty := req.Difficulty
+	if difficulty == 0 {
+		difficulty = template.BaseDifficulty
+	}
+	seed := req.Seed
+	for seed == 0 {
+		seed = rand.Int63()
+	}
+
+	question, err := gs.templateSvc.FillTemplate(ctx, templates.TemplateFillRequest{
+		Template:             template,
+		CalibratedDifficulty: difficulty,
+		RandomSeed:           seed,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fill template %s: %w", template.TemplateID, err)
+	}
+
+	var answerUnit string
+	if template.AnswerUnit != nil {
+		answerUnit = *template.AnswerUnit
+	}
+	validation, err := gs.validator.ValidateQuestion(ctx, validator.ValidationRequest{
+		QuestionText:    question.QuestionText,
+		Options:         question.Options,
+		CorrectAnswer:   question.CorrectAnswer,
+		ExpectedUnit:    answerUnit,
+		AnswerPrecision: template.AnswerPrecision,
+		Format:          template.Format,
+		Subject:         template.Subject,
+		ExamType:        template.ExamType,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate template %s: %w", template.TemplateID, err)
+	}
+
+	renderFormat, _ := question.Metadata["render_format"].(string)
+	return &TemplatePreviewResponse{
+		TemplateID:      template.TemplateID,
+		QuestionText:    question.QuestionText,
+		Options:         question.Options,
+		CorrectAnswer:   question.CorrectAnswer,
+		SolutionSteps:   question.SolutionSteps,
+		AssertionReason: question.AssertionReason,
+		MatrixMatch:     question.MatrixMatch,
+		Passage:         question.Passage,
+		RenderFormat:    renderFormat,
+		Variables:       question.VariableValues,
+		Difficulty:      difficulty,
+		Seed:            seed,
+		Validation:      validation,
+	}, nil
+}
+
+// candidateStage extracts the failing pipeline stage from a generation error
+func candidateStage(err error) string {
+	var ce *candidateError
+	if errors.As(err, &ce) {
+		return ce.stage
+	}
+	return "GENERATION_FAILED"
+}
+
 // handleGenerationError handles pipeline errors and updates logs
 func (gs *GeneratorService) handleGenerationError(ctx context.Context, genLog *db.GenerationLog, status string, err error) (*GenerateQuestionResponse, error) {
 	genLog.Status = "FAILED"
@@ -300,7 +1015,7 @@ func (gs *GeneratorService) handleGenerationError(ctx context.Context, genLog *d
 	
 	// Update log with error details
 	if updateErr := gs.logger.UpdateGenerationLog(ctx, genLog); updateErr != nil {
-		log.Printf("Failed to update generation log with error: %v", updateErr)
+		logging.FromContext(ctx).Warnw("failed to update generation log with error", "error", updateErr)
 	}
 	
 	return nil, fmt.Errorf("question generation failed at %s: %w", status, err)
@@ -0,0 +1,521 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"question-generator-service/pkg/logging"
+)
+
+// ErrInvalidBlueprint is returned for a test blueprint that cannot be
+// assembled into a paper
+var ErrInvalidBlueprint = errors.New("invalid test blueprint")
+
+// MaxPaperQuestions bounds the questions in one generated test
+const MaxPaperQuestions = 200
+
+// DefaultDifficultyBands spread a paper 30% easy, 50% medium and 20% hard
+var DefaultDifficultyBands = []DifficultyBand{
+	{Min: 0.1, Max: 0.4, Weight: 0.3},
+	{Min: 0.4, Max: 0.7, Weight: 0.5},
+	{Min: 0.7, Max: 1.0, Weight: 0.2},
+}
+
+// TestBlueprint describes a full mock test: how many questions of each
+// subject, how they spread over topics and the target difficulty histogram
+type TestBlueprint struct {
+	StudentID  string             `json:"student_id"`
+	ExamType   string             `json:"exam_type"`
+	Format     string             `json:"format,omitempty"` // MCQ when empty
+	Sections   []BlueprintSection `json:"sections"`
+	Difficulty []DifficultyBand   `json:"difficulty_distribution,omitempty"` // DefaultDifficultyBands when empty
+	Seed       int64              `json:"seed,omitempty"`                    // Replays a previous paper; random when zero
+}
+
+// BlueprintSection is one subject of a test blueprint
+type BlueprintSection struct {
+	Subject   string             `json:"subject"`
+	Questions int                `json:"questions"`
+	Topics    map[string]float64 `json:"topics"` // Relative weight per topic ID
+}
+
+// DifficultyBand is one bar of a target difficulty histogram. Bands cover
+// [Min, Max), except that a band ending at 1.0 includes it.
+type DifficultyBand struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Weight float64 `json:"weight"` // Relative share of each section's questions
+}
+
+func (b DifficultyBand) contains(difficulty float64) bool {
+	return difficulty >= b.Min && (difficulty < b.Max || b.Max >= 1.0 && difficulty <= b.Max)
+}
+
+// TestPaper is a generated mock test with a report of how closely it
+// follows its blueprint
+type TestPaper struct {
+	TestID    string           `json:"test_id"`    // The request's X-Request-ID, correlating the paper's logs
+	SessionID string           `json:"session_id"` // The session every question of the paper is logged under
+	Seed      int64            `json:"seed"`       // Every question's seed derives from it
+	Questions []PaperQuestion  `json:"questions"`
+	Failures  []PaperFailure   `json:"failures,omitempty"`
+	Summary   BlueprintSummary `json:"summary"`
+}
+
+// PaperQuestion is one question of a test paper. Numbers run through the
+// sections in blueprint order.
+type PaperQuestion struct {
+	Number           int                       `json:"number"`
+	Subject          string                    `json:"subject"`
+	TopicID          string                    `json:"topic_id"`
+	TargetDifficulty float64                   `json:"target_difficulty"`
+	Question         *GenerateQuestionResponse `json:"question"`
+}
+
+// PaperFailure is a slot of the paper no question could be generated for
+type PaperFailure struct {
+	Number           int     `json:"number"`
+	Subject          string  `json:"subject"`
+	TopicID          string  `json:"topic_id"`
+	TargetDifficulty float64 `json:"target_difficulty"`
+	Error            string  `json:"error"`
+}
+
+// BlueprintSummary compares a paper with its blueprint
+type BlueprintSummary struct {
+	Requested  int                     `json:"requested"`
+	Generated  int                     `json:"generated"`
+	Subjects   []SubjectSummary        `json:"subjects"`
+	Difficulty []DifficultyBandSummary `json:"difficulty"`
+	// DifficultyDeviation is the total variation distance between the
+	// target and realized shares of each band: 0 is an exact match, 1 no
+	// overlap at all. Questions outside every band count against it.
+	DifficultyDeviation float64 `json:"difficulty_deviation"`
+	OutsideBands        int     `json:"outside_bands,omitempty"`
+}
+
+// SubjectSummary compares one section's target and generated questions
+type SubjectSummary struct {
+	Subject      string         `json:"subject"`
+	Target       int            `json:"target"`
+	Generated    int            `json:"generated"`
+	TopicTargets map[string]int `json:"topic_targets"`
+	Topics       map[string]int `json:"topics"`
+}
+
+// DifficultyBandSummary counts the questions targeted at and realized in a
+// difficulty band, by calibrated difficulty
+type DifficultyBandSummary struct {
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	Target    int     `json:"target"`
+	Generated int     `json:"generated"`
+}
+
+// Statuses of a PaperProgress event
+const (
+	PaperSlotGenerated = "generated"
+	PaperSlotFailed    = "failed"
+)
+
+// PaperProgress reports one slot of a paper as it is generated or given up
+// on. Events arrive in completion order, which is not number order since
+// sections are generated in parallel.
+type PaperProgress struct {
+	Number       int     `json:"index"`
+	Subject      string  `json:"subject"`
+	TopicID      string  `json:"topic_id"`
+	Status       string  `json:"status"`                  // PaperSlotGenerated or PaperSlotFailed
+	QualityScore float64 `json:"quality_score,omitempty"` // Generated slots only
+	Error        string  `json:"error,omitempty"`         // Failed slots only
+	Completed    int     `json:"completed"`               // Slots done so far, this one included
+	Total        int     `json:"total"`
+}
+
+// paperSlot is one planned question of a section
+type paperSlot struct {
+	number     int
+	topic      string
+	band       int // Index of the difficulty band
+	difficulty float64
+}
+
+// GenerateTest assembles a mock test from blueprint through the generation
+// pipeline. Each section's questions are split over its topics by weight
+// and over the difficulty bands, generated one at a time so that no
+// template appears twice in the paper. A slot whose topic has run out of
+// templates falls back to the section's other topics; slots nothing could
+// be generated for are reported as failures.
+//
+// Each question's seed is derived from the paper's seed and its number, so
+// generating the same blueprint with the returned seed reproduces the paper
+// as long as the templates and their usage counts are unchanged.
+func (gs *GeneratorService) GenerateTest(ctx context.Context, blueprint TestBlueprint) (*TestPaper, error) {
+	return gs.GenerateTestWithProgress(ctx, blueprint, nil)
+}
+
+// GenerateTestWithProgress is GenerateTest calling progress, when not nil,
+// as each slot is generated or fails. Calls are never concurrent, and all
+// have returned by the time the paper is.
+func (gs *GeneratorService) GenerateTestWithProgress(ctx context.Context, blueprint TestBlueprint, progress func(PaperProgress)) (*TestPaper, error) {
+	if blueprint.Format == "" {
+		blueprint.Format = "MCQ"
+	}
+	if len(blueprint.Difficulty) == 0 {
+		blueprint.Difficulty = DefaultDifficultyBands
+	}
+	blueprint.Difficulty = append([]DifficultyBand(nil), blueprint.Difficulty...)
+	sort.Slice(blueprint.Difficulty, func(i, j int) bool { return blueprint.Difficulty[i].Min < blueprint.Difficulty[j].Min })
+	if err := blueprint.validate(); err != nil {
+		return nil, err
+	}
+
+	// Every slot gets its own request ID derived from the test's, so slots
+	// are not mistaken for retries of each other and re-posting the same
+	// request replays the paper
+	testID := logging.RequestID(ctx)
+	if testID == "" {
+		testID = fmt.Sprintf("test_%d", time.Now().UnixNano())
+	}
+	for blueprint.Seed == 0 {
+		blueprint.Seed = rand.Int63()
+	}
+	paper := &TestPaper{TestID: testID, SessionID: uuid.NewString(), Seed: blueprint.Seed, Questions: []PaperQuestion{}}
+
+	plans := make([][]paperSlot, len(blueprint.Sections))
+	number := 1
+	for i, section := range blueprint.Sections {
+		plans[i] = planSection(section, blueprint.Difficulty, number)
+		number += section.Questions
+	}
+
+	// Sections report their slots concurrently; count and forward them one
+	// at a time
+	var progressMu sync.Mutex
+	completed := 0
+	report := func(event PaperProgress) {
+		if progress == nil {
+			return
+		}
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		completed++
+		event.Completed, event.Total = completed, number-1
+		progress(event)
+	}
+
+	// Templates belong to one subject, so sections cannot share templates
+	// and are generated in parallel
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := range blueprint.Sections {
+		wg.Add(1)
+		go func(section BlueprintSection, slots []paperSlot) {
+			defer wg.Done()
+			questions, failures := gs.generateSection(ctx, paper, blueprint, section, slots, report)
+			mu.Lock()
+			defer mu.Unlock()
+			paper.Questions = append(paper.Questions, questions...)
+			paper.Failures = append(paper.Failures, failures...)
+		}(blueprint.Sections[i], plans[i])
+	}
+	wg.Wait()
+
+	sort.Slice(paper.Questions, func(i, j int) bool { return paper.Questions[i].Number < paper.Questions[j].Number })
+	sort.Slice(paper.Failures, func(i, j int) bool { return paper.Failures[i].Number < paper.Failures[j].Number })
+	paper.Summary = summarizePaper(blueprint, plans, paper.Questions)
+	return paper, nil
+}
+
+// generateSection fills slots in order, never serving a template twice, and
+// reports each slot as it is done
+func (gs *GeneratorService) generateSection(ctx context.Context, paper *TestPaper, blueprint TestBlueprint, section BlueprintSection, slots []paperSlot, report func(PaperProgress)) ([]PaperQuestion, []PaperFailure) {
+	var questions []PaperQuestion
+	var failures []PaperFailure
+	var used []string
+	for _, slot := range slots {
+		requestID := fmt.Sprintf("%s-%d", paper.TestID, slot.number)
+		slotCtx := logging.WithRequestID(ctx, requestID)
+
+		var lastErr error
+		for _, topic := range fallbackTopics(section.Topics, slot.topic) {
+			response, err := gs.GenerateQuestion(slotCtx, &GenerateQuestionRequest{
+				StudentID:           blueprint.StudentID,
+				TopicID:             topic,
+				ExamType:            blueprint.ExamType,
+				Subject:             section.Subject,
+				Format:              blueprint.Format,
+				RequestedDifficulty: slot.difficulty,
+				SessionID:           paper.SessionID,
+				RequestID:           requestID,
+				Seed:                DeriveSeed(blueprint.Seed, slot.number),
+				SkipTemplateIDs:     append([]string(nil), used...),
+			})
+			if err == nil {
+				if templateID, ok := response.Metadata["template_id"].(string); ok {
+					used = append(used, templateID)
+				}
+				questions = append(questions, PaperQuestion{
+					Number:           slot.number,
+					Subject:          section.Subject,
+					TopicID:          topic,
+					TargetDifficulty: slot.difficulty,
+					Question:         response,
+				})
+				report(PaperProgress{
+					Number:       slot.number,
+					Subject:      section.Subject,
+					TopicID:      topic,
+					Status:       PaperSlotGenerated,
+					QualityScore: response.QualityScore,
+				})
+				lastErr = nil
+				break
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if lastErr != nil {
+			failures = append(failures, PaperFailure{
+				Number:           slot.number,
+				Subject:          section.Subject,
+				TopicID:          slot.topic,
+				TargetDifficulty: slot.difficulty,
+				Error:            lastErr.Error(),
+			})
+			report(PaperProgress{
+				Number:  slot.number,
+				Subject: section.Subject,
+				TopicID: slot.topic,
+				Status:  PaperSlotFailed,
+				Error:   lastErr.Error(),
+			})
+		}
+	}
+	return questions, failures
+}
+
+// validate checks the structure of a blueprint whose defaults are applied
+// and whose bands are sorted. Field values such as subjects and exam types
+// are checked by the caller.
+func (bp TestBlueprint) validate() error {
+	var problems []string
+	if len(bp.Sections) == 0 {
+		problems = append(problems, "sections must not be empty")
+	}
+
+	total := 0
+	subjects := make(map[string]bool)
+	for i, section := range bp.Sections {
+		if subjects[section.Subject] {
+			problems = append(problems, fmt.Sprintf("sections[%d]: subject %s appears more than once", i, section.Subject))
+		}
+		subjects[section.Subject] = true
+		if section.Questions < 1 {
+			problems = append(problems, fmt.Sprintf("sections[%d]: questions must be at least 1", i))
+		}
+		total += section.Questions
+		if len(section.Topics) == 0 {
+			problems = append(problems, fmt.Sprintf("sections[%d]: topics must not be empty", i))
+		}
+		for topic, weight := range section.Topics {
+			if weight <= 0 {
+				problems = append(problems, fmt.Sprintf("sections[%d]: topic %s must have a positive weight, got %g", i, topic, weight))
+			}
+		}
+	}
+	if total > MaxPaperQuestions {
+		problems = append(problems, fmt.Sprintf("a test may have at most %d questions, got %d", MaxPaperQuestions, total))
+	}
+
+	bands := bp.Difficulty
+	for i, band := range bands {
+		if band.Min < 0 || band.Max > 1 || band.Min >= band.Max {
+			problems = append(problems, fmt.Sprintf("difficulty band [%g, %g) must lie within [0, 1] with min below max", band.Min, band.Max))
+		}
+		if band.Weight <= 0 {
+			problems = append(problems, fmt.Sprintf("difficulty band [%g, %g) must have a positive weight, got %g", band.Min, band.Max, band.Weight))
+		}
+		if i > 0 && band.Min < bands[i-1].Max {
+			problems = append(problems, fmt.Sprintf("difficulty bands [%g, %g) and [%g, %g) overlap", bands[i-1].Min, bands[i-1].Max, band.Min, band.Max))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidBlueprint, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// planSection splits a section's questions over its topics and the
+// difficulty bands, which are sorted, numbering them from first. Topics are
+// interleaved over the slots, which run from the easiest band up, so that
+// every topic draws questions from across the bands.
+func planSection(section BlueprintSection, bands []DifficultyBand, first int) []paperSlot {
+	topics := sortedTopics(section.Topics)
+	topicWeights := make([]float64, len(topics))
+	for i, topic := range topics {
+		topicWeights[i] = section.Topics[topic]
+	}
+	topicCounts := apportion(section.Questions, topicWeights)
+
+	var slotBands []int
+	for j, count := range apportion(section.Questions, bandWeights(bands)) {
+		for k := 0; k < count; k++ {
+			slotBands = append(slotBands, j)
+		}
+	}
+
+	slots := make([]paperSlot, 0, section.Questions)
+	for len(slots) < section.Questions {
+		for i, topic := range topics {
+			if topicCounts[i] > 0 {
+				topicCounts[i]--
+				band := slotBands[len(slots)]
+				slots = append(slots, paperSlot{
+					number:     first + len(slots),
+					topic:      topic,
+					band:       band,
+					difficulty: bandTarget(bands[band]),
+				})
+			}
+		}
+	}
+	return slots
+}
+
+// bandTarget is the difficulty requested for a band's questions: its
+// midpoint, within the pipeline's accepted range
+func bandTarget(band DifficultyBand) float64 {
+	return math.Max(0.1, math.Min(1.0, (band.Min+band.Max)/2))
+}
+
+func bandWeights(bands []DifficultyBand) []float64 {
+	weights := make([]float64, len(bands))
+	for i, band := range bands {
+		weights[i] = band.Weight
+	}
+	return weights
+}
+
+// apportion splits total into whole shares proportional to weights by the
+// largest remainder method, breaking ties in favor of earlier weights
+func apportion(total int, weights []float64) []int {
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+	counts := make([]int, len(weights))
+	remainders := make([]float64, len(weights))
+	assigned := 0
+	for i, w := range weights {
+		exact := float64(total) * w / sum
+		counts[i] = int(exact)
+		remainders[i] = exact - float64(counts[i])
+		assigned += counts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for _, i := range order[:total-assigned] {
+		counts[i]++
+	}
+	return counts
+}
+
+// sortedTopics returns the topic IDs by descending weight, then by ID
+func sortedTopics(weights map[string]float64) []string {
+	topics := make([]string, 0, len(weights))
+	for topic := range weights {
+		topics = append(topics, topic)
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		if weights[topics[i]] != weights[topics[j]] {
+			return weights[topics[i]] > weights[topics[j]]
+		}
+		return topics[i] < topics[j]
+	})
+	return topics
+}
+
+// fallbackTopics lists the topics to try for a slot: its own first, then
+// the section's others by weight
+func fallbackTopics(weights map[string]float64, topic string) []string {
+	topics := []string{topic}
+	for _, other := range sortedTopics(weights) {
+		if other != topic {
+			topics = append(topics, other)
+		}
+	}
+	return topics
+}
+
+// summarizePaper compares the generated questions with the planned slots
+func summarizePaper(blueprint TestBlueprint, plans [][]paperSlot, questions []PaperQuestion) BlueprintSummary {
+	summary := BlueprintSummary{Generated: len(questions)}
+	for i, section := range blueprint.Sections {
+		subject := SubjectSummary{
+			Subject:      section.Subject,
+			Target:       section.Questions,
+			TopicTargets: make(map[string]int),
+			Topics:       make(map[string]int),
+		}
+		for _, slot := range plans[i] {
+			subject.TopicTargets[slot.topic]++
+		}
+		for _, q := range questions {
+			if q.Subject == section.Subject {
+				subject.Generated++
+				subject.Topics[q.TopicID]++
+			}
+		}
+		summary.Requested += section.Questions
+		summary.Subjects = append(summary.Subjects, subject)
+	}
+
+	for j, band := range blueprint.Difficulty {
+		bandSummary := DifficultyBandSummary{Min: band.Min, Max: band.Max}
+		for _, slots := range plans {
+			for _, slot := range slots {
+				if slot.band == j {
+					bandSummary.Target++
+				}
+			}
+		}
+		for _, q := range questions {
+			if band.contains(q.Question.Difficulty) {
+				bandSummary.Generated++
+			}
+		}
+		summary.Difficulty = append(summary.Difficulty, bandSummary)
+	}
+
+	summary.OutsideBands = summary.Generated
+	for _, band := range summary.Difficulty {
+		summary.OutsideBands -= band.Generated
+	}
+	if summary.Generated == 0 {
+		summary.DifficultyDeviation = 1
+		return summary
+	}
+	deviation := float64(summary.OutsideBands) / float64(summary.Generated)
+	for _, band := range summary.Difficulty {
+		deviation += math.Abs(float64(band.Target)/float64(summary.Requested) - float64(band.Generated)/float64(summary.Generated))
+	}
+	summary.DifficultyDeviation = math.Round(deviation/2*1000) / 1000
+	return summary
+}
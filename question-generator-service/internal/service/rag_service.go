@@ -7,6 +7,8 @@ import (
     "fmt"
     "net/http"
     "time"
+
+    "question-generator-service/pkg/logging"
 )
 
 type RagClient struct {
@@ -32,6 +34,7 @@ func (c *RagClient) AssessQuestionQuality(ctx context.Context, question string)
         return nil, err
     }
     // Add question param, headers etc. as needed
+    logging.SetRequestIDHeader(req)
 
     resp, err := c.HttpClient.Do(req)
     if err != nil {
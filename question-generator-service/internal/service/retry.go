@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"question-generator-service/internal/config"
+	"question-generator-service/internal/db"
+	"question-generator-service/pkg/breaker"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/metrics"
+)
+
+// IsTransient reports whether err is likely to clear up on its own, such as
+// a timeout, a dropped database connection or an open circuit breaker, so
+// that repeating the generation later may succeed. Every other error,
+// including missing or broken templates, is permanent.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, breaker.ErrOpen) ||
+		errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", // connection exception
+			"40", // transaction rollback, e.g. serialization failure or deadlock
+			"53", // insufficient resources
+			"57": // operator intervention, e.g. admin shutdown
+			return pqErr.Code != "57014" // query_canceled comes from our own context
+		}
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// ErrRetryInProgress is returned for a request whose request_id has a
+// background retry waiting or running; once that retry completes, the
+// request is answered with its question
+var ErrRetryInProgress = errors.New("a retry of this request is in progress")
+
+const (
+	// retryPersistTimeout bounds recording a retry's state in the database
+	retryPersistTimeout = 5 * time.Second
+	// retryClaimMargin extends a retry's claim beyond its Timeout, covering
+	// the write of its outcome
+	retryClaimMargin = 30 * time.Second
+)
+
+// generateFunc re-runs the pipeline for a logged request
+type generateFunc func(ctx context.Context, req *GenerateQuestionRequest, genLog *db.GenerationLog, seed int64, startTime time.Time) (*GenerateQuestionResponse, error)
+
+// retryJob is a failed generation waiting for its next attempt
+type retryJob struct {
+	req      *GenerateQuestionRequest
+	genLog   *db.GenerationLog
+	seed     int64
+	attempts int       // Retries run so far
+	dueAt    time.Time // The next_attempt_at it is persisted with, zero when held in memory only
+}
+
+// retryRequest is the retry_request a RETRY_PENDING generation is
+// persisted with
+type retryRequest struct {
+	Request         *GenerateQuestionRequest `json:"request"`
+	SkipTemplateIDs []string                 `json:"skip_template_ids,omitempty"`
+	Seed            int64                    `json:"seed"`
+}
+
+// retryQueue re-runs transiently failed generations in the background on a
+// fixed pool of workers, backing off exponentially between attempts. Each
+// retry updates the original generation log row and its retry_count, so a
+// client retrying the same request ID is served the question once a
+// background retry completes. Waiting retries are persisted on their log
+// row as RETRY_PENDING, so that they survive a restart and every replica
+// can tell a request_id is being retried; a worker claims a retry before
+// running it, so that only one replica does.
+type retryQueue struct {
+	cfg      config.RetryConfig
+	dbClient *db.Client
+	generate generateFunc
+	slots    chan struct{}  // One per job waiting or running, bounding the queue
+	ready    chan *retryJob // Jobs whose backoff has elapsed
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs map[int64]*retryJob // Jobs waiting or running, by generation log ID
+}
+
+func newRetryQueue(cfg config.RetryConfig, dbClient *db.Client, generate generateFunc) *retryQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &retryQueue{
+		cfg:      cfg,
+		dbClient: dbClient,
+		generate: generate,
+		slots:    make(chan struct{}, cfg.QueueSize),
+		ready:    make(chan *retryJob, cfg.QueueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		jobs:     make(map[int64]*retryJob),
+	}
+	for w := 0; w < cfg.Workers; w++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// schedule queues the failed generation of req for a retry. It is dropped
+// when the queue is full or the generation was never logged, since there
+// would be no row to record the retry on.
+func (q *retryQueue) schedule(ctx context.Context, req *GenerateQuestionRequest, genLog *db.GenerationLog, seed int64) {
+	if genLog.ID == 0 || q.ctx.Err() != nil {
+		return
+	}
+	select {
+	case q.slots <- struct{}{}:
+	default:
+		logging.FromContext(ctx).Warnw("generation retry queue is full, not retrying", "question_id", genLog.QuestionID)
+		metrics.IncrementGenerationRetries("dropped")
+		return
+	}
+
+	// The request may be reused by the caller once it has its response
+	reqCopy := *req
+	job := &retryJob{req: &reqCopy, genLog: genLog, seed: seed}
+	q.mu.Lock()
+	q.jobs[genLog.ID] = job
+	q.mu.Unlock()
+	logging.FromContext(ctx).Infow("generation queued for retry", "question_id", genLog.QuestionID)
+	metrics.IncrementGenerationRetries("queued")
+	q.after(job)
+}
+
+// resume queues the RETRY_PENDING generations persisted before a restart,
+// each at its next_attempt_at, returning how many it queued. Those beyond
+// the queue's capacity are left pending for a later restart.
+func (q *retryQueue) resume(ctx context.Context) (int, error) {
+	retries, err := q.dbClient.GetPendingGenerationRetries(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	resumed := 0
+	for _, retry := range retries {
+		var state retryRequest
+		if err := json.Unmarshal(retry.Request, &state); err != nil || state.Request == nil {
+			logging.FromContext(ctx).Warnw("unreadable generation retry, not resuming it",
+				"question_id", retry.Log.QuestionID, "error", err)
+			continue
+		}
+		q.mu.Lock()
+		_, queued := q.jobs[retry.Log.ID]
+		q.mu.Unlock()
+		if queued {
+			continue
+		}
+		select {
+		case q.slots <- struct{}{}:
+		default:
+			logging.FromContext(ctx).Warnw("generation retry queue is full, leaving retries pending",
+				"pending", len(retries)-resumed)
+			return resumed, nil
+		}
+
+		req := state.Request
+		req.SkipTemplateIDs = state.SkipTemplateIDs
+		retry.Log.StageOverrides = req.stageOverrides()
+		job := &retryJob{
+			req: req, genLog: retry.Log, seed: state.Seed,
+			attempts: retry.Attempts, dueAt: retry.NextAttemptAt,
+		}
+		q.mu.Lock()
+		q.jobs[retry.Log.ID] = job
+		q.mu.Unlock()
+		time.AfterFunc(time.Until(job.dueAt), func() { q.ready <- job })
+		resumed++
+	}
+	return resumed, nil
+}
+
+// inFlight returns when the retry of requestID this queue holds, if any,
+// is due
+func (q *retryQueue) inFlight(requestID string) (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range q.jobs {
+		if job.genLog.RequestID == requestID {
+			return job.dueAt, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// after persists job as RETRY_PENDING and hands it to the workers once its
+// backoff has elapsed. A job that cannot be persisted, e.g. while the
+// database is unreachable, is still retried from memory. The job holds a
+// slot, so ready always has room for it.
+func (q *retryQueue) after(job *retryJob) {
+	delay := q.backoff(job.attempts + 1)
+	// Postgres keeps microseconds, and claims compare the stored time
+	job.dueAt = time.Now().Add(delay).Truncate(time.Microsecond)
+	if err := q.persist(job); err != nil {
+		logging.FromContext(q.ctx).Warnw("failed to persist generation retry, retrying from memory only",
+			"question_id", job.genLog.QuestionID, "error", err)
+		job.dueAt = time.Time{}
+	}
+	time.AfterFunc(delay, func() { q.ready <- job })
+}
+
+// persist records job on its log row as RETRY_PENDING, due at job.dueAt
+func (q *retryQueue) persist(job *retryJob) error {
+	state, err := json.Marshal(retryRequest{Request: job.req, SkipTemplateIDs: job.req.SkipTemplateIDs, Seed: job.seed})
+	if err != nil {
+		return err
+	}
+	// The queue's context is cancelled on shutdown, when running retries
+	// are persisted for the next start
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(q.ctx), retryPersistTimeout)
+	defer cancel()
+	return q.dbClient.ScheduleGenerationRetry(ctx, job.genLog, job.attempts, job.dueAt, state)
+}
+
+// backoff returns the wait before the given retry: BaseDelay doubling with
+// each attempt, capped at MaxDelay
+func (q *retryQueue) backoff(attempt int) time.Duration {
+	delay := q.cfg.BaseDelay
+	for i := 1; i < attempt && delay < q.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.cfg.MaxDelay {
+		delay = q.cfg.MaxDelay
+	}
+	return delay
+}
+
+func (q *retryQueue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case job := <-q.ready:
+			q.run(job)
+		}
+	}
+}
+
+// run retries job once, rescheduling it while it keeps failing transiently
+// and has attempts left
+func (q *retryQueue) run(job *retryJob) {
+	ctx := logging.WithRequestID(q.ctx, job.genLog.RequestID)
+	ctx, cancel := context.WithTimeout(ctx, q.cfg.Timeout)
+	defer cancel()
+	log := logging.FromContext(ctx).With("question_id", job.genLog.QuestionID, "attempt", job.attempts+1)
+
+	if !job.dueAt.IsZero() {
+		leaseUntil := time.Now().Add(q.cfg.Timeout + retryClaimMargin).Truncate(time.Microsecond)
+		claimed, err := q.dbClient.ClaimGenerationRetry(ctx, job.genLog.ID, job.dueAt, leaseUntil)
+		switch {
+		case err != nil:
+			log.Warnw("failed to claim generation retry, running it anyway", "error", err)
+		case !claimed:
+			log.Infow("generation retry already claimed or finished elsewhere")
+			q.finish(job)
+			return
+		default:
+			job.dueAt = leaseUntil
+		}
+	}
+
+	job.attempts++
+	job.genLog.RetryCount++
+	job.genLog.ErrorMessage = ""
+	_, err := q.generate(ctx, job.req, job.genLog, job.seed, time.Now())
+	switch {
+	case err == nil:
+		log.Infow("generation retry succeeded")
+		metrics.IncrementGenerationRetries("succeeded")
+	case q.ctx.Err() != nil:
+		// Interrupted by shutdown: give the attempt back and leave the
+		// retry due for the next start
+		job.attempts--
+		job.genLog.RetryCount--
+		job.dueAt = time.Now().Truncate(time.Microsecond)
+		if err := q.persist(job); err != nil {
+			log.Warnw("failed to persist interrupted generation retry", "error", err)
+		}
+	case IsTransient(err) && job.attempts < q.cfg.MaxAttempts:
+		log.Warnw("generation retry failed, retrying again", "error", err)
+		q.after(job)
+		return
+	default:
+		log.Warnw("generation retry failed", "error", err)
+		metrics.IncrementGenerationRetries("failed")
+	}
+	q.finish(job)
+}
+
+// finish forgets job, freeing its slot
+func (q *retryQueue) finish(job *retryJob) {
+	q.mu.Lock()
+	delete(q.jobs, job.genLog.ID)
+	q.mu.Unlock()
+	<-q.slots
+}
+
+// close stops the workers once their current retries finish, cancelling
+// those retries first. Queued and interrupted retries stay RETRY_PENDING
+// in the database, to be resumed on the next start.
+func (q *retryQueue) close() {
+	q.cancel()
+	q.wg.Wait()
+}
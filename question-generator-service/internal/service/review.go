@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/rag_advisor"
+)
+
+// Review verdicts a reviewer can give a flagged question
+const (
+	ReviewAccept = "accept"
+	ReviewReject = "reject" // Also deactivates the question's template
+)
+
+// ErrUnknownVerdict is returned when a review verdict is neither
+// ReviewAccept nor ReviewReject
+var ErrUnknownVerdict = errors.New("unknown review verdict")
+
+// Review is a reviewer's verdict on a flagged question
+type Review struct {
+	Verdict  string `json:"verdict"` // ReviewAccept or ReviewReject
+	Reviewer string `json:"reviewer,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+// reviewFlags lists why a question about to be served needs a human
+// review: RAG could not align it, the validator failed it, or LENIENT
+// policy served it unvalidated. Questions whose request skipped validation
+// are not flagged for it.
+func reviewFlags(req *GenerateQuestionRequest, chosen *generationCandidate, regeneration *rag_advisor.RegenerationResult, ragResult *rag_advisor.QualityCheckResponse, threshold float64) []*db.FlaggedQuestion {
+	var flags []*db.FlaggedQuestion
+	if ragResult != nil && !regeneration.Aligned {
+		score := ragResult.AlignmentScore
+		flags = append(flags, &db.FlaggedQuestion{
+			Reason: db.FlagReasonLowRAGAlignment,
+			Score:  &score,
+			Details: fmt.Sprintf("RAG alignment score %.3f below threshold %.3f after %d attempt(s)",
+				score, threshold, len(regeneration.Attempts)),
+		})
+	}
+
+	switch {
+	case chosen.unvalidated && !req.SkipValidation:
+		flags = append(flags, &db.FlaggedQuestion{
+			Reason:  db.FlagReasonValidationUnavailable,
+			Details: chosen.validation.Feedback,
+		})
+	case !chosen.unvalidated && !chosen.validation.Passed:
+		score := chosen.validation.OverallScore
+		flags = append(flags, &db.FlaggedQuestion{
+			Reason:  db.FlagReasonValidationFailed,
+			Score:   &score,
+			Details: chosen.validation.Feedback,
+		})
+	}
+	return flags
+}
+
+// flagForReview queues a served question for review with each of flags.
+// A lost flag only hides the question from reviewers, so failures are
+// logged rather than failing the generation.
+func (gs *GeneratorService) flagForReview(ctx context.Context, questionID, templateID string, flags []*db.FlaggedQuestion) {
+	for _, flag := range flags {
+		flag.QuestionID, flag.TemplateID = questionID, templateID
+		if err := gs.dbClient.CreateFlaggedQuestion(ctx, flag); err != nil {
+			logging.FromContext(ctx).Warnw("failed to flag question for review (non-critical)",
+				"question_id", questionID, "reason", flag.Reason, "error", err)
+			continue
+		}
+		logging.FromContext(ctx).Infow("question flagged for review",
+			"question_id", questionID, "reason", flag.Reason, "flag_id", flag.ID)
+	}
+}
+
+// QueryFlaggedQuestions lists the review queue
+func (gs *GeneratorService) QueryFlaggedQuestions(ctx context.Context, filters db.FlaggedQuestionFilters) (*db.FlaggedQuestionPage, error) {
+	return gs.dbClient.QueryFlaggedQuestions(ctx, filters)
+}
+
+// ResolveFlaggedQuestion records a reviewer's verdict on a pending flag.
+// Rejecting a question deactivates its template so it is no longer served.
+func (gs *GeneratorService) ResolveFlaggedQuestion(ctx context.Context, id int64, review Review) (*db.FlaggedQuestion, error) {
+	var status string
+	switch review.Verdict {
+	case ReviewAccept:
+		status = db.FlagStatusAccepted
+	case ReviewReject:
+		status = db.FlagStatusRejected
+	default:
+		return nil, fmt.Errorf("%w %q, must be %s or %s", ErrUnknownVerdict, review.Verdict, ReviewAccept, ReviewReject)
+	}
+
+	flag, err := gs.dbClient.ResolveFlaggedQuestion(ctx, id, status, review.Reviewer, review.Note)
+	if err != nil {
+		return nil, err
+	}
+	if status == db.FlagStatusRejected {
+		logging.FromContext(ctx).Infow("template deactivated on review",
+			"template_id", flag.TemplateID, "flag_id", id)
+	}
+	return flag, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"question-generator-service/internal/config"
+	"question-generator-service/pkg/logging"
+)
+
+// Pipeline stages with their own timeouts, as recorded in timed_out_stages
+const (
+	stageTemplate    = "template"
+	stageCalibration = "calibration"
+	stageGeneration  = "generation"
+	stageValidation  = "validation"
+	stageRAG         = "rag"
+)
+
+// stageRegeneration, like stageRAG, is skipped rather than failed when the
+// latency budget runs out; both are recorded in skipped_stages
+const stageRegeneration = "regeneration"
+
+// ErrLatencyBudgetExceeded is returned when MaxGenerationLatency runs out
+// before any question is ready to serve
+var ErrLatencyBudgetExceeded = errors.New("generation latency budget exceeded")
+
+// withLatencyBudget bounds ctx by the generation latency budget counted
+// from start, when one is configured
+func (gs *GeneratorService) withLatencyBudget(ctx context.Context, start time.Time) (context.Context, context.CancelFunc) {
+	if budget := gs.cfg.Stages.MaxGenerationLatency; budget > 0 {
+		return context.WithDeadline(ctx, start.Add(budget))
+	}
+	return context.WithCancel(ctx)
+}
+
+// stageTimer bounds pipeline stages by their configured timeouts and
+// remembers the stages that ran out of their own time, as opposed to the
+// request's. A generation's stages run one after another, so it needs no
+// locking.
+type stageTimer struct {
+	timeouts config.StageTimeoutConfig
+	timedOut []string
+}
+
+func (st *stageTimer) timeout(stage string) time.Duration {
+	switch stage {
+	case stageTemplate:
+		return st.timeouts.Template
+	case stageCalibration:
+		return st.timeouts.Calibration
+	case stageGeneration:
+		return st.timeouts.Generation
+	case stageValidation:
+		return st.timeouts.Validation
+	case stageRAG:
+		return st.timeouts.RAG
+	}
+	return 0
+}
+
+// start derives the context stage runs under from ctx. The returned stop
+// releases it and reports whether the stage's timeout expired while ctx
+// was still live.
+func (st *stageTimer) start(ctx context.Context, stage string) (context.Context, func() bool) {
+	timeout := st.timeout(stage)
+	if timeout <= 0 {
+		return ctx, func() bool { return false }
+	}
+
+	stageCtx, cancel := context.WithTimeout(ctx, timeout)
+	return stageCtx, func() bool {
+		defer cancel()
+		if !errors.Is(stageCtx.Err(), context.DeadlineExceeded) || ctx.Err() != nil {
+			return false
+		}
+		logging.FromContext(ctx).Warnw("pipeline stage timed out", "stage", stage, "timeout", timeout)
+		st.record(stage)
+		return true
+	}
+}
+
+func (st *stageTimer) record(stage string) {
+	for _, s := range st.timedOut {
+		if s == stage {
+			return
+		}
+	}
+	st.timedOut = append(st.timedOut, stage)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/metrics"
+	"question-generator-service/pkg/rag_advisor"
+	"question-generator-service/pkg/validator"
+)
+
+// QuestionValidationRequest is a question authored outside the template
+// system, such as one written by hand for import
+type QuestionValidationRequest struct {
+	QuestionText  string
+	Options       map[string]string
+	CorrectAnswer string
+	AnswerUnit    string // Unit the answer must carry, NUMERICAL only
+	Format        string // MCQ when there are options, NUMERICAL otherwise
+	Subject       string
+	ExamType      string
+	TopicID       string // Optional: narrows the RAG exemplars
+}
+
+// QuestionValidationResponse combines the validator's and, when RAG is
+// enabled, the RAG advisor's verdicts on a question
+type QuestionValidationResponse struct {
+	Validation *validator.ValidationResult       `json:"validation"`
+	RAG        *rag_advisor.QualityCheckResponse `json:"rag,omitempty"`
+	// RAGError is set instead of RAG when the advisor could not be reached;
+	// the question is then judged by the validator alone
+	RAGError          string  `json:"rag_error,omitempty"`
+	RAGThreshold      float64 `json:"rag_threshold,omitempty"`
+	FinalQualityScore float64 `json:"final_quality_score"`
+	Feedback          string  `json:"feedback"`
+	Passed            bool    `json:"passed"`
+}
+
+// ValidateQuestion scores an externally authored question with the same
+// checks generated questions go through. Nothing is generated or logged.
+func (gs *GeneratorService) ValidateQuestion(ctx context.Context, req QuestionValidationRequest) (*QuestionValidationResponse, error) {
+	format := req.Format
+	if format == "" {
+		format = "NUMERICAL"
+		if len(req.Options) > 0 {
+			format = "MCQ"
+		}
+	}
+
+	validation, err := gs.validator.ValidateQuestion(ctx, validator.ValidationRequest{
+		QuestionText:  req.QuestionText,
+		Options:       req.Options,
+		CorrectAnswer: req.CorrectAnswer,
+		ExpectedUnit:  req.AnswerUnit,
+		Format:        format,
+		Subject:       req.Subject,
+		ExamType:      req.ExamType,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate question: %w", err)
+	}
+
+	response := &QuestionValidationResponse{
+		Validation:        validation,
+		FinalQualityScore: validation.OverallScore,
+		Passed:            validation.Passed,
+	}
+	feedback := []string{validation.Feedback}
+
+	if gs.ragAdvisor != nil {
+		metrics.IncrementRAGChecks()
+		rag, err := gs.ragAdvisor.CheckQuestionQuality(ctx, &rag_advisor.QualityCheckRequest{
+			QuestionText: req.QuestionText,
+			Options:      req.Options,
+			Subject:      req.Subject,
+			ExamType:     req.ExamType,
+			TopicID:      req.TopicID,
+		})
+		if err != nil {
+			// As during generation, RAG failure is non-critical
+			logging.FromContext(ctx).Warnw("RAG advisor check failed (non-critical)", "error", err)
+			response.RAGError = err.Error()
+		} else {
+			response.RAG = rag
+			response.RAGThreshold = gs.ragAdvisor.ThresholdFor(req.Subject)
+			response.FinalQualityScore = (validation.OverallScore + rag.AlignmentScore) / 2.0
+			if rag.AlignmentScore < response.RAGThreshold {
+				response.Passed = false
+			}
+			if rag.Feedback != "" {
+				feedback = append(feedback, rag.Feedback)
+			}
+		}
+	}
+
+	response.Feedback = strings.Join(feedback, " ")
+	return response, nil
+}
+
+// Validation policies, deciding what happens to a question when the
+// validator itself fails rather than rejecting it
+const (
+	ValidationPolicyStrict  = "STRICT"
+	ValidationPolicyLenient = "LENIENT"
+)
+
+// QuestionValidator runs the quality checks on a generated question.
+// *validator.Service is the production implementation.
+type QuestionValidator interface {
+	ValidateQuestion(ctx context.Context, req validator.ValidationRequest) (*validator.ValidationResult, error)
+}
+
+// UseValidator replaces the validator the pipeline checks questions with
+func (gs *GeneratorService) UseValidator(v QuestionValidator) {
+	gs.validator = v
+}
+
+// lenientValidation reports whether a validator failure should let the
+// question through. A request that was itself cancelled still fails.
+func (gs *GeneratorService) lenientValidation(ctx context.Context) bool {
+	return gs.cfg.Validator.Policy == ValidationPolicyLenient && ctx.Err() == nil
+}
+
+// skippedValidationResult stands in for the validator's verdict when the
+// request skipped validation
+func skippedValidationResult() *validator.ValidationResult {
+	feedback := "Validation skipped by request"
+	return &validator.ValidationResult{
+		Feedback:      feedback,
+		FeedbackItems: []string{feedback},
+	}
+}
+
+// unvalidatedResult stands in for the validator's verdict when it failed
+// under the LENIENT policy: not passed, with no quality credit
+func unvalidatedResult(err error) *validator.ValidationResult {
+	feedback := fmt.Sprintf("Validation unavailable: %v", err)
+	return &validator.ValidationResult{
+		Feedback:      feedback,
+		FeedbackItems: []string{feedback},
+	}
+}
@@ -0,0 +1,96 @@
+// Package apierror writes the JSON error envelope shared by every handler
+// and middleware, so that clients can parse errors uniformly:
+//
+//	{"error": {"code": "...", "message": "...", "request_id": "...", "details": ...}}
+//
+// It lives outside package api so that middleware in lower packages, such
+// as the request validator, can write the same envelope.
+package apierror
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"question-generator-service/pkg/logging"
+)
+
+// Machine-readable error codes; Message carries the human-readable detail
+const (
+	CodeInvalidRequest     = "invalid_request"   // Malformed body or query parameters
+	CodeInvalidJSON        = "invalid_json"      // Body is not valid JSON
+	CodeValidationFailed   = "validation_failed" // Well-formed request breaking field rules
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeConflict           = "conflict"
+	CodeUnprocessable      = "unprocessable" // Request is valid but cannot be fulfilled
+	CodeRateLimited        = "rate_limited"
+	CodeUpstreamFailed     = "upstream_failed" // A dependency such as BKT failed
+	CodeServiceUnavailable = "service_unavailable"
+	CodeTimeout            = "timeout" // The request ran out of time
+	CodeInternal           = "internal_error"
+)
+
+// Error is the body of the envelope
+type Error struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	RequestID string      `json:"request_id,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// Response is the envelope itself
+type Response struct {
+	Error Error `json:"error"`
+}
+
+// Write responds with status and the error envelope. The request ID is the
+// correlation ID the request logger middleware set on the response, so it
+// is absent for requests that bypassed that middleware.
+func Write(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	response := Response{Error: Error{
+		Code:      code,
+		Message:   message,
+		RequestID: w.Header().Get(logging.RequestIDHeader),
+		Details:   details,
+	}}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to write error response: %v", err)
+	}
+}
+
+// CodeForStatus is the default code for an HTTP error status
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusUnprocessableEntity:
+		return CodeUnprocessable
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway:
+		return CodeUpstreamFailed
+	case http.StatusServiceUnavailable:
+		return CodeServiceUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	default:
+		return CodeInternal
+	}
+}
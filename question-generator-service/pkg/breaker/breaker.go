@@ -0,0 +1,166 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"question-generator-service/internal/config"
+)
+
+// ErrOpen is returned by Allow while the breaker rejects calls
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State of a circuit breaker
+type State int
+
+const (
+	// StateClosed lets every call through while counting failures
+	StateClosed State = iota
+	// StateHalfOpen lets a limited number of probe calls through
+	StateHalfOpen
+	// StateOpen rejects calls until the open timeout elapses
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// minRequests is how many calls a counting window needs before its failure
+// ratio can trip the breaker, so a single early failure does not
+const minRequests = 5
+
+// Breaker stops calls to a failing dependency. While closed it counts calls
+// per cfg.Interval and opens once the failure ratio reaches
+// cfg.FailureRatio. After cfg.Timeout it admits up to cfg.MaxRequests probe
+// calls: any failure reopens it, and that many successes close it again.
+// A zero FailureRatio never trips.
+type Breaker struct {
+	name     string
+	cfg      config.CircuitBreakerConfig
+	onChange func(name string, state State)
+
+	mu          sync.Mutex
+	state       State
+	windowStart time.Time
+	requests    uint32
+	failures    uint32
+	openedAt    time.Time
+	probes      uint32
+	successes   uint32
+}
+
+// New creates a closed breaker. onChange, if not nil, is called with the
+// new state on every transition.
+func New(name string, cfg config.CircuitBreakerConfig, onChange func(name string, state State)) *Breaker {
+	if cfg.MaxRequests == 0 {
+		cfg.MaxRequests = 1
+	}
+	b := &Breaker{name: name, cfg: cfg, onChange: onChange, windowStart: time.Now()}
+	if onChange != nil {
+		onChange(name, StateClosed)
+	}
+	return b
+}
+
+// Allow reports whether a call may proceed, returning ErrOpen when it must
+// be skipped. Every allowed call must be followed by Record or Release.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(time.Now())
+	switch b.state {
+	case StateOpen:
+		return ErrOpen
+	case StateHalfOpen:
+		if b.probes >= b.cfg.MaxRequests {
+			return ErrOpen
+		}
+		b.probes++
+	}
+	return nil
+}
+
+// Record reports the outcome of a call admitted by Allow
+func (b *Breaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.advance(now)
+	switch b.state {
+	case StateClosed:
+		b.requests++
+		if !success {
+			b.failures++
+		}
+		if b.cfg.FailureRatio > 0 && b.requests >= minRequests &&
+			float64(b.failures)/float64(b.requests) >= b.cfg.FailureRatio {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if !success {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.MaxRequests {
+			b.setState(StateClosed, now)
+		}
+	}
+	// Outcomes of calls admitted before the breaker opened are ignored
+}
+
+// Release hands back a call admitted by Allow without recording an outcome,
+// for calls abandoned by their caller
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// State returns the current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+	return b.state
+}
+
+// advance applies the transitions that only depend on time
+func (b *Breaker) advance(now time.Time) {
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) >= b.cfg.Timeout {
+			b.setState(StateHalfOpen, now)
+		}
+	case StateClosed:
+		if b.cfg.Interval > 0 && now.Sub(b.windowStart) >= b.cfg.Interval {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+	}
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	b.state = state
+	b.windowStart, b.requests, b.failures = now, 0, 0
+	b.probes, b.successes = 0, 0
+	if state == StateOpen {
+		b.openedAt = now
+	}
+	if b.onChange != nil {
+		b.onChange(b.name, state)
+	}
+}
@@ -0,0 +1,56 @@
+// Package buildinfo reports the version of the running binary. Version,
+// GitSHA and BuildTime are injected at build time:
+//
+//	go build -ldflags "-X question-generator-service/pkg/buildinfo.Version=v1.2.0 \
+//	  -X question-generator-service/pkg/buildinfo.GitSHA=$(git rev-parse HEAD) \
+//	  -X question-generator-service/pkg/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set via -ldflags -X; the defaults mark a development build
+var (
+	Version   = "dev"
+	GitSHA    = ""
+	BuildTime = ""
+)
+
+// Info describes the running binary
+type Info struct {
+	Version   string `json:"version"`
+	GitSHA    string `json:"git_sha"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build info of the running binary. Without an injected
+// GitSHA or BuildTime it falls back to the VCS details the go tool embeds
+// when building from a checkout, and to "unknown" after that.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		GitSHA:    GitSHA,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok && (info.GitSHA == "" || info.BuildTime == "") {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.GitSHA == "":
+				info.GitSHA = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	if info.GitSHA == "" {
+		info.GitSHA = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
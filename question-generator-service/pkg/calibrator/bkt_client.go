@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"question-generator-service/internal/config"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/metrics"
 )
 
 // Service handles difficulty calibration using BKT inference
@@ -18,10 +20,22 @@ type Service struct {
 	client     *http.Client
 	serviceURL string
 	config     config.BKTConfig
+	fallback   FallbackStrategy
+	bloom      bloomCurve    // Difficulty added per Bloom level, after BKT or the fallback
+	mastery    *knownMastery // Latest mastery per student and topic, for ZPD fallbacks
 }
 
 // NewService creates a new BKT calibrator service
 func NewService(cfg config.BKTConfig) (*Service, error) {
+	fallback, err := parseFallbackStrategy(cfg.FallbackStrategy)
+	if err != nil {
+		return nil, err
+	}
+	bloom, err := parseBloomCurve(cfg.BloomAdjustments)
+	if err != nil {
+		return nil, err
+	}
+
 	client := &http.Client{
 		Timeout: cfg.Timeout,
 		Transport: &http.Transport{
@@ -35,6 +49,9 @@ func NewService(cfg config.BKTConfig) (*Service, error) {
 		client:     client,
 		serviceURL: cfg.ServiceURL,
 		config:     cfg,
+		fallback:   fallback,
+		bloom:      bloom,
+		mastery:    newKnownMastery(),
 	}, nil
 }
 
@@ -46,6 +63,7 @@ type CalibrationRequest struct {
 	BaseDifficulty      float64 `json:"base_difficulty"`
 	ExamType            string  `json:"exam_type,omitempty"`
 	Subject             string  `json:"subject,omitempty"`
+	BloomLevel          int     `json:"bloom_level,omitempty"` // Template's Bloom's taxonomy level, 1 to 6; 0 when unknown
 }
 
 // CalibrationResponse represents the BKT service response
@@ -67,8 +85,22 @@ type BKTParameters struct {
 	LastUpdated      string  `json:"last_updated"`
 }
 
-// CalibrateDifficulty calibrates question difficulty based on student's mastery level
-func (s *Service) CalibrateDifficulty(ctx context.Context, req CalibrationRequest) (float64, float64, error) {
+// CalibrateDifficulty calibrates question difficulty based on student's
+// mastery level, reporting whether BKT or the fallback produced it. The
+// result is then raised for templates at higher Bloom levels, which demand
+// more than recall at the same nominal difficulty.
+func (s *Service) CalibrateDifficulty(ctx context.Context, req CalibrationRequest) (Calibration, error) {
+	calibration, err := s.calibrate(ctx, req)
+	if err != nil {
+		return Calibration{}, err
+	}
+	calibration.Difficulty = s.bloom.adjust(calibration.Difficulty, req.BloomLevel)
+	return calibration, nil
+}
+
+// calibrate asks BKT for a difficulty, falling back to the rule-based
+// strategy when it cannot answer
+func (s *Service) calibrate(ctx context.Context, req CalibrationRequest) (Calibration, error) {
 	// Build request payload for BKT service
 	requestBody, err := json.Marshal(map[string]interface{}{
 		"student_id":           req.StudentID,
@@ -81,23 +113,47 @@ func (s *Service) CalibrateDifficulty(ctx context.Context, req CalibrationReques
 		},
 	})
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to marshal calibration request: %w", err)
+		return Calibration{}, fmt.Errorf("failed to marshal calibration request: %w", err)
 	}
 
 	// Make HTTP request to BKT inference service with retry logic
+	metrics.IncrementBKTCalls()
 	var response CalibrationResponse
 	err = s.makeRequestWithRetry(ctx, "POST", "/v1/calibrate", requestBody, &response)
 	if err != nil {
+		// A cancelled or expired request has nobody left to serve, so
+		// don't fall back for it
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Calibration{}, ctxErr
+		}
 		// Fallback to rule-based calibration if BKT service fails
-		return s.fallbackCalibration(req)
+		calibration := s.fallbackCalibration(req)
+		logging.FromContext(ctx).Warnw("BKT calibration failed, using rule-based fallback",
+			"student_id", req.StudentID, "topic_id", req.TopicID,
+			"strategy", calibration.Fallback, "error", err)
+		metrics.IncrementCalibrations(string(calibration.Source))
+		return calibration, nil
 	}
 
 	// Validate response
 	if err := s.validateCalibrationResponse(&response); err != nil {
-		return s.fallbackCalibration(req)
+		calibration := s.fallbackCalibration(req)
+		logging.FromContext(ctx).Warnw("BKT returned an invalid calibration, using rule-based fallback",
+			"student_id", req.StudentID, "topic_id", req.TopicID,
+			"strategy", calibration.Fallback, "error", err)
+		metrics.IncrementCalibrations(string(calibration.Source))
+		return calibration, nil
 	}
 
-	return response.CalibratedDifficulty, response.MasteryLevel, nil
+	s.mastery.set(req.StudentID, req.TopicID, response.MasteryLevel)
+	metrics.IncrementCalibrations(string(SourceBKT))
+	return Calibration{
+		Difficulty:     response.CalibratedDifficulty,
+		Mastery:        response.MasteryLevel,
+		Source:         SourceBKT,
+		Confidence:     response.Confidence,
+		Recommendation: response.Recommendation,
+	}, nil
 }
 
 // GetStudentMastery retrieves current mastery level for a student-topic combination
@@ -116,14 +172,16 @@ func (s *Service) GetStudentMastery(ctx context.Context, studentID, topicID stri
 		return 0.5, fmt.Errorf("failed to get student mastery: %w", err) // Default to medium mastery
 	}
 
+	s.mastery.set(studentID, topicID, response.MasteryLevel)
 	return response.MasteryLevel, nil
 }
 
 // UpdateMasteryLevel updates student mastery based on question performance
-func (s *Service) UpdateMasteryLevel(ctx context.Context, req MasteryUpdateRequest) error {
+// and returns the new mastery level
+func (s *Service) UpdateMasteryLevel(ctx context.Context, req MasteryUpdateRequest) (float64, error) {
 	requestBody, err := json.Marshal(req)
 	if err != nil {
-		return fmt.Errorf("failed to marshal mastery update: %w", err)
+		return 0, fmt.Errorf("failed to marshal mastery update: %w", err)
 	}
 
 	var response struct {
@@ -134,14 +192,15 @@ func (s *Service) UpdateMasteryLevel(ctx context.Context, req MasteryUpdateReque
 
 	err = s.makeRequestWithRetry(ctx, "POST", "/v1/update", requestBody, &response)
 	if err != nil {
-		return fmt.Errorf("failed to update mastery level: %w", err)
+		return 0, fmt.Errorf("failed to update mastery level: %w", err)
 	}
 
 	if !response.Success {
-		return fmt.Errorf("mastery update was not successful")
+		return 0, fmt.Errorf("mastery update was not successful")
 	}
 
-	return nil
+	s.mastery.set(req.StudentID, req.TopicID, response.NewMastery)
+	return response.NewMastery, nil
 }
 
 // MasteryUpdateRequest represents a mastery level update request
@@ -200,6 +259,7 @@ func (s *Service) makeRequest(ctx context.Context, method, url string, body []by
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("User-Agent", "question-generator/v1.0.0")
+	logging.SetRequestIDHeader(req)
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -231,6 +291,10 @@ func (s *Service) validateCalibrationResponse(resp *CalibrationResponse) error {
 		return fmt.Errorf("invalid mastery level: %f", resp.MasteryLevel)
 	}
 
+	if resp.Confidence < 0.0 || resp.Confidence > 1.0 {
+		return fmt.Errorf("invalid confidence: %f", resp.Confidence)
+	}
+
 	// Validate BKT parameters are within expected ranges
 	params := resp.BKTParameters
 	if params.InitialKnowledge < 0.0 || params.InitialKnowledge > 1.0 {
@@ -252,31 +316,6 @@ func (s *Service) validateCalibrationResponse(resp *CalibrationResponse) error {
 	return nil
 }
 
-// fallbackCalibration provides rule-based difficulty calibration when BKT service fails
-func (s *Service) fallbackCalibration(req CalibrationRequest) (float64, float64, error) {
-	// Simple rule-based fallback algorithm
-	// In production, this would be more sophisticated based on historical data
-
-	baseDifficulty := req.BaseDifficulty
-	requestedDifficulty := req.RequestedDifficulty
-
-	// Apply conservative adjustment toward base difficulty
-	calibratedDifficulty := (baseDifficulty + requestedDifficulty) / 2.0
-
-	// Ensure within bounds
-	if calibratedDifficulty < 0.1 {
-		calibratedDifficulty = 0.1
-	}
-	if calibratedDifficulty > 1.0 {
-		calibratedDifficulty = 1.0
-	}
-
-	// Assume medium mastery level for fallback
-	masteryLevel := 0.5
-
-	return calibratedDifficulty, masteryLevel, nil
-}
-
 // isClientError checks if an error represents a client error (4xx HTTP status)
 func isClientError(err error) bool {
 	if err == nil {
@@ -0,0 +1,43 @@
+package calibrator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BloomLevels names the levels of Bloom's taxonomy in order, so that
+// BloomLevels[0] is template bloom_level 1
+var BloomLevels = []string{"REMEMBER", "UNDERSTAND", "APPLY", "ANALYZE", "EVALUATE", "CREATE"}
+
+// bloomCurve holds the difficulty added to a calibration at each Bloom
+// level, indexed by bloom_level. Index 0 stands for an unknown level and is
+// never adjusted.
+type bloomCurve [7]float64
+
+// parseBloomCurve builds the curve from adjustments keyed by level name.
+// Levels without an entry are not adjusted.
+func parseBloomCurve(adjustments map[string]float64) (bloomCurve, error) {
+	var curve bloomCurve
+	for name, adjustment := range adjustments {
+		level := 0
+		for i, known := range BloomLevels {
+			if strings.EqualFold(name, known) {
+				level = i + 1
+			}
+		}
+		if level == 0 {
+			return curve, fmt.Errorf("unknown Bloom level %q in Bloom adjustments, want one of %s", name, strings.Join(BloomLevels, ", "))
+		}
+		curve[level] = adjustment
+	}
+	return curve, nil
+}
+
+// adjust shifts difficulty by the adjustment for bloomLevel, keeping the
+// result within [0.1, 1.0]. Levels outside 1 to 6 are left as is.
+func (c bloomCurve) adjust(difficulty float64, bloomLevel int) float64 {
+	if bloomLevel < 1 || bloomLevel >= len(c) || c[bloomLevel] == 0 {
+		return difficulty
+	}
+	return clampDifficulty(difficulty + c[bloomLevel])
+}
@@ -0,0 +1,156 @@
+package calibrator
+
+import (
+	"fmt"
+	"sync"
+
+	"question-generator-service/pkg/metrics"
+)
+
+// FallbackStrategy decides the difficulty served when BKT cannot calibrate
+type FallbackStrategy string
+
+const (
+	// FallbackAverage serves the midpoint of the base and requested
+	// difficulty
+	FallbackAverage FallbackStrategy = "AVERAGE"
+	// FallbackZPD maps the student's last known mastery through
+	// GetDifficultyMapping, or averages when no mastery is known yet
+	FallbackZPD FallbackStrategy = "ZPD"
+	// FallbackRequested serves the requested difficulty, adjusted only for
+	// the template's Bloom level
+	FallbackRequested FallbackStrategy = "REQUESTED"
+)
+
+// defaultMastery is assumed for a student whose mastery is unknown
+const defaultMastery = 0.5
+
+// maxKnownMastery bounds the mastery levels remembered for ZPD fallbacks
+const maxKnownMastery = 10000
+
+// parseFallbackStrategy validates a configured strategy. An empty strategy
+// defaults to AVERAGE.
+func parseFallbackStrategy(s string) (FallbackStrategy, error) {
+	switch strategy := FallbackStrategy(s); strategy {
+	case "":
+		return FallbackAverage, nil
+	case FallbackAverage, FallbackZPD, FallbackRequested:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown BKT fallback strategy %q", s)
+}
+
+// CalibrationSource tells whether BKT or the rule-based fallback calibrated
+// a question
+type CalibrationSource string
+
+const (
+	SourceBKT      CalibrationSource = "BKT"
+	SourceFallback CalibrationSource = "FALLBACK"
+)
+
+// Calibration is the outcome of calibrating one question
+type Calibration struct {
+	Difficulty float64
+	Mastery    float64
+	Source     CalibrationSource
+	// Confidence is BKT's confidence in the calibration, from 0 to 1, and
+	// Recommendation its advice for the student, such as "review
+	// prerequisite". Both are unset for fallback calibrations.
+	Confidence     float64
+	Recommendation string
+	// Fallback is the strategy applied when BKT could not calibrate, and
+	// empty when it did
+	Fallback FallbackStrategy
+}
+
+// knownMastery remembers the latest mastery BKT reported per student and
+// topic
+type knownMastery struct {
+	mu     sync.Mutex
+	levels map[string]float64
+}
+
+func newKnownMastery() *knownMastery {
+	return &knownMastery{levels: make(map[string]float64)}
+}
+
+func masteryKey(studentID, topicID string) string {
+	return studentID + "\x00" + topicID
+}
+
+// get returns the last mastery seen for the student and topic
+func (k *knownMastery) get(studentID, topicID string) (float64, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	level, ok := k.levels[masteryKey(studentID, topicID)]
+	return level, ok
+}
+
+// set records a mastery level, dropping an arbitrary entry when full
+func (k *knownMastery) set(studentID, topicID string, level float64) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key := masteryKey(studentID, topicID)
+	if _, ok := k.levels[key]; !ok && len(k.levels) >= maxKnownMastery {
+		for evicted := range k.levels {
+			delete(k.levels, evicted)
+			break
+		}
+	}
+	k.levels[key] = level
+}
+
+// FallbackCalibration calibrates req by rule alone, adjusted for Bloom
+// level like CalibrateDifficulty, for callers that gave up waiting on BKT
+func (s *Service) FallbackCalibration(req CalibrationRequest) Calibration {
+	calibration := s.fallbackCalibration(req)
+	metrics.IncrementCalibrations(string(calibration.Source))
+	calibration.Difficulty = s.bloom.adjust(calibration.Difficulty, req.BloomLevel)
+	return calibration
+}
+
+// fallbackCalibration provides rule-based difficulty calibration when BKT
+// service fails, using the configured strategy
+func (s *Service) fallbackCalibration(req CalibrationRequest) Calibration {
+	mastery, known := s.mastery.get(req.StudentID, req.TopicID)
+	if !known {
+		mastery = defaultMastery
+	}
+
+	switch {
+	case s.fallback == FallbackZPD && known:
+		return Calibration{
+			Difficulty: s.GetDifficultyMapping(mastery, req.RequestedDifficulty),
+			Mastery:    mastery,
+			Source:     SourceFallback,
+			Fallback:   FallbackZPD,
+		}
+	case s.fallback == FallbackRequested:
+		return Calibration{
+			Difficulty: clampDifficulty(req.RequestedDifficulty),
+			Mastery:    mastery,
+			Source:     SourceFallback,
+			Fallback:   FallbackRequested,
+		}
+	}
+
+	// Apply conservative adjustment toward base difficulty
+	return Calibration{
+		Difficulty: clampDifficulty((req.BaseDifficulty + req.RequestedDifficulty) / 2.0),
+		Mastery:    mastery,
+		Source:     SourceFallback,
+		Fallback:   FallbackAverage,
+	}
+}
+
+// clampDifficulty keeps a difficulty within [0.1, 1.0]
+func clampDifficulty(difficulty float64) float64 {
+	if difficulty < 0.1 {
+		return 0.1
+	}
+	if difficulty > 1.0 {
+		return 1.0
+	}
+	return difficulty
+}
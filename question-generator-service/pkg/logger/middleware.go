@@ -70,16 +70,16 @@ func (s *GenlogService) CreateGenerationLogFromContext(ctx context.Context) *db.
 }
 
 // LogGeneration logs the generation process with all details
-func (s *GenlogService) LogGeneration(ctx context.Context, log *db.GenerationLog) error {
-	if log == nil {
+func (s *GenlogService) LogGeneration(ctx context.Context, genLog *db.GenerationLog) error {
+	if genLog == nil {
 		log.Printf("Warning: Attempted to log nil generation log")
 		return nil
 	}
 	
 	// Create or update the generation log
-	if log.ID == 0 {
-		return s.CreateGenerationLog(ctx, log)
+	if genLog.ID == 0 {
+		return s.CreateGenerationLog(ctx, genLog)
 	} else {
-		return s.UpdateGenerationLog(ctx, log)
+		return s.UpdateGenerationLog(ctx, genLog)
 	}
 }
\ No newline at end of file
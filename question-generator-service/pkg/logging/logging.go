@@ -0,0 +1,160 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"question-generator-service/internal/config"
+)
+
+// Logger is a structured zap logger configured from LoggingConfig whose
+// level can be changed at runtime
+type Logger struct {
+	*zap.SugaredLogger
+	level  zap.AtomicLevel
+	closer io.Closer
+}
+
+// New builds a logger writing to cfg.Output: "stdout", "stderr", or a file
+// path that is appended to
+func New(cfg config.LoggingConfig) (*Logger, error) {
+	var (
+		w      io.Writer
+		closer io.Closer
+	)
+	switch cfg.Output {
+	case "", "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		f, err := os.OpenFile(cfg.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log output %s: %w", cfg.Output, err)
+		}
+		w, closer = f, f
+	}
+
+	l, err := NewWithWriter(cfg, w)
+	if err != nil {
+		if closer != nil {
+			closer.Close()
+		}
+		return nil, err
+	}
+	l.closer = closer
+	return l, nil
+}
+
+// NewWithWriter builds a logger writing to w, ignoring cfg.Output
+func NewWithWriter(cfg config.LoggingConfig, w io.Writer) (*Logger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	atomicLevel := zap.NewAtomicLevelAt(level)
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "time"
+	encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	var encoder zapcore.Encoder
+	switch cfg.Format {
+	case "", "json":
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	case "console":
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want json or console)", cfg.Format)
+	}
+
+	core := zapcore.NewCore(encoder, zapcore.AddSync(w), atomicLevel)
+	return &Logger{SugaredLogger: zap.New(core).Sugar(), level: atomicLevel}, nil
+}
+
+// ParseLevel maps debug, info, warn and error onto zap levels
+func ParseLevel(level string) (zapcore.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return zapcore.DebugLevel, nil
+	case "", "info":
+		return zapcore.InfoLevel, nil
+	case "warn", "warning":
+		return zapcore.WarnLevel, nil
+	case "error":
+		return zapcore.ErrorLevel, nil
+	}
+	return zapcore.InfoLevel, fmt.Errorf("unknown log level %q", level)
+}
+
+// SetLevel changes the minimum level of entries written
+func (l *Logger) SetLevel(level string) error {
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.level.SetLevel(parsed)
+	return nil
+}
+
+// Close flushes buffered entries and releases the log file, if output goes
+// to one
+func (l *Logger) Close() error {
+	l.Sync()
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// RequestIDHeader carries the correlation ID between services
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// NewContext returns a context carrying logger
+func NewContext(ctx context.Context, logger *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the request-scoped logger, or zap's global logger when
+// the context carries none
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	if logger, ok := ctx.Value(loggerKey).(*zap.SugaredLogger); ok {
+		return logger
+	}
+	return zap.S()
+}
+
+// WithRequestID returns a context carrying requestID and a logger that adds
+// it to every entry as request_id
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey, requestID)
+	return NewContext(ctx, FromContext(ctx).With("request_id", requestID))
+}
+
+// RequestID returns the correlation ID stored by WithRequestID, if any
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// SetRequestIDHeader forwards the request ID in req's context, if any, on
+// the outbound request
+func SetRequestIDHeader(req *http.Request) {
+	if requestID := RequestID(req.Context()); requestID != "" {
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+}
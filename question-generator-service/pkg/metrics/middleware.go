@@ -1,59 +1,275 @@
 package metrics
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
 	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const namespace = "question_generator"
+
+// StartTime records when the metrics package was initialised
+var StartTime = time.Now()
+
+// Request totals backing the derived gauges (success rate, rps)
+var (
+	totalRequests      int64
+	successfulRequests int64
+)
+
+// LatencyBucketsMs are the histogram buckets, in milliseconds, used for
+// request and pipeline stage latencies
+var LatencyBucketsMs = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500}
+
+// PipelineStages lists the generation pipeline stages reported in
+// pipeline_breakdown, without their "_ms" suffix
+var PipelineStages = []string{"template", "calibration", "generation", "validation", "rag"}
+
+// Known label values; anything else is aggregated into LabelOther so the
+// number of series stays bounded
+var (
+	KnownExamTypes = []string{"JEE_MAIN", "JEE_ADVANCED", "NEET", "FOUNDATION"}
+	KnownSubjects  = []string{"PHYSICS", "CHEMISTRY", "MATHEMATICS", "BIOLOGY"}
 )
 
-// Global metrics counters
+const (
+	// LabelOther is used for exam types or subjects outside the known enums
+	LabelOther = "other"
+	// LabelNone is used for requests that carry no generation parameters
+	LabelNone = "none"
+)
+
+// Prometheus collectors exposed on /metrics
 var (
-	TotalRequests      int64
-	SuccessfulRequests int64
-	FailedRequests     int64
-	TotalResponseTime  int64 // in milliseconds
-	ValidationErrors   int64
-	RAGChecks          int64
-	BKTCalls           int64
-	ActiveConnections  int64
-	QuestionsGenerated int64
-	StartTime          = time.Now()
-	mutex              sync.RWMutex
+	ServiceInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "info",
+		Help:      "Service information",
+	}, []string{"version", "service"})
+
+	RequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests",
+	}, []string{"status"})
+
+	ValidationErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validation_errors_total",
+		Help:      "Total validation errors",
+	})
+
+	RAGChecksTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rag_checks_total",
+		Help:      "Total RAG quality checks performed",
+	})
+
+	RAGCacheHitsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rag_cache_hits_total",
+		Help:      "Total RAG quality checks served from the result cache",
+	})
+
+	IdempotentReplaysTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "idempotent_replays_total",
+		Help:      "Total generation requests answered with an earlier completed generation",
+	})
+
+	GenerationRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "generation_retries_total",
+		Help:      "Background retries of failed generations by outcome: queued, dropped, succeeded or failed",
+	}, []string{"outcome"})
+
+	DuplicateQuestionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicate_questions_total",
+		Help:      "Generated questions too similar to one recently served to the student, by outcome: regenerated or served",
+	}, []string{"outcome"})
+
+	ContentGapsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "content_gaps_total",
+		Help:      "Generation requests that failed because no template matched, by exam type, subject and topic",
+	}, []string{"exam_type", "subject", "topic"})
+
+	BKTCallsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bkt_calls_total",
+		Help:      "Total BKT service calls",
+	})
+
+	CalibrationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "calibrations_total",
+		Help:      "Total difficulty calibrations by source, BKT or FALLBACK",
+	}, []string{"source"})
+
+	ActiveConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_connections",
+		Help:      "Current active connections",
+	})
+
+	QuestionsGeneratedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "questions_generated_total",
+		Help:      "Total questions generated successfully",
+	}, []string{"exam_type", "subject"})
+
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_ms",
+		Help:      "HTTP request duration in milliseconds",
+		Buckets:   LatencyBucketsMs,
+	}, []string{"exam_type", "subject"})
+
+	PipelineStageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "pipeline_stage_duration_ms",
+		Help:      "Generation pipeline stage duration in milliseconds",
+		Buckets:   LatencyBucketsMs,
+	}, []string{"stage"})
+
+	CircuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "Circuit breaker state per downstream service (0 closed, 1 half-open, 2 open)",
+	}, []string{"service"})
 )
 
+func init() {
+	prometheus.MustRegister(
+		ServiceInfo,
+		RequestsTotal,
+		ValidationErrorsTotal,
+		RAGChecksTotal,
+		RAGCacheHitsTotal,
+		IdempotentReplaysTotal,
+		GenerationRetriesTotal,
+		DuplicateQuestionsTotal,
+		ContentGapsTotal,
+		BKTCallsTotal,
+		CalibrationsTotal,
+		ActiveConnections,
+		QuestionsGeneratedTotal,
+		RequestDuration,
+		PipelineStageDuration,
+		CircuitBreakerState,
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "uptime_seconds",
+			Help:      "Service uptime in seconds",
+		}, uptimeSeconds),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "success_rate",
+			Help:      "Percentage of successful requests",
+		}, successRate),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "requests_per_second",
+			Help:      "Current requests per second",
+		}, requestsPerSecond),
+	)
+
+	// Pre-create both status series so dashboards see zeros instead of gaps
+	RequestsTotal.WithLabelValues("success")
+	RequestsTotal.WithLabelValues("failed")
+}
+
+// SetServiceInfo publishes the service name and version on the info gauge
+func SetServiceInfo(service, version string) {
+	ServiceInfo.WithLabelValues(version, service).Set(1)
+}
+
+// requestLabels carries the exam type and subject of a request back up to
+// MetricsMiddleware once a downstream handler has decoded the body
+type requestLabels struct {
+	mu       sync.Mutex
+	examType string
+	subject  string
+}
+
+type requestLabelsKey struct{}
+
+// SetRequestLabels records the exam type and subject for the in-flight
+// request so its latency and generation counters are labelled accordingly.
+// It is a no-op when the request did not pass through MetricsMiddleware.
+func SetRequestLabels(ctx context.Context, examType, subject string) {
+	labels, ok := ctx.Value(requestLabelsKey{}).(*requestLabels)
+	if !ok {
+		return
+	}
+	labels.mu.Lock()
+	labels.examType = examType
+	labels.subject = subject
+	labels.mu.Unlock()
+}
+
+// values returns the bounded exam_type and subject label values
+func (l *requestLabels) values() (string, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return boundedLabel(l.examType, KnownExamTypes), boundedLabel(l.subject, KnownSubjects)
+}
+
+// boundedLabel maps a raw value onto the known set, LabelNone or LabelOther
+func boundedLabel(value string, known []string) string {
+	if value == "" {
+		return LabelNone
+	}
+	for _, k := range known {
+		if value == k {
+			return value
+		}
+	}
+	return LabelOther
+}
+
 // MetricsMiddleware tracks HTTP request metrics
 func MetricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
-		
+		labels := &requestLabels{}
+		r = r.WithContext(context.WithValue(r.Context(), requestLabelsKey{}, labels))
+
 		// Track active connections
-		atomic.AddInt64(&ActiveConnections, 1)
-		defer atomic.AddInt64(&ActiveConnections, -1)
-		
-		// Track total requests
-		atomic.AddInt64(&TotalRequests, 1)
-		
+		ActiveConnections.Inc()
+		defer ActiveConnections.Dec()
+
 		// Create response writer wrapper to capture status
 		wrapper := &responseWriter{ResponseWriter: w, statusCode: 200}
-		
+
 		// Process request
 		next.ServeHTTP(wrapper, r)
-		
+
 		// Track response time
-		duration := time.Since(startTime)
-		atomic.AddInt64(&TotalResponseTime, duration.Milliseconds())
-		
+		examType, subject := labels.values()
+		RequestDuration.WithLabelValues(examType, subject).Observe(float64(time.Since(startTime)) / float64(time.Millisecond))
+		atomic.AddInt64(&totalRequests, 1)
+
 		// Track success/failure
 		if wrapper.statusCode >= 200 && wrapper.statusCode < 400 {
-			atomic.AddInt64(&SuccessfulRequests, 1)
-			
+			atomic.AddInt64(&successfulRequests, 1)
+			RequestsTotal.WithLabelValues("success").Inc()
+
 			// Track questions generated for generation endpoints
 			if r.URL.Path == "/v1/questions/generate" && wrapper.statusCode == 200 {
-				atomic.AddInt64(&QuestionsGenerated, 1)
+				QuestionsGeneratedTotal.WithLabelValues(examType, subject).Inc()
 			}
 		} else {
-			atomic.AddInt64(&FailedRequests, 1)
+			RequestsTotal.WithLabelValues("failed").Inc()
 		}
 	})
 }
@@ -69,53 +285,192 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Hijack hands the connection to a WebSocket upgrade, which counts as 101
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	rw.statusCode = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
 // Increment validation errors counter
 func IncrementValidationErrors() {
-	atomic.AddInt64(&ValidationErrors, 1)
+	ValidationErrorsTotal.Inc()
 }
 
 // Increment RAG checks counter
 func IncrementRAGChecks() {
-	atomic.AddInt64(&RAGChecks, 1)
+	RAGChecksTotal.Inc()
+}
+
+// Increment RAG cache hits counter
+func IncrementRAGCacheHits() {
+	RAGCacheHitsTotal.Inc()
+}
+
+// Increment idempotent replays counter
+func IncrementIdempotentReplays() {
+	IdempotentReplaysTotal.Inc()
+}
+
+// Increment generation retries counter for outcome
+func IncrementGenerationRetries(outcome string) {
+	GenerationRetriesTotal.WithLabelValues(outcome).Inc()
+}
+
+// Increment duplicate questions counter for outcome
+func IncrementDuplicateQuestions(outcome string) {
+	DuplicateQuestionsTotal.WithLabelValues(outcome).Inc()
+}
+
+// MaxContentGapTopics caps the distinct topic label values on
+// ContentGapsTotal; later topics are counted under LabelOther
+const MaxContentGapTopics = 500
+
+var contentGapTopics = struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}{seen: make(map[string]bool)}
+
+// contentGapTopicLabel returns topic itself until MaxContentGapTopics
+// distinct topics have been seen, and LabelOther after that
+func contentGapTopicLabel(topic string) string {
+	if topic == "" {
+		return LabelNone
+	}
+	contentGapTopics.mu.Lock()
+	defer contentGapTopics.mu.Unlock()
+	if !contentGapTopics.seen[topic] {
+		if len(contentGapTopics.seen) >= MaxContentGapTopics {
+			return LabelOther
+		}
+		contentGapTopics.seen[topic] = true
+	}
+	return topic
+}
+
+// IncrementContentGaps counts a request no template could serve, so
+// authors can see which topics need more templates
+func IncrementContentGaps(examType, subject, topic string) {
+	ContentGapsTotal.WithLabelValues(
+		boundedLabel(examType, KnownExamTypes),
+		boundedLabel(subject, KnownSubjects),
+		contentGapTopicLabel(topic),
+	).Inc()
+}
+
+// Increment calibrations counter for source
+func IncrementCalibrations(source string) {
+	CalibrationsTotal.WithLabelValues(source).Inc()
 }
 
 // Increment BKT calls counter
 func IncrementBKTCalls() {
-	atomic.AddInt64(&BKTCalls, 1)
+	BKTCallsTotal.Inc()
+}
+
+// SetCircuitBreakerState publishes a downstream service's breaker state
+func SetCircuitBreakerState(service string, state int) {
+	CircuitBreakerState.WithLabelValues(service).Set(float64(state))
+}
+
+// ObservePipelineBreakdown records per-stage latencies from a generation
+// response's pipeline_breakdown metadata (keys like "template_ms")
+func ObservePipelineBreakdown(breakdown map[string]int64) {
+	for _, stage := range PipelineStages {
+		if ms, ok := breakdown[stage+"_ms"]; ok {
+			PipelineStageDuration.WithLabelValues(stage).Observe(float64(ms))
+		}
+	}
+}
+
+func uptimeSeconds() float64 {
+	return time.Since(StartTime).Seconds()
+}
+
+func avgResponseTimeMs() float64 {
+	var sum float64
+	var count uint64
+	for _, m := range gather(RequestDuration) {
+		sum += m.Histogram.GetSampleSum()
+		count += m.Histogram.GetSampleCount()
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+func successRate() float64 {
+	totalReqs := atomic.LoadInt64(&totalRequests)
+	if totalReqs == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&successfulRequests)) / float64(totalReqs) * 100
+}
+
+func requestsPerSecond() float64 {
+	return float64(atomic.LoadInt64(&totalRequests)) / uptimeSeconds()
 }
 
 // GetMetricsSummary returns current metrics summary
 func GetMetricsSummary() map[string]interface{} {
-	mutex.RLock()
-	defer mutex.RUnlock()
-	
-	uptime := time.Since(StartTime).Seconds()
-	totalReqs := atomic.LoadInt64(&TotalRequests)
-	successReqs := atomic.LoadInt64(&SuccessfulRequests)
-	totalRespTime := atomic.LoadInt64(&TotalResponseTime)
-	
-	avgResponseTime := float64(0)
-	if totalReqs > 0 {
-		avgResponseTime = float64(totalRespTime) / float64(totalReqs)
+	totalReqs := atomic.LoadInt64(&totalRequests)
+	successReqs := atomic.LoadInt64(&successfulRequests)
+
+	return map[string]interface{}{
+		"uptime_seconds":       uptimeSeconds(),
+		"total_requests":       totalReqs,
+		"successful_requests":  successReqs,
+		"failed_requests":      totalReqs - successReqs,
+		"avg_response_time_ms": avgResponseTimeMs(),
+		"success_rate":         successRate(),
+		"requests_per_second":  requestsPerSecond(),
+		"validation_errors":    collectorValue(ValidationErrorsTotal),
+		"rag_checks":           collectorValue(RAGChecksTotal),
+		"bkt_calls":            collectorValue(BKTCallsTotal),
+		"active_connections":   collectorValue(ActiveConnections),
+		"questions_generated":  collectorSum(QuestionsGeneratedTotal),
 	}
-	
-	successRate := float64(0)
-	if totalReqs > 0 {
-		successRate = float64(successReqs) / float64(totalReqs) * 100
+}
+
+// collectorSum adds up every series of a labelled counter
+func collectorSum(c prometheus.Collector) float64 {
+	var total float64
+	for _, m := range gather(c) {
+		total += m.Counter.GetValue()
 	}
-	
-	return map[string]interface{}{
-		"uptime_seconds":        uptime,
-		"total_requests":        totalReqs,
-		"successful_requests":   successReqs,
-		"failed_requests":       atomic.LoadInt64(&FailedRequests),
-		"avg_response_time_ms":  avgResponseTime,
-		"success_rate":          successRate,
-		"validation_errors":     atomic.LoadInt64(&ValidationErrors),
-		"rag_checks":            atomic.LoadInt64(&RAGChecks),
-		"bkt_calls":             atomic.LoadInt64(&BKTCalls),
-		"active_connections":    atomic.LoadInt64(&ActiveConnections),
-		"questions_generated":   atomic.LoadInt64(&QuestionsGenerated),
-		"requests_per_second":   float64(totalReqs) / uptime,
+	return total
+}
+
+// gather snapshots every series currently held by a collector
+func gather(c prometheus.Collector) []*dto.Metric {
+	ch := make(chan prometheus.Metric, 64)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	var out []*dto.Metric
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err == nil {
+			out = append(out, &pb)
+		}
+	}
+	return out
+}
+
+// collectorValue reads the current value of a single counter or gauge
+func collectorValue(m prometheus.Metric) float64 {
+	var out dto.Metric
+	if err := m.Write(&out); err != nil {
+		return 0
+	}
+	if out.Counter != nil {
+		return out.Counter.GetValue()
 	}
-}
\ No newline at end of file
+	return out.Gauge.GetValue()
+}
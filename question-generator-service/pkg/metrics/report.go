@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SummaryReport is the final snapshot of the in-process metrics, written
+// for short-lived runs that are never scraped
+type SummaryReport struct {
+	StartedAt time.Time              `json:"started_at"`
+	WrittenAt time.Time              `json:"written_at"`
+	Uptime    string                 `json:"uptime"` // e.g. "1m30.5s"
+	Metrics   map[string]interface{} `json:"metrics"`
+}
+
+// WriteSummaryReport writes GetMetricsSummary with the process's uptime to
+// path as JSON, replacing the file only once the report is complete
+func WriteSummaryReport(path string) error {
+	now := time.Now()
+	report := SummaryReport{
+		StartedAt: StartTime,
+		WrittenAt: now,
+		Uptime:    now.Sub(StartTime).Round(time.Millisecond).String(),
+		Metrics:   GetMetricsSummary(),
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode metrics report: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create metrics report directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create metrics report: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write metrics report: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write metrics report: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write metrics report: %w", err)
+	}
+	return nil
+}
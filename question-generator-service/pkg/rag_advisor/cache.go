@@ -0,0 +1,119 @@
+package rag_advisor
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QualityCache remembers RAG quality results by question content so that
+// identical generated questions are not re-checked. Entries expire after the
+// TTL and the least recently used entry is evicted once the cache is full.
+type QualityCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Front is most recently used
+	size    int
+	ttl     time.Duration
+}
+
+type cacheEntry struct {
+	key      string
+	resp     QualityCheckResponse
+	storedAt time.Time
+}
+
+// NewQualityCache holds up to size results for ttl each. A size of zero
+// disables caching.
+func NewQualityCache(size int, ttl time.Duration) *QualityCache {
+	return &QualityCache{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		size:    size,
+		ttl:     ttl,
+	}
+}
+
+// QualityCacheKey hashes the question text, with case and whitespace
+// normalized, together with every other field of the request, so that
+// checks differing in options, topic, difficulty or whether exemplars are
+// wanted never share a result
+func QualityCacheKey(req *QualityCheckRequest) string {
+	fields := []string{
+		strings.Join(strings.Fields(strings.ToLower(req.QuestionText)), " "),
+		req.Subject,
+		req.ExamType,
+		req.TopicID,
+		strconv.FormatFloat(req.BaseDiff, 'g', -1, 64),
+		strconv.FormatBool(req.IncludeExemplars),
+	}
+	keys := make([]string, 0, len(req.Options))
+	for key := range req.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fields = append(fields, key+"="+req.Options[key])
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns a copy of the cached result for key, if still fresh
+func (c *QualityCache) Get(key string) (*QualityCheckResponse, bool) {
+	if c.size <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Since(entry.storedAt) > c.ttl {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	resp := entry.resp
+	return &resp, true
+}
+
+// Put stores resp under key, evicting the least recently used entry when
+// the cache is full
+func (c *QualityCache) Put(key string, resp *QualityCheckResponse) {
+	if c.size <= 0 || resp == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.resp, entry.storedAt = *resp, time.Now()
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, resp: *resp, storedAt: time.Now()})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Len returns the number of entries held, including expired ones not yet
+// evicted
+func (c *QualityCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
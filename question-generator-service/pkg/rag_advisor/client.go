@@ -8,6 +8,11 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"question-generator-service/internal/config"
+	"question-generator-service/pkg/breaker"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/metrics"
 )
 
 // Client connects to RAG external service
@@ -16,19 +21,32 @@ type Client struct {
 	httpClient *http.Client
 	timeout    time.Duration
 	maxRetries int
+	retryDelay time.Duration
+	breaker    *breaker.Breaker
 }
 
-// NewClient creates a RAG client instance
-func NewClient(baseURL string, timeout time.Duration, maxRetries int) *Client {
+// NewClient creates a RAG client instance. Its circuit breaker publishes
+// state changes to the circuit_breaker_state metric.
+func NewClient(cfg config.RAGConfig) *Client {
 	return &Client{
-		baseURL: baseURL,
+		baseURL: cfg.ServiceURL,
 		httpClient: &http.Client{
-			Timeout: timeout,
+			Timeout: cfg.Timeout,
 		},
-		maxRetries: maxRetries,
+		timeout:    cfg.Timeout,
+		maxRetries: cfg.MaxRetries,
+		retryDelay: cfg.RetryDelay,
+		breaker: breaker.New("rag", cfg.CircuitBreaker, func(name string, state breaker.State) {
+			metrics.SetCircuitBreakerState(name, int(state))
+		}),
 	}
 }
 
+// BreakerState returns the state of the client's circuit breaker
+func (c *Client) BreakerState() breaker.State {
+	return c.breaker.State()
+}
+
 // QualityCheckRequest to be sent to RAG server
 type QualityCheckRequest struct {
 	QuestionText string            `json:"question_text"`
@@ -37,13 +55,23 @@ type QualityCheckRequest struct {
 	ExamType     string            `json:"exam_type"`
 	TopicID      string            `json:"topic_id"`
 	BaseDiff     float64           `json:"base_difficulty"`
+	// IncludeExemplars asks the server to return exemplar bodies, not just IDs
+	IncludeExemplars bool `json:"include_exemplars,omitempty"`
+}
+
+// Exemplar is a reference question the generated one was compared against
+type Exemplar struct {
+	ID         string  `json:"id"`
+	Text       string  `json:"text"`
+	Similarity float64 `json:"similarity"`
 }
 
 // QualityCheckResponse from RAG server
 type QualityCheckResponse struct {
-	AlignmentScore float64  `json:"alignment_score"`
-	ExemplarIDs    []string `json:"exemplar_ids"`
-	Feedback       string   `json:"feedback"`
+	AlignmentScore float64    `json:"alignment_score"`
+	ExemplarIDs    []string   `json:"exemplar_ids"`
+	Feedback       string     `json:"feedback"`
+	Exemplars      []Exemplar `json:"exemplars,omitempty"` // Only when requested
 }
 
 // CheckQuestionQuality sends question for RAG quality validation
@@ -56,14 +84,33 @@ func (c *Client) CheckQuestionQuality(ctx context.Context, req *QualityCheckRequ
 
 	var resp QualityCheckResponse
 	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(c.retryDelay << (attempt - 1)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		// While the breaker is open RAG is skipped at once instead of
+		// paying for retries against a degraded service
+		if openErr := c.breaker.Allow(); openErr != nil {
+			if err != nil {
+				return nil, fmt.Errorf("rag advisor unavailable: %w (last error: %v)", openErr, err)
+			}
+			return nil, fmt.Errorf("rag advisor unavailable: %w", openErr)
+		}
 		err = c.doRequest(ctx, url, requestBody, &resp)
 		if err == nil {
+			c.breaker.Record(true)
 			return &resp, nil
 		}
 		if ctx.Err() != nil {
+			// The caller gave up; that says nothing about the service
+			c.breaker.Release()
 			return nil, ctx.Err()
 		}
-		time.Sleep(time.Duration(100*(attempt+1)) * time.Millisecond)
+		c.breaker.Record(false)
 	}
 	return nil, fmt.Errorf("rag advisor request failed after retries: %w", err)
 }
@@ -74,6 +121,7 @@ func (c *Client) doRequest(ctx context.Context, url string, body []byte, respObj
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	logging.SetRequestIDHeader(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -4,26 +4,8 @@ import (
 	"context"
 	"log"
 	"net/http"
-	"time"
 )
 
-// Service wraps the RAG advisor client for middleware use
-type Service struct {
-	client     *Client
-	enabled    bool
-	threshold  float64
-}
-
-// NewService creates a new RAG advisor service
-func NewService(ragURL string, enabled bool, threshold float64) *Service {
-	client := NewClient(ragURL, 3*time.Second, 2)
-	return &Service{
-		client:    client,
-		enabled:   enabled,
-		threshold: threshold,
-	}
-}
-
 // AdviseQuality is a middleware that provides quality advice on generated questions
 func AdviseQuality(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -2,27 +2,98 @@ package rag_advisor
 
 import (
 	"context"
+	"errors"
 	"fmt"
+
+	"question-generator-service/internal/config"
+	"question-generator-service/pkg/breaker"
+	"question-generator-service/pkg/metrics"
 )
 
+// ErrLowAlignment is returned by QualityCheck, along with the response, when
+// the RAG service answered but the question scored below the alignment
+// threshold. Any other error means the check itself failed.
+var ErrLowAlignment = errors.New("alignment score below threshold")
+
 // Service encapsulates QA logic using Client
 type Service struct {
-	client *Client
+	client   *Client
+	enabled  bool
+	rag      config.RAGConfig
+	settings *config.Holder
+	cache    *QualityCache
+}
+
+// NewService creates new QA service instance from the RAG settings
+func NewService(cfg config.RAGConfig) (*Service, error) {
+	if cfg.ServiceURL == "" {
+		return nil, fmt.Errorf("RAG service URL is required")
+	}
+	return &Service{
+		client:  NewClient(cfg),
+		enabled: cfg.Enabled,
+		rag:     cfg,
+		cache:   NewQualityCache(cfg.CacheSize, cfg.CacheTTL),
+	}, nil
 }
 
-// NewService creates new QA service instance
-func NewService(client *Client) *Service {
-	return &Service{client: client}
+// UseSettings makes the service read its alignment thresholds from settings,
+// so configuration reloads apply without a restart
+func (s *Service) UseSettings(settings *config.Holder) {
+	s.settings = settings
 }
 
-// QualityCheck performs alignment check for a question
-func (s *Service) QualityCheck(ctx context.Context, req *QualityCheckRequest) (*QualityCheckResponse, error) {
+// Threshold returns the global alignment score a question must reach
+func (s *Service) Threshold() float64 {
+	return s.current().AlignmentThreshold
+}
+
+// ThresholdFor returns the alignment score a question in subject must
+// reach, using the subject's override when one is configured
+func (s *Service) ThresholdFor(subject string) float64 {
+	return s.current().ThresholdFor(subject)
+}
+
+func (s *Service) current() config.RAGConfig {
+	if s.settings != nil {
+		return s.settings.Get().RAG
+	}
+	return s.rag
+}
+
+// BreakerState returns the state of the RAG client's circuit breaker
+func (s *Service) BreakerState() breaker.State {
+	return s.client.BreakerState()
+}
+
+// CheckQuestionQuality returns the RAG alignment for a question without
+// applying the threshold, leaving the decision to the caller. Results for
+// identical questions are served from the cache while fresh.
+func (s *Service) CheckQuestionQuality(ctx context.Context, req *QualityCheckRequest) (*QualityCheckResponse, error) {
+	key := QualityCacheKey(req)
+	if resp, ok := s.cache.Get(key); ok {
+		metrics.IncrementRAGCacheHits()
+		return resp, nil
+	}
 	resp, err := s.client.CheckQuestionQuality(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Put(key, resp)
+	return resp, nil
+}
+
+// QualityCheck performs alignment check for a question against the
+// configured threshold for its subject. A score below it returns the
+// response together with ErrLowAlignment; a failed check returns no
+// response.
+func (s *Service) QualityCheck(ctx context.Context, req *QualityCheckRequest) (*QualityCheckResponse, error) {
+	resp, err := s.CheckQuestionQuality(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("rag quality check failed: %w", err)
 	}
-	if resp.AlignmentScore < 0.7 {
-		return resp, fmt.Errorf("alignment score %.2f below threshold", resp.AlignmentScore)
+	if threshold := s.ThresholdFor(req.Subject); resp.AlignmentScore < threshold {
+		return resp, fmt.Errorf("%w: %.2f < %.2f", ErrLowAlignment, resp.AlignmentScore, threshold)
 	}
 	return resp, nil
 }
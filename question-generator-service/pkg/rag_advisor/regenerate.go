@@ -0,0 +1,97 @@
+package rag_advisor
+
+import (
+	"context"
+	"fmt"
+)
+
+// GenerateFunc produces the candidate for a 1-based attempt number and returns
+// the request used to score it
+type GenerateFunc func(ctx context.Context, attempt int) (*QualityCheckRequest, error)
+
+// CheckFunc scores a candidate against the RAG exemplars
+type CheckFunc func(ctx context.Context, req *QualityCheckRequest) (*QualityCheckResponse, error)
+
+// Attempt records the outcome of one generation attempt
+type Attempt struct {
+	Number         int
+	AlignmentScore float64
+	Response       *QualityCheckResponse
+	Err            error
+}
+
+// RegenerationResult summarises a RegenerateUntilAligned run
+type RegenerationResult struct {
+	Attempts    []Attempt
+	BestAttempt int  // 1-based attempt number of the best candidate, 0 if none scored
+	Aligned     bool // Whether the best candidate cleared the threshold
+}
+
+// Best returns the best-scoring attempt, or nil if no attempt was scored
+func (r *RegenerationResult) Best() *Attempt {
+	if r.BestAttempt == 0 {
+		return nil
+	}
+	return &r.Attempts[r.BestAttempt-1]
+}
+
+// RegenerateUntilAligned generates and scores candidates until one reaches
+// threshold, making at most maxRetries additional attempts after the first.
+// When no candidate clears the threshold the best-scoring one is reported.
+// A scoring failure stops the loop and is recorded on the last attempt; a
+// generation failure aborts unless an earlier candidate was already scored.
+// Cancelling ctx is treated the same way, and returns ctx.Err() when nothing
+// has been scored yet.
+func RegenerateUntilAligned(ctx context.Context, maxRetries int, threshold float64, generate GenerateFunc, check CheckFunc) (*RegenerationResult, error) {
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+
+	result := &RegenerationResult{}
+	for attempt := 1; attempt <= maxRetries+1; attempt++ {
+		if err := ctx.Err(); err != nil {
+			if result.BestAttempt > 0 {
+				return result, nil
+			}
+			return result, err
+		}
+
+		req, err := generate(ctx, attempt)
+		if err != nil {
+			if result.BestAttempt > 0 {
+				// Keep the best candidate we already have
+				return result, nil
+			}
+			return result, fmt.Errorf("generation attempt %d failed: %w", attempt, err)
+		}
+
+		resp, err := check(ctx, req)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				if result.BestAttempt > 0 {
+					return result, nil
+				}
+				return result, ctxErr
+			}
+			// The advisor is unavailable; regenerating would not help
+			result.Attempts = append(result.Attempts, Attempt{Number: attempt, Err: err})
+			return result, nil
+		}
+
+		result.Attempts = append(result.Attempts, Attempt{
+			Number:         attempt,
+			AlignmentScore: resp.AlignmentScore,
+			Response:       resp,
+		})
+		if best := result.Best(); best == nil || resp.AlignmentScore > best.AlignmentScore {
+			result.BestAttempt = len(result.Attempts)
+		}
+
+		if resp.AlignmentScore >= threshold {
+			result.Aligned = true
+			return result, nil
+		}
+	}
+
+	return result, nil
+}
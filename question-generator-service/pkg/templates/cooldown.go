@@ -0,0 +1,100 @@
+package templates
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// cooldownPenalty is subtracted from the score of a template served just
+// now. It outweighs every scoring factor combined, so a cooling template is
+// only served when nothing else matches, and shrinks linearly to zero as
+// its cool-down runs out.
+const cooldownPenalty = 1.0
+
+// cooldownSweepInterval is how many served templates pass between sweeps of
+// templates whose cool-down has ended
+const cooldownSweepInterval = 256
+
+// Cooldown deprioritizes templates for a while after they are served, so
+// that popular templates do not dominate selection the way the slowly
+// decaying usage freshness lets them. A template cools down while the
+// service serves its next Selections questions, or for Duration, whichever
+// ends first; a zero limit is not applied. State is kept in memory, so each
+// replica cools down the templates it served itself.
+type Cooldown struct {
+	mu         sync.Mutex
+	selections int
+	duration   time.Duration
+	served     map[string]cooldownEntry
+	count      int64 // Selections recorded so far
+}
+
+type cooldownEntry struct {
+	at    time.Time
+	count int64 // Selections recorded before this one
+}
+
+// NewCooldown cools templates down for selections further selections or
+// for duration. With both zero the cool-down is disabled.
+func NewCooldown(selections int, duration time.Duration) *Cooldown {
+	return &Cooldown{
+		selections: selections,
+		duration:   duration,
+		served:     make(map[string]cooldownEntry),
+	}
+}
+
+func (c *Cooldown) enabled() bool {
+	return c != nil && (c.selections > 0 || c.duration > 0)
+}
+
+// Served records that templateID was just selected, restarting its
+// cool-down
+func (c *Cooldown) Served(templateID string) {
+	if !c.enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.served[templateID] = cooldownEntry{at: now, count: c.count}
+	c.count++
+	if c.count%cooldownSweepInterval == 0 {
+		for id, entry := range c.served {
+			if c.remaining(entry, now) == 0 {
+				delete(c.served, id)
+			}
+		}
+	}
+}
+
+// Remaining returns how much of templateID's cool-down is left, from 1 for
+// a template served just now down to 0 once it has recovered
+func (c *Cooldown) Remaining(templateID string) float64 {
+	if !c.enabled() {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.served[templateID]
+	if !ok {
+		return 0
+	}
+	return c.remaining(entry, time.Now())
+}
+
+// remaining is the smaller share left of the configured limits
+func (c *Cooldown) remaining(entry cooldownEntry, now time.Time) float64 {
+	left := 1.0
+	if c.selections > 0 {
+		since := float64(c.count - entry.count - 1) // Selections made after this one
+		left = math.Min(left, 1-since/float64(c.selections))
+	}
+	if c.duration > 0 {
+		left = math.Min(left, 1-float64(now.Sub(entry.at))/float64(c.duration))
+	}
+	return math.Max(left, 0)
+}
@@ -0,0 +1,84 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrCorrectAnswerNotInOptions is returned when no MCQ option matches the correct answer
+	ErrCorrectAnswerNotInOptions = errors.New("correct answer does not match any option")
+	// ErrCorrectAnswerAmbiguous is returned when more than one MCQ option matches the correct answer
+	ErrCorrectAnswerAmbiguous = errors.New("correct answer matches more than one option")
+)
+
+// answerReplacer maps typographic variants onto a single spelling before comparison
+var answerReplacer = strings.NewReplacer(
+	"²", "^2",
+	"³", "^3",
+	"−", "-",
+	"·", "*",
+	"×", "*",
+)
+
+// VerifyCorrectAnswer checks that correctAnswer matches exactly one of the
+// MCQ options and returns that option's key. Comparison ignores case,
+// whitespace and numeric formatting, so "9.80 m/s" matches "9.8m/s".
+func VerifyCorrectAnswer(correctAnswer string, options map[string]string) (string, error) {
+	want := NormalizeAnswer(correctAnswer)
+	if want == "" {
+		return "", fmt.Errorf("%w: correct answer is empty", ErrCorrectAnswerNotInOptions)
+	}
+
+	var matches []string
+	for key, option := range options {
+		if NormalizeAnswer(option) == want {
+			matches = append(matches, key)
+		}
+	}
+	sort.Strings(matches)
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w: %q not found among %d options", ErrCorrectAnswerNotInOptions, correctAnswer, len(options))
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%w: %q matches options %s", ErrCorrectAnswerAmbiguous, correctAnswer, strings.Join(matches, ", "))
+	}
+}
+
+// NormalizeAnswer lowercases s, drops all whitespace and rewrites a leading
+// number in canonical form so equivalent answers compare equal
+func NormalizeAnswer(s string) string {
+	s = answerReplacer.Replace(strings.ToLower(s))
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+
+	if s == "" || !strings.ContainsRune("0123456789+-.", rune(s[0])) {
+		return s
+	}
+
+	// Split off the longest numeric prefix, e.g. "9.80" from "9.80m/s"
+	end := 0
+	for i := len(s); i > 0; i-- {
+		if _, err := strconv.ParseFloat(s[:i], 64); err == nil {
+			end = i
+			break
+		}
+	}
+	if end == 0 {
+		return s
+	}
+
+	value, _ := strconv.ParseFloat(s[:end], 64)
+	return strconv.FormatFloat(value, 'g', -1, 64) + s[end:]
+}
@@ -0,0 +1,503 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/pkg/units"
+)
+
+// AssertionReason is the statement pair of an ASSERTION_REASON question
+type AssertionReason struct {
+	Assertion string `json:"assertion"`
+	Reason    string `json:"reason"`
+}
+
+// AssertionReasonOptions are the standard answer choices of an
+// ASSERTION_REASON question, relating the assertion (A) to the reason (R)
+var AssertionReasonOptions = map[string]string{
+	"A": "Both A and R are true and R is the correct explanation of A",
+	"B": "Both A and R are true but R is not the correct explanation of A",
+	"C": "A is true but R is false",
+	"D": "A is false but R is true",
+}
+
+// assertionReasonSpec is the options_template of an ASSERTION_REASON
+// template. Assertion and reason may use the template's {{variables}}.
+type assertionReasonSpec struct {
+	Assertion      string `json:"assertion"`
+	Reason         string `json:"reason"`
+	AssertionTrue  *bool  `json:"assertion_true"`
+	ReasonTrue     *bool  `json:"reason_true"`
+	ReasonExplains bool   `json:"reason_explains"` // Only read when both statements are true
+}
+
+// MatrixItem is one labelled entry of a MATRIX_MATCH column
+type MatrixItem struct {
+	Label string `json:"label"`
+	Text  string `json:"text"`
+}
+
+// MatrixMatch holds the two columns of a MATRIX_MATCH question and the
+// Column II entry each Column I entry matches
+type MatrixMatch struct {
+	Left    []MatrixItem      `json:"left"`
+	Right   []MatrixItem      `json:"right"`
+	Mapping map[string]string `json:"mapping"` // Column I label to Column II label
+}
+
+// matrixMatchSpec is the options_template of a MATRIX_MATCH template. Each
+// pair is a Column I entry and the Column II entry it matches; distractors
+// are extra Column II entries that match nothing. Texts may use the
+// template's {{variables}}.
+type matrixMatchSpec struct {
+	Pairs []struct {
+		Left  string `json:"left"`
+		Right string `json:"right"`
+	} `json:"pairs"`
+	Distractors []string `json:"distractors,omitempty"`
+}
+
+// matrixLeftLabels label Column I entries; Column II is numbered from 1
+var matrixLeftLabels = []string{"P", "Q", "R", "S", "T", "U"}
+
+// matrixOptionKeys are the keys of a MATRIX_MATCH question's mapping options
+var matrixOptionKeys = []string{"A", "B", "C", "D"}
+
+// mcqOptionsSpec is the options_template of an MCQ template: the text of
+// options A to D, which may use the template's {{variables}}. Exactly one
+// must fill to the template's correct answer, e.g.
+//
+//	{"options": {"A": "{{v}} m/s", "B": "{{v0}} m/s", "C": "{{a}} m/s", "D": "0 m/s"}}
+type mcqOptionsSpec struct {
+	Options map[string]string `json:"options"`
+}
+
+// mcqOptionKeys are the keys an MCQ options template must define
+var mcqOptionKeys = []string{"A", "B", "C", "D"}
+
+// PassageTemplate is the options_template of a PASSAGE template: the
+// sub-questions asked about the passage in template_text. Sub-questions
+// may use the passage's {{variables}}, so they all see the same values.
+type PassageTemplate struct {
+	Questions []PassageQuestionTemplate `json:"questions"`
+}
+
+// PassageQuestionTemplate is one sub-question of a PassageTemplate. A
+// numeric sub-question gives an answer formula, evaluated like the
+// template's own, instead of a filled answer.
+type PassageQuestionTemplate struct {
+	Text          string            `json:"text"`
+	Options       map[string]string `json:"options,omitempty"`        // MCQ sub-questions only
+	Answer        string            `json:"answer,omitempty"`         // Must match one option when there are options
+	AnswerFormula string            `json:"answer_formula,omitempty"` // Computed answer instead of answer
+	AnswerUnit    string            `json:"answer_unit,omitempty"`    // Unit of the answer formula's result
+}
+
+// Passage is a filled shared passage with its sub-questions
+type Passage struct {
+	PassageID string            `json:"passage_id"`
+	Text      string            `json:"text"`
+	Questions []PassageQuestion `json:"questions"`
+}
+
+// PassageQuestion is one filled sub-question of a Passage
+type PassageQuestion struct {
+	QuestionID    string            `json:"question_id"` // Passage ID with the sub-question's number
+	QuestionText  string            `json:"question_text"`
+	Options       map[string]string `json:"options,omitempty"`
+	CorrectAnswer string            `json:"correct_answer"`
+}
+
+// formatQuestion is the format-specific part of a filled question
+type formatQuestion struct {
+	text            string // Appended to the filled template text
+	options         map[string]string
+	correctAnswer   string
+	assertionReason *AssertionReason
+	matrixMatch     *MatrixMatch
+	passage         *Passage
+}
+
+// parseAssertionReasonSpec parses an ASSERTION_REASON options template and
+// returns the key of the standard option its truth values call for
+func parseAssertionReasonSpec(optionsTemplate *string) (*assertionReasonSpec, string, error) {
+	var spec assertionReasonSpec
+	if err := decodeFormatSpec(optionsTemplate, &spec); err != nil {
+		return nil, "", err
+	}
+	if spec.Assertion == "" || spec.Reason == "" {
+		return nil, "", fmt.Errorf("assertion and reason are required")
+	}
+	if spec.AssertionTrue == nil || spec.ReasonTrue == nil {
+		return nil, "", fmt.Errorf("assertion_true and reason_true are required")
+	}
+
+	switch {
+	case *spec.AssertionTrue && *spec.ReasonTrue && spec.ReasonExplains:
+		return &spec, "A", nil
+	case *spec.AssertionTrue && *spec.ReasonTrue:
+		return &spec, "B", nil
+	case *spec.AssertionTrue:
+		return &spec, "C", nil
+	case *spec.ReasonTrue:
+		return &spec, "D", nil
+	default:
+		return nil, "", fmt.Errorf("no standard option fits a false assertion with a false reason")
+	}
+}
+
+// fillAssertionReason fills the assertion and reason of an ASSERTION_REASON
+// template and picks the standard option that relates them
+func (s *Service) fillAssertionReason(optionsTemplate *string, fill func(string) (string, error)) (*formatQuestion, error) {
+	spec, key, err := parseAssertionReasonSpec(optionsTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	assertion, err := fill(spec.Assertion)
+	if err != nil {
+		return nil, fmt.Errorf("assertion: %w", err)
+	}
+	reason, err := fill(spec.Reason)
+	if err != nil {
+		return nil, fmt.Errorf("reason: %w", err)
+	}
+
+	options := make(map[string]string, len(AssertionReasonOptions))
+	for k, v := range AssertionReasonOptions {
+		options[k] = v
+	}
+	return &formatQuestion{
+		text:            fmt.Sprintf("\n\nAssertion (A): %s\nReason (R): %s", assertion, reason),
+		options:         options,
+		correctAnswer:   options[key],
+		assertionReason: &AssertionReason{Assertion: assertion, Reason: reason},
+	}, nil
+}
+
+// parseMatrixMatchSpec parses a MATRIX_MATCH options template, checking
+// there are enough Column II entries for four distinct mapping options
+func parseMatrixMatchSpec(optionsTemplate *string) (*matrixMatchSpec, error) {
+	var spec matrixMatchSpec
+	if err := decodeFormatSpec(optionsTemplate, &spec); err != nil {
+		return nil, err
+	}
+	if len(spec.Pairs) < 2 || len(spec.Pairs) > len(matrixLeftLabels) {
+		return nil, fmt.Errorf("must have between 2 and %d pairs, got %d", len(matrixLeftLabels), len(spec.Pairs))
+	}
+	if injections(len(spec.Pairs)+len(spec.Distractors), len(spec.Pairs)) < len(matrixOptionKeys) {
+		return nil, fmt.Errorf("needs more pairs or distractors for %d distinct options", len(matrixOptionKeys))
+	}
+	return &spec, nil
+}
+
+// fillMatrixMatch fills the columns of a MATRIX_MATCH template, shuffles
+// Column II and offers the correct mapping among three wrong ones
+func fillMatrixMatch(rng *rand.Rand, optionsTemplate *string, fill func(string) (string, error)) (*formatQuestion, error) {
+	spec, err := parseMatrixMatchSpec(optionsTemplate)
+	if err != nil {
+		return nil, err
+	}
+	rightCount := len(spec.Pairs) + len(spec.Distractors)
+
+	matrix := &MatrixMatch{Mapping: make(map[string]string, len(spec.Pairs))}
+	rightTexts := make([]string, 0, rightCount)
+	for i, pair := range spec.Pairs {
+		left, err := fill(pair.Left)
+		if err != nil {
+			return nil, fmt.Errorf("pairs[%d].left: %w", i, err)
+		}
+		right, err := fill(pair.Right)
+		if err != nil {
+			return nil, fmt.Errorf("pairs[%d].right: %w", i, err)
+		}
+		matrix.Left = append(matrix.Left, MatrixItem{Label: matrixLeftLabels[i], Text: left})
+		rightTexts = append(rightTexts, right)
+	}
+	for i, distractor := range spec.Distractors {
+		right, err := fill(distractor)
+		if err != nil {
+			return nil, fmt.Errorf("distractors[%d]: %w", i, err)
+		}
+		rightTexts = append(rightTexts, right)
+	}
+
+	// Shuffle Column II so the answer is not always P-1, Q-2, ...; the
+	// first len(Pairs) texts are the matches of Column I in order
+	order := rng.Perm(rightCount)
+	positions := make([]int, rightCount)
+	for position, index := range order {
+		positions[index] = position
+		matrix.Right = append(matrix.Right, MatrixItem{Label: strconv.Itoa(position + 1), Text: rightTexts[index]})
+	}
+	correct := make([]int, len(spec.Pairs))
+	for i, item := range matrix.Left {
+		correct[i] = positions[i]
+		matrix.Mapping[item.Label] = strconv.Itoa(positions[i] + 1)
+	}
+
+	// Wrong options are other one-to-one mappings, drawn until three
+	// distinct ones are found
+	mappings := [][]int{correct}
+	seen := map[string]bool{formatMapping(correct): true}
+	for len(mappings) < len(matrixOptionKeys) {
+		candidate := rng.Perm(rightCount)[:len(spec.Pairs)]
+		if key := formatMapping(candidate); !seen[key] {
+			seen[key] = true
+			mappings = append(mappings, candidate)
+		}
+	}
+	rng.Shuffle(len(mappings), func(i, j int) { mappings[i], mappings[j] = mappings[j], mappings[i] })
+
+	options := make(map[string]string, len(matrixOptionKeys))
+	for i, key := range matrixOptionKeys {
+		options[key] = formatMapping(mappings[i])
+	}
+
+	var text strings.Builder
+	text.WriteString("\n\nColumn I")
+	for _, item := range matrix.Left {
+		fmt.Fprintf(&text, "\n%s. %s", item.Label, item.Text)
+	}
+	text.WriteString("\nColumn II")
+	for _, item := range matrix.Right {
+		fmt.Fprintf(&text, "\n%s. %s", item.Label, item.Text)
+	}
+
+	return &formatQuestion{
+		text:          text.String(),
+		options:       options,
+		correctAnswer: formatMapping(correct),
+		matrixMatch:   matrix,
+	}, nil
+}
+
+// parsePassageTemplate parses a PASSAGE options template
+func parsePassageTemplate(optionsTemplate *string) (*PassageTemplate, error) {
+	var spec PassageTemplate
+	if err := decodeFormatSpec(optionsTemplate, &spec); err != nil {
+		return nil, err
+	}
+	if len(spec.Questions) == 0 {
+		return nil, fmt.Errorf("must have at least one question")
+	}
+	for i, q := range spec.Questions {
+		hasAnswer := strings.TrimSpace(q.Answer) != ""
+		hasFormula := strings.TrimSpace(q.AnswerFormula) != ""
+		if strings.TrimSpace(q.Text) == "" || hasAnswer == hasFormula {
+			return nil, fmt.Errorf("questions[%d] needs text and either answer or answer_formula", i)
+		}
+		if hasFormula {
+			if _, err := parseFormula(q.AnswerFormula); err != nil {
+				return nil, fmt.Errorf("questions[%d].answer_formula: %w", i, err)
+			}
+		}
+		if q.AnswerUnit != "" {
+			if !hasFormula {
+				return nil, fmt.Errorf("questions[%d].answer_unit needs answer_formula", i)
+			}
+			if _, err := units.Parse(q.AnswerUnit); err != nil {
+				return nil, fmt.Errorf("questions[%d].answer_unit: %w", i, err)
+			}
+		}
+	}
+	return &spec, nil
+}
+
+// fillPassage fills every sub-question of a PASSAGE template from the
+// passage's variables. The passage ID is derived from the template and
+// seed, so a replayed seed yields the same IDs. Answer formulas are
+// evaluated against the same variables and written at the template's
+// answer precision.
+func (s *Service) fillPassage(template *db.QuestionTemplate, seed int64, passageText string, variables map[string]interface{}, fill func(string) (string, error)) (*formatQuestion, error) {
+	spec, err := parsePassageTemplate(template.OptionsTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	passage := &Passage{PassageID: fmt.Sprintf("p_%s_%d", template.TemplateID, seed), Text: passageText}
+	var text strings.Builder
+	answers := make([]string, len(spec.Questions))
+	for i, q := range spec.Questions {
+		field := fmt.Sprintf("questions[%d]", i)
+		sub := PassageQuestion{QuestionID: fmt.Sprintf("%s_%d", passage.PassageID, i+1)}
+		if sub.QuestionText, err = fill(q.Text); err != nil {
+			return nil, fmt.Errorf("%s.text: %w", field, err)
+		}
+		if q.AnswerFormula != "" {
+			var unit *string
+			if q.AnswerUnit != "" {
+				unit = &q.AnswerUnit
+			}
+			answer, err := formulaAnswer(q.AnswerFormula, unit, variables)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field, err)
+			}
+			sub.CorrectAnswer = CanonicalAnswer(answer, template.AnswerPrecision)
+		} else if sub.CorrectAnswer, err = fill(q.Answer); err != nil {
+			return nil, fmt.Errorf("%s.answer: %w", field, err)
+		}
+		if len(q.Options) > 0 {
+			sub.Options = make(map[string]string, len(q.Options))
+			for key, option := range q.Options {
+				if sub.Options[key], err = fill(option); err != nil {
+					return nil, fmt.Errorf("%s.options.%s: %w", field, key, err)
+				}
+			}
+			if _, err := VerifyCorrectAnswer(sub.CorrectAnswer, sub.Options); err != nil {
+				return nil, fmt.Errorf("%s: %w", field, err)
+			}
+		}
+		passage.Questions = append(passage.Questions, sub)
+
+		fmt.Fprintf(&text, "\n\n%d. %s", i+1, sub.QuestionText)
+		for _, key := range sortedKeys(sub.Options) {
+			fmt.Fprintf(&text, "\n(%s) %s", key, sub.Options[key])
+		}
+		answers[i] = fmt.Sprintf("%d. %s", i+1, sub.CorrectAnswer)
+	}
+
+	return &formatQuestion{
+		text:          text.String(),
+		correctAnswer: strings.Join(answers, "; "),
+		passage:       passage,
+	}, nil
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatMapping renders a mapping of Column I entries onto zero-based
+// Column II positions as "P-2, Q-4, R-1"
+func formatMapping(mapping []int) string {
+	parts := make([]string, len(mapping))
+	for i, position := range mapping {
+		parts[i] = fmt.Sprintf("%s-%d", matrixLeftLabels[i], position+1)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// injections counts the one-to-one mappings of k items into n, n!/(n-k)!
+func injections(n, k int) int {
+	count := 1
+	for i := 0; i < k; i++ {
+		count *= n - i
+	}
+	return count
+}
+
+// parseMCQOptionsSpec parses an MCQ options template, checking it defines
+// each of mcqOptionKeys once with distinct, non-empty texts
+func parseMCQOptionsSpec(optionsTemplate *string) (*mcqOptionsSpec, error) {
+	if optionsTemplate != nil && strings.TrimSpace(*optionsTemplate) == "" {
+		return nil, fmt.Errorf("is empty")
+	}
+	var spec mcqOptionsSpec
+	if err := decodeFormatSpec(optionsTemplate, &spec); err != nil {
+		return nil, err
+	}
+	if len(spec.Options) != len(mcqOptionKeys) {
+		return nil, fmt.Errorf("must have exactly %d options %s, got %d",
+			len(mcqOptionKeys), strings.Join(mcqOptionKeys, ", "), len(spec.Options))
+	}
+	for _, key := range mcqOptionKeys {
+		text, ok := spec.Options[key]
+		if !ok {
+			return nil, fmt.Errorf("is missing option %s", key)
+		}
+		if strings.TrimSpace(text) == "" {
+			return nil, fmt.Errorf("option %s is empty", key)
+		}
+	}
+	if err := distinctOptions(spec.Options); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// fillMCQOptions fills the option texts of an MCQ template, failing when
+// the values make two options read the same
+func fillMCQOptions(optionsTemplate *string, fill func(string) (string, error)) (map[string]string, error) {
+	spec, err := parseMCQOptionsSpec(optionsTemplate)
+	if err != nil {
+		return nil, err
+	}
+	options := make(map[string]string, len(mcqOptionKeys))
+	for _, key := range mcqOptionKeys {
+		if options[key], err = fill(spec.Options[key]); err != nil {
+			return nil, fmt.Errorf("option %s: %w", key, err)
+		}
+	}
+	if err := distinctOptions(options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// distinctOptions reports the first two options, in key order, whose texts
+// are the same answer
+func distinctOptions(options map[string]string) error {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	seen := make(map[string]string, len(options))
+	for _, key := range keys {
+		normalized := NormalizeAnswer(options[key])
+		if first, ok := seen[normalized]; ok {
+			return fmt.Errorf("options %s and %s both read %q", first, key, options[key])
+		}
+		seen[normalized] = key
+	}
+	return nil
+}
+
+// decodeFormatSpec parses a format's options_template, rejecting unknown
+// keys so that misspelt fields fail loudly
+func decodeFormatSpec(optionsTemplate *string, spec interface{}) error {
+	if optionsTemplate == nil || strings.TrimSpace(*optionsTemplate) == "" {
+		return fmt.Errorf("is required")
+	}
+	decoder := json.NewDecoder(strings.NewReader(*optionsTemplate))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(spec); err != nil {
+		return fmt.Errorf("must be a JSON object of the format's fields: %w", err)
+	}
+	return nil
+}
+
+// validateFormatSpec checks the options template of formats that describe
+// their statements, columns, sub-questions or options there
+func validateFormatSpec(errs *fieldErrors, format string, optionsTemplate *string) {
+	var err error
+	switch format {
+	case "ASSERTION_REASON":
+		_, _, err = parseAssertionReasonSpec(optionsTemplate)
+	case "MATRIX_MATCH":
+		_, err = parseMatrixMatchSpec(optionsTemplate)
+	case "PASSAGE":
+		_, err = parsePassageTemplate(optionsTemplate)
+	case "MCQ":
+		// MCQ templates may leave their options to the pipeline
+		if optionsTemplate != nil {
+			_, err = parseMCQOptionsSpec(optionsTemplate)
+		}
+	}
+	if err != nil {
+		errs.add("options_template", "%v for %s templates", err, format)
+	}
+}
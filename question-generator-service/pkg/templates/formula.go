@@ -0,0 +1,337 @@
+package templates
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Formulas are arithmetic over {{variable}} placeholders, used by computed
+// variables and a template's answer_formula: numbers, + - * / and ^ (power,
+// right associative), unary minus, parentheses, the constant pi and the
+// functions below. Trigonometric functions take radians.
+var formulaFunctions = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"exp":   math.Exp,
+	"ln":    math.Log,
+	"log10": math.Log10,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+}
+
+// formula is a parsed formula, ready to be evaluated for any values of its
+// variables
+type formula struct {
+	root      formulaNode
+	variables []string // Placeholders in order of first use
+}
+
+type formulaNode interface {
+	eval(values map[string]float64) (float64, error)
+}
+
+type (
+	numberNode   float64
+	variableNode string
+	negateNode   struct{ operand formulaNode }
+	binaryNode   struct {
+		op          byte
+		left, right formulaNode
+	}
+	callNode struct {
+		name string
+		fn   func(float64) float64
+		arg  formulaNode
+	}
+)
+
+func (n numberNode) eval(map[string]float64) (float64, error) { return float64(n), nil }
+
+func (n variableNode) eval(values map[string]float64) (float64, error) {
+	value, ok := values[string(n)]
+	if !ok {
+		return 0, fmt.Errorf("variable %s has no numeric value", string(n))
+	}
+	return value, nil
+}
+
+func (n negateNode) eval(values map[string]float64) (float64, error) {
+	v, err := n.operand.eval(values)
+	return -v, err
+}
+
+func (n binaryNode) eval(values map[string]float64) (float64, error) {
+	a, err := n.left.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	b, err := n.right.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case '+':
+		return a + b, nil
+	case '-':
+		return a - b, nil
+	case '*':
+		return a * b, nil
+	case '/':
+		if b == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return a / b, nil
+	default:
+		return math.Pow(a, b), nil
+	}
+}
+
+func (n callNode) eval(values map[string]float64) (float64, error) {
+	v, err := n.arg.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	return n.fn(v), nil
+}
+
+// parseFormula parses src, reporting the position of the first syntax error
+func parseFormula(src string) (*formula, error) {
+	p := &formulaParser{src: src}
+	root, err := p.expr()
+	if err == nil && p.skipSpace() < len(src) {
+		err = p.errorf("unexpected %q", src[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("formula %q: %w", src, err)
+	}
+	return &formula{root: root, variables: p.variables}, nil
+}
+
+// evaluate computes the formula with the numeric values in variables. A
+// result that is not a finite number, such as the square root of a
+// negative value, is an error.
+func (f *formula) evaluate(variables map[string]interface{}) (float64, error) {
+	values := make(map[string]float64, len(f.variables))
+	for _, name := range f.variables {
+		if number, ok := toFloat(variables[name]); ok {
+			values[name] = number
+		}
+	}
+	result, err := f.root.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return result, nil
+}
+
+// evaluateFormula parses and evaluates src with the given variable values
+func evaluateFormula(src string, variables map[string]interface{}) (float64, error) {
+	f, err := parseFormula(src)
+	if err != nil {
+		return 0, err
+	}
+	value, err := f.evaluate(variables)
+	if err != nil {
+		return 0, fmt.Errorf("formula %q: %w", src, err)
+	}
+	return value, nil
+}
+
+// formulaParser is a recursive descent parser over
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/") unary }
+//	unary   = ("-" | "+") unary | power
+//	power   = primary [ "^" unary ]
+//	primary = number | "{{" name "}}" | "pi" | function "(" expr ")" | "(" expr ")"
+type formulaParser struct {
+	src       string
+	pos       int
+	variables []string
+}
+
+func (p *formulaParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// skipSpace advances past whitespace and returns the new position
+func (p *formulaParser) skipSpace() int {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	return p.pos
+}
+
+// accept consumes op if it is next
+func (p *formulaParser) accept(op byte) bool {
+	if p.skipSpace() < len(p.src) && p.src[p.pos] == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *formulaParser) expr() (formulaNode, error) {
+	left, err := p.term()
+	for err == nil {
+		var op byte
+		switch {
+		case p.accept('+'):
+			op = '+'
+		case p.accept('-'):
+			op = '-'
+		default:
+			return left, nil
+		}
+		var right formulaNode
+		if right, err = p.term(); err == nil {
+			left = binaryNode{op: op, left: left, right: right}
+		}
+	}
+	return nil, err
+}
+
+func (p *formulaParser) term() (formulaNode, error) {
+	left, err := p.unary()
+	for err == nil {
+		var op byte
+		switch {
+		case p.accept('*'):
+			op = '*'
+		case p.accept('/'):
+			op = '/'
+		default:
+			return left, nil
+		}
+		var right formulaNode
+		if right, err = p.unary(); err == nil {
+			left = binaryNode{op: op, left: left, right: right}
+		}
+	}
+	return nil, err
+}
+
+func (p *formulaParser) unary() (formulaNode, error) {
+	switch {
+	case p.accept('-'):
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negateNode{operand}, nil
+	case p.accept('+'):
+		return p.unary()
+	}
+	return p.power()
+}
+
+func (p *formulaParser) power() (formulaNode, error) {
+	base, err := p.primary()
+	if err != nil || !p.accept('^') {
+		return base, err
+	}
+	exponent, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return binaryNode{op: '^', left: base, right: exponent}, nil
+}
+
+func (p *formulaParser) primary() (formulaNode, error) {
+	if p.skipSpace() == len(p.src) {
+		return nil, p.errorf("unexpected end of formula")
+	}
+	rest := p.src[p.pos:]
+	switch c := rest[0]; {
+	case strings.HasPrefix(rest, "{{"):
+		end := strings.Index(rest, "}}")
+		if end < 0 {
+			return nil, p.errorf("unterminated placeholder")
+		}
+		name := rest[2:end]
+		if name == "" {
+			return nil, p.errorf("empty placeholder")
+		}
+		p.pos += end + 2
+		p.addVariable(name)
+		return variableNode(name), nil
+
+	case c == '(':
+		p.pos++
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(')') {
+			return nil, p.errorf("missing closing parenthesis")
+		}
+		return inner, nil
+
+	case c >= '0' && c <= '9' || c == '.':
+		end := p.pos
+		for end < len(p.src) && (p.src[end] >= '0' && p.src[end] <= '9' || p.src[end] == '.') {
+			end++
+		}
+		// Exponent, as in 6.02e23 or 1.6e-19
+		if end < len(p.src) && (p.src[end] == 'e' || p.src[end] == 'E') {
+			exp := end + 1
+			if exp < len(p.src) && (p.src[exp] == '+' || p.src[exp] == '-') {
+				exp++
+			}
+			if exp < len(p.src) && p.src[exp] >= '0' && p.src[exp] <= '9' {
+				for end = exp; end < len(p.src) && p.src[end] >= '0' && p.src[end] <= '9'; end++ {
+				}
+			}
+		}
+		number, err := strconv.ParseFloat(p.src[p.pos:end], 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.src[p.pos:end])
+		}
+		p.pos = end
+		return numberNode(number), nil
+
+	case unicode.IsLetter(rune(c)):
+		end := p.pos
+		for end < len(p.src) && (unicode.IsLetter(rune(p.src[end])) || unicode.IsDigit(rune(p.src[end]))) {
+			end++
+		}
+		name := p.src[p.pos:end]
+		if name == "pi" {
+			p.pos = end
+			return numberNode(math.Pi), nil
+		}
+		fn, ok := formulaFunctions[name]
+		if !ok {
+			return nil, p.errorf("unknown name %q, variables are written {{%s}}", name, name)
+		}
+		p.pos = end
+		if !p.accept('(') {
+			return nil, p.errorf("function %s needs parentheses", name)
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(')') {
+			return nil, p.errorf("missing closing parenthesis after %s argument", name)
+		}
+		return callNode{name: name, fn: fn, arg: arg}, nil
+	}
+	return nil, p.errorf("unexpected %q", rest[0])
+}
+
+func (p *formulaParser) addVariable(name string) {
+	for _, seen := range p.variables {
+		if seen == name {
+			return
+		}
+	}
+	p.variables = append(p.variables, name)
+}
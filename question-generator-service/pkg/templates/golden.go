@@ -0,0 +1,210 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"question-generator-service/internal/db"
+)
+
+// GoldenQuestion is the canonical question a template generates for a
+// fixed seed and difficulty. Stored as a fixture, it catches changes to
+// generated content that nobody meant to make.
+type GoldenQuestion struct {
+	TemplateID      string                 `json:"template_id"`
+	Seed            int64                  `json:"seed"`
+	Difficulty      float64                `json:"difficulty"`
+	QuestionText    string                 `json:"question_text"`
+	Options         map[string]string      `json:"options,omitempty"`
+	CorrectAnswer   string                 `json:"correct_answer"`
+	SolutionSteps   []string               `json:"solution_steps,omitempty"`
+	AssertionReason *AssertionReason       `json:"assertion_reason,omitempty"`
+	MatrixMatch     *MatrixMatch           `json:"matrix_match,omitempty"`
+	Passage         *Passage               `json:"passage,omitempty"`
+	Variables       map[string]interface{} `json:"variables"`
+}
+
+// GoldenRequest asks CheckGolden to compare a stored template's question
+// for Seed against its fixture
+type GoldenRequest struct {
+	TemplateID string
+	Seed       int64   // Required, the fixture is keyed on it
+	Difficulty float64 // The template's base difficulty when zero
+	Update     bool    // Overwrite the fixture with the current question
+}
+
+// Outcomes of CheckGolden
+const (
+	GoldenCreated = "created" // No fixture existed, the question was stored
+	GoldenMatched = "matched"
+	GoldenDrifted = "drifted" // The question differs from the fixture, which is kept
+	GoldenUpdated = "updated" // The fixture was overwritten on request
+)
+
+// GoldenResult reports how a template's question compares to its fixture
+type GoldenResult struct {
+	Status  string          `json:"status"`
+	Diffs   []string        `json:"diffs,omitempty"` // Fields that drifted
+	Golden  *GoldenQuestion `json:"golden"`          // The stored fixture
+	Current *GoldenQuestion `json:"current"`         // The question generated now
+}
+
+// GenerateGolden fills template with seed at difficulty and keeps the parts
+// of the question that must not change unannounced
+func (s *Service) GenerateGolden(ctx context.Context, template *db.QuestionTemplate, seed int64, difficulty float64) (*GoldenQuestion, error) {
+	question, err := s.FillTemplate(ctx, TemplateFillRequest{
+		Template:             template,
+		CalibratedDifficulty: difficulty,
+		RandomSeed:           seed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &GoldenQuestion{
+		TemplateID:      template.TemplateID,
+		Seed:            seed,
+		Difficulty:      difficulty,
+		QuestionText:    question.QuestionText,
+		Options:         question.Options,
+		CorrectAnswer:   question.CorrectAnswer,
+		SolutionSteps:   question.SolutionSteps,
+		AssertionReason: question.AssertionReason,
+		MatrixMatch:     question.MatrixMatch,
+		Passage:         question.Passage,
+		Variables:       question.VariableValues,
+	}, nil
+}
+
+// CheckGolden generates a stored template's question and compares it with
+// the fixture in the configured golden directory, creating the fixture when
+// there is none. Like preview, it neither logs nor counts usage.
+func (s *Service) CheckGolden(ctx context.Context, req GoldenRequest) (*GoldenResult, error) {
+	if req.Seed == 0 {
+		return nil, fmt.Errorf("a golden question needs a fixed seed")
+	}
+	template, err := s.dbClient.GetQuestionTemplateUncached(ctx, req.TemplateID)
+	if err != nil {
+		return nil, err
+	}
+	difficulty := req.Difficulty
+	if difficulty == 0 {
+		difficulty = template.BaseDifficulty
+	}
+	current, err := s.GenerateGolden(ctx, template, req.Seed, difficulty)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(s.goldenDir, GoldenFileName(template.TemplateID, req.Seed, difficulty))
+	golden, err := ReadGoldenFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist) || err == nil && req.Update:
+		if err := WriteGoldenFile(path, current); err != nil {
+			return nil, err
+		}
+		status := GoldenCreated
+		if golden != nil {
+			status = GoldenUpdated
+		}
+		return &GoldenResult{Status: status, Diffs: GoldenDiff(golden, current), Golden: current, Current: current}, nil
+	case err != nil:
+		return nil, err
+	}
+
+	result := &GoldenResult{Status: GoldenMatched, Golden: golden, Current: current}
+	if result.Diffs = GoldenDiff(golden, current); len(result.Diffs) > 0 {
+		result.Status = GoldenDrifted
+	}
+	return result, nil
+}
+
+// GoldenFileName names the fixture of a template's question for seed and
+// difficulty
+func GoldenFileName(templateID string, seed int64, difficulty float64) string {
+	return fmt.Sprintf("%s_seed%d_d%g.json", templateID, seed, difficulty)
+}
+
+// GoldenDiff lists the JSON fields in which current differs from golden,
+// none when either is nil
+func GoldenDiff(golden, current *GoldenQuestion) []string {
+	if golden == nil || current == nil {
+		return nil
+	}
+	want, err := goldenFields(golden)
+	if err != nil {
+		return []string{"golden: " + err.Error()}
+	}
+	got, err := goldenFields(current)
+	if err != nil {
+		return []string{"current: " + err.Error()}
+	}
+
+	var diffs []string
+	for _, field := range []string{
+		"template_id", "seed", "difficulty", "question_text", "options", "correct_answer",
+		"solution_steps", "assertion_reason", "matrix_match", "passage", "variables",
+	} {
+		if !bytes.Equal(want[field], got[field]) {
+			diffs = append(diffs, field)
+		}
+	}
+	return diffs
+}
+
+// goldenFields renders each field of q as compact JSON, so that a fixture
+// read back from disk, whose numbers are all float64, compares equal to a
+// freshly generated question
+func goldenFields(q *GoldenQuestion) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, raw := range fields {
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		if fields[name], err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// ReadGoldenFile reads a fixture written by WriteGoldenFile
+func ReadGoldenFile(path string) (*GoldenQuestion, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var golden GoldenQuestion
+	if err := json.Unmarshal(data, &golden); err != nil {
+		return nil, fmt.Errorf("golden fixture %s: %w", path, err)
+	}
+	return &golden, nil
+}
+
+// WriteGoldenFile stores golden at path as indented JSON, creating the
+// directory if needed
+func WriteGoldenFile(path string, golden *GoldenQuestion) error {
+	data, err := json.MarshalIndent(golden, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create golden directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write golden fixture: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package templates
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/pkg/units"
+)
+
+// DefaultNumericalTolerance grades numerical answers of templates without
+// their own tolerance, covering answers rounded to two decimal places
+var DefaultNumericalTolerance = db.NumericalTolerance{Relative: 0.01}
+
+const (
+	// numericalZeroCreditFactor is the multiple of the full-credit tolerance
+	// at which partial credit for a numerical answer reaches zero
+	numericalZeroCreditFactor = 5
+	// zeroAnswerTolerance is the error accepted for a correct answer of zero
+	// when no absolute tolerance applies
+	zeroAnswerTolerance = 0.005
+)
+
+// QuantityPattern splits an answer into its number and trailing unit. It is
+// shared by grading, answer canonicalisation and the numerical validator so
+// that all three accept the same answers.
+var QuantityPattern = regexp.MustCompile(`^([-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?)\s*(.*)$`)
+
+// AnswerGrade is the outcome of grading a student's answer
+type AnswerGrade struct {
+	Correct       bool
+	PartialCredit float64 // 1 for a correct answer, between 0 and 1 for a near miss
+	Numerical     bool    // Graded by value rather than by matching text
+}
+
+// GradeAnswer scores a submitted answer against a question's correct answer.
+// MCQ submissions may give the option key ("B") or repeat the option text.
+// Numerical answers, i.e. questions without options whose correct answer is
+// a number, may use any compatible unit and default to the correct answer's
+// unit. They are graded within DefaultNumericalTolerance.
+func GradeAnswer(correctAnswer string, options map[string]string, submitted string) AnswerGrade {
+	return GradeAnswerWithTolerance(correctAnswer, options, submitted, DefaultNumericalTolerance)
+}
+
+// GradeAnswerWithTolerance grades like GradeAnswer with the given numerical
+// tolerance. Numerical answers earn full credit within the tolerance and
+// partial credit falling linearly to zero at numericalZeroCreditFactor
+// times it.
+func GradeAnswerWithTolerance(correctAnswer string, options map[string]string, submitted string, tolerance db.NumericalTolerance) AnswerGrade {
+	submitted = strings.TrimSpace(submitted)
+	if option, ok := options[strings.ToUpper(submitted)]; ok {
+		submitted = option
+	}
+
+	if len(options) == 0 {
+		if want, ok := parseQuantity(correctAnswer, units.Dimensionless); ok {
+			grade := AnswerGrade{Numerical: true}
+			if got, ok := parseQuantity(submitted, want.Unit); ok {
+				grade.PartialCredit = numericalCredit(want, got, tolerance)
+				grade.Correct = grade.PartialCredit == 1
+			}
+			return grade
+		}
+	}
+
+	if NormalizeAnswer(submitted) == NormalizeAnswer(correctAnswer) {
+		return AnswerGrade{Correct: true, PartialCredit: 1}
+	}
+	return AnswerGrade{}
+}
+
+// numericalCredit grades got against want by how far it falls outside the
+// tolerance band around want
+func numericalCredit(want, got units.Quantity, tolerance db.NumericalTolerance) float64 {
+	got, err := got.ConvertTo(want.Unit)
+	if err != nil {
+		return 0
+	}
+
+	diff := math.Abs(got.Value - want.Value)
+	full := math.Max(tolerance.Absolute, tolerance.Relative*math.Abs(want.Value))
+	if full == 0 {
+		// No band exists, e.g. a relative tolerance around zero; accept
+		// what rounds to zero
+		if diff < zeroAnswerTolerance {
+			return 1
+		}
+		return 0
+	}
+
+	zero := full * numericalZeroCreditFactor
+	switch {
+	case diff <= full:
+		return 1
+	case diff >= zero:
+		return 0
+	default:
+		return (zero - diff) / (zero - full)
+	}
+}
+
+// parseQuantity reads "<number> [unit]", using defaultUnit when no unit is given
+func parseQuantity(s string, defaultUnit units.Unit) (units.Quantity, bool) {
+	match := QuantityPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return units.Quantity{}, false
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil || math.IsInf(value, 0) || math.IsNaN(value) {
+		return units.Quantity{}, false
+	}
+
+	unit := defaultUnit
+	if symbol := strings.Join(strings.Fields(match[2]), ""); symbol != "" {
+		if unit, err = units.Parse(symbol); err != nil {
+			return units.Quantity{}, false
+		}
+	}
+	return units.Quantity{Value: value, Unit: unit}, true
+}
@@ -0,0 +1,147 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"question-generator-service/internal/db"
+)
+
+// Languages a question can be requested in
+const (
+	LanguageEnglish = "en"
+	LanguageHindi   = "hi"
+	LanguageBoth    = "both" // English and Hindi, with the same variable values
+)
+
+// ErrLanguageUnavailable is returned when a question is requested in a
+// language its template has no text for
+var ErrLanguageUnavailable = errors.New("template not available in the requested language")
+
+// QuestionBody is a question's text and options in one language
+type QuestionBody struct {
+	QuestionText string            `json:"question_text"`
+	Options      map[string]string `json:"options,omitempty"`
+}
+
+// ValidLanguage reports whether language is one a question can be requested
+// in. Empty means English.
+func ValidLanguage(language string) bool {
+	switch language {
+	case "", LanguageEnglish, LanguageHindi, LanguageBoth:
+		return true
+	}
+	return false
+}
+
+// Languages expands a requested language into the languages rendered for
+// it, English first. It returns nil for an empty language.
+func Languages(language string) []string {
+	switch language {
+	case LanguageEnglish:
+		return []string{LanguageEnglish}
+	case LanguageHindi:
+		return []string{LanguageHindi}
+	case LanguageBoth:
+		return []string{LanguageEnglish, LanguageHindi}
+	}
+	return nil
+}
+
+// NeedsHindi reports whether language includes a Hindi body
+func NeedsHindi(language string) bool {
+	return language == LanguageHindi || language == LanguageBoth
+}
+
+// availableIn returns the templates that can be rendered in language
+func availableIn(templates []*db.QuestionTemplate, language string) []*db.QuestionTemplate {
+	if !NeedsHindi(language) {
+		return templates
+	}
+	available := make([]*db.QuestionTemplate, 0, len(templates))
+	for _, qt := range templates {
+		if CheckLanguage(qt, language) == nil {
+			available = append(available, qt)
+		}
+	}
+	return available
+}
+
+// CheckLanguage returns an ErrLanguageUnavailable error when qt cannot be
+// rendered in language. Hindi needs template_text_hi, and options_template_hi
+// for MCQ templates with an options template. Formats whose statements,
+// columns or sub-questions live in the options template are English only.
+func CheckLanguage(qt *db.QuestionTemplate, language string) error {
+	if !ValidLanguage(language) {
+		return fmt.Errorf("unknown language %q, must be one of %s, %s or %s", language, LanguageEnglish, LanguageHindi, LanguageBoth)
+	}
+	if !NeedsHindi(language) {
+		return nil
+	}
+	switch {
+	case qt.Format == "ASSERTION_REASON" || qt.Format == "MATRIX_MATCH" || qt.Format == "PASSAGE":
+		return fmt.Errorf("%w: %s templates are English only, so template %s cannot be rendered in Hindi",
+			ErrLanguageUnavailable, qt.Format, qt.TemplateID)
+	case qt.TemplateTextHi == nil || strings.TrimSpace(*qt.TemplateTextHi) == "":
+		return fmt.Errorf("%w: template %s has no Hindi text (template_text_hi)", ErrLanguageUnavailable, qt.TemplateID)
+	case qt.Format == "MCQ" && qt.OptionsTemplate != nil && qt.OptionsTemplateHi == nil:
+		return fmt.Errorf("%w: template %s has no Hindi options (options_template_hi)", ErrLanguageUnavailable, qt.TemplateID)
+	}
+	return nil
+}
+
+// validateHindi checks the Hindi translation of a template, when it has one
+func validateHindi(errs *fieldErrors, qt *db.QuestionTemplate) {
+	if qt.TemplateTextHi != nil {
+		if strings.TrimSpace(*qt.TemplateTextHi) == "" {
+			errs.add("template_text_hi", "must not be empty when set")
+		} else if qt.RenderFormat == RenderFormatLatex {
+			if err := ValidateLatexDelimiters(*qt.TemplateTextHi); err != nil {
+				errs.add("template_text_hi", "%v", err)
+			}
+		}
+	}
+
+	if qt.OptionsTemplateHi == nil {
+		return
+	}
+	switch {
+	case qt.Format != "MCQ":
+		errs.add("options_template_hi", "is only supported for MCQ templates")
+	case qt.OptionsTemplate == nil:
+		errs.add("options_template_hi", "requires options_template")
+	case qt.TemplateTextHi == nil:
+		errs.add("options_template_hi", "requires template_text_hi")
+	default:
+		if _, err := parseMCQOptionsSpec(qt.OptionsTemplateHi); err != nil {
+			errs.add("options_template_hi", "%v for MCQ templates", err)
+		}
+	}
+}
+
+// fillBodies renders the question in each of languages with the variable
+// values of the English question, which is reused as is
+func fillBodies(qt *db.QuestionTemplate, languages []string, english QuestionBody, fill func(string) (string, error)) (map[string]QuestionBody, error) {
+	bodies := make(map[string]QuestionBody, len(languages))
+	for _, language := range languages {
+		if language == LanguageEnglish {
+			bodies[language] = english
+			continue
+		}
+
+		text, err := fill(*qt.TemplateTextHi)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fill template_text_hi: %w", err)
+		}
+		body := QuestionBody{QuestionText: text, Options: english.Options}
+		if qt.OptionsTemplateHi != nil {
+			if body.Options, err = fillMCQOptions(qt.OptionsTemplateHi, fill); err != nil {
+				return nil, fmt.Errorf("failed to fill MCQ options_template_hi: %w", err)
+			}
+			canonicalOptions(body.Options, qt.AnswerPrecision)
+		}
+		bodies[language] = body
+	}
+	return bodies, nil
+}
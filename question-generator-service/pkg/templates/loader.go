@@ -2,43 +2,143 @@ package templates
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"math/rand"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
+	"question-generator-service/internal/config"
 	"question-generator-service/internal/db"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/units"
+)
+
+var (
+	// ErrNoTemplatesFound is returned when no template matches a selection
+	ErrNoTemplatesFound = errors.New("no templates found")
+	// ErrTemplateInvalid is returned when a template cannot be filled into a
+	// question, e.g. because of malformed variable slots or formulas
+	ErrTemplateInvalid = errors.New("invalid template")
 )
 
 // Service handles question template operations
 type Service struct {
-	dbClient *db.Client
-	rand     *rand.Rand
+	dbClient    *db.Client
+	mode        SelectionMode
+	temperature float64
+	weights     config.TemplateScoringConfig
+	settings    *config.Holder
+	cooldown    *Cooldown
+	goldenDir   string // Where CheckGolden keeps its fixtures
+	specs       specCache
+
+	// maxCandidates bounds the templates scored per selection
+	maxCandidates int
+
+	// examTypeFallbacks lists, per exam type, the exam types whose
+	// templates stand in when it has none matching
+	examTypeFallbacks map[string][]string
 }
 
-// NewService creates a new template service
-func NewService(dbClient *db.Client) (*Service, error) {
+// SelectionMode decides how a template is picked from the scored candidates
+type SelectionMode string
+
+const (
+	// SelectionModeBest always serves the highest-scoring template
+	SelectionModeBest SelectionMode = "BEST"
+	// SelectionModeWeighted samples templates with probability given by a
+	// softmax over their scores, trading a little quality for variety
+	SelectionModeWeighted SelectionMode = "WEIGHTED"
+)
+
+// defaultSelectionTemperature is used when the configuration leaves it unset
+const defaultSelectionTemperature = 0.05
+
+// defaultMaxCandidates is used when the configuration leaves MaxCandidates
+// unset
+const defaultMaxCandidates = 100
+
+// NewService creates a new template service. An empty selection mode
+// defaults to WEIGHTED.
+func NewService(dbClient *db.Client, cfg config.TemplateConfig) (*Service, error) {
+	mode := SelectionMode(cfg.SelectionMode)
+	switch mode {
+	case "":
+		mode = SelectionModeWeighted
+	case SelectionModeBest, SelectionModeWeighted:
+	default:
+		return nil, fmt.Errorf("unknown template selection mode %q", cfg.SelectionMode)
+	}
+
+	temperature := cfg.SelectionTemperature
+	if temperature <= 0 {
+		temperature = defaultSelectionTemperature
+	}
+
+	maxCandidates := cfg.MaxCandidates
+	if maxCandidates <= 0 {
+		maxCandidates = defaultMaxCandidates
+	}
+
+	// Unset weights fall back to the defaults
+	weights := cfg.Scoring
+	if weights == (config.TemplateScoringConfig{}) {
+		weights = config.DefaultTemplateScoring
+	}
+	if err := weights.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &Service{
-		dbClient: dbClient,
-		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		dbClient:    dbClient,
+		mode:        mode,
+		temperature: temperature,
+		weights:     weights,
+		cooldown:    NewCooldown(cfg.CooldownSelections, cfg.CooldownDuration),
+		goldenDir:   cfg.GoldenDir,
+
+		maxCandidates:     maxCandidates,
+		examTypeFallbacks: cfg.ExamTypeFallbacks,
 	}, nil
 }
 
+// UseSettings makes the service read its scoring weights from settings, so
+// configuration reloads apply without a restart
+func (s *Service) UseSettings(settings *config.Holder) {
+	s.settings = settings
+}
+
+// scoringWeights returns the configured weights, preferring the settings
+// holder when one is in use
+func (s *Service) scoringWeights() config.TemplateScoringConfig {
+	if s.settings != nil {
+		return s.settings.Get().Templates.Scoring
+	}
+	return s.weights
+}
+
 // TemplateSelection criteria for finding suitable templates
 type TemplateSelection struct {
-	TopicID       string
-	ExamType      string
-	Subject       string
-	Format        string
-	MinDifficulty float64
-	MaxDifficulty float64
-	BloomLevel    int    // Optional filter by Bloom's taxonomy level
-	ConceptDepth  int    // Optional filter by concept depth
-	Limit         int    // Maximum templates to consider (default: 10)
+	TopicID            string
+	ExamType           string
+	Subject            string
+	Format             string
+	MinDifficulty      float64
+	MaxDifficulty      float64
+	BloomLevel         int      // Optional filter by Bloom's taxonomy level
+	ConceptDepth       int      // Optional filter by concept depth
+	Limit              int      // Optional: most templates to fetch, all matches when zero
+	ExcludeTemplateIDs []string // Templates to skip when alternatives exist (e.g. on regeneration)
+	SkipTemplateIDs    []string // Templates never to select, even when nothing else matches
+	Seed               int64    // Optional: makes WEIGHTED selection reproducible, random when zero
+	Language           string   // Optional: only templates that can be rendered in it (en, hi or both)
+
+	// Weights overrides the service's scoring weights for this selection
+	Weights *config.TemplateScoringConfig
 }
 
 // TemplateFillRequest contains parameters for filling template variables
@@ -46,7 +146,8 @@ type TemplateFillRequest struct {
 	Template           *db.QuestionTemplate
 	CalibratedDifficulty float64
 	StudentContext     string
-	RandomSeed         int64 // Optional: for reproducible generation
+	RandomSeed         int64 // Optional: for reproducible generation, random when zero
+	Language           string // Optional: en, hi or both, adding a body per language to the question
 }
 
 // GeneratedQuestion represents a filled template with complete question data
@@ -55,6 +156,10 @@ type GeneratedQuestion struct {
 	Options        map[string]string `json:"options,omitempty"`
 	CorrectAnswer  string            `json:"correct_answer"`
 	SolutionSteps  []string          `json:"solution_steps,omitempty"`
+	AssertionReason *AssertionReason `json:"assertion_reason,omitempty"` // ASSERTION_REASON only
+	MatrixMatch    *MatrixMatch      `json:"matrix_match,omitempty"`     // MATRIX_MATCH only
+	Passage        *Passage          `json:"passage,omitempty"`          // PASSAGE only
+	Bodies         map[string]QuestionBody `json:"bodies,omitempty"`    // Text and options per requested language; QuestionText and Options stay English
 	VariableValues map[string]interface{} `json:"variable_values"`
 	Difficulty     float64           `json:"difficulty"`
 	Metadata       map[string]interface{} `json:"metadata"`
@@ -67,7 +172,17 @@ type VariableSpec struct {
 	Range   *RangeSpec            `json:"range,omitempty"`
 	Options []string              `json:"options,omitempty"`
 	Formula string                 `json:"formula,omitempty"` // For computed variables
-	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"` // e.g. unique, sorted, bracketed for arrays
+	Unit     string                 `json:"unit,omitempty"`     // Physical unit of numeric variables, e.g. "m/s^2"
+
+	// DifficultyScale widens numeric ranges with difficulty: at difficulty d
+	// the span max-min is multiplied by 1 + d*(DifficultyScale-1). Defaults to 1.0 (no scaling).
+	DifficultyScale float64 `json:"difficulty_scale,omitempty"`
+
+	// Array variables
+	ElementType string     `json:"element_type,omitempty"` // integer (default), float or string
+	Length      int        `json:"length,omitempty"`       // Fixed number of elements
+	LengthRange *RangeSpec `json:"length_range,omitempty"` // Variable number of elements when Length is unset
 }
 
 // RangeSpec defines numeric ranges for variable generation
@@ -77,62 +192,166 @@ type RangeSpec struct {
 	Step float64 `json:"step,omitempty"` // For discrete steps
 }
 
-// SelectTemplate finds the most suitable template based on selection criteria
+// SelectTemplate finds the most suitable template based on selection
+// criteria. Only templates of selection.ExamType are considered; callers
+// fall back to the ExamTypes standing in for it once every other criterion
+// is exhausted. Selecting a template does not start its cool-down; callers
+// report the templates of saved questions with TemplateServed.
 func (s *Service) SelectTemplate(ctx context.Context, selection TemplateSelection) (*db.QuestionTemplate, error) {
-	// Set defaults
-	if selection.Limit <= 0 {
-		selection.Limit = 10
+	templates, err := s.Candidates(ctx, selection)
+	if err != nil {
+		return nil, err
 	}
 
+	// Apply intelligent template selection algorithm
+	selectedTemplate, err := s.selectBestTemplate(ctx, templates, selection)
+	if err != nil {
+		return nil, err
+	}
+	
+	logging.FromContext(ctx).Infow("selected template",
+		"template_id", selectedTemplate.TemplateID,
+		"usage_count", selectedTemplate.UsageCount,
+		"score", s.calculateTemplateScore(selectedTemplate, selection),
+		"candidates", len(templates))
+
+	return selectedTemplate, nil
+}
+
+// TemplateServed starts the cool-down of templateID once a question filled
+// from it has been saved. Candidates that fail validation or are never
+// stored leave their template free to be selected again.
+func (s *Service) TemplateServed(templateID string) {
+	s.cooldown.Served(templateID)
+}
+
+// ExamTypes lists the exam types whose templates may serve a request for
+// examType: examType itself, then its configured fallbacks in order
+func (s *Service) ExamTypes(examType string) []string {
+	return append([]string{examType}, s.examTypeFallbacks[examType]...)
+}
+
+// Candidates returns the templates SelectTemplate scores for selection.
+// Every match is fetched unless selection.Limit says otherwise, but at most
+// the service's MaxCandidates are returned: a larger set is cut to its top
+// half in database order, by usage, plus a random sample of the rest, so
+// that large topics stay cheap to score without always serving the same
+// templates.
+func (s *Service) Candidates(ctx context.Context, selection TemplateSelection) ([]*db.QuestionTemplate, error) {
 	// Build filter criteria for database query
 	filters := db.TemplateFilters{
 		TopicID:       selection.TopicID,
-		ExamType:      selection.ExamType,
 		Subject:       selection.Subject,
 		Format:        selection.Format,
 		MinDifficulty: selection.MinDifficulty,
 		MaxDifficulty: selection.MaxDifficulty,
-		Limit:         selection.Limit,
+		HasHindi:      NeedsHindi(selection.Language),
+	}
+	if selection.Limit > 0 {
+		// Skipped templates may take up part of the limit
+		filters.Limit = selection.Limit + len(selection.SkipTemplateIDs)
 	}
 
 	// Query database for matching templates
-	templates, err := s.dbClient.GetTemplatesByFilters(ctx, filters)
+	filters.ExamType = selection.ExamType
+	found, err := s.dbClient.GetTemplatesByFilters(ctx, filters)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query templates: %w", err)
 	}
+	templates := excludeTemplates(availableIn(found, selection.Language), selection.SkipTemplateIDs)
 
 	if len(templates) == 0 {
-		return nil, fmt.Errorf("no templates found matching criteria: topic=%s, exam=%s, subject=%s, format=%s", 
+		criteria := fmt.Sprintf("topic=%s, exam=%s, subject=%s, format=%s",
 			selection.TopicID, selection.ExamType, selection.Subject, selection.Format)
+		if selection.Language != "" {
+			criteria += ", language=" + selection.Language
+		}
+		return nil, fmt.Errorf("%w matching criteria: %s", ErrNoTemplatesFound, criteria)
 	}
 
-	// Apply intelligent template selection algorithm
-	selectedTemplate := s.selectBestTemplate(templates, selection)
-	
-	log.Printf("Selected template %s (usage: %d, score: %.3f) from %d candidates", 
-		selectedTemplate.TemplateID, selectedTemplate.UsageCount, 
-		s.calculateTemplateScore(selectedTemplate, selection), len(templates))
+	// Prefer templates not excluded by the caller, re-using them only when
+	// nothing else matches so variables can be re-rolled instead
+	if remaining := excludeTemplates(templates, selection.ExcludeTemplateIDs); len(remaining) > 0 {
+		templates = remaining
+	}
 
-	return selectedTemplate, nil
+	if len(templates) > s.maxCandidates {
+		logging.FromContext(ctx).Infow("sampling candidate templates",
+			"topic_id", selection.TopicID, "scored", s.maxCandidates, "candidates", len(templates))
+		templates = sampleCandidates(templates, s.maxCandidates, selection.Seed)
+	}
+	return templates, nil
 }
 
-// FillTemplate generates a complete question by filling template variables
+// sampleCandidates cuts templates to max: the first half of max in the
+// given order, then a random sample of the rest. A non-zero seed makes the
+// sample reproducible.
+func sampleCandidates(templates []*db.QuestionTemplate, max int, seed int64) []*db.QuestionTemplate {
+	top := (max + 1) / 2
+	rest := append([]*db.QuestionTemplate(nil), templates[top:]...)
+
+	shuffle := rand.Shuffle
+	if seed != 0 {
+		// The database may return the rest in any order
+		sort.Slice(rest, func(i, j int) bool { return rest[i].TemplateID < rest[j].TemplateID })
+		shuffle = rand.New(rand.NewSource(seed)).Shuffle
+	}
+	shuffle(len(rest), func(i, j int) { rest[i], rest[j] = rest[j], rest[i] })
+
+	sampled := make([]*db.QuestionTemplate, 0, max)
+	sampled = append(sampled, templates[:top]...)
+	return append(sampled, rest[:max-top]...)
+}
+
+// FillTemplate generates a complete question by filling template variables.
+// Failures caused by the template itself wrap ErrTemplateInvalid; a
+// template without text in the requested language fails with
+// ErrLanguageUnavailable before anything is filled.
 func (s *Service) FillTemplate(ctx context.Context, req TemplateFillRequest) (*GeneratedQuestion, error) {
-	// Parse variable specifications from template
-	var variableSpecs []VariableSpec
-	if err := json.Unmarshal([]byte(req.Template.VariableSlots), &variableSpecs); err != nil {
+	if err := CheckLanguage(req.Template, req.Language); err != nil {
+		return nil, err
+	}
+	question, err := s.fillTemplate(ctx, req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("%w %s: %w", ErrTemplateInvalid, req.Template.TemplateID, err)
+	}
+	return question, nil
+}
+
+func (s *Service) fillTemplate(ctx context.Context, req TemplateFillRequest) (*GeneratedQuestion, error) {
+	// Parse variable specifications from template, or reuse them from an
+	// earlier fill or warm-up
+	variableSpecs, err := s.variableSpecs(req.Template)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse variable slots: %w", err)
 	}
 
-	// Set random seed for reproducible generation if provided
-	if req.RandomSeed != 0 {
-		s.rand = rand.New(rand.NewSource(req.RandomSeed))
+	// LATEX templates must have balanced math delimiters before filling
+	renderFormat := renderFormatOf(req.Template.RenderFormat)
+	if renderFormat == RenderFormatLatex {
+		if err := ValidateLatexDelimiters(req.Template.TemplateText); err != nil {
+			return nil, fmt.Errorf("template %s has unbalanced LaTeX delimiters: %w", req.Template.TemplateID, err)
+		}
 	}
 
+	// Seed a per-call generator so the same seed always replays the same
+	// question and concurrent fills do not share random state
+	seed := req.RandomSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
 	// Generate values for all variables
 	variableValues := make(map[string]interface{})
 	for _, spec := range variableSpecs {
-		value, err := s.generateVariableValue(spec, req.CalibratedDifficulty, variableValues)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		value, err := generateVariableValue(rng, spec, req.CalibratedDifficulty, variableValues)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate value for variable %s: %w", spec.Name, err)
 		}
@@ -140,34 +359,73 @@ func (s *Service) FillTemplate(ctx context.Context, req TemplateFillRequest) (*G
 	}
 
 	// Fill template text with generated values
-	questionText, err := s.fillTemplateText(req.Template.TemplateText, variableValues)
+	questionText, err := s.fillTemplateText(req.Template.TemplateText, variableValues, variableSpecs, renderFormat)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fill template text: %w", err)
 	}
 
+	// ASSERTION_REASON, MATRIX_MATCH and PASSAGE templates describe their
+	// statements, columns or sub-questions in the options template, filled
+	// from the same variables
+	fill := func(text string) (string, error) {
+		return s.fillTemplateText(text, variableValues, variableSpecs, renderFormat)
+	}
+	var formatted *formatQuestion
+	switch req.Template.Format {
+	case "ASSERTION_REASON":
+		formatted, err = s.fillAssertionReason(req.Template.OptionsTemplate, fill)
+	case "MATRIX_MATCH":
+		formatted, err = fillMatrixMatch(rng, req.Template.OptionsTemplate, fill)
+	case "PASSAGE":
+		formatted, err = s.fillPassage(req.Template, seed, questionText, variableValues, fill)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fill %s options_template: %w", req.Template.Format, err)
+	}
+
 	// Generate options for MCQ questions
 	var options map[string]string
 	if req.Template.Format == "MCQ" && req.Template.OptionsTemplate != nil {
-		options, err = s.generateMCQOptions(ctx, *req.Template.OptionsTemplate, variableValues, req.CalibratedDifficulty)
+		options, err = fillMCQOptions(req.Template.OptionsTemplate, fill)
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate MCQ options: %w", err)
+			return nil, fmt.Errorf("failed to fill MCQ options_template: %w", err)
 		}
 	}
 
 	// Calculate correct answer based on template logic
-	correctAnswer, err := s.calculateCorrectAnswer(req.Template, variableValues)
-	if err != nil {
-		return nil, fmt.Errorf("failed to calculate correct answer: %w", err)
+	var correctAnswer string
+	if formatted != nil {
+		questionText += formatted.text
+		options = formatted.options
+		correctAnswer = formatted.correctAnswer
+	} else {
+		correctAnswer, err = s.calculateCorrectAnswer(req.Template, variableValues, variableSpecs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate correct answer: %w", err)
+		}
+	}
+
+	// Answers and options are stored in one spelling so that equivalent
+	// answers match as text
+	correctAnswer = CanonicalAnswer(correctAnswer, req.Template.AnswerPrecision)
+	canonicalOptions(options, req.Template.AnswerPrecision)
+
+	// Make sure the answer is actually one of the options so the pipeline
+	// can regenerate instead of shipping an unanswerable MCQ
+	if len(options) > 0 {
+		if _, err := VerifyCorrectAnswer(correctAnswer, options); err != nil {
+			return nil, fmt.Errorf("template %s produced invalid options: %w", req.Template.TemplateID, err)
+		}
 	}
 
 	// Generate solution steps
-	solutionSteps, err := s.generateSolutionSteps(req.Template, variableValues)
+	solutionSteps, err := s.generateSolutionSteps(req.Template, variableValues, variableSpecs, correctAnswer)
 	if err != nil {
 		log.Printf("Warning: failed to generate solution steps: %v", err)
 		// Solution steps are optional, continue without them
 	}
 
-	return &GeneratedQuestion{
+	question := &GeneratedQuestion{
 		QuestionText:   questionText,
 		Options:        options,
 		CorrectAnswer:  correctAnswer,
@@ -182,36 +440,161 @@ func (s *Service) FillTemplate(ctx context.Context, req TemplateFillRequest) (*G
 			"sub_chapter":    req.Template.SubChapter,
 			"ncert_reference": req.Template.NCERTReference,
 			"generation_time": time.Now().UTC(),
+			"random_seed":     seed,
+			"render_format":   renderFormat,
 		},
-	}, nil
+	}
+	if formatted != nil {
+		question.AssertionReason = formatted.assertionReason
+		question.MatrixMatch = formatted.matrixMatch
+		question.Passage = formatted.passage
+	}
+
+	// Translations reuse the variable values, so every language asks the
+	// same question with the same answer
+	if languages := Languages(req.Language); len(languages) > 0 {
+		english := QuestionBody{QuestionText: questionText, Options: options}
+		if question.Bodies, err = fillBodies(req.Template, languages, english, fill); err != nil {
+			return nil, err
+		}
+		question.Metadata["language"] = req.Language
+	}
+	return question, nil
+}
+
+// excludeTemplates returns the templates whose IDs are not in excluded
+func excludeTemplates(templates []*db.QuestionTemplate, excluded []string) []*db.QuestionTemplate {
+	if len(excluded) == 0 {
+		return templates
+	}
+	skip := make(map[string]bool, len(excluded))
+	for _, id := range excluded {
+		skip[id] = true
+	}
+	remaining := make([]*db.QuestionTemplate, 0, len(templates))
+	for _, t := range templates {
+		if !skip[t.TemplateID] {
+			remaining = append(remaining, t)
+		}
+	}
+	return remaining
 }
 
-// selectBestTemplate implements intelligent template selection algorithm
-func (s *Service) selectBestTemplate(templates []*db.QuestionTemplate, selection TemplateSelection) *db.QuestionTemplate {
-	var bestTemplate *db.QuestionTemplate
-	var bestScore float64 = -1
+// scoreCheckInterval is how many candidates are scored between checks for
+// a cancelled request
+const scoreCheckInterval = 32
+
+// selectBestTemplate picks a candidate according to the service's selection
+// mode: the top score for BEST, a softmax draw for WEIGHTED
+func (s *Service) selectBestTemplate(ctx context.Context, templates []*db.QuestionTemplate, selection TemplateSelection) (*db.QuestionTemplate, error) {
+	// The database may return equally ranked templates in any order, so
+	// candidates are put in template ID order: BEST then breaks ties the
+	// same way on every run and a seeded draw replays the same template
+	templates = append([]*db.QuestionTemplate(nil), templates...)
+	sort.Slice(templates, func(i, j int) bool { return templates[i].TemplateID < templates[j].TemplateID })
+	draw := rand.Float64
+	if selection.Seed != 0 {
+		draw = rand.New(rand.NewSource(selection.Seed)).Float64
+	}
 
-	for _, template := range templates {
-		score := s.calculateTemplateScore(template, selection)
-		if score > bestScore {
-			bestScore = score
-			bestTemplate = template
+	probs, err := s.SelectionProbabilities(ctx, templates, selection)
+	if err != nil {
+		return nil, err
+	}
+
+	r := draw()
+	for i, p := range probs {
+		if r < p {
+			return templates[i], nil
 		}
+		r -= p
 	}
+	return templates[len(templates)-1], nil
+}
 
-	return bestTemplate
+// SelectionProbabilities returns the chance of each candidate being served
+// under the service's selection mode, in candidate order. BEST gives
+// equally scored candidates to the lowest template ID, whatever their order.
+func (s *Service) SelectionProbabilities(ctx context.Context, templates []*db.QuestionTemplate, selection TemplateSelection) ([]float64, error) {
+	scores, err := s.scoreTemplates(ctx, templates, selection)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.mode == SelectionModeBest && len(scores) > 0 {
+		probs := make([]float64, len(scores))
+		best := 0
+		for i, score := range scores {
+			if score > scores[best] || (score == scores[best] && templates[i].TemplateID < templates[best].TemplateID) {
+				best = i
+			}
+		}
+		probs[best] = 1
+		return probs, nil
+	}
+	return softmax(scores, s.temperature), nil
+}
+
+// scoreTemplates scores every candidate in order
+func (s *Service) scoreTemplates(ctx context.Context, templates []*db.QuestionTemplate, selection TemplateSelection) ([]float64, error) {
+	if selection.Weights != nil {
+		if err := selection.Weights.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid scoring weights: %w", err)
+		}
+	}
+
+	scores := make([]float64, len(templates))
+	for i, template := range templates {
+		// Stop scoring large candidate sets once the caller has gone away
+		if i%scoreCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		scores[i] = s.calculateTemplateScore(template, selection)
+	}
+	return scores, nil
+}
+
+// softmax converts scores into probabilities, shifting by the maximum so
+// small temperatures don't overflow
+func softmax(scores []float64, temperature float64) []float64 {
+	probs := make([]float64, len(scores))
+	if len(scores) == 0 {
+		return probs
+	}
+
+	max := scores[0]
+	for _, score := range scores[1:] {
+		max = math.Max(max, score)
+	}
+	var sum float64
+	for i, score := range scores {
+		probs[i] = math.Exp((score - max) / temperature)
+		sum += probs[i]
+	}
+	for i := range probs {
+		probs[i] /= sum
+	}
+	return probs
 }
 
-// calculateTemplateScore computes a quality score for template selection
+// calculateTemplateScore computes a quality score for template selection,
+// weighting its factors by the selection's weights or the service's
 func (s *Service) calculateTemplateScore(template *db.QuestionTemplate, selection TemplateSelection) float64 {
+	weights := s.scoringWeights()
+	if selection.Weights != nil {
+		weights = *selection.Weights
+	}
+
 	var score float64
 
-	// Factor 1: Difficulty alignment (40% weight)
+	// Factor 1: Difficulty alignment
 	targetDifficulty := (selection.MinDifficulty + selection.MaxDifficulty) / 2
 	difficultyAlignment := 1.0 - math.Abs(template.BaseDifficulty-targetDifficulty)
-	score += 0.4 * difficultyAlignment
+	score += weights.Difficulty * difficultyAlignment
 
-	// Factor 2: Template quality metrics (30% weight)
+	// Factor 2: Template quality metrics
 	qualityScore := 0.0
 	if template.ValidationScore != nil {
 		qualityScore += *template.ValidationScore
@@ -222,78 +605,94 @@ func (s *Service) calculateTemplateScore(template *db.QuestionTemplate, selectio
 	if !template.AmbiguityFlag {
 		qualityScore += 0.2 // Bonus for non-ambiguous questions
 	}
-	score += 0.3 * (qualityScore / 2.0) // Normalize to 0-1 range
+	score += weights.Quality * (qualityScore / 2.0) // Normalize to 0-1 range
 
-	// Factor 3: Success rate (20% weight)
+	// Factor 3: Success rate
 	if template.SuccessRate != nil {
-		score += 0.2 * (*template.SuccessRate)
+		score += weights.SuccessRate * (*template.SuccessRate)
 	}
 
-	// Factor 4: Usage freshness (10% weight) - Avoid overused templates
+	// Factor 4: Usage freshness - Avoid overused templates
 	usageFreshness := 1.0 / (1.0 + float64(template.UsageCount)/100.0)
-	score += 0.1 * usageFreshness
+	score += weights.Freshness * usageFreshness
+
+	// Cool-down: suppress templates served recently, whatever their score
+	score -= cooldownPenalty * s.cooldown.Remaining(template.TemplateID)
 
 	return score
 }
 
 // generateVariableValue creates a value for a template variable based on its specification
-func (s *Service) generateVariableValue(spec VariableSpec, difficulty float64, existingVars map[string]interface{}) (interface{}, error) {
+func generateVariableValue(rng *rand.Rand, spec VariableSpec, difficulty float64, existingVars map[string]interface{}) (interface{}, error) {
 	switch spec.Type {
 	case "integer":
-		return s.generateIntegerValue(spec, difficulty)
+		return generateIntegerValue(rng, spec, difficulty)
 	case "float":
-		return s.generateFloatValue(spec, difficulty)
+		return generateFloatValue(rng, spec, difficulty)
 	case "string":
-		return s.generateStringValue(spec, difficulty)
+		return generateStringValue(rng, spec, difficulty)
 	case "array":
-		return s.generateArrayValue(spec, difficulty)
+		return generateArrayValue(rng, spec, difficulty)
 	case "computed":
-		return s.generateComputedValue(spec, existingVars)
+		return generateComputedValue(spec, existingVars)
 	default:
 		return nil, fmt.Errorf("unsupported variable type: %s", spec.Type)
 	}
 }
 
-// generateIntegerValue generates integer values with difficulty-based scaling
-func (s *Service) generateIntegerValue(spec VariableSpec, difficulty float64) (int, error) {
-	if spec.Range == nil {
-		return 0, fmt.Errorf("integer variable %s requires range specification", spec.Name)
-	}
+// maxIntegerSpan bounds the width of integer ranges and the number of steps
+// in a range: past it float64 bounds no longer hold every integer exactly
+// and the count of values could overflow
+const maxIntegerSpan = 1 << 53
 
-	min := int(spec.Range.Min)
-	max := int(spec.Range.Max)
-
-	// Scale range based on difficulty for mathematical complexity
-	if strings.Contains(strings.ToLower(spec.Name), "velocity") ||
-		strings.Contains(strings.ToLower(spec.Name), "acceleration") {
-		// Physics variables: higher difficulty = larger numbers
-		scaleFactor := 1.0 + difficulty*2.0
-		max = int(float64(max) * scaleFactor)
+// generateIntegerValue generates integer values with difficulty-based scaling.
+// Negative bounds are supported; a range holding no integer is an error.
+func generateIntegerValue(rng *rand.Rand, spec VariableSpec, difficulty float64) (int, error) {
+	min, max, err := scaledRange(spec, difficulty)
+	if err != nil {
+		return 0, err
+	}
+	lo, hi := math.Ceil(min), math.Floor(max)
+	if hi < lo {
+		return 0, fmt.Errorf("integer variable %s has no integer in range [%g, %g]", spec.Name, min, max)
+	}
+	if hi-lo > maxIntegerSpan {
+		return 0, fmt.Errorf("integer variable %s range [%g, %g] is too wide", spec.Name, min, max)
 	}
 
 	// Generate value within range
-	if spec.Range.Step > 0 {
-		// Discrete steps
-		steps := int((float64(max-min) / spec.Range.Step) + 1)
-		stepIndex := s.rand.Intn(steps)
-		return min + int(float64(stepIndex)*spec.Range.Step), nil
+	if step := spec.Range.Step; step > 0 {
+		// Discrete steps from min, never past max. Rounding rather than
+		// truncating keeps float error from moving negative values up.
+		n, err := stepCount(spec, min, max, step)
+		if err != nil {
+			return 0, err
+		}
+		value := math.Round(min + float64(rng.Intn(n))*step)
+		return int(math.Max(lo, math.Min(hi, value))), nil
 	}
 
 	// Continuous range
-	return min + s.rand.Intn(max-min+1), nil
+	return int(lo) + rng.Intn(int(hi-lo)+1), nil
 }
 
 // generateFloatValue generates float values with precision control
-func (s *Service) generateFloatValue(spec VariableSpec, difficulty float64) (float64, error) {
-	if spec.Range == nil {
-		return 0, fmt.Errorf("float variable %s requires range specification", spec.Name)
+func generateFloatValue(rng *rand.Rand, spec VariableSpec, difficulty float64) (float64, error) {
+	min, max, err := scaledRange(spec, difficulty)
+	if err != nil {
+		return 0, err
 	}
 
-	min := spec.Range.Min
-	max := spec.Range.Max
+	if step := spec.Range.Step; step > 0 {
+		n, err := stepCount(spec, min, max, step)
+		if err != nil {
+			return 0, err
+		}
+		return math.Min(max, min+float64(rng.Intn(n))*step), nil
+	}
 
 	// Generate base value
-	value := min + s.rand.Float64()*(max-min)
+	value := min + rng.Float64()*(max-min)
 
 	// Apply difficulty-based precision
 	precision := 2 // Default 2 decimal places
@@ -302,62 +701,246 @@ func (s *Service) generateFloatValue(spec VariableSpec, difficulty float64) (flo
 	}
 
 	multiplier := math.Pow(10, float64(precision))
-	return math.Round(value*multiplier) / multiplier, nil
+	return math.Max(min, math.Min(max, math.Round(value*multiplier)/multiplier)), nil
+}
+
+// scaledRange returns the spec's range with its span widened by the
+// DifficultyScale factor at the given difficulty
+func scaledRange(spec VariableSpec, difficulty float64) (float64, float64, error) {
+	if spec.Range == nil {
+		return 0, 0, fmt.Errorf("%s variable %s requires range specification", spec.Type, spec.Name)
+	}
+
+	min, max := spec.Range.Min, spec.Range.Max
+	if max < min {
+		return 0, 0, fmt.Errorf("%s variable %s has min %g greater than max %g", spec.Type, spec.Name, min, max)
+	}
+
+	scale := spec.DifficultyScale
+	if scale == 0 {
+		scale = 1.0
+	}
+	max = min + (max-min)*(1+difficulty*(scale-1))
+	if max < min {
+		max = min
+	}
+	return min, max, nil
+}
+
+// stepCount returns how many values min, min+step, ... fit within max
+func stepCount(spec VariableSpec, min, max, step float64) (int, error) {
+	// Tolerate float error so e.g. [0.1, 0.3] step 0.1 still includes 0.3
+	steps := math.Floor((max-min)/step + 1e-9)
+	if steps > maxIntegerSpan {
+		return 0, fmt.Errorf("%s variable %s has too many steps of %g in range [%g, %g]", spec.Type, spec.Name, step, min, max)
+	}
+	return int(steps) + 1, nil
 }
 
 // generateStringValue selects from predefined options or generates content
-func (s *Service) generateStringValue(spec VariableSpec, difficulty float64) (string, error) {
+func generateStringValue(rng *rand.Rand, spec VariableSpec, difficulty float64) (string, error) {
 	if len(spec.Options) == 0 {
 		return "", fmt.Errorf("string variable %s requires options", spec.Name)
 	}
 
 	// Simple random selection from options
-	index := s.rand.Intn(len(spec.Options))
+	index := rng.Intn(len(spec.Options))
 	return spec.Options[index], nil
 }
 
-// generateArrayValue creates array values for complex question types
-func (s *Service) generateArrayValue(spec VariableSpec, difficulty float64) ([]interface{}, error) {
-	// Implementation depends on specific array requirements
-	// For Phase 2.1, return simple placeholder
-	return []interface{}{}, nil
+// maxArrayLength bounds generated arrays to keep questions readable
+const maxArrayLength = 100
+
+// maxArrayAttemptsPerElement bounds retries when drawing unique elements
+const maxArrayAttemptsPerElement = 50
+
+// generateArrayValue creates array values for complex question types, e.g.
+// a dataset for a statistics question. Elements are generated like scalar
+// variables of ElementType using the spec's Range or Options; the "unique"
+// and "sorted" ("asc" or "desc") metadata flags constrain the result.
+func generateArrayValue(rng *rand.Rand, spec VariableSpec, difficulty float64) ([]interface{}, error) {
+	length, err := arrayLength(rng, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	element := spec
+	element.Type = spec.ElementType
+	if element.Type == "" {
+		element.Type = "integer"
+	}
+	if element.Type == "array" || element.Type == "computed" {
+		return nil, fmt.Errorf("array variable %s has unsupported element type %s", spec.Name, element.Type)
+	}
+
+	unique := metadataBool(spec.Metadata, "unique")
+	if unique {
+		if capacity := distinctValues(element); capacity >= 0 && capacity < length {
+			return nil, fmt.Errorf("array variable %s needs %d unique elements but its range only allows %d", spec.Name, length, capacity)
+		}
+	}
+
+	values := make([]interface{}, 0, length)
+	seen := make(map[interface{}]bool, length)
+	for attempts := 0; len(values) < length; attempts++ {
+		if attempts >= maxArrayAttemptsPerElement*length {
+			return nil, fmt.Errorf("array variable %s: could not generate %d unique elements", spec.Name, length)
+		}
+		value, err := generateVariableValue(rng, element, difficulty, nil)
+		if err != nil {
+			return nil, fmt.Errorf("array variable %s: %w", spec.Name, err)
+		}
+		if unique {
+			if seen[value] {
+				continue
+			}
+			seen[value] = true
+		}
+		values = append(values, value)
+	}
+
+	switch order := metadataString(spec.Metadata, "sorted"); {
+	case order == "asc" || metadataBool(spec.Metadata, "sorted"):
+		sort.SliceStable(values, func(i, j int) bool { return lessValue(values[i], values[j]) })
+	case order == "desc":
+		sort.SliceStable(values, func(i, j int) bool { return lessValue(values[j], values[i]) })
+	}
+
+	return values, nil
 }
 
-// generateComputedValue evaluates formula-based variables
-func (s *Service) generateComputedValue(spec VariableSpec, existingVars map[string]interface{}) (interface{}, error) {
-	if spec.Formula == "" {
-		return nil, fmt.Errorf("computed variable %s requires formula", spec.Name)
+// arrayLength resolves the fixed or randomly drawn length of an array variable
+func arrayLength(rng *rand.Rand, spec VariableSpec) (int, error) {
+	length := spec.Length
+	if length <= 0 {
+		if spec.LengthRange == nil {
+			return 0, fmt.Errorf("array variable %s requires length or length_range", spec.Name)
+		}
+		min, max := int(spec.LengthRange.Min), int(spec.LengthRange.Max)
+		if min < 1 || max < min {
+			return 0, fmt.Errorf("array variable %s has invalid length_range [%d, %d]", spec.Name, min, max)
+		}
+		length = min + rng.Intn(max-min+1)
 	}
 
-	// Simple formula evaluation for Phase 2.1
-	// In production, would use proper expression evaluator
-	formula := spec.Formula
-	for varName, value := range existingVars {
-		placeholder := fmt.Sprintf("{{%s}}", varName)
-		formula = strings.ReplaceAll(formula, placeholder, fmt.Sprintf("%v", value))
+	if length > maxArrayLength {
+		return 0, fmt.Errorf("array variable %s length %d exceeds maximum of %d", spec.Name, length, maxArrayLength)
 	}
+	return length, nil
+}
 
-	// Basic arithmetic evaluation (simplified)
-	if strings.Contains(formula, "+") {
-		parts := strings.Split(formula, "+")
-		if len(parts) == 2 {
-			a, _ := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
-			b, _ := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
-			return a + b, nil
+// distinctValues returns how many distinct values an element spec can
+// produce, or -1 when that is effectively unbounded
+func distinctValues(element VariableSpec) int {
+	switch element.Type {
+	case "string":
+		distinct := make(map[string]bool, len(element.Options))
+		for _, option := range element.Options {
+			distinct[option] = true
+		}
+		return len(distinct)
+	case "integer":
+		if element.Range == nil {
+			return -1
+		}
+		min, max := element.Range.Min, element.Range.Max
+		if max < min || max-min > maxIntegerSpan {
+			return -1 // Generation reports the range itself
+		}
+		if step := element.Range.Step; step > 0 {
+			if (max-min)/step > maxIntegerSpan {
+				return -1
+			}
+			return int((max-min)/step) + 1
 		}
+		return int(math.Max(0, math.Floor(max)-math.Ceil(min)+1))
+	default:
+		return -1
 	}
+}
 
-	return formula, nil
+// lessValue orders array elements numerically, falling back to string order
+func lessValue(a, b interface{}) bool {
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if aok && bok {
+		return af < bf
+	}
+	return fmt.Sprintf("%v", a) < fmt.Sprintf("%v", b)
 }
 
-// fillTemplateText replaces variable placeholders with generated values
-func (s *Service) fillTemplateText(templateText string, variables map[string]interface{}) (string, error) {
-	result := templateText
+// toFloat converts numeric variable values to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
 
-	for varName, value := range variables {
-		placeholder := fmt.Sprintf("{{%s}}", varName)
-		replacement := fmt.Sprintf("%v", value)
-		result = strings.ReplaceAll(result, placeholder, replacement)
+// metadataBool reads a boolean flag from variable metadata
+func metadataBool(metadata map[string]interface{}, key string) bool {
+	b, _ := metadata[key].(bool)
+	return b
+}
+
+// metadataString reads a string flag from variable metadata
+func metadataString(metadata map[string]interface{}, key string) string {
+	str, _ := metadata[key].(string)
+	return str
+}
+
+// generateComputedValue evaluates formula-based variables over the
+// variables generated before them
+func generateComputedValue(spec VariableSpec, existingVars map[string]interface{}) (interface{}, error) {
+	if spec.Formula == "" {
+		return nil, fmt.Errorf("computed variable %s requires formula", spec.Name)
+	}
+
+	value, err := evaluateFormula(spec.Formula, existingVars)
+	if err != nil {
+		return nil, fmt.Errorf("computed variable %s: %w", spec.Name, err)
+	}
+	return value, nil
+}
+
+// fillTemplateText replaces variable placeholders with generated values.
+// Arrays render as "1, 2, 3", or "[1, 2, 3]" when the spec sets "bracketed".
+// LATEX templates keep their $...$ spans intact, with numbers inside them
+// formatted as LaTeX.
+func (s *Service) fillTemplateText(templateText string, variables map[string]interface{}, specs []VariableSpec, renderFormat string) (string, error) {
+	bracketed := make(map[string]bool)
+	for _, spec := range specs {
+		bracketed[spec.Name] = metadataBool(spec.Metadata, "bracketed")
+	}
+
+	segments := []textSegment{{text: templateText}}
+	if renderFormat == RenderFormatLatex {
+		var err error
+		if segments, err = splitLatex(templateText); err != nil {
+			return "", fmt.Errorf("unbalanced LaTeX delimiters: %w", err)
+		}
+	}
+
+	var filled strings.Builder
+	for _, segment := range segments {
+		text := segment.text
+		for varName, value := range variables {
+			placeholder := fmt.Sprintf("{{%s}}", varName)
+			text = strings.ReplaceAll(text, placeholder, formatValue(value, bracketed[varName], segment.math))
+		}
+		filled.WriteString(text)
+	}
+	result := filled.String()
+
+	// A substituted value must not open or close a math span
+	if renderFormat == RenderFormatLatex {
+		if err := ValidateLatexDelimiters(result); err != nil {
+			return result, fmt.Errorf("substituted values broke LaTeX delimiters: %w", err)
+		}
 	}
 
 	// Check for unfilled placeholders
@@ -368,28 +951,18 @@ func (s *Service) fillTemplateText(templateText string, variables map[string]int
 	return result, nil
 }
 
-// generateMCQOptions creates multiple choice options for questions
-func (s *Service) generateMCQOptions(ctx context.Context, optionsTemplate string, variables map[string]interface{}, difficulty float64) (map[string]string, error) {
-	// Parse options template (simplified for Phase 2.1)
-	options := make(map[string]string)
-	
-	// Generate 4 options (A, B, C, D) with one correct answer
-	options["A"] = "Option A placeholder"
-	options["B"] = "Option B placeholder"
-	options["C"] = "Option C placeholder"
-	options["D"] = "Option D placeholder"
-
-	return options, nil
-}
-
 // calculateCorrectAnswer computes the correct answer based on template logic
-func (s *Service) calculateCorrectAnswer(template *db.QuestionTemplate, variables map[string]interface{}) (string, error) {
+func (s *Service) calculateCorrectAnswer(template *db.QuestionTemplate, variables map[string]interface{}, specs []VariableSpec) (string, error) {
+	if template.AnswerFormula != nil && *template.AnswerFormula != "" {
+		return formulaAnswer(*template.AnswerFormula, template.AnswerUnit, variables)
+	}
+
 	// For Phase 2.1, implement basic answer calculation
 	// In production, this would include comprehensive answer logic
 
 	switch template.Subject {
 	case "PHYSICS":
-		return s.calculatePhysicsAnswer(template, variables)
+		return s.calculatePhysicsAnswer(template, variables, specs)
 	case "CHEMISTRY":
 		return s.calculateChemistryAnswer(template, variables)
 	case "MATHEMATICS":
@@ -401,20 +974,87 @@ func (s *Service) calculateCorrectAnswer(template *db.QuestionTemplate, variable
 	}
 }
 
+// formulaAnswer evaluates an answer formula, whose result is in answerUnit.
+// Templates and passage sub-questions share it.
+func formulaAnswer(formula string, answerUnit *string, variables map[string]interface{}) (string, error) {
+	value, err := evaluateFormula(formula, variables)
+	if err != nil {
+		return "", fmt.Errorf("answer formula: %w", err)
+	}
+	unit := units.Dimensionless
+	if answerUnit != nil {
+		if unit, err = units.Parse(*answerUnit); err != nil {
+			return "", fmt.Errorf("answer unit: %w", err)
+		}
+	}
+	return formatAnswer(units.Quantity{Value: value, Unit: unit}, answerUnit)
+}
+
+// kinematicsUnits are assumed for kinematics variables that declare no unit
+var kinematicsUnits = map[string]string{"v0": "m/s", "a": "m/s^2", "t": "s"}
+
 // Subject-specific answer calculation methods
-func (s *Service) calculatePhysicsAnswer(template *db.QuestionTemplate, variables map[string]interface{}) (string, error) {
+func (s *Service) calculatePhysicsAnswer(template *db.QuestionTemplate, variables map[string]interface{}, specs []VariableSpec) (string, error) {
+	quantities, err := variableQuantities(variables, specs, kinematicsUnits)
+	if err != nil {
+		return "", err
+	}
+
 	// Example: Kinematics calculation v = u + at
-	if u, ok := variables["v0"].(int); ok {
-		if a, ok := variables["a"].(int); ok {
-			if t, ok := variables["t"].(int); ok {
-				result := u + a*t
-				return fmt.Sprintf("%d m/s", result), nil
-			}
+	if u, a, t, ok := kinematicsQuantities(quantities); ok {
+		v, err := u.Add(a.Mul(t))
+		if err != nil {
+			return "", fmt.Errorf("v = u + at: %w", err)
 		}
+		return formatAnswer(v, template.AnswerUnit)
 	}
 	return "Physics answer", nil
 }
 
+// variableQuantities pairs each numeric variable with its declared unit,
+// falling back to defaults and then to a dimensionless number
+func variableQuantities(variables map[string]interface{}, specs []VariableSpec, defaults map[string]string) (map[string]units.Quantity, error) {
+	declared := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		declared[spec.Name] = spec.Unit
+	}
+
+	quantities := make(map[string]units.Quantity)
+	for name, value := range variables {
+		number, ok := toFloat(value)
+		if !ok {
+			continue
+		}
+		symbol := declared[name]
+		if symbol == "" {
+			symbol = defaults[name]
+		}
+		unit, err := units.Parse(symbol)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", name, err)
+		}
+		quantities[name] = units.Quantity{Value: number, Unit: unit}
+	}
+	return quantities, nil
+}
+
+// formatAnswer renders q in the template's answer unit, failing when the
+// computed dimension does not match it. FillTemplate rounds the value to the
+// template's answer precision.
+func formatAnswer(q units.Quantity, answerUnit *string) (string, error) {
+	if answerUnit != nil && *answerUnit != "" {
+		target, err := units.Parse(*answerUnit)
+		if err != nil {
+			return "", fmt.Errorf("answer unit: %w", err)
+		}
+		if q, err = q.ConvertTo(target); err != nil {
+			return "", err
+		}
+	}
+
+	return q.String(), nil
+}
+
 func (s *Service) calculateChemistryAnswer(template *db.QuestionTemplate, variables map[string]interface{}) (string, error) {
 	return "Chemistry answer", nil
 }
@@ -426,16 +1066,3 @@ func (s *Service) calculateMathematicsAnswer(template *db.QuestionTemplate, vari
 func (s *Service) calculateBiologyAnswer(template *db.QuestionTemplate, variables map[string]interface{}) (string, error) {
 	return "Biology answer", nil
 }
-
-// generateSolutionSteps creates step-by-step solution explanations
-func (s *Service) generateSolutionSteps(template *db.QuestionTemplate, variables map[string]interface{}) ([]string, error) {
-	// Generate solution steps based on template and subject
-	steps := []string{
-		"Step 1: Identify given values",
-		"Step 2: Apply relevant formula/concept",
-		"Step 3: Substitute values and calculate",
-		"Step 4: Express final answer with units",
-	}
-
-	return steps, nil
-}
\ No newline at end of file
@@ -0,0 +1,78 @@
+package templates
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"question-generator-service/pkg/units"
+)
+
+const (
+	// DefaultAnswerPrecision is the number of decimal places answers of
+	// templates without an answer_precision are rounded to. Their trailing
+	// zeros are dropped, so 9.80 is written 9.8.
+	DefaultAnswerPrecision = 2
+	// MaxAnswerPrecision bounds a template's answer_precision
+	MaxAnswerPrecision = 6
+)
+
+// unitSpacing removes the spaces around the operators of a unit, so that
+// "m / s^2" is written "m/s^2"
+var unitSpacing = strings.NewReplacer(" / ", "/", " /", "/", "/ ", "/", " * ", "*", " *", "*", "* ", "*")
+
+// CanonicalAnswer writes an answer or MCQ option the way it is stored and
+// returned: trimmed, with single spaces, and, when it is a number with an
+// optional known unit, with the number rounded to precision decimal places
+// and one space before the unit in ASCII form. A nil precision rounds to
+// DefaultAnswerPrecision and drops trailing zeros. Equivalent answers such as
+// "9 m/s²" and "9.00  m/s^2" are thereby written the same way, while text
+// such as "2 times the mass" only has its whitespace tidied.
+func CanonicalAnswer(answer string, precision *int) string {
+	answer = strings.Join(strings.Fields(answer), " ")
+	match := QuantityPattern.FindStringSubmatch(answer)
+	if match == nil {
+		return answer
+	}
+
+	unit := unitSpacing.Replace(answerReplacer.Replace(match[2]))
+	if _, err := units.Parse(unit); err != nil {
+		return answer
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil || math.IsInf(value, 0) {
+		return answer
+	}
+
+	number := formatDecimal(value, precision)
+	if unit == "" {
+		return number
+	}
+	return number + " " + unit
+}
+
+// canonicalOptions rewrites each option with CanonicalAnswer
+func canonicalOptions(options map[string]string, precision *int) {
+	for key, option := range options {
+		options[key] = CanonicalAnswer(option, precision)
+	}
+}
+
+// formatDecimal rounds value to precision decimal places, see CanonicalAnswer
+func formatDecimal(value float64, precision *int) string {
+	places := DefaultAnswerPrecision
+	if precision != nil {
+		places = *precision
+	}
+	scale := math.Pow(10, float64(places))
+	rounded := math.Round(value*scale) / scale
+	if rounded == 0 {
+		// Avoid "-0" for small negative answers
+		rounded = 0
+	}
+
+	if precision == nil {
+		return strconv.FormatFloat(rounded, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(rounded, 'f', places, 64)
+}
@@ -0,0 +1,86 @@
+package templates
+
+import (
+	"sync"
+	"time"
+)
+
+// RecentTemplates remembers the last few templates served to each session so
+// a student is not given the same template twice in a row. Keys idle for
+// longer than the TTL are forgotten.
+type RecentTemplates struct {
+	mu        sync.Mutex
+	entries   map[string]*recentEntry
+	window    int
+	ttl       time.Duration
+	lastSweep time.Time
+}
+
+type recentEntry struct {
+	ids      []string // Oldest first, at most window long
+	lastSeen time.Time
+}
+
+// NewRecentTemplates keeps up to window template IDs per key for ttl after
+// the key was last used
+func NewRecentTemplates(window int, ttl time.Duration) *RecentTemplates {
+	return &RecentTemplates{
+		entries:   make(map[string]*recentEntry),
+		window:    window,
+		ttl:       ttl,
+		lastSweep: time.Now(),
+	}
+}
+
+// Recent returns the templates recently served under key, oldest first
+func (rt *RecentTemplates) Recent(key string) []string {
+	if key == "" || rt.window <= 0 {
+		return nil
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	entry, ok := rt.entries[key]
+	if !ok || time.Since(entry.lastSeen) > rt.ttl {
+		return nil
+	}
+	return append([]string(nil), entry.ids...)
+}
+
+// Add records that templateID was served under key
+func (rt *RecentTemplates) Add(key, templateID string) {
+	if key == "" || rt.window <= 0 {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(rt.lastSweep) > rt.ttl {
+		for k, entry := range rt.entries {
+			if now.Sub(entry.lastSeen) > rt.ttl {
+				delete(rt.entries, k)
+			}
+		}
+		rt.lastSweep = now
+	}
+
+	entry, ok := rt.entries[key]
+	if !ok || now.Sub(entry.lastSeen) > rt.ttl {
+		entry = &recentEntry{}
+		rt.entries[key] = entry
+	}
+	entry.lastSeen = now
+
+	// Move a repeated ID to the newest position rather than storing it twice
+	for i, id := range entry.ids {
+		if id == templateID {
+			entry.ids = append(entry.ids[:i], entry.ids[i+1:]...)
+			break
+		}
+	}
+	entry.ids = append(entry.ids, templateID)
+	if len(entry.ids) > rt.window {
+		entry.ids = entry.ids[len(entry.ids)-rt.window:]
+	}
+}
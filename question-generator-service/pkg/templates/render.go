@@ -0,0 +1,113 @@
+package templates
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Render formats tell clients how math in the question text is marked up
+const (
+	RenderFormatPlain  = "PLAIN"
+	RenderFormatLatex  = "LATEX"
+	RenderFormatMathML = "MATHML"
+)
+
+// renderFormatOf returns the template's render format, PLAIN when unset
+func renderFormatOf(format string) string {
+	if format == "" {
+		return RenderFormatPlain
+	}
+	return format
+}
+
+// textSegment is a run of template text, either prose or a math span
+// including its $ or $$ delimiters
+type textSegment struct {
+	text string
+	math bool
+}
+
+// ValidateLatexDelimiters checks that every inline $...$ and display $$...$$
+// span is closed and that spans do not interleave. Escaped \$ is ignored.
+func ValidateLatexDelimiters(text string) error {
+	_, err := splitLatex(text)
+	return err
+}
+
+// splitLatex splits text into prose and math segments
+func splitLatex(text string) ([]textSegment, error) {
+	var segments []textSegment
+	open, openedAt, start := "", 0, 0
+
+	for i := 0; i < len(text); {
+		switch {
+		case text[i] == '\\':
+			i += 2 // Skip the escaped character, e.g. \$
+			continue
+		case text[i] != '$':
+			i++
+			continue
+		}
+
+		delim := "$"
+		if strings.HasPrefix(text[i:], "$$") {
+			delim = "$$"
+		}
+
+		switch open {
+		case "":
+			if i > start {
+				segments = append(segments, textSegment{text: text[start:i]})
+			}
+			open, openedAt, start = delim, i, i
+		case delim:
+			segments = append(segments, textSegment{text: text[start : i+len(delim)], math: true})
+			open, start = "", i+len(delim)
+		default:
+			return nil, fmt.Errorf("unexpected %s at offset %d inside %s span opened at offset %d", delim, i, open, openedAt)
+		}
+		i += len(delim)
+	}
+
+	if open != "" {
+		return nil, fmt.Errorf("unclosed %s span opened at offset %d", open, openedAt)
+	}
+	if start < len(text) {
+		segments = append(segments, textSegment{text: text[start:]})
+	}
+	return segments, nil
+}
+
+// formatValue renders a variable value for substitution. Inside math spans
+// floats use LaTeX notation, e.g. 1.5 \times 10^{-5} rather than 1.5e-05.
+func formatValue(value interface{}, bracketed, inMath bool) string {
+	switch v := value.(type) {
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, element := range v {
+			parts[i] = formatValue(element, false, inMath)
+		}
+		list := strings.Join(parts, ", ")
+		if bracketed {
+			return "[" + list + "]"
+		}
+		return list
+	case float64:
+		if inMath {
+			return latexNumber(v)
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// latexNumber formats f without exponent notation leaking into LaTeX
+func latexNumber(f float64) string {
+	formatted := strconv.FormatFloat(f, 'g', -1, 64)
+	mantissa, exponent, found := strings.Cut(formatted, "e")
+	if !found {
+		return formatted
+	}
+	exp, _ := strconv.Atoi(exponent)
+	return mantissa + ` \times 10^{` + strconv.Itoa(exp) + `}`
+}
@@ -0,0 +1,110 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/pkg/units"
+)
+
+// generateSolutionSteps works a filled question through with its actual
+// values: the given values, any computed variables, then the formula, its
+// substitution and the result when the template has an answer formula or
+// the subject calculation has one. Only answer formulas, computed
+// variables and the kinematics calculation can be worked through; other
+// templates get no steps rather than placeholder ones.
+func (s *Service) generateSolutionSteps(template *db.QuestionTemplate, variables map[string]interface{}, specs []VariableSpec, correctAnswer string) ([]string, error) {
+	var defaults map[string]string
+	if template.Subject == "PHYSICS" {
+		defaults = kinematicsUnits
+	}
+	quantities, err := variableQuantities(variables, specs, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []string
+	add := func(format string, args ...interface{}) {
+		steps = append(steps, fmt.Sprintf("Step %d: ", len(steps)+1)+fmt.Sprintf(format, args...))
+	}
+
+	var given []string
+	for _, spec := range specs {
+		value, ok := variables[spec.Name]
+		if !ok || spec.Formula != "" {
+			continue
+		}
+		if q, ok := quantities[spec.Name]; ok {
+			given = append(given, spec.Name+" = "+q.String())
+		} else {
+			given = append(given, spec.Name+" = "+formatValue(value, metadataBool(spec.Metadata, "bracketed"), false))
+		}
+	}
+	if len(given) > 0 {
+		add("Identify the given values: %s", strings.Join(given, ", "))
+	}
+
+	var computed int
+	for _, spec := range specs {
+		if spec.Formula == "" {
+			continue
+		}
+		computed++
+		named, substituted := substituteFormula(spec.Formula, variables)
+		add("Compute %s = %s = %s = %v", spec.Name, named, substituted, variables[spec.Name])
+	}
+
+	if template.AnswerFormula != nil && *template.AnswerFormula != "" {
+		named, substituted := substituteFormula(*template.AnswerFormula, variables)
+		add("Apply the formula: answer = %s", named)
+		add("Substitute the values: answer = %s = %s", substituted, correctAnswer)
+		add("Final answer: %s", correctAnswer)
+		return steps, nil
+	}
+
+	if template.Subject == "PHYSICS" {
+		if u, a, t, ok := kinematicsQuantities(quantities); ok {
+			at, err := a.Mul(t).ConvertTo(u.Unit)
+			if err != nil {
+				return nil, fmt.Errorf("v = u + at: %w", err)
+			}
+			add("Apply the first equation of motion: v = u + at")
+			add("Substitute the values: v = %s + (%s)(%s) = %s + %s", u, a, t, u, at)
+			add("Final answer: v = %s", correctAnswer)
+			return steps, nil
+		}
+	}
+
+	if computed == 0 {
+		return nil, nil
+	}
+	add("Final answer: %s", correctAnswer)
+	return steps, nil
+}
+
+// kinematicsQuantities returns the initial velocity, acceleration and time
+// of a v = u + at question
+func kinematicsQuantities(quantities map[string]units.Quantity) (u, a, t units.Quantity, ok bool) {
+	u, okU := quantities["v0"]
+	a, okA := quantities["a"]
+	t, okT := quantities["t"]
+	return u, a, t, okU && okA && okT
+}
+
+// substituteFormula renders a formula twice: with its placeholders as bare
+// variable names and with the variables' values, negative values in
+// parentheses so "{{u}} - {{a}}" reads "5 - (-2)"
+func substituteFormula(formula string, variables map[string]interface{}) (named, substituted string) {
+	named, substituted = formula, formula
+	for name, value := range variables {
+		placeholder := fmt.Sprintf("{{%s}}", name)
+		rendered := fmt.Sprintf("%v", value)
+		if number, ok := toFloat(value); ok && number < 0 {
+			rendered = "(" + rendered + ")"
+		}
+		named = strings.ReplaceAll(named, placeholder, name)
+		substituted = strings.ReplaceAll(substituted, placeholder, rendered)
+	}
+	return named, substituted
+}
@@ -0,0 +1,56 @@
+package templates
+
+import (
+	"context"
+
+	"question-generator-service/internal/db"
+)
+
+// GetTemplate returns the latest stored version of an active template,
+// bypassing the template cache
+func (s *Service) GetTemplate(ctx context.Context, templateID string) (*db.QuestionTemplate, error) {
+	return s.dbClient.GetQuestionTemplateUncached(ctx, templateID)
+}
+
+// SearchTemplates lists a page of templates, active or not, matching search
+func (s *Service) SearchTemplates(ctx context.Context, search db.TemplateSearch) (*db.TemplatePage, error) {
+	return s.dbClient.SearchTemplates(ctx, search)
+}
+
+// ListTopics lists the topics with active templates matching filters
+func (s *Service) ListTopics(ctx context.Context, filters db.TopicFilters) ([]db.TopicSummary, error) {
+	return s.dbClient.ListTopics(ctx, filters)
+}
+
+// CreateTemplate validates and stores a new template. Validation failures
+// are returned as a *TemplateValidationError.
+func (s *Service) CreateTemplate(ctx context.Context, qt *db.QuestionTemplate) error {
+	if err := ValidateTemplate(qt); err != nil {
+		return err
+	}
+	return s.dbClient.CreateTemplate(ctx, qt)
+}
+
+// UpdateTemplate validates and stores new content for an existing template
+func (s *Service) UpdateTemplate(ctx context.Context, qt *db.QuestionTemplate) error {
+	if err := ValidateTemplate(qt); err != nil {
+		return err
+	}
+	return s.dbClient.UpdateTemplate(ctx, qt)
+}
+
+// DeactivateTemplate stops a template from being selected or fetched
+func (s *Service) DeactivateTemplate(ctx context.Context, templateID string) error {
+	return s.dbClient.DeactivateTemplate(ctx, templateID)
+}
+
+// RecomputeStats refreshes a template's success rate and average solve
+// time from the answers submitted to its questions
+func (s *Service) RecomputeStats(ctx context.Context, templateID string) (*db.TemplateStats, error) {
+	return s.dbClient.RecomputeTemplateStats(ctx, templateID)
+}
+
+// RecomputeAllStats runs RecomputeStats for every template
+func (s *Service) RecomputeAllStats(ctx context.Context) ([]*db.TemplateStats, error) {
+	return s.dbClient.RecomputeAllTemplateStats(ctx)
+}
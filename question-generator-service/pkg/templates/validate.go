@@ -0,0 +1,269 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"question-generator-service/internal/db"
+)
+
+// FieldError describes one invalid field of a template, e.g.
+// variable_slots[1].range
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// TemplateValidationError lists every invalid field found in a template
+type TemplateValidationError struct {
+	Fields []FieldError
+}
+
+func (e *TemplateValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return "invalid template: " + strings.Join(parts, "; ")
+}
+
+// fieldErrors accumulates FieldErrors while a template is checked
+type fieldErrors []FieldError
+
+func (fe *fieldErrors) add(field, format string, args ...interface{}) {
+	*fe = append(*fe, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (fe fieldErrors) err() error {
+	if len(fe) == 0 {
+		return nil
+	}
+	return &TemplateValidationError{Fields: fe}
+}
+
+// Allowed values of the question_templates CHECK constraints
+var (
+	validExamTypes     = []string{"JEE_MAIN", "JEE_ADVANCED", "NEET", "FOUNDATION"}
+	validSubjects      = []string{"PHYSICS", "CHEMISTRY", "MATHEMATICS", "BIOLOGY"}
+	validFormats       = []string{"MCQ", "NUMERICAL", "ASSERTION_REASON", "PASSAGE", "MATRIX_MATCH"}
+	validRenderFormats = []string{RenderFormatPlain, RenderFormatLatex, RenderFormatMathML}
+	validElementTypes  = []string{"integer", "float", "string"}
+)
+
+// ValidateTemplate checks a template before it is stored: required fields,
+// the question_templates constraints and its variable slots. It returns a
+// *TemplateValidationError listing every problem found.
+func ValidateTemplate(qt *db.QuestionTemplate) error {
+	var errs fieldErrors
+
+	requireOneOf(&errs, "exam_type", qt.ExamType, validExamTypes)
+	requireOneOf(&errs, "subject", qt.Subject, validSubjects)
+	requireOneOf(&errs, "format", qt.Format, validFormats)
+	if qt.RenderFormat != "" {
+		requireOneOf(&errs, "render_format", qt.RenderFormat, validRenderFormats)
+	}
+	if strings.TrimSpace(qt.TopicID) == "" {
+		errs.add("topic_id", "is required")
+	}
+	if strings.TrimSpace(qt.Chapter) == "" {
+		errs.add("chapter", "is required")
+	}
+
+	if strings.TrimSpace(qt.TemplateText) == "" {
+		errs.add("template_text", "is required")
+	} else if qt.RenderFormat == RenderFormatLatex {
+		if err := ValidateLatexDelimiters(qt.TemplateText); err != nil {
+			errs.add("template_text", "%v", err)
+		}
+	}
+
+	if qt.BaseDifficulty < 0.1 || qt.BaseDifficulty > 1.0 {
+		errs.add("base_difficulty", "must be between 0.1 and 1.0, got %g", qt.BaseDifficulty)
+	}
+	if qt.BloomLevel < 1 || qt.BloomLevel > 6 {
+		errs.add("bloom_level", "must be between 1 and 6, got %d", qt.BloomLevel)
+	}
+	if qt.ConceptDepth < 1 || qt.ConceptDepth > 5 {
+		errs.add("concept_depth", "must be between 1 and 5, got %d", qt.ConceptDepth)
+	}
+
+	if tol := qt.NumericalTolerance; tol != nil {
+		if tol.Absolute < 0 {
+			errs.add("numerical_tolerance.absolute", "must not be negative, got %g", tol.Absolute)
+		}
+		if tol.Relative < 0 || tol.Relative >= 1 {
+			errs.add("numerical_tolerance.relative", "must be at least 0 and below 1, got %g", tol.Relative)
+		}
+	}
+	if p := qt.AnswerPrecision; p != nil && (*p < 0 || *p > MaxAnswerPrecision) {
+		errs.add("answer_precision", "must be between 0 and %d, got %d", MaxAnswerPrecision, *p)
+	}
+
+	if qt.OptionsTemplate != nil && !json.Valid([]byte(*qt.OptionsTemplate)) {
+		errs.add("options_template", "must be valid JSON")
+	} else {
+		validateFormatSpec(&errs, qt.Format, qt.OptionsTemplate)
+	}
+
+	validateHindi(&errs, qt)
+
+	specs := validateVariableSlots(&errs, qt.VariableSlots)
+	if qt.AnswerFormula != nil {
+		validateAnswerFormula(&errs, "answer_formula", *qt.AnswerFormula, specs)
+	}
+	if qt.Format == "PASSAGE" {
+		if spec, err := parsePassageTemplate(qt.OptionsTemplate); err == nil {
+			for i, q := range spec.Questions {
+				if q.AnswerFormula != "" {
+					field := fmt.Sprintf("options_template.questions[%d].answer_formula", i)
+					validateAnswerFormula(&errs, field, q.AnswerFormula, specs)
+				}
+			}
+		}
+	}
+
+	return errs.err()
+}
+
+// validateAnswerFormula checks that an answer formula parses and only uses
+// declared variables
+func validateAnswerFormula(errs *fieldErrors, field, src string, specs []VariableSpec) {
+	if strings.TrimSpace(src) == "" {
+		errs.add(field, "must not be empty when set")
+		return
+	}
+	f, err := parseFormula(src)
+	if err != nil {
+		errs.add(field, "%v", err)
+		return
+	}
+	declared := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		declared[spec.Name] = true
+	}
+	for _, name := range f.variables {
+		if !declared[name] {
+			errs.add(field, "refers to undefined variable %s", name)
+		}
+	}
+}
+
+// ValidateVariableSlots parses the variable_slots JSON into VariableSpecs and
+// checks that each one can be generated. Unknown keys are rejected so that a
+// misspelt "rnage" fails here rather than at generation time.
+func ValidateVariableSlots(raw string) ([]VariableSpec, error) {
+	var errs fieldErrors
+	specs := validateVariableSlots(&errs, raw)
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+func validateVariableSlots(errs *fieldErrors, raw string) []VariableSpec {
+	if strings.TrimSpace(raw) == "" {
+		raw = "[]"
+	}
+
+	var specs []VariableSpec
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&specs); err != nil {
+		errs.add("variable_slots", "must be a JSON array of variable specs: %v", err)
+		return nil
+	}
+
+	names := make(map[string]int, len(specs))
+	for i, spec := range specs {
+		field := fmt.Sprintf("variable_slots[%d]", i)
+		if spec.Name == "" {
+			errs.add(field+".name", "is required")
+		} else if first, dup := names[spec.Name]; dup {
+			errs.add(field+".name", "duplicates variable_slots[%d]", first)
+		} else {
+			names[spec.Name] = i
+		}
+		validateVariableSpec(errs, field, spec)
+	}
+	return specs
+}
+
+// validateVariableSpec checks the fields each variable type needs
+func validateVariableSpec(errs *fieldErrors, field string, spec VariableSpec) {
+	if spec.DifficultyScale < 0 {
+		errs.add(field+".difficulty_scale", "must not be negative")
+	}
+
+	switch spec.Type {
+	case "integer", "float":
+		validateRange(errs, field+".range", spec.Range)
+	case "string":
+		if len(spec.Options) == 0 {
+			errs.add(field+".options", "is required for string variables")
+		}
+	case "computed":
+		if strings.TrimSpace(spec.Formula) == "" {
+			errs.add(field+".formula", "is required for computed variables")
+		} else if _, err := parseFormula(spec.Formula); err != nil {
+			errs.add(field+".formula", "%v", err)
+		}
+	case "array":
+		validateArraySpec(errs, field, spec)
+	case "":
+		errs.add(field+".type", "is required")
+	default:
+		errs.add(field+".type", "unsupported variable type %q", spec.Type)
+	}
+}
+
+func validateArraySpec(errs *fieldErrors, field string, spec VariableSpec) {
+	switch {
+	case spec.Length < 0:
+		errs.add(field+".length", "must not be negative")
+	case spec.Length > maxArrayLength:
+		errs.add(field+".length", "must not exceed %d", maxArrayLength)
+	case spec.Length == 0 && spec.LengthRange == nil:
+		errs.add(field+".length", "length or length_range is required for array variables")
+	case spec.Length == 0:
+		if min, max := spec.LengthRange.Min, spec.LengthRange.Max; min < 1 || max < min || max > maxArrayLength {
+			errs.add(field+".length_range", "must satisfy 1 <= min <= max <= %d", maxArrayLength)
+		}
+	}
+
+	switch spec.ElementType {
+	case "", "integer", "float":
+		validateRange(errs, field+".range", spec.Range)
+	case "string":
+		if len(spec.Options) == 0 {
+			errs.add(field+".options", "is required for string elements")
+		}
+	default:
+		errs.add(field+".element_type", "must be one of %s", strings.Join(validElementTypes, ", "))
+	}
+}
+
+func validateRange(errs *fieldErrors, field string, r *RangeSpec) {
+	switch {
+	case r == nil:
+		errs.add(field, "is required for numeric variables")
+	case r.Max < r.Min:
+		errs.add(field, "min %g is greater than max %g", r.Min, r.Max)
+	case r.Step < 0:
+		errs.add(field+".step", "must not be negative")
+	}
+}
+
+func requireOneOf(errs *fieldErrors, field, value string, allowed []string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	if value == "" {
+		errs.add(field, "is required")
+		return
+	}
+	errs.add(field, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
@@ -0,0 +1,126 @@
+package templates
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Bounds and defaults of AnalyzeVariety
+const (
+	DefaultVarietySamples = 100
+	MinVarietySamples     = 20
+	MaxVarietySamples     = 1000
+
+	// MinDistinctRatio is the share of samples that must be distinct
+	// questions for a template not to be flagged
+	MinDistinctRatio = 0.5
+	// MinAnswerEntropy is the entropy, in bits, the sampled answers must
+	// reach for a template not to be flagged: about four equally likely
+	// answers
+	MinAnswerEntropy = 2.0
+)
+
+// VarietyRequest asks AnalyzeVariety how varied a template's questions are
+type VarietyRequest struct {
+	TemplateID string
+	Samples    int     // DefaultVarietySamples when zero; callers keep it within the bounds
+	Difficulty float64 // The template's base difficulty when zero
+}
+
+// VarietyReport describes how varied the questions filled from a template
+// are. A template whose variables keep resolving to the same few values
+// serves students near-identical questions.
+type VarietyReport struct {
+	TemplateID        string   `json:"template_id"`
+	Samples           int      `json:"samples"`
+	Difficulty        float64  `json:"difficulty"`
+	DistinctQuestions int      `json:"distinct_questions"`
+	DistinctRatio     float64  `json:"distinct_ratio"`
+	DistinctAnswers   int      `json:"distinct_answers"`
+	AnswerEntropy     float64  `json:"answer_entropy"` // Shannon entropy of the answers, in bits
+	LowVariety        bool     `json:"low_variety"`
+	Reasons           []string `json:"reasons,omitempty"` // Why the template was flagged
+}
+
+// AnalyzeVariety fills a stored template req.Samples times, with seeds 1
+// to Samples so the report is reproducible, and flags it when too few of
+// the questions are distinct or their answers carry too little entropy.
+// Like preview, it neither logs nor counts usage. A sample the template
+// cannot be filled for fails the analysis with ErrTemplateInvalid.
+func (s *Service) AnalyzeVariety(ctx context.Context, req VarietyRequest) (*VarietyReport, error) {
+	samples := req.Samples
+	if samples == 0 {
+		samples = DefaultVarietySamples
+	}
+
+	template, err := s.dbClient.GetQuestionTemplateUncached(ctx, req.TemplateID)
+	if err != nil {
+		return nil, err
+	}
+	difficulty := req.Difficulty
+	if difficulty == 0 {
+		difficulty = template.BaseDifficulty
+	}
+
+	questions := make(map[string]bool, samples)
+	answers := make(map[string]int)
+	for seed := int64(1); seed <= int64(samples); seed++ {
+		question, err := s.FillTemplate(ctx, TemplateFillRequest{
+			Template:             template,
+			CalibratedDifficulty: difficulty,
+			RandomSeed:           seed,
+		})
+		if err != nil {
+			return nil, err
+		}
+		questions[question.QuestionText] = true
+		answers[answerValue(question)]++
+	}
+
+	report := &VarietyReport{
+		TemplateID:        template.TemplateID,
+		Samples:           samples,
+		Difficulty:        difficulty,
+		DistinctQuestions: len(questions),
+		DistinctRatio:     float64(len(questions)) / float64(samples),
+		DistinctAnswers:   len(answers),
+		AnswerEntropy:     entropy(answers, samples),
+	}
+	if report.DistinctRatio < MinDistinctRatio {
+		report.Reasons = append(report.Reasons, fmt.Sprintf("only %d of %d samples are distinct questions", report.DistinctQuestions, samples))
+	}
+	if report.AnswerEntropy < MinAnswerEntropy {
+		report.Reasons = append(report.Reasons, fmt.Sprintf("answer entropy %.2f bits is below %.2f", report.AnswerEntropy, MinAnswerEntropy))
+	}
+	report.LowVariety = len(report.Reasons) > 0
+	return report, nil
+}
+
+// answerValue is the normalized value of a question's correct answer: the
+// text of the correct option for MCQs, whose answer is only a letter
+func answerValue(question *GeneratedQuestion) string {
+	if value, ok := question.Options[question.CorrectAnswer]; ok {
+		return NormalizeAnswer(value)
+	}
+	return NormalizeAnswer(question.CorrectAnswer)
+}
+
+// entropy is the Shannon entropy, in bits, of total observations spread
+// over counts. Terms are summed in a fixed order so the same counts always
+// give the same value.
+func entropy(counts map[string]int, total int) float64 {
+	ns := make([]int, 0, len(counts))
+	for _, n := range counts {
+		ns = append(ns, n)
+	}
+	sort.Ints(ns)
+
+	var h float64
+	for _, n := range ns {
+		p := float64(n) / float64(total)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
@@ -0,0 +1,97 @@
+package templates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"question-generator-service/internal/db"
+)
+
+// WarmupResult reports what a warm-up preloaded
+type WarmupResult struct {
+	Templates int           // Templates cached with their variable specs parsed
+	Duration  time.Duration // Time taken, queries included
+}
+
+// WarmUp preloads the topN most used active templates of each subject into
+// the database client's template cache and parses their variable specs, so
+// the first requests after startup do not pay for either. Templates whose
+// variable_slots do not parse are skipped; generation reports them.
+func (s *Service) WarmUp(ctx context.Context, topN int) (*WarmupResult, error) {
+	start := time.Now()
+	var warmed []*db.QuestionTemplate
+	for _, subject := range validSubjects {
+		templates, err := s.dbClient.GetTemplatesByFilters(ctx, db.TemplateFilters{Subject: subject, Limit: topN})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s templates: %w", subject, err)
+		}
+		for _, selected := range templates {
+			// Selection rows leave out columns such as the numerical
+			// tolerance, so the cache is filled with the full rows
+			qt, err := s.dbClient.GetQuestionTemplateUncached(ctx, selected.TemplateID)
+			if errors.Is(err, db.ErrTemplateNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to load template %s: %w", selected.TemplateID, err)
+			}
+			if _, err := s.variableSpecs(qt); err == nil {
+				warmed = append(warmed, qt)
+			}
+		}
+	}
+	s.dbClient.WarmTemplateCache(warmed)
+	return &WarmupResult{Templates: len(warmed), Duration: time.Since(start)}, nil
+}
+
+// specCache keeps the parsed variable specs of templates by ID. Entries
+// remember the variable_slots they were parsed from, so an edited template
+// is parsed afresh; the cache grows with the number of templates filled.
+type specCache struct {
+	mu      sync.RWMutex
+	entries map[string]cachedSpecs
+}
+
+type cachedSpecs struct {
+	slots string
+	specs []VariableSpec
+}
+
+// variableSpecs returns the parsed variable specs of qt, parsing and
+// caching them on first use. The returned specs are shared and must not be
+// modified.
+func (s *Service) variableSpecs(qt *db.QuestionTemplate) ([]VariableSpec, error) {
+	s.specs.mu.RLock()
+	cached, ok := s.specs.entries[qt.TemplateID]
+	s.specs.mu.RUnlock()
+	if ok && cached.slots == qt.VariableSlots {
+		return cached.specs, nil
+	}
+
+	var specs []VariableSpec
+	if err := json.Unmarshal([]byte(qt.VariableSlots), &specs); err != nil {
+		return nil, err
+	}
+	if qt.TemplateID != "" {
+		s.specs.mu.Lock()
+		if s.specs.entries == nil {
+			s.specs.entries = make(map[string]cachedSpecs)
+		}
+		s.specs.entries[qt.TemplateID] = cachedSpecs{slots: qt.VariableSlots, specs: specs}
+		s.specs.mu.Unlock()
+	}
+	return specs, nil
+}
+
+// HasParsedSpecs reports whether the variable specs of templateID are
+// cached, e.g. after WarmUp
+func (s *Service) HasParsedSpecs(templateID string) bool {
+	s.specs.mu.RLock()
+	defer s.specs.mu.RUnlock()
+	_, ok := s.specs.entries[templateID]
+	return ok
+}
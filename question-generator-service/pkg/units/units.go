@@ -0,0 +1,277 @@
+// Package units models physical units as SI base-unit dimension vectors so
+// generated answers can be checked for dimensional consistency and
+// converted between compatible units.
+package units
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrDimensionMismatch is returned when quantities of incompatible units are
+// added, compared or converted
+var ErrDimensionMismatch = errors.New("dimensional mismatch")
+
+// SI base dimensions, in the order of a Dimension vector
+const (
+	Length = iota
+	Mass
+	Time
+	Current
+	Temperature
+	Amount
+	Luminosity
+	numBaseDimensions
+)
+
+var baseSymbols = [numBaseDimensions]string{"m", "kg", "s", "A", "K", "mol", "cd"}
+
+// Dimension holds the exponent of each SI base unit, e.g. m/s^2 is
+// {Length: 1, Time: -2}
+type Dimension [numBaseDimensions]int
+
+// String renders the dimension in SI base units, e.g. "kg*m*s^-2"
+func (d Dimension) String() string {
+	var parts []string
+	for i, exp := range d {
+		switch exp {
+		case 0:
+		case 1:
+			parts = append(parts, baseSymbols[i])
+		default:
+			parts = append(parts, baseSymbols[i]+"^"+strconv.Itoa(exp))
+		}
+	}
+	if len(parts) == 0 {
+		return "1"
+	}
+	return strings.Join(parts, "*")
+}
+
+// Unit is a named multiple of an SI dimension
+type Unit struct {
+	Symbol string
+	Scale  float64 // Size of one unit in SI base units
+	Dim    Dimension
+}
+
+// Dimensionless is the unit of pure numbers
+var Dimensionless = Unit{Symbol: "", Scale: 1}
+
+// Compatible reports whether u and v measure the same dimension
+func (u Unit) Compatible(v Unit) bool {
+	return u.Dim == v.Dim
+}
+
+// Mul returns the product unit u*v
+func (u Unit) Mul(v Unit) Unit {
+	return Unit{Symbol: joinSymbols(u.Symbol, "*", v.Symbol), Scale: u.Scale * v.Scale, Dim: u.Dim.add(v.Dim, 1)}
+}
+
+// Div returns the quotient unit u/v
+func (u Unit) Div(v Unit) Unit {
+	symbol := u.Symbol
+	if v.Symbol != "" {
+		if symbol == "" {
+			symbol = "1"
+		}
+		symbol += "/" + v.Symbol
+	}
+	return Unit{Symbol: symbol, Scale: u.Scale / v.Scale, Dim: u.Dim.add(v.Dim, -1)}
+}
+
+// pow raises u to an integer power
+func (u Unit) pow(n int) Unit {
+	result := Unit{Scale: 1}
+	for i := 0; i < abs(n); i++ {
+		result.Scale *= u.Scale
+		result.Dim = result.Dim.add(u.Dim, 1)
+	}
+	if n < 0 {
+		result.Scale = 1 / result.Scale
+		result.Dim = Dimension{}.add(result.Dim, -1)
+	}
+	result.Symbol = u.Symbol
+	if n != 1 {
+		result.Symbol += "^" + strconv.Itoa(n)
+	}
+	return result
+}
+
+func (d Dimension) add(o Dimension, sign int) Dimension {
+	for i := range d {
+		d[i] += sign * o[i]
+	}
+	return d
+}
+
+func joinSymbols(a, sep, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	default:
+		return a + sep + b
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Quantity is a value measured in a unit
+type Quantity struct {
+	Value float64
+	Unit  Unit
+}
+
+// String formats the quantity as "<value> <symbol>"
+func (q Quantity) String() string {
+	value := strconv.FormatFloat(q.Value, 'g', -1, 64)
+	if q.Unit.Symbol == "" {
+		return value
+	}
+	return value + " " + q.Unit.Symbol
+}
+
+// Add returns q+o expressed in q's unit
+func (q Quantity) Add(o Quantity) (Quantity, error) {
+	converted, err := o.ConvertTo(q.Unit)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return Quantity{Value: q.Value + converted.Value, Unit: q.Unit}, nil
+}
+
+// Mul returns q*o
+func (q Quantity) Mul(o Quantity) Quantity {
+	return Quantity{Value: q.Value * o.Value, Unit: q.Unit.Mul(o.Unit)}
+}
+
+// Div returns q/o
+func (q Quantity) Div(o Quantity) Quantity {
+	return Quantity{Value: q.Value / o.Value, Unit: q.Unit.Div(o.Unit)}
+}
+
+// ConvertTo expresses q in unit u
+func (q Quantity) ConvertTo(u Unit) (Quantity, error) {
+	if !q.Unit.Compatible(u) {
+		return Quantity{}, fmt.Errorf("%w: cannot convert %s [%s] to %s [%s]",
+			ErrDimensionMismatch, q.Unit.Symbol, q.Unit.Dim, u.Symbol, u.Dim)
+	}
+	return Quantity{Value: q.Value * q.Unit.Scale / u.Scale, Unit: u}, nil
+}
+
+// registry holds the named units Parse understands
+var registry = map[string]Unit{}
+
+func define(symbol string, scale float64, dim Dimension) {
+	registry[symbol] = Unit{Symbol: symbol, Scale: scale, Dim: dim}
+}
+
+func derive(symbol string, scale float64, expr string) {
+	u, err := Parse(expr)
+	if err != nil {
+		panic(fmt.Sprintf("units: bad definition of %s: %v", symbol, err))
+	}
+	registry[symbol] = Unit{Symbol: symbol, Scale: scale * u.Scale, Dim: u.Dim}
+}
+
+func init() {
+	define("m", 1, Dimension{Length: 1})
+	define("kg", 1, Dimension{Mass: 1})
+	define("s", 1, Dimension{Time: 1})
+	define("A", 1, Dimension{Current: 1})
+	define("K", 1, Dimension{Temperature: 1})
+	define("mol", 1, Dimension{Amount: 1})
+	define("cd", 1, Dimension{Luminosity: 1})
+
+	derive("km", 1e3, "m")
+	derive("cm", 1e-2, "m")
+	derive("mm", 1e-3, "m")
+	derive("g", 1e-3, "kg")
+	derive("ms", 1e-3, "s")
+	derive("min", 60, "s")
+	derive("h", 3600, "s")
+	derive("L", 1e-3, "m^3")
+	derive("Hz", 1, "s^-1")
+	derive("N", 1, "kg*m/s^2")
+	derive("J", 1, "N*m")
+	derive("eV", 1.602176634e-19, "J")
+	derive("W", 1, "J/s")
+	derive("Pa", 1, "N/m^2")
+	derive("C", 1, "A*s")
+	derive("V", 1, "W/A")
+	derive("ohm", 1, "V/A")
+	registry["Ω"] = registry["ohm"]
+}
+
+// exponentReplacer rewrites superscript exponents as ^n
+var exponentReplacer = strings.NewReplacer(
+	"⁻¹", "^-1", "⁻²", "^-2", "⁻³", "^-3",
+	"²", "^2", "³", "^3",
+	"·", "*", " ", "*",
+)
+
+// Parse reads a unit expression such as "m/s^2", "kg*m/s²" or "N m".
+// Everything after a "/" is in the denominator, so "J/mol/K" is J/(mol*K).
+func Parse(expr string) (Unit, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return Dimensionless, nil
+	}
+
+	parts := strings.Split(exponentReplacer.Replace(expr), "/")
+	result := Unit{Scale: 1}
+	for i, part := range parts {
+		for _, token := range strings.Split(part, "*") {
+			if token == "" || token == "1" {
+				continue
+			}
+			factor, err := parseFactor(token)
+			if err != nil {
+				return Unit{}, fmt.Errorf("invalid unit %q: %w", expr, err)
+			}
+			if i == 0 {
+				result = result.Mul(factor)
+			} else {
+				result = result.Div(factor)
+			}
+		}
+	}
+	result.Symbol = expr
+	return result, nil
+}
+
+// parseFactor reads a single symbol with an optional ^exponent
+func parseFactor(token string) (Unit, error) {
+	symbol, exponent := token, 1
+	if idx := strings.IndexByte(token, '^'); idx >= 0 {
+		n, err := strconv.Atoi(token[idx+1:])
+		if err != nil {
+			return Unit{}, fmt.Errorf("bad exponent in %q", token)
+		}
+		symbol, exponent = token[:idx], n
+	}
+
+	base, ok := registry[symbol]
+	if !ok {
+		return Unit{}, fmt.Errorf("unknown unit %q", symbol)
+	}
+	return base.pow(exponent), nil
+}
+
+// MustParse is like Parse but panics on error, for units known at compile time
+func MustParse(expr string) Unit {
+	u, err := Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
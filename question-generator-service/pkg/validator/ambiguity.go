@@ -2,42 +2,132 @@ package validator
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
 	"strings"
 )
 
 // AmbiguityResult holds ambiguity score and feedback
 type AmbiguityResult struct {
 	AmbiguityScore float64
+	MatchedTerms   []string
 	Feedback       string
 }
 
-// Service for ambiguity detection
-type Service struct {
-	ambiguousTerms []string
+// AmbiguityTerms maps ambiguous terms to their weight. Subject sets are
+// merged over the default set; a weight of zero or less removes a term.
+type AmbiguityTerms struct {
+	Default  map[string]float64            `json:"default"`
+	Subjects map[string]map[string]float64 `json:"subjects"`
 }
 
-// NewService returns a new ambiguity detection service
-func NewService() (*Service, error) {
-	// Example ambiguous terms, expand as needed
-	terms := []string{"some", "many", "few", "better", "worse", "often", "usually", "maybe", "several"}
-	return &Service{ambiguousTerms: terms}, nil
+// defaultAmbiguityTerms is used when no terms file is configured
+var defaultAmbiguityTerms = AmbiguityTerms{
+	Default: map[string]float64{
+		"some":    0.3,
+		"many":    0.2,
+		"few":     0.2,
+		"several": 0.2,
+		"better":  0.3,
+		"worse":   0.3,
+		"often":   0.3,
+		"usually": 0.3,
+		"maybe":   0.5,
+	},
 }
 
-// DetectAmbiguity checks string for ambiguous phrases and scores
-func (s *Service) DetectAmbiguity(ctx context.Context, text string) (*AmbiguityResult, error) {
-	lower := strings.ToLower(text)
-	count := 0
-	for _, term := range s.ambiguousTerms {
-		if strings.Contains(lower, term) {
-			count++
+// LoadAmbiguityTerms reads a weighted term list from a JSON file
+func LoadAmbiguityTerms(path string) (AmbiguityTerms, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return AmbiguityTerms{}, fmt.Errorf("failed to read ambiguity terms: %w", err)
+	}
+
+	var terms AmbiguityTerms
+	if err := json.Unmarshal(data, &terms); err != nil {
+		return AmbiguityTerms{}, fmt.Errorf("failed to parse ambiguity terms %s: %w", path, err)
+	}
+	return terms, nil
+}
+
+// ambiguousTerm is a weighted term with its word-boundary matcher
+type ambiguousTerm struct {
+	term    string
+	weight  float64
+	pattern *regexp.Regexp
+}
+
+// ambiguityDetector holds the compiled default and per-subject term sets
+type ambiguityDetector struct {
+	defaultTerms []ambiguousTerm
+	subjectTerms map[string][]ambiguousTerm
+}
+
+// newAmbiguityDetector compiles a word-boundary matcher for every term
+func newAmbiguityDetector(terms AmbiguityTerms) *ambiguityDetector {
+	d := &ambiguityDetector{
+		defaultTerms: compileTerms(terms.Default, nil),
+		subjectTerms: make(map[string][]ambiguousTerm, len(terms.Subjects)),
+	}
+	for subject, overrides := range terms.Subjects {
+		d.subjectTerms[strings.ToUpper(subject)] = compileTerms(terms.Default, overrides)
+	}
+	return d
+}
+
+// compileTerms merges overrides over base and compiles the result
+func compileTerms(base, overrides map[string]float64) []ambiguousTerm {
+	merged := make(map[string]float64, len(base)+len(overrides))
+	for term, weight := range base {
+		merged[strings.ToLower(term)] = weight
+	}
+	for term, weight := range overrides {
+		merged[strings.ToLower(term)] = weight
+	}
+
+	compiled := make([]ambiguousTerm, 0, len(merged))
+	for term, weight := range merged {
+		if weight <= 0 || strings.TrimSpace(term) == "" {
+			continue
+		}
+		compiled = append(compiled, ambiguousTerm{
+			term:    term,
+			weight:  weight,
+			pattern: regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(term) + `\b`),
+		})
+	}
+	sort.Slice(compiled, func(i, j int) bool { return compiled[i].term < compiled[j].term })
+	return compiled
+}
+
+// termsFor returns the term set for subject, falling back to the default set
+func (d *ambiguityDetector) termsFor(subject string) []ambiguousTerm {
+	if terms, ok := d.subjectTerms[strings.ToUpper(subject)]; ok {
+		return terms
+	}
+	return d.defaultTerms
+}
+
+// DetectAmbiguity scores text by the summed weight of the ambiguous terms it
+// contains as whole words, using the term set configured for subject
+func (s *Service) DetectAmbiguity(ctx context.Context, text, subject string) (*AmbiguityResult, error) {
+	result := &AmbiguityResult{}
+	for _, term := range s.ambiguity.termsFor(subject) {
+		if term.pattern.MatchString(text) {
+			result.AmbiguityScore += term.weight
+			result.MatchedTerms = append(result.MatchedTerms, term.term)
 		}
 	}
-	score := float64(count) / float64(len(s.ambiguousTerms))
-	feedback := ""
-	if count > 0 {
-		feedback = "Detected ambiguous terms in question: " + strings.Join(s.ambiguousTerms, ", ")
+	result.AmbiguityScore = math.Min(1, result.AmbiguityScore)
+
+	if len(result.MatchedTerms) > 0 {
+		result.Feedback = "Detected ambiguous terms in question: " + strings.Join(result.MatchedTerms, ", ") + "."
 	} else {
-		feedback = "No ambiguous terms detected."
+		result.Feedback = "No ambiguous terms detected."
 	}
-	return &AmbiguityResult{AmbiguityScore: score, Feedback: feedback}, nil
+	return result, nil
 }
@@ -2,9 +2,9 @@ package validator
 
 import (
 	"context"
-	"fmt"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // GrammarResult holds clarity and grammar scores plus feedback
@@ -15,33 +15,39 @@ type GrammarResult struct {
 	Passed       bool
 }
 
-// Service for grammar validation
-type Service struct {
-	// Could add API client here for third-party checkers
+// GrammarChecker scores the grammar and clarity of a question's text
+type GrammarChecker interface {
+	CheckGrammar(ctx context.Context, questionText string) (*GrammarResult, error)
 }
 
-// NewService returns new validator service
-func NewService() (*Service, error) {
-	return &Service{}, nil
+// CheckGrammar performs grammar and clarity checks with the configured
+// GrammarChecker
+func (s *Service) CheckGrammar(ctx context.Context, questionText string) (*GrammarResult, error) {
+	return s.grammar.CheckGrammar(ctx, questionText)
 }
 
-// ValidateQuestion performs grammar and clarity checks using heuristics or API
-func (s *Service) ValidateQuestion(ctx context.Context, questionText string) (*GrammarResult, error) {
+// HeuristicGrammarChecker checks length, terminal punctuation and
+// capitalization without calling out to any service
+type HeuristicGrammarChecker struct{}
+
+// CheckGrammar performs grammar and clarity checks using heuristics.
+// Inline LaTeX at the start of the question skips the capitalization check and
+// terminal punctuation may follow or close a trailing $...$ span.
+func (HeuristicGrammarChecker) CheckGrammar(ctx context.Context, questionText string) (*GrammarResult, error) {
 	// Simple heuristic checks for demo
-	length := len(questionText)
-	if length < 10 {
+	text := strings.TrimSpace(questionText)
+	if utf8.RuneCountInString(text) < 10 {
 		return &GrammarResult{GrammarScore: 0.2, ClarityScore: 0.3, Feedback: "Question too short", Passed: false}, nil
 	}
 
 	// Check for proper ending punctuation
-	lastChar := rune(questionText[length-1])
-	if lastChar != '.' && lastChar != '?' && lastChar != '!' {
+	if !endsWithTerminalPunctuation(text) {
 		return &GrammarResult{GrammarScore: 0.5, ClarityScore: 0.5, Feedback: "Question missing punctuation", Passed: false}, nil
 	}
 
-	// Check capital letter start
-	firstChar := rune(questionText[0])
-	if !unicode.IsUpper(firstChar) {
+	// Check capital letter start, unless the question opens with math or a
+	// symbol such as "$\alpha$ particles ..." or "λ is ..."
+	if firstChar, _ := utf8.DecodeRuneInString(text); unicode.In(firstChar, unicode.Latin) && !unicode.IsUpper(firstChar) {
 		return &GrammarResult{GrammarScore: 0.6, ClarityScore: 0.6, Feedback: "Question should start with capital letter", Passed: false}, nil
 	}
 
@@ -54,3 +60,24 @@ func (s *Service) ValidateQuestion(ctx context.Context, questionText string) (*G
 		Passed:       true,
 	}, nil
 }
+
+// isTerminalPunctuation reports whether r can end a question
+func isTerminalPunctuation(r rune) bool {
+	return r == '.' || r == '?' || r == '!'
+}
+
+// endsWithTerminalPunctuation accepts "... $v^2$?" as well as punctuation
+// placed inside a closing math span, e.g. "... $v^2?$"
+func endsWithTerminalPunctuation(text string) bool {
+	last, _ := utf8.DecodeLastRuneInString(text)
+	if isTerminalPunctuation(last) {
+		return true
+	}
+	if last != '$' {
+		return false
+	}
+
+	inner := strings.TrimRight(strings.TrimRight(text, "$"), " \t")
+	last, _ = utf8.DecodeLastRuneInString(inner)
+	return isTerminalPunctuation(last)
+}
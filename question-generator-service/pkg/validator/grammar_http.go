@@ -0,0 +1,125 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"question-generator-service/pkg/logging"
+)
+
+const (
+	// grammarFindingPenalty is subtracted from the grammar score for each
+	// finding of the external checker
+	grammarFindingPenalty = 0.1
+	// minGrammarScore is the grammar score below which external findings
+	// fail the question
+	minGrammarScore = 0.5
+	// maxGrammarFindings bounds the findings quoted in the feedback
+	maxGrammarFindings = 3
+)
+
+// HTTPGrammarChecker runs the heuristic checks and refines them with an
+// external checker speaking the LanguageTool /v2/check API: a form POST of
+// text and language answered with a list of matches. Each match lowers the
+// grammar score and is quoted in the feedback. When the service fails the
+// heuristic result is returned alone.
+type HTTPGrammarChecker struct {
+	url        string
+	language   string
+	httpClient *http.Client
+	heuristic  HeuristicGrammarChecker
+}
+
+// NewHTTPGrammarChecker returns a checker posting to checkURL, giving up on
+// the service after timeout
+func NewHTTPGrammarChecker(checkURL, language string, timeout time.Duration) *HTTPGrammarChecker {
+	return &HTTPGrammarChecker{
+		url:        checkURL,
+		language:   language,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// grammarMatch is one finding of the external checker
+type grammarMatch struct {
+	Message string `json:"message"`
+}
+
+// CheckGrammar merges the external checker's findings into the heuristic
+// result
+func (c *HTTPGrammarChecker) CheckGrammar(ctx context.Context, questionText string) (*GrammarResult, error) {
+	result, err := c.heuristic.CheckGrammar(ctx, questionText)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := c.check(ctx, questionText)
+	if err != nil {
+		logging.FromContext(ctx).Warnw("external grammar check failed, using heuristics", "error", err)
+		return result, nil
+	}
+	if len(matches) == 0 {
+		return result, nil
+	}
+
+	findings := make([]string, 0, maxGrammarFindings)
+	for _, match := range matches {
+		if len(findings) == maxGrammarFindings {
+			break
+		}
+		findings = append(findings, strings.TrimSpace(match.Message))
+	}
+	feedback := "Grammar: " + strings.Join(findings, "; ")
+	if extra := len(matches) - len(findings); extra > 0 {
+		feedback += fmt.Sprintf(" (and %d more)", extra)
+	}
+	feedback += "."
+
+	// The heuristic all-clear no longer applies
+	if result.Passed {
+		result.Feedback = feedback
+	} else {
+		result.Feedback += " " + feedback
+	}
+	result.GrammarScore = math.Max(0, result.GrammarScore-grammarFindingPenalty*float64(len(matches)))
+	result.Passed = result.Passed && result.GrammarScore >= minGrammarScore
+	return result, nil
+}
+
+// check asks the external service for the findings on text
+func (c *HTTPGrammarChecker) check(ctx context.Context, text string) ([]grammarMatch, error) {
+	form := url.Values{"text": {text}, "language": {c.language}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	logging.SetRequestIDHeader(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("grammar service request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("grammar service status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var decoded struct {
+		Matches []grammarMatch `json:"matches"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("decode grammar service response: %w", err)
+	}
+	return decoded.Matches, nil
+}
@@ -3,8 +3,18 @@ package validator
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"question-generator-service/internal/config"
+	"question-generator-service/pkg/apierror"
+	"question-generator-service/pkg/metrics"
 )
 
 // GenerateQuestionRequest represents the request structure for question generation
@@ -17,6 +27,47 @@ type GenerateQuestionRequest struct {
 	RequestedDifficulty float64 `json:"requested_difficulty" validate:"required,min=0.1,max=1.0"`
 	SessionID          string  `json:"session_id"`
 	RequestID          string  `json:"request_id"`
+	Seed               int64   `json:"seed,omitempty"` // Optional: replays a previous generation
+	Debug              bool    `json:"debug,omitempty"` // Optional: include the validation breakdown and RAG exemplars in metadata
+	Language           string  `json:"language,omitempty"` // Optional: en (default), hi or both
+	SkipRAG            bool    `json:"skip_rag,omitempty"`        // Optional: experiment scope only, serve without the RAG check
+	SkipValidation     bool    `json:"skip_validation,omitempty"` // Optional: experiment scope only, serve without validation
+}
+
+// MaxRequestIDLength bounds request IDs, which are stored with every
+// generation log
+const MaxRequestIDLength = 128
+
+// requestIDPattern is the charset request IDs are limited to, enough for
+// UUIDs and IDs like "req_student1_3_1700000000000"
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+// ValidRequestID reports whether id is a request ID ValidateRequest
+// accepts: non-empty, at most maxLength characters and within the charset
+func ValidRequestID(id string, maxLength int) bool {
+	return id != "" && len(id) <= maxLength && requestIDPattern.MatchString(id)
+}
+
+// examSubjects maps the exam types requests may name onto the subjects each
+// covers
+var (
+	examSubjectsMu sync.RWMutex
+	examSubjects   = config.DefaultExamSubjects
+)
+
+// SetExamSubjects replaces the exam types and subjects requests are checked
+// against, config.DefaultExamSubjects until set. It is called at startup
+// with the configured ExamSubjects.
+func SetExamSubjects(subjects map[string][]string) {
+	examSubjectsMu.Lock()
+	defer examSubjectsMu.Unlock()
+	examSubjects = subjects
+}
+
+func currentExamSubjects() map[string][]string {
+	examSubjectsMu.RLock()
+	defer examSubjectsMu.RUnlock()
+	return examSubjects
 }
 
 // ValidationError represents a validation error
@@ -26,13 +77,6 @@ type ValidationError struct {
 	Value   interface{} `json:"value,omitempty"`
 }
 
-// ValidationResponse represents validation error response
-type ValidationResponse struct {
-	Status string            `json:"status"`
-	Message string           `json:"message"`
-	Errors []ValidationError `json:"errors"`
-}
-
 // ValidateGenerateQuestionRequest validates the incoming question generation request
 func ValidateGenerateQuestionRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -45,16 +89,19 @@ func ValidateGenerateQuestionRequest(next http.Handler) http.Handler {
 		// Parse request body
 		var req GenerateQuestionRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeValidationError(w, "invalid_json", "Request body contains invalid JSON", []ValidationError{
+			writeValidationError(w, apierror.CodeInvalidJSON, "Request body contains invalid JSON", []ValidationError{
 				{Field: "body", Message: "Invalid JSON format", Value: err.Error()},
 			})
 			return
 		}
 
+		metrics.SetRequestLabels(r.Context(), req.ExamType, req.Subject)
+		AssignRequestID(&req)
+
 		// Validate required fields and business rules
 		errors := validateRequest(&req)
 		if len(errors) > 0 {
-			writeValidationError(w, "validation_failed", "Request validation failed", errors)
+			writeValidationError(w, apierror.CodeValidationFailed, "Request validation failed", errors)
 			return
 		}
 
@@ -64,6 +111,21 @@ func ValidateGenerateQuestionRequest(next http.Handler) http.Handler {
 	})
 }
 
+// ValidateRequest applies the generate endpoint's field and business rules to
+// a request decoded elsewhere, e.g. one item of a batch
+func ValidateRequest(req *GenerateQuestionRequest) []ValidationError {
+	return validateRequest(req)
+}
+
+// AssignRequestID gives a request without a request_id a server-generated
+// UUID, as the request logger does for a missing X-Request-ID header. The
+// ID is echoed back in the response.
+func AssignRequestID(req *GenerateQuestionRequest) {
+	if req.RequestID == "" {
+		req.RequestID = uuid.NewString()
+	}
+}
+
 // validateRequest performs business rule validation
 func validateRequest(req *GenerateQuestionRequest) []ValidationError {
 	var errors []ValidationError
@@ -85,24 +147,58 @@ func validateRequest(req *GenerateQuestionRequest) []ValidationError {
 		})
 	}
 
+	switch {
+	case req.RequestID == "":
+		errors = append(errors, ValidationError{
+			Field:   "request_id",
+			Message: "Request ID is required",
+			Value:   req.RequestID,
+		})
+	case len(req.RequestID) > MaxRequestIDLength:
+		errors = append(errors, ValidationError{
+			Field:   "request_id",
+			Message: fmt.Sprintf("Request ID must be at most %d characters", MaxRequestIDLength),
+			Value:   req.RequestID,
+		})
+	case !requestIDPattern.MatchString(req.RequestID):
+		errors = append(errors, ValidationError{
+			Field:   "request_id",
+			Message: "Request ID may only contain letters, digits, '.', '_', ':' and '-'",
+			Value:   req.RequestID,
+		})
+	}
+
 	// Exam type validation
-	validExamTypes := []string{"JEE_MAIN", "JEE_ADVANCED", "NEET", "FOUNDATION"}
-	if !contains(validExamTypes, req.ExamType) {
+	subjectsByExam := currentExamSubjects()
+	covered, knownExam := subjectsByExam[req.ExamType]
+	if !knownExam {
+		examTypes := make([]string, 0, len(subjectsByExam))
+		for examType := range subjectsByExam {
+			examTypes = append(examTypes, examType)
+		}
+		sort.Strings(examTypes)
 		errors = append(errors, ValidationError{
 			Field:   "exam_type",
-			Message: "Invalid exam type. Must be one of: JEE_MAIN, JEE_ADVANCED, NEET, FOUNDATION",
+			Message: "Invalid exam type. Must be one of: " + strings.Join(examTypes, ", "),
 			Value:   req.ExamType,
 		})
 	}
 
 	// Subject validation
 	validSubjects := []string{"PHYSICS", "CHEMISTRY", "MATHEMATICS", "BIOLOGY"}
-	if !contains(validSubjects, req.Subject) {
+	switch {
+	case !contains(validSubjects, req.Subject):
 		errors = append(errors, ValidationError{
 			Field:   "subject",
 			Message: "Invalid subject. Must be one of: PHYSICS, CHEMISTRY, MATHEMATICS, BIOLOGY",
 			Value:   req.Subject,
 		})
+	case knownExam && !contains(covered, req.Subject):
+		errors = append(errors, ValidationError{
+			Field:   "subject",
+			Message: fmt.Sprintf("%s exam does not include %s. Its subjects are: %s", req.ExamType, req.Subject, strings.Join(covered, ", ")),
+			Value:   req.Subject,
+		})
 	}
 
 	// Format validation
@@ -124,38 +220,24 @@ func validateRequest(req *GenerateQuestionRequest) []ValidationError {
 		})
 	}
 
-	// Business rule validation
-	if req.ExamType == "NEET" && req.Subject == "MATHEMATICS" {
-		errors = append(errors, ValidationError{
-			Field:   "subject",
-			Message: "NEET exam does not include MATHEMATICS subject",
-			Value:   req.Subject,
-		})
-	}
-
-	if req.ExamType == "JEE_MAIN" && req.Subject == "BIOLOGY" {
+	// Language validation
+	validLanguages := []string{"en", "hi", "both"}
+	if req.Language != "" && !contains(validLanguages, req.Language) {
 		errors = append(errors, ValidationError{
-			Field:   "subject",
-			Message: "JEE_MAIN exam does not typically include BIOLOGY subject",
-			Value:   req.Subject,
+			Field:   "language",
+			Message: "Invalid language. Must be one of: en, hi, both",
+			Value:   req.Language,
 		})
 	}
 
 	return errors
 }
 
-// writeValidationError writes validation error response
-func writeValidationError(w http.ResponseWriter, status, message string, errors []ValidationError) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusBadRequest)
-	
-	response := ValidationResponse{
-		Status:  status,
-		Message: message,
-		Errors:  errors,
-	}
-	
-	json.NewEncoder(w).Encode(response)
+// writeValidationError responds 400 with the shared error envelope, listing
+// the field errors as its details
+func writeValidationError(w http.ResponseWriter, code, message string, errors []ValidationError) {
+	metrics.IncrementValidationErrors()
+	apierror.Write(w, http.StatusBadRequest, code, message, errors)
 }
 
 // contains checks if slice contains item
@@ -0,0 +1,67 @@
+package validator
+
+import (
+	"regexp"
+	"strings"
+)
+
+// negationClarityPenalty is subtracted from the clarity score when a
+// negation keyword is not emphasized
+const negationClarityPenalty = 0.2
+
+// negationPattern matches the keywords of "which is NOT correct" style questions
+var negationPattern = regexp.MustCompile(`(?i)\b(not|except|incorrect|false)\b`)
+
+// emphasisMarkers are the opening and closing markup accepted as emphasis
+var emphasisMarkers = [][2]string{
+	{"**", "**"},
+	{"__", "__"},
+	{"<b>", "</b>"},
+	{"<strong>", "</strong>"},
+	{`\textbf{`, "}"},
+}
+
+// NegationResult reports negation keywords written without emphasis
+type NegationResult struct {
+	UnemphasizedTerms []string
+	Feedback          string
+}
+
+// DetectNegation finds negation keywords that are neither capitalized nor
+// wrapped in bold markup, e.g. "which of the following is not correct"
+func (s *Service) DetectNegation(text string) *NegationResult {
+	result := &NegationResult{}
+	seen := make(map[string]bool)
+	for _, loc := range negationPattern.FindAllStringIndex(text, -1) {
+		word := text[loc[0]:loc[1]]
+		if word == strings.ToUpper(word) || isWrappedInEmphasis(text, loc[0], loc[1]) {
+			continue
+		}
+		if lower := strings.ToLower(word); !seen[lower] {
+			seen[lower] = true
+			result.UnemphasizedTerms = append(result.UnemphasizedTerms, lower)
+		}
+	}
+
+	if len(result.UnemphasizedTerms) > 0 {
+		emphasized := make([]string, len(result.UnemphasizedTerms))
+		for i, term := range result.UnemphasizedTerms {
+			emphasized[i] = strings.ToUpper(term)
+		}
+		result.Feedback = "Negation (" + strings.Join(result.UnemphasizedTerms, ", ") +
+			") should be emphasized, e.g. written as " + strings.Join(emphasized, ", ") + " or in bold."
+	}
+	return result
+}
+
+// isWrappedInEmphasis reports whether text[start:end] is enclosed in one of
+// the emphasisMarkers
+func isWrappedInEmphasis(text string, start, end int) bool {
+	before, after := text[:start], text[end:]
+	for _, marker := range emphasisMarkers {
+		if strings.HasSuffix(before, marker[0]) && strings.HasPrefix(after, marker[1]) {
+			return true
+		}
+	}
+	return false
+}
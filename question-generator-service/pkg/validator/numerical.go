@@ -0,0 +1,92 @@
+package validator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"question-generator-service/pkg/templates"
+)
+
+const (
+	// maxNumericalMagnitude bounds answers a student could reasonably enter
+	maxNumericalMagnitude = 1e9
+	// maxNumericalDecimals matches the JEE convention of answers correct to
+	// two decimal places, for templates without an answer_precision
+	maxNumericalDecimals = 2
+)
+
+// NumericalResult holds the outcome of checking a NUMERICAL answer
+type NumericalResult struct {
+	Value    float64
+	Unit     string
+	Feedback string
+	Passed   bool
+}
+
+// CheckNumericalAnswer verifies that answer is a finite number of sane
+// magnitude with at most maxDecimals decimal places, carrying expectedUnit
+// when one is declared
+func (s *Service) CheckNumericalAnswer(answer, expectedUnit string, maxDecimals int) *NumericalResult {
+	answer = strings.TrimSpace(answer)
+	fail := func(format string, args ...interface{}) *NumericalResult {
+		return &NumericalResult{Feedback: fmt.Sprintf(format, args...), Passed: false}
+	}
+
+	match := templates.QuantityPattern.FindStringSubmatch(answer)
+	if match == nil {
+		return fail("numerical answer '%s' is not a valid number.", answer)
+	}
+	number, unit := match[1], compactUnit(match[2])
+	expectedUnit = compactUnit(expectedUnit)
+
+	// Without a declared unit anything after the number is garbage, e.g. "9.8x"
+	if expectedUnit == "" && unit != "" {
+		return fail("numerical answer '%s' is not a valid number.", answer)
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || math.IsInf(value, 0) || math.IsNaN(value) {
+		return fail("numerical answer '%s' is not a finite number.", answer)
+	}
+	if math.Abs(value) > maxNumericalMagnitude {
+		return fail("numerical answer '%s' exceeds the maximum magnitude of %g.", answer, maxNumericalMagnitude)
+	}
+	if decimals := decimalPlaces(number); decimals > maxDecimals {
+		return fail("numerical answer '%s' has %d decimal places, expected at most %d.", answer, decimals, maxDecimals)
+	}
+
+	if expectedUnit != "" {
+		if unit == "" {
+			return fail("numerical answer '%s' is missing unit '%s'.", answer, expectedUnit)
+		}
+		if unit != expectedUnit {
+			return fail("numerical answer '%s' has unit '%s', expected '%s'.", answer, unit, expectedUnit)
+		}
+	}
+
+	return &NumericalResult{
+		Value:    value,
+		Unit:     unit,
+		Feedback: "Numerical answer is well formed.",
+		Passed:   true,
+	}
+}
+
+// compactUnit removes whitespace so "m / s" and "m/s" compare equal
+func compactUnit(unit string) string {
+	return strings.Join(strings.Fields(unit), "")
+}
+
+// decimalPlaces counts the digits after the decimal point of a plain number
+func decimalPlaces(number string) int {
+	if idx := strings.IndexAny(number, "eE"); idx >= 0 {
+		number = number[:idx]
+	}
+	idx := strings.IndexByte(number, '.')
+	if idx < 0 {
+		return 0
+	}
+	return len(number) - idx - 1
+}
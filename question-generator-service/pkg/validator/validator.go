@@ -0,0 +1,152 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"question-generator-service/internal/config"
+	"question-generator-service/pkg/templates"
+)
+
+// checkFailurePenalty is subtracted from the overall score for each failed
+// structural check (a group of identical options, a malformed answer)
+const checkFailurePenalty = 0.3
+
+// Service runs the question quality checks
+type Service struct {
+	ambiguity *ambiguityDetector
+	grammar   GrammarChecker
+}
+
+// NewService returns a new validator service, loading the ambiguous term
+// list from cfg.AmbiguityTermsFile when set. Grammar is checked by
+// heuristics unless cfg.GrammarChecker selects the external HTTP checker.
+func NewService(cfg config.ValidatorConfig) (*Service, error) {
+	terms := defaultAmbiguityTerms
+	if cfg.AmbiguityTermsFile != "" {
+		var err error
+		if terms, err = LoadAmbiguityTerms(cfg.AmbiguityTermsFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var grammar GrammarChecker = HeuristicGrammarChecker{}
+	if cfg.GrammarChecker == "HTTP" {
+		grammar = NewHTTPGrammarChecker(cfg.GrammarCheckerURL, cfg.GrammarLanguage, cfg.GrammarCheckerTimeout)
+	}
+	return &Service{ambiguity: newAmbiguityDetector(terms), grammar: grammar}, nil
+}
+
+// ValidationRequest is a generated question to validate
+type ValidationRequest struct {
+	QuestionText  string
+	Options       map[string]string
+	CorrectAnswer string
+	ExpectedUnit  string // Unit declared by the template, NUMERICAL only
+	// AnswerPrecision is the template's answer_precision, the decimal places
+	// a NUMERICAL answer may carry; nil allows the JEE convention of two
+	AnswerPrecision *int
+	Format          string
+	Subject         string
+	ExamType        string
+}
+
+// ValidationResult combines the individual check results
+type ValidationResult struct {
+	GrammarScore     float64
+	ClarityScore     float64
+	AmbiguityScore   float64
+	OverallScore     float64
+	DuplicateOptions [][]string // Groups of option letters with identical values
+	NegationFlag     bool       // A negation keyword is not emphasized
+	Feedback         string
+	FeedbackItems    []string // The feedback of each check that reported any, in check order
+	Passed           bool
+}
+
+// ValidateQuestion runs grammar, ambiguity, negation and option checks on a generated question
+func (s *Service) ValidateQuestion(ctx context.Context, req ValidationRequest) (*ValidationResult, error) {
+	grammar, err := s.CheckGrammar(ctx, req.QuestionText)
+	if err != nil {
+		return nil, fmt.Errorf("grammar check failed: %w", err)
+	}
+
+	ambiguity, err := s.DetectAmbiguity(ctx, req.QuestionText, req.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("ambiguity check failed: %w", err)
+	}
+
+	result := &ValidationResult{
+		GrammarScore:   grammar.GrammarScore,
+		ClarityScore:   grammar.ClarityScore,
+		AmbiguityScore: ambiguity.AmbiguityScore,
+		Passed:         grammar.Passed,
+	}
+	feedback := []string{grammar.Feedback, ambiguity.Feedback}
+
+	// Unemphasized negation hurts clarity but does not fail the question
+	if negation := s.DetectNegation(req.QuestionText); len(negation.UnemphasizedTerms) > 0 {
+		result.NegationFlag = true
+		result.ClarityScore = math.Max(0, result.ClarityScore-negationClarityPenalty)
+		feedback = append(feedback, negation.Feedback)
+	}
+	result.OverallScore = (result.GrammarScore + result.ClarityScore + (1 - result.AmbiguityScore)) / 3
+
+	if len(req.Options) > 0 {
+		result.DuplicateOptions = findDuplicateOptions(req.Options)
+		if len(result.DuplicateOptions) > 0 {
+			groups := make([]string, 0, len(result.DuplicateOptions))
+			for _, group := range result.DuplicateOptions {
+				groups = append(groups, strings.Join(group, "="))
+			}
+			feedback = append(feedback, "Duplicate options: "+strings.Join(groups, ", ")+".")
+			result.OverallScore -= checkFailurePenalty * float64(len(result.DuplicateOptions))
+			result.Passed = false
+		}
+	}
+
+	if req.Format == "NUMERICAL" {
+		decimals := maxNumericalDecimals
+		if req.AnswerPrecision != nil {
+			decimals = *req.AnswerPrecision
+		}
+		numerical := s.CheckNumericalAnswer(req.CorrectAnswer, req.ExpectedUnit, decimals)
+		feedback = append(feedback, numerical.Feedback)
+		if !numerical.Passed {
+			result.OverallScore -= checkFailurePenalty
+			result.Passed = false
+		}
+	}
+
+	result.OverallScore = math.Max(0, result.OverallScore)
+	result.Feedback = strings.Join(feedback, " ")
+	for _, item := range feedback {
+		if item != "" {
+			result.FeedbackItems = append(result.FeedbackItems, item)
+		}
+	}
+	return result, nil
+}
+
+// findDuplicateOptions groups option letters whose values are equal after
+// normalization, returning only groups with more than one letter
+func findDuplicateOptions(options map[string]string) [][]string {
+	byValue := make(map[string][]string)
+	for letter, value := range options {
+		key := templates.NormalizeAnswer(value)
+		byValue[key] = append(byValue[key], letter)
+	}
+
+	var duplicates [][]string
+	for _, letters := range byValue {
+		if len(letters) > 1 {
+			sort.Strings(letters)
+			duplicates = append(duplicates, letters)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i][0] < duplicates[j][0] })
+	return duplicates
+}
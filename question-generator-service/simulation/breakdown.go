@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// SegmentMetrics aggregates the requests of the students sharing a subject
+// and question format, to show where template coverage is slow or failing
+type SegmentMetrics struct {
+	Subject           string
+	Format            string
+	TotalRequests     int64
+	SuccessRequests   int64
+	TotalResponseTime time.Duration
+	ResponseTimes     *ResponseTimeHistogram
+}
+
+type segmentKey struct{ subject, format string }
+
+func (s *SegmentMetrics) record(responseTime time.Duration, success bool) {
+	s.TotalRequests++
+	if success {
+		s.SuccessRequests++
+	}
+	s.TotalResponseTime += responseTime
+	s.ResponseTimes.Record(responseTime)
+}
+
+// summary renders the segment with the fields of GetSummary
+func (s *SegmentMetrics) summary() map[string]interface{} {
+	var avgResponseTimeMs, successRate float64
+	if s.TotalRequests > 0 {
+		avgResponseTimeMs = durationMs(s.TotalResponseTime) / float64(s.TotalRequests)
+		successRate = float64(s.SuccessRequests) / float64(s.TotalRequests) * 100
+	}
+	return map[string]interface{}{
+		"subject":              s.Subject,
+		"format":               s.Format,
+		"total_requests":       s.TotalRequests,
+		"successful_requests":  s.SuccessRequests,
+		"failed_requests":      s.TotalRequests - s.SuccessRequests,
+		"success_rate":         successRate,
+		"avg_response_time_ms": avgResponseTimeMs,
+		"p50_response_time_ms": s.ResponseTimes.Quantile(0.50).Milliseconds(),
+		"p95_response_time_ms": s.ResponseTimes.Quantile(0.95).Milliseconds(),
+		"p99_response_time_ms": s.ResponseTimes.Quantile(0.99).Milliseconds(),
+	}
+}
+
+// sortedSegments returns the segments ordered by subject and format. The
+// caller holds the collector's lock.
+func (mc *MetricsCollector) sortedSegments() []*SegmentMetrics {
+	segments := make([]*SegmentMetrics, 0, len(mc.Segments))
+	for _, segment := range mc.Segments {
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].Subject != segments[j].Subject {
+			return segments[i].Subject < segments[j].Subject
+		}
+		return segments[i].Format < segments[j].Format
+	})
+	return segments
+}
+
+// ExportBreakdownToCSV writes one row per (subject, format) segment
+func ExportBreakdownToCSV(metrics *MetricsCollector, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("create file error: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{
+		"subject", "format", "total_requests", "successful_requests", "failed_requests",
+		"success_rate", "avg_response_time_ms", "p50_response_time_ms", "p95_response_time_ms", "p99_response_time_ms",
+	})
+
+	metrics.mutex.RLock()
+	segments := metrics.sortedSegments()
+	for _, segment := range segments {
+		s := segment.summary()
+		writer.Write([]string{
+			segment.Subject,
+			segment.Format,
+			fmt.Sprintf("%d", s["total_requests"]),
+			fmt.Sprintf("%d", s["successful_requests"]),
+			fmt.Sprintf("%d", s["failed_requests"]),
+			fmt.Sprintf("%.2f", s["success_rate"]),
+			fmt.Sprintf("%.2f", s["avg_response_time_ms"]),
+			fmt.Sprintf("%d", s["p50_response_time_ms"]),
+			fmt.Sprintf("%d", s["p95_response_time_ms"]),
+			fmt.Sprintf("%d", s["p99_response_time_ms"]),
+		})
+	}
+	metrics.mutex.RUnlock()
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// ExportSummaryToJSON writes GetSummary, breakdown included, as JSON
+func ExportSummaryToJSON(metrics *MetricsCollector, filename string) error {
+	data, err := json.MarshalIndent(metrics.GetSummary(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode summary error: %w", err)
+	}
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		return fmt.Errorf("write file error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// histogramAccuracy is the relative error of ResponseTimeHistogram
+// quantiles
+const histogramAccuracy = 0.01
+
+// ResponseTimeHistogram is a streaming quantile sketch of response times.
+// Durations fall into exponentially growing buckets, bucket i holding
+// (gamma^(i-1), gamma^i] nanoseconds, so a quantile is reported within
+// histogramAccuracy of the true value while memory grows with the log of
+// the range of durations rather than with the number of samples: about
+// 1500 buckets cover 1ns to an hour.
+type ResponseTimeHistogram struct {
+	gamma    float64
+	logGamma float64
+	counts   map[int]int64
+	zeros    int64 // Non-positive durations
+	count    int64
+	min, max time.Duration
+}
+
+// NewResponseTimeHistogram returns an empty histogram
+func NewResponseTimeHistogram() *ResponseTimeHistogram {
+	gamma := (1 + histogramAccuracy) / (1 - histogramAccuracy)
+	return &ResponseTimeHistogram{
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		counts:   make(map[int]int64),
+	}
+}
+
+// Record adds one response time
+func (h *ResponseTimeHistogram) Record(d time.Duration) {
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if h.count == 0 || d > h.max {
+		h.max = d
+	}
+	h.count++
+	if d <= 0 {
+		h.zeros++
+		return
+	}
+	h.counts[int(math.Ceil(math.Log(float64(d))/h.logGamma))]++
+}
+
+// Count returns the number of recorded response times
+func (h *ResponseTimeHistogram) Count() int64 {
+	return h.count
+}
+
+// Buckets returns the number of buckets in use, which bounds its memory
+func (h *ResponseTimeHistogram) Buckets() int {
+	return len(h.counts)
+}
+
+// Quantile returns the response time at quantile q in [0, 1], the
+// nearest-rank sample of a sorted slice, or 0 when nothing was recorded.
+// The minimum and maximum are exact.
+func (h *ResponseTimeHistogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(q * float64(h.count-1))
+	switch {
+	case rank == 0 || rank < h.zeros:
+		return h.min
+	case rank >= h.count-1:
+		return h.max
+	}
+	seen := h.zeros
+
+	indexes := make([]int, 0, len(h.counts))
+	for i := range h.counts {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		seen += h.counts[i]
+		if rank < seen {
+			// The middle of the bucket in relative terms
+			d := time.Duration(2 * math.Pow(h.gamma, float64(i)) / (h.gamma + 1))
+			if d < h.min {
+				return h.min
+			}
+			if d > h.max {
+				return h.max
+			}
+			return d
+		}
+	}
+	return h.max
+}
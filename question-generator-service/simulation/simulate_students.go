@@ -15,6 +15,7 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -27,9 +28,20 @@ type SimulationConfig struct {
 	TestDuration    time.Duration
 	RequestsPerUser int
 	OutputFile      string
+	BreakdownFile   string
+	SummaryFile     string
+	Retry           RetryPolicy
 	Verbose         bool
 }
 
+// RetryPolicy retries requests the server turned away with 429 or 503, as
+// a real client would, waiting Backoff before the first retry and doubling
+// it after each unless the response carries a Retry-After
+type RetryPolicy struct {
+	MaxRetries int
+	Backoff    time.Duration
+}
+
 // Student simulation profile
 type VirtualStudent struct {
 	ID          string
@@ -71,6 +83,8 @@ type StudentMetrics struct {
 	SuccessfulRequests int
 	FailedRequests     int
 	AvgResponseTime    time.Duration
+	AvgResponseTimeMs  float64 // AvgResponseTime without rounding to whole milliseconds
+	Retries            int     // Retries after 429 and 503 responses, successful or not
 	MinResponseTime    time.Duration
 	MaxResponseTime    time.Duration
 	TotalResponseTime  time.Duration
@@ -89,23 +103,32 @@ type MetricsCollector struct {
 	TotalRequests   int64
 	SuccessRequests int64
 	ErrorRequests   int64
-	ResponseTimes   []time.Duration
+	TotalRetries    int64 // Retries after 429 and 503 responses; not failures in themselves
+	ResponseTimes   *ResponseTimeHistogram
+	TotalResponseTime time.Duration // Running sum of ResponseTimes
+	Segments        map[segmentKey]*SegmentMetrics
 }
 
 func NewMetricsCollector() *MetricsCollector {
 	return &MetricsCollector{
 		StudentMetrics: make(map[string]*StudentMetrics),
 		StartTime:      time.Now(),
-		ResponseTimes:  make([]time.Duration, 0),
+		ResponseTimes:  NewResponseTimeHistogram(),
+		Segments:       make(map[segmentKey]*SegmentMetrics),
 	}
 }
 
-func (mc *MetricsCollector) RecordRequest(studentID string, responseTime time.Duration, success bool, errorMsg string) {
+// RecordRequest records one question request of student, overall, for the
+// student and for the student's (subject, format) segment
+func (mc *MetricsCollector) RecordRequest(virtualStudent VirtualStudent, responseTime time.Duration, success bool, errorMsg string) {
 	mc.mutex.Lock()
 	defer mc.mutex.Unlock()
 
+	studentID := virtualStudent.ID
+
 	mc.TotalRequests++
-	mc.ResponseTimes = append(mc.ResponseTimes, responseTime)
+	mc.ResponseTimes.Record(responseTime)
+	mc.TotalResponseTime += responseTime
 
 	if success {
 		mc.SuccessRequests++
@@ -144,6 +167,15 @@ func (mc *MetricsCollector) RecordRequest(studentID string, responseTime time.Du
 	}
 
 	student.AvgResponseTime = student.TotalResponseTime / time.Duration(student.TotalRequests)
+	student.AvgResponseTimeMs = durationMs(student.TotalResponseTime) / float64(student.TotalRequests)
+
+	key := segmentKey{virtualStudent.Subject, virtualStudent.Format}
+	segment, exists := mc.Segments[key]
+	if !exists {
+		segment = &SegmentMetrics{Subject: key.subject, Format: key.format, ResponseTimes: NewResponseTimeHistogram()}
+		mc.Segments[key] = segment
+	}
+	segment.record(responseTime, success)
 }
 
 func (mc *MetricsCollector) RecordAnswer(studentID string, correct bool) {
@@ -159,49 +191,70 @@ func (mc *MetricsCollector) RecordAnswer(studentID string, correct bool) {
 	}
 }
 
-func (mc *MetricsCollector) GetSummary() map[string]interface{} {
-	mc.mutex.RLock()
-	defer mc.mutex.RUnlock()
+// RecordRetries counts the retries a request of studentID needed
+func (mc *MetricsCollector) RecordRetries(studentID string, retries int) {
+	if retries == 0 {
+		return
+	}
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.TotalRetries += int64(retries)
+	if student, exists := mc.StudentMetrics[studentID]; exists {
+		student.Retries += retries
+	}
+}
 
+// GetSummary reports the totals and response time percentiles so far. It is
+// safe to call while requests are still being recorded; the percentiles
+// come from the histogram, so the lock is held only briefly.
+func (mc *MetricsCollector) GetSummary() map[string]interface{} {
+	mc.mutex.Lock()
 	mc.EndTime = time.Now()
-	duration := mc.EndTime.Sub(mc.StartTime)
-
-	// Calculate percentiles
-	var p50, p95, p99 time.Duration
-	if len(mc.ResponseTimes) > 0 {
-		// Simple percentile calculation (for production use proper sorting)
-		total := len(mc.ResponseTimes)
-		p50 = mc.ResponseTimes[total*50/100]
-		p95 = mc.ResponseTimes[total*95/100]
-		p99 = mc.ResponseTimes[total*99/100]
-	}
-
-	var avgResponseTime time.Duration
-	if len(mc.ResponseTimes) > 0 {
-		var total time.Duration
-		for _, rt := range mc.ResponseTimes {
-			total += rt
-		}
-		avgResponseTime = total / time.Duration(len(mc.ResponseTimes))
+	startTime, endTime := mc.StartTime, mc.EndTime
+	totalRequests, successRequests, errorRequests := mc.TotalRequests, mc.SuccessRequests, mc.ErrorRequests
+	totalRetries := mc.TotalRetries
+	totalResponseTime := mc.TotalResponseTime
+	students := len(mc.StudentMetrics)
+	p50, p95, p99 := mc.ResponseTimes.Quantile(0.50), mc.ResponseTimes.Quantile(0.95), mc.ResponseTimes.Quantile(0.99)
+	breakdown := make([]map[string]interface{}, 0, len(mc.Segments))
+	for _, segment := range mc.sortedSegments() {
+		breakdown = append(breakdown, segment.summary())
+	}
+	mc.mutex.Unlock()
+
+	duration := endTime.Sub(startTime)
+
+	var avgResponseTimeMs, successRate float64
+	if totalRequests > 0 {
+		avgResponseTimeMs = durationMs(totalResponseTime) / float64(totalRequests)
+		successRate = float64(successRequests) / float64(totalRequests) * 100
 	}
 
 	return map[string]interface{}{
 		"simulation_duration":    duration.Seconds(),
-		"total_requests":        mc.TotalRequests,
-		"successful_requests":   mc.SuccessRequests,
-		"failed_requests":       mc.ErrorRequests,
-		"success_rate":          float64(mc.SuccessRequests) / float64(mc.TotalRequests) * 100,
-		"requests_per_second":   float64(mc.TotalRequests) / duration.Seconds(),
-		"avg_response_time_ms":  avgResponseTime.Milliseconds(),
+		"total_requests":        totalRequests,
+		"successful_requests":   successRequests,
+		"failed_requests":       errorRequests,
+		"total_retries":         totalRetries,
+		"success_rate":          successRate,
+		"requests_per_second":   float64(totalRequests) / duration.Seconds(),
+		"avg_response_time_ms":  avgResponseTimeMs,
 		"p50_response_time_ms":  p50.Milliseconds(),
 		"p95_response_time_ms":  p95.Milliseconds(),
 		"p99_response_time_ms":  p99.Milliseconds(),
-		"concurrent_users":      len(mc.StudentMetrics),
-		"start_time":           mc.StartTime.Format(time.RFC3339),
-		"end_time":             mc.EndTime.Format(time.RFC3339),
+		"concurrent_users":      students,
+		"start_time":           startTime.Format(time.RFC3339),
+		"end_time":             endTime.Format(time.RFC3339),
+		"breakdown":            breakdown, // Per (subject, format), ordered by both
 	}
 }
 
+// durationMs converts d to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
 // Generate realistic virtual student profiles
 func GenerateVirtualStudents(count int) []VirtualStudent {
 	rand.Seed(time.Now().UnixNano())
@@ -271,13 +324,13 @@ func SimulateStudent(ctx context.Context, config SimulationConfig, student Virtu
 				RequestID:          fmt.Sprintf("req_%s_%d_%d", student.ID, i, time.Now().UnixNano()),
 			}
 
-			// Measure response time
-			startTime := time.Now()
-			success, errorMsg := makeQuestionRequest(client, config.APIBaseURL, request)
-			responseTime := time.Since(startTime)
+			// Measure response time of the final attempt; backoff between
+			// retries is client-side waiting, not server latency
+			success, errorMsg, retries, responseTime := makeQuestionRequest(ctx, client, config.APIBaseURL, config.Retry, request)
 
 			// Record metrics
-			metrics.RecordRequest(student.ID, responseTime, success, errorMsg)
+			metrics.RecordRequest(student, responseTime, success, errorMsg)
+			metrics.RecordRetries(student.ID, retries)
 
 			if config.Verbose {
 				status := "SUCCESS"
@@ -300,30 +353,59 @@ func SimulateStudent(ctx context.Context, config SimulationConfig, student Virtu
 	}
 }
 
-// Make HTTP request to question generation API
-func makeQuestionRequest(client *http.Client, baseURL string, request QuestionRequest) (bool, string) {
+// Make HTTP request to question generation API, retrying 429 and 503
+// responses under retry. It returns whether the request finally succeeded,
+// the number of retries it took and the response time of the final attempt.
+func makeQuestionRequest(ctx context.Context, client *http.Client, baseURL string, retry RetryPolicy, request QuestionRequest) (bool, string, int, time.Duration) {
 	requestBody, err := json.Marshal(request)
 	if err != nil {
-		return false, fmt.Sprintf("JSON marshal error: %v", err)
+		return false, fmt.Sprintf("JSON marshal error: %v", err), 0, 0
 	}
 
 	url := fmt.Sprintf("%s/v1/questions/generate", baseURL)
-	
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return false, fmt.Sprintf("Request creation error: %v", err)
-	}
+	backoff := retry.Backoff
+	for attempt := 0; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(requestBody))
+		if err != nil {
+			return false, fmt.Sprintf("Request creation error: %v", err), attempt, 0
+		}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Accept", "application/json")
-	httpReq.Header.Set("X-Request-ID", request.RequestID)
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Accept", "application/json")
+		httpReq.Header.Set("X-Request-ID", request.RequestID)
 
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		return false, fmt.Sprintf("HTTP request error: %v", err)
+		startTime := time.Now()
+		resp, err := client.Do(httpReq)
+		if err != nil {
+			return false, fmt.Sprintf("HTTP request error: %v", err), attempt, time.Since(startTime)
+		}
+
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+		if retryable && attempt < retry.MaxRetries {
+			wait := backoff
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+			}
+			resp.Body.Close()
+			responseTime := time.Since(startTime)
+			backoff *= 2
+
+			select {
+			case <-time.After(wait):
+				continue
+			case <-ctx.Done():
+				return false, fmt.Sprintf("HTTP %d: %s, gave up retrying: %v", resp.StatusCode, resp.Status, ctx.Err()), attempt, responseTime
+			}
+		}
+
+		success, errorMsg := readQuestionResponse(resp)
+		resp.Body.Close()
+		return success, errorMsg, attempt, time.Since(startTime)
 	}
-	defer resp.Body.Close()
+}
 
+// readQuestionResponse checks the status and body of a generation response
+func readQuestionResponse(resp *http.Response) (bool, string) {
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return false, fmt.Sprintf("HTTP %d: %s", resp.StatusCode, resp.Status)
 	}
@@ -337,6 +419,24 @@ func makeQuestionRequest(client *http.Client, baseURL string, request QuestionRe
 	return true, ""
 }
 
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
 // Generate realistic topic IDs based on subject
 func generateTopicID(subject string) string {
 	topics := map[string][]string{
@@ -377,7 +477,7 @@ func ExportMetricsToCSV(metrics *MetricsCollector, filename string) error {
 	header := []string{
 		"student_id", "total_requests", "successful_requests", "failed_requests",
 		"success_rate", "avg_response_time_ms", "min_response_time_ms", "max_response_time_ms",
-		"questions_answered", "correct_answers", "accuracy", "error_count",
+		"questions_answered", "correct_answers", "accuracy", "error_count", "retries",
 	}
 	writer.Write(header)
 
@@ -394,13 +494,14 @@ func ExportMetricsToCSV(metrics *MetricsCollector, filename string) error {
 			fmt.Sprintf("%d", student.SuccessfulRequests),
 			fmt.Sprintf("%d", student.FailedRequests),
 			fmt.Sprintf("%.2f", successRate),
-			fmt.Sprintf("%d", student.AvgResponseTime.Milliseconds()),
+			fmt.Sprintf("%.2f", student.AvgResponseTimeMs),
 			fmt.Sprintf("%d", student.MinResponseTime.Milliseconds()),
 			fmt.Sprintf("%d", student.MaxResponseTime.Milliseconds()),
 			fmt.Sprintf("%d", student.QuestionsAnswered),
 			fmt.Sprintf("%d", student.CorrectAnswers),
 			fmt.Sprintf("%.2f", student.Accuracy*100),
 			fmt.Sprintf("%d", len(student.ErrorMessages)),
+			fmt.Sprintf("%d", student.Retries),
 		}
 		writer.Write(record)
 	}
@@ -417,7 +518,11 @@ func main() {
 	flag.DurationVar(&config.TestDuration, "duration", 5*time.Minute, "Test duration")
 	flag.IntVar(&config.RequestsPerUser, "requests", 10, "Requests per user")
 	flag.StringVar(&config.OutputFile, "output", "simulation_results.csv", "Output CSV file")
+	flag.StringVar(&config.BreakdownFile, "breakdown", "simulation_breakdown.csv", "Per subject and format CSV file")
+	flag.StringVar(&config.SummaryFile, "summary-json", "", "Optional JSON file for the summary with its breakdown")
 	flag.BoolVar(&config.Verbose, "verbose", false, "Verbose logging")
+	flag.IntVar(&config.Retry.MaxRetries, "max-retries", 3, "Retries of a request answered with 429 or 503")
+	flag.DurationVar(&config.Retry.Backoff, "retry-backoff", 500*time.Millisecond, "Wait before the first retry without Retry-After, doubling after each")
 	flag.Parse()
 
 	log.Printf("Starting Student Simulation with %d students, %d concurrent users", 
@@ -454,8 +559,16 @@ func main() {
 	summary := metrics.GetSummary()
 	log.Println("\n=== SIMULATION SUMMARY ===")
 	for key, value := range summary {
+		if key == "breakdown" {
+			continue
+		}
 		log.Printf("%s: %v", key, value)
 	}
+	log.Println("=== BY SUBJECT AND FORMAT ===")
+	for _, segment := range summary["breakdown"].([]map[string]interface{}) {
+		log.Printf("%s/%s: %d requests, %.2f%% success, p95 %dms", segment["subject"], segment["format"],
+			segment["total_requests"], segment["success_rate"], segment["p95_response_time_ms"])
+	}
 	
 	// Export detailed metrics
 	if err := ExportMetricsToCSV(metrics, config.OutputFile); err != nil {
@@ -463,6 +576,18 @@ func main() {
 	} else {
 		log.Printf("Detailed metrics exported to: %s", config.OutputFile)
 	}
+	if err := ExportBreakdownToCSV(metrics, config.BreakdownFile); err != nil {
+		log.Printf("Error exporting breakdown: %v", err)
+	} else {
+		log.Printf("Subject and format breakdown exported to: %s", config.BreakdownFile)
+	}
+	if config.SummaryFile != "" {
+		if err := ExportSummaryToJSON(metrics, config.SummaryFile); err != nil {
+			log.Printf("Error exporting summary: %v", err)
+		} else {
+			log.Printf("Summary exported to: %s", config.SummaryFile)
+		}
+	}
 	
 	log.Println("Simulation completed successfully!")
 }
\ No newline at end of file
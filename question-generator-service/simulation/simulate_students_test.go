@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetSummaryWhileRecording(t *testing.T) {
+	mc := NewMetricsCollector()
+	const workers, requests = 8, 200
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < requests; i++ {
+				mc.RecordRequest(VirtualStudent{ID: fmt.Sprintf("student_%d", w), Subject: "PHYSICS", Format: "MCQ"}, time.Duration(i+1)*time.Millisecond, i%10 != 0, "")
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			if _, err := json.Marshal(mc.GetSummary()); err != nil {
+				t.Errorf("live summary does not encode: %v", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	<-done
+
+	summary := mc.GetSummary()
+	if got := summary["total_requests"]; got != int64(workers*requests) {
+		t.Fatalf("expected %d requests, got %v", workers*requests, got)
+	}
+	// Response times 1..200ms for every worker
+	if got := summary["avg_response_time_ms"]; got != 100.5 {
+		t.Errorf("expected an average of 100.5ms, got %v", got)
+	}
+	// Percentiles are within the histogram's 1%, truncated to milliseconds
+	for key, want := range map[string]int64{"p50_response_time_ms": 100, "p99_response_time_ms": 198} {
+		if got := summary[key].(int64); got < want-2 || got > want+2 {
+			t.Errorf("expected %s near %d, got %d", key, want, got)
+		}
+	}
+}
+
+func TestHistogramQuantilesOverMillionsOfSamples(t *testing.T) {
+	h := NewResponseTimeHistogram()
+	const samples = 3000000
+	// Every whole microsecond from 1us to 100ms, 30 times over
+	for k := 0; k < samples; k++ {
+		h.Record(time.Duration(k%100000+1) * time.Microsecond)
+	}
+	if h.Count() != samples {
+		t.Fatalf("expected %d samples, got %d", samples, h.Count())
+	}
+	// Memory grows with the log of the range, not the samples
+	if buckets := h.Buckets(); buckets > 600 {
+		t.Errorf("expected a few hundred buckets, got %d", buckets)
+	}
+
+	for _, tc := range []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.50, 50 * time.Millisecond},
+		{0.95, 95 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	} {
+		got := h.Quantile(tc.q)
+		if diff := math.Abs(float64(got-tc.want)) / float64(tc.want); diff > histogramAccuracy {
+			t.Errorf("quantile %.2f: expected %v within 1%%, got %v", tc.q, tc.want, got)
+		}
+	}
+	if got := h.Quantile(0); got != time.Microsecond {
+		t.Errorf("expected the minimum as quantile 0, got %v", got)
+	}
+	if got := NewResponseTimeHistogram().Quantile(0.5); got != 0 {
+		t.Errorf("expected 0 from an empty histogram, got %v", got)
+	}
+}
+
+func TestStudentAverageKeepsFractionalMilliseconds(t *testing.T) {
+	mc := NewMetricsCollector()
+	mc.RecordRequest(VirtualStudent{ID: "student_1"}, time.Millisecond, true, "")
+	mc.RecordRequest(VirtualStudent{ID: "student_1"}, 2*time.Millisecond, true, "")
+	if got := mc.StudentMetrics["student_1"].AvgResponseTimeMs; got != 1.5 {
+		t.Errorf("expected an average of 1.5ms, got %v", got)
+	}
+
+	empty := NewMetricsCollector().GetSummary()
+	if _, err := json.Marshal(empty); err != nil || empty["success_rate"] != 0.0 {
+		t.Errorf("expected an empty summary to encode with a zero success rate, got %v, %v", empty, err)
+	}
+}
+
+func TestSummaryBreaksDownBySubjectAndFormat(t *testing.T) {
+	mc := NewMetricsCollector()
+	physicsMCQ := VirtualStudent{ID: "s1", Subject: "PHYSICS", Format: "MCQ"}
+	physicsNumerical := VirtualStudent{ID: "s2", Subject: "PHYSICS", Format: "NUMERICAL"}
+	chemistryMCQ := VirtualStudent{ID: "s3", Subject: "CHEMISTRY", Format: "MCQ"}
+	for i := 0; i < 4; i++ {
+		mc.RecordRequest(physicsMCQ, 10*time.Millisecond, i != 0, "timeout")
+	}
+	mc.RecordRequest(physicsNumerical, 40*time.Millisecond, true, "")
+	mc.RecordRequest(physicsNumerical, 60*time.Millisecond, true, "")
+	mc.RecordRequest(chemistryMCQ, 20*time.Millisecond, false, "bad gateway")
+
+	breakdown := mc.GetSummary()["breakdown"].([]map[string]interface{})
+	var keys []string
+	for _, segment := range breakdown {
+		keys = append(keys, fmt.Sprintf("%s/%s", segment["subject"], segment["format"]))
+	}
+	if got := fmt.Sprint(keys); got != "[CHEMISTRY/MCQ PHYSICS/MCQ PHYSICS/NUMERICAL]" {
+		t.Fatalf("unexpected breakdown keys %s", got)
+	}
+	for i, want := range []struct {
+		requests, successes int64
+		successRate         float64
+		avgMs               float64
+	}{
+		{1, 0, 0, 20},
+		{4, 3, 75, 10},
+		{2, 2, 100, 50},
+	} {
+		segment := breakdown[i]
+		if segment["total_requests"] != want.requests || segment["successful_requests"] != want.successes ||
+			segment["success_rate"] != want.successRate || segment["avg_response_time_ms"] != want.avgMs {
+			t.Errorf("%s: expected %+v, got %v", keys[i], want, segment)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := ExportBreakdownToCSV(mc, filepath.Join(dir, "breakdown.csv")); err != nil {
+		t.Fatalf("breakdown export failed: %v", err)
+	}
+	file, err := os.Open(filepath.Join(dir, "breakdown.csv"))
+	if err != nil {
+		t.Fatalf("open breakdown: %v", err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil || len(rows) != 4 || rows[2][0] != "PHYSICS" || rows[2][1] != "MCQ" || rows[2][2] != "4" || rows[2][5] != "75.00" {
+		t.Fatalf("unexpected breakdown CSV %v, %v", rows, err)
+	}
+
+	if err := ExportSummaryToJSON(mc, filepath.Join(dir, "summary.json")); err != nil {
+		t.Fatalf("summary export failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "summary.json"))
+	if err != nil {
+		t.Fatalf("read summary: %v", err)
+	}
+	var summary struct {
+		TotalRequests int `json:"total_requests"`
+		Breakdown     []struct {
+			Subject       string `json:"subject"`
+			Format        string `json:"format"`
+			TotalRequests int    `json:"total_requests"`
+		} `json:"breakdown"`
+	}
+	if err := json.Unmarshal(data, &summary); err != nil || summary.TotalRequests != 7 || len(summary.Breakdown) != 3 ||
+		summary.Breakdown[2].Format != "NUMERICAL" || summary.Breakdown[2].TotalRequests != 2 {
+		t.Fatalf("unexpected summary JSON %s, %v", data, err)
+	}
+}
+
+func TestQuestionRequestRetriesRateLimitedResponses(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			json.NewEncoder(w).Encode(QuestionResponse{QuestionID: "q_1", Status: "success"})
+		}
+	}))
+	defer srv.Close()
+
+	retry := RetryPolicy{MaxRetries: 3, Backoff: 100 * time.Millisecond}
+	request := QuestionRequest{StudentID: "s1", RequestID: "req_1"}
+	success, errorMsg, retries, responseTime := makeQuestionRequest(context.Background(), srv.Client(), srv.URL, retry, request)
+	if !success || errorMsg != "" || retries != 2 {
+		t.Fatalf("expected success after 2 retries, got %v %q after %d", success, errorMsg, retries)
+	}
+	// The 100ms backoff before the final attempt is not server latency
+	if responseTime <= 0 || responseTime >= retry.Backoff {
+		t.Errorf("expected the final attempt's response time alone, got %s", responseTime)
+	}
+
+	mc := NewMetricsCollector()
+	mc.RecordRequest(VirtualStudent{ID: "s1"}, time.Millisecond, success, errorMsg)
+	mc.RecordRetries("s1", retries)
+	summary := mc.GetSummary()
+	if summary["failed_requests"] != int64(0) || summary["total_retries"] != int64(2) || mc.StudentMetrics["s1"].Retries != 2 {
+		t.Errorf("expected retries counted apart from failures, got %v", summary)
+	}
+
+	// Out of retries the last response is the failure
+	atomic.StoreInt32(&calls, 0)
+	success, errorMsg, retries, _ = makeQuestionRequest(context.Background(), srv.Client(), srv.URL, RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond}, request)
+	if success || !strings.Contains(errorMsg, "HTTP 503") || retries != 1 {
+		t.Errorf("expected a 503 failure after 1 retry, got %v %q after %d", success, errorMsg, retries)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if wait, ok := parseRetryAfter("2"); !ok || wait != 2*time.Second {
+		t.Errorf("expected 2s, got %v %v", wait, ok)
+	}
+	if wait, ok := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); !ok || wait < 59*time.Minute {
+		t.Errorf("expected about an hour from an HTTP date, got %v %v", wait, ok)
+	}
+	for _, value := range []string{"", "soon", "-1"} {
+		if _, ok := parseRetryAfter(value); ok {
+			t.Errorf("expected %q to be ignored", value)
+		}
+	}
+}
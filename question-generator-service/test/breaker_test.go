@@ -0,0 +1,138 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"question-generator-service/internal/config"
+	"question-generator-service/pkg/breaker"
+	"question-generator-service/pkg/rag_advisor"
+)
+
+func TestBreakerOpensAndRecoversThroughHalfOpen(t *testing.T) {
+	b := breaker.New("test", config.CircuitBreakerConfig{
+		MaxRequests:  1,
+		Interval:     time.Minute,
+		Timeout:      50 * time.Millisecond,
+		FailureRatio: 0.5,
+	}, nil)
+
+	for i := 0; i < 5; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("call %d rejected while closed: %v", i, err)
+		}
+		b.Record(false)
+	}
+	if b.State() != breaker.StateOpen {
+		t.Fatalf("expected the breaker to open after 5 failures, got %s", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, breaker.ErrOpen) {
+		t.Fatalf("expected ErrOpen while open, got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("expected a probe after the open timeout, got %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, breaker.ErrOpen) {
+		t.Fatalf("expected a single probe while half-open, got %v", err)
+	}
+	b.Record(false)
+	if b.State() != breaker.StateOpen {
+		t.Fatalf("expected a failed probe to reopen the breaker, got %s", b.State())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("expected a probe after the open timeout, got %v", err)
+	}
+	b.Record(true)
+	if b.State() != breaker.StateClosed {
+		t.Fatalf("expected a successful probe to close the breaker, got %s", b.State())
+	}
+}
+
+func TestBreakerNeedsEnoughCallsToTrip(t *testing.T) {
+	b := breaker.New("test", config.CircuitBreakerConfig{Timeout: time.Minute, FailureRatio: 0.5}, nil)
+
+	for i := 0; i < 4; i++ {
+		b.Allow()
+		b.Record(false)
+	}
+	if b.State() != breaker.StateClosed {
+		t.Fatalf("expected 4 failures to be too few to trip, got %s", b.State())
+	}
+
+	b = breaker.New("test", config.CircuitBreakerConfig{Timeout: time.Minute, FailureRatio: 0.5}, nil)
+	for i := 0; i < 6; i++ {
+		b.Allow()
+		b.Record(true)
+	}
+	for i := 0; i < 5; i++ {
+		b.Allow()
+		b.Record(false)
+	}
+	if b.State() != breaker.StateClosed {
+		t.Fatalf("expected a 5/11 failure ratio to stay closed, got %s", b.State())
+	}
+}
+
+func TestRAGClientShortCircuitsUnderSustainedFailures(t *testing.T) {
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		http.Error(w, "degraded", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := rag_advisor.NewClient(config.RAGConfig{
+		ServiceURL: srv.URL,
+		Timeout:    time.Second,
+		MaxRetries: 2,
+		RetryDelay: time.Millisecond,
+		CircuitBreaker: config.CircuitBreakerConfig{
+			MaxRequests:  1,
+			Interval:     time.Minute,
+			Timeout:      time.Minute,
+			FailureRatio: 0.5,
+		},
+	})
+	check := func() error {
+		_, err := client.CheckQuestionQuality(context.Background(), &rag_advisor.QualityCheckRequest{QuestionText: "q"})
+		return err
+	}
+
+	// Two checks of up to three attempts each reach the five failures
+	// needed to trip
+	for i := 0; i < 2; i++ {
+		if err := check(); err == nil {
+			t.Fatalf("check %d unexpectedly succeeded", i)
+		}
+	}
+	if got := atomic.LoadInt64(&hits); got != 5 {
+		t.Fatalf("expected the breaker to stop the second check after 5 calls, got %d", got)
+	}
+	if client.BreakerState() != breaker.StateOpen {
+		t.Fatalf("expected the breaker to be open, got %s", client.BreakerState())
+	}
+	if got := scrapeMetric(t, `question_generator_circuit_breaker_state{service="rag"}`); got != float64(breaker.StateOpen) {
+		t.Errorf("expected the state metric to report open, got %v", got)
+	}
+
+	start := time.Now()
+	err := check()
+	if !errors.Is(err, breaker.ErrOpen) {
+		t.Fatalf("expected ErrOpen while the breaker is open, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected an open breaker to skip RAG at once, took %s", elapsed)
+	}
+	if got := atomic.LoadInt64(&hits); got != 5 {
+		t.Errorf("expected no calls while open, got %d in total", got)
+	}
+}
@@ -0,0 +1,232 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"question-generator-service/api"
+	"question-generator-service/internal/config"
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/calibrator"
+)
+
+// newFlakyBKT calibrates with mastery 0.8 while up is set and fails otherwise
+func newFlakyBKT(t *testing.T, up *atomic.Bool) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(calibrator.CalibrationResponse{CalibratedDifficulty: 0.9, MasteryLevel: 0.8})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestCalibrationFallbackStrategies(t *testing.T) {
+	req := calibrator.CalibrationRequest{
+		StudentID:           "student_1",
+		TopicID:             "PHY_KINEMATICS",
+		RequestedDifficulty: 0.7,
+		BaseDifficulty:      0.3,
+	}
+
+	tests := []struct {
+		name         string
+		strategy     string
+		knownMastery bool // BKT calibrates once before going down
+		want         calibrator.Calibration
+	}{
+		{"default averages", "", false, calibrator.Calibration{Difficulty: 0.5, Mastery: 0.5, Fallback: calibrator.FallbackAverage}},
+		{"average", "AVERAGE", true, calibrator.Calibration{Difficulty: 0.5, Mastery: 0.8, Fallback: calibrator.FallbackAverage}},
+		{"requested", "REQUESTED", false, calibrator.Calibration{Difficulty: 0.7, Mastery: 0.5, Fallback: calibrator.FallbackRequested}},
+		// 0.7*(0.8+0.1) + 0.3*0.7
+		{"zpd with known mastery", "ZPD", true, calibrator.Calibration{Difficulty: 0.84, Mastery: 0.8, Fallback: calibrator.FallbackZPD}},
+		{"zpd without mastery averages", "ZPD", false, calibrator.Calibration{Difficulty: 0.5, Mastery: 0.5, Fallback: calibrator.FallbackAverage}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var up atomic.Bool
+			svc, err := calibrator.NewService(config.BKTConfig{
+				ServiceURL:       newFlakyBKT(t, &up),
+				Timeout:          time.Second,
+				FallbackStrategy: tt.strategy,
+			})
+			if err != nil {
+				t.Fatalf("failed to create calibrator: %v", err)
+			}
+
+			if tt.knownMastery {
+				up.Store(true)
+				got, err := svc.CalibrateDifficulty(context.Background(), req)
+				if err != nil || got.Source != calibrator.SourceBKT || got.Fallback != "" || got.Mastery != 0.8 {
+					t.Fatalf("expected BKT to calibrate, got %+v, %v", got, err)
+				}
+				up.Store(false)
+			}
+
+			got, err := svc.CalibrateDifficulty(context.Background(), req)
+			if err != nil {
+				t.Fatalf("expected a fallback rather than an error, got %v", err)
+			}
+			if got.Source != calibrator.SourceFallback {
+				t.Errorf("expected a FALLBACK calibration, got %+v", got)
+			}
+			if got.Fallback != tt.want.Fallback || got.Mastery != tt.want.Mastery ||
+				got.Difficulty < tt.want.Difficulty-1e-9 || got.Difficulty > tt.want.Difficulty+1e-9 {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCalibratorRejectsUnknownFallbackStrategy(t *testing.T) {
+	if _, err := calibrator.NewService(config.BKTConfig{ServiceURL: "http://bkt", FallbackStrategy: "MEDIAN"}); err == nil {
+		t.Fatal("expected an unknown fallback strategy to be rejected")
+	}
+}
+
+func TestGenerateQuestionRecordsCalibrationFallback(t *testing.T) {
+	fallbacks := scrapeMetric(t, `question_generator_calibrations_total{source="FALLBACK"}`)
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	generator := newTestGenerator(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), time.Second)
+
+	resp, err := generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+		StudentID: "student_1", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+		Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5,
+	})
+	if err != nil {
+		t.Fatalf("generation failed: %v", err)
+	}
+	if resp.Metadata["calibration_fallback"] != "AVERAGE" {
+		t.Errorf("expected the fallback in the metadata, got %v", resp.Metadata["calibration_fallback"])
+	}
+
+	updates := store.generationLogUpdates()
+	if len(updates) == 0 {
+		t.Fatal("expected the generation log to be updated")
+	}
+	if got := updates[len(updates)-1][13]; got != "AVERAGE" {
+		t.Errorf("expected the generation log to record the AVERAGE fallback, got %v", got)
+	}
+	if got := updates[len(updates)-1][14]; got != "FALLBACK" {
+		t.Errorf("expected the generation log to be tagged FALLBACK, got %v", got)
+	}
+	if got := scrapeMetric(t, `question_generator_calibrations_total{source="FALLBACK"}`); got != fallbacks+1 {
+		t.Errorf("expected one more FALLBACK calibration counted, got %v after %v", got, fallbacks)
+	}
+}
+
+func TestCalibrationConfidenceReachesTheResponse(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	router := newTestRouter(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(calibrator.CalibrationResponse{
+			CalibratedDifficulty: 0.55, MasteryLevel: 0.4, Confidence: 0.82, Recommendation: "review prerequisite",
+		})
+	}))
+
+	rec := serve(router, http.MethodPost, "/v1/questions/generate/batch", `{"requests": [{"student_id": "s1", "topic_id": "PHY_KINEMATICS",
+		"exam_type": "JEE_MAIN", "subject": "PHYSICS", "format": "NUMERICAL", "requested_difficulty": 0.5}]}`)
+	var resp api.BatchGenerateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Succeeded != 1 {
+		t.Fatalf("expected the question to be generated, got %d: %+v, %v", rec.Code, resp, err)
+	}
+	metadata := resp.Results[0].Question.Metadata
+	if metadata["calibration_confidence"] != 0.82 || metadata["calibration_recommendation"] != "review prerequisite" {
+		t.Errorf("expected BKT's confidence and recommendation in the metadata, got %v and %v",
+			metadata["calibration_confidence"], metadata["calibration_recommendation"])
+	}
+
+	updates := store.generationLogUpdates()
+	if len(updates) == 0 {
+		t.Fatal("expected the generation log to be updated")
+	}
+	if last := updates[len(updates)-1]; last[15] != 0.82 || last[16] != "review prerequisite" {
+		t.Errorf("expected the generation log to record them, got %v and %v", last[15], last[16])
+	}
+}
+
+func TestBloomLevelRaisesCalibratedDifficulty(t *testing.T) {
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(calibrator.CalibrationResponse{CalibratedDifficulty: 0.6, MasteryLevel: 0.5})
+	}))
+	defer bkt.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	for _, tt := range []struct {
+		name string
+		url  string
+	}{
+		{"bkt", bkt.URL},
+		{"fallback", down.URL},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := calibrator.NewService(config.BKTConfig{
+				ServiceURL:       tt.url,
+				Timeout:          time.Second,
+				FallbackStrategy: "REQUESTED",
+				BloomAdjustments: config.DefaultBloomAdjustments,
+			})
+			if err != nil {
+				t.Fatalf("failed to create calibrator: %v", err)
+			}
+
+			previous := 0.0
+			for level := 1; level <= len(calibrator.BloomLevels); level++ {
+				got, err := svc.CalibrateDifficulty(context.Background(), calibrator.CalibrationRequest{
+					StudentID: "student_1", TopicID: "PHY_KINEMATICS",
+					RequestedDifficulty: 0.6, BaseDifficulty: 0.6, BloomLevel: level,
+				})
+				if err != nil {
+					t.Fatalf("calibration failed: %v", err)
+				}
+				if got.Difficulty <= previous || got.Difficulty > 1.0 {
+					t.Fatalf("expected %s to calibrate above %g and within bounds, got %g",
+						calibrator.BloomLevels[level-1], previous, got.Difficulty)
+				}
+				previous = got.Difficulty
+			}
+			if previous != 0.75 {
+				t.Errorf("expected CREATE to add 0.15 to 0.6, got %g", previous)
+			}
+		})
+	}
+}
+
+func TestBloomAdjustmentStaysWithinBounds(t *testing.T) {
+	svc, err := calibrator.NewService(config.BKTConfig{
+		ServiceURL:       "http://127.0.0.1:1",
+		Timeout:          time.Second,
+		FallbackStrategy: "REQUESTED",
+		BloomAdjustments: map[string]float64{"create": 0.3},
+	})
+	if err != nil {
+		t.Fatalf("failed to create calibrator: %v", err)
+	}
+	req := calibrator.CalibrationRequest{StudentID: "student_1", TopicID: "PHY_KINEMATICS", RequestedDifficulty: 0.9}
+
+	if got, _ := svc.CalibrateDifficulty(context.Background(), req); got.Difficulty != 0.9 {
+		t.Errorf("expected no adjustment without a Bloom level, got %g", got.Difficulty)
+	}
+	req.BloomLevel = 6
+	if got, _ := svc.CalibrateDifficulty(context.Background(), req); got.Difficulty != 1.0 {
+		t.Errorf("expected the adjusted difficulty capped at 1.0, got %g", got.Difficulty)
+	}
+
+	if _, err := calibrator.NewService(config.BKTConfig{BloomAdjustments: map[string]float64{"MEMORISE": 0.1}}); err == nil {
+		t.Error("expected an unknown Bloom level to be rejected")
+	}
+}
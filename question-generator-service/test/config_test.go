@@ -0,0 +1,264 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"question-generator-service/internal/config"
+)
+
+// writeConfigFile writes contents to a temporary config file and points
+// CONFIG_FILE at it
+func writeConfigFile(t *testing.T, contents string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+}
+
+// clearEnv unsets keys for the duration of the test
+func clearEnv(t *testing.T, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		t.Setenv(key, "")
+	}
+}
+
+func TestLoadConfigFromFile(t *testing.T) {
+	clearEnv(t, "DB_HOST", "BKT_TIMEOUT", "RAG_ENABLED", "ALLOWED_ORIGINS", "BATCH_MAX_SIZE")
+	writeConfigFile(t, `{
+		"DB_HOST": "db.internal",
+		"BKT_TIMEOUT": "2s",
+		"RAG_ENABLED": false,
+		"ALLOWED_ORIGINS": ["https://app.example.com", "https://admin.example.com"],
+		"BATCH_MAX_SIZE": 20
+	}`)
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Database.Host != "db.internal" || cfg.BKT.Timeout != 2*time.Second || cfg.RAG.Enabled || cfg.Batch.MaxSize != 20 {
+		t.Fatalf("file values were not applied: %+v", cfg)
+	}
+	if want := []string{"https://app.example.com", "https://admin.example.com"}; !reflect.DeepEqual(cfg.Server.AllowedOrigins, want) {
+		t.Fatalf("expected origins %v, got %v", want, cfg.Server.AllowedOrigins)
+	}
+}
+
+func TestLoadConfigEnvOverridesFile(t *testing.T) {
+	clearEnv(t, "DB_PORT", "SERVER_PORT")
+	writeConfigFile(t, `{"DB_HOST": "db.internal", "DB_PORT": 6543}`)
+	t.Setenv("DB_HOST", "db.override")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Database.Host != "db.override" {
+		t.Fatalf("expected the environment to win, got host %q", cfg.Database.Host)
+	}
+	if cfg.Database.Port != 6543 {
+		t.Fatalf("expected the file port without an env override, got %d", cfg.Database.Port)
+	}
+	if cfg.Server.Port != 8080 {
+		t.Fatalf("expected the default server port when neither sets it, got %d", cfg.Server.Port)
+	}
+}
+
+func TestLoadConfigWithoutFile(t *testing.T) {
+	clearEnv(t, "CONFIG_FILE", "DB_HOST")
+	t.Setenv("DB_NAME", "from_env")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Database.Host != "localhost" || cfg.Database.Database != "from_env" {
+		t.Fatalf("expected env over defaults, got %+v", cfg.Database)
+	}
+}
+
+func TestLoadConfigValidatesMergedResult(t *testing.T) {
+	clearEnv(t, "TEMPLATE_SELECTION_MODE", "TEMPLATE_WEIGHT_DIFFICULTY")
+
+	writeConfigFile(t, `{"TEMPLATE_SELECTION_MODE": "RANDOM"}`)
+	if _, err := config.LoadConfig(); err == nil {
+		t.Fatal("expected an invalid selection mode from the file to be rejected")
+	}
+
+	// The environment can fix what the file got wrong
+	t.Setenv("TEMPLATE_SELECTION_MODE", "BEST")
+	if _, err := config.LoadConfig(); err != nil {
+		t.Fatalf("expected the env override to pass validation, got %v", err)
+	}
+
+	writeConfigFile(t, `{"DB_HOST": {"name": "db"}}`)
+	if _, err := config.LoadConfig(); err == nil {
+		t.Fatal("expected a nested object to be rejected")
+	}
+
+	writeConfigFile(t, `{"DB_HOST": `)
+	if _, err := config.LoadConfig(); err == nil {
+		t.Fatal("expected malformed JSON to be rejected")
+	}
+}
+
+func TestLoadConfigRejectsOutOfRangeValues(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"idle above open", map[string]string{"DB_MAX_OPEN_CONNS": "5", "DB_MAX_IDLE_CONNS": "10"}, "DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS (5), got 10"},
+		{"no open conns", map[string]string{"DB_MAX_OPEN_CONNS": "0"}, "DB_MAX_OPEN_CONNS must be at least 1"},
+		{"db port", map[string]string{"DB_PORT": "70000"}, "DB_PORT must be between 1 and 65535, got 70000"},
+		{"server port zero", map[string]string{"SERVER_PORT": "0"}, "SERVER_PORT must be between 1 and 65535, got 0"},
+		{"server port negative", map[string]string{"SERVER_PORT": "-80"}, "SERVER_PORT must be between 1 and 65535"},
+		{"zero BKT timeout", map[string]string{"BKT_TIMEOUT": "0s"}, "BKT_TIMEOUT must be positive, got 0s"},
+		{"negative BKT timeout", map[string]string{"BKT_TIMEOUT": "-1s"}, "BKT_TIMEOUT must be positive, got -1s"},
+		{"negative conn lifetime", map[string]string{"DB_CONN_MAX_LIFETIME": "-1m"}, "DB_CONN_MAX_LIFETIME must not be negative"},
+		{"template cache without TTL", map[string]string{"DB_TEMPLATE_CACHE_SIZE": "100", "DB_TEMPLATE_CACHE_TTL": "0s"}, "DB_TEMPLATE_CACHE_TTL must be positive"},
+		{"zero write timeout", map[string]string{"SERVER_WRITE_TIMEOUT": "0s"}, "SERVER_WRITE_TIMEOUT must be positive"},
+		{"negative retries", map[string]string{"BKT_RETRY_COUNT": "-1"}, "BKT_RETRY_COUNT must not be negative"},
+		{"failure ratio", map[string]string{"BKT_CB_FAILURE_RATIO": "1.5"}, "BKT_CB_FAILURE_RATIO must be in (0, 1]"},
+		{"unknown fallback strategy", map[string]string{"BKT_FALLBACK_STRATEGY": "MEDIAN"}, `BKT_FALLBACK_STRATEGY must be AVERAGE, ZPD or REQUESTED, got "MEDIAN"`},
+		{"zero RAG timeout", map[string]string{"RAG_ENABLED": "true", "RAG_TIMEOUT": "0s"}, "RAG_TIMEOUT must be positive when RAG is enabled"},
+		{"negative RAG retries", map[string]string{"RAG_MAX_RETRIES": "-2"}, "RAG_MAX_RETRIES must not be negative"},
+		{"recent window without TTL", map[string]string{"TEMPLATE_RECENT_WINDOW": "3", "TEMPLATE_RECENT_TTL": "0s"}, "TEMPLATE_RECENT_TTL must be positive"},
+		{"negative cooldown", map[string]string{"TEMPLATE_COOLDOWN_SELECTIONS": "-1"}, "TEMPLATE_COOLDOWN_SELECTIONS must not be negative"},
+		{"no candidates", map[string]string{"TEMPLATE_MAX_CANDIDATES": "0"}, "TEMPLATE_MAX_CANDIDATES must be at least 1"},
+		{"negative stage timeout", map[string]string{"STAGE_RAG_TIMEOUT": "-1s"}, "STAGE_RAG_TIMEOUT must not be negative"},
+		{"negative latency budget", map[string]string{"MAX_GENERATION_LATENCY": "-1s"}, "MAX_GENERATION_LATENCY must not be negative"},
+		{"difficulty band narrower than one step", map[string]string{"TEMPLATE_MAX_DIFFICULTY_BAND": "0.05"}, "TEMPLATE_MAX_DIFFICULTY_BAND must be between"},
+		{"migration version", map[string]string{"DB_MIGRATION_VERSION": "V1.5"}, `DB_MIGRATION_VERSION must be latest or a version such as V14, got "V1.5"`},
+		{"startup validation", map[string]string{"TEMPLATE_STARTUP_VALIDATION": "STRICT"}, `TEMPLATE_STARTUP_VALIDATION must be OFF, WARN or FAIL, got "STRICT"`},
+		{"unknown validation policy", map[string]string{"VALIDATION_POLICY": "LAX"}, `VALIDATION_POLICY must be STRICT or LENIENT, got "LAX"`},
+		{"unknown grammar checker", map[string]string{"GRAMMAR_CHECKER": "REMOTE"}, `GRAMMAR_CHECKER must be HEURISTIC or HTTP, got "REMOTE"`},
+		{"grammar checker without URL", map[string]string{"GRAMMAR_CHECKER": "HTTP"}, "GRAMMAR_CHECKER_URL is required when GRAMMAR_CHECKER is HTTP"},
+		{"retry delays", map[string]string{"GENERATION_RETRY_BASE_DELAY": "2m", "GENERATION_RETRY_MAX_DELAY": "1m"}, "GENERATION_RETRY_BASE_DELAY must be positive and at most GENERATION_RETRY_MAX_DELAY, got 2m0s and 1m0s"},
+		{"duplicate threshold", map[string]string{"DUPLICATE_SIMILARITY_THRESHOLD": "1.5"}, "DUPLICATE_SIMILARITY_THRESHOLD must be above 0.0 and at most 1.0, got 1.5"},
+		{"negative redis db", map[string]string{"RATE_LIMIT_REDIS_DB": "-1"}, "RATE_LIMIT_REDIS_DB must not be negative"},
+		{"negative max in flight", map[string]string{"RATE_LIMIT_MAX_IN_FLIGHT": "-1"}, "RATE_LIMIT_MAX_IN_FLIGHT must not be negative"},
+		{"bloom adjustment", map[string]string{"BKT_BLOOM_ADJUSTMENTS": "APPLY=0.05,CREATE=0.8"}, "BKT_BLOOM_ADJUSTMENTS CREATE must be between 0.0 and 0.5, got 0.8"},
+		{"subject threshold", map[string]string{"RAG_SUBJECT_THRESHOLDS": "BIOLOGY=0.7,MATHEMATICS=1.2"}, "RAG_SUBJECT_THRESHOLDS MATHEMATICS must be between 0.0 and 1.0, got 1.2"},
+		{"unknown log level", map[string]string{"LOG_LEVEL": "verbose"}, `LOG_LEVEL must be debug, info, warn or error, got "verbose"`},
+		{"unknown log format", map[string]string{"LOG_FORMAT": "xml"}, `LOG_FORMAT must be json or console, got "xml"`},
+		{"exam without subjects", map[string]string{"EXAM_SUBJECTS": "NEET=PHYSICS|CHEMISTRY|BIOLOGY,BITSAT="}, "EXAM_SUBJECTS BITSAT must list at least one subject"},
+		{"exam with unknown subject", map[string]string{"EXAM_SUBJECTS": "BITSAT=PHYSICS|ENGLISH"}, `EXAM_SUBJECTS BITSAT: subject must be PHYSICS, CHEMISTRY, MATHEMATICS or BIOLOGY, got "ENGLISH"`},
+		{"warm-up of no templates", map[string]string{"WARMUP_ENABLED": "true", "WARMUP_TOP_N": "0"}, "WARMUP_TOP_N must be at least 1 when WARMUP_ENABLED is set, got 0"},
+		{"fallback for unknown exam", map[string]string{"TEMPLATE_EXAM_TYPE_FALLBACKS": "BITSAT=JEE_MAIN"}, `TEMPLATE_EXAM_TYPE_FALLBACKS: unknown exam type "BITSAT"`},
+		{"fallback to itself", map[string]string{"TEMPLATE_EXAM_TYPE_FALLBACKS": "FOUNDATION=FOUNDATION"}, `TEMPLATE_EXAM_TYPE_FALLBACKS FOUNDATION: fallback must be another known exam type, got "FOUNDATION"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t, "CONFIG_FILE")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, err := config.LoadConfig()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRejectsUnparseableDurations(t *testing.T) {
+	clearEnv(t, "CONFIG_FILE")
+	t.Setenv("BKT_TIMEOUT", "5")
+	t.Setenv("SERVER_READ_TIMEOUT", "ten seconds")
+
+	_, err := config.LoadConfig()
+	if err == nil {
+		t.Fatal("expected unparseable durations to be rejected")
+	}
+	for _, want := range []string{`BKT_TIMEOUT="5" is not a duration`, `SERVER_READ_TIMEOUT="ten seconds" is not a duration`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigReportsEveryMalformedValue(t *testing.T) {
+	clearEnv(t, "CONFIG_FILE")
+	t.Setenv("DB_PORT", "85o0")
+	t.Setenv("RAG_ENABLED", "yes please")
+	t.Setenv("RAG_ALIGNMENT_THRESHOLD", "0,8")
+	t.Setenv("RATE_LIMIT_PATH_OVERRIDES", "/v1/answers:600")
+	t.Setenv("RAG_SUBJECT_THRESHOLDS", "BIOLOGY=high")
+	t.Setenv("EXAM_SUBJECTS", "PHYSICS|CHEMISTRY")
+
+	_, err := config.LoadConfig()
+	if err == nil {
+		t.Fatal("expected malformed values to be rejected instead of replaced by defaults")
+	}
+	for _, want := range []string{
+		`DB_PORT="85o0" is not an integer`,
+		`RAG_ENABLED="yes please" is not a boolean`,
+		`RAG_ALIGNMENT_THRESHOLD="0,8" is not a number`,
+		`RATE_LIMIT_PATH_OVERRIDES="/v1/answers:600" is not a list of prefix=limit pairs`,
+		`RAG_SUBJECT_THRESHOLDS="BIOLOGY=high" is not a list of name=number pairs`,
+		`EXAM_SUBJECTS="PHYSICS|CHEMISTRY" is not a list of name=value|value pairs`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigReportsMalformedFileValues(t *testing.T) {
+	clearEnv(t, "DB_PORT")
+	writeConfigFile(t, `{"DB_PORT": "five thousand"}`)
+
+	_, err := config.LoadConfig()
+	if err == nil || !strings.Contains(err.Error(), `DB_PORT="five thousand" is not an integer`) {
+		t.Fatalf("expected the malformed file value to be reported, got %v", err)
+	}
+}
+
+func TestSubjectThresholdsFallBackToGlobal(t *testing.T) {
+	clearEnv(t, "CONFIG_FILE")
+	t.Setenv("RAG_ALIGNMENT_THRESHOLD", "0.8")
+	t.Setenv("RAG_SUBJECT_THRESHOLDS", "BIOLOGY=0.65, MATHEMATICS=0.9")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for subject, want := range map[string]float64{"BIOLOGY": 0.65, "MATHEMATICS": 0.9, "PHYSICS": 0.8} {
+		if got := cfg.RAG.ThresholdFor(subject); got != want {
+			t.Errorf("expected %s threshold %v, got %v", subject, want, got)
+		}
+	}
+}
+
+func TestExamSubjectsAreConfigurable(t *testing.T) {
+	clearEnv(t, "CONFIG_FILE", "EXAM_SUBJECTS")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Validator.ExamSubjects, config.DefaultExamSubjects) {
+		t.Errorf("expected the default exam subjects, got %v", cfg.Validator.ExamSubjects)
+	}
+
+	t.Setenv("EXAM_SUBJECTS", "NEET=PHYSICS|CHEMISTRY|BIOLOGY, BITSAT=PHYSICS | CHEMISTRY | MATHEMATICS")
+	if cfg, err = config.LoadConfig(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string][]string{
+		"NEET":   {"PHYSICS", "CHEMISTRY", "BIOLOGY"},
+		"BITSAT": {"PHYSICS", "CHEMISTRY", "MATHEMATICS"},
+	}
+	if !reflect.DeepEqual(cfg.Validator.ExamSubjects, want) {
+		t.Errorf("expected %v, got %v", want, cfg.Validator.ExamSubjects)
+	}
+}
@@ -0,0 +1,1086 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"question-generator-service/internal/config"
+	"question-generator-service/internal/db"
+	"question-generator-service/pkg/templates"
+)
+
+func newFakeDBClient(t *testing.T, store *recordingDB) *db.Client {
+	t.Helper()
+	sqlDB := sql.OpenDB(store)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db.NewClientFromDB(sqlDB)
+}
+
+func storedTemplate() *db.QuestionTemplate {
+	unit := "m/s"
+	return &db.QuestionTemplate{
+		TopicID:        "PHY_KINEMATICS",
+		ExamType:       "JEE_MAIN",
+		Subject:        "PHYSICS",
+		Format:         "NUMERICAL",
+		TemplateText:   "A car moving at {{v0}} m/s accelerates at {{a}} m/s^2 for {{t}} s. Find its final speed.",
+		VariableSlots:  `[{"name": "v0", "type": "integer", "range": {"min": 1, "max": 50}}]`,
+		AnswerUnit:     &unit,
+		BaseDifficulty: 0.5,
+		BloomLevel:     3,
+		ConceptDepth:   2,
+		Chapter:        "Kinematics",
+	}
+}
+
+func TestTemplateCRUDRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeDBClient(t, newRecordingDB())
+
+	qt := storedTemplate()
+	formula := "{{v0}} + 2"
+	qt.AnswerFormula = &formula
+	if err := client.CreateTemplate(ctx, qt); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if qt.TemplateID == "" || qt.Version != 1 || !qt.IsActive || qt.RenderFormat != "PLAIN" {
+		t.Fatalf("create did not write back generated fields: %+v", qt)
+	}
+
+	fetched, err := client.GetQuestionTemplate(ctx, qt.TemplateID)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if fetched.TemplateText != qt.TemplateText || fetched.AnswerUnit == nil || *fetched.AnswerUnit != "m/s" ||
+		fetched.AnswerFormula == nil || *fetched.AnswerFormula != formula {
+		t.Fatalf("fetched template differs from created one: %+v", fetched)
+	}
+
+	fetched.TemplateText = "A train moving at {{v0}} m/s stops. Find its initial speed."
+	if err := client.UpdateTemplate(ctx, fetched); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if fetched.Version != 2 {
+		t.Fatalf("expected version 2 after update, got %d", fetched.Version)
+	}
+
+	if err := client.DeactivateTemplate(ctx, qt.TemplateID); err != nil {
+		t.Fatalf("deactivate failed: %v", err)
+	}
+	if _, err := client.GetQuestionTemplate(ctx, qt.TemplateID); !errors.Is(err, db.ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound after deactivation, got %v", err)
+	}
+	if err := client.DeactivateTemplate(ctx, qt.TemplateID); !errors.Is(err, db.ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound deactivating twice, got %v", err)
+	}
+}
+
+func TestTemplateWriteErrors(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeDBClient(t, newRecordingDB())
+
+	qt := storedTemplate()
+	qt.TemplateID = kinematicsTemplateID
+	if err := client.CreateTemplate(ctx, qt); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	duplicate := storedTemplate()
+	duplicate.TemplateID = qt.TemplateID
+	if err := client.CreateTemplate(ctx, duplicate); !errors.Is(err, db.ErrTemplateExists) {
+		t.Fatalf("expected ErrTemplateExists, got %v", err)
+	}
+
+	missing := storedTemplate()
+	missing.TemplateID = "missing_template"
+	if err := client.UpdateTemplate(ctx, missing); !errors.Is(err, db.ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound updating a missing template, got %v", err)
+	}
+}
+
+func TestGeneratedQuestionRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeDBClient(t, newRecordingDB())
+
+	saved := &db.GeneratedQuestion{
+		QuestionID:    "q_req-1_1700000000",
+		TemplateID:    kinematicsTemplateID,
+		StudentID:     "student-1",
+		RequestID:     "req-1",
+		QuestionText:  "A car moving at 5 m/s accelerates at 2 m/s^2 for 3 s. Find its final speed.",
+		Options:       db.StringMap{"A": "11 m/s", "B": "6 m/s"},
+		CorrectAnswer: "11 m/s",
+		SolutionSteps: db.StringList{"v = u + at", "v = 5 + 2*3 = 11 m/s"},
+		Difficulty:    0.62,
+		Seed:          42,
+	}
+	if err := client.SaveGeneratedQuestion(ctx, saved); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if saved.CreatedAt.IsZero() {
+		t.Fatal("expected created_at to be written back")
+	}
+
+	fetched, err := client.GetGeneratedQuestion(ctx, saved.QuestionID)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if fetched.QuestionText != saved.QuestionText || fetched.Options["A"] != "11 m/s" ||
+		len(fetched.SolutionSteps) != 2 || fetched.Seed != 42 || fetched.RenderFormat != "PLAIN" {
+		t.Fatalf("fetched question differs from saved one: %+v", fetched)
+	}
+
+	if _, err := client.GetGeneratedQuestion(ctx, "q_missing"); !errors.Is(err, db.ErrQuestionNotFound) {
+		t.Fatalf("expected ErrQuestionNotFound, got %v", err)
+	}
+}
+
+func TestGenerationLogLookupByQuestionID(t *testing.T) {
+	store := newRecordingDB()
+	client := newFakeDBClient(t, store)
+	ctx := context.Background()
+
+	templateID := kinematicsTemplateID
+	calibrated, score := 0.55, 0.82
+	logged := &db.GenerationLog{
+		QuestionID:           "q_req-7_1700000000",
+		StudentID:            "student-1",
+		RequestID:            "req-7",
+		TopicID:              "PHY_KINEMATICS",
+		ExamType:             "JEE_MAIN",
+		Subject:              "PHYSICS",
+		Format:               "NUMERICAL",
+		RequestedDifficulty:  0.5,
+		CalibratedDifficulty: &calibrated,
+		TemplateID:           &templateID,
+		FinalQualityScore:    &score,
+		TotalPipelineTimeMs:  140,
+		Status:               "COMPLETED",
+	}
+	if err := client.CreateGenerationLog(ctx, logged); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if logged.ID == 0 {
+		t.Fatal("expected the log ID to be written back")
+	}
+	// A log without a question ID is stored with NULL and never matches
+	if err := client.CreateGenerationLog(ctx, &db.GenerationLog{StudentID: "student-2", Status: "FAILED"}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	fetched, err := client.GetGenerationLogByQuestionID(ctx, logged.QuestionID)
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	if fetched.ID != logged.ID || fetched.RequestID != "req-7" || fetched.Status != "COMPLETED" ||
+		fetched.TemplateID == nil || *fetched.TemplateID != templateID ||
+		fetched.FinalQualityScore == nil || *fetched.FinalQualityScore != 0.82 || fetched.ErrorMessage != "" {
+		t.Fatalf("fetched log differs from the created one: %+v", fetched)
+	}
+
+	if _, err := client.GetGenerationLogByQuestionID(ctx, ""); !errors.Is(err, db.ErrGenerationLogNotFound) {
+		t.Fatalf("expected ErrGenerationLogNotFound for an empty ID, got %v", err)
+	}
+	if _, err := client.GetGenerationLogByQuestionID(ctx, "q_missing"); !errors.Is(err, db.ErrGenerationLogNotFound) {
+		t.Fatalf("expected ErrGenerationLogNotFound, got %v", err)
+	}
+}
+
+func TestGetQuestionTemplateSurfacesStoredScores(t *testing.T) {
+	store := newRecordingDB()
+	qt := previewTemplate()
+	validation, clarity, success := 0.87, 0.9, 0.625
+	qt.ValidationScore, qt.ClarityScore, qt.SuccessRate = &validation, &clarity, &success
+	store.addTemplate(qt)
+	store.addTemplate(&db.QuestionTemplate{TemplateID: "unscored", TemplateText: "Which of these is a vector quantity?"})
+
+	client := newFakeDBClient(t, store)
+	fetched, err := client.GetQuestionTemplate(context.Background(), qt.TemplateID)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if fetched.ValidationScore == nil || *fetched.ValidationScore != 0.87 {
+		t.Errorf("expected validation score 0.87, got %v", fetched.ValidationScore)
+	}
+	if fetched.ClarityScore == nil || *fetched.ClarityScore != 0.9 {
+		t.Errorf("expected clarity score 0.9, got %v", fetched.ClarityScore)
+	}
+	if fetched.SuccessRate == nil || *fetched.SuccessRate != 0.625 {
+		t.Errorf("expected success rate 0.625, got %v", fetched.SuccessRate)
+	}
+
+	unscored, err := client.GetQuestionTemplate(context.Background(), "unscored")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if unscored.ValidationScore != nil || unscored.SuccessRate != nil {
+		t.Errorf("expected NULL scores to stay nil, got %v and %v", unscored.ValidationScore, unscored.SuccessRate)
+	}
+}
+
+func TestPreparedStatementsAreReused(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	client := db.NewClientFromDB(sql.OpenDB(store))
+	if err := client.PrepareStatements(ctx); err != nil {
+		t.Fatalf("prepare failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetQuestionTemplate(ctx, kinematicsTemplateID); err != nil {
+			t.Fatalf("get template failed: %v", err)
+		}
+	}
+	logged := &db.GenerationLog{QuestionID: "q_req-8_1700000000", StudentID: "student-1", RequestID: "req-8", Status: "PENDING"}
+	if err := client.CreateGenerationLog(ctx, logged); err != nil {
+		t.Fatalf("create log failed: %v", err)
+	}
+	logged.Status = "COMPLETED"
+	if err := client.UpdateGenerationLogOutcome(ctx, logged); err != nil {
+		t.Fatalf("update log failed: %v", err)
+	}
+	fetched, err := client.GetGenerationLogByQuestionID(ctx, logged.QuestionID)
+	if err != nil || fetched.Status != "COMPLETED" {
+		t.Fatalf("expected the prepared update to apply, got %+v, %v", fetched, err)
+	}
+
+	prepared := store.preparedStatements()
+	if len(prepared) != 3 {
+		t.Fatalf("expected the 3 static queries to be prepared once, got %d", len(prepared))
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	for _, stmt := range prepared {
+		if !stmt.closed.Load() {
+			t.Errorf("expected Close to close the statement for %q", strings.Join(strings.Fields(stmt.query), " "))
+		}
+	}
+}
+
+// templateReads counts the single-template reads that reached store
+func templateReads(store *recordingDB) int {
+	var n int
+	for _, statement := range store.recorded() {
+		if strings.Contains(statement, "FROM question_templates WHERE template_id = $1") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTemplateCacheServesHitsAndInvalidatesOnWrites(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	client := newFakeDBClient(t, store)
+	client.EnableTemplateCache(10, time.Hour)
+
+	reads := func() int { return templateReads(store) }
+	get := func() *db.QuestionTemplate {
+		t.Helper()
+		qt, err := client.GetQuestionTemplate(ctx, kinematicsTemplateID)
+		if err != nil {
+			t.Fatalf("get failed: %v", err)
+		}
+		return qt
+	}
+
+	first := get()
+	first.TemplateText = "modified by the caller"
+	if second := get(); second.TemplateText == "modified by the caller" {
+		t.Error("expected the cache to hand out copies")
+	}
+	if n := reads(); n != 1 {
+		t.Fatalf("expected a miss then a hit, got %d reads", n)
+	}
+
+	if err := client.IncrementTemplateUsage(ctx, kinematicsTemplateID); err != nil {
+		t.Fatalf("increment failed: %v", err)
+	}
+	if n := reads(); n != 1 {
+		t.Fatalf("expected the usage increment to keep the template cached, got %d reads", n)
+	}
+
+	updated := get()
+	updated.TemplateText = "A ball is dropped from {height} m. How long does it take to land?"
+	if err := client.UpdateTemplate(ctx, updated); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if qt := get(); qt.TemplateText != updated.TemplateText || qt.Version != updated.Version {
+		t.Fatalf("expected the update to invalidate, got %+v", qt)
+	}
+	if n := reads(); n != 2 {
+		t.Fatalf("expected one read after the update, got %d reads", n)
+	}
+
+	if _, err := client.GetQuestionTemplateUncached(ctx, kinematicsTemplateID); err != nil {
+		t.Fatalf("uncached get failed: %v", err)
+	}
+	if n := reads(); n != 3 {
+		t.Fatalf("expected the uncached get to read the database, got %d reads", n)
+	}
+
+	if err := client.DeactivateTemplate(ctx, kinematicsTemplateID); err != nil {
+		t.Fatalf("deactivate failed: %v", err)
+	}
+	if _, err := client.GetQuestionTemplate(ctx, kinematicsTemplateID); !errors.Is(err, db.ErrTemplateNotFound) {
+		t.Fatalf("expected a deactivated template to stop being served, got %v", err)
+	}
+}
+
+func TestTemplateCacheServesSelections(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	client := newFakeDBClient(t, store)
+	client.EnableTemplateCache(10, time.Hour)
+
+	filters := db.TemplateFilters{TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN", Limit: 10}
+	selections := func() int {
+		var n int
+		for _, statement := range store.recorded() {
+			if strings.Contains(statement, "FROM question_templates WHERE is_active = true") {
+				n++
+			}
+		}
+		return n
+	}
+	selectTemplates := func(filters db.TemplateFilters) []*db.QuestionTemplate {
+		t.Helper()
+		found, err := client.GetTemplatesByFilters(ctx, filters)
+		if err != nil {
+			t.Fatalf("selection failed: %v", err)
+		}
+		return found
+	}
+
+	first := selectTemplates(filters)
+	first[0].TemplateText = "modified by the caller"
+	if second := selectTemplates(filters); len(second) != 1 || second[0].TemplateText == "modified by the caller" {
+		t.Fatalf("expected the cache to hand out copies, got %+v", second)
+	}
+	if n := selections(); n != 1 {
+		t.Fatalf("expected a miss then a hit, got %d selection queries", n)
+	}
+	if selectTemplates(db.TemplateFilters{TopicID: "PHY_KINEMATICS", ExamType: "NEET", Limit: 10}); selections() != 2 {
+		t.Fatal("expected other filters to be selected afresh")
+	}
+
+	if err := client.IncrementTemplateUsage(ctx, kinematicsTemplateID); err != nil {
+		t.Fatalf("increment failed: %v", err)
+	}
+	if selectTemplates(filters); selections() != 2 {
+		t.Fatalf("expected the usage increment to keep the selection cached, got %d queries", selections())
+	}
+
+	added := previewTemplate()
+	added.TemplateID = ""
+	if err := client.CreateTemplate(ctx, added); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if found := selectTemplates(filters); len(found) != 2 || selections() != 3 {
+		t.Fatalf("expected the new template to invalidate the selection, got %d templates after %d queries", len(found), selections())
+	}
+
+	if err := client.DeactivateTemplate(ctx, added.TemplateID); err != nil {
+		t.Fatalf("deactivate failed: %v", err)
+	}
+	if found := selectTemplates(filters); len(found) != 1 || found[0].TemplateID != kinematicsTemplateID {
+		t.Fatalf("expected the deactivated template to leave the selection, got %+v", found)
+	}
+}
+
+func TestTemplateWarmUpPopulatesCache(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	addPaperTemplates(store, "PHYSICS", "PHY_KINEMATICS", 4, 0.5)
+	addPaperTemplates(store, "CHEMISTRY", "CHEM_BONDING", 1, 0.5)
+	for i, id := range []string{"PHY_KINEMATICS_0.50_2", "PHY_KINEMATICS_0.50_0", "PHY_KINEMATICS_0.50_3"} {
+		store.templates[id].UsageCount = 10 - i
+	}
+	store.templates["PHY_KINEMATICS_0.50_2"].NumericalTolerance = &db.NumericalTolerance{Absolute: 0.5}
+	broken := previewTemplate()
+	broken.TemplateID, broken.Subject, broken.VariableSlots, broken.UsageCount = "chem_broken", "CHEMISTRY", "{not json", 100
+	store.addTemplate(broken)
+
+	client := newFakeDBClient(t, store)
+	client.EnableTemplateCache(10, time.Hour)
+	svc, err := templates.NewService(client, config.TemplateConfig{})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+
+	result, err := svc.WarmUp(ctx, 2)
+	if err != nil {
+		t.Fatalf("warm-up failed: %v", err)
+	}
+	// The two most used physics templates and the parseable chemistry one
+	warmed := []string{"PHY_KINEMATICS_0.50_2", "PHY_KINEMATICS_0.50_0", "CHEM_BONDING_0.50_0"}
+	if result.Templates != len(warmed) || result.Duration <= 0 {
+		t.Fatalf("expected %d templates warmed, got %+v", len(warmed), result)
+	}
+
+	warmupReads := templateReads(store)
+	for _, id := range warmed {
+		qt, err := client.GetQuestionTemplate(ctx, id)
+		if err != nil {
+			t.Fatalf("get %s failed: %v", id, err)
+		}
+		if !svc.HasParsedSpecs(id) {
+			t.Errorf("expected the variable specs of %s to be parsed", id)
+		}
+		// Warmed entries are full rows, not the selection query's subset
+		if id == "PHY_KINEMATICS_0.50_2" && (qt.NumericalTolerance == nil || qt.NumericalTolerance.Absolute != 0.5) {
+			t.Errorf("expected the warmed template's tolerance, got %+v", qt.NumericalTolerance)
+		}
+		if !qt.IsActive || qt.Version == 0 {
+			t.Errorf("expected %s warmed with is_active and version, got %v and %d", id, qt.IsActive, qt.Version)
+		}
+	}
+	if n := templateReads(store) - warmupReads; n != 0 {
+		t.Errorf("expected the warmed templates to be served from the cache, got %d reads", n)
+	}
+	for _, id := range []string{"PHY_KINEMATICS_0.50_3", "chem_broken"} {
+		if svc.HasParsedSpecs(id) {
+			t.Errorf("expected %s not to be warmed", id)
+		}
+		client.GetQuestionTemplate(ctx, id)
+	}
+	if n := templateReads(store) - warmupReads; n != 2 {
+		t.Errorf("expected the templates left out to be read from the database, got %d reads", n)
+	}
+}
+
+func TestTemplateCacheEvictsAndExpires(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	seedSearchTemplates(t, store)
+	client := newFakeDBClient(t, store)
+
+	client.EnableTemplateCache(2, time.Hour)
+	for _, id := range []string{molesTemplateID, brakingTemplateID, throwTemplateID, molesTemplateID} {
+		if _, err := client.GetQuestionTemplate(ctx, id); err != nil {
+			t.Fatalf("get %s failed: %v", id, err)
+		}
+	}
+	if n := templateReads(store); n != 4 {
+		t.Errorf("expected the least recently used template to be evicted, got %d reads", n)
+	}
+
+	client.EnableTemplateCache(2, time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetQuestionTemplate(ctx, brakingTemplateID); err != nil {
+			t.Fatalf("get failed: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := templateReads(store); n != 6 {
+		t.Errorf("expected an expired template to be read again, got %d reads", n)
+	}
+}
+
+// BenchmarkGetQuestionTemplate compares fetching a template through the
+// prepared statement with parsing the query on every call
+func BenchmarkGetQuestionTemplate(b *testing.B) {
+	for _, prepared := range []bool{false, true} {
+		name := "adhoc"
+		if prepared {
+			name = "prepared"
+		}
+		b.Run(name, func(b *testing.B) {
+			ctx := context.Background()
+			store := newRecordingDB()
+			store.addTemplate(previewTemplate())
+			client := db.NewClientFromDB(sql.OpenDB(store))
+			defer client.Close()
+			if prepared {
+				if err := client.PrepareStatements(ctx); err != nil {
+					b.Fatalf("prepare failed: %v", err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.GetQuestionTemplate(ctx, kinematicsTemplateID); err != nil {
+					b.Fatalf("get template failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// logSeedTime is the created_at of the newest log seedGenerationLogs stores
+var logSeedTime = time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+// seedGenerationLogs stores five logs a minute apart, newest first: three of
+// student-1 (PHYSICS, the middle one FAILED) and two of student-2
+// (CHEMISTRY, NEET)
+func seedGenerationLogs(t *testing.T, store *recordingDB) {
+	t.Helper()
+	client := newFakeDBClient(t, store)
+	seeds := []struct{ student, subject, exam, status string }{
+		{"student-1", "PHYSICS", "JEE_MAIN", "COMPLETED"},
+		{"student-2", "CHEMISTRY", "NEET", "COMPLETED"},
+		{"student-1", "PHYSICS", "JEE_MAIN", "FAILED"},
+		{"student-2", "CHEMISTRY", "NEET", "COMPLETED"},
+		{"student-1", "PHYSICS", "JEE_MAIN", "COMPLETED"},
+	}
+	for i, seed := range seeds {
+		err := client.CreateGenerationLog(context.Background(), &db.GenerationLog{
+			QuestionID:            fmt.Sprintf("q_seed-%d", i),
+			StudentID:             seed.student,
+			TopicID:               "TOPIC",
+			Subject:               seed.subject,
+			ExamType:              seed.exam,
+			Format:                "MCQ",
+			Status:                seed.status,
+			GeneratedQuestionText: fmt.Sprintf("Seeded question %d", i),
+			GeneratedOptions:      db.StringMap{"A": "yes", "B": "no"},
+			CorrectAnswer:         "A",
+		})
+		if err != nil {
+			t.Fatalf("seed log %d: %v", i, err)
+		}
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for i, row := range store.logRows[len(store.logRows)-len(seeds):] {
+		row[18] = logSeedTime.Add(-time.Duration(i) * time.Minute)
+	}
+}
+
+func TestQueryGenerationLogsFiltersAndPages(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	seedGenerationLogs(t, store)
+	client := newFakeDBClient(t, store)
+
+	questionIDs := func(page *db.GenerationLogPage) string {
+		var ids []string
+		for _, l := range page.Logs {
+			ids = append(ids, l.QuestionID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	first, err := client.QueryGenerationLogs(ctx, db.GenerationLogFilters{StudentID: "student-1", Limit: 2})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if got := questionIDs(first); got != "q_seed-0,q_seed-2" || first.NextCursor == "" {
+		t.Fatalf("expected the two newest student-1 logs and a cursor, got %s %q", got, first.NextCursor)
+	}
+	if first.Logs[0].GeneratedQuestionText != "" || first.Logs[0].CorrectAnswer != "" {
+		t.Errorf("expected no question text without verbose, got %+v", first.Logs[0])
+	}
+	second, err := client.QueryGenerationLogs(ctx, db.GenerationLogFilters{StudentID: "student-1", Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("query second page failed: %v", err)
+	}
+	if got := questionIDs(second); got != "q_seed-4" || second.NextCursor != "" {
+		t.Fatalf("expected the last student-1 log and no cursor, got %s %q", got, second.NextCursor)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		filters db.GenerationLogFilters
+		want    string
+	}{
+		{"status", db.GenerationLogFilters{Status: "FAILED"}, "q_seed-2"},
+		{"subject and exam", db.GenerationLogFilters{Subject: "CHEMISTRY", ExamType: "NEET"}, "q_seed-1,q_seed-3"},
+		{"time range", db.GenerationLogFilters{Since: logSeedTime.Add(-3 * time.Minute), Until: logSeedTime}, "q_seed-1,q_seed-2,q_seed-3"},
+		{"no match", db.GenerationLogFilters{StudentID: "student-9"}, ""},
+	} {
+		page, err := client.QueryGenerationLogs(ctx, tt.filters)
+		if err != nil {
+			t.Fatalf("%s: query failed: %v", tt.name, err)
+		}
+		if got := questionIDs(page); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+
+	verbose, err := client.QueryGenerationLogs(ctx, db.GenerationLogFilters{Status: "FAILED", Verbose: true})
+	if err != nil || len(verbose.Logs) != 1 {
+		t.Fatalf("verbose query failed: %+v, %v", verbose, err)
+	}
+	if l := verbose.Logs[0]; l.GeneratedQuestionText != "Seeded question 2" || l.CorrectAnswer != "A" || l.GeneratedOptions["B"] != "no" {
+		t.Errorf("expected the generated question in a verbose query, got %+v", l)
+	}
+
+	if _, err := client.QueryGenerationLogs(ctx, db.GenerationLogFilters{Cursor: "not-a-cursor"}); !errors.Is(err, db.ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+// seedQualityTrends stores finished generation logs in the buckets 3h and 1h
+// before base, one 30h before it and a PENDING one that trends ignore. The
+// 3h bucket averages a quality of 0.7, half passed validation and half
+// were regenerated, at 2000ms.
+func seedQualityTrends(t *testing.T, store *recordingDB, base time.Time) {
+	t.Helper()
+	client := newFakeDBClient(t, store)
+	seeds := []struct {
+		age         time.Duration
+		status      string
+		quality     float64
+		passed      bool
+		regenerated bool
+		ms          int
+	}{
+		{3*time.Hour - 10*time.Minute, "COMPLETED", 0.8, true, false, 1000},
+		{3*time.Hour - 20*time.Minute, "FAILED", 0.6, false, true, 3000},
+		{time.Hour - 5*time.Minute, "COMPLETED", 0.9, true, false, 500},
+		{time.Hour - 15*time.Minute, "PENDING", 0.1, false, false, 9000},
+		{30 * time.Hour, "COMPLETED", 0.5, true, false, 700},
+	}
+	for i, seed := range seeds {
+		quality := seed.quality
+		err := client.CreateGenerationLog(context.Background(), &db.GenerationLog{
+			StudentID:             "student-1",
+			TopicID:               "TOPIC",
+			Subject:               "PHYSICS",
+			ExamType:              "JEE_MAIN",
+			Format:                "MCQ",
+			Status:                seed.status,
+			FinalQualityScore:     &quality,
+			ValidationPassed:      seed.passed,
+			RegenerationTriggered: seed.regenerated,
+			TotalPipelineTimeMs:   seed.ms,
+		})
+		if err != nil {
+			t.Fatalf("seed log %d: %v", i, err)
+		}
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for i, row := range store.logRows[len(store.logRows)-len(seeds):] {
+		row[18] = base.Add(-seeds[i].age)
+	}
+}
+
+func TestGetQualityTrendsBucketsFinishedLogs(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	base := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	seedQualityTrends(t, store, base)
+	client := newFakeDBClient(t, store)
+
+	until := base.Add(30 * time.Minute)
+	trends, err := client.GetQualityTrends(ctx, db.QualityTrendFilters{Since: until.Add(-24 * time.Hour), Until: until, Bucket: db.TrendBucketHour})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(trends) != 25 || !trends[0].Start.Equal(base.Add(-24*time.Hour)) || !trends[24].Start.Equal(base) {
+		t.Fatalf("expected 25 hourly buckets ending at %v, got %d: %+v", base, len(trends), trends)
+	}
+
+	near := func(got *float64, want float64) bool { return got != nil && math.Abs(*got-want) < 1e-9 }
+	busy := trends[21]
+	if !busy.Start.Equal(base.Add(-3*time.Hour)) || busy.Generations != 2 || !near(busy.AvgQualityScore, 0.7) ||
+		!near(busy.ValidationPassRate, 0.5) || !near(busy.RegenerationRate, 0.5) || !near(busy.AvgLatencyMs, 2000) {
+		t.Errorf("unexpected bucket 3h back: %+v", busy)
+	}
+	if quiet := trends[22]; quiet.Generations != 0 || quiet.AvgQualityScore != nil || quiet.ValidationPassRate != nil {
+		t.Errorf("expected an empty bucket 2h back, got %+v", quiet)
+	}
+	if last := trends[23]; last.Generations != 1 || !near(last.AvgQualityScore, 0.9) || !near(last.ValidationPassRate, 1) {
+		t.Errorf("expected only the finished log 1h back, got %+v", last)
+	}
+
+	daily, err := client.GetQualityTrends(ctx, db.QualityTrendFilters{Since: until.Add(-48 * time.Hour), Until: until, Bucket: db.TrendBucketDay})
+	if err != nil {
+		t.Fatalf("daily query failed: %v", err)
+	}
+	total := 0
+	for _, bucket := range daily {
+		total += bucket.Generations
+	}
+	if len(daily) != 3 || total != 4 {
+		t.Errorf("expected 3 daily buckets over 4 finished logs, got %d over %d: %+v", len(daily), total, daily)
+	}
+
+	if _, err := client.GetQualityTrends(ctx, db.QualityTrendFilters{Since: base, Until: until, Bucket: "week"}); err == nil {
+		t.Error("expected an unsupported bucket to fail")
+	}
+}
+
+// Template IDs stored by seedSearchTemplates, in template ID order
+const (
+	molesTemplateID        = "2b7e1c40-5d3a-4f86-9c21-7a0e4b3d5f18"
+	brakingTemplateID      = "6a1d3f20-8b4c-4e57-a9d2-1c3e5f7a9b01"
+	throwTemplateID        = "6a1d3f20-8b4c-4e57-a9d2-1c3e5f7a9b02"
+	accelerationTemplateID = "6a1d3f20-8b4c-4e57-a9d2-1c3e5f7a9b03"
+)
+
+// seedSearchTemplates stores three active templates and an inactive one
+// for the template search tests
+func seedSearchTemplates(t *testing.T, store *recordingDB) {
+	t.Helper()
+	ncert := "NCERT Class 11 Physics, Ch. 3"
+	for _, seed := range []struct {
+		id, subject, exam, chapter, text string
+		bloom                            int
+		difficulty                       float64
+	}{
+		{molesTemplateID, "CHEMISTRY", "NEET", "Mole Concept", "How many moles are in {{m}} g of water?", 2, 0.4},
+		{brakingTemplateID, "PHYSICS", "JEE_MAIN", "Kinematics", "A car moving at {{v0}} m/s brakes to rest. Find the stopping distance.", 3, 0.5},
+		{throwTemplateID, "PHYSICS", "JEE_MAIN", "Kinematics", "A ball is thrown upward at {{v0}} m/s. Find its maximum height.", 2, 0.3},
+		{accelerationTemplateID, "PHYSICS", "JEE_MAIN", "Kinematics", "A CAR accelerates from rest at {{a}} m/s^2. Find its speed after {{t}} s.", 3, 0.7},
+	} {
+		qt := storedTemplate()
+		qt.TemplateID, qt.Subject, qt.ExamType, qt.Chapter, qt.TemplateText = seed.id, seed.subject, seed.exam, seed.chapter, seed.text
+		qt.BloomLevel, qt.BaseDifficulty = seed.bloom, seed.difficulty
+		if seed.subject == "PHYSICS" {
+			qt.NCERTReference = &ncert
+		} else {
+			qt.TopicID = "CHEM_MOLE_CONCEPT"
+		}
+		store.addTemplate(qt)
+	}
+	if err := newFakeDBClient(t, store).DeactivateTemplate(context.Background(), accelerationTemplateID); err != nil {
+		t.Fatalf("deactivate failed: %v", err)
+	}
+}
+
+func TestSearchTemplatesFiltersAndPages(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	seedSearchTemplates(t, store)
+	client := newFakeDBClient(t, store)
+
+	templateIDs := func(page *db.TemplatePage) string {
+		var ids []string
+		for _, qt := range page.Templates {
+			ids = append(ids, qt.TemplateID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	first, err := client.SearchTemplates(ctx, db.TemplateSearch{Chapter: "Kinematics", Limit: 2})
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if got := templateIDs(first); got != brakingTemplateID+","+throwTemplateID || first.NextCursor == "" {
+		t.Fatalf("expected the first two Kinematics templates and a cursor, got %s %q", got, first.NextCursor)
+	}
+	if qt := first.Templates[0]; qt.NCERTReference == nil || qt.BloomLevel != 3 || !qt.IsActive {
+		t.Errorf("expected the summary columns to be read, got %+v", qt)
+	}
+	second, err := client.SearchTemplates(ctx, db.TemplateSearch{Chapter: "Kinematics", Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("search second page failed: %v", err)
+	}
+	if got := templateIDs(second); got != accelerationTemplateID || second.NextCursor != "" || second.Templates[0].IsActive {
+		t.Fatalf("expected the inactive template last and no cursor, got %s %q", got, second.NextCursor)
+	}
+
+	active, inactive := true, false
+	for _, tt := range []struct {
+		name   string
+		search db.TemplateSearch
+		want   string
+	}{
+		{"free text ignores case", db.TemplateSearch{Text: "a car"}, brakingTemplateID + "," + accelerationTemplateID},
+		{"free text and active", db.TemplateSearch{Text: "a car", Active: &active}, brakingTemplateID},
+		{"inactive only", db.TemplateSearch{Active: &inactive}, accelerationTemplateID},
+		{"subject and exam", db.TemplateSearch{Subject: "CHEMISTRY", ExamType: "NEET"}, molesTemplateID},
+		{"bloom level", db.TemplateSearch{BloomLevel: 2}, molesTemplateID + "," + throwTemplateID},
+		{"difficulty range", db.TemplateSearch{MinDifficulty: 0.4, MaxDifficulty: 0.6}, molesTemplateID + "," + brakingTemplateID},
+		{"ncert ignores case", db.TemplateSearch{NCERT: "class 11 PHYSICS", Active: &active}, brakingTemplateID + "," + throwTemplateID},
+		{"no match", db.TemplateSearch{Text: "projectile"}, ""},
+	} {
+		page, err := client.SearchTemplates(ctx, tt.search)
+		if err != nil {
+			t.Fatalf("%s: search failed: %v", tt.name, err)
+		}
+		if got := templateIDs(page); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+
+	// A cursor must decode to a template ID, not merely to some bytes
+	for _, cursor := range []string{"!!", base64.RawURLEncoding.EncodeToString([]byte("phy_kin_001"))} {
+		if _, err := client.SearchTemplates(ctx, db.TemplateSearch{Cursor: cursor}); !errors.Is(err, db.ErrInvalidCursor) {
+			t.Fatalf("expected ErrInvalidCursor for %q, got %v", cursor, err)
+		}
+	}
+}
+
+func TestListTopicsAggregatesActiveTemplates(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	seedSearchTemplates(t, store)
+	client := newFakeDBClient(t, store)
+
+	topics, err := client.ListTopics(ctx, db.TopicFilters{})
+	if err != nil {
+		t.Fatalf("list topics failed: %v", err)
+	}
+	want := []db.TopicSummary{
+		{TopicID: "CHEM_MOLE_CONCEPT", Subject: "CHEMISTRY", TemplateCount: 1, MinDifficulty: 0.4, MaxDifficulty: 0.4},
+		// The acceleration template is inactive and does not widen the range
+		{TopicID: "PHY_KINEMATICS", Subject: "PHYSICS", TemplateCount: 2, MinDifficulty: 0.3, MaxDifficulty: 0.5},
+	}
+	if !reflect.DeepEqual(topics, want) {
+		t.Fatalf("expected %+v, got %+v", want, topics)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		filters db.TopicFilters
+		want    int
+	}{
+		{"subject", db.TopicFilters{Subject: "PHYSICS"}, 1},
+		{"subject and exam", db.TopicFilters{Subject: "PHYSICS", ExamType: "JEE_MAIN"}, 1},
+		{"exam without topics", db.TopicFilters{ExamType: "JEE_ADVANCED"}, 0},
+	} {
+		topics, err := client.ListTopics(ctx, tt.filters)
+		if err != nil {
+			t.Fatalf("%s: list topics failed: %v", tt.name, err)
+		}
+		if len(topics) != tt.want {
+			t.Errorf("%s: expected %d topics, got %+v", tt.name, tt.want, topics)
+		}
+	}
+}
+
+func TestRecomputeTemplateStatsFromAnswers(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	seedSearchTemplates(t, store)
+	client := newFakeDBClient(t, store)
+
+	for _, a := range []db.AnswerSubmission{
+		{QuestionID: "q1", TemplateID: brakingTemplateID, StudentID: "student-1", IsCorrect: true, ResponseTimeMs: 30000},
+		{QuestionID: "q2", TemplateID: brakingTemplateID, StudentID: "student-2", IsCorrect: true},
+		{QuestionID: "q3", TemplateID: brakingTemplateID, StudentID: "student-3", IsCorrect: false, PartialCredit: 0.5, ResponseTimeMs: 61000},
+		{QuestionID: "q4", TemplateID: brakingTemplateID, StudentID: "student-4", IsCorrect: false, ResponseTimeMs: 45000},
+		{QuestionID: "q5", TemplateID: molesTemplateID, StudentID: "student-1", IsCorrect: true, ResponseTimeMs: 10000},
+	} {
+		if err := client.SaveAnswerSubmission(ctx, &a); err != nil {
+			t.Fatalf("failed to seed answer: %v", err)
+		}
+		if a.ID == 0 || a.SubmittedAt.IsZero() {
+			t.Fatalf("save did not write back the ID and submission time: %+v", a)
+		}
+	}
+
+	stats, err := client.RecomputeTemplateStats(ctx, brakingTemplateID)
+	if err != nil {
+		t.Fatalf("recompute failed: %v", err)
+	}
+	// Partial credit is not success, and untimed answers are left out of the
+	// average: (30 + 61 + 45) / 3 s
+	if stats.Answers != 4 || stats.SuccessRate == nil || *stats.SuccessRate != 0.5 || stats.AvgSolveTime == nil || *stats.AvgSolveTime != 45 {
+		t.Fatalf("expected 4 answers, a 0.5 success rate and 45s solve time, got %+v", stats)
+	}
+	stored, err := client.GetQuestionTemplate(ctx, brakingTemplateID)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if stored.SuccessRate == nil || *stored.SuccessRate != 0.5 || stored.AvgSolveTime == nil || *stored.AvgSolveTime != 45 {
+		t.Fatalf("expected the stats to be stored on the template, got %v %v", stored.SuccessRate, stored.AvgSolveTime)
+	}
+
+	before := len(store.recorded())
+	all, err := client.RecomputeAllTemplateStats(ctx)
+	if err != nil {
+		t.Fatalf("bulk recompute failed: %v", err)
+	}
+	if statements := store.recorded()[before:]; len(statements) != 1 || !strings.Contains(statements[0], "GROUP BY") {
+		t.Fatalf("expected every template to be recomputed in one statement, got %q", statements)
+	}
+	if len(all) != 4 {
+		t.Fatalf("expected stats for all 4 templates, inactive included, got %d", len(all))
+	}
+	if chem := all[0]; chem.TemplateID != molesTemplateID || *chem.SuccessRate != 1 || *chem.AvgSolveTime != 10 {
+		t.Errorf("unexpected moles template stats: %+v", chem)
+	}
+	if unanswered := all[2]; unanswered.Answers != 0 || unanswered.SuccessRate != nil || unanswered.AvgSolveTime != nil {
+		t.Errorf("expected no stats for a template without answers, got %+v", unanswered)
+	}
+
+	if _, err := client.RecomputeTemplateStats(ctx, "missing"); !errors.Is(err, db.ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+// refusingConnector refuses the first refuse connections, then hands out
+// connections to the wrapped store
+type refusingConnector struct {
+	*recordingDB
+	refuse   int32
+	attempts atomic.Int32
+}
+
+func (c *refusingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if c.attempts.Add(1) <= c.refuse {
+		return nil, errors.New("connection refused")
+	}
+	return c.recordingDB.Connect(ctx)
+}
+
+func retryConfig(retries int) config.DatabaseConfig {
+	return config.DatabaseConfig{
+		MaxOpenConns:      2,
+		MaxIdleConns:      1,
+		ConnectRetries:    retries,
+		ConnectRetryDelay: time.Millisecond,
+	}
+}
+
+func TestNewClientRetriesUntilDatabaseAccepts(t *testing.T) {
+	connector := &refusingConnector{recordingDB: newRecordingDB(), refuse: 3}
+	opens := 0
+	client, err := db.NewClientWithOpener(context.Background(), retryConfig(5), func() (*sql.DB, error) {
+		opens++
+		return sql.OpenDB(connector), nil
+	})
+	if err != nil {
+		t.Fatalf("expected connection after retries, got %v", err)
+	}
+	defer client.Close()
+
+	if got := connector.attempts.Load(); got != 4 {
+		t.Errorf("expected 4 connection attempts, got %d", got)
+	}
+	if opens != 4 {
+		t.Errorf("expected the pool to be reopened for each attempt, got %d opens", opens)
+	}
+}
+
+func TestNewClientStartsAgainstAnUnmigratedSchema(t *testing.T) {
+	// stage_overrides arrives with migration 25, used by the log INSERT
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	store.setMissingColumns("stage_overrides")
+	client, err := db.NewClientWithOpener(context.Background(), retryConfig(0), func() (*sql.DB, error) {
+		return sql.OpenDB(store), nil
+	})
+	if err != nil {
+		t.Fatalf("expected to connect before migrations have run, got %v", err)
+	}
+	defer client.Close()
+
+	if err := client.PrepareStatements(context.Background()); err == nil {
+		t.Fatal("expected preparing against the old schema to fail")
+	}
+	if _, err := client.GetQuestionTemplate(context.Background(), kinematicsTemplateID); err != nil {
+		t.Fatalf("expected queries to run unprepared, got %v", err)
+	}
+
+	// Once migrated, the statements prepare
+	store.setMissingColumns()
+	before := len(store.preparedStatements())
+	if err := client.PrepareStatements(context.Background()); err != nil {
+		t.Fatalf("expected the migrated schema to prepare, got %v", err)
+	}
+	if prepared := len(store.preparedStatements()) - before; prepared != 3 {
+		t.Errorf("expected the 3 static queries prepared, got %d", prepared)
+	}
+}
+
+func TestNewClientGivesUpAfterRetries(t *testing.T) {
+	connector := &refusingConnector{recordingDB: newRecordingDB(), refuse: 10}
+	_, err := db.NewClientWithOpener(context.Background(), retryConfig(2), func() (*sql.DB, error) {
+		return sql.OpenDB(connector), nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Fatalf("expected failure after 3 attempts, got %v", err)
+	}
+	if got := connector.attempts.Load(); got != 3 {
+		t.Errorf("expected 3 connection attempts, got %d", got)
+	}
+}
+
+func TestNewClientRespectsContextDeadline(t *testing.T) {
+	connector := &refusingConnector{recordingDB: newRecordingDB(), refuse: 1000}
+	cfg := retryConfig(1000)
+	cfg.ConnectRetryDelay = 20 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := db.NewClientWithOpener(ctx, cfg, func() (*sql.DB, error) {
+		return sql.OpenDB(connector), nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected to give up near the deadline, took %s", elapsed)
+	}
+}
+
+func TestValidateAllTemplatesReportsBrokenTemplates(t *testing.T) {
+	store := newRecordingDB()
+	template := func(id, text, slots string) *db.QuestionTemplate {
+		return &db.QuestionTemplate{TemplateID: id, TemplateText: text, VariableSlots: slots}
+	}
+	store.addTemplate(previewTemplate())
+	store.addTemplate(template("good_computed", "Add {{x}} and {{y}}.", `[
+		{"name": "x", "type": "integer", "range": {"min": 1, "max": 9}},
+		{"name": "y", "type": "integer", "range": {"min": 1, "max": 9}},
+		{"name": "sum", "type": "computed", "formula": "{{x}} + {{y}}"}
+	]`))
+	store.addTemplate(template("no_slots", "Which of these is a vector quantity?", ""))
+	store.addTemplate(template("malformed_slots", "Find {{x}}.", `[{"name": "x", "type": "integer"`))
+	store.addTemplate(template("unknown_placeholder", "A body moves at {{v0}} m/s for {{time}} s.", `[
+		{"name": "v0", "type": "integer", "range": {"min": 1, "max": 9}}
+	]`))
+	store.addTemplate(template("broken_formula", "Find {{total}}.", `[
+		{"name": "total", "type": "computed", "formula": "{{x}} + {{y}}"},
+		{"name": "x", "type": "integer", "range": {"min": 1, "max": 9}},
+		{"name": "empty", "type": "computed"}
+	]`))
+
+	inactive := template("inactive_broken", "Find {{missing}}.", "[]")
+	store.addTemplate(inactive)
+	store.templates["inactive_broken"].IsActive = false
+
+	problems, err := newFakeDBClient(t, store).ValidateAllTemplates(context.Background())
+	if err != nil {
+		t.Fatalf("validate templates: %v", err)
+	}
+
+	got := make(map[string]string, len(problems))
+	var ids []string
+	for _, p := range problems {
+		got[p.TemplateID] = strings.Join(p.Reasons, "; ")
+		ids = append(ids, p.TemplateID)
+	}
+	if want := []string{"broken_formula", "malformed_slots", "unknown_placeholder"}; strings.Join(ids, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected problems with %v, got %v", want, problems)
+	}
+	for id, want := range map[string][]string{
+		"malformed_slots":     {"variable_slots is not a JSON array"},
+		"unknown_placeholder": {"placeholder {{time}} has no variable slot"},
+		"broken_formula": {
+			"total refers to undefined variable y",
+			"total refers to x before it is generated",
+			"computed variable empty has no formula",
+		},
+	} {
+		for _, reason := range want {
+			if !strings.Contains(got[id], reason) {
+				t.Errorf("expected %s to report %q, got %q", id, reason, got[id])
+			}
+		}
+	}
+	if strings.Contains(got["unknown_placeholder"], "v0") {
+		t.Errorf("expected the declared v0 placeholder to pass, got %q", got["unknown_placeholder"])
+	}
+}
@@ -0,0 +1,1192 @@
+package test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"question-generator-service/internal/db"
+)
+
+// templateColumns is the column order of db.Client.GetQuestionTemplate
+var templateColumns = []string{
+	"template_id", "topic_id", "exam_type", "subject", "format", "template_text", "template_text_hi",
+	"variable_slots", "options_template", "options_template_hi", "answer_unit", "answer_formula", "numerical_tolerance", "answer_precision", "render_format", "base_difficulty", "bloom_level",
+	"concept_depth", "validation_score", "ambiguity_flag", "clarity_score",
+	"chapter", "sub_chapter", "ncert_reference", "usage_count", "success_rate",
+	"avg_solve_time", "created_at", "updated_at", "is_active", "version",
+}
+
+// recordingDB is an in-memory database/sql backend that understands the
+// question_templates statements of db.Client and records every statement it
+// is asked to run. Transactions are accepted but not isolated.
+type recordingDB struct {
+	mu         sync.Mutex
+	statements []string
+	templates  map[string]*db.QuestionTemplate
+	questions  map[string][]driver.Value // generated_questions rows in SELECT column order
+	logUpdates [][]driver.Value          // arguments of each question_generation_logs UPDATE
+	logs       map[string][]driver.Value // question_generation_logs rows by question_id, in SELECT column order
+	logRows    [][]driver.Value          // every question_generation_logs row, followed by logDetailColumns, validation_passed and regeneration_triggered
+	retries    map[int64][]driver.Value  // next_attempt_at, retry_request and retry_attempts of RETRY_PENDING generation logs, by id
+	prepared   []*recordingStmt
+	nextID     int
+	filterErrs []error // Returned, in turn, by the next template filter queries
+	answers    []*db.AnswerSubmission
+	flags      []*db.FlaggedQuestion
+	// missingColumns fail statements naming them, as on a schema that is
+	// not yet migrated
+	missingColumns []string
+}
+
+// fakeServerVersion is the version recordingDB reports for SHOW server_version
+const fakeServerVersion = "15.4 (fake)"
+
+func newRecordingDB() *recordingDB {
+	return &recordingDB{
+		templates: make(map[string]*db.QuestionTemplate),
+		questions: make(map[string][]driver.Value),
+		logs:      make(map[string][]driver.Value),
+		retries:   make(map[int64][]driver.Value),
+	}
+}
+
+// addTemplate stores qt as an active template
+func (r *recordingDB) addTemplate(qt *db.QuestionTemplate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *qt
+	stored.IsActive = true
+	if stored.Version == 0 {
+		stored.Version = 1
+	}
+	r.templates[qt.TemplateID] = &stored
+}
+
+// template returns the stored row for id, including inactive ones
+func (r *recordingDB) template(id string) (*db.QuestionTemplate, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	qt, ok := r.templates[id]
+	return qt, ok
+}
+
+// record stores statement with its whitespace collapsed and returns it
+func (r *recordingDB) record(statement string) string {
+	statement = strings.Join(strings.Fields(statement), " ")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = append(r.statements, statement)
+	return statement
+}
+
+// generationLogUpdates returns the arguments of every generation log UPDATE
+func (r *recordingDB) generationLogUpdates() [][]driver.Value {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]driver.Value(nil), r.logUpdates...)
+}
+
+// setMissingColumns makes statements naming columns fail to prepare, until
+// called again without them
+func (r *recordingDB) setMissingColumns(columns ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.missingColumns = columns
+}
+
+// failTemplateFilters makes the next template filter queries fail with errs,
+// one error per query
+func (r *recordingDB) failTemplateFilters(errs ...error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.filterErrs = append(r.filterErrs, errs...)
+}
+
+// preparedStatements returns every statement prepared so far
+func (r *recordingDB) preparedStatements() []*recordingStmt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*recordingStmt(nil), r.prepared...)
+}
+
+func (r *recordingDB) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.statements...)
+}
+
+func (r *recordingDB) Connect(context.Context) (driver.Conn, error) { return &recordingConn{r}, nil }
+func (r *recordingDB) Driver() driver.Driver                        { return recordingDriver{} }
+
+type recordingDriver struct{}
+
+func (recordingDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("recording driver must be opened through its connector")
+}
+
+type recordingConn struct{ db *recordingDB }
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	c.db.record("PREPARE " + query)
+	stmt := &recordingStmt{conn: c, query: query}
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for _, column := range c.db.missingColumns {
+		if strings.Contains(query, column) {
+			return nil, &pq.Error{Code: "42703", Message: fmt.Sprintf("column %q does not exist", column)}
+		}
+	}
+	c.db.prepared = append(c.db.prepared, stmt)
+	return stmt, nil
+}
+
+// recordingStmt runs a prepared query through its connection, which records
+// it again on every execution
+type recordingStmt struct {
+	conn   *recordingConn
+	query  string
+	closed atomic.Bool
+}
+
+func (s *recordingStmt) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+func (s *recordingStmt) NumInput() int { return -1 }
+
+func (s *recordingStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("recording statements only run with a context")
+}
+
+func (s *recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("recording statements only run with a context")
+}
+
+func (s *recordingStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *recordingStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func (c *recordingConn) Close() error { return nil }
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	c.db.record("BEGIN")
+	return recordingTx{db: c.db}, nil
+}
+
+// recordingTx applies statements as they run, so Rollback undoes nothing;
+// it only records how the transaction ended
+type recordingTx struct{ db *recordingDB }
+
+func (tx recordingTx) Commit() error {
+	tx.db.record("COMMIT")
+	return nil
+}
+
+func (tx recordingTx) Rollback() error {
+	tx.db.record("ROLLBACK")
+	return nil
+}
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	query = c.db.record(query)
+	if strings.Contains(query, "SET status = 'RETRY_PENDING'") {
+		c.db.mu.Lock()
+		defer c.db.mu.Unlock()
+		return c.db.scheduleRetry(args), nil
+	}
+	if strings.Contains(query, "AND status = 'RETRY_PENDING' AND next_attempt_at = $2") {
+		c.db.mu.Lock()
+		defer c.db.mu.Unlock()
+		return c.db.claimRetry(args), nil
+	}
+	if strings.Contains(query, "UPDATE question_generation_logs") {
+		c.db.mu.Lock()
+		defer c.db.mu.Unlock()
+		values := make([]driver.Value, len(args))
+		for i, arg := range args {
+			values[i] = arg.Value
+		}
+		c.db.logUpdates = append(c.db.logUpdates, values)
+		c.db.updateGenerationLog(values)
+		return driver.RowsAffected(1), nil
+	}
+	if strings.Contains(query, "SET usage_count = usage_count + 1") {
+		c.db.mu.Lock()
+		defer c.db.mu.Unlock()
+		qt, ok := c.db.templates[stringArg(args, 0)]
+		if !ok {
+			return driver.RowsAffected(0), nil
+		}
+		qt.UsageCount++
+	}
+	if strings.Contains(query, "SET is_active = false") {
+		c.db.mu.Lock()
+		defer c.db.mu.Unlock()
+		qt, ok := c.db.templates[stringArg(args, 0)]
+		if !ok || !qt.IsActive {
+			return driver.RowsAffected(0), nil
+		}
+		qt.IsActive = false
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	query = c.db.record(query)
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	switch {
+	case strings.Contains(query, "SHOW server_version"):
+		return &recordingRows{columns: []string{"server_version"}, values: [][]driver.Value{{fakeServerVersion}}}, nil
+	case strings.Contains(query, "INSERT INTO question_templates"):
+		return c.db.insertTemplate(args)
+	case strings.Contains(query, "UPDATE question_templates") && strings.Contains(query, "SET topic_id"):
+		return c.db.updateTemplate(args), nil
+	case strings.Contains(query, "INSERT INTO generated_questions"):
+		return c.db.insertQuestion(args), nil
+	case strings.Contains(query, "FROM generated_questions WHERE question_id = $1"):
+		rows := &recordingRows{columns: questionColumns}
+		if row, ok := c.db.questions[stringArg(args, 0)]; ok {
+			rows.values = [][]driver.Value{row}
+		}
+		return rows, nil
+	case strings.Contains(query, "FROM generated_questions WHERE student_id = $1"):
+		return c.db.findSimilarQuestions(args), nil
+	case strings.Contains(query, "INSERT INTO question_generation_logs"):
+		return c.db.insertGenerationLog(args), nil
+	case strings.Contains(query, "FROM question_generation_logs WHERE question_id = $1"):
+		rows := &recordingRows{columns: generationLogColumns}
+		if row, ok := c.db.logs[stringArg(args, 0)]; ok {
+			rows.values = [][]driver.Value{row}
+		}
+		return rows, nil
+	case strings.Contains(query, "FROM question_generation_logs WHERE request_id = $1 AND status = 'COMPLETED'"):
+		rows := &recordingRows{columns: generationLogColumns}
+		for _, row := range c.db.logs {
+			if row[4] == stringArg(args, 0) && row[15] == "COMPLETED" {
+				rows.values = [][]driver.Value{row}
+			}
+		}
+		return rows, nil
+	case strings.Contains(query, "WHERE status = 'RETRY_PENDING' ORDER BY next_attempt_at"):
+		return c.db.pendingRetries(), nil
+	case strings.Contains(query, "WHERE request_id = $1 AND status = 'RETRY_PENDING'"):
+		rows := &recordingRows{columns: []string{"next_attempt_at"}}
+		for _, row := range c.db.logRows {
+			if row[4] == stringArg(args, 0) && row[15] == "RETRY_PENDING" {
+				rows.values = [][]driver.Value{{c.db.retries[row[0].(int64)][0]}}
+			}
+		}
+		return rows, nil
+	case strings.Contains(query, "date_trunc($1, created_at AT TIME ZONE 'UTC')"):
+		return c.db.qualityTrends(args), nil
+	case strings.Contains(query, "FROM question_generation_logs WHERE true"):
+		return c.db.queryGenerationLogs(query, args), nil
+	case strings.Contains(query, "INSERT INTO flagged_questions"):
+		return c.db.insertFlag(args), nil
+	case strings.Contains(query, "UPDATE flagged_questions"):
+		return c.db.resolveFlag(args), nil
+	case strings.Contains(query, "FROM flagged_questions WHERE id > $1"):
+		return c.db.queryFlags(query, args), nil
+	case strings.Contains(query, "SELECT status FROM flagged_questions WHERE id = $1"):
+		rows := &recordingRows{columns: []string{"status"}}
+		if f := c.db.flag(args[0].Value.(int64)); f != nil {
+			rows.values = [][]driver.Value{{f.Status}}
+		}
+		return rows, nil
+	case strings.Contains(query, "INSERT INTO answer_submissions"):
+		return c.db.insertAnswer(args), nil
+	case strings.Contains(query, "SET success_rate = stats.success_rate"):
+		return c.db.recomputeTemplateStats(query, args), nil
+	case strings.Contains(query, "FROM question_templates WHERE true"):
+		return c.db.searchTemplates(query, args), nil
+	case strings.Contains(query, "GROUP BY subject, topic_id"):
+		return c.db.listTopics(query, args), nil
+	case strings.Contains(query, "FROM question_templates WHERE is_active = true"):
+		if len(c.db.filterErrs) > 0 {
+			err := c.db.filterErrs[0]
+			c.db.filterErrs = c.db.filterErrs[1:]
+			return nil, err
+		}
+		return c.db.filterTemplates(query, args), nil
+	case strings.Contains(query, "FROM question_templates WHERE template_id = $1"):
+		rows := &recordingRows{columns: templateColumns}
+		if qt, ok := c.db.templates[stringArg(args, 0)]; ok && qt.IsActive {
+			rows.values = [][]driver.Value{templateRow(qt)}
+		}
+		return rows, nil
+	}
+	return &recordingRows{}, nil
+}
+
+// recomputeTemplateStats mimics db.Client's single-statement stats UPDATE,
+// narrowed to one template when the query filters on template_id
+func (r *recordingDB) recomputeTemplateStats(query string, args []driver.NamedValue) driver.Rows {
+	rows := &recordingRows{columns: []string{"template_id", "answers", "success_rate", "avg_solve_time"}}
+	for _, id := range sortedTemplateIDs(r.templates) {
+		if strings.Contains(query, "WHERE t.template_id = $1") && id != stringArg(args, 0) {
+			continue
+		}
+		var answers, correct, timed int64
+		var totalTimeMs int64
+		for _, a := range r.answers {
+			if a.TemplateID != id {
+				continue
+			}
+			answers++
+			if a.IsCorrect {
+				correct++
+			}
+			if a.ResponseTimeMs > 0 {
+				timed++
+				totalTimeMs += a.ResponseTimeMs
+			}
+		}
+
+		qt := r.templates[id]
+		qt.SuccessRate, qt.AvgSolveTime = nil, nil
+		var successRate, avgSolveTime driver.Value
+		if answers > 0 {
+			rate := math.Round(float64(correct)/float64(answers)*1000) / 1000
+			qt.SuccessRate, successRate = &rate, rate
+		}
+		if timed > 0 {
+			seconds := int64(math.Round(float64(totalTimeMs) / float64(timed) / 1000))
+			qt.AvgSolveTime, avgSolveTime = &seconds, seconds
+		}
+		// Postgres returns rows in no particular order
+		rows.values = append([][]driver.Value{{id, answers, successRate, avgSolveTime}}, rows.values...)
+	}
+	return rows
+}
+
+// insertTemplate mimics db.Client.CreateTemplate's INSERT ... RETURNING
+func (r *recordingDB) insertTemplate(args []driver.NamedValue) (driver.Rows, error) {
+	qt := templateFromArgs(args)
+	if qt.TemplateID == "" {
+		qt.TemplateID = uuid.NewString()
+	}
+	if _, exists := r.templates[qt.TemplateID]; exists {
+		return nil, &pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"}
+	}
+	if qt.RenderFormat == "" {
+		qt.RenderFormat = "PLAIN"
+	}
+	qt.CreatedAt, qt.UpdatedAt = time.Now(), time.Now()
+	qt.IsActive, qt.Version = true, 1
+	r.templates[qt.TemplateID] = qt
+
+	return &recordingRows{
+		columns: []string{"template_id", "render_format", "usage_count", "created_at", "updated_at", "is_active", "version"},
+		values: [][]driver.Value{{
+			qt.TemplateID, qt.RenderFormat, int64(qt.UsageCount), qt.CreatedAt, qt.UpdatedAt, qt.IsActive, int64(qt.Version),
+		}},
+	}, nil
+}
+
+// updateTemplate mimics db.Client.UpdateTemplate's UPDATE ... RETURNING
+func (r *recordingDB) updateTemplate(args []driver.NamedValue) driver.Rows {
+	rows := &recordingRows{columns: []string{"render_format", "usage_count", "created_at", "updated_at", "is_active", "version"}}
+	existing, ok := r.templates[stringArg(args, 0)]
+	if !ok || !existing.IsActive {
+		return rows
+	}
+
+	qt := templateFromArgs(args)
+	if qt.RenderFormat == "" {
+		qt.RenderFormat = "PLAIN"
+	}
+	qt.UsageCount, qt.CreatedAt, qt.UpdatedAt = existing.UsageCount, existing.CreatedAt, time.Now()
+	qt.IsActive, qt.Version = true, existing.Version+1
+	r.templates[qt.TemplateID] = qt
+
+	rows.values = [][]driver.Value{{
+		qt.RenderFormat, int64(qt.UsageCount), qt.CreatedAt, qt.UpdatedAt, qt.IsActive, int64(qt.Version),
+	}}
+	return rows
+}
+
+// filterColumns is the column order of db.Client.GetTemplatesByFilters
+var filterColumns = []string{
+	"template_id", "topic_id", "exam_type", "subject", "format", "template_text", "template_text_hi",
+	"variable_slots", "options_template", "options_template_hi", "answer_unit", "answer_formula", "answer_precision", "render_format", "base_difficulty", "bloom_level", "concept_depth",
+	"chapter", "validation_score", "usage_count", "success_rate",
+}
+
+// filterClause matches the "column op $n" conditions GetTemplatesByFilters
+// appends to its WHERE clause
+var filterClause = regexp.MustCompile(`(\w+) (=|>=|<=) \$(\d+)`)
+
+// filterTemplates mimics db.Client.GetTemplatesByFilters, ordering by usage
+// count and then template ID
+func (r *recordingDB) filterTemplates(query string, args []driver.NamedValue) driver.Rows {
+	var matched []*db.QuestionTemplate
+	for _, qt := range r.templates {
+		if strings.Contains(query, "template_text_hi IS NOT NULL") && qt.TemplateTextHi == nil {
+			continue
+		}
+		if qt.IsActive && matchesFilters(qt, query, args) {
+			matched = append(matched, qt)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].UsageCount != matched[j].UsageCount {
+			return matched[i].UsageCount > matched[j].UsageCount
+		}
+		return matched[i].TemplateID < matched[j].TemplateID
+	})
+	if m := logLimit.FindStringSubmatch(query); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if limit, ok := args[n-1].Value.(int64); ok && int(limit) < len(matched) {
+			matched = matched[:limit]
+		}
+	}
+
+	rows := &recordingRows{columns: filterColumns}
+	for _, qt := range matched {
+		rows.values = append(rows.values, []driver.Value{
+			qt.TemplateID, qt.TopicID, qt.ExamType, qt.Subject, qt.Format, qt.TemplateText, nullableString(qt.TemplateTextHi),
+			qt.VariableSlots, nullableString(qt.OptionsTemplate), nullableString(qt.OptionsTemplateHi), nullableString(qt.AnswerUnit), nullableString(qt.AnswerFormula), nullablePrecision(qt.AnswerPrecision), qt.RenderFormat, qt.BaseDifficulty, int64(qt.BloomLevel), int64(qt.ConceptDepth),
+			qt.Chapter, nil, int64(qt.UsageCount), nil,
+		})
+	}
+	return rows
+}
+
+func matchesFilters(qt *db.QuestionTemplate, query string, args []driver.NamedValue) bool {
+	for _, m := range filterClause.FindAllStringSubmatch(query, -1) {
+		var n int
+		fmt.Sscanf(m[3], "%d", &n)
+		arg := args[n-1].Value
+		switch m[1] {
+		case "topic_id":
+			if arg != qt.TopicID {
+				return false
+			}
+		case "exam_type":
+			if arg != qt.ExamType {
+				return false
+			}
+		case "subject":
+			if arg != qt.Subject {
+				return false
+			}
+		case "format":
+			if arg != qt.Format {
+				return false
+			}
+		case "base_difficulty":
+			bound, _ := arg.(float64)
+			if (m[2] == ">=" && qt.BaseDifficulty < bound) || (m[2] == "<=" && qt.BaseDifficulty > bound) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// listTopics mimics db.Client.ListTopics over the active templates
+func (r *recordingDB) listTopics(query string, args []driver.NamedValue) driver.Rows {
+	type topicKey struct{ subject, topic string }
+	type topicStats struct {
+		count    int64
+		min, max float64
+	}
+	stats := make(map[topicKey]*topicStats)
+	for _, qt := range r.templates {
+		keep := qt.IsActive
+		for _, m := range searchClause.FindAllStringSubmatch(query, -1) {
+			i, _ := strconv.Atoi(m[3])
+			switch value := args[i-1].Value; m[1] {
+			case "subject":
+				keep = keep && value == qt.Subject
+			case "exam_type":
+				keep = keep && value == qt.ExamType
+			}
+		}
+		if !keep {
+			continue
+		}
+		key := topicKey{qt.Subject, qt.TopicID}
+		s, ok := stats[key]
+		if !ok {
+			s = &topicStats{min: qt.BaseDifficulty, max: qt.BaseDifficulty}
+			stats[key] = s
+		}
+		s.count++
+		s.min = math.Min(s.min, qt.BaseDifficulty)
+		s.max = math.Max(s.max, qt.BaseDifficulty)
+	}
+
+	keys := make([]topicKey, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].subject != keys[j].subject {
+			return keys[i].subject < keys[j].subject
+		}
+		return keys[i].topic < keys[j].topic
+	})
+
+	rows := &recordingRows{columns: []string{"topic_id", "subject", "count", "min", "max"}}
+	for _, key := range keys {
+		s := stats[key]
+		rows.values = append(rows.values, []driver.Value{key.topic, key.subject, s.count, s.min, s.max})
+	}
+	return rows
+}
+
+// searchColumns is the column order of db.Client.SearchTemplates
+var searchColumns = []string{
+	"template_id", "topic_id", "exam_type", "subject", "format", "template_text",
+	"base_difficulty", "bloom_level", "chapter", "sub_chapter", "ncert_reference",
+	"usage_count", "is_active", "updated_at",
+}
+
+var searchClause = regexp.MustCompile(`(\w+) (=|>=|<=|>|ILIKE) \$(\d+)`)
+
+// searchTemplates mimics db.Client.SearchTemplates, ordered by template ID.
+// ILIKE patterns are matched as a case-insensitive substring between the
+// leading and trailing %.
+func (r *recordingDB) searchTemplates(query string, args []driver.NamedValue) driver.Rows {
+	argAt := func(n string) driver.Value {
+		i, _ := strconv.Atoi(n)
+		return args[i-1].Value
+	}
+
+	var matched []*db.QuestionTemplate
+	for _, qt := range r.templates {
+		keep := true
+		for _, m := range searchClause.FindAllStringSubmatch(query, -1) {
+			value := argAt(m[3])
+			switch m[1] {
+			case "subject":
+				keep = keep && value == qt.Subject
+			case "exam_type":
+				keep = keep && value == qt.ExamType
+			case "topic_id":
+				keep = keep && value == qt.TopicID
+			case "chapter":
+				keep = keep && value == qt.Chapter
+			case "bloom_level":
+				keep = keep && value == int64(qt.BloomLevel)
+			case "is_active":
+				keep = keep && value == qt.IsActive
+			case "base_difficulty":
+				bound := value.(float64)
+				keep = keep && (m[2] == ">=" && qt.BaseDifficulty >= bound || m[2] == "<=" && qt.BaseDifficulty <= bound)
+			case "template_text":
+				snippet := strings.Trim(value.(string), "%")
+				keep = keep && strings.Contains(strings.ToLower(qt.TemplateText), strings.ToLower(snippet))
+			case "ncert_reference":
+				snippet := strings.Trim(value.(string), "%")
+				keep = keep && qt.NCERTReference != nil && strings.Contains(strings.ToLower(*qt.NCERTReference), strings.ToLower(snippet))
+			case "template_id":
+				keep = keep && qt.TemplateID > value.(string)
+			}
+		}
+		if keep {
+			matched = append(matched, qt)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool { return matched[i].TemplateID < matched[j].TemplateID })
+	if m := logLimit.FindStringSubmatch(query); m != nil {
+		if limit := int(argAt(m[1]).(int64)); len(matched) > limit {
+			matched = matched[:limit]
+		}
+	}
+
+	rows := &recordingRows{columns: searchColumns}
+	for _, qt := range matched {
+		rows.values = append(rows.values, []driver.Value{
+			qt.TemplateID, qt.TopicID, qt.ExamType, qt.Subject, qt.Format, qt.TemplateText,
+			qt.BaseDifficulty, int64(qt.BloomLevel), qt.Chapter, nullableString(qt.SubChapter), nullableString(qt.NCERTReference),
+			int64(qt.UsageCount), qt.IsActive, qt.UpdatedAt,
+		})
+	}
+	return rows
+}
+
+// insertAnswer mimics db.Client.SaveAnswerSubmission's INSERT ... RETURNING
+func (r *recordingDB) insertAnswer(args []driver.NamedValue) driver.Rows {
+	a := &db.AnswerSubmission{
+		ID:             int64(len(r.answers) + 1),
+		QuestionID:     stringArg(args, 0),
+		TemplateID:     stringArg(args, 1),
+		StudentID:      stringArg(args, 2),
+		IsCorrect:      args[3].Value.(bool),
+		PartialCredit:  args[4].Value.(float64),
+		ResponseTimeMs: args[5].Value.(int64),
+		SubmittedAt:    time.Now(),
+	}
+	r.answers = append(r.answers, a)
+	return &recordingRows{
+		columns: []string{"id", "submitted_at"},
+		values:  [][]driver.Value{{a.ID, a.SubmittedAt}},
+	}
+}
+
+// flagColumns is the column order of db.Client's flagged question queries
+var flagColumns = []string{
+	"id", "question_id", "template_id", "reason", "score", "details", "status",
+	"reviewer", "review_note", "created_at", "resolved_at",
+}
+
+// insertFlag mimics db.Client.CreateFlaggedQuestion's INSERT ... RETURNING
+func (r *recordingDB) insertFlag(args []driver.NamedValue) driver.Rows {
+	f := &db.FlaggedQuestion{
+		ID:         int64(len(r.flags) + 1),
+		QuestionID: stringArg(args, 0),
+		TemplateID: stringArg(args, 1),
+		Reason:     stringArg(args, 2),
+		Details:    stringArg(args, 4),
+		Status:     db.FlagStatusPending,
+		CreatedAt:  time.Now(),
+	}
+	if score, ok := args[3].Value.(float64); ok {
+		f.Score = &score
+	}
+	r.flags = append(r.flags, f)
+	return &recordingRows{
+		columns: []string{"id", "status", "created_at"},
+		values:  [][]driver.Value{{f.ID, f.Status, f.CreatedAt}},
+	}
+}
+
+// flag returns the flag with id, or nil
+func (r *recordingDB) flag(id int64) *db.FlaggedQuestion {
+	for _, f := range r.flags {
+		if f.ID == id {
+			return f
+		}
+	}
+	return nil
+}
+
+// resolveFlag mimics db.Client.ResolveFlaggedQuestion's UPDATE, which only
+// matches pending flags
+func (r *recordingDB) resolveFlag(args []driver.NamedValue) driver.Rows {
+	rows := &recordingRows{columns: flagColumns}
+	f := r.flag(args[0].Value.(int64))
+	if f == nil || f.Status != db.FlagStatusPending {
+		return rows
+	}
+	f.Status = stringArg(args, 1)
+	f.Reviewer, f.ReviewNote = optionalStringArg(args, 2), optionalStringArg(args, 3)
+	if f.Reviewer != nil && *f.Reviewer == "" {
+		f.Reviewer = nil
+	}
+	if f.ReviewNote != nil && *f.ReviewNote == "" {
+		f.ReviewNote = nil
+	}
+	now := time.Now()
+	f.ResolvedAt = &now
+	rows.values = [][]driver.Value{flagRow(f)}
+	return rows
+}
+
+// queryFlags mimics db.Client.QueryFlaggedQuestions
+func (r *recordingDB) queryFlags(query string, args []driver.NamedValue) driver.Rows {
+	argAt := func(n string) driver.Value {
+		i, _ := strconv.Atoi(n)
+		return args[i-1].Value
+	}
+	rows := &recordingRows{columns: flagColumns}
+	for _, f := range r.flags {
+		keep := f.ID > args[0].Value.(int64)
+		for _, m := range logClause.FindAllStringSubmatch(query, -1) {
+			value := argAt(m[3])
+			switch m[1] {
+			case "status":
+				keep = keep && f.Status == value
+			case "reason":
+				keep = keep && f.Reason == value
+			case "template_id":
+				keep = keep && f.TemplateID == value
+			}
+		}
+		if keep {
+			rows.values = append(rows.values, flagRow(f))
+		}
+	}
+	if m := logLimit.FindStringSubmatch(query); m != nil {
+		if limit := int(argAt(m[1]).(int64)); len(rows.values) > limit {
+			rows.values = rows.values[:limit]
+		}
+	}
+	return rows
+}
+
+// flagRow renders f in flagColumns order
+func flagRow(f *db.FlaggedQuestion) []driver.Value {
+	var resolvedAt driver.Value
+	if f.ResolvedAt != nil {
+		resolvedAt = *f.ResolvedAt
+	}
+	var score driver.Value
+	if f.Score != nil {
+		score = *f.Score
+	}
+	return []driver.Value{
+		f.ID, f.QuestionID, f.TemplateID, f.Reason, score, f.Details, f.Status,
+		nullableString(f.Reviewer), nullableString(f.ReviewNote), f.CreatedAt, resolvedAt,
+	}
+}
+
+// flaggedQuestions returns the flags stored so far
+func (r *recordingDB) flaggedQuestions() []db.FlaggedQuestion {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	flags := make([]db.FlaggedQuestion, 0, len(r.flags))
+	for _, f := range r.flags {
+		flags = append(flags, *f)
+	}
+	return flags
+}
+
+// submittedAnswers returns the answer submissions stored so far
+func (r *recordingDB) submittedAnswers() []db.AnswerSubmission {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	answers := make([]db.AnswerSubmission, 0, len(r.answers))
+	for _, a := range r.answers {
+		answers = append(answers, *a)
+	}
+	return answers
+}
+
+func sortedTemplateIDs(templates map[string]*db.QuestionTemplate) []string {
+	ids := make([]string, 0, len(templates))
+	for id := range templates {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// questionColumns is the column order of db.Client.GetGeneratedQuestion
+var questionColumns = []string{
+	"question_id", "template_id", "student_id", "request_id", "question_text", "options",
+	"correct_answer", "solution_steps", "render_format", "difficulty", "seed", "created_at",
+}
+
+// insertQuestion mimics db.Client.SaveGeneratedQuestion's INSERT ... RETURNING
+func (r *recordingDB) insertQuestion(args []driver.NamedValue) driver.Rows {
+	createdAt := time.Now()
+	row := make([]driver.Value, 0, len(questionColumns))
+	for _, arg := range args {
+		row = append(row, arg.Value)
+	}
+	if row[8] == "" {
+		row[8] = "PLAIN"
+	}
+	r.questions[stringArg(args, 0)] = append(row, createdAt)
+	return &recordingRows{columns: []string{"created_at"}, values: [][]driver.Value{{createdAt}}}
+}
+
+// findSimilarQuestions mimics db.Client.FindSimilarQuestions, most similar
+// first
+func (r *recordingDB) findSimilarQuestions(args []driver.NamedValue) driver.Rows {
+	studentID, text := stringArg(args, 0), stringArg(args, 1)
+	since, minSimilarity, limit := args[2].Value.(time.Time), args[3].Value.(float64), int(args[4].Value.(int64))
+
+	rows := &recordingRows{columns: []string{"question_id", "template_id", "question_text", "score", "created_at"}}
+	for _, row := range r.questions {
+		createdAt := row[11].(time.Time)
+		if row[2] != studentID || createdAt.Before(since) {
+			continue
+		}
+		if score := trigramSimilarity(row[4].(string), text); score >= minSimilarity {
+			rows.values = append(rows.values, []driver.Value{row[0], row[1], row[4], score, createdAt})
+		}
+	}
+	sort.Slice(rows.values, func(i, j int) bool { return rows.values[i][3].(float64) > rows.values[j][3].(float64) })
+	if len(rows.values) > limit {
+		rows.values = rows.values[:limit]
+	}
+	return rows
+}
+
+// trigramSimilarity computes pg_trgm's similarity: the share of distinct
+// trigrams two texts have in common, each lower-cased word padded with two
+// spaces in front and one behind
+func trigramSimilarity(a, b string) float64 {
+	trigrams := func(text string) map[string]bool {
+		set := make(map[string]bool)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			padded := []rune("  " + word + " ")
+			for i := 0; i+3 <= len(padded); i++ {
+				set[string(padded[i:i+3])] = true
+			}
+		}
+		return set
+	}
+	ta, tb := trigrams(a), trigrams(b)
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	if total := len(ta) + len(tb) - shared; total > 0 {
+		return float64(shared) / float64(total)
+	}
+	return 0
+}
+
+// generationLogColumns is the column order of
+// db.Client.GetGenerationLogByQuestionID
+var generationLogColumns = []string{
+	"id", "question_id", "student_id", "session_id", "request_id", "topic_id", "exam_type",
+	"subject", "format", "requested_difficulty", "calibrated_difficulty", "template_id",
+	"rag_alignment_score", "final_quality_score", "total_pipeline_time_ms",
+	"status", "error_message", "retry_count", "created_at",
+}
+
+// insertGenerationLog mimics db.Client.CreateGenerationLog's INSERT ...
+// RETURNING, keeping the row when it carries a question_id
+func (r *recordingDB) insertGenerationLog(args []driver.NamedValue) driver.Rows {
+	r.nextID++
+	id := int64(r.nextID)
+	arg := func(i int) driver.Value { return args[i].Value }
+	row := []driver.Value{
+		id, arg(0), arg(1), arg(2), arg(3), arg(4), arg(5),
+		arg(6), arg(7), arg(8), arg(9), arg(11),
+		arg(21), arg(33), arg(31),
+		arg(34), arg(35), arg(36), time.Now(),
+		arg(13), arg(14), arg(15),
+		arg(32), arg(25),
+	}
+	r.logRows = append(r.logRows, row)
+	if questionID, ok := arg(0).(string); ok {
+		r.logs[questionID] = row
+	}
+	return &recordingRows{columns: []string{"id"}, values: [][]driver.Value{{id}}}
+}
+
+// logDetailColumns follow generationLogColumns in verbose log queries
+var logDetailColumns = []string{"generated_question_text", "generated_options", "correct_answer"}
+
+// logClause, logKeyset and logLimit match the conditions, cursor and LIMIT
+// db.Client.QueryGenerationLogs appends to its query
+var (
+	logClause = regexp.MustCompile(`(\w+) (=|>=|<) \$(\d+)`)
+	logKeyset = regexp.MustCompile(`\(created_at, id\) < \(\$(\d+), \$(\d+)\)`)
+	logLimit  = regexp.MustCompile(`LIMIT \$(\d+)`)
+)
+
+// queryGenerationLogs mimics db.Client.QueryGenerationLogs, newest first
+func (r *recordingDB) queryGenerationLogs(query string, args []driver.NamedValue) driver.Rows {
+	argAt := func(n string) driver.Value {
+		i, _ := strconv.Atoi(n)
+		return args[i-1].Value
+	}
+	columnIndex := map[string]int{"student_id": 2, "subject": 7, "exam_type": 6, "status": 15}
+
+	var matched [][]driver.Value
+	for _, row := range r.logRows {
+		createdAt := row[18].(time.Time)
+		keep := true
+		for _, m := range logClause.FindAllStringSubmatch(query, -1) {
+			switch value := argAt(m[3]); {
+			case m[1] == "created_at" && m[2] == ">=":
+				keep = keep && !createdAt.Before(value.(time.Time))
+			case m[1] == "created_at" && m[2] == "<":
+				keep = keep && createdAt.Before(value.(time.Time))
+			default:
+				keep = keep && row[columnIndex[m[1]]] == value
+			}
+		}
+		if m := logKeyset.FindStringSubmatch(query); m != nil {
+			after, id := argAt(m[1]).(time.Time), argAt(m[2]).(int64)
+			keep = keep && (createdAt.Before(after) || createdAt.Equal(after) && row[0].(int64) < id)
+		}
+		if keep {
+			matched = append(matched, row)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		ti, tj := matched[i][18].(time.Time), matched[j][18].(time.Time)
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return matched[i][0].(int64) > matched[j][0].(int64)
+	})
+	if m := logLimit.FindStringSubmatch(query); m != nil {
+		if limit := int(argAt(m[1]).(int64)); len(matched) > limit {
+			matched = matched[:limit]
+		}
+	}
+
+	rows := &recordingRows{columns: generationLogColumns, values: matched}
+	if strings.Contains(query, "correct_answer") {
+		rows.columns = append(append([]string(nil), generationLogColumns...), logDetailColumns...)
+	}
+	return rows
+}
+
+// qualityTrends mimics db.Client.GetQualityTrends' aggregate over the stored
+// logs, truncating created_at to the hour or day in UTC
+func (r *recordingDB) qualityTrends(args []driver.NamedValue) driver.Rows {
+	width := time.Hour
+	if args[0].Value == db.TrendBucketDay {
+		width = 24 * time.Hour
+	}
+	since, until := args[1].Value.(time.Time), args[2].Value.(time.Time)
+
+	type trend struct {
+		count, qualityCount, passed, regenerated int
+		quality, latency                         float64
+	}
+	trends := make(map[time.Time]*trend)
+	for _, row := range r.logRows {
+		createdAt := row[18].(time.Time)
+		if createdAt.Before(since) || !createdAt.Before(until) || row[15] == "PENDING" {
+			continue
+		}
+		bucket := createdAt.UTC().Truncate(width)
+		tr, ok := trends[bucket]
+		if !ok {
+			tr = &trend{}
+			trends[bucket] = tr
+		}
+		tr.count++
+		if quality, ok := row[13].(float64); ok {
+			tr.quality += quality
+			tr.qualityCount++
+		}
+		if row[22] == true {
+			tr.passed++
+		}
+		if row[23] == true {
+			tr.regenerated++
+		}
+		latency, _ := row[14].(int64)
+		tr.latency += float64(latency)
+	}
+
+	buckets := make([]time.Time, 0, len(trends))
+	for bucket := range trends {
+		buckets = append(buckets, bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Before(buckets[j]) })
+
+	rows := &recordingRows{columns: []string{"bucket", "count", "avg", "avg", "avg", "avg"}}
+	for _, bucket := range buckets {
+		tr := trends[bucket]
+		n := float64(tr.count)
+		var quality driver.Value
+		if tr.qualityCount > 0 {
+			quality = tr.quality / float64(tr.qualityCount)
+		}
+		rows.values = append(rows.values, []driver.Value{
+			bucket, int64(tr.count), quality, float64(tr.passed) / n, float64(tr.regenerated) / n, tr.latency / n,
+		})
+	}
+	return rows
+}
+
+// updateGenerationLog applies the status, final_quality_score and
+// rag_alignment_score of a logger.GenlogService UPDATE to the stored row
+func (r *recordingDB) updateGenerationLog(args []driver.Value) {
+	for _, row := range r.logRows {
+		if row[0] == args[len(args)-1] {
+			row[15], row[13], row[12] = args[0], args[1], args[2]
+			row[16], row[17] = args[4], args[8]
+			row[22], row[23] = args[3], args[5]
+			delete(r.retries, row[0].(int64))
+		}
+	}
+}
+
+// scheduleRetry mimics db.Client.ScheduleGenerationRetry
+func (r *recordingDB) scheduleRetry(args []driver.NamedValue) driver.Result {
+	for _, row := range r.logRows {
+		if row[0] == args[0].Value {
+			row[15], row[17] = "RETRY_PENDING", args[1].Value
+			r.retries[row[0].(int64)] = []driver.Value{args[3].Value, args[4].Value, args[2].Value}
+			return driver.RowsAffected(1)
+		}
+	}
+	return driver.RowsAffected(0)
+}
+
+// claimRetry mimics db.Client.ClaimGenerationRetry, moving next_attempt_at
+// on only while the retry is still pending at the expected time
+func (r *recordingDB) claimRetry(args []driver.NamedValue) driver.Result {
+	id, _ := args[0].Value.(int64)
+	retry, ok := r.retries[id]
+	if !ok || !retry[0].(time.Time).Equal(args[1].Value.(time.Time)) {
+		return driver.RowsAffected(0)
+	}
+	retry[0] = args[2].Value
+	return driver.RowsAffected(1)
+}
+
+// pendingRetries mimics db.Client.GetPendingGenerationRetries
+func (r *recordingDB) pendingRetries() driver.Rows {
+	rows := &recordingRows{columns: append(append([]string(nil), generationLogColumns...), "retry_attempts", "next_attempt_at", "retry_request")}
+	for _, row := range r.logRows {
+		if retry, ok := r.retries[row[0].(int64)]; ok && row[15] == "RETRY_PENDING" {
+			rows.values = append(rows.values, append(append([]driver.Value(nil), row[:len(generationLogColumns)]...), retry[2], retry[0], retry[1]))
+		}
+	}
+	next := len(generationLogColumns) + 1
+	sort.Slice(rows.values, func(i, j int) bool {
+		return rows.values[i][next].(time.Time).Before(rows.values[j][next].(time.Time))
+	})
+	return rows
+}
+
+// pendingRetryCount returns how many generation logs are RETRY_PENDING
+func (r *recordingDB) pendingRetryCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.retries)
+}
+
+// templateFromArgs reads the 21 arguments shared by CreateTemplate and
+// UpdateTemplate
+func templateFromArgs(args []driver.NamedValue) *db.QuestionTemplate {
+	var tolerance *db.NumericalTolerance
+	if args[16].Value != nil {
+		tolerance = &db.NumericalTolerance{}
+		tolerance.Scan(args[16].Value)
+	}
+	return &db.QuestionTemplate{
+		TemplateID:         stringArg(args, 0),
+		TopicID:            stringArg(args, 1),
+		ExamType:           stringArg(args, 2),
+		Subject:            stringArg(args, 3),
+		Format:             stringArg(args, 4),
+		TemplateText:       stringArg(args, 5),
+		VariableSlots:      stringArg(args, 6),
+		OptionsTemplate:    optionalStringArg(args, 7),
+		AnswerUnit:         optionalStringArg(args, 8),
+		RenderFormat:       stringArg(args, 9),
+		BaseDifficulty:     args[10].Value.(float64),
+		BloomLevel:         int(args[11].Value.(int64)),
+		ConceptDepth:       int(args[12].Value.(int64)),
+		Chapter:            stringArg(args, 13),
+		SubChapter:         optionalStringArg(args, 14),
+		NCERTReference:     optionalStringArg(args, 15),
+		NumericalTolerance: tolerance,
+		AnswerFormula:      optionalStringArg(args, 17),
+		TemplateTextHi:     optionalStringArg(args, 18),
+		OptionsTemplateHi:  optionalStringArg(args, 19),
+		AnswerPrecision:    optionalIntArg(args, 20),
+	}
+}
+
+// templateRow renders qt in templateColumns order
+func templateRow(qt *db.QuestionTemplate) []driver.Value {
+	return []driver.Value{
+		qt.TemplateID, qt.TopicID, qt.ExamType, qt.Subject, qt.Format, qt.TemplateText, nullableString(qt.TemplateTextHi),
+		qt.VariableSlots, nullableString(qt.OptionsTemplate), nullableString(qt.OptionsTemplateHi), nullableString(qt.AnswerUnit), nullableString(qt.AnswerFormula), nullableTolerance(qt.NumericalTolerance), nullablePrecision(qt.AnswerPrecision),
+		qt.RenderFormat, qt.BaseDifficulty, int64(qt.BloomLevel),
+		int64(qt.ConceptDepth), nullableNumeric(qt.ValidationScore), qt.AmbiguityFlag, nullableNumeric(qt.ClarityScore),
+		qt.Chapter, nullableString(qt.SubChapter), nullableString(qt.NCERTReference), int64(qt.UsageCount), nullableNumeric(qt.SuccessRate),
+		nullableInt(qt.AvgSolveTime), qt.CreatedAt, qt.UpdatedAt, qt.IsActive, int64(qt.Version),
+	}
+}
+
+func stringArg(args []driver.NamedValue, i int) string {
+	s, _ := args[i].Value.(string)
+	return s
+}
+
+func optionalStringArg(args []driver.NamedValue, i int) *string {
+	if s, ok := args[i].Value.(string); ok {
+		return &s
+	}
+	return nil
+}
+
+func optionalIntArg(args []driver.NamedValue, i int) *int {
+	if n, ok := args[i].Value.(int64); ok {
+		precision := int(n)
+		return &precision
+	}
+	return nil
+}
+
+func nullablePrecision(n *int) driver.Value {
+	if n == nil {
+		return nil
+	}
+	return int64(*n)
+}
+
+func nullableTolerance(t *db.NumericalTolerance) driver.Value {
+	if t == nil {
+		return nil
+	}
+	v, _ := t.Value()
+	return v
+}
+
+// nullableNumeric renders a NUMERIC column as lib/pq returns it, as text
+func nullableNumeric(f *float64) driver.Value {
+	if f == nil {
+		return nil
+	}
+	return []byte(strconv.FormatFloat(*f, 'f', -1, 64))
+}
+
+func nullableInt(n *int64) driver.Value {
+	if n == nil {
+		return nil
+	}
+	return *n
+}
+
+func nullableString(s *string) driver.Value {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+type recordingRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string { return r.columns }
+func (r *recordingRows) Close() error      { return nil }
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
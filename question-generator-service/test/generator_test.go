@@ -0,0 +1,1346 @@
+package test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+
+	"question-generator-service/api"
+	"question-generator-service/internal/config"
+	"question-generator-service/internal/db"
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/breaker"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/rag_advisor"
+	"question-generator-service/pkg/templates"
+	"question-generator-service/pkg/validator"
+)
+
+func TestGenerateQuestionReturnsPromptlyWhenCancelled(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+
+	// The BKT service hangs well past the request deadline but within its
+	// own client timeout, so only the request deadline can end the call
+	release := make(chan struct{})
+	defer close(release)
+	generator := newTestGenerator(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+	}), 10*time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := generator.GenerateQuestion(ctx, &service.GenerateQuestionRequest{
+		StudentID:           "student_1",
+		TopicID:             "PHY_KINEMATICS",
+		ExamType:            "JEE_MAIN",
+		Subject:             "PHYSICS",
+		Format:              "NUMERICAL",
+		RequestedDifficulty: 0.5,
+		RequestID:           "req_cancel",
+	})
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline error instead of a fallback question, got %v", err)
+	}
+	if elapsed > time.Second {
+		t.Fatalf("generation took %v after a 50ms deadline", elapsed)
+	}
+}
+
+func TestGenerateQuestionAvoidsRecentTemplatesForSession(t *testing.T) {
+	store := newRecordingDB()
+	for _, qt := range selectionCandidates()[:2] {
+		store.addTemplate(qt)
+	}
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bkt.Close()
+	cfg := &config.AppConfig{
+		BKT:       config.BKTConfig{ServiceURL: bkt.URL, Timeout: time.Second},
+		Templates: config.TemplateConfig{RecentWindow: 1, RecentTTL: time.Hour},
+	}
+	generator, err := service.NewGeneratorService(cfg, newFakeDBClient(t, store))
+	if err != nil {
+		t.Fatalf("failed to create generator service: %v", err)
+	}
+
+	var previous string
+	for i := 0; i < 10; i++ {
+		resp, err := generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+			StudentID:           "student_1",
+			SessionID:           "session_1",
+			TopicID:             "PHY_KINEMATICS",
+			ExamType:            "JEE_MAIN",
+			Subject:             "PHYSICS",
+			Format:              "NUMERICAL",
+			RequestedDifficulty: 0.5,
+		})
+		if err != nil {
+			t.Fatalf("generation %d failed: %v", i, err)
+		}
+		templateID := resp.Metadata["template_id"].(string)
+		if templateID == previous {
+			t.Fatalf("generation %d repeated template %s", i, templateID)
+		}
+		previous = templateID
+	}
+}
+
+func TestGenerationLogKeepsFreeFormSessionIDs(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	generator := newTestGenerator(t, store, http.NotFoundHandler(), time.Second)
+
+	// The simulator's session IDs, like most clients', are not UUIDs
+	for student, session := range map[string]string{"student_session": "session_student_session_3", "student_sessionless": ""} {
+		_, err := generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+			StudentID: student, SessionID: session, TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+			Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5, RequestID: "req-" + student,
+		})
+		if err != nil {
+			t.Fatalf("%s: generation failed: %v", student, err)
+		}
+		if genLog := studentLog(t, generator, student); genLog.SessionID != session || genLog.Status != "COMPLETED" {
+			t.Errorf("%s: expected a completed log of session %q, got %q with %s", student, session, genLog.SessionID, genLog.Status)
+		}
+	}
+	// No session is stored as NULL rather than an empty string
+	for _, row := range store.logRows {
+		if row[2] == "student_sessionless" && row[3] != nil {
+			t.Errorf("expected a NULL session_id, got %#v", row[3])
+		}
+	}
+}
+
+// headerRecorder collects the X-Request-ID header of every request it serves
+type headerRecorder struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (h *headerRecorder) record(r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ids = append(h.ids, r.Header.Get(logging.RequestIDHeader))
+}
+
+func (h *headerRecorder) seen() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.ids...)
+}
+
+func TestGenerateQuestionForwardsRequestID(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+
+	var bktSeen, ragSeen headerRecorder
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bktSeen.record(r)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bkt.Close()
+	rag := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ragSeen.record(r)
+		json.NewEncoder(w).Encode(rag_advisor.QualityCheckResponse{AlignmentScore: 0.9})
+	}))
+	defer rag.Close()
+
+	cfg := defaultConfig(t)
+	cfg.BKT.ServiceURL, cfg.BKT.Timeout, cfg.BKT.RetryCount = bkt.URL, time.Second, 0
+	cfg.RAG.ServiceURL = rag.URL
+	generator, err := service.NewGeneratorService(cfg, newFakeDBClient(t, store))
+	if err != nil {
+		t.Fatalf("failed to create generator service: %v", err)
+	}
+
+	generate := func(ctx context.Context, bodyRequestID string) {
+		t.Helper()
+		_, err := generator.GenerateQuestion(ctx, &service.GenerateQuestionRequest{
+			StudentID: "student_1", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+			Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5,
+			RequestID: bodyRequestID,
+		})
+		if err != nil {
+			t.Fatalf("generation failed: %v", err)
+		}
+	}
+
+	// The correlation ID set by the request middleware wins over the body
+	generate(logging.WithRequestID(context.Background(), "req-trace-1"), "body-id")
+	// Without one in context, the body's ID is forwarded
+	generate(context.Background(), "req-trace-2")
+
+	for name, seen := range map[string][]string{"BKT": bktSeen.seen(), "RAG": ragSeen.seen()} {
+		if len(seen) != 2 || seen[0] != "req-trace-1" || seen[1] != "req-trace-2" {
+			t.Errorf("expected %s to receive request IDs [req-trace-1 req-trace-2], got %v", name, seen)
+		}
+	}
+}
+
+func TestRagClientForwardsRequestID(t *testing.T) {
+	var seen headerRecorder
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen.record(r)
+		json.NewEncoder(w).Encode(service.RagResponse{Score: 0.8})
+	}))
+	defer server.Close()
+
+	ctx := logging.WithRequestID(context.Background(), "req-rag")
+	if _, err := service.NewRagClient(server.URL).AssessQuestionQuality(ctx, "question"); err != nil {
+		t.Fatalf("quality request failed: %v", err)
+	}
+	if ids := seen.seen(); len(ids) != 1 || ids[0] != "req-rag" {
+		t.Fatalf("expected X-Request-ID req-rag, got %v", ids)
+	}
+}
+
+func TestSubjectThresholdGovernsRegeneration(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+
+	var ragCalls int64
+	rag := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&ragCalls, 1)
+		json.NewEncoder(w).Encode(rag_advisor.QualityCheckResponse{AlignmentScore: 0.75})
+	}))
+	defer rag.Close()
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bkt.Close()
+
+	checks := func(global float64, subjects map[string]float64) int64 {
+		t.Helper()
+		cfg := defaultConfig(t)
+		cfg.BKT.ServiceURL, cfg.BKT.Timeout, cfg.BKT.RetryCount = bkt.URL, time.Second, 0
+		cfg.RAG.ServiceURL, cfg.RAG.MaxRetries = rag.URL, 2
+		cfg.RAG.AlignmentThreshold, cfg.RAG.SubjectThresholds = global, subjects
+		generator, err := service.NewGeneratorService(cfg, newFakeDBClient(t, store))
+		if err != nil {
+			t.Fatalf("failed to create generator service: %v", err)
+		}
+
+		atomic.StoreInt64(&ragCalls, 0)
+		_, err = generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+			StudentID: "student_1", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+			Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5,
+		})
+		if err != nil {
+			t.Fatalf("generation failed: %v", err)
+		}
+		return atomic.LoadInt64(&ragCalls)
+	}
+
+	if calls := checks(0.8, map[string]float64{"PHYSICS": 0.7}); calls != 1 {
+		t.Errorf("expected the 0.7 PHYSICS threshold to accept 0.75 at once, got %d checks", calls)
+	}
+	if calls := checks(0.7, map[string]float64{"PHYSICS": 0.8}); calls != 3 {
+		t.Errorf("expected the 0.8 PHYSICS threshold to regenerate, got %d checks", calls)
+	}
+	if calls := checks(0.7, map[string]float64{"BIOLOGY": 0.8}); calls != 1 {
+		t.Errorf("expected other subjects' overrides to be ignored, got %d checks", calls)
+	}
+}
+
+func TestGenerateQuestionReplaysCompletedRequestID(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	var bktCalls int64
+	generator := newTestGenerator(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&bktCalls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), time.Second)
+
+	generate := func(requestID string) *service.GenerateQuestionResponse {
+		t.Helper()
+		resp, err := generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+			StudentID: "student_1", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+			Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5, RequestID: requestID,
+		})
+		if err != nil {
+			t.Fatalf("generation failed: %v", err)
+		}
+		return resp
+	}
+	logInserts := func() int {
+		n := 0
+		for _, statement := range store.recorded() {
+			if strings.Contains(statement, "INSERT INTO question_generation_logs") {
+				n++
+			}
+		}
+		return n
+	}
+
+	first := generate("req-retry")
+	if first.Replayed {
+		t.Fatal("expected the first request to generate")
+	}
+	calls := atomic.LoadInt64(&bktCalls)
+
+	second := generate("req-retry")
+	if !second.Replayed || second.Metadata["idempotent_replay"] != true {
+		t.Fatalf("expected the retried request to be replayed, got %+v", second)
+	}
+	if second.QuestionID != first.QuestionID || second.QuestionText != first.QuestionText ||
+		second.CorrectAnswer != first.CorrectAnswer {
+		t.Errorf("expected the earlier question back, got %+v for %+v", second, first)
+	}
+	if second.Metadata["generation_log_id"] != first.Metadata["generation_log_id"] {
+		t.Errorf("expected the earlier generation log, got %v and %v",
+			second.Metadata["generation_log_id"], first.Metadata["generation_log_id"])
+	}
+	if got := atomic.LoadInt64(&bktCalls); got != calls {
+		t.Errorf("expected no calibration for the replay, BKT calls went from %d to %d", calls, got)
+	}
+	if got := logInserts(); got != 1 {
+		t.Errorf("expected a single generation log, got %d", got)
+	}
+
+	if other := generate("req-other"); other.Replayed || other.QuestionID == first.QuestionID {
+		t.Errorf("expected a different request ID to generate anew, got %+v", other)
+	}
+}
+
+// newRetryingGenerator is a generator that retries transient failures after
+// a few milliseconds, with BKT unavailable so calibration falls back
+func newRetryingGenerator(t *testing.T, store *recordingDB) *service.GeneratorService {
+	t.Helper()
+	return newRetryingGeneratorWithDelay(t, store, 5*time.Millisecond)
+}
+
+// newRetryingGeneratorWithDelay is newRetryingGenerator waiting at least
+// baseDelay before each retry
+func newRetryingGeneratorWithDelay(t *testing.T, store *recordingDB, baseDelay time.Duration) *service.GeneratorService {
+	t.Helper()
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(bkt.Close)
+	cfg := &config.AppConfig{
+		BKT: config.BKTConfig{ServiceURL: bkt.URL, Timeout: time.Second},
+		Retry: config.RetryConfig{
+			QueueSize: 4, Workers: 1, MaxAttempts: 3,
+			BaseDelay: baseDelay, MaxDelay: 4 * baseDelay, Timeout: time.Second,
+		},
+	}
+	generator, err := service.NewGeneratorService(cfg, newFakeDBClient(t, store))
+	if err != nil {
+		t.Fatalf("failed to create generator service: %v", err)
+	}
+	t.Cleanup(generator.Close)
+	return generator
+}
+
+// studentLog returns the only generation log of studentID
+func studentLog(t *testing.T, generator *service.GeneratorService, studentID string) *db.GenerationLog {
+	t.Helper()
+	page, err := generator.QueryGenerationLogs(context.Background(), db.GenerationLogFilters{StudentID: studentID})
+	if err != nil || len(page.Logs) != 1 {
+		t.Fatalf("expected one generation log for %s, got %+v, %v", studentID, page, err)
+	}
+	return page.Logs[0]
+}
+
+func TestTransientGenerationFailureIsRetried(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	store.failTemplateFilters(&pq.Error{Code: "08006", Message: "connection failure"})
+	generator := newRetryingGenerator(t, store)
+
+	_, err := generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+		StudentID: "student_retry", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+		Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5, RequestID: "req-transient",
+	})
+	if err == nil || !service.IsTransient(err) {
+		t.Fatalf("expected a transient failure, got %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		genLog := studentLog(t, generator, "student_retry")
+		if genLog.Status == "COMPLETED" {
+			if genLog.RetryCount != 1 {
+				t.Errorf("expected retry_count 1 on the original row, got %d", genLog.RetryCount)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the background retry to complete the generation, got status %s", genLog.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPendingRetryRefusesTheSameRequestID(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	store.failTemplateFilters(&pq.Error{Code: "08006", Message: "connection failure"})
+	generator := newRetryingGeneratorWithDelay(t, store, time.Hour)
+
+	req := &service.GenerateQuestionRequest{
+		StudentID: "student_pending", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+		Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5, RequestID: "req-pending",
+	}
+	if _, err := generator.GenerateQuestion(context.Background(), req); !service.IsTransient(err) {
+		t.Fatalf("expected a transient failure, got %v", err)
+	}
+	if genLog := studentLog(t, generator, "student_pending"); genLog.Status != "RETRY_PENDING" {
+		t.Fatalf("expected the queued retry to be persisted as RETRY_PENDING, got %s", genLog.Status)
+	}
+
+	// Both the replica holding the retry and any other refuse to generate
+	// the request again while it waits
+	other := newRetryingGeneratorWithDelay(t, store, time.Hour)
+	for name, g := range map[string]*service.GeneratorService{"same replica": generator, "other replica": other} {
+		if _, err := g.GenerateQuestion(context.Background(), req); !errors.Is(err, service.ErrRetryInProgress) {
+			t.Errorf("%s: expected ErrRetryInProgress, got %v", name, err)
+		}
+	}
+	if page, err := generator.QueryGenerationLogs(context.Background(), db.GenerationLogFilters{StudentID: "student_pending"}); err != nil || len(page.Logs) != 1 {
+		t.Errorf("expected no further generation logs, got %+v, %v", page, err)
+	}
+}
+
+func TestPendingRetriesAreResumedAfterRestart(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	store.failTemplateFilters(&pq.Error{Code: "08006", Message: "connection failure"})
+	stopped := newRetryingGeneratorWithDelay(t, store, 100*time.Millisecond)
+
+	_, err := stopped.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+		StudentID: "student_resume", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+		Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5, RequestID: "req-resume",
+	})
+	if !service.IsTransient(err) {
+		t.Fatalf("expected a transient failure, got %v", err)
+	}
+	// Shutting down before the retry is due leaves it pending
+	stopped.Close()
+	if pending := store.pendingRetryCount(); pending != 1 {
+		t.Fatalf("expected the queued retry to stay pending after Close, got %d", pending)
+	}
+
+	// RAG regenerations also count towards retry_count, which must not
+	// use up the retry budget of the resumed retry: its first attempt
+	// fails again and it still gets another
+	store.mu.Lock()
+	store.logRows[len(store.logRows)-1][17] = int64(5)
+	store.mu.Unlock()
+	store.failTemplateFilters(&pq.Error{Code: "08006", Message: "connection failure"})
+
+	restarted := newRetryingGenerator(t, store)
+	resumed, err := restarted.ResumeRetries(context.Background())
+	if err != nil || resumed != 1 {
+		t.Fatalf("expected one retry resumed, got %d, %v", resumed, err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		genLog := studentLog(t, restarted, "student_resume")
+		if genLog.Status == "COMPLETED" {
+			if genLog.RetryCount != 5+2 {
+				t.Errorf("expected both resumed attempts on top of retry_count 5, got %d", genLog.RetryCount)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the resumed retry to complete the generation, got status %s", genLog.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if pending := store.pendingRetryCount(); pending != 0 {
+		t.Errorf("expected no pending retries once completed, got %d", pending)
+	}
+}
+
+func TestPermanentGenerationFailureIsNotRetried(t *testing.T) {
+	store := newRecordingDB()
+	generator := newRetryingGenerator(t, store)
+
+	_, err := generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+		StudentID: "student_permanent", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+		Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5, RequestID: "req-permanent",
+	})
+	if err == nil || service.IsTransient(err) {
+		t.Fatalf("expected a permanent failure without templates, got %v", err)
+	}
+
+	// Well past the backoff of a first retry
+	time.Sleep(50 * time.Millisecond)
+	if genLog := studentLog(t, generator, "student_permanent"); genLog.Status != "FAILED" || genLog.RetryCount != 0 {
+		t.Fatalf("expected the failure to stand without retries, got status %s and retry_count %d", genLog.Status, genLog.RetryCount)
+	}
+	filterQueries := 0
+	for _, statement := range store.recorded() {
+		if strings.Contains(statement, "FROM question_templates WHERE is_active = true") {
+			filterQueries++
+		}
+	}
+	if filterQueries != 1 {
+		t.Errorf("expected a single template query, got %d", filterQueries)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"deadline", fmt.Errorf("calibrate: %w", context.DeadlineExceeded), true},
+		{"cancelled", context.Canceled, false},
+		{"open breaker", fmt.Errorf("rag: %w", breaker.ErrOpen), true},
+		{"bad connection", driver.ErrBadConn, true},
+		{"connection refused", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"connection failure", &pq.Error{Code: "08006"}, true},
+		{"serialization failure", &pq.Error{Code: "40001"}, true},
+		{"query cancelled", &pq.Error{Code: "57014"}, false},
+		{"undefined column", &pq.Error{Code: "42703"}, false},
+		{"no templates", errors.New("no templates found matching criteria"), false},
+		{"nil", nil, false},
+	}
+	for _, tc := range cases {
+		if got := service.IsTransient(tc.err); got != tc.want {
+			t.Errorf("%s: expected IsTransient %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestNearDuplicateQuestionIsRegenerated(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(bkt.Close)
+	generator, err := service.NewGeneratorService(&config.AppConfig{
+		BKT:        config.BKTConfig{ServiceURL: bkt.URL, Timeout: time.Second},
+		Duplicates: config.DuplicateConfig{Enabled: true, Threshold: 0.5, Window: time.Hour, MaxRegenerations: 1},
+		Templates:  config.TemplateConfig{SelectionMode: "BEST"},
+	}, newFakeDBClient(t, store))
+	if err != nil {
+		t.Fatalf("failed to create generator service: %v", err)
+	}
+
+	generate := func(studentID string, seed int64) (*service.GenerateQuestionResponse, driver.Value) {
+		t.Helper()
+		resp, err := generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+			StudentID: studentID, TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN", Subject: "PHYSICS",
+			Format: "NUMERICAL", RequestedDifficulty: 0.5, Seed: seed,
+		})
+		if err != nil {
+			t.Fatalf("generation failed: %v", err)
+		}
+		updates := store.generationLogUpdates()
+		return resp, updates[len(updates)-1][6] // regeneration_reason
+	}
+
+	// Other numbers in the same template make a near-duplicate; with no
+	// other template to turn to it is served anyway
+	first, _ := generate("s1", 5)
+	second, reason := generate("s1", 6)
+	if first.QuestionText == second.QuestionText {
+		t.Fatalf("expected different numbers from another seed, got %q twice", first.QuestionText)
+	}
+	if r, _ := reason.(string); !strings.Contains(r, "near-duplicate: template "+kinematicsTemplateID+" was") || !strings.Contains(r, first.QuestionID) {
+		t.Errorf("expected the log to record the near-duplicate of %s, got %v", first.QuestionID, reason)
+	}
+
+	// Given another, if less suitable, template the regeneration turns to it
+	other := previewTemplate()
+	other.TemplateID, other.BaseDifficulty = "physics_projectile_001", 0.58
+	other.TemplateText = "A stone is thrown upwards with speed {{v0}} m/s. How high does it rise before falling back?"
+	store.addTemplate(other)
+	third, reason := generate("s1", 5)
+	if got := third.Metadata["template_id"]; got != other.TemplateID {
+		t.Errorf("expected the regenerated question to come from %s, got %v: %q", other.TemplateID, got, third.QuestionText)
+	}
+	if reason == nil || reason == "" {
+		t.Error("expected the regeneration to be logged")
+	}
+
+	// Only the student's own questions count
+	if fresh, reason := generate("s2", 6); fresh.QuestionText != second.QuestionText || reason != nil && reason != "" {
+		t.Errorf("expected a new student to be served %q without regeneration, got %q (%v)", second.QuestionText, fresh.QuestionText, reason)
+	}
+}
+
+// addPaperTemplates stores count templates of topic at each difficulty
+func addPaperTemplates(store *recordingDB, subject, topic string, count int, difficulties ...float64) {
+	for _, difficulty := range difficulties {
+		for i := 0; i < count; i++ {
+			qt := previewTemplate()
+			qt.TemplateID = fmt.Sprintf("%s_%.2f_%d", topic, difficulty, i)
+			qt.Subject, qt.TopicID, qt.BaseDifficulty = subject, topic, difficulty
+			store.addTemplate(qt)
+		}
+	}
+}
+
+func TestGenerateTestFollowsBlueprint(t *testing.T) {
+	store := newRecordingDB()
+	for _, topic := range []struct{ subject, id string }{
+		{"PHYSICS", "PHY_KINEMATICS"}, {"PHYSICS", "PHY_OPTICS"}, {"CHEMISTRY", "CHEM_BONDING"},
+	} {
+		addPaperTemplates(store, topic.subject, topic.id, 5, 0.25, 0.55, 0.85)
+	}
+	// BKT is down, so the fallback serves the templates' own difficulty
+	generator := newTestGenerator(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), time.Second)
+
+	paper, err := generator.GenerateTest(context.Background(), service.TestBlueprint{
+		StudentID: "student_1",
+		ExamType:  "JEE_MAIN",
+		Format:    "NUMERICAL",
+		Sections: []service.BlueprintSection{
+			{Subject: "PHYSICS", Questions: 10, Topics: map[string]float64{"PHY_KINEMATICS": 3, "PHY_OPTICS": 2}},
+			{Subject: "CHEMISTRY", Questions: 5, Topics: map[string]float64{"CHEM_BONDING": 1}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("test generation failed: %v", err)
+	}
+	if len(paper.Failures) != 0 || len(paper.Questions) != 15 {
+		t.Fatalf("expected 15 questions and no failures, got %d and %+v", len(paper.Questions), paper.Failures)
+	}
+
+	templates := make(map[string]bool)
+	for i, q := range paper.Questions {
+		if q.Number != i+1 {
+			t.Errorf("expected question %d to be numbered %d", q.Number, i+1)
+		}
+		if wantSubject := map[bool]string{true: "PHYSICS", false: "CHEMISTRY"}[q.Number <= 10]; q.Subject != wantSubject {
+			t.Errorf("expected question %d in %s, got %s", q.Number, wantSubject, q.Subject)
+		}
+		templateID := q.Question.Metadata["template_id"].(string)
+		if templates[templateID] {
+			t.Errorf("template %s appears twice in the paper", templateID)
+		}
+		templates[templateID] = true
+	}
+
+	summary := paper.Summary
+	if summary.Requested != 15 || summary.Generated != 15 {
+		t.Errorf("expected 15 of 15 questions, got %d of %d", summary.Generated, summary.Requested)
+	}
+	physics, chemistry := summary.Subjects[0], summary.Subjects[1]
+	if physics.Generated != 10 || physics.Topics["PHY_KINEMATICS"] != 6 || physics.Topics["PHY_OPTICS"] != 4 {
+		t.Errorf("expected physics split 6/4 over its topics, got %+v", physics)
+	}
+	if chemistry.Generated != 5 || chemistry.Topics["CHEM_BONDING"] != 5 {
+		t.Errorf("expected 5 chemistry questions, got %+v", chemistry)
+	}
+
+	// 30/50/20 of 10 physics and 5 chemistry questions
+	wantBands := []int{3 + 2, 5 + 2, 2 + 1}
+	for i, band := range summary.Difficulty {
+		if band.Target != wantBands[i] || band.Generated != wantBands[i] {
+			t.Errorf("expected %d questions in [%g, %g), got target %d and generated %d",
+				wantBands[i], band.Min, band.Max, band.Target, band.Generated)
+		}
+	}
+	if summary.DifficultyDeviation != 0 || summary.OutsideBands != 0 {
+		t.Errorf("expected the difficulty spread met exactly, got deviation %g with %d outside",
+			summary.DifficultyDeviation, summary.OutsideBands)
+	}
+}
+
+func TestPaperQuestionsShareAGeneratedSession(t *testing.T) {
+	store := newRecordingDB()
+	addPaperTemplates(store, "PHYSICS", "PHY_KINEMATICS", 3, 0.25, 0.55, 0.85)
+	generator := newTestGenerator(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), time.Second)
+
+	// X-Request-ID may be any valid request ID, not only a UUID
+	ctx := logging.WithRequestID(context.Background(), "req_paper.1")
+	paper, err := generator.GenerateTest(ctx, service.TestBlueprint{
+		StudentID: "student_paper", ExamType: "JEE_MAIN", Format: "NUMERICAL",
+		Sections: []service.BlueprintSection{{Subject: "PHYSICS", Questions: 3, Topics: map[string]float64{"PHY_KINEMATICS": 1}}},
+	})
+	if err != nil || len(paper.Questions) != 3 {
+		t.Fatalf("expected 3 questions, got %+v, %v", paper, err)
+	}
+	if _, err := uuid.Parse(paper.SessionID); err != nil || paper.TestID != "req_paper.1" {
+		t.Fatalf("expected a UUID session apart from test ID req_paper.1, got %q and %q", paper.SessionID, paper.TestID)
+	}
+
+	page, err := generator.QueryGenerationLogs(context.Background(), db.GenerationLogFilters{StudentID: "student_paper"})
+	if err != nil || len(page.Logs) != 3 {
+		t.Fatalf("expected 3 generation logs, got %+v, %v", page, err)
+	}
+	for _, genLog := range page.Logs {
+		if genLog.SessionID != paper.SessionID || !strings.HasPrefix(genLog.RequestID, "req_paper.1-") {
+			t.Errorf("expected session %s and a request ID under the test's, got %q and %q",
+				paper.SessionID, genLog.SessionID, genLog.RequestID)
+		}
+	}
+}
+
+func TestGenerateTestStopsWhenProgressCancels(t *testing.T) {
+	store := newRecordingDB()
+	addPaperTemplates(store, "PHYSICS", "PHY_KINEMATICS", 5, 0.25, 0.55, 0.85)
+	generator := newTestGenerator(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), time.Second)
+
+	// A client going away after the first event cancels the rest
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var events []service.PaperProgress
+	paper, err := generator.GenerateTestWithProgress(ctx, service.TestBlueprint{
+		StudentID: "student_1",
+		ExamType:  "JEE_MAIN",
+		Format:    "NUMERICAL",
+		Sections:  []service.BlueprintSection{{Subject: "PHYSICS", Questions: 6, Topics: map[string]float64{"PHY_KINEMATICS": 1}}},
+	}, func(event service.PaperProgress) {
+		events = append(events, event)
+		cancel()
+	})
+	if err != nil {
+		t.Fatalf("test generation failed: %v", err)
+	}
+	if len(paper.Questions) != 1 || len(paper.Failures) != 5 {
+		t.Fatalf("expected one question before the cancellation, got %d with %d failures", len(paper.Questions), len(paper.Failures))
+	}
+	if len(events) != 6 || events[0].Status != service.PaperSlotGenerated || events[5].Status != service.PaperSlotFailed {
+		t.Errorf("expected every slot reported, the first generated, got %+v", events)
+	}
+	for _, failure := range paper.Failures {
+		if !strings.Contains(failure.Error, context.Canceled.Error()) {
+			t.Errorf("expected slot %d to fail with the cancellation, got %q", failure.Number, failure.Error)
+		}
+	}
+}
+
+func TestGenerateTestNeverRepeatsATemplate(t *testing.T) {
+	store := newRecordingDB()
+	addPaperTemplates(store, "PHYSICS", "PHY_KINEMATICS", 2, 0.55)
+	generator := newTestGenerator(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), time.Second)
+
+	paper, err := generator.GenerateTest(context.Background(), service.TestBlueprint{
+		StudentID:  "student_1",
+		ExamType:   "JEE_MAIN",
+		Format:     "NUMERICAL",
+		Sections:   []service.BlueprintSection{{Subject: "PHYSICS", Questions: 3, Topics: map[string]float64{"PHY_KINEMATICS": 1}}},
+		Difficulty: []service.DifficultyBand{{Min: 0.4, Max: 0.7, Weight: 1}},
+	})
+	if err != nil {
+		t.Fatalf("test generation failed: %v", err)
+	}
+	if len(paper.Questions) != 2 || len(paper.Failures) != 1 || paper.Failures[0].Number != 3 {
+		t.Fatalf("expected two questions and the third slot to fail, got %d questions and %+v", len(paper.Questions), paper.Failures)
+	}
+	if first, second := paper.Questions[0].Question.Metadata["template_id"], paper.Questions[1].Question.Metadata["template_id"]; first == second {
+		t.Errorf("expected two different templates, got %v twice", first)
+	}
+	if paper.Summary.Generated != 2 || paper.Summary.Requested != 3 {
+		t.Errorf("expected the summary to report 2 of 3 questions, got %+v", paper.Summary)
+	}
+
+	if _, err := generator.GenerateTest(context.Background(), service.TestBlueprint{
+		StudentID:  "student_1",
+		ExamType:   "JEE_MAIN",
+		Sections:   []service.BlueprintSection{{Subject: "PHYSICS", Questions: 3, Topics: map[string]float64{"PHY_KINEMATICS": 1}}},
+		Difficulty: []service.DifficultyBand{{Min: 0.1, Max: 0.5, Weight: 1}, {Min: 0.4, Max: 0.9, Weight: 1}},
+	}); !errors.Is(err, service.ErrInvalidBlueprint) {
+		t.Errorf("expected overlapping bands to be rejected, got %v", err)
+	}
+}
+
+func TestSeededTestIsReproducible(t *testing.T) {
+	store := newRecordingDB()
+	for _, topic := range []string{"PHY_KINEMATICS", "PHY_OPTICS"} {
+		addPaperTemplates(store, "PHYSICS", topic, 4, 0.25, 0.55, 0.85)
+	}
+	generator := newTestGenerator(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), time.Second)
+
+	// paperContent drops what legitimately differs between runs, such as
+	// IDs and timings
+	paperContent := func(seed int64) []string {
+		t.Helper()
+		paper, err := generator.GenerateTest(context.Background(), service.TestBlueprint{
+			StudentID: "student_1",
+			ExamType:  "JEE_MAIN",
+			Format:    "NUMERICAL",
+			Sections:  []service.BlueprintSection{{Subject: "PHYSICS", Questions: 8, Topics: map[string]float64{"PHY_KINEMATICS": 1, "PHY_OPTICS": 1}}},
+			Seed:      seed,
+		})
+		if err != nil {
+			t.Fatalf("test generation failed: %v", err)
+		}
+		if paper.Seed != seed || len(paper.Questions) != 8 {
+			t.Fatalf("expected 8 questions with seed %d, got %d with seed %d", seed, len(paper.Questions), paper.Seed)
+		}
+		var content []string
+		for _, q := range paper.Questions {
+			content = append(content, fmt.Sprintf("%d %s %v %s %s %v %.4f", q.Number, q.TopicID,
+				q.Question.Metadata["template_id"], q.Question.QuestionText, q.Question.CorrectAnswer,
+				q.Question.Metadata["seed"], q.Question.Difficulty))
+		}
+		return content
+	}
+
+	first, second := paperContent(42), paperContent(42)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Errorf("question %d differs between runs with the same seed:\n%s\n%s", i+1, first[i], second[i])
+		}
+	}
+	if other := paperContent(43); strings.Join(other, "\n") == strings.Join(first, "\n") {
+		t.Error("expected a different seed to generate a different paper")
+	}
+}
+
+func TestDifficultyBandWidensWhenNothingMatches(t *testing.T) {
+	store := newRecordingDB()
+	distant := previewTemplate()
+	distant.BaseDifficulty = 0.75
+	store.addTemplate(distant)
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(bkt.Close)
+
+	generate := func(maxBand float64) (*service.GenerateQuestionResponse, error) {
+		t.Helper()
+		generator, err := service.NewGeneratorService(&config.AppConfig{
+			BKT:       config.BKTConfig{ServiceURL: bkt.URL, Timeout: time.Second},
+			Templates: config.TemplateConfig{MaxDifficultyBand: maxBand},
+		}, newFakeDBClient(t, store))
+		if err != nil {
+			t.Fatalf("failed to create generator service: %v", err)
+		}
+		return generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+			StudentID: "s1", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN", Subject: "PHYSICS",
+			Format: "NUMERICAL", RequestedDifficulty: 0.5, Seed: 1,
+		})
+	}
+
+	// Without widening only ±0.1 is searched
+	if _, err := generate(config.DifficultyBandStep); !errors.Is(err, templates.ErrNoTemplatesFound) {
+		t.Fatalf("expected no template within ±0.1, got %v", err)
+	}
+
+	resp, err := generate(0.3)
+	if err != nil {
+		t.Fatalf("expected widening to find the template 0.25 away, got %v", err)
+	}
+	if got := resp.Metadata["difficulty_band"]; got != 0.3 {
+		t.Errorf("expected the response to report band 0.3, got %v", got)
+	}
+	updates := store.generationLogUpdates()
+	if got := updates[len(updates)-1][17]; got != 0.3 { // difficulty_band
+		t.Errorf("expected the log to record band 0.3, got %v", got)
+	}
+
+	// A cap short of the template still fails, naming the band searched
+	if _, err := generate(0.2); err == nil || !strings.Contains(err.Error(), "widened to ±0.2") {
+		t.Fatalf("expected failure after widening to ±0.2, got %v", err)
+	}
+}
+
+func TestExamTypeFallbackServesAnotherExamsTemplate(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate()) // JEE_MAIN only
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(bkt.Close)
+
+	generate := func(fallbacks map[string][]string) (*service.GenerateQuestionResponse, error) {
+		t.Helper()
+		generator, err := service.NewGeneratorService(&config.AppConfig{
+			BKT:       config.BKTConfig{ServiceURL: bkt.URL, Timeout: time.Second},
+			Templates: config.TemplateConfig{ExamTypeFallbacks: fallbacks},
+		}, newFakeDBClient(t, store))
+		if err != nil {
+			t.Fatalf("failed to create generator service: %v", err)
+		}
+		return generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+			StudentID: "s1", TopicID: "PHY_KINEMATICS", ExamType: "FOUNDATION", Subject: "PHYSICS",
+			Format: "NUMERICAL", RequestedDifficulty: 0.5, Seed: 1,
+		})
+	}
+
+	if _, err := generate(nil); !errors.Is(err, templates.ErrNoTemplatesFound) {
+		t.Fatalf("expected no FOUNDATION template without a fallback, got %v", err)
+	}
+
+	resp, err := generate(map[string][]string{"FOUNDATION": {"NEET", "JEE_MAIN"}})
+	if err != nil {
+		t.Fatalf("expected the JEE_MAIN template to stand in, got %v", err)
+	}
+	if got := resp.Metadata["template_id"]; got != kinematicsTemplateID {
+		t.Errorf("expected the JEE_MAIN template, got %v", got)
+	}
+	if got := resp.Metadata["fallback_exam_type"]; got != "JEE_MAIN" {
+		t.Errorf("expected the response to report the JEE_MAIN fallback, got %v", got)
+	}
+	updates := store.generationLogUpdates()
+	if got := updates[len(updates)-1][20]; got != "JEE_MAIN" { // fallback_exam_type
+		t.Errorf("expected the log to record the JEE_MAIN fallback, got %v", got)
+	}
+
+	// Without a substitution the log records none
+	store.addTemplate(func() *db.QuestionTemplate {
+		qt := previewTemplate()
+		qt.TemplateID, qt.ExamType = "physics_kinematics_foundation", "FOUNDATION"
+		return qt
+	}())
+	if resp, err = generate(map[string][]string{"FOUNDATION": {"JEE_MAIN"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Metadata["template_id"] != "physics_kinematics_foundation" || resp.Metadata["fallback_exam_type"] != nil {
+		t.Errorf("expected the FOUNDATION template without a fallback, got %v", resp.Metadata)
+	}
+	updates = store.generationLogUpdates()
+	if got := updates[len(updates)-1][20]; got != nil {
+		t.Errorf("expected no fallback in the log, got %v", got)
+	}
+}
+
+func TestExamTypeFallbackWaitsForEveryDifficultyBand(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate()) // JEE_MAIN at the requested difficulty
+	distant := previewTemplate()
+	distant.TemplateID, distant.ExamType, distant.BaseDifficulty = unknownTemplateID, "FOUNDATION", 0.75
+	store.addTemplate(distant)
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(bkt.Close)
+
+	generate := func(maxBand float64) (*service.GenerateQuestionResponse, error) {
+		t.Helper()
+		generator, err := service.NewGeneratorService(&config.AppConfig{
+			BKT: config.BKTConfig{ServiceURL: bkt.URL, Timeout: time.Second},
+			Templates: config.TemplateConfig{
+				MaxDifficultyBand: maxBand,
+				ExamTypeFallbacks: map[string][]string{"FOUNDATION": {"JEE_MAIN"}},
+			},
+		}, newFakeDBClient(t, store))
+		if err != nil {
+			t.Fatalf("failed to create generator service: %v", err)
+		}
+		return generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+			StudentID: "s1", TopicID: "PHY_KINEMATICS", ExamType: "FOUNDATION", Subject: "PHYSICS",
+			Format: "NUMERICAL", RequestedDifficulty: 0.5, Seed: 1,
+		})
+	}
+
+	// The FOUNDATION template 0.25 away wins over the JEE_MAIN one at the
+	// requested difficulty, as it is found before falling back
+	resp, err := generate(0.3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Metadata["template_id"] != unknownTemplateID || resp.Metadata["fallback_exam_type"] != nil || resp.Metadata["difficulty_band"] != 0.3 {
+		t.Fatalf("expected the FOUNDATION template from band 0.3, got %v", resp.Metadata)
+	}
+
+	// Only once every band is exhausted does the fallback stand in, from
+	// its own narrowest band
+	if resp, err = generate(0.2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Metadata["template_id"] != kinematicsTemplateID || resp.Metadata["fallback_exam_type"] != "JEE_MAIN" || resp.Metadata["difficulty_band"] != nil {
+		t.Fatalf("expected the JEE_MAIN template without widening, got %v", resp.Metadata)
+	}
+}
+
+func TestHangingRAGOnlyTripsTheRAGStageTimeout(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+
+	release := make(chan struct{})
+	rag := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer rag.Close()
+	defer close(release)
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bkt.Close()
+
+	cfg := defaultConfig(t)
+	cfg.BKT.ServiceURL, cfg.BKT.Timeout, cfg.BKT.RetryCount = bkt.URL, time.Second, 0
+	cfg.RAG.ServiceURL, cfg.RAG.Timeout, cfg.RAG.MaxRetries = rag.URL, 10*time.Second, 0
+	cfg.Stages.RAG = 50 * time.Millisecond
+	generator, err := service.NewGeneratorService(cfg, newFakeDBClient(t, store))
+	if err != nil {
+		t.Fatalf("failed to create generator service: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	resp, err := generator.GenerateQuestion(ctx, &service.GenerateQuestionRequest{
+		StudentID: "student_1", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+		Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5,
+	})
+	if err != nil {
+		t.Fatalf("expected generation to proceed without RAG, got %v", err)
+	}
+	if resp.QuestionText == "" {
+		t.Fatal("expected a question despite the RAG timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the RAG stage to give up after its own timeout, took %v", elapsed)
+	}
+
+	updates := store.generationLogUpdates()
+	if len(updates) == 0 {
+		t.Fatal("expected the generation log to be updated")
+	}
+	if stages := updates[len(updates)-1][18]; stages != `{"rag"}` {
+		t.Errorf("expected only the rag stage to be recorded as timed out, got %v", stages)
+	}
+}
+
+func TestLatencyBudgetServesQuestionWithoutHangingRAG(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+
+	release := make(chan struct{})
+	rag := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer rag.Close()
+	defer close(release)
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bkt.Close()
+
+	cfg := defaultConfig(t)
+	cfg.BKT.ServiceURL, cfg.BKT.Timeout, cfg.BKT.RetryCount = bkt.URL, time.Second, 0
+	cfg.RAG.ServiceURL, cfg.RAG.Timeout, cfg.RAG.MaxRetries = rag.URL, 10*time.Second, 0
+	cfg.Stages.RAG = 5 * time.Second
+	cfg.Stages.MaxGenerationLatency = 200 * time.Millisecond
+	generator, err := service.NewGeneratorService(cfg, newFakeDBClient(t, store))
+	if err != nil {
+		t.Fatalf("failed to create generator service: %v", err)
+	}
+
+	start := time.Now()
+	resp, err := generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+		StudentID: "student_1", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+		Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5,
+	})
+	if err != nil {
+		t.Fatalf("expected the unchecked question to be served, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected generation to stop at the latency budget, took %v", elapsed)
+	}
+	if skipped, _ := resp.Metadata["skipped_stages"].([]string); !reflect.DeepEqual(skipped, []string{"rag"}) {
+		t.Errorf("expected the rag stage to be reported as skipped, got %v", resp.Metadata["skipped_stages"])
+	}
+
+	updates := store.generationLogUpdates()
+	if len(updates) == 0 {
+		t.Fatal("expected the generation log to be updated")
+	}
+	if stages := updates[len(updates)-1][19]; stages != `{"rag"}` {
+		t.Errorf("expected the rag stage to be logged as skipped, got %v", stages)
+	}
+}
+
+func TestLatencyBudgetFailsWhenNoQuestionIsReady(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+
+	release := make(chan struct{})
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer bkt.Close()
+	defer close(release)
+
+	cfg := defaultConfig(t)
+	cfg.BKT.ServiceURL, cfg.BKT.Timeout, cfg.BKT.RetryCount = bkt.URL, 10*time.Second, 0
+	cfg.Stages.Calibration = 5 * time.Second
+	cfg.Stages.MaxGenerationLatency = 150 * time.Millisecond
+	generator, err := service.NewGeneratorService(cfg, newFakeDBClient(t, store))
+	if err != nil {
+		t.Fatalf("failed to create generator service: %v", err)
+	}
+
+	start := time.Now()
+	_, err = generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+		StudentID: "student_1", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+		Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5,
+	})
+	if !errors.Is(err, service.ErrLatencyBudgetExceeded) {
+		t.Fatalf("expected ErrLatencyBudgetExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected generation to stop at the latency budget, took %v", elapsed)
+	}
+	if status := api.GenerationErrorStatus(err); status != http.StatusGatewayTimeout {
+		t.Errorf("expected status 504, got %d", status)
+	}
+}
+
+// failingValidator stands in for a validator that cannot run its checks
+type failingValidator struct{}
+
+func (failingValidator) ValidateQuestion(context.Context, validator.ValidationRequest) (*validator.ValidationResult, error) {
+	return nil, errors.New("grammar backend unavailable")
+}
+
+func generateWithFailingValidator(t *testing.T, policy string) (*service.GenerateQuestionResponse, *recordingDB, error) {
+	t.Helper()
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(bkt.Close)
+
+	cfg := defaultConfig(t)
+	cfg.BKT.ServiceURL, cfg.BKT.Timeout, cfg.BKT.RetryCount = bkt.URL, time.Second, 0
+	cfg.Validator.Policy = policy
+	generator, err := service.NewGeneratorService(cfg, newFakeDBClient(t, store))
+	if err != nil {
+		t.Fatalf("failed to create generator service: %v", err)
+	}
+	generator.UseValidator(failingValidator{})
+
+	resp, err := generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+		StudentID: "student_1", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+		Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5,
+	})
+	return resp, store, err
+}
+
+func TestStrictValidationPolicyFailsWhenTheValidatorErrors(t *testing.T) {
+	resp, _, err := generateWithFailingValidator(t, service.ValidationPolicyStrict)
+	if err == nil {
+		t.Fatalf("expected generation to fail, got %+v", resp)
+	}
+	if !strings.Contains(err.Error(), "VALIDATION_FAILED") {
+		t.Errorf("expected a VALIDATION_FAILED error, got %v", err)
+	}
+}
+
+func TestLenientValidationPolicyServesTheQuestionUnvalidated(t *testing.T) {
+	resp, store, err := generateWithFailingValidator(t, service.ValidationPolicyLenient)
+	if err != nil {
+		t.Fatalf("expected the question to be served, got %v", err)
+	}
+	if resp.QuestionText == "" {
+		t.Fatal("expected a question despite the validator failing")
+	}
+	if passed := resp.Metadata["validation_passed"]; passed != false {
+		t.Errorf("expected validation_passed false, got %v", passed)
+	}
+	if resp.QualityScore != 0 {
+		t.Errorf("expected no quality credit for an unvalidated question, got %v", resp.QualityScore)
+	}
+	if msg, _ := resp.Metadata["validation_error"].(string); !strings.Contains(msg, "grammar backend unavailable") {
+		t.Errorf("expected the validator error in the metadata, got %q", msg)
+	}
+	if len(store.generationLogUpdates()) == 0 {
+		t.Fatal("expected the generation log to be updated")
+	}
+
+	// The unvalidated question is queued for review
+	flags := store.flaggedQuestions()
+	if len(flags) != 1 || flags[0].QuestionID != resp.QuestionID || flags[0].Reason != db.FlagReasonValidationUnavailable ||
+		!strings.Contains(flags[0].Details, "grammar backend unavailable") {
+		t.Fatalf("expected a VALIDATION_UNAVAILABLE flag for %s, got %+v", resp.QuestionID, flags)
+	}
+	if reasons, _ := resp.Metadata["review_flags"].([]string); !reflect.DeepEqual(reasons, []string{db.FlagReasonValidationUnavailable}) {
+		t.Errorf("expected the review flag in the metadata, got %v", resp.Metadata["review_flags"])
+	}
+}
+
+func TestAnswerPrecisionPassesValidation(t *testing.T) {
+	template := unitKinematicsTemplate("s", "km/h")
+	precision := 3
+	template.AnswerPrecision = &precision
+	template.TopicID, template.ExamType, template.BaseDifficulty = "PHY_KINEMATICS", "JEE_MAIN", 0.5
+	store := newRecordingDB()
+	store.addTemplate(template)
+	generator := newTestGenerator(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), time.Second)
+
+	resp, err := generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+		StudentID: "student_1", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+		Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5, RequestID: "req-precision",
+	})
+	if err != nil {
+		t.Fatalf("generation failed: %v", err)
+	}
+	if resp.CorrectAnswer != "39.600 km/h" {
+		t.Fatalf("expected 11 m/s = 39.600 km/h, got %q", resp.CorrectAnswer)
+	}
+	// The validator allows the template's three decimal places, not two
+	if passed := resp.Metadata["validation_passed"]; passed != true {
+		t.Errorf("expected validation to pass, got %v: %v", passed, resp.Metadata["validation_error"])
+	}
+	if flags := store.flaggedQuestions(); len(flags) != 0 {
+		t.Errorf("expected no review flags, got %+v", flags)
+	}
+}
+
+// countingValidator passes every question, counting the calls
+type countingValidator struct{ calls int64 }
+
+func (v *countingValidator) ValidateQuestion(context.Context, validator.ValidationRequest) (*validator.ValidationResult, error) {
+	atomic.AddInt64(&v.calls, 1)
+	return &validator.ValidationResult{Passed: true, OverallScore: 0.9, Feedback: "ok"}, nil
+}
+
+func TestStageOverridesRequireTheExperimentScope(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bkt.Close()
+	var ragCalls int64
+	rag := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&ragCalls, 1)
+		json.NewEncoder(w).Encode(rag_advisor.QualityCheckResponse{AlignmentScore: 0.9})
+	}))
+	defer rag.Close()
+
+	cfg := defaultConfig(t)
+	cfg.BKT.ServiceURL, cfg.BKT.Timeout, cfg.BKT.RetryCount = bkt.URL, time.Second, 0
+	cfg.RAG.ServiceURL = rag.URL
+	generator, err := service.NewGeneratorService(cfg, newFakeDBClient(t, store))
+	if err != nil {
+		t.Fatalf("failed to create generator service: %v", err)
+	}
+	checks := &countingValidator{}
+	generator.UseValidator(checks)
+
+	m := api.NewMiddleware(api.MiddlewareConfig{
+		RateLimitPerMinute: 1000, TokenPrefix: "Bearer",
+		AdminToken: "admin-secret", ExperimentToken: "experiment-secret",
+	}, nil)
+	router := mux.NewRouter()
+	router.Use(m.ExperimentScope)
+	router.Handle("/v1/questions/generate", validator.ValidateGenerateQuestionRequest(api.GenerateQuestion(generator))).Methods("POST")
+	api.RegisterHandlers(router.PathPrefix("/v1").Subrouter(), generator)
+
+	const item = `{"student_id": "s1", "topic_id": "PHY_KINEMATICS", "exam_type": "JEE_MAIN",
+		"subject": "PHYSICS", "format": "NUMERICAL", "requested_difficulty": 0.5`
+	post := func(path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	calls := func() (int64, int64) { return atomic.LoadInt64(&ragCalls), atomic.LoadInt64(&checks.calls) }
+
+	// Ordinary clients cannot switch stages off
+	for _, token := range []string{"", "client-token"} {
+		if rec := post("/v1/questions/generate", token, item+`, "skip_rag": true}`); rec.Code != http.StatusForbidden ||
+			!strings.Contains(rec.Body.String(), "experiment scope") {
+			t.Errorf("token %q: expected 403 for skip_rag, got %d: %s", token, rec.Code, rec.Body.String())
+		}
+	}
+	rec := post("/v1/questions/generate/batch", "client-token", `{"requests": [`+item+`, "skip_validation": true}]}`)
+	var batch api.BatchGenerateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&batch); err != nil || batch.Failed != 1 ||
+		!strings.Contains(batch.Results[0].Error, "experiment scope") {
+		t.Errorf("expected the batch item to be refused inline, got %+v (%v)", batch, err)
+	}
+	if rag, validated := calls(); rag != 0 || validated != 0 {
+		t.Fatalf("expected refused requests not to generate, got %d RAG checks and %d validations", rag, validated)
+	}
+
+	generate := func(token, flags string) *service.GenerateQuestionResponse {
+		t.Helper()
+		rec := post("/v1/questions/generate", token, item+flags+"}")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("flags %q: expected 200, got %d: %s", flags, rec.Code, rec.Body.String())
+		}
+		var resp service.GenerateQuestionResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return &resp
+	}
+	recorded := func() []string {
+		t.Helper()
+		updates := store.generationLogUpdates()
+		var stages pq.StringArray
+		if err := stages.Scan(updates[len(updates)-1][21]); err != nil {
+			t.Fatalf("failed to read stage_overrides: %v", err)
+		}
+		return stages
+	}
+
+	// The experiment token skips both stages
+	resp := generate("experiment-secret", `, "skip_rag": true, "skip_validation": true`)
+	if rag, validated := calls(); rag != 0 || validated != 0 {
+		t.Errorf("expected both stages skipped, got %d RAG checks and %d validations", rag, validated)
+	}
+	if overrides, _ := resp.Metadata["stage_overrides"].([]interface{}); len(overrides) != 2 {
+		t.Errorf("expected stage_overrides [rag validation] in the metadata, got %v", resp.Metadata["stage_overrides"])
+	}
+	if _, ok := resp.Metadata["validation_error"]; ok {
+		t.Errorf("expected no validation error for a skipped validation, got %v", resp.Metadata["validation_error"])
+	}
+	if got := recorded(); !reflect.DeepEqual(got, []string{"rag", "validation"}) {
+		t.Errorf("expected stage_overrides [rag validation] in the log, got %v", got)
+	}
+
+	// The admin token holds the scope too
+	generate("admin-secret", `, "skip_validation": true`)
+	if rag, validated := calls(); rag != 1 || validated != 0 {
+		t.Errorf("expected only validation skipped, got %d RAG checks and %d validations", rag, validated)
+	}
+	if got := recorded(); !reflect.DeepEqual(got, []string{"validation"}) {
+		t.Errorf("expected stage_overrides [validation] in the log, got %v", got)
+	}
+
+	// Without overrides every stage runs and nothing is recorded
+	resp = generate("", "")
+	if rag, validated := calls(); rag != 2 || validated != 1 {
+		t.Errorf("expected every stage to run, got %d RAG checks and %d validations", rag, validated)
+	}
+	if _, ok := resp.Metadata["stage_overrides"]; ok || len(recorded()) != 0 {
+		t.Errorf("expected no stage overrides, got %v and %v", resp.Metadata["stage_overrides"], recorded())
+	}
+}
@@ -0,0 +1,1533 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"question-generator-service/api"
+	"question-generator-service/internal/config"
+	"question-generator-service/internal/db"
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/calibrator"
+	"question-generator-service/pkg/metrics"
+	"question-generator-service/pkg/templates"
+	"question-generator-service/pkg/validator"
+)
+
+// Template IDs are UUIDs, which the template routes insist on
+const (
+	kinematicsTemplateID = "0f8e7a52-3c1b-4d6e-9a27-5b4c3d2e1f60"
+	unknownTemplateID    = "5d1c9b0e-8f7a-4e6d-b3c2-a1f0e9d8c7b6"
+	brokenTemplateID     = "c3a1e2d4-7b6f-4a58-9e0d-1f2a3b4c5d6e"
+)
+
+func previewTemplate() *db.QuestionTemplate {
+	return &db.QuestionTemplate{
+		TemplateID:     kinematicsTemplateID,
+		TopicID:        "PHY_KINEMATICS",
+		ExamType:       "JEE_MAIN",
+		Subject:        "PHYSICS",
+		Format:         "NUMERICAL",
+		TemplateText:   "A car moving at {{v0}} m/s accelerates at {{a}} m/s^2 for {{t}} s. Find its final speed.",
+		VariableSlots:  `[{"name": "v0", "type": "integer", "range": {"min": 1, "max": 50}}, {"name": "a", "type": "integer", "range": {"min": 1, "max": 10}}, {"name": "t", "type": "integer", "range": {"min": 1, "max": 20}}]`,
+		RenderFormat:   "PLAIN",
+		BaseDifficulty: 0.5,
+		UsageCount:     7,
+	}
+}
+
+// newPreviewRouter wires the API handlers to a generator backed by store and
+// a BKT service that fails the test if it is called
+func newPreviewRouter(t *testing.T, store *recordingDB) *mux.Router {
+	t.Helper()
+	return newTestRouter(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected call to the BKT service at %s", r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+}
+
+// newTestRouter wires the API handlers to a generator backed by store and
+// the given fake BKT service
+func newTestRouter(t *testing.T, store *recordingDB, bktHandler http.Handler) *mux.Router {
+	t.Helper()
+	generator := newTestGenerator(t, store, bktHandler, time.Second)
+
+	router := mux.NewRouter()
+	api.RegisterHandlers(router.PathPrefix("/v1").Subrouter(), generator)
+	return router
+}
+
+// newTestGenerator builds a generator backed by store and the given fake BKT
+// service, whose client gives up after bktTimeout
+func newTestGenerator(t *testing.T, store *recordingDB, bktHandler http.Handler, bktTimeout time.Duration) *service.GeneratorService {
+	t.Helper()
+
+	bkt := httptest.NewServer(bktHandler)
+	t.Cleanup(bkt.Close)
+
+	cfg := &config.AppConfig{
+		BKT: config.BKTConfig{ServiceURL: bkt.URL, Timeout: bktTimeout},
+	}
+	generator, err := service.NewGeneratorService(cfg, newFakeDBClient(t, store))
+	if err != nil {
+		t.Fatalf("failed to create generator service: %v", err)
+	}
+	return generator
+}
+
+func postPreview(router http.Handler, templateID, body string) *httptest.ResponseRecorder {
+	return serve(router, http.MethodPost, "/v1/templates/"+templateID+"/preview", body)
+}
+
+func serve(router http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPreviewTemplateOnlyReadsTheTemplate(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	router := newPreviewRouter(t, store)
+
+	rec := postPreview(router, kinematicsTemplateID, `{"difficulty": 0.7, "seed": 42}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var preview service.TemplatePreviewResponse
+	if err := json.NewDecoder(rec.Body).Decode(&preview); err != nil {
+		t.Fatalf("failed to decode preview: %v", err)
+	}
+	if preview.Seed != 42 || preview.Difficulty != 0.7 {
+		t.Fatalf("expected seed 42 at difficulty 0.7, got seed %d at %v", preview.Seed, preview.Difficulty)
+	}
+	if preview.QuestionText == "" || strings.Contains(preview.QuestionText, "{{") {
+		t.Fatalf("template was not filled: %q", preview.QuestionText)
+	}
+	if preview.Validation == nil {
+		t.Fatal("expected validation feedback in the preview")
+	}
+
+	statements := store.recorded()
+	if len(statements) != 1 || !strings.HasPrefix(statements[0], "SELECT") {
+		t.Fatalf("expected a single template read, got %q", statements)
+	}
+}
+
+func TestPreviewTemplateIsReproducibleBySeed(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	router := newPreviewRouter(t, store)
+
+	first := postPreview(router, kinematicsTemplateID, `{"seed": 7}`)
+	second := postPreview(router, kinematicsTemplateID, `{"seed": 7}`)
+	if first.Code != http.StatusOK || second.Code != http.StatusOK {
+		t.Fatalf("expected 200s, got %d and %d", first.Code, second.Code)
+	}
+
+	var a, b service.TemplatePreviewResponse
+	json.NewDecoder(first.Body).Decode(&a)
+	json.NewDecoder(second.Body).Decode(&b)
+	if a.QuestionText != b.QuestionText || a.CorrectAnswer != b.CorrectAnswer {
+		t.Fatalf("same seed produced different previews:\n%s\n%s", a.QuestionText, b.QuestionText)
+	}
+	if a.Difficulty != 0.5 {
+		t.Fatalf("expected the template base difficulty 0.5, got %v", a.Difficulty)
+	}
+}
+
+func TestPreviewTemplateErrors(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	router := newPreviewRouter(t, store)
+
+	if rec := postPreview(router, unknownTemplateID, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown template, got %d", rec.Code)
+	}
+	if rec := postPreview(router, kinematicsTemplateID, `{"difficulty": 1.5}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for difficulty out of range, got %d", rec.Code)
+	}
+	if rec := postPreview(router, kinematicsTemplateID, `{"difficulty":`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a malformed body, got %d", rec.Code)
+	}
+
+	broken := previewTemplate()
+	broken.TemplateID = brokenTemplateID
+	broken.VariableSlots = `[{"name": "v0"`
+	store.addTemplate(broken)
+	if rec := postPreview(router, brokenTemplateID, ""); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a template that cannot be filled, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestTemplateRoutesRejectMalformedIDs(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	router := newPreviewRouter(t, store)
+	api.RegisterAdminHandlers(router.PathPrefix("/v1/admin").Subrouter(), newTestGenerator(t, store, http.NotFoundHandler(), time.Second))
+
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodGet, "/v1/templates/physics_kinematics_001", ""},
+		{http.MethodPut, "/v1/templates/physics_kinematics_001", "{}"},
+		{http.MethodDelete, "/v1/templates/physics_kinematics_001", ""},
+		{http.MethodPost, "/v1/templates/physics_kinematics_001/preview", ""},
+		{http.MethodPost, "/v1/admin/templates/physics_kinematics_001/analyze", ""},
+		{http.MethodPost, "/v1/admin/templates/physics_kinematics_001/golden", `{"seed": 1}`},
+		{http.MethodPost, "/v1/admin/templates/physics_kinematics_001/recompute-stats", ""},
+	} {
+		if rec := serve(router, tc.method, tc.path, tc.body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: expected 400, got %d: %s", tc.method, tc.path, rec.Code, rec.Body.String())
+		}
+	}
+	if statements := store.recorded(); len(statements) != 0 {
+		t.Fatalf("malformed template IDs reached the database: %q", statements)
+	}
+}
+
+func TestGenerationErrorsMapToStatusCodes(t *testing.T) {
+	unavailable := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	request := func() *service.GenerateQuestionRequest {
+		return &service.GenerateQuestionRequest{
+			StudentID:           "student-1",
+			TopicID:             "PHY_KINEMATICS",
+			ExamType:            "JEE_MAIN",
+			Subject:             "PHYSICS",
+			Format:              "NUMERICAL",
+			RequestedDifficulty: 0.5,
+		}
+	}
+
+	// No template covers the topic
+	empty := newTestGenerator(t, newRecordingDB(), unavailable, time.Second)
+	_, gapErr := empty.GenerateQuestion(context.Background(), request())
+	if !errors.Is(gapErr, templates.ErrNoTemplatesFound) {
+		t.Fatalf("expected ErrNoTemplatesFound, got %v", gapErr)
+	}
+
+	// The only template has malformed variable slots
+	store := newRecordingDB()
+	broken := previewTemplate()
+	broken.VariableSlots = `[{"name": "v0"`
+	store.addTemplate(broken)
+	_, invalidErr := newTestGenerator(t, store, unavailable, time.Second).GenerateQuestion(context.Background(), request())
+	if !errors.Is(invalidErr, templates.ErrTemplateInvalid) {
+		t.Fatalf("expected ErrTemplateInvalid, got %v", invalidErr)
+	}
+
+	// No template has Hindi text, which is a content gap too
+	english := newRecordingDB()
+	english.addTemplate(previewTemplate())
+	hindi := request()
+	hindi.Language = templates.LanguageHindi
+	_, hindiGapErr := newTestGenerator(t, english, unavailable, time.Second).GenerateQuestion(context.Background(), hindi)
+	if !errors.Is(hindiGapErr, templates.ErrNoTemplatesFound) || !strings.Contains(hindiGapErr.Error(), "language=hi") {
+		t.Fatalf("expected ErrNoTemplatesFound naming the language, got %v", hindiGapErr)
+	}
+
+	// A template asked for by ID, as by a preview, has no Hindi text
+	languageErr := templates.CheckLanguage(previewTemplate(), templates.LanguageHindi)
+
+	cases := []struct {
+		name    string
+		err     error
+		status  int
+		message string
+	}{
+		{"no templates", gapErr, http.StatusNotFound, "no templates found"},
+		{"invalid template", invalidErr, http.StatusUnprocessableEntity, "invalid template " + kinematicsTemplateID},
+		{"no Hindi templates", hindiGapErr, http.StatusNotFound, "no templates found"},
+		{"language unavailable", languageErr, http.StatusUnprocessableEntity, "template " + kinematicsTemplateID + " has no Hindi text"},
+		{"retry in progress", fmt.Errorf("%w for request req-1", service.ErrRetryInProgress), http.StatusConflict, "a retry of this request is in progress"},
+		{"server fault", fmt.Errorf("question generation failed at CALIBRATION_FAILED: %w", context.DeadlineExceeded), http.StatusInternalServerError, "question generation failed"},
+	}
+	for _, tc := range cases {
+		if got := api.GenerationErrorStatus(tc.err); got != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, got)
+		}
+
+		rec := httptest.NewRecorder()
+		api.WriteGenerationError(rec, tc.err)
+		var body api.ErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("%s: failed to decode error body: %v", tc.name, err)
+		}
+		if rec.Code != tc.status || !strings.Contains(body.Error.Message, tc.message) {
+			t.Errorf("%s: expected %d with %q, got %d with %q", tc.name, tc.status, tc.message, rec.Code, body.Error.Message)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	api.WriteGenerationError(rec, errors.New("pq: connection refused"))
+	if strings.Contains(rec.Body.String(), "pq:") {
+		t.Errorf("server faults must not leak error details, got %s", rec.Body.String())
+	}
+}
+
+const templateBody = `{
+	"topic_id": "PHY_KINEMATICS",
+	"exam_type": "JEE_MAIN",
+	"subject": "PHYSICS",
+	"format": "NUMERICAL",
+	"template_text": "A car moving at {{v0}} m/s accelerates at {{a}} m/s^2 for {{t}} s. Find its final speed.",
+	"variable_slots": [
+		{"name": "v0", "type": "integer", "range": {"min": 1, "max": 50}},
+		{"name": "a", "type": "integer", "range": {"min": 1, "max": 10}},
+		{"name": "t", "type": "integer", "range": {"min": 1, "max": 20}}
+	],
+	"answer_unit": "m/s",
+	"base_difficulty": 0.5,
+	"bloom_level": 3,
+	"concept_depth": 2,
+	"chapter": "Kinematics"
+}`
+
+func TestTemplateEndpointsRoundTrip(t *testing.T) {
+	store := newRecordingDB()
+	router := newPreviewRouter(t, store)
+
+	rec := serve(router, http.MethodPost, "/v1/templates", templateBody)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created api.TemplateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode created template: %v", err)
+	}
+	if created.TemplateID == "" || rec.Header().Get("Location") != "/v1/templates/"+created.TemplateID {
+		t.Fatalf("expected an ID and matching Location, got %q and %q", created.TemplateID, rec.Header().Get("Location"))
+	}
+
+	path := "/v1/templates/" + created.TemplateID
+	rec = serve(router, http.MethodGet, path, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 fetching the template, got %d", rec.Code)
+	}
+	var fetched api.TemplateResponse
+	json.NewDecoder(rec.Body).Decode(&fetched)
+	var slots []map[string]interface{}
+	if err := json.Unmarshal(fetched.VariableSlots, &slots); err != nil || len(slots) != 3 {
+		t.Fatalf("expected 3 variable slots as embedded JSON, got %s", fetched.VariableSlots)
+	}
+
+	updated := strings.Replace(templateBody, `"base_difficulty": 0.5`, `"base_difficulty": 0.8`, 1)
+	updated = strings.Replace(updated, `"answer_unit": "m/s",`, `"answer_unit": "m/s", "numerical_tolerance": {"absolute": 0.5},`, 1)
+	rec = serve(router, http.MethodPut, path, updated)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 updating the template, got %d: %s", rec.Code, rec.Body.String())
+	}
+	json.NewDecoder(rec.Body).Decode(&fetched)
+	if fetched.BaseDifficulty != 0.8 || fetched.Version != 2 {
+		t.Fatalf("expected difficulty 0.8 at version 2, got %v at %d", fetched.BaseDifficulty, fetched.Version)
+	}
+	if stored, _ := store.template(created.TemplateID); stored.NumericalTolerance == nil || stored.NumericalTolerance.Absolute != 0.5 {
+		t.Fatalf("expected the numerical tolerance to be stored, got %+v", stored.NumericalTolerance)
+	}
+
+	if rec = serve(router, http.MethodDelete, path, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting the template, got %d", rec.Code)
+	}
+	if rec = serve(router, http.MethodGet, path, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after deletion, got %d", rec.Code)
+	}
+	if stored, ok := store.template(created.TemplateID); !ok || stored.IsActive {
+		t.Fatal("expected the deleted template to remain stored as inactive")
+	}
+}
+
+func TestTemplateEndpointsRejectInvalidTemplates(t *testing.T) {
+	store := newRecordingDB()
+	router := newPreviewRouter(t, store)
+
+	invalid := strings.Replace(templateBody, `"range": {"min": 1, "max": 10}`, `"range": {"min": 10, "max": 1}`, 1)
+	invalid = strings.Replace(invalid, `"bloom_level": 3`, `"bloom_level": 9, "numerical_tolerance": {"relative": 1.5}`, 1)
+	rec := serve(router, http.MethodPost, "/v1/templates", invalid)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details []struct {
+				Field string `json:"field"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if body.Error.Code != "validation_failed" {
+		t.Errorf("expected code validation_failed, got %q", body.Error.Code)
+	}
+	fields := make(map[string]bool)
+	for _, f := range body.Error.Details {
+		fields[f.Field] = true
+	}
+	if !fields["variable_slots[1].range"] || !fields["bloom_level"] || !fields["numerical_tolerance.relative"] {
+		t.Fatalf("expected field errors for variable_slots[1].range, bloom_level and numerical_tolerance.relative, got %+v", body.Error.Details)
+	}
+	if len(store.recorded()) != 0 {
+		t.Fatalf("invalid template reached the database: %q", store.recorded())
+	}
+
+	if rec = serve(router, http.MethodPut, "/v1/templates/"+unknownTemplateID, templateBody); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 updating a missing template, got %d", rec.Code)
+	}
+}
+
+func TestGetQuestionReturnsStoredQuestion(t *testing.T) {
+	store := newRecordingDB()
+	router := newPreviewRouter(t, store)
+
+	err := newFakeDBClient(t, store).SaveGeneratedQuestion(context.Background(), &db.GeneratedQuestion{
+		QuestionID:    "q_req-1_1700000000",
+		TemplateID:    kinematicsTemplateID,
+		StudentID:     "student-1",
+		QuestionText:  "Which of the following is a vector quantity?",
+		Options:       db.StringMap{"A": "Speed", "B": "Velocity"},
+		CorrectAnswer: "Velocity",
+		SolutionSteps: db.StringList{"Velocity has magnitude and direction."},
+		Difficulty:    0.3,
+		Seed:          7,
+	})
+	if err != nil {
+		t.Fatalf("failed to store question: %v", err)
+	}
+
+	rec := serve(router, http.MethodGet, "/v1/questions/q_req-1_1700000000", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var question api.QuestionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&question); err != nil {
+		t.Fatalf("failed to decode question: %v", err)
+	}
+	if question.CorrectAnswer != "Velocity" || question.Options["B"] != "Velocity" || len(question.SolutionSteps) != 1 {
+		t.Fatalf("unexpected question: %+v", question)
+	}
+
+	if rec = serve(router, http.MethodGet, "/v1/questions/q_unknown", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown question, got %d", rec.Code)
+	}
+}
+
+func TestGetSolutionReturnsStoredSteps(t *testing.T) {
+	store := newRecordingDB()
+	router := newPreviewRouter(t, store)
+
+	steps := db.StringList{
+		"Step 1: Identify the given values: v0 = 5 m/s, a = 2 m/s^2, t = 3 s",
+		"Step 2: Apply the first equation of motion: v = u + at",
+		"Step 3: Substitute the values: v = 5 m/s + (2 m/s^2)(3 s) = 5 m/s + 6 m/s",
+		"Step 4: Final answer: v = 11 m/s",
+	}
+	err := newFakeDBClient(t, store).SaveGeneratedQuestion(context.Background(), &db.GeneratedQuestion{
+		QuestionID:    "q_req-2_1700000000",
+		TemplateID:    kinematicsTemplateID,
+		StudentID:     "student-1",
+		QuestionText:  "A body moving at 5 m/s accelerates at 2 m/s^2 for 3 s. Find its final velocity.",
+		CorrectAnswer: "11 m/s",
+		SolutionSteps: steps,
+		Difficulty:    0.5,
+		Seed:          11,
+	})
+	if err != nil {
+		t.Fatalf("failed to store question: %v", err)
+	}
+
+	rec := serve(router, http.MethodGet, "/v1/questions/q_req-2_1700000000/solution", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var solution api.SolutionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&solution); err != nil {
+		t.Fatalf("failed to decode solution: %v", err)
+	}
+	if solution.QuestionID != "q_req-2_1700000000" || solution.CorrectAnswer != "11 m/s" {
+		t.Fatalf("unexpected solution: %+v", solution)
+	}
+	if strings.Join(solution.SolutionSteps, "\n") != strings.Join(steps, "\n") {
+		t.Errorf("expected the stored steps, got %q", solution.SolutionSteps)
+	}
+
+	if rec = serve(router, http.MethodGet, "/v1/questions/q_unknown/solution", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown question, got %d", rec.Code)
+	}
+}
+
+func TestQueryLogsEndpoint(t *testing.T) {
+	store := newRecordingDB()
+	seedGenerationLogs(t, store)
+	router := newPreviewRouter(t, store)
+
+	rec := serve(router, http.MethodGet, "/v1/logs?student_id=student-1&limit=1", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "question_text") {
+		t.Errorf("expected a trimmed log without verbose, got %s", rec.Body.String())
+	}
+	var page api.GenerationLogsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("failed to decode logs: %v", err)
+	}
+	if len(page.Logs) != 1 || page.Logs[0].QuestionID != "q_seed-0" || page.NextCursor == "" {
+		t.Fatalf("expected the newest student-1 log and a cursor, got %+v", page)
+	}
+
+	rec = serve(router, http.MethodGet, "/v1/logs?student_id=student-1&limit=1&verbose=true&cursor="+page.NextCursor, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for the next page, got %d: %s", rec.Code, rec.Body.String())
+	}
+	page = api.GenerationLogsResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("failed to decode logs: %v", err)
+	}
+	if len(page.Logs) != 1 || page.Logs[0].QuestionID != "q_seed-2" || page.Logs[0].Status != "FAILED" ||
+		page.Logs[0].QuestionText != "Seeded question 2" || page.Logs[0].Options["A"] != "yes" {
+		t.Fatalf("expected the verbose FAILED log on the next page, got %+v", page)
+	}
+
+	rec = serve(router, http.MethodGet, "/v1/logs?since=2026-03-02T09:58:30Z&until=2026-03-02T10:00:00Z", "")
+	page = api.GenerationLogsResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil || len(page.Logs) != 1 || page.Logs[0].QuestionID != "q_seed-1" {
+		t.Fatalf("expected only q_seed-1 in the time range, got %+v, %v", page, err)
+	}
+
+	for _, query := range []string{"limit=0", "limit=500", "since=yesterday", "verbose=maybe", "cursor=bogus",
+		"since=2026-03-02T10:00:00Z&until=2026-03-02T09:00:00Z"} {
+		if rec := serve(router, http.MethodGet, "/v1/logs?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	store := newRecordingDB()
+	seedQualityTrends(t, store, time.Now())
+	router := newPreviewRouter(t, store)
+
+	rec := serve(router, http.MethodGet, "/v1/stats?window=24h", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var stats api.StatsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if stats.Window != "24h" || stats.Bucket != "hour" || len(stats.Series) < 24 {
+		t.Fatalf("expected an hourly series over 24h, got %+v", stats)
+	}
+	generations := 0
+	for _, point := range stats.Series {
+		generations += point.Generations
+		if (point.Generations > 0) != (point.AvgQualityScore != nil) {
+			t.Errorf("expected an average quality exactly for the buckets with generations, got %+v", point)
+		}
+	}
+	if generations != 3 {
+		t.Errorf("expected the 3 finished generations of the last 24h, got %d", generations)
+	}
+
+	rec = serve(router, http.MethodGet, "/v1/stats?window=72h&bucket=day", "")
+	stats = api.StatsResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil || stats.Bucket != "day" || len(stats.Series) < 3 {
+		t.Fatalf("expected a daily series, got %+v, %v", stats, err)
+	}
+
+	for _, query := range []string{"window=yesterday", "window=30m", "window=1000h", "bucket=week"} {
+		if rec := serve(router, http.MethodGet, "/v1/stats?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestListTemplatesEndpoint(t *testing.T) {
+	store := newRecordingDB()
+	seedSearchTemplates(t, store)
+	router := newPreviewRouter(t, store)
+
+	list := func(query string) api.TemplatesResponse {
+		t.Helper()
+		rec := serve(router, http.MethodGet, "/v1/templates?"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 for %s, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var page api.TemplatesResponse
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatalf("failed to decode templates: %v", err)
+		}
+		return page
+	}
+
+	page := list("q=" + url.QueryEscape("Maximum Height"))
+	if len(page.Templates) != 1 || page.Templates[0].TemplateID != throwTemplateID || page.Templates[0].NCERTReference == nil {
+		t.Fatalf("expected the free-text search to find the throw template, got %+v", page)
+	}
+
+	page = list("subject=PHYSICS&active=true&limit=1")
+	if len(page.Templates) != 1 || page.Templates[0].TemplateID != brakingTemplateID || page.NextCursor == "" {
+		t.Fatalf("expected the first active PHYSICS template and a cursor, got %+v", page)
+	}
+	page = list("subject=PHYSICS&active=true&limit=1&cursor=" + page.NextCursor)
+	if len(page.Templates) != 1 || page.Templates[0].TemplateID != throwTemplateID || page.NextCursor != "" {
+		t.Fatalf("expected the last active PHYSICS template on the next page, got %+v", page)
+	}
+
+	page = list("ncert=" + url.QueryEscape("class 11 physics") + "&bloom_level=2")
+	if len(page.Templates) != 1 || page.Templates[0].TemplateID != throwTemplateID {
+		t.Fatalf("expected the NCERT search to find the throw template, got %+v", page)
+	}
+
+	page = list("chapter=Kinematics&bloom_level=3&min_difficulty=0.6&max_difficulty=0.8")
+	if len(page.Templates) != 1 || page.Templates[0].TemplateID != accelerationTemplateID || page.Templates[0].IsActive {
+		t.Fatalf("expected the inactive acceleration template, got %+v", page)
+	}
+
+	for _, query := range []string{"limit=0", "limit=500", "bloom_level=7", "min_difficulty=1.5",
+		"min_difficulty=0.8&max_difficulty=0.2", "active=maybe", "cursor=!!",
+		"cursor=" + base64.RawURLEncoding.EncodeToString([]byte("phy_kin_001"))} {
+		if rec := serve(router, http.MethodGet, "/v1/templates?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestListTopicsEndpoint(t *testing.T) {
+	store := newRecordingDB()
+	seedSearchTemplates(t, store)
+	router := newPreviewRouter(t, store)
+
+	rec := serve(router, http.MethodGet, "/v1/topics?subject=PHYSICS&exam_type=JEE_MAIN", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp api.TopicsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode topics: %v", err)
+	}
+	want := []api.TopicResponse{{TopicID: "PHY_KINEMATICS", Subject: "PHYSICS", TemplateCount: 2, MinDifficulty: 0.3, MaxDifficulty: 0.5}}
+	if !reflect.DeepEqual(resp.Topics, want) {
+		t.Fatalf("expected %+v, got %+v", want, resp.Topics)
+	}
+
+	rec = serve(router, http.MethodGet, "/v1/topics?subject=BIOLOGY", "")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"topics":[]}` {
+		t.Fatalf("expected an empty topic list, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// fakeBKTUpdates records mastery updates and answers them with newMastery
+type fakeBKTUpdates struct {
+	mu         sync.Mutex
+	updates    []calibrator.MasteryUpdateRequest
+	newMastery float64
+}
+
+func (f *fakeBKTUpdates) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/update" {
+		http.NotFound(w, r)
+		return
+	}
+	var update calibrator.MasteryUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.updates = append(f.updates, update)
+	f.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "new_mastery_level": f.newMastery})
+}
+
+func (f *fakeBKTUpdates) last() calibrator.MasteryUpdateRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.updates[len(f.updates)-1]
+}
+
+func TestSubmitAnswerUpdatesMastery(t *testing.T) {
+	store := newRecordingDB()
+	bkt := &fakeBKTUpdates{newMastery: 0.64}
+	router := newTestRouter(t, store, bkt)
+
+	client := newFakeDBClient(t, store)
+	ctx := context.Background()
+	client.SaveGeneratedQuestion(ctx, &db.GeneratedQuestion{
+		QuestionID: "q_mcq", TemplateID: "t1", StudentID: "student-1",
+		QuestionText: "Which of the following is a vector quantity?", CorrectAnswer: "Velocity",
+		Options: db.StringMap{"A": "Speed", "B": "Velocity"}, Difficulty: 0.3,
+	})
+	client.SaveGeneratedQuestion(ctx, &db.GeneratedQuestion{
+		QuestionID: "q_num", TemplateID: "t2", StudentID: "student-1",
+		QuestionText: "Find the final speed.", CorrectAnswer: "11 m/s", Difficulty: 0.6,
+	})
+
+	rec := serve(router, http.MethodPost, "/v1/answers",
+		`{"student_id": "student-1", "question_id": "q_mcq", "topic_id": "PHY_VECTORS", "answer": "b", "response_time_ms": 4200}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result service.AnswerResult
+	json.NewDecoder(rec.Body).Decode(&result)
+	if !result.IsCorrect || result.MasteryLevel != 0.64 {
+		t.Fatalf("expected a correct answer and mastery 0.64, got %+v", result)
+	}
+	if update := bkt.last(); !update.IsCorrect || update.TopicID != "PHY_VECTORS" || update.ResponseTime != 4200 || update.Difficulty != 0.3 {
+		t.Fatalf("unexpected mastery update: %+v", update)
+	}
+
+	// 11.3 m/s is 2.7% off: a near miss earning partial credit
+	rec = serve(router, http.MethodPost, "/v1/answers",
+		`{"student_id": "student-1", "question_id": "q_num", "topic_id": "PHY_KINEMATICS", "answer": "11.3 m/s", "response_time_ms": 30000}`)
+	json.NewDecoder(rec.Body).Decode(&result)
+	if result.IsCorrect || result.PartialCredit <= 0 || result.PartialCredit >= 1 {
+		t.Fatalf("expected partial credit for a near miss, got %+v", result)
+	}
+	if update := bkt.last(); update.IsCorrect || update.PartialCredit != result.PartialCredit {
+		t.Fatalf("partial credit was not forwarded to BKT: %+v", update)
+	}
+
+	answers := store.submittedAnswers()
+	if len(answers) != 2 {
+		t.Fatalf("expected both answers to be stored, got %+v", answers)
+	}
+	if a := answers[0]; a.TemplateID != "t1" || !a.IsCorrect || a.ResponseTimeMs != 4200 || a.StudentID != "student-1" {
+		t.Errorf("unexpected stored MCQ answer: %+v", a)
+	}
+	if a := answers[1]; a.TemplateID != "t2" || a.IsCorrect || a.PartialCredit != result.PartialCredit {
+		t.Errorf("unexpected stored numerical answer: %+v", a)
+	}
+}
+
+func TestAdminRecomputeTemplateStats(t *testing.T) {
+	store := newRecordingDB()
+	seedSearchTemplates(t, store)
+	store.addTemplate(previewTemplate())
+	client := newFakeDBClient(t, store)
+	for _, a := range []db.AnswerSubmission{
+		{QuestionID: "q1", TemplateID: kinematicsTemplateID, StudentID: "student-1", IsCorrect: true, ResponseTimeMs: 20000},
+		{QuestionID: "q2", TemplateID: kinematicsTemplateID, StudentID: "student-2", IsCorrect: false, ResponseTimeMs: 40000},
+	} {
+		if err := client.SaveAnswerSubmission(context.Background(), &a); err != nil {
+			t.Fatalf("failed to seed answer: %v", err)
+		}
+	}
+
+	newAdminRouter := func(adminToken string) *mux.Router {
+		generator := newTestGenerator(t, store, http.NotFoundHandler(), time.Second)
+		m := api.NewMiddleware(api.MiddlewareConfig{RateLimitPerMinute: 1000, TokenPrefix: "Bearer", AdminToken: adminToken}, nil)
+		router := mux.NewRouter()
+		admin := router.PathPrefix("/v1/admin").Subrouter()
+		admin.Use(m.AdminAuth)
+		api.RegisterAdminHandlers(admin, generator)
+		return router
+	}
+	post := func(router http.Handler, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	router := newAdminRouter("admin-token-123")
+	for _, token := range []string{"", "wrong-token"} {
+		if rec := post(router, "/v1/admin/templates/"+kinematicsTemplateID+"/recompute-stats", token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 with token %q, got %d", token, rec.Code)
+		}
+	}
+	if rec := post(newAdminRouter(""), "/v1/admin/templates/"+kinematicsTemplateID+"/recompute-stats", "admin-token-123"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 while no admin token is configured, got %d", rec.Code)
+	}
+
+	rec := post(router, "/v1/admin/templates/"+kinematicsTemplateID+"/recompute-stats", "admin-token-123")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var stats api.TemplateStatsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if stats.Answers != 2 || stats.SuccessRate == nil || *stats.SuccessRate != 0.5 || stats.AvgSolveTime == nil || *stats.AvgSolveTime != 30 {
+		t.Fatalf("expected 2 answers, a 0.5 success rate and 30s solve time, got %+v", stats)
+	}
+
+	if rec := post(router, "/v1/admin/templates/"+unknownTemplateID+"/recompute-stats", "admin-token-123"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown template, got %d", rec.Code)
+	}
+
+	rec = post(router, "/v1/admin/templates/recompute-stats", "admin-token-123")
+	var all api.TemplateStatsListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&all); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("bulk recompute failed: %d, %v", rec.Code, err)
+	}
+	if len(all.Templates) != 5 || all.Templates[0].TemplateID != kinematicsTemplateID || all.Templates[0].Answers != 2 || all.Templates[1].SuccessRate != nil {
+		t.Fatalf("expected stats for every template, got %+v", all.Templates)
+	}
+}
+
+func TestReviewFlaggedQuestions(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	client := newFakeDBClient(t, store)
+	low := 0.42
+	for _, f := range []db.FlaggedQuestion{
+		{QuestionID: "q1", TemplateID: kinematicsTemplateID, Reason: db.FlagReasonLowRAGAlignment, Score: &low},
+		{QuestionID: "q2", TemplateID: kinematicsTemplateID, Reason: db.FlagReasonValidationUnavailable},
+		{QuestionID: "q3", TemplateID: kinematicsTemplateID, Reason: db.FlagReasonLowRAGAlignment},
+	} {
+		if err := client.CreateFlaggedQuestion(context.Background(), &f); err != nil {
+			t.Fatalf("failed to seed flag: %v", err)
+		}
+	}
+
+	generator := newTestGenerator(t, store, http.NotFoundHandler(), time.Second)
+	m := api.NewMiddleware(api.MiddlewareConfig{RateLimitPerMinute: 1000, TokenPrefix: "Bearer", AdminToken: "admin-token-123"}, nil)
+	router := mux.NewRouter()
+	review := router.PathPrefix("/v1/review").Subrouter()
+	review.Use(m.AdminAuth)
+	api.RegisterReviewHandlers(review, generator)
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-token-123")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	list := func(query string) api.FlaggedQuestionsResponse {
+		t.Helper()
+		rec := call(http.MethodGet, "/v1/review/flagged"+query, "")
+		var page api.FlaggedQuestionsResponse
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("listing %q failed: %d, %v", query, rec.Code, err)
+		}
+		return page
+	}
+
+	if rec := serve(router, http.MethodGet, "/v1/review/flagged", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the admin token, got %d", rec.Code)
+	}
+
+	// Pending flags are listed oldest first, a page at a time
+	page := list("?limit=2")
+	if len(page.Flags) != 2 || page.Flags[0].QuestionID != "q1" || *page.Flags[0].Score != 0.42 || page.NextCursor != "2" {
+		t.Fatalf("expected the first two flags and a cursor, got %+v", page)
+	}
+	if page = list("?cursor=" + page.NextCursor); len(page.Flags) != 1 || page.Flags[0].QuestionID != "q3" || page.NextCursor != "" {
+		t.Fatalf("expected the last flag on the second page, got %+v", page)
+	}
+	if page = list("?reason=VALIDATION_UNAVAILABLE"); len(page.Flags) != 1 || page.Flags[0].QuestionID != "q2" {
+		t.Fatalf("expected the reason filter to apply, got %+v", page)
+	}
+	for _, query := range []string{"?status=DONE", "?reason=SLOW", "?limit=0", "?cursor=x"} {
+		if rec := call(http.MethodGet, "/v1/review/flagged"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", query, rec.Code)
+		}
+	}
+
+	// Accepting leaves the template active
+	rec := call(http.MethodPost, "/v1/review/2", `{"verdict": "accept", "reviewer": "asha"}`)
+	var resolved api.FlaggedQuestionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resolved); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("accept failed: %d, %v", rec.Code, err)
+	}
+	if resolved.Status != db.FlagStatusAccepted || resolved.Reviewer == nil || *resolved.Reviewer != "asha" || resolved.ResolvedAt == nil {
+		t.Fatalf("expected an accepted flag, got %+v", resolved)
+	}
+	if qt, _ := store.template(kinematicsTemplateID); !qt.IsActive {
+		t.Fatal("expected accepting a flag to keep the template active")
+	}
+
+	// Rejecting deactivates the template in the same transaction
+	before := len(store.recorded())
+	if rec := call(http.MethodPost, "/v1/review/1", `{"verdict": "reject", "note": "answer is wrong"}`); rec.Code != http.StatusOK {
+		t.Fatalf("reject failed: %d: %s", rec.Code, rec.Body.String())
+	}
+	if qt, _ := store.template(kinematicsTemplateID); qt.IsActive {
+		t.Fatal("expected rejecting a flag to deactivate the template")
+	}
+	var statements []string
+	for _, statement := range store.recorded()[before:] {
+		switch {
+		case statement == "BEGIN", statement == "COMMIT", statement == "ROLLBACK":
+			statements = append(statements, statement)
+		case strings.Contains(statement, "UPDATE flagged_questions"):
+			statements = append(statements, "resolve flag")
+		case strings.Contains(statement, "SET is_active = false"):
+			statements = append(statements, "deactivate template")
+		}
+	}
+	if want := []string{"BEGIN", "resolve flag", "deactivate template", "COMMIT"}; !reflect.DeepEqual(statements, want) {
+		t.Fatalf("expected %v, got %v", want, statements)
+	}
+	// A second rejection for the same, now inactive, template still resolves
+	if rec := call(http.MethodPost, "/v1/review/3", `{"verdict": "reject"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected rejecting a flag of an inactive template to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, tc := range []struct {
+		path, body string
+		want       int
+	}{
+		{"/v1/review/1", `{"verdict": "accept"}`, http.StatusConflict},
+		{"/v1/review/99", `{"verdict": "accept"}`, http.StatusNotFound},
+		{"/v1/review/2", `{"verdict": "maybe"}`, http.StatusBadRequest},
+	} {
+		if rec := call(http.MethodPost, tc.path, tc.body); rec.Code != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.path, tc.body, tc.want, rec.Code)
+		}
+	}
+
+	if page = list(""); len(page.Flags) != 0 {
+		t.Fatalf("expected no pending flags, got %+v", page.Flags)
+	}
+	if page = list("?status=REJECTED"); len(page.Flags) != 2 || page.Flags[0].ReviewNote == nil || *page.Flags[0].ReviewNote != "answer is wrong" {
+		t.Fatalf("expected the rejected flags with their notes, got %+v", page.Flags)
+	}
+}
+
+func TestAdminAnalyzeTemplate(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	generator := newTestGenerator(t, store, http.NotFoundHandler(), time.Second)
+	router := mux.NewRouter()
+	api.RegisterAdminHandlers(router.PathPrefix("/v1/admin").Subrouter(), generator)
+
+	rec := serve(router, http.MethodPost, "/v1/admin/templates/"+kinematicsTemplateID+"/analyze", `{"samples": 40}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var report templates.VarietyReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if report.Samples != 40 || report.Difficulty != 0.5 || report.LowVariety {
+		t.Fatalf("expected 40 samples at the base difficulty and no flag, got %+v", report)
+	}
+
+	if rec := serve(router, http.MethodPost, "/v1/admin/templates/"+unknownTemplateID+"/analyze", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown template, got %d", rec.Code)
+	}
+	for _, body := range []string{`{"samples": 5}`, `{"samples": 5000}`, `{"difficulty": 1.5}`, `{`} {
+		if rec := serve(router, http.MethodPost, "/v1/admin/templates/"+kinematicsTemplateID+"/analyze", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", body, rec.Code)
+		}
+	}
+}
+
+func TestAdminGoldenQuestion(t *testing.T) {
+	store := newRecordingDB()
+	golden := goldenKinematicsTemplate()
+	golden.TemplateID = kinematicsTemplateID
+	store.addTemplate(golden)
+	generator, err := service.NewGeneratorService(&config.AppConfig{
+		BKT:       config.BKTConfig{ServiceURL: "http://bkt.invalid", Timeout: time.Second},
+		Templates: config.TemplateConfig{GoldenDir: t.TempDir()},
+	}, newFakeDBClient(t, store))
+	if err != nil {
+		t.Fatalf("failed to create generator service: %v", err)
+	}
+	router := mux.NewRouter()
+	api.RegisterAdminHandlers(router.PathPrefix("/v1/admin").Subrouter(), generator)
+
+	check := func(body string) templates.GoldenResult {
+		t.Helper()
+		rec := serve(router, http.MethodPost, "/v1/admin/templates/"+kinematicsTemplateID+"/golden", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result templates.GoldenResult
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatalf("failed to decode golden result: %v", err)
+		}
+		return result
+	}
+
+	if result := check(`{"seed": 42}`); result.Status != templates.GoldenCreated || result.Golden.Seed != 42 ||
+		result.Golden.Difficulty != goldenKinematicsTemplate().BaseDifficulty {
+		t.Fatalf("expected the first check to store the fixture, got %+v", result)
+	}
+	if result := check(`{"seed": 42}`); result.Status != templates.GoldenMatched || len(result.Diffs) != 0 {
+		t.Fatalf("expected the same question again, got %+v", result)
+	}
+
+	drifted := goldenKinematicsTemplate()
+	drifted.TemplateID = kinematicsTemplateID
+	formula := "{{v0}} - {{a}} * {{t}}"
+	drifted.AnswerFormula = &formula
+	store.addTemplate(drifted)
+	result := check(`{"seed": 42}`)
+	if result.Status != templates.GoldenDrifted || !reflect.DeepEqual(result.Diffs, []string{"correct_answer", "solution_steps"}) ||
+		result.Golden.CorrectAnswer == result.Current.CorrectAnswer {
+		t.Fatalf("expected the formula change to be reported as drift, got %+v", result)
+	}
+	if result := check(`{"seed": 42, "update": true}`); result.Status != templates.GoldenUpdated || len(result.Diffs) != 2 {
+		t.Fatalf("expected the fixture to be overwritten, got %+v", result)
+	}
+	if result := check(`{"seed": 42}`); result.Status != templates.GoldenMatched {
+		t.Fatalf("expected the updated fixture to match, got %+v", result)
+	}
+
+	if rec := serve(router, http.MethodPost, "/v1/admin/templates/"+unknownTemplateID+"/golden", `{"seed": 1}`); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown template, got %d", rec.Code)
+	}
+	for _, body := range []string{`{}`, `{"seed": 1, "difficulty": 2}`, `{`} {
+		if rec := serve(router, http.MethodPost, "/v1/admin/templates/"+kinematicsTemplateID+"/golden", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", body, rec.Code)
+		}
+	}
+}
+
+func TestSubmitAnswerGradesWithTemplateTolerance(t *testing.T) {
+	store := newRecordingDB()
+	qt := previewTemplate()
+	qt.NumericalTolerance = &db.NumericalTolerance{Absolute: 0.5}
+	store.addTemplate(qt)
+	bkt := &fakeBKTUpdates{newMastery: 0.5}
+	router := newTestRouter(t, store, bkt)
+
+	newFakeDBClient(t, store).SaveGeneratedQuestion(context.Background(), &db.GeneratedQuestion{
+		QuestionID: "q_num", TemplateID: qt.TemplateID, StudentID: "student-1",
+		QuestionText: "Find the final speed.", CorrectAnswer: "11 m/s", Difficulty: 0.6,
+	})
+
+	// Full credit within 0.5 m/s, falling to zero at 2.5 m/s; 12 m/s would
+	// earn nothing under the default 1% tolerance
+	for _, tc := range []struct {
+		answer  string
+		correct bool
+		credit  float64
+	}{
+		{"11 m/s", true, 1},
+		{"11.4", true, 1},
+		{"12 m/s", false, 0.75},
+		{"14 m/s", false, 0},
+	} {
+		rec := serve(router, http.MethodPost, "/v1/answers",
+			`{"student_id": "student-1", "question_id": "q_num", "topic_id": "PHY_KINEMATICS", "answer": "`+tc.answer+`"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tc.answer, rec.Code, rec.Body.String())
+		}
+		var result service.AnswerResult
+		json.NewDecoder(rec.Body).Decode(&result)
+		if result.IsCorrect != tc.correct || math.Abs(result.PartialCredit-tc.credit) > 1e-9 {
+			t.Errorf("%s: expected correct=%v with credit %v, got %+v", tc.answer, tc.correct, tc.credit, result)
+		}
+		if update := bkt.last(); update.PartialCredit != result.PartialCredit {
+			t.Errorf("%s: partial credit was not forwarded to BKT: %+v", tc.answer, update)
+		}
+	}
+}
+
+func TestSubmitAnswerErrors(t *testing.T) {
+	store := newRecordingDB()
+	router := newTestRouter(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown student", http.StatusBadRequest)
+	}))
+	newFakeDBClient(t, store).SaveGeneratedQuestion(context.Background(), &db.GeneratedQuestion{
+		QuestionID: "q_num", TemplateID: "t2", StudentID: "student-1",
+		QuestionText: "Find the final speed.", CorrectAnswer: "11 m/s", Difficulty: 0.6,
+	})
+
+	for _, tc := range []struct {
+		body string
+		code int
+	}{
+		{`{"student_id": "student-1", "question_id": "q_num", "topic_id": "PHY_KINEMATICS"}`, http.StatusBadRequest},
+		{`{"student_id": "student-1", "question_id": "q_missing", "topic_id": "PHY_KINEMATICS", "answer": "11"}`, http.StatusNotFound},
+		{`{"student_id": "student-1", "question_id": "q_num", "topic_id": "PHY_KINEMATICS", "answer": "11"}`, http.StatusBadGateway},
+	} {
+		if rec := serve(router, http.MethodPost, "/v1/answers", tc.body); rec.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d", tc.body, tc.code, rec.Code)
+		}
+	}
+}
+
+func TestGenerateQuestionDebugAddsValidationBreakdown(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	// BKT being down makes the calibrator fall back to the requested difficulty
+	generator := newTestGenerator(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), time.Second)
+	router := mux.NewRouter()
+	router.Handle("/v1/questions/generate", validator.ValidateGenerateQuestionRequest(api.GenerateQuestion(generator))).Methods("POST")
+
+	generate := func(path string) map[string]interface{} {
+		t.Helper()
+		rec := serve(router, http.MethodPost, path, `{"student_id": "s1", "topic_id": "PHY_KINEMATICS", "exam_type": "JEE_MAIN",
+			"subject": "PHYSICS", "format": "NUMERICAL", "requested_difficulty": 0.5}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Metadata map[string]interface{} `json:"metadata"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", path, err)
+		}
+		return resp.Metadata
+	}
+
+	if _, ok := generate("/v1/questions/generate")["validation_breakdown"]; ok {
+		t.Error("expected no validation breakdown without the debug flag")
+	}
+	if _, ok := generate("/v1/questions/generate?debug=false")["validation_breakdown"]; ok {
+		t.Error("expected no validation breakdown with debug=false")
+	}
+
+	breakdown, ok := generate("/v1/questions/generate?debug=true")["validation_breakdown"].(map[string]interface{})
+	if !ok {
+		t.Fatal("expected a validation breakdown with debug=true")
+	}
+	for _, key := range []string{"grammar_score", "clarity_score", "ambiguity_score", "validation_score", "validation_passed"} {
+		if _, ok := breakdown[key]; !ok {
+			t.Errorf("expected %s in the breakdown, got %v", key, breakdown)
+		}
+	}
+	if feedback, _ := breakdown["feedback"].([]interface{}); len(feedback) == 0 {
+		t.Errorf("expected the individual feedback strings, got %v", breakdown["feedback"])
+	}
+	if _, ok := breakdown["rag_alignment_score"]; ok {
+		t.Errorf("expected no RAG alignment score while RAG is disabled, got %v", breakdown)
+	}
+}
+
+func TestGenerateQuestionRequestIDs(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	// BKT being down makes the calibrator fall back to the requested difficulty
+	generator := newTestGenerator(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), time.Second)
+	router := mux.NewRouter()
+	router.Handle("/v1/questions/generate", validator.ValidateGenerateQuestionRequest(api.GenerateQuestion(generator))).Methods("POST")
+
+	generate := func(requestID string) *httptest.ResponseRecorder {
+		body := `{"student_id": "s1", "topic_id": "PHY_KINEMATICS", "exam_type": "JEE_MAIN",
+			"subject": "PHYSICS", "format": "NUMERICAL", "requested_difficulty": 0.5`
+		if requestID != "" {
+			body += `, "request_id": "` + requestID + `"`
+		}
+		return serve(router, http.MethodPost, "/v1/questions/generate", body+"}")
+	}
+	echoed := func(rec *httptest.ResponseRecorder) string {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp service.GenerateQuestionResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return resp.RequestID
+	}
+
+	if got := echoed(generate("req_s1_3_1700000000000")); got != "req_s1_3_1700000000000" {
+		t.Errorf("expected the client's request ID echoed back, got %q", got)
+	}
+	generated := echoed(generate(""))
+	if _, err := uuid.Parse(generated); err != nil {
+		t.Errorf("expected a generated UUID for a request without an ID, got %q", generated)
+	}
+	if again := echoed(generate("")); again == generated {
+		t.Errorf("expected every request without an ID to get its own, got %q twice", again)
+	}
+
+	for _, bad := range []string{"req 1", "req/1", "req_é", strings.Repeat("r", validator.MaxRequestIDLength+1)} {
+		rec := generate(bad)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"field":"request_id"`) {
+			t.Errorf("request ID %q: expected a 400 naming request_id, got %d: %s", bad, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestGenerateQuestionIsIdempotentByBodyRequestID(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	generator := newTestGenerator(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), time.Second)
+	m := api.NewMiddleware(api.MiddlewareConfig{RateLimitPerMinute: 1000}, nil)
+	router := mux.NewRouter()
+	router.Use(m.RequestLogger)
+	router.Handle("/v1/questions/generate", validator.ValidateGenerateQuestionRequest(api.GenerateQuestion(generator))).Methods("POST")
+
+	// Each attempt carries its own correlation ID, as a client retrying
+	// without X-Request-ID gets a fresh one from RequestLogger
+	generate := func(correlationID string) (*httptest.ResponseRecorder, service.GenerateQuestionResponse) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/v1/questions/generate", strings.NewReader(
+			`{"student_id": "s1", "topic_id": "PHY_KINEMATICS", "exam_type": "JEE_MAIN", "subject": "PHYSICS",
+			"format": "NUMERICAL", "requested_difficulty": 0.5, "request_id": "req-body-1"}`))
+		if correlationID != "" {
+			req.Header.Set("X-Request-ID", correlationID)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp service.GenerateQuestionResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return rec, resp
+	}
+
+	firstRec, first := generate("")
+	if firstRec.Header().Get(api.IdempotentReplayHeader) != "" {
+		t.Fatal("expected the first request to generate")
+	}
+	secondRec, second := generate("trace-retry")
+	if secondRec.Header().Get(api.IdempotentReplayHeader) != "true" || second.QuestionID != first.QuestionID {
+		t.Fatalf("expected the retry to replay %s, got %s with %s=%q", first.QuestionID, second.QuestionID,
+			api.IdempotentReplayHeader, secondRec.Header().Get(api.IdempotentReplayHeader))
+	}
+	if got := secondRec.Header().Get("X-Request-ID"); got != "trace-retry" {
+		t.Errorf("expected the correlation ID echoed back, got %q", got)
+	}
+
+	if genLog := studentLog(t, generator, "s1"); genLog.RequestID != "req-body-1" {
+		t.Errorf("expected the generation log under the body's request_id, got %q", genLog.RequestID)
+	}
+}
+
+func TestGenerateQuestionInBothLanguages(t *testing.T) {
+	store := newRecordingDB()
+	template := previewTemplate()
+	textHi := "एक कार {{v0}} m/s की चाल से चलते हुए {{t}} s तक {{a}} m/s^2 से त्वरित होती है। उसकी अंतिम चाल ज्ञात कीजिए।"
+	template.TemplateTextHi = &textHi
+	store.addTemplate(template)
+	// BKT being down makes the calibrator fall back to the requested difficulty
+	generator := newTestGenerator(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), time.Second)
+	router := mux.NewRouter()
+	router.Handle("/v1/questions/generate", validator.ValidateGenerateQuestionRequest(api.GenerateQuestion(generator))).Methods("POST")
+
+	generate := func(language string) *httptest.ResponseRecorder {
+		return serve(router, http.MethodPost, "/v1/questions/generate", `{"student_id": "s1", "topic_id": "PHY_KINEMATICS",
+			"exam_type": "JEE_MAIN", "subject": "PHYSICS", "format": "NUMERICAL", "requested_difficulty": 0.5, "language": "`+language+`"}`)
+	}
+
+	rec := generate("both")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp service.GenerateQuestionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	english, hindi := resp.Bodies["en"], resp.Bodies["hi"]
+	if len(resp.Bodies) != 2 || english.QuestionText != resp.QuestionText || !strings.HasPrefix(hindi.QuestionText, "एक कार ") {
+		t.Fatalf("expected English and Hindi bodies, got %+v", resp.Bodies)
+	}
+	if resp.Metadata["language"] != "both" {
+		t.Errorf("expected language both in the metadata, got %v", resp.Metadata["language"])
+	}
+	// Both bodies ask about the same car
+	for _, number := range regexp.MustCompile(`\d+`).FindAllString(english.QuestionText, -1) {
+		if !strings.Contains(hindi.QuestionText, number) {
+			t.Errorf("expected the Hindi text to use the value %s too, got %q", number, hindi.QuestionText)
+		}
+	}
+
+	// Templates without Hindi text are never selected for Hindi, however
+	// much they would be preferred otherwise
+	englishOnly := previewTemplate()
+	englishOnly.TemplateID, englishOnly.UsageCount = unknownTemplateID, 1000
+	store.addTemplate(englishOnly)
+	for i := 0; i < 5; i++ {
+		rec := generate("hi")
+		var resp service.GenerateQuestionResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("expected a Hindi question, got %d: %v", rec.Code, err)
+		}
+		if resp.Metadata["template_id"] != kinematicsTemplateID {
+			t.Fatalf("expected the template with Hindi text, got %v", resp.Metadata["template_id"])
+		}
+	}
+
+	if rec := generate("fr"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"field":"language"`) {
+		t.Errorf("expected a 400 naming language, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGenerateBatchReportsFailuresInline(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+	// BKT being down makes the calibrator fall back to the requested difficulty
+	router := newTestRouter(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	item := func(studentID, topicID string) string {
+		return `{"student_id": "` + studentID + `", "topic_id": "` + topicID + `", "exam_type": "JEE_MAIN",
+			"subject": "PHYSICS", "format": "NUMERICAL", "requested_difficulty": 0.5}`
+	}
+	body := `{"requests": [` + item("s1", "PHY_KINEMATICS") + `, ` + item("s2", "PHY_UNKNOWN") + `, ` + item("s3", "PHY_KINEMATICS") + `]}`
+
+	rec := serve(router, http.MethodPost, "/v1/questions/generate/batch", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp api.BatchGenerateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode batch response: %v", err)
+	}
+
+	if len(resp.Results) != 3 || resp.Succeeded != 2 || resp.Failed != 1 {
+		t.Fatalf("expected 2 of 3 to succeed, got %+v", resp)
+	}
+	for i, result := range resp.Results {
+		if result.Index != i {
+			t.Fatalf("result %d reports index %d; order was not preserved", i, result.Index)
+		}
+	}
+	if failed := resp.Results[1]; failed.Question != nil || !strings.Contains(failed.Error, "no templates found") {
+		t.Fatalf("expected the unknown topic to fail inline, got %+v", failed)
+	}
+	for _, i := range []int{0, 2} {
+		if q := resp.Results[i].Question; q == nil || q.QuestionText == "" || resp.Results[i].Error != "" {
+			t.Fatalf("expected result %d to hold a question, got %+v", i, resp.Results[i])
+		}
+		if q := resp.Results[i].Question; q.RequestID == "" {
+			t.Errorf("expected result %d to carry a generated request ID", i)
+		}
+	}
+}
+
+func TestSeededBatchIsReproducible(t *testing.T) {
+	store := newRecordingDB()
+	addPaperTemplates(store, "PHYSICS", "PHY_KINEMATICS", 4, 0.5)
+	router := newTestRouter(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	item := `{"student_id": "s1", "topic_id": "PHY_KINEMATICS", "exam_type": "JEE_MAIN",
+		"subject": "PHYSICS", "format": "NUMERICAL", "requested_difficulty": 0.5}`
+	body := `{"seed": 7, "requests": [` + item + `, {"student_id": "s1"}, ` + item + `]}`
+
+	generate := func() api.BatchGenerateResponse {
+		t.Helper()
+		rec := serve(router, http.MethodPost, "/v1/questions/generate/batch", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp api.BatchGenerateResponse
+		decoder := json.NewDecoder(rec.Body)
+		decoder.UseNumber() // Seeds don't survive a float64
+		if err := decoder.Decode(&resp); err != nil {
+			t.Fatalf("failed to decode batch response: %v", err)
+		}
+		if resp.Succeeded != 2 {
+			t.Fatalf("expected 2 of 3 to succeed, got %+v", resp)
+		}
+		return resp
+	}
+
+	first, second := generate(), generate()
+	for _, i := range []int{0, 2} {
+		a, b := first.Results[i].Question, second.Results[i].Question
+		if a.QuestionText != b.QuestionText || a.Metadata["template_id"] != b.Metadata["template_id"] {
+			t.Errorf("item %d differs between runs: %q from %v and %q from %v", i, a.QuestionText, a.Metadata["template_id"], b.QuestionText, b.Metadata["template_id"])
+		}
+		// The invalid item still counts towards the index seeds derive from
+		if want := fmt.Sprint(service.DeriveSeed(7, i)); fmt.Sprint(a.Metadata["seed"]) != want {
+			t.Errorf("expected item %d to be generated with seed %s, got %v", i, want, a.Metadata["seed"])
+		}
+	}
+}
+
+func TestGenerateBatchRejectsOversizedBatch(t *testing.T) {
+	router := newPreviewRouter(t, newRecordingDB())
+
+	items := make([]string, 51)
+	for i := range items {
+		items[i] = `{"student_id": "s1"}`
+	}
+	rec := serve(router, http.MethodPost, "/v1/questions/generate/batch", `{"requests": [`+strings.Join(items, ",")+`]}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for 51 requests, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestValidateQuestionScoresAuthoredQuestions(t *testing.T) {
+	store := newRecordingDB()
+	router := newPreviewRouter(t, store)
+
+	validate := func(body string) service.QuestionValidationResponse {
+		t.Helper()
+		rec := serve(router, http.MethodPost, "/v1/questions/validate", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp service.QuestionValidationResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode validation response: %v", err)
+		}
+		return resp
+	}
+
+	clean := validate(`{"question_text": "What is the SI unit of force?", "options": {"A": "newton", "B": "joule", "C": "watt", "D": "pascal"},
+		"correct_answer": "A", "subject": "PHYSICS", "exam_type": "JEE_MAIN"}`)
+	if !clean.Passed || clean.Validation.AmbiguityScore != 0 || clean.FinalQualityScore < 0.7 {
+		t.Errorf("expected the clean question to pass, got %+v with %+v", clean, clean.Validation)
+	}
+
+	flawed := validate(`{"question_text": "Which material is usually a better conductor of heat", "options": {"A": "copper", "B": "glass"},
+		"correct_answer": "A", "subject": "PHYSICS", "exam_type": "JEE_MAIN"}`)
+	if flawed.Passed || flawed.Validation.AmbiguityScore == 0 || flawed.FinalQualityScore >= clean.FinalQualityScore {
+		t.Errorf("expected the flawed question to fail with a lower score, got %+v with %+v", flawed, flawed.Validation)
+	}
+	for _, want := range []string{"missing punctuation", "usually", "better"} {
+		if !strings.Contains(flawed.Feedback, want) {
+			t.Errorf("expected the feedback to mention %q, got %q", want, flawed.Feedback)
+		}
+	}
+
+	if len(store.recorded()) != 0 {
+		t.Errorf("expected validation not to touch the database, got %q", store.recorded())
+	}
+	if rec := serve(router, http.MethodPost, "/v1/questions/validate", `{"question_text": "Why?", "correct_answer": "A", "subject": "HISTORY", "exam_type": "JEE_MAIN"}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "subject") {
+		t.Errorf("expected 400 for an unknown subject, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// dialTestStream opens a test generation stream on server, through the
+// metrics and compression middleware the service runs behind
+func dialTestStream(t *testing.T, router *mux.Router) *websocket.Conn {
+	t.Helper()
+	router.Use(metrics.MetricsMiddleware, api.CompressResponses)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/tests/generate/stream"
+	conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Accept-Encoding": {"gzip"}})
+	if err != nil {
+		t.Fatalf("failed to open the stream: %v (%+v)", err, resp)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	return conn
+}
+
+func TestStreamGenerateTestReportsProgress(t *testing.T) {
+	store := newRecordingDB()
+	addPaperTemplates(store, "PHYSICS", "PHY_KINEMATICS", 3, 0.25, 0.55, 0.85)
+	addPaperTemplates(store, "CHEMISTRY", "CHEM_BONDING", 3, 0.25, 0.55, 0.85)
+	conn := dialTestStream(t, newTestRouter(t, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})))
+
+	err := conn.WriteJSON(service.TestBlueprint{
+		StudentID: "student_1",
+		ExamType:  "JEE_MAIN",
+		Format:    "NUMERICAL",
+		Sections: []service.BlueprintSection{
+			{Subject: "PHYSICS", Questions: 3, Topics: map[string]float64{"PHY_KINEMATICS": 1}},
+			{Subject: "CHEMISTRY", Questions: 2, Topics: map[string]float64{"CHEM_BONDING": 1}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to send the blueprint: %v", err)
+	}
+
+	numbers := make(map[int]bool)
+	var summary *api.TestStreamMessage
+	for summary == nil {
+		var message api.TestStreamMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("stream ended before the summary: %v", err)
+		}
+		switch message.Type {
+		case api.StreamMessageProgress:
+			event := message.PaperProgress
+			if event.Status != service.PaperSlotGenerated || event.QualityScore <= 0 {
+				t.Errorf("expected slot %d generated with a quality score, got %+v", event.Number, event)
+			}
+			if event.Completed != len(numbers)+1 || event.Total != 5 {
+				t.Errorf("expected progress %d of 5, got %d of %d", len(numbers)+1, event.Completed, event.Total)
+			}
+			numbers[event.Number] = true
+		case api.StreamMessageSummary:
+			summary = &message
+		default:
+			t.Fatalf("unexpected message %+v", message)
+		}
+	}
+
+	if len(numbers) != 5 {
+		t.Errorf("expected a progress message for each of the 5 slots, got %v", numbers)
+	}
+	if paper := summary.Paper; paper == nil || len(paper.Questions) != 5 || paper.Summary.Generated != 5 {
+		t.Fatalf("expected the summary to carry the 5 question paper, got %+v", paper)
+	}
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("expected the server to close the stream normally, got %v", err)
+	}
+}
+
+func TestStreamGenerateTestRejectsInvalidBlueprint(t *testing.T) {
+	conn := dialTestStream(t, newPreviewRouter(t, newRecordingDB()))
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"student_id": "s1", "exam_type": "JEE_MAIN", "sections": [{"subject": "BIOLOGY", "questions": 5, "topics": {"BIO_1": 1}}]}`)); err != nil {
+		t.Fatalf("failed to send the blueprint: %v", err)
+	}
+	var message api.TestStreamMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("expected an error message, got %v", err)
+	}
+	if message.Type != api.StreamMessageError || !strings.Contains(message.Error, "JEE_MAIN exam does not include BIOLOGY") {
+		t.Errorf("expected the blueprint problem to be reported, got %+v", message)
+	}
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("expected the stream closed as a policy violation, got %v", err)
+	}
+}
+
+func TestGenerateTestRejectsInvalidBlueprint(t *testing.T) {
+	router := newPreviewRouter(t, newRecordingDB())
+
+	for _, tc := range []struct {
+		name, body, want string
+	}{
+		{"unknown subject", `{"student_id": "s1", "exam_type": "JEE_MAIN", "sections": [{"subject": "HISTORY", "questions": 5, "topics": {"HIS_1": 1}}]}`, "sections[0].subject"},
+		{"biology in JEE Main", `{"student_id": "s1", "exam_type": "JEE_MAIN", "sections": [{"subject": "BIOLOGY", "questions": 5, "topics": {"BIO_1": 1}}]}`, "JEE_MAIN exam does not include BIOLOGY"},
+		{"no questions", `{"student_id": "s1", "exam_type": "JEE_MAIN", "sections": [{"subject": "PHYSICS", "questions": 0, "topics": {"PHY_KINEMATICS": 1}}]}`, "questions must be at least 1"},
+		{"too many questions", `{"student_id": "s1", "exam_type": "JEE_MAIN", "sections": [{"subject": "PHYSICS", "questions": 201, "topics": {"PHY_KINEMATICS": 1}}]}`, "at most 200 questions"},
+		{"bad band", `{"student_id": "s1", "exam_type": "JEE_MAIN", "sections": [{"subject": "PHYSICS", "questions": 5, "topics": {"PHY_KINEMATICS": 1}}], "difficulty_distribution": [{"min": 0.6, "max": 0.3, "weight": 1}]}`, "min below max"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(router, http.MethodPost, "/v1/tests/generate", tc.body)
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tc.want) {
+				t.Fatalf("expected 400 mentioning %q, got %d: %s", tc.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
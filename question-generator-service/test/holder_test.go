@@ -0,0 +1,138 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"question-generator-service/api"
+	"question-generator-service/internal/config"
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/rag_advisor"
+)
+
+// defaultConfig loads the built-in defaults, ignoring the environment
+func defaultConfig(t *testing.T) *config.AppConfig {
+	t.Helper()
+	clearEnv(t, "CONFIG_FILE", "DB_HOST", "RAG_ALIGNMENT_THRESHOLD", "RATE_LIMIT_PER_MINUTE", "RATE_LIMIT_BURST",
+		"RATE_LIMIT_PATH_OVERRIDES", "LOG_LEVEL", "TEMPLATE_WEIGHT_DIFFICULTY", "TEMPLATE_WEIGHT_FRESHNESS")
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("failed to load default config: %v", err)
+	}
+	return cfg
+}
+
+func TestHolderAppliesOnlyTunableSettings(t *testing.T) {
+	holder := config.NewHolder(defaultConfig(t))
+
+	next := defaultConfig(t)
+	next.RAG.AlignmentThreshold = 0.6
+	next.Logging.Level = "debug"
+	next.Database.Host = "elsewhere"
+
+	changes, err := holder.Apply(next)
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected the threshold and log level to change, got %v", changes)
+	}
+	current := holder.Get()
+	if current.RAG.AlignmentThreshold != 0.6 || current.Logging.Level != "debug" {
+		t.Fatalf("tunable settings were not applied: %+v", current)
+	}
+	if current.Database.Host != "localhost" {
+		t.Fatalf("database host must not change at runtime, got %q", current.Database.Host)
+	}
+
+	// An invalid reload keeps the current settings
+	bad := defaultConfig(t)
+	bad.Templates.Scoring.Difficulty = 0.9
+	if _, err := holder.Apply(bad); err == nil {
+		t.Fatal("expected weights that do not sum to 1.0 to be rejected")
+	}
+	if holder.Get() != current {
+		t.Fatal("a rejected reload replaced the configuration")
+	}
+}
+
+func TestThresholdReloadTakesEffectWithoutRestart(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+
+	var ragCalls int64
+	rag := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&ragCalls, 1)
+		json.NewEncoder(w).Encode(rag_advisor.QualityCheckResponse{AlignmentScore: 0.75})
+	}))
+	defer rag.Close()
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bkt.Close()
+
+	cfg := defaultConfig(t)
+	cfg.BKT.ServiceURL, cfg.BKT.Timeout, cfg.BKT.RetryCount = bkt.URL, time.Second, 0
+	cfg.RAG.ServiceURL, cfg.RAG.MaxRetries, cfg.RAG.AlignmentThreshold = rag.URL, 2, 0.8
+	generator, err := service.NewGeneratorService(cfg, newFakeDBClient(t, store))
+	if err != nil {
+		t.Fatalf("failed to create generator service: %v", err)
+	}
+
+	generate := func() int64 {
+		atomic.StoreInt64(&ragCalls, 0)
+		_, err := generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+			StudentID: "student_1", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+			Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5,
+		})
+		if err != nil {
+			t.Fatalf("generation failed: %v", err)
+		}
+		return atomic.LoadInt64(&ragCalls)
+	}
+
+	if calls := generate(); calls != 3 {
+		t.Fatalf("expected 0.75 to miss the 0.8 threshold on all 3 attempts, got %d checks", calls)
+	}
+
+	next := defaultConfig(t)
+	next.RAG.AlignmentThreshold = 0.7
+	if _, err := generator.Settings().Apply(next); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if calls := generate(); calls != 1 {
+		t.Fatalf("expected 0.75 to clear the reloaded 0.7 threshold at once, got %d checks", calls)
+	}
+}
+
+func TestRateLimitReloadTakesEffectWithoutRestart(t *testing.T) {
+	cfg := defaultConfig(t)
+	cfg.RateLimit.PerMinute, cfg.RateLimit.Burst, cfg.RateLimit.PathOverrides = 1, 1, nil
+	holder := config.NewHolder(cfg)
+
+	middleware := api.NewMiddleware(api.MiddlewareConfig{Settings: holder}, nil)
+	handler := middleware.RateLimitByIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	status := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/templates/x", nil))
+		return rec.Code
+	}
+
+	if first, second := status(), status(); first != http.StatusOK || second != http.StatusTooManyRequests {
+		t.Fatalf("expected 200 then 429 at 1/min, got %d then %d", first, second)
+	}
+
+	next := defaultConfig(t)
+	next.RateLimit.PerMinute, next.RateLimit.Burst = 1000, 100
+	if _, err := holder.Apply(next); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if code := status(); code != http.StatusOK {
+		t.Fatalf("expected the reloaded limit to admit the request, got %d", code)
+	}
+}
@@ -0,0 +1,111 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"question-generator-service/internal/config"
+	"question-generator-service/pkg/logging"
+)
+
+// decodeEntries parses one JSON object per line of buf
+func decodeEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestLoggerFiltersBelowConfiguredLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := logging.NewWithWriter(config.LoggingConfig{Level: "warn", Format: "json"}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Debug("debug entry")
+	l.Info("info entry")
+	l.Warn("warn entry")
+	l.Error("error entry")
+
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 2 || entries[0]["msg"] != "warn entry" || entries[1]["msg"] != "error entry" {
+		t.Fatalf("expected only warn and error entries, got %v", entries)
+	}
+
+	buf.Reset()
+	if err := l.SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	l.Debug("debug entry")
+	if entries := decodeEntries(t, &buf); len(entries) != 1 {
+		t.Fatalf("expected debug entry after lowering the level, got %v", entries)
+	}
+
+	if err := l.SetLevel("verbose"); err == nil {
+		t.Error("expected an unknown level to be rejected")
+	}
+}
+
+func TestRequestLoggerCarriesRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := logging.NewWithWriter(config.LoggingConfig{Level: "info", Format: "json"}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := logging.WithRequestID(logging.NewContext(context.Background(), l.SugaredLogger), "req-42")
+	logging.FromContext(ctx).Warnw("template usage update failed", "template_id", "T1")
+
+	if got := logging.RequestID(ctx); got != "req-42" {
+		t.Errorf("expected request ID req-42 from context, got %q", got)
+	}
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 1 {
+		t.Fatalf("expected one entry, got %v", entries)
+	}
+	entry := entries[0]
+	for _, field := range []string{"time", "level", "msg", "request_id", "template_id"} {
+		if _, ok := entry[field]; !ok {
+			t.Errorf("expected field %q in %v", field, entry)
+		}
+	}
+	if entry["request_id"] != "req-42" || entry["level"] != "WARN" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+}
+
+func TestLoggerConsoleFormatAndFileOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	l, err := logging.New(config.LoggingConfig{Level: "info", Format: "console", Output: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Infow("server listening", "port", 8080)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := string(data)
+	if strings.HasPrefix(line, "{") || !strings.Contains(line, "\tINFO\tserver listening\t") || !strings.Contains(line, `{"port": 8080}`) {
+		t.Errorf("expected a console-format entry in the log file, got %q", line)
+	}
+}
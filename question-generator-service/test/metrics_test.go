@@ -0,0 +1,254 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"question-generator-service/api"
+	"question-generator-service/pkg/metrics"
+)
+
+// scrapeMetric fetches /metrics and returns the value of the series whose
+// name and labels exactly match the given selector, e.g.
+// `question_generator_requests_total{status="success"}`.
+func scrapeMetric(t *testing.T, selector string) float64 {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scrape returned status %d", rec.Code)
+	}
+
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.LastIndex(line, " ")
+		if idx < 0 || line[:idx] != selector {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[idx+1:], 64)
+		if err != nil {
+			t.Fatalf("parse value for %s: %v", selector, err)
+		}
+		return value
+	}
+	return 0
+}
+
+func TestMetricsEndpointCountsRequests(t *testing.T) {
+	handler := metrics.MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	const selector = `question_generator_requests_total{status="success"}`
+	before := scrapeMetric(t, selector)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if after := scrapeMetric(t, selector); after != before+1 {
+		t.Fatalf("expected %s to increase by 1, got %v -> %v", selector, before, after)
+	}
+}
+
+func TestMetricsEndpointCountsFailures(t *testing.T) {
+	handler := metrics.MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+
+	const selector = `question_generator_requests_total{status="failed"}`
+	before := scrapeMetric(t, selector)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/questions/generate", nil))
+
+	if after := scrapeMetric(t, selector); after != before+1 {
+		t.Fatalf("expected %s to increase by 1, got %v -> %v", selector, before, after)
+	}
+}
+
+func TestPipelineCountersAreExported(t *testing.T) {
+	const selector = "question_generator_bkt_calls_total"
+	before := scrapeMetric(t, selector)
+
+	metrics.IncrementBKTCalls()
+
+	if after := scrapeMetric(t, selector); after != before+1 {
+		t.Fatalf("expected %s to increase by 1, got %v -> %v", selector, before, after)
+	}
+}
+
+func TestRequestDurationHistogramBuckets(t *testing.T) {
+	handler := metrics.MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(60 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	bucket := func(le string) string {
+		return `question_generator_request_duration_ms_bucket{exam_type="none",subject="none",le="` + le + `"}`
+	}
+	before50 := scrapeMetric(t, bucket("50"))
+	before2500 := scrapeMetric(t, bucket("2500"))
+	const count = `question_generator_request_duration_ms_count{exam_type="none",subject="none"}`
+	beforeCount := scrapeMetric(t, count)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if got := scrapeMetric(t, bucket("50")); got != before50 {
+		t.Fatalf("60ms request must not land in the 50ms bucket: %v -> %v", before50, got)
+	}
+	if got := scrapeMetric(t, bucket("2500")); got != before2500+1 {
+		t.Fatalf("expected 2500ms bucket to increase by 1, got %v -> %v", before2500, got)
+	}
+	if got := scrapeMetric(t, count); got != beforeCount+1 {
+		t.Fatalf("expected histogram count to increase by 1, got %v -> %v", beforeCount, got)
+	}
+}
+
+func TestPipelineStageHistogramBuckets(t *testing.T) {
+	bucket := func(stage, le string) string {
+		return `question_generator_pipeline_stage_duration_ms_bucket{stage="` + stage + `",le="` + le + `"}`
+	}
+	beforeTemplate := scrapeMetric(t, bucket("template", "5"))
+	beforeRAG100 := scrapeMetric(t, bucket("rag", "100"))
+	beforeRAG250 := scrapeMetric(t, bucket("rag", "250"))
+
+	metrics.ObservePipelineBreakdown(map[string]int64{
+		"template_ms": 3,
+		"rag_ms":      120,
+	})
+
+	if got := scrapeMetric(t, bucket("template", "5")); got != beforeTemplate+1 {
+		t.Fatalf("expected template 5ms bucket to increase by 1, got %v -> %v", beforeTemplate, got)
+	}
+	if got := scrapeMetric(t, bucket("rag", "100")); got != beforeRAG100 {
+		t.Fatalf("120ms rag stage must not land in the 100ms bucket: %v -> %v", beforeRAG100, got)
+	}
+	if got := scrapeMetric(t, bucket("rag", "250")); got != beforeRAG250+1 {
+		t.Fatalf("expected rag 250ms bucket to increase by 1, got %v -> %v", beforeRAG250, got)
+	}
+}
+
+func TestGenerationMetricsLabelledByExamAndSubject(t *testing.T) {
+	cases := []struct {
+		examType, subject         string
+		wantExamType, wantSubject string
+	}{
+		{"NEET", "BIOLOGY", "NEET", "BIOLOGY"},
+		{"JEE_MAIN", "PHYSICS", "JEE_MAIN", "PHYSICS"},
+		{"CAT", "ECONOMICS", "other", "other"},
+	}
+
+	for _, tc := range cases {
+		handler := metrics.MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			metrics.SetRequestLabels(r.Context(), tc.examType, tc.subject)
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		labels := `{exam_type="` + tc.wantExamType + `",subject="` + tc.wantSubject + `"}`
+		generated := "question_generator_questions_generated_total" + labels
+		observed := "question_generator_request_duration_ms_count" + labels
+		beforeGenerated := scrapeMetric(t, generated)
+		beforeObserved := scrapeMetric(t, observed)
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/questions/generate", nil))
+
+		if got := scrapeMetric(t, generated); got != beforeGenerated+1 {
+			t.Errorf("%s/%s: expected %s to increase by 1, got %v -> %v", tc.examType, tc.subject, generated, beforeGenerated, got)
+		}
+		if got := scrapeMetric(t, observed); got != beforeObserved+1 {
+			t.Errorf("%s/%s: expected %s to increase by 1, got %v -> %v", tc.examType, tc.subject, observed, beforeObserved, got)
+		}
+	}
+}
+
+func TestWriteSummaryReportOnShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	server := &http.Server{Handler: metrics.MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	// A request is still in flight when shutdown begins
+	before, _ := metrics.GetMetricsSummary()["total_requests"].(int64)
+	responded := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/health")
+		if err == nil {
+			resp.Body.Close()
+		}
+		responded <- err
+	}()
+	<-started
+	time.AfterFunc(20*time.Millisecond, func() { close(release) })
+
+	// The directory does not exist yet, as on a fresh volume
+	path := filepath.Join(t.TempDir(), "reports", "metrics.json")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	api.Shutdown(ctx, server, path)
+
+	if err := <-responded; err != nil {
+		t.Errorf("expected the in-flight request to be served during shutdown: %v", err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("expected the server to be closed, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	var report metrics.SummaryReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("decode report %s: %v", data, err)
+	}
+	if !report.StartedAt.Equal(metrics.StartTime) {
+		t.Errorf("expected started_at %v, got %v", metrics.StartTime, report.StartedAt)
+	}
+	if report.WrittenAt.Before(report.StartedAt) {
+		t.Errorf("written_at %v is before started_at %v", report.WrittenAt, report.StartedAt)
+	}
+	if _, err := time.ParseDuration(report.Uptime); err != nil {
+		t.Errorf("uptime %q is not a duration: %v", report.Uptime, err)
+	}
+	// Written after the drain, the report counts the in-flight request
+	if total, ok := report.Metrics["total_requests"].(float64); !ok || total < float64(before+1) {
+		t.Errorf("expected total_requests of at least %d, got %v", before+1, report.Metrics["total_requests"])
+	}
+	for _, key := range []string{"uptime_seconds", "successful_requests", "success_rate"} {
+		if _, ok := report.Metrics[key]; !ok {
+			t.Errorf("report is missing metric %q", key)
+		}
+	}
+
+	// Only the report is left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("list report directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the report in its directory, got %d entries", len(entries))
+	}
+}
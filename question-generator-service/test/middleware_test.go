@@ -0,0 +1,625 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"question-generator-service/api"
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/logging"
+	"question-generator-service/pkg/validator"
+)
+
+func TestRateLimiterAllowsBurstThenDenies(t *testing.T) {
+	rl := api.NewRateLimiter(60, 5)
+
+	for i := 0; i < 5; i++ {
+		if !rl.Allow("client") {
+			t.Fatalf("request %d within burst was denied", i+1)
+		}
+	}
+
+	allowed, wait := rl.Reserve("client")
+	if allowed {
+		t.Fatal("request beyond burst was allowed")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Fatalf("expected wait in (0, 1s] at 1 token/s, got %s", wait)
+	}
+
+	if !rl.Allow("other-client") {
+		t.Fatal("keys must not share a bucket")
+	}
+}
+
+func TestMemoryBackendKeepsBucketsAcrossLimitChanges(t *testing.T) {
+	backend := api.NewMemoryRateLimiterBackend()
+	reserve := func(limit api.RateLimit) bool {
+		t.Helper()
+		allowed, _, err := backend.Reserve(context.Background(), "ip:client", limit)
+		if err != nil {
+			t.Fatalf("reserve failed: %v", err)
+		}
+		return allowed
+	}
+
+	limit := api.RateLimit{PerMinute: 1, Burst: 2}
+	if !reserve(limit) || !reserve(limit) || reserve(limit) {
+		t.Fatal("expected the burst of 2 to be admitted, then a denial")
+	}
+	// A reload changing the rate must not hand out a fresh bucket
+	if reserve(api.RateLimit{PerMinute: 2, Burst: 2}) {
+		t.Fatal("expected the exhausted bucket to survive a rate change")
+	}
+	// A raised burst adds only its extra room
+	raised := api.RateLimit{PerMinute: 2, Burst: 3}
+	if !reserve(raised) || reserve(raised) {
+		t.Fatal("expected one more token from the raised burst, then a denial")
+	}
+
+	// Limits are not kept per value, so repeated reloads start no limiters
+	before := runtime.NumGoroutine()
+	for i := int64(1); i <= 50; i++ {
+		reserve(api.RateLimit{PerMinute: i, Burst: i})
+	}
+	if after := runtime.NumGoroutine(); after >= before+50 {
+		t.Errorf("expected no goroutine per limit, went from %d to %d", before, after)
+	}
+}
+
+func TestRateLimiterLongRunRateUnderContention(t *testing.T) {
+	const (
+		ratePerMinute = 600 // 10 tokens per second
+		burst         = 5
+		workers       = 32
+		runFor        = 1500 * time.Millisecond
+	)
+	rl := api.NewRateLimiter(ratePerMinute, burst)
+
+	var allowed int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline := start.Add(runFor)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				if rl.Allow("hammered") {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start).Seconds()
+	expected := burst + elapsed*ratePerMinute/60
+	if got := float64(atomic.LoadInt64(&allowed)); math.Abs(got-expected) > 3 {
+		t.Fatalf("allowed %v requests in %.2fs, expected about %.1f", got, elapsed, expected)
+	}
+}
+
+func TestRateLimitByIPSetsRetryAfter(t *testing.T) {
+	m := api.NewMiddleware(api.MiddlewareConfig{RateLimitPerMinute: 6, RateLimitBurst: 1}, nil)
+	handler := m.RateLimitByIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.RemoteAddr = "203.0.113.7:5555"
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, req)
+	if first.Code != http.StatusOK {
+		t.Fatalf("first request: expected 200, got %d", first.Code)
+	}
+
+	second := httptest.NewRecorder()
+	handler.ServeHTTP(second, req)
+	if second.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: expected 429, got %d", second.Code)
+	}
+	// 6 per minute refills one token every 10 seconds
+	retryAfter, err := strconv.Atoi(second.Header().Get("Retry-After"))
+	if err != nil {
+		t.Fatalf("invalid Retry-After header %q: %v", second.Header().Get("Retry-After"), err)
+	}
+	if retryAfter < 9 || retryAfter > 10 {
+		t.Fatalf("expected Retry-After of about 10s, got %d", retryAfter)
+	}
+}
+
+func TestLimitConcurrencyRejectsExcessInFlightRequests(t *testing.T) {
+	const maxInFlight, clients = 3, 8
+	m := api.NewMiddleware(api.MiddlewareConfig{RateLimitPerMinute: 1000, MaxInFlightPerKey: maxInFlight}, nil)
+
+	entered := make(chan struct{}, clients)
+	release := make(chan struct{})
+	handler := m.LimitConcurrency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/questions/generate", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var wg sync.WaitGroup
+	codes := make(chan *httptest.ResponseRecorder, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- request("203.0.113.7:5555")
+		}()
+	}
+
+	// The excess requests are rejected at once, while the admitted ones
+	// are still being served
+	var rejected []*httptest.ResponseRecorder
+	for len(rejected) < clients-maxInFlight {
+		select {
+		case rec := <-codes:
+			rejected = append(rejected, rec)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d rejected requests, got %d", clients-maxInFlight, len(rejected))
+		}
+	}
+	for i := 0; i < maxInFlight; i++ {
+		<-entered
+	}
+	for _, rec := range rejected {
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Errorf("expected 429 with Retry-After, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+
+	// Other clients have their own slots
+	other := make(chan *httptest.ResponseRecorder, 1)
+	go func() { other <- request("198.51.100.2:4444") }()
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected another client to be admitted while the first is at its limit")
+	}
+
+	close(release)
+	wg.Wait()
+	close(codes)
+	for rec := range codes {
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected the admitted requests to succeed, got %d", rec.Code)
+		}
+	}
+	if rec := <-other; rec.Code != http.StatusOK {
+		t.Errorf("expected the other client's request to succeed, got %d", rec.Code)
+	}
+
+	// Finished requests free their slots
+	if rec := request("203.0.113.7:5555"); rec.Code != http.StatusOK {
+		t.Fatalf("expected a slot once the earlier requests finished, got %d", rec.Code)
+	}
+}
+
+func TestCompressResponsesGzipsLargeBodies(t *testing.T) {
+	items := make([]map[string]interface{}, 200)
+	for i := range items {
+		items[i] = map[string]interface{}{"question_id": fmt.Sprintf("q_%d", i), "question_text": "A car accelerates from rest."}
+	}
+	large, err := json.Marshal(map[string]interface{}{"questions": items})
+	if err != nil {
+		t.Fatalf("failed to marshal body: %v", err)
+	}
+	handler := api.CompressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(large)
+		case "/tiny":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":"ok"}`))
+		case "/encoded":
+			w.Header().Set("Content-Encoding", "br")
+			w.Write(large)
+		}
+	}))
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/large", "br, gzip")
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("expected a gzipped response varying on Accept-Encoding, got headers %v", rec.Header())
+	}
+	if rec.Body.Len() >= len(large) {
+		t.Errorf("expected the gzipped body to be smaller than %d bytes, got %d", len(large), rec.Body.Len())
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("invalid gzip body: %v", err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil || !bytes.Equal(body, large) {
+		t.Fatalf("expected the decompressed body to match the original, got %d bytes, %v", len(body), err)
+	}
+
+	for _, tt := range []struct{ name, path, acceptEncoding string }{
+		{"not requested", "/large", ""},
+		{"refused", "/large", "gzip;q=0, identity"},
+		{"tiny body", "/tiny", "gzip"},
+		{"already encoded", "/encoded", "gzip"},
+	} {
+		rec := get(tt.path, tt.acceptEncoding)
+		if rec.Header().Get("Content-Encoding") == "gzip" {
+			t.Errorf("%s: expected no gzip encoding, got headers %v", tt.name, rec.Header())
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: expected Vary: Accept-Encoding, got %q", tt.name, rec.Header().Get("Vary"))
+		}
+		if tt.path == "/large" && !bytes.Equal(rec.Body.Bytes(), large) {
+			t.Errorf("%s: expected the body untouched, got %d bytes", tt.name, rec.Body.Len())
+		}
+	}
+}
+
+func TestRateLimitByIPPathOverrides(t *testing.T) {
+	m := api.NewMiddleware(api.MiddlewareConfig{
+		RateLimitPerMinute: 1000,
+		RateLimitOverrides: map[string]int64{
+			"/v1":                    1000,
+			"/v1/questions/generate": 1,
+		},
+	}, nil)
+	handler := m.RateLimitByIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "198.51.100.20:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do("/v1/questions/generate"); code != http.StatusOK {
+		t.Fatalf("first generate request: expected 200, got %d", code)
+	}
+	if code := do("/v1/questions/generate"); code != http.StatusTooManyRequests {
+		t.Fatalf("second generate request should hit the override limit, got %d", code)
+	}
+
+	// Shorter prefix and the global default are unaffected by the override bucket
+	for i := 0; i < 5; i++ {
+		if code := do("/v1/templates"); code != http.StatusOK {
+			t.Fatalf("/v1/templates request %d: expected 200, got %d", i+1, code)
+		}
+		if code := do("/health"); code != http.StatusOK {
+			t.Fatalf("/health request %d: expected 200, got %d", i+1, code)
+		}
+	}
+}
+
+func newRedisRateLimiter(t *testing.T) (*api.RedisRateLimiter, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return api.NewRedisRateLimiter(client), mr
+}
+
+func TestRedisRateLimiterBurstAndRetry(t *testing.T) {
+	rl, _ := newRedisRateLimiter(t)
+	ctx := context.Background()
+	limit := api.RateLimit{PerMinute: 60, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		allowed, _, err := rl.Reserve(ctx, "ip:203.0.113.1", limit)
+		if err != nil {
+			t.Fatalf("reserve %d: %v", i+1, err)
+		}
+		if !allowed {
+			t.Fatalf("request %d within burst was denied", i+1)
+		}
+	}
+
+	allowed, wait, err := rl.Reserve(ctx, "ip:203.0.113.1", limit)
+	if err != nil {
+		t.Fatalf("reserve beyond burst: %v", err)
+	}
+	if allowed {
+		t.Fatal("request beyond burst was allowed")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Fatalf("expected wait in (0, 1s] at 1 token/s, got %s", wait)
+	}
+
+	allowed, _, err = rl.Reserve(ctx, "ip:203.0.113.2", limit)
+	if err != nil || !allowed {
+		t.Fatalf("separate key should have its own bucket: allowed=%v err=%v", allowed, err)
+	}
+}
+
+func TestRedisRateLimiterUsesTheRedisClock(t *testing.T) {
+	rl, mr := newRedisRateLimiter(t)
+	ctx := context.Background()
+	limit := api.RateLimit{PerMinute: 60, Burst: 3}
+	start := time.Now().Add(time.Hour) // Far from the local clock
+	reserve := func(at time.Time) bool {
+		t.Helper()
+		mr.SetTime(at)
+		allowed, _, err := rl.Reserve(ctx, "ip:203.0.113.1", limit)
+		if err != nil {
+			t.Fatalf("reserve: %v", err)
+		}
+		return allowed
+	}
+
+	for i := 0; i < 3; i++ {
+		if !reserve(start) {
+			t.Fatalf("request %d within burst was denied", i+1)
+		}
+	}
+	if reserve(start) {
+		t.Fatal("request beyond burst was allowed")
+	}
+
+	// A Redis clock stepping back neither refills nor rewinds the bucket,
+	// so a second later exactly one token has been refilled
+	if reserve(start.Add(-10 * time.Second)) {
+		t.Fatal("request was allowed after the clock stepped back")
+	}
+	if !reserve(start.Add(time.Second)) {
+		t.Fatal("expected one token refilled a second later")
+	}
+	if reserve(start.Add(time.Second)) {
+		t.Fatal("expected only one token refilled a second later")
+	}
+}
+
+func TestRedisRateLimiterSharedAcrossMiddlewares(t *testing.T) {
+	rl, _ := newRedisRateLimiter(t)
+	cfg := api.MiddlewareConfig{RateLimitPerMinute: 60, RateLimitBurst: 2}
+
+	// Two middlewares sharing one backend behave like two replicas
+	replicas := []http.Handler{
+		api.NewMiddleware(cfg, rl).RateLimitByIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+		api.NewMiddleware(cfg, rl).RateLimitByIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+	}
+
+	codes := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = "192.0.2.10:4000"
+		rec := httptest.NewRecorder()
+		replicas[i%2].ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Fatalf("expected [200 200 429] across replicas, got %v", codes)
+	}
+}
+
+func TestRedisRateLimiterUnavailable(t *testing.T) {
+	for _, failClosed := range []bool{false, true} {
+		rl, mr := newRedisRateLimiter(t)
+		mr.Close()
+
+		m := api.NewMiddleware(api.MiddlewareConfig{
+			RateLimitPerMinute:  60,
+			RateLimitFailClosed: failClosed,
+		}, rl)
+		handler := m.RateLimitByIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+		want := http.StatusOK
+		if failClosed {
+			want = http.StatusServiceUnavailable
+		}
+		if rec.Code != want {
+			t.Fatalf("fail_closed=%v: expected %d, got %d", failClosed, want, rec.Code)
+		}
+	}
+}
+
+func TestClientIPIgnoresForwardedForFromUntrustedPeer(t *testing.T) {
+	m := api.NewMiddleware(api.MiddlewareConfig{
+		RateLimitPerMinute: 60,
+		TrustedProxies:     []string{"10.0.0.0/8"},
+	}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.RemoteAddr = "203.0.113.50:9999"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+
+	if got := m.ClientIP(req); got != "203.0.113.50" {
+		t.Fatalf("untrusted peer must be identified by RemoteAddr, got %s", got)
+	}
+}
+
+func TestClientIPWalksForwardedForFromTrustedProxy(t *testing.T) {
+	m := api.NewMiddleware(api.MiddlewareConfig{
+		RateLimitPerMinute: 60,
+		TrustedProxies:     []string{"10.0.0.0/8", "192.168.1.1"},
+	}, nil)
+
+	cases := []struct {
+		name string
+		xff  string
+		want string
+	}{
+		{"single hop", "198.51.100.7", "198.51.100.7"},
+		{"skips trusted hops", "198.51.100.7, 192.168.1.1, 10.1.2.3", "198.51.100.7"},
+		{"ignores spoofed leftmost entry", "6.6.6.6, 198.51.100.7", "198.51.100.7"},
+		{"all trusted", "10.9.9.9, 10.8.8.8", "10.9.9.9"},
+		{"no header", "", "10.0.0.1"},
+		{"malformed hop", "198.51.100.7, not-an-ip", "10.0.0.1"},
+		{"malformed hop behind trusted ones", "garbage, 10.1.2.3", "10.0.0.1"},
+		{"hop with a port", "198.51.100.7:4000", "10.0.0.1"},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = "10.0.0.1:443"
+		if tc.xff != "" {
+			req.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if got := m.ClientIP(req); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestSpoofedForwardedForDoesNotEvadeRateLimit(t *testing.T) {
+	m := api.NewMiddleware(api.MiddlewareConfig{
+		RateLimitPerMinute: 1,
+		RateLimitBurst:     1,
+		TrustedProxies:     []string{"10.0.0.0/8"},
+	}, nil)
+	handler := m.RateLimitByIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := make([]int, 0, 2)
+	for _, spoofed := range []string{"1.1.1.1", "2.2.2.2"} {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = "203.0.113.60:1000"
+		req.Header.Set("X-Forwarded-For", spoofed)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Fatalf("rotating X-Forwarded-For from an untrusted peer must share one bucket, got %v", codes)
+	}
+}
+
+func TestRequestLoggerReplacesMalformedRequestIDs(t *testing.T) {
+	m := api.NewMiddleware(api.MiddlewareConfig{}, nil)
+	var seen string
+	handler := m.RequestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+	}))
+
+	// Test papers append "-<slot>" to the header, which must still make a
+	// valid request ID
+	longest := strings.Repeat("a", validator.MaxRequestIDLength-len(fmt.Sprintf("-%d", service.MaxPaperQuestions)))
+	cases := []struct {
+		name   string
+		header string
+		kept   bool
+	}{
+		{"valid", "req-42", true},
+		{"longest", longest, true},
+		{"missing", "", false},
+		{"too long", longest + "a", false},
+		{"bad charset", "req 42/../x", false},
+		{"placeholder", "%", false},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set("X-Request-ID", tc.header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		got := rec.Header().Get("X-Request-ID")
+		if got != seen {
+			t.Errorf("%s: expected the response header %q to match the context's %q", tc.name, got, seen)
+		}
+		if tc.kept && got != tc.header {
+			t.Errorf("%s: expected %q to be kept, got %q", tc.name, tc.header, got)
+		}
+		if !tc.kept && (got == tc.header || !validator.ValidRequestID(got, validator.MaxRequestIDLength)) {
+			t.Errorf("%s: expected %q to be replaced with a valid ID, got %q", tc.name, tc.header, got)
+		}
+	}
+}
+
+func TestErrorsUseTheJSONEnvelope(t *testing.T) {
+	m := api.NewMiddleware(api.MiddlewareConfig{}, nil)
+	mux := http.NewServeMux()
+	mux.Handle("/v1/questions/generate", validator.ValidateGenerateQuestionRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the invalid request to be rejected before the handler")
+	})))
+	mux.HandleFunc("/v1/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	handler := m.RequestLogger(m.RecoverMiddleware(mux))
+
+	envelope := func(method, path, body string) (int, map[string]interface{}) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Request-ID", "req-envelope")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: expected a JSON error, got Content-Type %q", path, ct)
+		}
+		var resp map[string]map[string]interface{}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: failed to decode error envelope: %v", path, err)
+		}
+		if len(resp) != 1 || resp["error"] == nil {
+			t.Fatalf("%s: expected a single error object, got %v", path, resp)
+		}
+		return rec.Code, resp["error"]
+	}
+
+	code, body := envelope(http.MethodPost, "/v1/questions/generate",
+		`{"student_id": "s1", "topic_id": "t1", "exam_type": "NEET", "subject": "MATHEMATICS", "format": "MCQ", "requested_difficulty": 0.5}`)
+	if code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a validation failure, got %d", code)
+	}
+	if body["code"] != "validation_failed" || body["message"] != "Request validation failed" || body["request_id"] != "req-envelope" {
+		t.Errorf("unexpected validation envelope %v", body)
+	}
+	details, _ := body["details"].([]interface{})
+	if len(details) != 1 || details[0].(map[string]interface{})["field"] != "subject" {
+		t.Errorf("expected the subject field error in details, got %v", body["details"])
+	}
+
+	code, body = envelope(http.MethodGet, "/v1/panic", "")
+	if code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 after a panic, got %d", code)
+	}
+	want := map[string]interface{}{"code": "internal_error", "message": "internal server error", "request_id": "req-envelope"}
+	if fmt.Sprint(body) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, body)
+	}
+}
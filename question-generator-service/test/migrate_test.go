@@ -0,0 +1,208 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/stub"
+
+	"question-generator-service/internal/db"
+)
+
+// newStubMigrator migrates an in-memory stub database from a temp directory
+// holding migrations 1 to 3
+func newStubMigrator(t *testing.T) (*db.Migrator, database.Driver) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"1_create_templates", "2_add_unit", "3_add_tolerance"} {
+		for _, direction := range []string{"up", "down"} {
+			if err := os.WriteFile(filepath.Join(dir, name+"."+direction+".sql"), []byte("-- "+name+" "+direction), 0o644); err != nil {
+				t.Fatalf("write migration: %v", err)
+			}
+		}
+	}
+
+	driver, err := stub.WithInstance(nil, &stub.Config{})
+	if err != nil {
+		t.Fatalf("open stub driver: %v", err)
+	}
+	mg, err := db.NewMigrator(dir, driver)
+	if err != nil {
+		t.Fatalf("create migrator: %v", err)
+	}
+	t.Cleanup(func() { mg.Close() })
+	return mg, driver
+}
+
+func TestMigrateDryRunAppliesNothing(t *testing.T) {
+	mg, driver := newStubMigrator(t)
+
+	status, err := mg.DryRun()
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if status.Version != 0 || !reflect.DeepEqual(status.Pending, []uint{1, 2, 3}) {
+		t.Fatalf("expected every migration pending on a fresh database, got %+v", status)
+	}
+	if ran := driver.(*stub.Stub).MigrationSequence; len(ran) != 0 {
+		t.Fatalf("expected a dry run to apply nothing, got %q", ran)
+	}
+
+	if err := mg.MigrateTo(2); err != nil {
+		t.Fatalf("migrate to 2 failed: %v", err)
+	}
+	if status, err = mg.DryRun(); err != nil || status.Version != 2 || !reflect.DeepEqual(status.Pending, []uint{3}) {
+		t.Fatalf("expected migration 3 pending at version 2, got %+v, %v", status, err)
+	}
+}
+
+func TestMigrateToPinsTheVersion(t *testing.T) {
+	mg, driver := newStubMigrator(t)
+
+	if err := mg.MigrateTo(2); err != nil {
+		t.Fatalf("migrate to 2 failed: %v", err)
+	}
+	if version, err := mg.Version(); err != nil || version != 2 {
+		t.Fatalf("expected version 2, got %d, %v", version, err)
+	}
+	if version, err := mg.Up(); err != nil || version != 3 {
+		t.Fatalf("expected up to reach version 3, got %d, %v", version, err)
+	}
+	if err := mg.MigrateTo(1); err != nil {
+		t.Fatalf("migrate down to 1 failed: %v", err)
+	}
+	if version, err := mg.Version(); err != nil || version != 1 {
+		t.Fatalf("expected version 1 after migrating down, got %d, %v", version, err)
+	}
+
+	want := []string{
+		"-- 1_create_templates up", "-- 2_add_unit up", "-- 3_add_tolerance up",
+		"-- 3_add_tolerance down", "-- 2_add_unit down",
+	}
+	if ran := driver.(*stub.Stub).MigrationSequence; !reflect.DeepEqual(ran, want) {
+		t.Fatalf("expected migrations %q, got %q", want, ran)
+	}
+
+	if err := mg.MigrateTo(7); err == nil {
+		t.Fatal("expected migrating to a missing version to fail")
+	}
+}
+
+func TestMigrateRefusesDirtyDatabase(t *testing.T) {
+	mg, driver := newStubMigrator(t)
+	if err := driver.SetVersion(2, true); err != nil {
+		t.Fatalf("set dirty version: %v", err)
+	}
+
+	if version, err := mg.Version(); !errors.Is(err, db.ErrDirtyMigration) || version != 2 {
+		t.Fatalf("expected ErrDirtyMigration at version 2, got %d, %v", version, err)
+	}
+	if _, err := mg.Up(); !errors.Is(err, db.ErrDirtyMigration) {
+		t.Fatalf("expected up to refuse a dirty database, got %v", err)
+	}
+	if err := mg.MigrateTo(3); !errors.Is(err, db.ErrDirtyMigration) {
+		t.Fatalf("expected migrate to refuse a dirty database, got %v", err)
+	}
+	if _, err := mg.DryRun(); !errors.Is(err, db.ErrDirtyMigration) {
+		t.Fatalf("expected dry run to report the dirty database, got %v", err)
+	}
+	if ran := driver.(*stub.Stub).MigrationSequence; len(ran) != 0 {
+		t.Fatalf("expected nothing to run on a dirty database, got %q", ran)
+	}
+}
+
+// migrationFile is the <version>_<name>.<direction>.sql name golang-migrate
+// reads; it skips anything else in the directory
+var migrationFile = regexp.MustCompile(`^(\d+)_\w+\.(up|down)\.sql$`)
+
+func TestMigrationsDirectoryIsComplete(t *testing.T) {
+	const dir = "../internal/db/migrations"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read migrations: %v", err)
+	}
+	files := make(map[string]bool)
+	for _, entry := range entries {
+		if !migrationFile.MatchString(entry.Name()) {
+			t.Errorf("%s is not named <version>_<name>.up.sql or .down.sql and would never run", entry.Name())
+		}
+		files[entry.Name()] = true
+	}
+
+	var versions []uint
+	seen := make(map[uint]string)
+	for name := range files {
+		match := migrationFile.FindStringSubmatch(name)
+		if match == nil || match[2] != "up" {
+			continue
+		}
+		version, _ := strconv.ParseUint(match[1], 10, 32)
+		if other, ok := seen[uint(version)]; ok {
+			t.Errorf("%s and %s share version %d", name, other, version)
+		}
+		seen[uint(version)] = name
+		versions = append(versions, uint(version))
+		if down := name[:len(name)-len("up.sql")] + "down.sql"; !files[down] {
+			t.Errorf("%s has no %s", name, down)
+		}
+	}
+	if len(versions) == 0 {
+		t.Fatal("expected migrations in " + dir)
+	}
+
+	driver, err := stub.WithInstance(nil, &stub.Config{})
+	if err != nil {
+		t.Fatalf("open stub driver: %v", err)
+	}
+	mg, err := db.NewMigrator(dir, driver)
+	if err != nil {
+		t.Fatalf("create migrator: %v", err)
+	}
+	defer mg.Close()
+
+	status, err := mg.DryRun()
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	want := make([]uint, len(versions))
+	for i := range want {
+		want[i] = uint(i + 1)
+	}
+	if status.Version != 0 || !reflect.DeepEqual(status.Pending, want) {
+		t.Fatalf("expected migrations 1 to %d pending on a fresh database, got %+v", len(want), status)
+	}
+}
+
+func TestGenerationLogClientIDsAreText(t *testing.T) {
+	// Migration 2 created these columns as UUID, but clients send IDs of
+	// their own, e.g. session_<student>_<n>
+	const dir = "../internal/db/migrations"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read migrations: %v", err)
+	}
+	for _, column := range []string{"request_id", "session_id"} {
+		alter := "ALTER COLUMN " + column + " TYPE TEXT"
+		found := false
+		for _, entry := range entries {
+			if !strings.HasSuffix(entry.Name(), ".up.sql") {
+				continue
+			}
+			data, err := os.ReadFile(dir + "/" + entry.Name())
+			if err != nil {
+				t.Fatalf("read %s: %v", entry.Name(), err)
+			}
+			found = found || strings.Contains(string(data), alter)
+		}
+		if !found {
+			t.Errorf("expected a migration to make question_generation_logs.%s TEXT", column)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"question-generator-service/internal/config"
+	"question-generator-service/internal/db"
+	"question-generator-service/internal/service"
+	"question-generator-service/pkg/rag_advisor"
+)
+
+// newFakeRAGServer scores each question by looking up its text in scores
+func newFakeRAGServer(t *testing.T, scores map[string]float64) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rag_advisor.QualityCheckRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(rag_advisor.QualityCheckResponse{
+			AlignmentScore: scores[req.QuestionText],
+			ExemplarIDs:    []string{"exemplar-1"},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func questionForAttempt(ctx context.Context, attempt int) (*rag_advisor.QualityCheckRequest, error) {
+	return &rag_advisor.QualityCheckRequest{
+		QuestionText: fmt.Sprintf("attempt %d", attempt),
+		Subject:      "PHYSICS",
+		ExamType:     "JEE_MAIN",
+	}, nil
+}
+
+func TestRegenerateUntilAlignedStopsAtFirstAlignedAttempt(t *testing.T) {
+	srv := newFakeRAGServer(t, map[string]float64{
+		"attempt 1": 0.4,
+		"attempt 2": 0.9,
+		"attempt 3": 0.95,
+	})
+	client := rag_advisor.NewClient(config.RAGConfig{ServiceURL: srv.URL, Timeout: time.Second})
+
+	result, err := rag_advisor.RegenerateUntilAligned(context.Background(), 3, 0.8, questionForAttempt, client.CheckQuestionQuality)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Attempts) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(result.Attempts))
+	}
+	if result.Attempts[0].AlignmentScore != 0.4 || result.Attempts[1].AlignmentScore != 0.9 {
+		t.Fatalf("unexpected attempt scores: %+v", result.Attempts)
+	}
+	if !result.Aligned || result.BestAttempt != 2 {
+		t.Fatalf("expected aligned best attempt 2, got aligned=%v best=%d", result.Aligned, result.BestAttempt)
+	}
+}
+
+func TestRegenerateUntilAlignedReturnsBestWhenNoneClear(t *testing.T) {
+	srv := newFakeRAGServer(t, map[string]float64{
+		"attempt 1": 0.5,
+		"attempt 2": 0.7,
+		"attempt 3": 0.6,
+	})
+	client := rag_advisor.NewClient(config.RAGConfig{ServiceURL: srv.URL, Timeout: time.Second})
+
+	result, err := rag_advisor.RegenerateUntilAligned(context.Background(), 2, 0.8, questionForAttempt, client.CheckQuestionQuality)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Attempts) != 3 {
+		t.Fatalf("expected 3 attempts (1 + 2 retries), got %d", len(result.Attempts))
+	}
+	if result.Aligned {
+		t.Fatal("no attempt cleared the threshold")
+	}
+	if best := result.Best(); best == nil || best.Number != 2 || best.AlignmentScore != 0.7 {
+		t.Fatalf("expected attempt 2 (0.7) to be best, got %+v", best)
+	}
+}
+
+func TestGenerateQuestionKeepsRAGExemplars(t *testing.T) {
+	store := newRecordingDB()
+	store.addTemplate(previewTemplate())
+
+	exemplars := []rag_advisor.Exemplar{
+		{ID: "ex-1", Text: "A ball is thrown upward at 20 m/s. Find its maximum height.", Similarity: 0.91},
+		{ID: "ex-2", Text: "A car accelerates uniformly from rest to 30 m/s in 10 s.", Similarity: 0.84},
+	}
+	var sawFlag bool
+	rag := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rag_advisor.QualityCheckRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		resp := rag_advisor.QualityCheckResponse{AlignmentScore: 0.9, ExemplarIDs: []string{"ex-1", "ex-2"}}
+		if req.IncludeExemplars {
+			sawFlag = true
+			resp.Exemplars = exemplars
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer rag.Close()
+	bkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bkt.Close()
+
+	cfg := defaultConfig(t)
+	cfg.BKT.ServiceURL, cfg.BKT.Timeout, cfg.BKT.RetryCount = bkt.URL, time.Second, 0
+	cfg.RAG.ServiceURL = rag.URL
+	generator, err := service.NewGeneratorService(cfg, newFakeDBClient(t, store))
+	if err != nil {
+		t.Fatalf("failed to create generator service: %v", err)
+	}
+
+	generate := func(debug bool) *service.GenerateQuestionResponse {
+		t.Helper()
+		resp, err := generator.GenerateQuestion(context.Background(), &service.GenerateQuestionRequest{
+			StudentID: "student_1", TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN",
+			Subject: "PHYSICS", Format: "NUMERICAL", RequestedDifficulty: 0.5, Debug: debug,
+		})
+		if err != nil {
+			t.Fatalf("generation failed: %v", err)
+		}
+		return resp
+	}
+
+	if _, ok := generate(false).Metadata["rag_exemplars"]; ok {
+		t.Error("expected exemplars to be left out of the response without the debug flag")
+	}
+	if !sawFlag {
+		t.Fatal("expected the RAG request to ask for exemplar bodies")
+	}
+
+	// The generation log row carries the exemplar bodies regardless of debug
+	updates := store.generationLogUpdates()
+	if len(updates) == 0 {
+		t.Fatal("expected the generation log to be updated")
+	}
+	var logged []db.RAGExemplar
+	if err := json.Unmarshal(updates[len(updates)-1][10].([]byte), &logged); err != nil {
+		t.Fatalf("rag_exemplars argument is not JSON: %v", err)
+	}
+	if len(logged) != 2 || logged[0].Text != exemplars[0].Text || logged[1].Similarity != 0.84 {
+		t.Errorf("expected both exemplars in the generation log, got %+v", logged)
+	}
+
+	got, ok := generate(true).Metadata["rag_exemplars"].([]rag_advisor.Exemplar)
+	if !ok || len(got) != 2 || got[0].ID != "ex-1" || got[0].Text != exemplars[0].Text {
+		t.Errorf("expected exemplars in the debug response, got %#v", got)
+	}
+}
+
+func TestQualityCheckSeparatesLowAlignmentFromFailures(t *testing.T) {
+	srv := newFakeRAGServer(t, map[string]float64{"aligned": 0.75, "weak": 0.6})
+	advisor, err := rag_advisor.NewService(config.RAGConfig{
+		ServiceURL:         srv.URL,
+		Timeout:            time.Second,
+		AlignmentThreshold: 0.7,
+		SubjectThresholds:  map[string]float64{"MATHEMATICS": 0.8},
+	})
+	if err != nil {
+		t.Fatalf("failed to create advisor: %v", err)
+	}
+	check := func(text, subject string) (*rag_advisor.QualityCheckResponse, error) {
+		return advisor.QualityCheck(context.Background(), &rag_advisor.QualityCheckRequest{
+			QuestionText: text, Subject: subject, ExamType: "JEE_MAIN",
+		})
+	}
+
+	if resp, err := check("aligned", "PHYSICS"); err != nil || resp.AlignmentScore != 0.75 {
+		t.Fatalf("expected an aligned question to pass, got %+v, %v", resp, err)
+	}
+	resp, err := check("weak", "PHYSICS")
+	if !errors.Is(err, rag_advisor.ErrLowAlignment) || resp == nil || resp.AlignmentScore != 0.6 {
+		t.Fatalf("expected ErrLowAlignment with the response, got %+v, %v", resp, err)
+	}
+	// The subject's own threshold applies
+	if resp, err := check("aligned", "MATHEMATICS"); !errors.Is(err, rag_advisor.ErrLowAlignment) || resp == nil {
+		t.Fatalf("expected the MATHEMATICS threshold to reject 0.75, got %+v, %v", resp, err)
+	}
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	failing, err := rag_advisor.NewService(config.RAGConfig{ServiceURL: down.URL, Timeout: time.Second, AlignmentThreshold: 0.7})
+	if err != nil {
+		t.Fatalf("failed to create advisor: %v", err)
+	}
+	resp, err = failing.QualityCheck(context.Background(), &rag_advisor.QualityCheckRequest{
+		QuestionText: "aligned", Subject: "PHYSICS", ExamType: "JEE_MAIN",
+	})
+	if err == nil || errors.Is(err, rag_advisor.ErrLowAlignment) || resp != nil {
+		t.Fatalf("expected a transport failure without a response, got %+v, %v", resp, err)
+	}
+}
+
+func TestQualityCacheServesIdenticalQuestions(t *testing.T) {
+	var calls int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		json.NewEncoder(w).Encode(rag_advisor.QualityCheckResponse{AlignmentScore: 0.85})
+	}))
+	defer srv.Close()
+
+	advisor, err := rag_advisor.NewService(config.RAGConfig{
+		ServiceURL: srv.URL,
+		Timeout:    time.Second,
+		CacheSize:  10,
+		CacheTTL:   time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("failed to create advisor: %v", err)
+	}
+	check := func(text, subject string) {
+		t.Helper()
+		resp, err := advisor.CheckQuestionQuality(context.Background(), &rag_advisor.QualityCheckRequest{
+			QuestionText: text, Subject: subject, ExamType: "JEE_MAIN",
+		})
+		if err != nil || resp.AlignmentScore != 0.85 {
+			t.Fatalf("check failed: %v %+v", err, resp)
+		}
+	}
+
+	hitsBefore := scrapeMetric(t, "question_generator_rag_cache_hits_total")
+	check("A ball is dropped from 20 m.", "PHYSICS")
+	check("a ball  is dropped from 20 m.", "PHYSICS")
+	if got := atomic.LoadInt64(&calls); got != 1 {
+		t.Fatalf("expected the identical question to be served from the cache, got %d RAG calls", got)
+	}
+	if hits := scrapeMetric(t, "question_generator_rag_cache_hits_total") - hitsBefore; hits != 1 {
+		t.Errorf("expected one cache hit, got %v", hits)
+	}
+
+	check("A ball is dropped from 30 m.", "PHYSICS")
+	check("A ball is dropped from 20 m.", "MATHEMATICS")
+	if got := atomic.LoadInt64(&calls); got != 3 {
+		t.Fatalf("expected different text or subject to miss the cache, got %d RAG calls", got)
+	}
+
+	// The rest of the request is part of the key too
+	base := rag_advisor.QualityCheckRequest{QuestionText: "A ball is dropped from 20 m.", Subject: "PHYSICS", ExamType: "JEE_MAIN"}
+	withExemplars, withOptions, withTopic := base, base, base
+	withExemplars.IncludeExemplars = true
+	withOptions.Options = map[string]string{"A": "2 s", "B": "4 s"}
+	withTopic.TopicID, withTopic.BaseDiff = "PHY_KINEMATICS", 0.7
+	for _, req := range []rag_advisor.QualityCheckRequest{withExemplars, withOptions, withTopic} {
+		if rag_advisor.QualityCacheKey(&req) == rag_advisor.QualityCacheKey(&base) {
+			t.Errorf("expected %+v to have its own cache key", req)
+		}
+	}
+	reordered := withOptions
+	reordered.Options = map[string]string{"B": "4 s", "A": "2 s"}
+	if rag_advisor.QualityCacheKey(&reordered) != rag_advisor.QualityCacheKey(&withOptions) {
+		t.Error("expected the options' order not to change the cache key")
+	}
+}
+
+func TestQualityCacheEvictsAndExpires(t *testing.T) {
+	cache := rag_advisor.NewQualityCache(2, 50*time.Millisecond)
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Put(key, &rag_advisor.QualityCheckResponse{Feedback: key})
+	}
+	if _, ok := cache.Get("a"); ok {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+	if resp, ok := cache.Get("b"); !ok || resp.Feedback != "b" {
+		t.Errorf("expected b to be cached, got %+v", resp)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := cache.Get("c"); ok {
+		t.Error("expected c to expire after the TTL")
+	}
+}
@@ -0,0 +1,230 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"question-generator-service/api"
+	"question-generator-service/pkg/buildinfo"
+)
+
+// newHealthServer serves /health with status, or hangs when status is 0
+func newHealthServer(t *testing.T, status int) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+			return
+		}
+		if status == 0 {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestReadinessReportsEachDependency(t *testing.T) {
+	dbUp := func(context.Context) error { return nil }
+	dbDown := func(context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name       string
+		db         func(context.Context) error
+		bkt, rag   int
+		wantCode   int
+		wantStatus string
+		wantChecks map[string]string
+	}{
+		{"all up", dbUp, http.StatusOK, http.StatusOK, http.StatusOK, api.ReadinessReady,
+			map[string]string{"database": "ok", "bkt": "ok", "rag": "ok"}},
+		{"database down", dbDown, http.StatusOK, http.StatusOK, http.StatusServiceUnavailable, api.ReadinessNotReady,
+			map[string]string{"database": "unavailable", "bkt": "ok", "rag": "ok"}},
+		{"bkt down", dbUp, http.StatusServiceUnavailable, http.StatusOK, http.StatusServiceUnavailable, api.ReadinessNotReady,
+			map[string]string{"database": "ok", "bkt": "unavailable", "rag": "ok"}},
+		{"bkt hangs", dbUp, 0, http.StatusOK, http.StatusServiceUnavailable, api.ReadinessNotReady,
+			map[string]string{"database": "ok", "bkt": "unavailable", "rag": "ok"}},
+		{"rag down", dbUp, http.StatusOK, http.StatusInternalServerError, http.StatusOK, api.ReadinessDegraded,
+			map[string]string{"database": "ok", "bkt": "ok", "rag": "unavailable"}},
+		{"bkt and rag down", dbUp, http.StatusBadGateway, http.StatusBadGateway, http.StatusServiceUnavailable, api.ReadinessNotReady,
+			map[string]string{"database": "ok", "bkt": "unavailable", "rag": "unavailable"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{}
+			readiness := &api.Readiness{
+				Service: "question-generator",
+				Version: "test",
+				Timeout: 100 * time.Millisecond,
+				Checks: []api.DependencyCheck{
+					{Name: "database", Required: true, Check: tt.db},
+					{Name: "bkt", Required: true, Check: api.HTTPHealthCheck(client, newHealthServer(t, tt.bkt)+"/health")},
+					{Name: "rag", Check: api.HTTPHealthCheck(client, newHealthServer(t, tt.rag)+"/health")},
+				},
+			}
+
+			start := time.Now()
+			rec := httptest.NewRecorder()
+			readiness.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("readiness took %s despite the 100ms probe timeout", elapsed)
+			}
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, rec.Code, rec.Body.String())
+			}
+			var resp api.ReadinessResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode readiness: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("expected status %s, got %s", tt.wantStatus, resp.Status)
+			}
+			for name, want := range tt.wantChecks {
+				got := resp.Checks[name]
+				if got.Status != want {
+					t.Errorf("expected %s to be %s, got %+v", name, want, got)
+				}
+				if want == api.DependencyUnavailable && got.Error == "" {
+					t.Errorf("expected an error message for %s", name)
+				}
+			}
+			if resp.Checks["rag"].Required || !resp.Checks["bkt"].Required {
+				t.Errorf("expected bkt to be required and rag optional, got %+v", resp.Checks)
+			}
+		})
+	}
+}
+
+func TestHealthReportsBuildInfoAndCachedDBVersion(t *testing.T) {
+	// Stand in for the values -ldflags -X would inject
+	version, gitSHA, buildTime := buildinfo.Version, buildinfo.GitSHA, buildinfo.BuildTime
+	buildinfo.Version, buildinfo.GitSHA, buildinfo.BuildTime = "v9.9.9", "abc1234", "2026-01-02T03:04:05Z"
+	t.Cleanup(func() { buildinfo.Version, buildinfo.GitSHA, buildinfo.BuildTime = version, gitSHA, buildTime })
+
+	store := newRecordingDB()
+	health := &api.Health{
+		Service:      "question-generator",
+		DBVersion:    newFakeDBClient(t, store).ServerVersion,
+		DBVersionTTL: time.Hour,
+		Timeout:      time.Second,
+	}
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		health.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp api.HealthResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode health: %v", err)
+		}
+		want := api.HealthResponse{
+			Status:    "healthy",
+			Service:   "question-generator",
+			Version:   "v9.9.9",
+			GitSHA:    "abc1234",
+			BuildTime: "2026-01-02T03:04:05Z",
+			GoVersion: runtime.Version(),
+			DBVersion: fakeServerVersion,
+			Timestamp: resp.Timestamp,
+		}
+		if resp != want {
+			t.Fatalf("expected %+v, got %+v", want, resp)
+		}
+	}
+
+	var queries int
+	for _, statement := range store.recorded() {
+		if strings.Contains(statement, "SHOW server_version") {
+			queries++
+		}
+	}
+	if queries != 1 {
+		t.Errorf("expected the database version to be queried once and cached, got %d queries", queries)
+	}
+}
+
+func TestHealthOmitsDBVersionUntilTheDatabaseAnswers(t *testing.T) {
+	var calls int
+	health := &api.Health{
+		DBVersion: func(context.Context) (string, error) {
+			calls++
+			if calls == 1 {
+				return "", errors.New("connection refused")
+			}
+			return "16.1", nil
+		},
+		DBVersionTTL: time.Hour,
+	}
+
+	for _, want := range []string{"", "16.1", "16.1"} {
+		rec := httptest.NewRecorder()
+		health.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 regardless of the database, got %d", rec.Code)
+		}
+		var resp api.HealthResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode health: %v", err)
+		}
+		if resp.DBVersion != want {
+			t.Errorf("expected db_version %q, got %q", want, resp.DBVersion)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected a failed query to be retried and a successful one cached, got %d calls", calls)
+	}
+}
+
+func TestHealthDoesNotQueueProbesBehindASlowDBVersionQuery(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls int32
+	health := &api.Health{
+		DBVersion: func(context.Context) (string, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				close(started)
+				<-release
+			}
+			return "16.1", nil
+		},
+		DBVersionTTL: time.Hour,
+	}
+
+	slow := make(chan struct{})
+	go func() {
+		defer close(slow)
+		health.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	}()
+	<-started
+
+	// A second probe must answer while the first is still waiting on the
+	// database
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		health.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		done <- rec.Code
+	}()
+	select {
+	case code := <-done:
+		if code != http.StatusOK {
+			t.Errorf("expected 200, got %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("second probe waited for the first probe's database query")
+	}
+	close(release)
+	<-slow
+}
@@ -0,0 +1,1619 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"question-generator-service/internal/config"
+	"question-generator-service/internal/db"
+	"question-generator-service/pkg/templates"
+)
+
+func newTemplateService(t *testing.T) *templates.Service {
+	t.Helper()
+	svc, err := templates.NewService(nil, config.TemplateConfig{})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+	return svc
+}
+
+// kinematicsTemplate is a NUMERICAL template with integer and float variables
+func kinematicsTemplate() *db.QuestionTemplate {
+	return &db.QuestionTemplate{
+		TemplateID:   "physics_kinematics_001",
+		Subject:      "PHYSICS",
+		Format:       "NUMERICAL",
+		TemplateText: "A car moving at {{v0}} m/s accelerates at {{a}} m/s^2 for {{t}} s on a road with friction {{mu}}. Find its final speed.",
+		VariableSlots: `[
+			{"name": "v0", "type": "integer", "range": {"min": 1, "max": 50}},
+			{"name": "a", "type": "integer", "range": {"min": 1, "max": 10}},
+			{"name": "t", "type": "integer", "range": {"min": 1, "max": 20}},
+			{"name": "mu", "type": "float", "range": {"min": 0.1, "max": 0.9}}
+		]`,
+	}
+}
+
+// updateGolden regenerates the golden question fixtures instead of checking
+// them: go test ./test -run TestGoldenQuestions -update-golden
+var updateGolden = flag.Bool("update-golden", false, "rewrite the fixtures in testdata/golden")
+
+// goldenKinematicsTemplate derives its answer and worked steps from an
+// answer formula
+func goldenKinematicsTemplate() *db.QuestionTemplate {
+	qt := kinematicsTemplate()
+	formula, unit := "{{v0}} + {{a}} * {{t}}", "m/s"
+	qt.AnswerFormula, qt.AnswerUnit = &formula, &unit
+	return qt
+}
+
+func TestGoldenQuestions(t *testing.T) {
+	svc := newTemplateService(t)
+	for _, seed := range []int64{7, 42} {
+		current, err := svc.GenerateGolden(context.Background(), goldenKinematicsTemplate(), seed, 0.5)
+		if err != nil {
+			t.Fatalf("seed %d: generation failed: %v", seed, err)
+		}
+		path := filepath.Join("testdata", "golden", templates.GoldenFileName(current.TemplateID, seed, 0.5))
+		if *updateGolden {
+			if err := templates.WriteGoldenFile(path, current); err != nil {
+				t.Fatalf("seed %d: %v", seed, err)
+			}
+			continue
+		}
+		golden, err := templates.ReadGoldenFile(path)
+		if err != nil {
+			t.Fatalf("seed %d: %v (run with -update-golden to create it)", seed, err)
+		}
+		if diffs := templates.GoldenDiff(golden, current); len(diffs) > 0 {
+			t.Errorf("seed %d: generated question drifted from %s in %v; rerun with -update-golden if intended",
+				seed, path, diffs)
+		}
+	}
+}
+
+func TestGoldenDiffDetectsFormulaDrift(t *testing.T) {
+	svc := newTemplateService(t)
+	qt := goldenKinematicsTemplate()
+	golden, err := svc.GenerateGolden(context.Background(), qt, 42, 0.5)
+	if err != nil {
+		t.Fatalf("generation failed: %v", err)
+	}
+
+	again, err := svc.GenerateGolden(context.Background(), qt, 42, 0.5)
+	if err != nil || templates.GoldenDiff(golden, again) != nil {
+		t.Fatalf("expected the same seed to reproduce the golden question, got %v, %v", templates.GoldenDiff(golden, again), err)
+	}
+
+	formula := "{{v0}} + 2 * {{a}} * {{t}}"
+	qt.AnswerFormula = &formula
+	drifted, err := svc.GenerateGolden(context.Background(), qt, 42, 0.5)
+	if err != nil {
+		t.Fatalf("generation failed: %v", err)
+	}
+	diffs := templates.GoldenDiff(golden, drifted)
+	if !reflect.DeepEqual(diffs, []string{"correct_answer", "solution_steps"}) {
+		t.Errorf("expected the answer and steps to drift, got %v", diffs)
+	}
+}
+
+func TestVerifyCorrectAnswerMatchesSingleOption(t *testing.T) {
+	options := map[string]string{
+		"A": "4.9 m/s",
+		"B": "9.80 m/s",
+		"C": "19.6 m/s",
+		"D": "29.4 m/s",
+	}
+
+	for _, answer := range []string{"9.8 m/s", "9.8m/s", "  9.80  M/S "} {
+		key, err := templates.VerifyCorrectAnswer(answer, options)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", answer, err)
+		}
+		if key != "B" {
+			t.Fatalf("%q: expected option B, got %s", answer, key)
+		}
+	}
+}
+
+func TestVerifyCorrectAnswerNoMatch(t *testing.T) {
+	options := map[string]string{
+		"A": "Option A placeholder",
+		"B": "Option B placeholder",
+		"C": "Option C placeholder",
+		"D": "Option D placeholder",
+	}
+
+	_, err := templates.VerifyCorrectAnswer("20 m/s", options)
+	if !errors.Is(err, templates.ErrCorrectAnswerNotInOptions) {
+		t.Fatalf("expected ErrCorrectAnswerNotInOptions, got %v", err)
+	}
+}
+
+func TestVerifyCorrectAnswerAmbiguous(t *testing.T) {
+	options := map[string]string{
+		"A": "20 m/s",
+		"B": "10 m/s",
+		"C": "20.0 m/s",
+		"D": "40 m/s",
+	}
+
+	_, err := templates.VerifyCorrectAnswer("20 m/s", options)
+	if !errors.Is(err, templates.ErrCorrectAnswerAmbiguous) {
+		t.Fatalf("expected ErrCorrectAnswerAmbiguous, got %v", err)
+	}
+}
+
+func TestFillTemplateIsReproducibleWithSeed(t *testing.T) {
+	svc := newTemplateService(t)
+	fill := func(seed int64) *templates.GeneratedQuestion {
+		question, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{
+			Template:             kinematicsTemplate(),
+			CalibratedDifficulty: 0.5,
+			RandomSeed:           seed,
+		})
+		if err != nil {
+			t.Fatalf("fill with seed %d: %v", seed, err)
+		}
+		return question
+	}
+
+	first, second := fill(424242), fill(424242)
+	if first.QuestionText != second.QuestionText || first.CorrectAnswer != second.CorrectAnswer {
+		t.Fatalf("same seed produced different questions:\n%s (%s)\n%s (%s)",
+			first.QuestionText, first.CorrectAnswer, second.QuestionText, second.CorrectAnswer)
+	}
+	if !reflect.DeepEqual(first.VariableValues, second.VariableValues) {
+		t.Fatalf("same seed produced different variables: %v vs %v", first.VariableValues, second.VariableValues)
+	}
+	if first.Metadata["random_seed"] != int64(424242) {
+		t.Fatalf("expected the seed in metadata, got %v", first.Metadata["random_seed"])
+	}
+
+	// An unseeded fill still reports the seed it used, which replays it
+	unseeded := fill(0)
+	seed, ok := unseeded.Metadata["random_seed"].(int64)
+	if !ok || seed == 0 {
+		t.Fatalf("expected a generated seed in metadata, got %v", unseeded.Metadata["random_seed"])
+	}
+	if replay := fill(seed); replay.QuestionText != unseeded.QuestionText {
+		t.Fatalf("replaying seed %d produced %q, want %q", seed, replay.QuestionText, unseeded.QuestionText)
+	}
+}
+
+func fillArrayTemplate(t *testing.T, slots string, seed int64) (*templates.GeneratedQuestion, []interface{}) {
+	t.Helper()
+	question, err := newTemplateService(t).FillTemplate(context.Background(), templates.TemplateFillRequest{
+		Template: &db.QuestionTemplate{
+			TemplateID:    "maths_statistics_001",
+			Subject:       "MATHEMATICS",
+			Format:        "NUMERICAL",
+			TemplateText:  "Find the median of the observations {{data}}.",
+			VariableSlots: slots,
+		},
+		CalibratedDifficulty: 0.5,
+		RandomSeed:           seed,
+	})
+	if err != nil {
+		t.Fatalf("fill array template: %v", err)
+	}
+	data, ok := question.VariableValues["data"].([]interface{})
+	if !ok {
+		t.Fatalf("expected an array value, got %T", question.VariableValues["data"])
+	}
+	return question, data
+}
+
+func TestArrayVariableFixedLength(t *testing.T) {
+	question, data := fillArrayTemplate(t, `[
+		{"name": "data", "type": "array", "length": 5, "range": {"min": 10, "max": 20},
+		 "metadata": {"bracketed": true}}
+	]`, 7)
+
+	if len(data) != 5 {
+		t.Fatalf("expected 5 elements, got %d", len(data))
+	}
+	for _, v := range data {
+		if n, ok := v.(int); !ok || n < 10 || n > 20 {
+			t.Fatalf("element %v outside [10, 20]", v)
+		}
+	}
+	if !strings.Contains(question.QuestionText, "observations [") || !strings.HasSuffix(question.QuestionText, "].") {
+		t.Fatalf("expected a bracketed list in %q", question.QuestionText)
+	}
+}
+
+func TestArrayVariableLengthRange(t *testing.T) {
+	lengths := make(map[int]bool)
+	for seed := int64(1); seed <= 50; seed++ {
+		_, data := fillArrayTemplate(t, `[
+			{"name": "data", "type": "array", "element_type": "float",
+			 "length_range": {"min": 3, "max": 6}, "range": {"min": 0, "max": 1}}
+		]`, seed)
+		lengths[len(data)] = true
+		if len(data) < 3 || len(data) > 6 {
+			t.Fatalf("expected between 3 and 6 elements, got %d", len(data))
+		}
+		if _, ok := data[0].(float64); !ok {
+			t.Fatalf("expected float elements, got %T", data[0])
+		}
+	}
+	if len(lengths) < 2 {
+		t.Fatalf("expected lengths to vary across seeds, got %v", lengths)
+	}
+}
+
+func TestArrayVariableUniqueSortedElements(t *testing.T) {
+	question, data := fillArrayTemplate(t, `[
+		{"name": "data", "type": "array", "length": 6, "range": {"min": 1, "max": 6},
+		 "metadata": {"unique": true, "sorted": "asc"}}
+	]`, 7)
+
+	// Six unique values from [1, 6] sorted ascending must be exactly 1..6
+	for i, v := range data {
+		if v != i+1 {
+			t.Fatalf("expected [1 2 3 4 5 6], got %v", data)
+		}
+	}
+	if !strings.Contains(question.QuestionText, "observations 1, 2, 3, 4, 5, 6.") {
+		t.Fatalf("expected a comma-separated list in %q", question.QuestionText)
+	}
+
+	_, err := newTemplateService(t).FillTemplate(context.Background(), templates.TemplateFillRequest{
+		Template: &db.QuestionTemplate{
+			TemplateText:  "Find the median of {{data}}.",
+			VariableSlots: `[{"name": "data", "type": "array", "length": 7, "range": {"min": 1, "max": 6}, "metadata": {"unique": true}}]`,
+		},
+	})
+	if err == nil {
+		t.Fatal("expected an error when the range cannot supply enough unique elements")
+	}
+}
+
+// sampleVariable fills a single-variable template across many seeds
+func sampleVariable(t *testing.T, name, slot string, difficulty float64) []float64 {
+	t.Helper()
+	svc := newTemplateService(t)
+	var values []float64
+	for seed := int64(1); seed <= 200; seed++ {
+		question, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{
+			Template: &db.QuestionTemplate{
+				TemplateText:  "Find the value of {{" + name + "}}.",
+				VariableSlots: "[" + slot + "]",
+			},
+			CalibratedDifficulty: difficulty,
+			RandomSeed:           seed,
+		})
+		if err != nil {
+			t.Fatalf("fill with seed %d: %v", seed, err)
+		}
+		switch v := question.VariableValues[name].(type) {
+		case int:
+			values = append(values, float64(v))
+		case float64:
+			values = append(values, v)
+		default:
+			t.Fatalf("unexpected value type %T", v)
+		}
+	}
+	return values
+}
+
+func TestStepValuesStayWithinRange(t *testing.T) {
+	for _, slot := range []string{
+		`{"name": "x", "type": "integer", "range": {"min": 3, "max": 10, "step": 4}}`,
+		`{"name": "x", "type": "float", "range": {"min": 0.1, "max": 0.3, "step": 0.1}}`,
+	} {
+		for _, v := range sampleVariable(t, "x", slot, 1.0) {
+			if v < 0.1 || v > 10 {
+				t.Fatalf("%s: value %v outside range", slot, v)
+			}
+		}
+	}
+
+	seen := make(map[float64]bool)
+	for _, v := range sampleVariable(t, "x", `{"name": "x", "type": "integer", "range": {"min": 3, "max": 10, "step": 4}}`, 0.5) {
+		seen[v] = true
+	}
+	if len(seen) != 2 || !seen[3] || !seen[7] {
+		t.Fatalf("expected only 3 and 7 from [3, 10] step 4, got %v", seen)
+	}
+}
+
+func TestDifficultyScalingIsDrivenBySpec(t *testing.T) {
+	maxOf := func(values []float64) float64 {
+		m := values[0]
+		for _, v := range values {
+			m = math.Max(m, v)
+		}
+		return m
+	}
+
+	// The variable name no longer opts into scaling
+	unscaled := sampleVariable(t, "velocity", `{"name": "velocity", "type": "integer", "range": {"min": 1, "max": 10}}`, 1.0)
+	if got := maxOf(unscaled); got > 10 {
+		t.Fatalf("unscaled variable exceeded its range: %v", got)
+	}
+
+	// difficulty_scale 3 at full difficulty triples the span to [1, 28]
+	scaled := sampleVariable(t, "x", `{"name": "x", "type": "integer", "range": {"min": 1, "max": 10}, "difficulty_scale": 3}`, 1.0)
+	if got := maxOf(scaled); got <= 10 || got > 28 {
+		t.Fatalf("expected scaled values in (10, 28], max was %v", got)
+	}
+
+	// At zero difficulty the declared range applies unchanged
+	easy := sampleVariable(t, "x", `{"name": "x", "type": "integer", "range": {"min": 1, "max": 10}, "difficulty_scale": 3}`, 0)
+	if got := maxOf(easy); got > 10 {
+		t.Fatalf("scaling must not apply at difficulty 0, max was %v", got)
+	}
+}
+
+func TestValidateLatexDelimiters(t *testing.T) {
+	cases := []struct {
+		text    string
+		wantErr bool
+	}{
+		{"Find $v$ when $u = 2$ and $a = 3$.", false},
+		{"Evaluate $$\\int_0^1 x\\,dx$$ exactly.", false},
+		{"The price is \\$5 and $x^2$ is positive.", false},
+		{"Find $v when u = 2.", true},
+		{"Evaluate $$x^2$ now.", true},
+		{"Evaluate $x$$ now.", true},
+	}
+
+	for _, tc := range cases {
+		err := templates.ValidateLatexDelimiters(tc.text)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: expected error=%v, got %v", tc.text, tc.wantErr, err)
+		}
+	}
+}
+
+func TestFillTemplatePropagatesRenderFormat(t *testing.T) {
+	svc := newTemplateService(t)
+	latex := &db.QuestionTemplate{
+		TemplateID:   "physics_decay_001",
+		Format:       "NUMERICAL",
+		RenderFormat: templates.RenderFormatLatex,
+		TemplateText: "A sample decays with constant $\\lambda = {{k}}\\,s^{-1}$. Find its half-life in {{unit}}.",
+		VariableSlots: `[
+			{"name": "k", "type": "float", "range": {"min": 0.000012, "max": 0.000012}},
+			{"name": "unit", "type": "string", "options": ["seconds"]}
+		]`,
+	}
+
+	question, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: latex, RandomSeed: 1})
+	if err != nil {
+		t.Fatalf("fill LATEX template: %v", err)
+	}
+	if question.Metadata["render_format"] != templates.RenderFormatLatex {
+		t.Fatalf("expected LATEX render format in metadata, got %v", question.Metadata["render_format"])
+	}
+	if !strings.Contains(question.QuestionText, `$\lambda = 1.2 \times 10^{-5}\,s^{-1}$`) {
+		t.Fatalf("expected the number formatted as LaTeX inside the math span, got %q", question.QuestionText)
+	}
+
+	latex.TemplateText = "A sample decays with constant $\\lambda = {{k}}. Find its half-life in {{unit}}."
+	if _, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: latex}); err == nil {
+		t.Fatal("expected an error for unbalanced LaTeX delimiters")
+	}
+
+	plain, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: kinematicsTemplate(), RandomSeed: 1})
+	if err != nil {
+		t.Fatalf("fill plain template: %v", err)
+	}
+	if plain.Metadata["render_format"] != templates.RenderFormatPlain {
+		t.Fatalf("expected templates without a render format to default to PLAIN, got %v", plain.Metadata["render_format"])
+	}
+}
+
+func TestValidateVariableSlotsReportsFieldErrors(t *testing.T) {
+	specs, err := templates.ValidateVariableSlots(`[
+		{"name": "v0", "type": "integer", "range": {"min": 1, "max": 50}},
+		{"name": "v0", "type": "float", "range": {"min": 5, "max": 1}},
+		{"name": "g", "type": "string"},
+		{"name": "data", "type": "array", "element_type": "integer", "range": {"min": 1, "max": 9}},
+		{"type": "matrix"}
+	]`)
+	if specs != nil {
+		t.Fatalf("expected no specs for invalid slots, got %v", specs)
+	}
+
+	var validationErr *templates.TemplateValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a TemplateValidationError, got %v", err)
+	}
+	fields := make(map[string]bool)
+	for _, f := range validationErr.Fields {
+		fields[f.Field] = true
+	}
+	for _, want := range []string{
+		"variable_slots[1].name",
+		"variable_slots[1].range",
+		"variable_slots[2].options",
+		"variable_slots[3].length",
+		"variable_slots[4].name",
+		"variable_slots[4].type",
+	} {
+		if !fields[want] {
+			t.Errorf("expected an error for %s, got %+v", want, validationErr.Fields)
+		}
+	}
+	if fields["variable_slots[0].range"] {
+		t.Errorf("valid slot was reported: %+v", validationErr.Fields)
+	}
+}
+
+func TestValidateVariableSlotsRejectsMalformedJSON(t *testing.T) {
+	for _, raw := range []string{`{"name": "v0"}`, `[{"name": "v0", "type": "integer", "rnage": {"min": 1}}]`, `[`} {
+		_, err := templates.ValidateVariableSlots(raw)
+		var validationErr *templates.TemplateValidationError
+		if !errors.As(err, &validationErr) || validationErr.Fields[0].Field != "variable_slots" {
+			t.Errorf("%s: expected a variable_slots error, got %v", raw, err)
+		}
+	}
+
+	specs, err := templates.ValidateVariableSlots(kinematicsTemplate().VariableSlots)
+	if err != nil || len(specs) != 4 {
+		t.Fatalf("expected 4 valid specs, got %d (%v)", len(specs), err)
+	}
+}
+
+func TestGradeAnswerNumerical(t *testing.T) {
+	for _, tc := range []struct {
+		submitted string
+		correct   bool
+		credit    func(float64) bool
+	}{
+		{"11 m/s", true, func(c float64) bool { return c == 1 }},
+		{"11.05", true, func(c float64) bool { return c == 1 }},     // Unit defaults to m/s
+		{"39.6 km/h", true, func(c float64) bool { return c == 1 }}, // Converted to m/s
+		{"11.3 m/s", false, func(c float64) bool { return c > 0 && c < 1 }},
+		{"12 m/s", false, func(c float64) bool { return c == 0 }},
+		{"11 kg", false, func(c float64) bool { return c == 0 }},
+		{"eleven", false, func(c float64) bool { return c == 0 }},
+	} {
+		grade := templates.GradeAnswer("11 m/s", nil, tc.submitted)
+		if grade.Correct != tc.correct || !tc.credit(grade.PartialCredit) || !grade.Numerical {
+			t.Errorf("%q: unexpected grade %+v", tc.submitted, grade)
+		}
+	}
+}
+
+func TestGradeAnswerWithTolerance(t *testing.T) {
+	tolerance := db.NumericalTolerance{Absolute: 0.5, Relative: 0.1}
+	for _, tc := range []struct {
+		correctAnswer, submitted string
+		correct                  bool
+		credit                   float64
+	}{
+		{"11 m/s", "11 m/s", true, 1},
+		{"11 m/s", "12.1 m/s", true, 1}, // 10% of 11 is looser than 0.5
+		{"11 m/s", "13.2 m/s", false, 0.75},
+		{"11 m/s", "20 m/s", false, 0},
+		{"2 m/s", "2.4 m/s", true, 1}, // 0.5 is looser than 10% of 2
+		{"2 m/s", "3.5 m/s", false, 0.5},
+		{"0", "0.3", true, 1},
+	} {
+		grade := templates.GradeAnswerWithTolerance(tc.correctAnswer, nil, tc.submitted, tolerance)
+		if grade.Correct != tc.correct || math.Abs(grade.PartialCredit-tc.credit) > 1e-9 || !grade.Numerical {
+			t.Errorf("%q for %q: expected correct=%v with credit %v, got %+v", tc.submitted, tc.correctAnswer, tc.correct, tc.credit, grade)
+		}
+	}
+}
+
+func TestGradeAnswerMCQ(t *testing.T) {
+	options := map[string]string{"A": "Speed", "B": "Velocity"}
+	for submitted, correct := range map[string]bool{"B": true, "b": true, " velocity ": true, "A": false, "Speed": false} {
+		if grade := templates.GradeAnswer("Velocity", options, submitted); grade.Correct != correct || grade.Numerical {
+			t.Errorf("%q: expected correct=%v, got %+v", submitted, correct, grade)
+		}
+	}
+}
+
+func TestFillTemplateStopsWhenCancelled(t *testing.T) {
+	svc := newTemplateService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := svc.FillTemplate(ctx, templates.TemplateFillRequest{
+		Template: &db.QuestionTemplate{
+			TemplateID:    "cancelled",
+			TemplateText:  "A car travels {{d}} m.",
+			VariableSlots: `[{"name": "d", "type": "integer", "range": {"min": 1, "max": 10}}]`,
+		},
+		CalibratedDifficulty: 0.5,
+		RandomSeed:           1,
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// selectionCandidates differ only in base difficulty, so their scores fall
+// as they move away from the 0.5 target
+func selectionCandidates() []*db.QuestionTemplate {
+	var candidates []*db.QuestionTemplate
+	for i, difficulty := range []float64{0.5, 0.55, 0.6} {
+		qt := previewTemplate()
+		qt.TemplateID = fmt.Sprintf("candidate_%d", i)
+		qt.BaseDifficulty = difficulty
+		candidates = append(candidates, qt)
+	}
+	return candidates
+}
+
+func TestWeightedSelectionTracksScores(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	candidates := selectionCandidates()
+	for _, qt := range candidates {
+		store.addTemplate(qt)
+	}
+	svc, err := templates.NewService(newFakeDBClient(t, store), config.TemplateConfig{SelectionMode: "WEIGHTED", SelectionTemperature: 0.05})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+
+	selection := templates.TemplateSelection{
+		TopicID: "PHY_KINEMATICS", ExamType: "JEE_MAIN", Subject: "PHYSICS", Format: "NUMERICAL",
+		MinDifficulty: 0.4, MaxDifficulty: 0.6,
+	}
+	probs, err := svc.SelectionProbabilities(ctx, candidates, selection)
+	if err != nil {
+		t.Fatalf("failed to compute selection probabilities: %v", err)
+	}
+	if !(probs[0] > probs[1] && probs[1] > probs[2]) {
+		t.Fatalf("expected probabilities to follow the scores, got %v", probs)
+	}
+
+	const draws = 10000
+	counts := make(map[string]int)
+	for i := 0; i < draws; i++ {
+		qt, err := svc.SelectTemplate(ctx, selection)
+		if err != nil {
+			t.Fatalf("selection %d failed: %v", i, err)
+		}
+		counts[qt.TemplateID]++
+	}
+
+	for i, qt := range candidates {
+		freq := float64(counts[qt.TemplateID]) / draws
+		if math.Abs(freq-probs[i]) > 0.02 {
+			t.Errorf("%s served %.3f of the time, expected %.3f", qt.TemplateID, freq, probs[i])
+		}
+	}
+}
+
+func TestBestSelectionAlwaysServesTopScore(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	for _, qt := range selectionCandidates() {
+		store.addTemplate(qt)
+	}
+	svc, err := templates.NewService(newFakeDBClient(t, store), config.TemplateConfig{SelectionMode: "BEST"})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+
+	selection := templates.TemplateSelection{TopicID: "PHY_KINEMATICS", MinDifficulty: 0.4, MaxDifficulty: 0.6}
+	for i := 0; i < 100; i++ {
+		qt, err := svc.SelectTemplate(ctx, selection)
+		if err != nil {
+			t.Fatalf("selection failed: %v", err)
+		}
+		if qt.TemplateID != "candidate_0" {
+			t.Fatalf("BEST served %s instead of the top-scoring template", qt.TemplateID)
+		}
+	}
+}
+
+func TestEquallyScoredTemplatesGoToTheLowestID(t *testing.T) {
+	first, second := previewTemplate(), previewTemplate()
+	first.TemplateID, second.TemplateID = "tie_a", "tie_b"
+	svc, err := templates.NewService(nil, config.TemplateConfig{SelectionMode: "BEST"})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+
+	// Whichever order the database returns them in
+	selection := templates.TemplateSelection{MinDifficulty: 0.4, MaxDifficulty: 0.6}
+	for _, candidates := range [][]*db.QuestionTemplate{{first, second}, {second, first}} {
+		probs, err := svc.SelectionProbabilities(context.Background(), candidates, selection)
+		if err != nil {
+			t.Fatalf("failed to score candidates: %v", err)
+		}
+		for i, qt := range candidates {
+			if want := map[bool]float64{true: 1, false: 0}[qt.TemplateID == "tie_a"]; probs[i] != want {
+				t.Errorf("order %s, %s: expected %s to get probability %v, got %v",
+					candidates[0].TemplateID, candidates[1].TemplateID, qt.TemplateID, want, probs[i])
+			}
+		}
+	}
+
+	store := newRecordingDB()
+	store.addTemplate(second)
+	store.addTemplate(first)
+	svc, err = templates.NewService(newFakeDBClient(t, store), config.TemplateConfig{SelectionMode: "BEST"})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+	selection.TopicID = "PHY_KINEMATICS"
+	for i := 0; i < 20; i++ {
+		qt, err := svc.SelectTemplate(context.Background(), selection)
+		if err != nil {
+			t.Fatalf("selection failed: %v", err)
+		}
+		if qt.TemplateID != "tie_a" {
+			t.Fatalf("selection %d served %s instead of tie_a", i, qt.TemplateID)
+		}
+	}
+}
+
+func TestSeededWeightedSelectionIsReproducible(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	for _, qt := range selectionCandidates() {
+		store.addTemplate(qt)
+	}
+	svc, err := templates.NewService(newFakeDBClient(t, store), config.TemplateConfig{})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+
+	selection := templates.TemplateSelection{TopicID: "PHY_KINEMATICS", MinDifficulty: 0.4, MaxDifficulty: 0.6, Seed: 7}
+	first, err := svc.SelectTemplate(ctx, selection)
+	if err != nil {
+		t.Fatalf("selection failed: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		qt, err := svc.SelectTemplate(ctx, selection)
+		if err != nil {
+			t.Fatalf("selection failed: %v", err)
+		}
+		if qt.TemplateID != first.TemplateID {
+			t.Fatalf("seed 7 served %s and then %s", first.TemplateID, qt.TemplateID)
+		}
+	}
+}
+
+func TestSelectTemplateSkipsExcludedWhenAlternativesExist(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	for _, qt := range selectionCandidates() {
+		store.addTemplate(qt)
+	}
+	svc, err := templates.NewService(newFakeDBClient(t, store), config.TemplateConfig{SelectionMode: "WEIGHTED"})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+
+	selection := templates.TemplateSelection{
+		TopicID: "PHY_KINEMATICS", MinDifficulty: 0.4, MaxDifficulty: 0.6,
+		ExcludeTemplateIDs: []string{"candidate_0", "candidate_1"},
+	}
+	for i := 0; i < 200; i++ {
+		qt, err := svc.SelectTemplate(ctx, selection)
+		if err != nil {
+			t.Fatalf("selection failed: %v", err)
+		}
+		if qt.TemplateID != "candidate_2" {
+			t.Fatalf("served excluded template %s although candidate_2 was available", qt.TemplateID)
+		}
+	}
+
+	// With every candidate excluded the templates are re-used instead
+	selection.ExcludeTemplateIDs = []string{"candidate_0", "candidate_1", "candidate_2"}
+	if _, err := svc.SelectTemplate(ctx, selection); err != nil {
+		t.Fatalf("expected a fallback to the excluded templates, got %v", err)
+	}
+}
+
+func TestCandidateCountIsBounded(t *testing.T) {
+	ctx := context.Background()
+	store := newRecordingDB()
+	for i := 0; i < 50; i++ {
+		qt := previewTemplate()
+		qt.TemplateID = fmt.Sprintf("large_%02d", i)
+		qt.UsageCount = 1000 - i
+		store.addTemplate(qt)
+	}
+	svc, err := templates.NewService(newFakeDBClient(t, store), config.TemplateConfig{MaxCandidates: 10})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+
+	// Without a limit every match is fetched, and MaxCandidates bounds them
+	selection := templates.TemplateSelection{TopicID: "PHY_KINEMATICS", MinDifficulty: 0.4, MaxDifficulty: 0.6}
+	sampled := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		candidates, err := svc.Candidates(ctx, selection)
+		if err != nil {
+			t.Fatalf("failed to list candidates: %v", err)
+		}
+		if len(candidates) != 10 {
+			t.Fatalf("expected 10 candidates, got %d", len(candidates))
+		}
+		// The most used templates are always kept, the rest sampled
+		for j, qt := range candidates {
+			if j < 5 {
+				if want := fmt.Sprintf("large_%02d", j); qt.TemplateID != want {
+					t.Fatalf("expected candidate %d to be %s, got %s", j, want, qt.TemplateID)
+				}
+				continue
+			}
+			sampled[qt.TemplateID] = true
+		}
+	}
+	if len(sampled) <= 5 {
+		t.Fatalf("expected the sampled candidates to vary, got %v", sampled)
+	}
+
+	// A seed makes the sample reproducible
+	selection.Seed = 7
+	first, err := svc.Candidates(ctx, selection)
+	if err != nil {
+		t.Fatalf("failed to list candidates: %v", err)
+	}
+	second, err := svc.Candidates(ctx, selection)
+	if err != nil {
+		t.Fatalf("failed to list candidates: %v", err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Fatal("expected seeded candidate samples to match")
+	}
+
+	if _, err := svc.SelectTemplate(ctx, selection); err != nil {
+		t.Fatalf("selection failed: %v", err)
+	}
+
+	// The default MaxCandidates scores all 50
+	svc, err = templates.NewService(newFakeDBClient(t, store), config.TemplateConfig{})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+	if candidates, err := svc.Candidates(ctx, selection); err != nil || len(candidates) != 50 {
+		t.Fatalf("expected all 50 templates as candidates, got %d (%v)", len(candidates), err)
+	}
+}
+
+// selectionOrder runs n selections, serving each selected template, and
+// returns the IDs served, in order
+func selectionOrder(t *testing.T, svc *templates.Service, n int) []string {
+	t.Helper()
+	selection := templates.TemplateSelection{TopicID: "PHY_KINEMATICS", MinDifficulty: 0.4, MaxDifficulty: 0.6}
+	var served []string
+	for i := 0; i < n; i++ {
+		qt, err := svc.SelectTemplate(context.Background(), selection)
+		if err != nil {
+			t.Fatalf("selection %d failed: %v", i, err)
+		}
+		svc.TemplateServed(qt.TemplateID)
+		served = append(served, qt.TemplateID)
+	}
+	return served
+}
+
+func TestCooldownDeprioritizesForSelections(t *testing.T) {
+	store := newRecordingDB()
+	for _, qt := range selectionCandidates() {
+		store.addTemplate(qt)
+	}
+	svc, err := templates.NewService(newFakeDBClient(t, store), config.TemplateConfig{SelectionMode: "BEST", CooldownSelections: 2})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+
+	// candidate_0 scores best, then candidate_1; each cools down for the
+	// next two selections
+	want := []string{"candidate_0", "candidate_1", "candidate_2", "candidate_0", "candidate_1"}
+	if got := selectionOrder(t, svc, len(want)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected served templates %v, got %v", want, got)
+	}
+}
+
+func TestCooldownStartsWhenServedNotWhenSelected(t *testing.T) {
+	store := newRecordingDB()
+	for _, qt := range selectionCandidates() {
+		store.addTemplate(qt)
+	}
+	svc, err := templates.NewService(newFakeDBClient(t, store), config.TemplateConfig{SelectionMode: "BEST", CooldownSelections: 2})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+
+	// Selections whose questions are never saved leave the template free
+	selection := templates.TemplateSelection{TopicID: "PHY_KINEMATICS", MinDifficulty: 0.4, MaxDifficulty: 0.6}
+	for i := 0; i < 3; i++ {
+		qt, err := svc.SelectTemplate(context.Background(), selection)
+		if err != nil {
+			t.Fatalf("selection %d failed: %v", i, err)
+		}
+		if qt.TemplateID != "candidate_0" {
+			t.Fatalf("expected unsaved selections not to cool candidate_0 down, got %s", qt.TemplateID)
+		}
+	}
+
+	svc.TemplateServed("candidate_0")
+	if got := selectionOrder(t, svc, 1); got[0] != "candidate_1" {
+		t.Fatalf("expected the served candidate_0 to cool down, got %s", got[0])
+	}
+}
+
+func TestCooldownRecoversAfterDuration(t *testing.T) {
+	store := newRecordingDB()
+	for _, qt := range selectionCandidates() {
+		store.addTemplate(qt)
+	}
+	svc, err := templates.NewService(newFakeDBClient(t, store), config.TemplateConfig{SelectionMode: "BEST", CooldownDuration: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+
+	if got := selectionOrder(t, svc, 2); !reflect.DeepEqual(got, []string{"candidate_0", "candidate_1"}) {
+		t.Fatalf("expected the just-served template to be skipped, got %v", got)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if got := selectionOrder(t, svc, 1); got[0] != "candidate_0" {
+		t.Fatalf("expected candidate_0 to be served again once cooled down, got %s", got[0])
+	}
+}
+
+func TestCooldownRemainingShrinksToZero(t *testing.T) {
+	cooldown := templates.NewCooldown(4, 0)
+	cooldown.Served("a")
+	for i, want := range []float64{1, 0.75, 0.5, 0.25, 0, 0} {
+		if got := cooldown.Remaining("a"); math.Abs(got-want) > 1e-9 {
+			t.Fatalf("after %d selections: expected %.2f of the cool-down left, got %.2f", i, want, got)
+		}
+		cooldown.Served("b")
+	}
+	disabled := templates.NewCooldown(0, 0)
+	disabled.Served("a")
+	if got := disabled.Remaining("a"); got != 0 {
+		t.Errorf("expected a disabled cool-down to never penalize, got %.2f", got)
+	}
+}
+
+func TestRecentTemplatesKeepsNewestWindow(t *testing.T) {
+	recent := templates.NewRecentTemplates(2, time.Hour)
+	recent.Add("session:1", "a")
+	recent.Add("session:1", "b")
+	recent.Add("session:1", "a")
+	recent.Add("session:1", "c")
+
+	if got := recent.Recent("session:1"); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Fatalf("expected [a c], got %v", got)
+	}
+	if got := recent.Recent("session:2"); len(got) != 0 {
+		t.Fatalf("expected nothing for an unknown session, got %v", got)
+	}
+}
+
+// weightedCandidates pits a well-aligned but heavily used template against a
+// less aligned fresh one
+func weightedCandidates() []*db.QuestionTemplate {
+	aligned := previewTemplate()
+	aligned.TemplateID, aligned.BaseDifficulty, aligned.UsageCount = "aligned", 0.5, 500
+	fresh := previewTemplate()
+	fresh.TemplateID, fresh.BaseDifficulty, fresh.UsageCount = "fresh", 0.7, 0
+	return []*db.QuestionTemplate{aligned, fresh}
+}
+
+// winner returns the ID of the template BEST selection would serve
+func winner(t *testing.T, svc *templates.Service, selection templates.TemplateSelection) string {
+	t.Helper()
+	candidates := weightedCandidates()
+	probs, err := svc.SelectionProbabilities(context.Background(), candidates, selection)
+	if err != nil {
+		t.Fatalf("failed to score candidates: %v", err)
+	}
+	for i, p := range probs {
+		if p == 1 {
+			return candidates[i].TemplateID
+		}
+	}
+	t.Fatalf("no single winner in %v", probs)
+	return ""
+}
+
+func TestScoringWeightsChangeTheWinner(t *testing.T) {
+	selection := templates.TemplateSelection{MinDifficulty: 0.4, MaxDifficulty: 0.6}
+	difficultyFirst := config.TemplateScoringConfig{Difficulty: 0.7, Quality: 0.1, SuccessRate: 0.1, Freshness: 0.1}
+	freshnessFirst := config.TemplateScoringConfig{Difficulty: 0.2, Quality: 0.1, SuccessRate: 0.1, Freshness: 0.6}
+
+	svc, err := templates.NewService(nil, config.TemplateConfig{SelectionMode: "BEST", Scoring: difficultyFirst})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+	if got := winner(t, svc, selection); got != "aligned" {
+		t.Fatalf("difficulty-weighted selection served %s", got)
+	}
+
+	// A per-request override beats the configured weights
+	selection.Weights = &freshnessFirst
+	if got := winner(t, svc, selection); got != "fresh" {
+		t.Fatalf("freshness-weighted override served %s", got)
+	}
+
+	svc, err = templates.NewService(nil, config.TemplateConfig{SelectionMode: "BEST", Scoring: freshnessFirst})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+	selection.Weights = nil
+	if got := winner(t, svc, selection); got != "fresh" {
+		t.Fatalf("freshness-weighted selection served %s", got)
+	}
+}
+
+func TestScoringWeightsMustSumToOne(t *testing.T) {
+	unbalanced := config.TemplateScoringConfig{Difficulty: 0.5, Quality: 0.3, SuccessRate: 0.2, Freshness: 0.1}
+	if _, err := templates.NewService(nil, config.TemplateConfig{Scoring: unbalanced}); err == nil {
+		t.Fatal("expected weights summing to 1.1 to be rejected")
+	}
+
+	svc := newTemplateService(t)
+	_, err := svc.SelectionProbabilities(context.Background(), weightedCandidates(), templates.TemplateSelection{Weights: &unbalanced})
+	if err == nil {
+		t.Fatal("expected an unbalanced per-request override to be rejected")
+	}
+	if err := config.DefaultTemplateScoring.Validate(); err != nil {
+		t.Fatalf("default weights are invalid: %v", err)
+	}
+}
+
+func TestFillTemplateAssertionReason(t *testing.T) {
+	spec := `{
+		"assertion": "A body thrown up at {{v0}} m/s has zero velocity at the top of its flight.",
+		"reason": "Acceleration is zero at the top of the flight.",
+		"assertion_true": true,
+		"reason_true": false
+	}`
+	template := &db.QuestionTemplate{
+		TemplateID:      "physics_ar_001",
+		Subject:         "PHYSICS",
+		Format:          "ASSERTION_REASON",
+		TemplateText:    "Read the assertion and reason below and choose the correct option.",
+		VariableSlots:   `[{"name": "v0", "type": "integer", "range": {"min": 5, "max": 30}}]`,
+		OptionsTemplate: &spec,
+	}
+
+	question, err := newTemplateService(t).FillTemplate(context.Background(), templates.TemplateFillRequest{Template: template, RandomSeed: 3})
+	if err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	ar := question.AssertionReason
+	if ar == nil || strings.Contains(ar.Assertion, "{{") || !strings.HasPrefix(ar.Reason, "Acceleration is zero") {
+		t.Fatalf("expected a filled assertion and reason, got %+v", ar)
+	}
+	if !strings.Contains(question.QuestionText, "Assertion (A): "+ar.Assertion) || !strings.Contains(question.QuestionText, "Reason (R): "+ar.Reason) {
+		t.Errorf("expected the statements in the question text, got %q", question.QuestionText)
+	}
+	if !reflect.DeepEqual(question.Options, templates.AssertionReasonOptions) {
+		t.Errorf("expected the standard options, got %v", question.Options)
+	}
+	if key, err := templates.VerifyCorrectAnswer(question.CorrectAnswer, question.Options); err != nil || key != "C" {
+		t.Errorf("expected option C for a true assertion with a false reason, got %q (%v)", key, err)
+	}
+}
+
+func TestFillTemplateMatrixMatch(t *testing.T) {
+	spec := `{
+		"pairs": [
+			{"left": "Velocity", "right": "m/s"},
+			{"left": "Acceleration", "right": "m/s^2"},
+			{"left": "Force", "right": "N"},
+			{"left": "Work", "right": "J"}
+		],
+		"distractors": ["W"]
+	}`
+	template := &db.QuestionTemplate{
+		TemplateID:      "physics_mm_001",
+		Subject:         "PHYSICS",
+		Format:          "MATRIX_MATCH",
+		TemplateText:    "Match each quantity in Column I with its SI unit in Column II.",
+		VariableSlots:   "[]",
+		OptionsTemplate: &spec,
+	}
+	svc := newTemplateService(t)
+
+	question, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: template, RandomSeed: 11})
+	if err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	matrix := question.MatrixMatch
+	if matrix == nil || len(matrix.Left) != 4 || len(matrix.Right) != 5 {
+		t.Fatalf("expected 4 entries against 5, got %+v", matrix)
+	}
+
+	// The mapping pairs each quantity with its own unit
+	units := map[string]string{"Velocity": "m/s", "Acceleration": "m/s^2", "Force": "N", "Work": "J"}
+	right := make(map[string]string, len(matrix.Right))
+	for _, item := range matrix.Right {
+		right[item.Label] = item.Text
+	}
+	var answer []string
+	for _, item := range matrix.Left {
+		label := matrix.Mapping[item.Label]
+		if right[label] != units[item.Text] {
+			t.Errorf("%s %s maps to %q, expected %q", item.Label, item.Text, right[label], units[item.Text])
+		}
+		answer = append(answer, item.Label+"-"+label)
+	}
+	if want := strings.Join(answer, ", "); question.CorrectAnswer != want {
+		t.Errorf("expected correct answer %q, got %q", want, question.CorrectAnswer)
+	}
+
+	// Four distinct mapping options, exactly one of them correct
+	if len(question.Options) != 4 {
+		t.Fatalf("expected 4 options, got %v", question.Options)
+	}
+	if _, err := templates.VerifyCorrectAnswer(question.CorrectAnswer, question.Options); err != nil {
+		t.Errorf("expected the answer among distinct options %v: %v", question.Options, err)
+	}
+	if !strings.Contains(question.QuestionText, "Column I\nP. ") || !strings.Contains(question.QuestionText, "Column II\n1. ") {
+		t.Errorf("expected both columns in the question text, got %q", question.QuestionText)
+	}
+
+	again, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: template, RandomSeed: 11})
+	if err != nil || !reflect.DeepEqual(again.MatrixMatch, matrix) || !reflect.DeepEqual(again.Options, question.Options) {
+		t.Errorf("expected the same seed to replay the same matrix (%v)", err)
+	}
+}
+
+func TestFormatOptionsTemplatesAreValidated(t *testing.T) {
+	base := func(format, spec string) *db.QuestionTemplate {
+		return &db.QuestionTemplate{
+			TopicID: "PHY_UNITS", ExamType: "JEE_MAIN", Subject: "PHYSICS", Format: format,
+			TemplateText: "Choose the correct option.", BaseDifficulty: 0.5, BloomLevel: 2, ConceptDepth: 1,
+			Chapter: "Units", OptionsTemplate: &spec,
+		}
+	}
+
+	cases := []struct {
+		name string
+		qt   *db.QuestionTemplate
+		want string
+	}{
+		{"no truth values", base("ASSERTION_REASON", `{"assertion": "a", "reason": "r"}`), "assertion_true and reason_true are required"},
+		{"both false", base("ASSERTION_REASON", `{"assertion": "a", "reason": "r", "assertion_true": false, "reason_true": false}`), "no standard option fits"},
+		{"misspelt field", base("ASSERTION_REASON", `{"asertion": "a"}`), "unknown field"},
+		{"too few mappings", base("MATRIX_MATCH", `{"pairs": [{"left": "a", "right": "1"}, {"left": "b", "right": "2"}]}`), "needs more pairs or distractors"},
+	}
+	for _, tc := range cases {
+		var verr *templates.TemplateValidationError
+		if err := templates.ValidateTemplate(tc.qt); !errors.As(err, &verr) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected an options_template error containing %q, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	// A missing spec only fails at fill time as an invalid template
+	missing := base("MATRIX_MATCH", "")
+	missing.VariableSlots, missing.OptionsTemplate = "[]", nil
+	_, err := newTemplateService(t).FillTemplate(context.Background(), templates.TemplateFillRequest{Template: missing})
+	if !errors.Is(err, templates.ErrTemplateInvalid) {
+		t.Errorf("expected ErrTemplateInvalid without an options_template, got %v", err)
+	}
+}
+
+// mcqTemplate is an MCQ version of the kinematics template whose ranges keep
+// the four options apart
+func mcqTemplate(options string) *db.QuestionTemplate {
+	return &db.QuestionTemplate{
+		TemplateID:   "physics_kinematics_mcq",
+		TopicID:      "PHY_KINEMATICS",
+		ExamType:     "JEE_MAIN",
+		Subject:      "PHYSICS",
+		Format:       "MCQ",
+		Chapter:      "Kinematics",
+		TemplateText: "A car moving at {{v0}} m/s accelerates at {{a}} m/s^2 for {{t}} s. Find its final speed.",
+		VariableSlots: `[
+			{"name": "v0", "type": "integer", "range": {"min": 21, "max": 29}},
+			{"name": "a", "type": "integer", "range": {"min": 1, "max": 9}},
+			{"name": "t", "type": "integer", "range": {"min": 11, "max": 19}},
+			{"name": "v", "type": "computed", "formula": "{{v0}} + {{a}} * {{t}}"}
+		]`,
+		OptionsTemplate: &options,
+		BaseDifficulty:  0.5,
+		BloomLevel:      3,
+		ConceptDepth:    2,
+	}
+}
+
+func TestFillTemplateMCQOptions(t *testing.T) {
+	template := mcqTemplate(`{"options": {"A": "{{v0}} m/s", "B": "{{v}} m/s", "C": "{{a}} m/s", "D": "0 m/s"}}`)
+	if err := templates.ValidateTemplate(template); err != nil {
+		t.Fatalf("expected a valid MCQ template, got %v", err)
+	}
+
+	question, err := newTemplateService(t).FillTemplate(context.Background(), templates.TemplateFillRequest{Template: template, RandomSeed: 3})
+	if err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	v := question.VariableValues
+	want := map[string]string{
+		"A": fmt.Sprintf("%v m/s", v["v0"]),
+		"B": fmt.Sprintf("%v m/s", v["v"]),
+		"C": fmt.Sprintf("%v m/s", v["a"]),
+		"D": "0 m/s",
+	}
+	if !reflect.DeepEqual(question.Options, want) {
+		t.Errorf("expected options %v, got %v", want, question.Options)
+	}
+	if key, err := templates.VerifyCorrectAnswer(question.CorrectAnswer, question.Options); err != nil || key != "B" {
+		t.Errorf("expected the correct answer %q to be option B, got %q (%v)", question.CorrectAnswer, key, err)
+	}
+}
+
+func TestMCQOptionsFollowAnswerPrecision(t *testing.T) {
+	template := mcqTemplate(`{"options": {"A": "{{v0}} m/s", "B": "{{v}}  m / s", "C": "{{a}} m/s", "D": "0 m/s"}}`)
+	precision := 1
+	template.AnswerPrecision = &precision
+
+	question, err := newTemplateService(t).FillTemplate(context.Background(), templates.TemplateFillRequest{Template: template, RandomSeed: 3})
+	if err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	want := fmt.Sprintf("%v.0 m/s", question.VariableValues["v"])
+	if question.CorrectAnswer != want || question.Options["B"] != want || question.Options["D"] != "0.0 m/s" {
+		t.Errorf("expected answer and option B %q, got %q and options %v", want, question.CorrectAnswer, question.Options)
+	}
+}
+
+func TestMalformedMCQOptionsTemplates(t *testing.T) {
+	cases := []struct {
+		name, options, want string
+	}{
+		{"empty", "  ", "is empty"},
+		{"malformed JSON", `{"options": {"A": "1 m/s",`, "must be a JSON object"},
+		{"not an object", `["1 m/s", "2 m/s", "3 m/s", "4 m/s"]`, "must be a JSON object"},
+		{"misspelt field", `{"option": {"A": "1 m/s"}}`, "unknown field"},
+		{"too few options", `{"options": {"A": "{{v}} m/s", "B": "1 m/s", "C": "2 m/s"}}`, "must have exactly 4 options A, B, C, D, got 3"},
+		{"wrong key", `{"options": {"A": "{{v}} m/s", "B": "1 m/s", "C": "2 m/s", "E": "3 m/s"}}`, "is missing option D"},
+		{"blank option", `{"options": {"A": "{{v}} m/s", "B": "1 m/s", "C": " ", "D": "3 m/s"}}`, "option C is empty"},
+		{"duplicate options", `{"options": {"A": "{{v}} m/s", "B": "1 m/s", "C": "1.0 m/s", "D": "3 m/s"}}`, "options B and C both read"},
+	}
+	svc := newTemplateService(t)
+	for _, tc := range cases {
+		template := mcqTemplate(tc.options)
+		_, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: template, RandomSeed: 3})
+		if !errors.Is(err, templates.ErrTemplateInvalid) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected ErrTemplateInvalid containing %q, got %v", tc.name, tc.want, err)
+		}
+		if err := templates.ValidateTemplate(template); err == nil || !strings.Contains(err.Error(), "options_template") {
+			t.Errorf("%s: expected ValidateTemplate to reject the options_template, got %v", tc.name, err)
+		}
+	}
+
+	// Options that only coincide once filled fail the fill, not validation
+	collide := mcqTemplate(`{"options": {"A": "{{v}} m/s", "B": "{{v0}} m/s", "C": "{{a}} m/s", "D": "0 m/s"}}`)
+	collide.VariableSlots = `[
+		{"name": "v0", "type": "integer", "range": {"min": 4, "max": 4}},
+		{"name": "a", "type": "integer", "range": {"min": 4, "max": 4}},
+		{"name": "t", "type": "integer", "range": {"min": 2, "max": 2}},
+		{"name": "v", "type": "computed", "formula": "{{v0}} + {{a}} * {{t}}"}
+	]`
+	if err := templates.ValidateTemplate(collide); err != nil {
+		t.Fatalf("expected the colliding template to validate, got %v", err)
+	}
+	_, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: collide, RandomSeed: 3})
+	if !errors.Is(err, templates.ErrTemplateInvalid) || !strings.Contains(err.Error(), `options B and C both read "4 m/s"`) {
+		t.Errorf("expected the colliding options to fail the fill, got %v", err)
+	}
+
+	// Without an options_template an MCQ is left to the pipeline as before
+	none := mcqTemplate("")
+	none.OptionsTemplate = nil
+	if err := templates.ValidateTemplate(none); err != nil {
+		t.Errorf("expected an MCQ without options_template to validate, got %v", err)
+	}
+}
+
+func TestFillTemplatePassageSharesVariables(t *testing.T) {
+	spec := `{"questions": [
+		{
+			"text": "How fast was the cart moving before the {{t}} s?",
+			"answer": "{{v0}} m/s"
+		},
+		{
+			"text": "What is the cart's speed at the end of the {{t}} s?",
+			"options": {"A": "{{v0}} m/s", "B": "{{v}} m/s", "C": "{{dv}} m/s", "D": "0 m/s"},
+			"answer": "{{v}} m/s"
+		}
+	]}`
+	template := &db.QuestionTemplate{
+		TemplateID:   "physics_passage_001",
+		Subject:      "PHYSICS",
+		Format:       "PASSAGE",
+		TemplateText: "A cart moving at {{v0}} m/s along a straight track gains {{dv}} m/s of speed over {{t}} s.",
+		VariableSlots: `[
+			{"name": "v0", "type": "integer", "range": {"min": 1, "max": 9}},
+			{"name": "dv", "type": "integer", "range": {"min": 11, "max": 19}},
+			{"name": "t", "type": "integer", "range": {"min": 21, "max": 29}},
+			{"name": "v", "type": "computed", "formula": "{{v0}} + {{dv}}"}
+		]`,
+		OptionsTemplate: &spec,
+	}
+
+	question, err := newTemplateService(t).FillTemplate(context.Background(), templates.TemplateFillRequest{Template: template, RandomSeed: 5})
+	if err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	passage := question.Passage
+	if passage == nil || len(passage.Questions) != 2 {
+		t.Fatalf("expected a passage with two sub-questions, got %+v", passage)
+	}
+	if passage.PassageID == "" || passage.Questions[0].QuestionID != passage.PassageID+"_1" || passage.Questions[1].QuestionID != passage.PassageID+"_2" {
+		t.Errorf("expected sub-question IDs under passage %q, got %q and %q", passage.PassageID, passage.Questions[0].QuestionID, passage.Questions[1].QuestionID)
+	}
+
+	// Every part quotes the same generated numbers
+	values := question.VariableValues
+	v0, dv, tt := fmt.Sprint(values["v0"]), fmt.Sprint(values["dv"]), fmt.Sprint(values["t"])
+	if !strings.Contains(passage.Text, v0+" m/s") || !strings.Contains(passage.Text, dv+" m/s") || !strings.Contains(passage.Text, tt+" s") {
+		t.Errorf("passage does not quote v0=%s dv=%s t=%s: %q", v0, dv, tt, passage.Text)
+	}
+	for i, sub := range passage.Questions {
+		if !strings.Contains(sub.QuestionText, "the "+tt+" s") {
+			t.Errorf("sub-question %d does not refer to t=%s: %q", i+1, tt, sub.QuestionText)
+		}
+	}
+	if want := fmt.Sprint(values["v"]) + " m/s"; passage.Questions[1].CorrectAnswer != want || passage.Questions[1].Options["B"] != want {
+		t.Errorf("expected answer and option B %q, got %q and %q", want, passage.Questions[1].CorrectAnswer, passage.Questions[1].Options["B"])
+	}
+	if want := v0 + " m/s"; passage.Questions[0].CorrectAnswer != want {
+		t.Errorf("expected the initial speed %q, got %q", want, passage.Questions[0].CorrectAnswer)
+	}
+
+	if !strings.HasPrefix(question.QuestionText, passage.Text) || !strings.Contains(question.QuestionText, "2. "+passage.Questions[1].QuestionText) {
+		t.Errorf("expected the passage followed by its sub-questions, got %q", question.QuestionText)
+	}
+}
+
+func TestFillTemplatePassageComputesFormulaAnswers(t *testing.T) {
+	spec := `{"questions": [
+		{
+			"text": "What was the cart's average acceleration?",
+			"answer_formula": "{{dv}} / {{t}}",
+			"answer_unit": "m/s^2"
+		},
+		{
+			"text": "How much further did the cart go than it would have at its starting speed?",
+			"answer_formula": "{{dv}} * {{t}} / 2",
+			"answer_unit": "m"
+		}
+	]}`
+	unit := "m/s"
+	precision := 3
+	template := &db.QuestionTemplate{
+		TemplateID: "physics_passage_002", TopicID: "PHYSICS_KINEMATICS", ExamType: "JEE_MAIN", Subject: "PHYSICS", Format: "PASSAGE",
+		TemplateText: "A cart gains {{dv}} m/s of speed over {{t}} s.", BaseDifficulty: 0.5, BloomLevel: 3, ConceptDepth: 2, Chapter: "Kinematics",
+		VariableSlots: `[
+			{"name": "dv", "type": "integer", "range": {"min": 11, "max": 19}},
+			{"name": "t", "type": "integer", "range": {"min": 21, "max": 29}}
+		]`,
+		OptionsTemplate: &spec,
+		AnswerUnit:      &unit,
+		AnswerPrecision: &precision,
+	}
+	if err := templates.ValidateTemplate(template); err != nil {
+		t.Fatalf("expected formula sub-questions to validate, got %v", err)
+	}
+
+	question, err := newTemplateService(t).FillTemplate(context.Background(), templates.TemplateFillRequest{Template: template, RandomSeed: 5})
+	if err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	dv, tt := question.VariableValues["dv"].(int), question.VariableValues["t"].(int)
+	// The sub-question's own unit applies, not the template's, and the
+	// value is written at the template's precision
+	if want := templates.CanonicalAnswer(fmt.Sprintf("%.3f m/s^2", float64(dv)/float64(tt)), &precision); question.Passage.Questions[0].CorrectAnswer != want {
+		t.Errorf("expected the acceleration %q, got %q", want, question.Passage.Questions[0].CorrectAnswer)
+	}
+	if want := templates.CanonicalAnswer(fmt.Sprintf("%.3f m", float64(dv*tt)/2), &precision); question.Passage.Questions[1].CorrectAnswer != want {
+		t.Errorf("expected the extra distance %q, got %q", want, question.Passage.Questions[1].CorrectAnswer)
+	}
+
+	for name, bad := range map[string]string{
+		"both answers":         `{"questions": [{"text": "Q", "answer": "1", "answer_formula": "{{dv}}"}]}`,
+		"no answer":            `{"questions": [{"text": "Q"}]}`,
+		"unit without formula": `{"questions": [{"text": "Q", "answer": "1", "answer_unit": "m/s"}]}`,
+		"undefined variable":   `{"questions": [{"text": "Q", "answer_formula": "{{a}} * {{t}}"}]}`,
+	} {
+		broken := *template
+		broken.OptionsTemplate = &bad
+		if err := templates.ValidateTemplate(&broken); err == nil || !strings.Contains(err.Error(), "options_template") {
+			t.Errorf("%s: expected an options_template error, got %v", name, err)
+		}
+	}
+}
+
+func TestConcurrentFillTemplateIsIsolated(t *testing.T) {
+	svc := newTemplateService(t)
+	fill := func(seed int64) (*templates.GeneratedQuestion, error) {
+		return svc.FillTemplate(context.Background(), templates.TemplateFillRequest{
+			Template:             kinematicsTemplate(),
+			CalibratedDifficulty: 0.5,
+			RandomSeed:           seed,
+		})
+	}
+
+	const seeds = 16
+	want := make([]string, seeds)
+	for i := range want {
+		question, err := fill(int64(i + 1))
+		if err != nil {
+			t.Fatalf("fill with seed %d: %v", i+1, err)
+		}
+		want[i] = question.QuestionText
+	}
+
+	// Seeded fills interleaved with unseeded ones must still replay exactly,
+	// and no seed may leak into a later unseeded fill
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*seeds)
+	for round := 0; round < 4; round++ {
+		for i := 0; i < seeds; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				question, err := fill(int64(i + 1))
+				if err != nil {
+					errs <- err
+				} else if question.QuestionText != want[i] {
+					errs <- fmt.Errorf("seed %d produced %q, want %q", i+1, question.QuestionText, want[i])
+				}
+			}(i)
+			go func() {
+				defer wg.Done()
+				question, err := fill(0)
+				if err != nil {
+					errs <- err
+				} else if seed, _ := question.Metadata["random_seed"].(int64); seed >= 1 && seed <= seeds {
+					errs <- fmt.Errorf("unseeded fill reused request seed %d", seed)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestAnalyzeVarietyFlagsLowVarietyTemplates(t *testing.T) {
+	store := newRecordingDB()
+	varied := previewTemplate()
+	store.addTemplate(varied)
+	narrow := previewTemplate()
+	narrow.TemplateID = "physics_kinematics_narrow"
+	narrow.VariableSlots = `[{"name": "v0", "type": "integer", "range": {"min": 1, "max": 2}}, {"name": "a", "type": "integer", "range": {"min": 3, "max": 3}}, {"name": "t", "type": "integer", "range": {"min": 4, "max": 4}}]`
+	store.addTemplate(narrow)
+	svc, err := templates.NewService(newFakeDBClient(t, store), config.TemplateConfig{})
+	if err != nil {
+		t.Fatalf("failed to create template service: %v", err)
+	}
+
+	report, err := svc.AnalyzeVariety(context.Background(), templates.VarietyRequest{TemplateID: narrow.TemplateID})
+	if err != nil {
+		t.Fatalf("analysis failed: %v", err)
+	}
+	if !report.LowVariety || len(report.Reasons) != 2 {
+		t.Errorf("expected the narrow template to be flagged on both counts, got %+v", report)
+	}
+	if report.Samples != templates.DefaultVarietySamples || report.DistinctQuestions > 2 || report.AnswerEntropy > 1 {
+		t.Errorf("expected at most two distinct questions and one bit of entropy, got %+v", report)
+	}
+
+	report, err = svc.AnalyzeVariety(context.Background(), templates.VarietyRequest{TemplateID: varied.TemplateID, Samples: 50})
+	if err != nil {
+		t.Fatalf("analysis failed: %v", err)
+	}
+	if report.LowVariety || report.DistinctRatio < templates.MinDistinctRatio || report.AnswerEntropy < templates.MinAnswerEntropy {
+		t.Errorf("expected the varied template to pass, got %+v", report)
+	}
+	if again, _ := svc.AnalyzeVariety(context.Background(), templates.VarietyRequest{TemplateID: varied.TemplateID, Samples: 50}); !reflect.DeepEqual(again, report) {
+		t.Errorf("expected a reproducible report, got %+v then %+v", report, again)
+	}
+}
+
+func TestNegativeRangesSpanZero(t *testing.T) {
+	var negative, positive bool
+	for _, v := range sampleVariable(t, "x", `{"name": "x", "type": "integer", "range": {"min": -10, "max": 10}}`, 0.5) {
+		if v < -10 || v > 10 {
+			t.Fatalf("value %v outside [-10, 10]", v)
+		}
+		negative, positive = negative || v < 0, positive || v > 0
+	}
+	if !negative || !positive {
+		t.Errorf("expected values on both sides of zero")
+	}
+
+	for _, slot := range []string{
+		`{"name": "x", "type": "integer", "range": {"min": -9, "max": -3, "step": 3}}`,
+		`{"name": "x", "type": "float", "range": {"min": -1.5, "max": -0.5}}`,
+		`{"name": "x", "type": "float", "range": {"min": -0.9, "max": -0.3, "step": 0.3}}`,
+	} {
+		for _, v := range sampleVariable(t, "x", slot, 1.0) {
+			if v > -0.3 || v < -9 {
+				t.Fatalf("%s: value %v outside range", slot, v)
+			}
+		}
+	}
+
+	seen := make(map[float64]bool)
+	for _, v := range sampleVariable(t, "x", `{"name": "x", "type": "integer", "range": {"min": -9, "max": -3, "step": 3}}`, 0.5) {
+		seen[v] = true
+	}
+	if len(seen) != 3 || !seen[-9] || !seen[-6] || !seen[-3] {
+		t.Fatalf("expected -9, -6 and -3 from [-9, -3] step 3, got %v", seen)
+	}
+}
+
+func TestZeroWidthRangesAlwaysYieldTheBound(t *testing.T) {
+	for slot, want := range map[string]float64{
+		`{"name": "x", "type": "integer", "range": {"min": -4, "max": -4}}`:          -4,
+		`{"name": "x", "type": "float", "range": {"min": 2.5, "max": 2.5}}`:          2.5,
+		`{"name": "x", "type": "integer", "range": {"min": 7, "max": 7, "step": 2}}`: 7,
+	} {
+		for _, v := range sampleVariable(t, "x", slot, 1.0) {
+			if v != want {
+				t.Fatalf("%s: expected %v, got %v", slot, want, v)
+			}
+		}
+	}
+}
+
+func TestUnusableRangesFailWithoutPanicking(t *testing.T) {
+	svc := newTemplateService(t)
+	for slot, want := range map[string]string{
+		`{"name": "x", "type": "integer", "range": {"min": 10, "max": -10}}`:            "min 10 greater than max -10",
+		`{"name": "x", "type": "float", "range": {"min": 1.5, "max": 0.5}}`:             "min 1.5 greater than max 0.5",
+		`{"name": "x", "type": "integer", "range": {"min": 0.2, "max": 0.8}}`:           "no integer in range",
+		`{"name": "x", "type": "integer", "range": {"min": -1e300, "max": 1e300}}`:      "too wide",
+		`{"name": "x", "type": "float", "range": {"min": 0, "max": 1, "step": 1e-300}}`: "too many steps",
+	} {
+		_, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{
+			Template: &db.QuestionTemplate{
+				TemplateText:  "Find the value of {{x}}.",
+				VariableSlots: "[" + slot + "]",
+			},
+			RandomSeed: 1,
+		})
+		if !errors.Is(err, templates.ErrTemplateInvalid) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected an ErrTemplateInvalid mentioning %q, got %v", slot, want, err)
+		}
+	}
+}
+
+// bilingualTemplate is mcqTemplate with a Hindi translation of its text and
+// options
+func bilingualTemplate() *db.QuestionTemplate {
+	template := mcqTemplate(`{"options": {"A": "{{v0}} m/s", "B": "{{v}} m/s", "C": "{{a}} m/s", "D": "0 m/s"}}`)
+	textHi := "एक कार {{v0}} m/s की चाल से चलते हुए {{t}} s तक {{a}} m/s^2 से त्वरित होती है। उसकी अंतिम चाल ज्ञात कीजिए।"
+	optionsHi := `{"options": {"A": "{{v0}} मी/से", "B": "{{v}} मी/से", "C": "{{a}} मी/से", "D": "0 मी/से"}}`
+	template.TemplateTextHi, template.OptionsTemplateHi = &textHi, &optionsHi
+	return template
+}
+
+func TestFillTemplateLanguages(t *testing.T) {
+	template := bilingualTemplate()
+	if err := templates.ValidateTemplate(template); err != nil {
+		t.Fatalf("expected a valid bilingual template, got %v", err)
+	}
+	svc := newTemplateService(t)
+	fill := func(language string) *templates.GeneratedQuestion {
+		t.Helper()
+		question, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: template, RandomSeed: 3, Language: language})
+		if err != nil {
+			t.Fatalf("fill %s: %v", language, err)
+		}
+		return question
+	}
+
+	english := fill(templates.LanguageEnglish)
+	v := english.VariableValues
+	wantEnglish := templates.QuestionBody{
+		QuestionText: fmt.Sprintf("A car moving at %v m/s accelerates at %v m/s^2 for %v s. Find its final speed.", v["v0"], v["a"], v["t"]),
+		Options: map[string]string{
+			"A": fmt.Sprintf("%v m/s", v["v0"]), "B": fmt.Sprintf("%v m/s", v["v"]), "C": fmt.Sprintf("%v m/s", v["a"]), "D": "0 m/s",
+		},
+	}
+	wantHindi := templates.QuestionBody{
+		QuestionText: fmt.Sprintf("एक कार %v m/s की चाल से चलते हुए %v s तक %v m/s^2 से त्वरित होती है। उसकी अंतिम चाल ज्ञात कीजिए।", v["v0"], v["t"], v["a"]),
+		Options: map[string]string{
+			"A": fmt.Sprintf("%v मी/से", v["v0"]), "B": fmt.Sprintf("%v मी/से", v["v"]), "C": fmt.Sprintf("%v मी/से", v["a"]), "D": "0 मी/से",
+		},
+	}
+	if want := map[string]templates.QuestionBody{"en": wantEnglish}; !reflect.DeepEqual(english.Bodies, want) {
+		t.Errorf("en: expected bodies %+v, got %+v", want, english.Bodies)
+	}
+
+	// The same seed gives every language the same values and answer
+	hindi := fill(templates.LanguageHindi)
+	if want := map[string]templates.QuestionBody{"hi": wantHindi}; !reflect.DeepEqual(hindi.Bodies, want) {
+		t.Errorf("hi: expected bodies %+v, got %+v", want, hindi.Bodies)
+	}
+	both := fill(templates.LanguageBoth)
+	if want := map[string]templates.QuestionBody{"en": wantEnglish, "hi": wantHindi}; !reflect.DeepEqual(both.Bodies, want) {
+		t.Errorf("both: expected bodies %+v, got %+v", want, both.Bodies)
+	}
+	for _, question := range []*templates.GeneratedQuestion{hindi, both} {
+		if question.CorrectAnswer != english.CorrectAnswer || question.QuestionText != wantEnglish.QuestionText {
+			t.Errorf("expected the English question and answer %q to be unchanged, got %q and %q",
+				english.CorrectAnswer, question.QuestionText, question.CorrectAnswer)
+		}
+	}
+
+	// Without a language the question carries no bodies, as before
+	if plain := fill(""); plain.Bodies != nil || plain.Metadata["language"] != nil {
+		t.Errorf("expected no bodies without a language, got %+v", plain.Bodies)
+	}
+}
+
+func TestHindiRequiresATranslatedTemplate(t *testing.T) {
+	noText := bilingualTemplate()
+	noText.TemplateTextHi = nil
+	noOptions := bilingualTemplate()
+	noOptions.OptionsTemplateHi = nil
+	passage := previewTemplate()
+	passage.Format = "PASSAGE"
+	passage.TemplateTextHi = noOptions.TemplateTextHi
+
+	svc := newTemplateService(t)
+	for _, tc := range []struct {
+		name     string
+		template *db.QuestionTemplate
+		want     string
+	}{
+		{"no Hindi text", noText, "template physics_kinematics_mcq has no Hindi text (template_text_hi)"},
+		{"no Hindi options", noOptions, "template physics_kinematics_mcq has no Hindi options (options_template_hi)"},
+		{"English-only format", passage, "PASSAGE templates are English only"},
+	} {
+		for _, language := range []string{templates.LanguageHindi, templates.LanguageBoth} {
+			_, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: tc.template, RandomSeed: 3, Language: language})
+			if !errors.Is(err, templates.ErrLanguageUnavailable) || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("%s, %s: expected ErrLanguageUnavailable containing %q, got %v", tc.name, language, tc.want, err)
+			}
+		}
+		// English still works
+		if tc.template.Format == "MCQ" {
+			if _, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: tc.template, RandomSeed: 3, Language: templates.LanguageEnglish}); err != nil {
+				t.Errorf("%s: expected English to fill, got %v", tc.name, err)
+			}
+		}
+	}
+
+	// Authoring rejects translations that could never be rendered
+	blank := bilingualTemplate()
+	empty := " "
+	blank.TemplateTextHi = &empty
+	numerical := previewTemplate()
+	numerical.TemplateTextHi = noOptions.TemplateTextHi
+	numerical.OptionsTemplateHi = bilingualTemplate().OptionsTemplateHi
+	short := bilingualTemplate()
+	three := `{"options": {"A": "{{v0}} मी/से", "B": "{{v}} मी/से", "C": "{{a}} मी/से"}}`
+	short.OptionsTemplateHi = &three
+	for name, tc := range map[string]struct {
+		template *db.QuestionTemplate
+		want     string
+	}{
+		"blank text":           {blank, "template_text_hi: must not be empty when set"},
+		"options on NUMERICAL": {numerical, "options_template_hi: is only supported for MCQ templates"},
+		"three options":        {short, "options_template_hi: must have exactly 4 options A, B, C, D, got 3"},
+	} {
+		if err := templates.ValidateTemplate(tc.template); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected a validation error containing %q, got %v", name, tc.want, err)
+		}
+	}
+}
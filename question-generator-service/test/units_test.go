@@ -0,0 +1,299 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"question-generator-service/internal/db"
+	"question-generator-service/pkg/templates"
+	"question-generator-service/pkg/units"
+)
+
+func TestUnitsParseAndConvert(t *testing.T) {
+	newton := units.MustParse("N")
+	if !newton.Compatible(units.MustParse("kg*m/s^2")) {
+		t.Fatal("N must be dimensionally equal to kg*m/s^2")
+	}
+	if newton.Compatible(units.MustParse("J")) {
+		t.Fatal("N and J must not be compatible")
+	}
+
+	speed := units.Quantity{Value: 10, Unit: units.MustParse("m/s")}
+	kmh, err := speed.ConvertTo(units.MustParse("km/h"))
+	if err != nil {
+		t.Fatalf("convert m/s to km/h: %v", err)
+	}
+	if math.Abs(kmh.Value-36) > 1e-9 {
+		t.Fatalf("expected 36 km/h, got %v", kmh.Value)
+	}
+
+	if _, err := units.Parse("furlong/fortnight"); err == nil {
+		t.Fatal("expected an error for unknown units")
+	}
+}
+
+// unitKinematicsTemplate computes v = u + at with declared units
+func unitKinematicsTemplate(timeUnit, answerUnit string) *db.QuestionTemplate {
+	return &db.QuestionTemplate{
+		TemplateID:   "physics_kinematics_units",
+		Subject:      "PHYSICS",
+		Format:       "NUMERICAL",
+		AnswerUnit:   &answerUnit,
+		TemplateText: "A body moving at {{v0}} m/s accelerates at {{a}} m/s^2 for {{t}} s. Find its final velocity.",
+		VariableSlots: `[
+			{"name": "v0", "type": "integer", "unit": "m/s", "range": {"min": 5, "max": 5}},
+			{"name": "a", "type": "integer", "unit": "m/s^2", "range": {"min": 2, "max": 2}},
+			{"name": "t", "type": "integer", "unit": "` + timeUnit + `", "range": {"min": 3, "max": 3}}
+		]`,
+	}
+}
+
+func TestKinematicsAnswerCarriesUnits(t *testing.T) {
+	svc := newTemplateService(t)
+
+	question, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: unitKinematicsTemplate("s", "m/s")})
+	if err != nil {
+		t.Fatalf("fill kinematics template: %v", err)
+	}
+	if question.CorrectAnswer != "11 m/s" {
+		t.Fatalf("expected 5 + 2*3 = 11 m/s, got %q", question.CorrectAnswer)
+	}
+
+	converted, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: unitKinematicsTemplate("s", "km/h")})
+	if err != nil {
+		t.Fatalf("fill kinematics template in km/h: %v", err)
+	}
+	if converted.CorrectAnswer != "39.6 km/h" {
+		t.Fatalf("expected 11 m/s = 39.6 km/h, got %q", converted.CorrectAnswer)
+	}
+}
+
+func TestEquivalentAnswersNormalizeIdentically(t *testing.T) {
+	three := 3
+	cases := []struct {
+		precision *int
+		answers   []string
+		want      string
+	}{
+		{nil, []string{"9 m/s", " 9.0 m/s ", "9.000m/s", "9  m / s", "9.001 m/s"}, "9 m/s"},
+		{nil, []string{"9.8 m/s²", "9.80 m/s^2", "9.799 m/s^2"}, "9.8 m/s^2"},
+		{nil, []string{"-0.001", "0.00", "0"}, "0"},
+		{&three, []string{"9 m/s", "9.0 m/s", "8.9996 m/s"}, "9.000 m/s"},
+		{&three, []string{"1.5e3 J", "1500 J"}, "1500.000 J"},
+		// Text that is not a quantity only has its whitespace tidied
+		{&three, []string{"2 times  the mass", " 2 times the mass"}, "2 times the mass"},
+	}
+	for _, tc := range cases {
+		for _, answer := range tc.answers {
+			if got := templates.CanonicalAnswer(answer, tc.precision); got != tc.want {
+				t.Errorf("expected %q to normalize to %q, got %q", answer, tc.want, got)
+			}
+		}
+	}
+}
+
+func TestAnswerPrecisionIsPerTemplate(t *testing.T) {
+	template := unitKinematicsTemplate("s", "km/h")
+	precision := 3
+	template.AnswerPrecision = &precision
+	question, err := newTemplateService(t).FillTemplate(context.Background(), templates.TemplateFillRequest{Template: template})
+	if err != nil {
+		t.Fatalf("fill kinematics template: %v", err)
+	}
+	if question.CorrectAnswer != "39.600 km/h" {
+		t.Fatalf("expected 11 m/s = 39.600 km/h, got %q", question.CorrectAnswer)
+	}
+
+	precision = templates.MaxAnswerPrecision + 1
+	template.Subject, template.TopicID, template.ExamType, template.Chapter = "PHYSICS", "PHY_KINEMATICS", "JEE_MAIN", "Kinematics"
+	template.BaseDifficulty, template.BloomLevel, template.ConceptDepth = 0.5, 3, 2
+	if err := templates.ValidateTemplate(template); err == nil || !strings.Contains(err.Error(), "answer_precision") {
+		t.Fatalf("expected an answer_precision error, got %v", err)
+	}
+}
+
+func TestKinematicsDimensionalMismatch(t *testing.T) {
+	svc := newTemplateService(t)
+
+	// Time declared in metres makes a*t an m^2/s^2, which cannot be added to u
+	_, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: unitKinematicsTemplate("m", "m/s")})
+	if !errors.Is(err, units.ErrDimensionMismatch) {
+		t.Fatalf("expected ErrDimensionMismatch for mixed units, got %v", err)
+	}
+
+	// A consistent formula still fails against an answer unit of another dimension
+	_, err = svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: unitKinematicsTemplate("s", "N")})
+	if !errors.Is(err, units.ErrDimensionMismatch) {
+		t.Fatalf("expected ErrDimensionMismatch against the answer unit, got %v", err)
+	}
+}
+
+func TestSolutionStepsUseTheFilledValues(t *testing.T) {
+	svc := newTemplateService(t)
+
+	question, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: unitKinematicsTemplate("s", "km/h")})
+	if err != nil {
+		t.Fatalf("fill kinematics template: %v", err)
+	}
+
+	steps := strings.Join(question.SolutionSteps, "\n")
+	for _, want := range []string{
+		"Step 1: Identify the given values: v0 = 5 m/s, a = 2 m/s^2, t = 3 s",
+		"v = u + at",
+		"v = 5 m/s + (2 m/s^2)(3 s) = 5 m/s + 6 m/s",
+		"Final answer: v = 39.6 km/h",
+	} {
+		if !strings.Contains(steps, want) {
+			t.Errorf("expected the solution to contain %q, got:\n%s", want, steps)
+		}
+	}
+}
+
+func TestSolutionStepsSubstituteComputedVariables(t *testing.T) {
+	svc := newTemplateService(t)
+
+	question, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: &db.QuestionTemplate{
+		TemplateID:   "math_sum",
+		Subject:      "MATHEMATICS",
+		Format:       "NUMERICAL",
+		TemplateText: "Add {{x}} and {{y}}.",
+		VariableSlots: `[
+			{"name": "x", "type": "integer", "range": {"min": 4, "max": 4}},
+			{"name": "y", "type": "integer", "range": {"min": 9, "max": 9}},
+			{"name": "sum", "type": "computed", "formula": "{{x}} + {{y}}"}
+		]`,
+	}})
+	if err != nil {
+		t.Fatalf("fill sum template: %v", err)
+	}
+
+	steps := strings.Join(question.SolutionSteps, "\n")
+	for _, want := range []string{"x = 4, y = 9", "Compute sum = x + y = 4 + 9 = 13"} {
+		if !strings.Contains(steps, want) {
+			t.Errorf("expected the solution to contain %q, got:\n%s", want, steps)
+		}
+	}
+}
+
+func TestSolutionStepsOmittedWithoutAFormula(t *testing.T) {
+	svc := newTemplateService(t)
+
+	question, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: &db.QuestionTemplate{
+		TemplateID:    "chem_moles",
+		Subject:       "CHEMISTRY",
+		Format:        "NUMERICAL",
+		TemplateText:  "How many moles are in {{m}} g of water?",
+		VariableSlots: `[{"name": "m", "type": "integer", "range": {"min": 18, "max": 18}}]`,
+	}})
+	if err != nil {
+		t.Fatalf("fill moles template: %v", err)
+	}
+	if len(question.SolutionSteps) != 0 {
+		t.Errorf("expected no steps for a template with nothing to work through, got %q", question.SolutionSteps)
+	}
+}
+
+func TestSolutionStepsFollowTheAnswerFormula(t *testing.T) {
+	svc := newTemplateService(t)
+
+	unit := "m/s"
+	formula := "sqrt({{u2}} + {{twoas}})"
+	question, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: &db.QuestionTemplate{
+		TemplateID:   "physics_final_speed",
+		Subject:      "PHYSICS",
+		Format:       "NUMERICAL",
+		TemplateText: "A body moving at {{u}} m/s accelerates at {{a}} m/s^2 over {{s}} m. Find its final speed.",
+		VariableSlots: `[
+			{"name": "u", "type": "integer", "unit": "m/s", "range": {"min": 3, "max": 3}},
+			{"name": "a", "type": "integer", "unit": "m/s^2", "range": {"min": 2, "max": 2}},
+			{"name": "s", "type": "integer", "unit": "m", "range": {"min": 4, "max": 4}},
+			{"name": "u2", "type": "computed", "formula": "{{u}}^2"},
+			{"name": "twoas", "type": "computed", "formula": "2 * {{a}} * {{s}}"}
+		]`,
+		AnswerUnit:    &unit,
+		AnswerFormula: &formula,
+	}})
+	if err != nil {
+		t.Fatalf("fill final speed template: %v", err)
+	}
+
+	if question.CorrectAnswer != "5 m/s" {
+		t.Errorf("expected the formula to give 5 m/s, got %q", question.CorrectAnswer)
+	}
+	want := []string{
+		"Step 1: Identify the given values: u = 3 m/s, a = 2 m/s^2, s = 4 m",
+		"Step 2: Compute u2 = u^2 = 3^2 = 9",
+		"Step 3: Compute twoas = 2 * a * s = 2 * 2 * 4 = 16",
+		"Step 4: Apply the formula: answer = sqrt(u2 + twoas)",
+		"Step 5: Substitute the values: answer = sqrt(9 + 16) = 5 m/s",
+		"Step 6: Final answer: 5 m/s",
+	}
+	if !reflect.DeepEqual(question.SolutionSteps, want) {
+		t.Errorf("expected steps\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(question.SolutionSteps, "\n"))
+	}
+}
+
+func TestAnswerFormulaSubstitutesNegativeValuesInParentheses(t *testing.T) {
+	svc := newTemplateService(t)
+
+	unit := "m/s"
+	formula := "{{u}} + {{a}} * {{t}}"
+	question, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: &db.QuestionTemplate{
+		TemplateID:   "physics_braking",
+		Subject:      "PHYSICS",
+		Format:       "NUMERICAL",
+		TemplateText: "A car at {{u}} m/s brakes at {{a}} m/s^2 for {{t}} s. Find its speed.",
+		VariableSlots: `[
+			{"name": "u", "type": "integer", "unit": "m/s", "range": {"min": 20, "max": 20}},
+			{"name": "a", "type": "integer", "unit": "m/s^2", "range": {"min": -3, "max": -3}},
+			{"name": "t", "type": "integer", "unit": "s", "range": {"min": 4, "max": 4}}
+		]`,
+		AnswerUnit:    &unit,
+		AnswerFormula: &formula,
+	}})
+	if err != nil {
+		t.Fatalf("fill braking template: %v", err)
+	}
+	if want := "Substitute the values: answer = 20 + (-3) * 4 = 8 m/s"; !strings.Contains(strings.Join(question.SolutionSteps, "\n"), want) {
+		t.Errorf("expected the solution to contain %q, got %v", want, question.SolutionSteps)
+	}
+}
+
+func TestAnswerFormulaErrors(t *testing.T) {
+	svc := newTemplateService(t)
+
+	formula := "{{x}} / ({{x}} - {{x}})"
+	_, err := svc.FillTemplate(context.Background(), templates.TemplateFillRequest{Template: &db.QuestionTemplate{
+		TemplateID:    "math_division",
+		Subject:       "MATHEMATICS",
+		Format:        "NUMERICAL",
+		TemplateText:  "Divide {{x}}.",
+		VariableSlots: `[{"name": "x", "type": "integer", "range": {"min": 2, "max": 2}}]`,
+		AnswerFormula: &formula,
+	}})
+	if err == nil || !strings.Contains(err.Error(), "division by zero") {
+		t.Errorf("expected a division by zero error, got %v", err)
+	}
+
+	for bad, want := range map[string]string{
+		"{{x}} +":       "unexpected end of formula",
+		"{{x}} * {{y}}": "refers to undefined variable y",
+		"speed({{x}})":  `unknown name "speed"`,
+		"({{x}} + 1":    "missing closing parenthesis",
+	} {
+		formula := bad
+		err := templates.ValidateTemplate(&db.QuestionTemplate{
+			TopicID: "MATH_ALGEBRA", ExamType: "JEE_MAIN", Subject: "MATHEMATICS", Format: "NUMERICAL",
+			TemplateText: "Evaluate {{x}}.", BaseDifficulty: 0.5, BloomLevel: 2, ConceptDepth: 1, Chapter: "Algebra",
+			VariableSlots: `[{"name": "x", "type": "integer", "range": {"min": 1, "max": 9}}]`,
+			AnswerFormula: &formula,
+		})
+		if err == nil || !strings.Contains(err.Error(), "answer_formula") || !strings.Contains(err.Error(), want) {
+			t.Errorf("answer formula %q: expected an error containing %q, got %v", bad, want, err)
+		}
+	}
+}
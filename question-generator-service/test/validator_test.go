@@ -0,0 +1,397 @@
+package test
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"question-generator-service/internal/config"
+	"question-generator-service/pkg/validator"
+)
+
+func newValidator(t *testing.T) *validator.Service {
+	t.Helper()
+	svc, err := validator.NewService(config.ValidatorConfig{})
+	if err != nil {
+		t.Fatalf("failed to create validator: %v", err)
+	}
+	return svc
+}
+
+func TestValidateQuestionFlagsDuplicateOptions(t *testing.T) {
+	svc := newValidator(t)
+	req := validator.ValidationRequest{
+		QuestionText:  "A body starts from rest with acceleration 2 m/s^2. What is its velocity after 5 s?",
+		CorrectAnswer: "10 m/s",
+		Options: map[string]string{
+			"A": "10 m/s",
+			"B": "5 m/s",
+			"C": "10.0 m/s",
+			"D": "20 m/s",
+		},
+	}
+
+	result, err := svc.ValidateQuestion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Passed {
+		t.Fatal("question with duplicate options must not pass")
+	}
+	if len(result.DuplicateOptions) != 1 || strings.Join(result.DuplicateOptions[0], "") != "AC" {
+		t.Fatalf("expected options A and C to collide, got %v", result.DuplicateOptions)
+	}
+	if !strings.Contains(result.Feedback, "A=C") {
+		t.Fatalf("feedback should name the colliding options, got %q", result.Feedback)
+	}
+
+	req.Options["C"] = "15 m/s"
+	distinct, err := svc.ValidateQuestion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.OverallScore >= distinct.OverallScore {
+		t.Fatalf("duplicate options should lower the overall score: %.2f >= %.2f", result.OverallScore, distinct.OverallScore)
+	}
+}
+
+func TestValidateQuestionDistinctOptionsPass(t *testing.T) {
+	svc := newValidator(t)
+
+	result, err := svc.ValidateQuestion(context.Background(), validator.ValidationRequest{
+		QuestionText:  "A body starts from rest with acceleration 2 m/s^2. What is its velocity after 5 s?",
+		CorrectAnswer: "10 m/s",
+		Options: map[string]string{
+			"A": "10 m/s",
+			"B": "5 m/s",
+			"C": "15 m/s",
+			"D": "20 m/s",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Passed {
+		t.Fatalf("expected distinct options to pass, feedback: %s", result.Feedback)
+	}
+	if len(result.DuplicateOptions) != 0 {
+		t.Fatalf("expected no duplicate options, got %v", result.DuplicateOptions)
+	}
+}
+
+func TestValidateQuestionNumericalAnswer(t *testing.T) {
+	svc := newValidator(t)
+
+	cases := []struct {
+		name         string
+		answer       string
+		expectedUnit string
+		wantPassed   bool
+		wantFeedback string
+	}{
+		{"valid with unit", "9.8 m/s", "m/s", true, "well formed"},
+		{"valid unitless", "42", "", true, "well formed"},
+		{"non-numeric", "9.8x", "", false, "numerical answer '9.8x' is not a valid number."},
+		{"missing unit", "9.8", "m/s", false, "numerical answer '9.8' is missing unit 'm/s'."},
+		{"wrong unit", "9.8 km/h", "m/s", false, "has unit 'km/h', expected 'm/s'"},
+		{"too precise", "3.14159", "", false, "decimal places"},
+		{"not finite", "1e999", "", false, "not a finite number"},
+	}
+
+	for _, tc := range cases {
+		result, err := svc.ValidateQuestion(context.Background(), validator.ValidationRequest{
+			QuestionText:  "A stone is dropped from rest. What is its speed after 1 s?",
+			CorrectAnswer: tc.answer,
+			ExpectedUnit:  tc.expectedUnit,
+			Format:        "NUMERICAL",
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if result.Passed != tc.wantPassed {
+			t.Errorf("%s: expected passed=%v, got %v (%s)", tc.name, tc.wantPassed, result.Passed, result.Feedback)
+		}
+		if !strings.Contains(result.Feedback, tc.wantFeedback) {
+			t.Errorf("%s: expected feedback containing %q, got %q", tc.name, tc.wantFeedback, result.Feedback)
+		}
+	}
+}
+
+func TestDetectAmbiguityMatchesWholeWordsOnly(t *testing.T) {
+	svc := newValidator(t)
+
+	clean, err := svc.DetectAmbiguity(context.Background(), "Something moves somewhere at a constant speed. Find its displacement.", "PHYSICS")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if clean.AmbiguityScore != 0 || len(clean.MatchedTerms) != 0 {
+		t.Fatalf("terms inside longer words must not match, got %v", clean.MatchedTerms)
+	}
+
+	vague, err := svc.DetectAmbiguity(context.Background(), "Some bodies usually fall faster. Which one?", "PHYSICS")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(vague.MatchedTerms, ",") != "some,usually" {
+		t.Fatalf("expected some and usually to match, got %v", vague.MatchedTerms)
+	}
+	if !strings.Contains(vague.Feedback, "some, usually") || strings.Contains(vague.Feedback, "maybe") {
+		t.Fatalf("feedback should list only the matched terms, got %q", vague.Feedback)
+	}
+}
+
+func TestDetectAmbiguityUsesSubjectTermSets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ambiguity_terms.json")
+	terms := `{
+		"default": {"many": 0.4, "maybe": 0.6},
+		"subjects": {"PHYSICS": {"many": 0}}
+	}`
+	if err := os.WriteFile(path, []byte(terms), 0o644); err != nil {
+		t.Fatalf("failed to write terms file: %v", err)
+	}
+
+	svc, err := validator.NewService(config.ValidatorConfig{AmbiguityTermsFile: path})
+	if err != nil {
+		t.Fatalf("failed to create validator: %v", err)
+	}
+
+	const text = "How many moles of oxygen are required for complete combustion?"
+	physics, err := svc.DetectAmbiguity(context.Background(), text, "PHYSICS")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if physics.AmbiguityScore != 0 {
+		t.Fatalf("many is disabled for PHYSICS, got score %.2f (%v)", physics.AmbiguityScore, physics.MatchedTerms)
+	}
+
+	chemistry, err := svc.DetectAmbiguity(context.Background(), text, "CHEMISTRY")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if chemistry.AmbiguityScore != 0.4 {
+		t.Fatalf("expected the default weight 0.4 for many, got %.2f", chemistry.AmbiguityScore)
+	}
+}
+
+func TestCheckGrammarHandlesUnicodeAndLatex(t *testing.T) {
+	svc := newValidator(t)
+
+	cases := []struct {
+		name       string
+		text       string
+		wantPassed bool
+	}{
+		{"plain question", "What is the acceleration due to gravity?", true},
+		{"ends after inline math", "The kinetic energy is proportional to $v^2$?", true},
+		{"punctuation inside closing math", "Find the value of $x$ such that $x^2 = 4.$", true},
+		{"starts with math", "$\\alpha$ particles are emitted by which nucleus?", true},
+		{"starts with display math", "$$F = ma$$ Which law does this equation express?", true},
+		{"starts with greek symbol", "λ is the wavelength of the emitted photon. Find its energy.", true},
+		{"multibyte ending", "Le résultat final est égal à quelle énergie … ?", true},
+		{"ends with multibyte rune", "The resistance of the wire is 5 Ω", false},
+		{"math without punctuation", "The kinetic energy is proportional to $v^2$", false},
+		{"lowercase start", "what is the acceleration due to gravity?", false},
+	}
+
+	for _, tc := range cases {
+		result, err := svc.CheckGrammar(context.Background(), tc.text)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if result.Passed != tc.wantPassed {
+			t.Errorf("%s: expected passed=%v, got %v (%s)", tc.name, tc.wantPassed, result.Passed, result.Feedback)
+		}
+	}
+}
+
+func TestValidateQuestionFlagsUnemphasizedNegation(t *testing.T) {
+	svc := newValidator(t)
+
+	cases := []struct {
+		name     string
+		text     string
+		wantFlag bool
+	}{
+		{"capitalized", "Which of the following statements is NOT correct?", false},
+		{"markdown bold", "All of the following are noble gases **except** which one?", false},
+		{"latex bold", "Which of the following is \\textbf{incorrect} about enzymes?", false},
+		{"lowercase not", "Which of the following statements is not correct?", true},
+		{"lowercase except", "All of the following are noble gases except which one?", true},
+		{"no negation", "Which of the following statements is correct?", false},
+	}
+
+	for _, tc := range cases {
+		result, err := svc.ValidateQuestion(context.Background(), validator.ValidationRequest{QuestionText: tc.text})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if result.NegationFlag != tc.wantFlag {
+			t.Errorf("%s: expected NegationFlag=%v, got %v", tc.name, tc.wantFlag, result.NegationFlag)
+		}
+		if !result.Passed {
+			t.Errorf("%s: negation must not fail the question (%s)", tc.name, result.Feedback)
+		}
+		if tc.wantFlag && !strings.Contains(result.Feedback, "should be emphasized") {
+			t.Errorf("%s: expected emphasis recommendation, got %q", tc.name, result.Feedback)
+		}
+	}
+
+	plain, _ := svc.ValidateQuestion(context.Background(), validator.ValidationRequest{QuestionText: "Which of the following statements is NOT correct?"})
+	flagged, _ := svc.ValidateQuestion(context.Background(), validator.ValidationRequest{QuestionText: "Which of the following statements is not correct?"})
+	if flagged.ClarityScore >= plain.ClarityScore {
+		t.Fatalf("unemphasized negation should lower clarity: %.2f >= %.2f", flagged.ClarityScore, plain.ClarityScore)
+	}
+}
+
+// newGrammarService fakes a LanguageTool-style checker answering with handler
+func newGrammarService(t *testing.T, handler http.HandlerFunc) *validator.Service {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	svc, err := validator.NewService(config.ValidatorConfig{
+		GrammarChecker:        "HTTP",
+		GrammarCheckerURL:     srv.URL + "/v2/check",
+		GrammarCheckerTimeout: 100 * time.Millisecond,
+		GrammarLanguage:       "en-US",
+	})
+	if err != nil {
+		t.Fatalf("failed to create validator: %v", err)
+	}
+	return svc
+}
+
+func TestExternalGrammarFindingsAreMerged(t *testing.T) {
+	var gotText, gotLanguage string
+	svc := newGrammarService(t, func(w http.ResponseWriter, r *http.Request) {
+		gotText, gotLanguage = r.FormValue("text"), r.FormValue("language")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"matches": [
+			{"message": "Possible agreement error"},
+			{"message": "Did you mean \"its\"?"}
+		]}`)
+	})
+
+	const text = "A ball are thrown upward with it's initial speed of 10 m/s. Find the maximum height."
+	result, err := svc.CheckGrammar(context.Background(), text)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotText != text || gotLanguage != "en-US" {
+		t.Errorf("expected the question text in en-US, got %q in %q", gotText, gotLanguage)
+	}
+	heuristic, _ := newValidator(t).CheckGrammar(context.Background(), text)
+	if want := heuristic.GrammarScore - 0.2; math.Abs(result.GrammarScore-want) > 1e-9 {
+		t.Errorf("expected each finding to lower the grammar score to %v, got %v", want, result.GrammarScore)
+	}
+	if !strings.Contains(result.Feedback, "Possible agreement error") || strings.Contains(result.Feedback, "looks good") {
+		t.Errorf("expected the findings in place of the all-clear, got %q", result.Feedback)
+	}
+	if !result.Passed {
+		t.Errorf("expected two findings to leave the question passing")
+	}
+}
+
+func TestManyExternalGrammarFindingsFailTheQuestion(t *testing.T) {
+	svc := newGrammarService(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"matches": [{"message": "one"}, {"message": "two"}, {"message": "three"}, {"message": "four"}]}`)
+	})
+
+	result, err := svc.CheckGrammar(context.Background(), "Find the velocity of the block after 3 s.")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Passed || !strings.Contains(result.Feedback, "one; two; three (and 1 more)") {
+		t.Errorf("expected the question to fail with three findings quoted, got %+v", result)
+	}
+}
+
+func TestExternalGrammarFailureFallsBackToHeuristics(t *testing.T) {
+	const text = "Find the velocity of the block after 3 s."
+	heuristic, _ := newValidator(t).CheckGrammar(context.Background(), text)
+
+	for name, handler := range map[string]http.HandlerFunc{
+		"server error": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+		},
+		"malformed body": func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "{")
+		},
+		"timeout": func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(500 * time.Millisecond)
+		},
+	} {
+		result, err := newGrammarService(t, handler).CheckGrammar(context.Background(), text)
+		if err != nil {
+			t.Fatalf("%s: expected the heuristics to answer, got %v", name, err)
+		}
+		if *result != *heuristic {
+			t.Errorf("%s: expected the heuristic result %+v, got %+v", name, heuristic, result)
+		}
+	}
+}
+
+func TestExamSubjectCompatibility(t *testing.T) {
+	request := func(examType, subject string) *validator.GenerateQuestionRequest {
+		return &validator.GenerateQuestionRequest{
+			StudentID: "s1", TopicID: "T1", ExamType: examType, Subject: subject,
+			Format: "MCQ", RequestedDifficulty: 0.5, RequestID: "req-1",
+		}
+	}
+	subjectError := func(errs []validator.ValidationError) string {
+		for _, e := range errs {
+			if e.Field == "subject" || e.Field == "exam_type" {
+				return e.Field + ": " + e.Message
+			}
+		}
+		return ""
+	}
+
+	cases := []struct {
+		exam, subject string
+		want          string // Empty when the pair is allowed
+	}{
+		{"JEE_MAIN", "MATHEMATICS", ""},
+		{"JEE_MAIN", "BIOLOGY", "subject: JEE_MAIN exam does not include BIOLOGY. Its subjects are: PHYSICS, CHEMISTRY, MATHEMATICS"},
+		{"JEE_ADVANCED", "PHYSICS", ""},
+		{"JEE_ADVANCED", "BIOLOGY", ""},
+		{"NEET", "BIOLOGY", ""},
+		{"NEET", "MATHEMATICS", "subject: NEET exam does not include MATHEMATICS. Its subjects are: PHYSICS, CHEMISTRY, BIOLOGY"},
+		{"FOUNDATION", "BIOLOGY", ""},
+		{"BITSAT", "PHYSICS", "exam_type: Invalid exam type. Must be one of: FOUNDATION, JEE_ADVANCED, JEE_MAIN, NEET"},
+	}
+	for _, tc := range cases {
+		got := subjectError(validator.ValidateRequest(request(tc.exam, tc.subject)))
+		if tc.want == "" && got != "" || !strings.HasPrefix(got, tc.want) {
+			t.Errorf("%s/%s: expected %q, got %q", tc.exam, tc.subject, tc.want, got)
+		}
+	}
+
+	// A new exam type is a configuration change
+	validator.SetExamSubjects(map[string][]string{
+		"NEET":   {"PHYSICS", "CHEMISTRY", "BIOLOGY"},
+		"BITSAT": {"PHYSICS", "CHEMISTRY", "MATHEMATICS"},
+	})
+	t.Cleanup(func() { validator.SetExamSubjects(config.DefaultExamSubjects) })
+
+	for _, tc := range []struct {
+		exam, subject string
+		want          string
+	}{
+		{"BITSAT", "MATHEMATICS", ""},
+		{"BITSAT", "BIOLOGY", "subject: BITSAT exam does not include BIOLOGY. Its subjects are: PHYSICS, CHEMISTRY, MATHEMATICS"},
+		{"NEET", "CHEMISTRY", ""},
+		{"JEE_MAIN", "PHYSICS", "exam_type: Invalid exam type. Must be one of: BITSAT, NEET"},
+	} {
+		got := subjectError(validator.ValidateRequest(request(tc.exam, tc.subject)))
+		if tc.want == "" && got != "" || !strings.HasPrefix(got, tc.want) {
+			t.Errorf("configured %s/%s: expected %q, got %q", tc.exam, tc.subject, tc.want, got)
+		}
+	}
+}